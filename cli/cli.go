@@ -97,6 +97,11 @@ func (s *Subcommand) Config() *config.Config {
 	return s.config
 }
 
+// ConfigPath returns the path passed with --config, empty for the default locations (see config.ParseConfig).
+func (s *Subcommand) ConfigPath() string {
+	return rootArgs.configPath
+}
+
 func (s *Subcommand) run(cmd *cobra.Command, args []string) {
 	s.tryParseConfig()
 	ctx := context.Background()
@@ -135,9 +140,10 @@ func addSubcommandToCobraCmd(c *cobra.Command, s *Subcommand) {
 		Short:   s.Short,
 		Example: s.Example,
 	}
-	if s.SetupSubcommands == nil {
+	if s.Run != nil {
 		cmd.Run = s.run
-	} else {
+	}
+	if s.SetupSubcommands != nil {
 		for _, sub := range s.SetupSubcommands() {
 			addSubcommandToCobraCmd(&cmd, sub)
 		}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon"
+)
+
+var BandwidthLimitCmd = &cli.Subcommand{
+	Use:   "bandwidth-limit JOB [RATE]",
+	Short: "show or change the replication bandwidth limit of a running job (RATE is e.g. 50MiB/s or unlimited)",
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		return runBandwidthLimitCmd(subcommand.Config(), args)
+	},
+}
+
+func runBandwidthLimitCmd(config *config.Config, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.Errorf("Expected 1 or 2 arguments: JOB [RATE]")
+	}
+	req := daemon.BandwidthLimitRequest{Name: args[0]}
+	if len(args) == 2 {
+		req.Rate = args[1]
+	}
+
+	httpc, err := controlHttpClient(config.Global.Control.SockPath)
+	if err != nil {
+		return err
+	}
+
+	var res daemon.BandwidthLimitResponse
+	err = jsonRequestResponse(httpc, daemon.ControlJobEndpointBandwidthLimit, req, &res)
+	if err != nil {
+		return err
+	}
+	if res.Rate == 0 {
+		fmt.Println("unlimited")
+	} else {
+		fmt.Printf("%s/s\n", ByteCountBinary(res.Rate))
+	}
+	return nil
+}
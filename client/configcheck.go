@@ -15,6 +15,8 @@ import (
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/job"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 )
 
@@ -28,7 +30,7 @@ var ConfigcheckCmd = &cli.Subcommand{
 	Short: "check if config can be parsed without errors",
 	SetupFlags: func(f *pflag.FlagSet) {
 		f.StringVar(&configcheckArgs.format, "format", "", "dump parsed config object [pretty|yaml|json]")
-		f.StringVar(&configcheckArgs.what, "what", "all", "what to print [all|config|jobs|logging]")
+		f.StringVar(&configcheckArgs.what, "what", "all", "what to print [all|config|jobs|logging|snapshot-names]")
 	},
 	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
 		formatMap := map[string]func(interface{}){
@@ -56,6 +58,11 @@ var ConfigcheckCmd = &cli.Subcommand{
 		}
 
 		var hadErr bool
+
+		if err := setupZFSAbstractionsNamespace(subcommand); err != nil {
+			return err
+		}
+
 		// further: try to build jobs
 		confJobs, err := job.JobsFromConfig(subcommand.Config())
 		if err != nil {
@@ -104,6 +111,18 @@ var ConfigcheckCmd = &cli.Subcommand{
 			"logging": func() {
 				formatter(outlets)
 			},
+			"snapshot-names": func() {
+				// independent of --format, for use in the `regex` of keep rules
+				snapshotNames, err := snapshotNamesFromConfig(subcommand.Config())
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", errors.Wrap(err, "cannot build snapshotting from config"))
+					hadErr = true
+					return
+				}
+				for _, n := range snapshotNames {
+					fmt.Printf("%s\t%s\n", n.job, n.regex)
+				}
+			},
 		}
 
 		wf, ok := whatMap[configcheckArgs.what]
@@ -119,3 +138,39 @@ var ConfigcheckCmd = &cli.Subcommand{
 		}
 	},
 }
+
+type snapshotName struct {
+	job, regex string
+}
+
+// snapshotNamesFromConfig returns regular expressions for the names of the snapshots that the jobs create, in config order.
+func snapshotNamesFromConfig(c *config.Config) ([]snapshotName, error) {
+	var names []snapshotName
+	for _, j := range c.Jobs {
+		var snapshotting config.SnapshottingEnum
+		switch v := j.Ret.(type) {
+		case *config.PushJob:
+			snapshotting = v.Snapshotting
+		case *config.SourceJob:
+			snapshotting = v.Snapshotting
+		case *config.SnapJob:
+			snapshotting = v.Snapshotting
+		case *config.LocalJob:
+			snapshotting = v.Snapshotting
+		default:
+			continue
+		}
+		jobID, err := endpoint.MakeJobID(j.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "job %q: invalid job name", j.Name())
+		}
+		s, err := snapper.FromConfig(c.Global, nil, snapshotting, jobID, endpoint.NewSnapshotStepHolds{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "job %q", j.Name())
+		}
+		for _, re := range s.NameRegexes() {
+			names = append(names, snapshotName{j.Name(), re})
+		}
+	}
+	return names, nil
+}
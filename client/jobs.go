@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon"
+)
+
+var JobsCmd = &cli.Subcommand{
+	Use:   "jobs",
+	Short: "manage the jobs in global.control.jobs_dir of the running daemon",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			jobsCmd("create", "create a job from a spec in the schema of the config file's `jobs` entries (SPEC_FILE - for stdin)", "SPEC_FILE"),
+			jobsCmd("modify", "replace the spec of the job with the same name", "SPEC_FILE"),
+			jobsCmd("delete", "stop a job and remove its spec", "JOB"),
+			jobsCmd("list", "print the specs of the jobs", ""),
+		}
+	},
+}
+
+func jobsCmd(op, short, arg string) *cli.Subcommand {
+	use := op
+	if arg != "" {
+		use += " " + arg
+	}
+	return &cli.Subcommand{
+		Use:   use,
+		Short: short,
+		Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+			return runJobsCmd(subcommand.Config(), op, arg != "", args)
+		},
+	}
+}
+
+func runJobsCmd(config *config.Config, op string, hasArg bool, args []string) error {
+	if hasArg && len(args) != 1 {
+		return errors.Errorf("Expected 1 argument")
+	} else if !hasArg && len(args) != 0 {
+		return errors.Errorf("Expected no arguments")
+	}
+
+	req := daemon.JobsRequest{Op: op}
+	switch op {
+	case "create", "modify":
+		var spec []byte
+		var err error
+		if args[0] == "-" {
+			spec, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			spec, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot read job spec")
+		}
+		req.Spec = string(spec)
+	case "delete":
+		req.Name = args[0]
+	}
+
+	httpc, err := controlHttpClient(config.Global.Control.SockPath)
+	if err != nil {
+		return err
+	}
+	var res daemon.JobsResponse
+	if err := jsonRequestResponse(httpc, daemon.ControlJobEndpointJobs, req, &res); err != nil {
+		return err
+	}
+
+	if op == "list" {
+		names := make([]string, 0, len(res.Specs))
+		for name := range res.Specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			if i > 0 {
+				fmt.Println("---")
+			}
+			fmt.Print(strings.TrimSuffix(res.Specs[name], "\n") + "\n")
+		}
+		return nil
+	}
+	for _, l := range []struct {
+		what string
+		jobs []string
+	}{
+		{"started", res.Reload.Started},
+		{"stopped", res.Reload.Stopped},
+		{"restarted", res.Reload.Restarted},
+		{"reconfigured", res.Reload.Reconfigured},
+	} {
+		if len(l.jobs) > 0 {
+			fmt.Printf("%s: %s\n", l.what, strings.Join(l.jobs, ", "))
+		}
+	}
+	if len(res.Reload.Stopped) > 0 || len(res.Reload.Restarted) > 0 {
+		fmt.Println("stopped and restarted jobs finish their current replication step first, new jobs start afterwards")
+	}
+	return nil
+}
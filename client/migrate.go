@@ -124,6 +124,9 @@ var fail = color.New(color.FgRed)
 var migrateReplicationCursorSkipSentinel = fmt.Errorf("skipping this filesystem")
 
 func doMigrateReplicationCursor(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
 	if len(args) != 0 {
 		return fmt.Errorf("migration does not take arguments, got %v", args)
 	}
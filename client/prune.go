@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+var pruneCmdFlags struct {
+	DryRun bool
+}
+
+var PruneCmd = &cli.Subcommand{
+	Use:     "prune JOB --dry-run",
+	Short:   "print which snapshots the pruning of a running job would destroy, and which keep rules keep the others",
+	Example: `  zrepl prune backup_job --dry-run`,
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		return runPruneCmd(ctx, subcommand.Config(), args)
+	},
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.BoolVar(&pruneCmdFlags.DryRun, "dry-run", false, "plan the pruning without destroying snapshots")
+	},
+}
+
+func runPruneCmd(ctx context.Context, config *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("Expected 1 argument: JOB")
+	}
+	if !pruneCmdFlags.DryRun {
+		return errors.Errorf("only --dry-run is supported, jobs prune after each invocation (see `zrepl signal wakeup`)")
+	}
+	jobName := args[0]
+
+	httpc, err := controlHttpClient(config.Global.Control.SockPath)
+	if err != nil {
+		return err
+	}
+
+	requested := time.Now()
+	err = jsonRequestResponse(httpc, daemon.ControlJobEndpointPruneDryRun,
+		daemon.PruneDryRunRequest{Name: jobName},
+		struct{}{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// the dry run lists the snapshots of all filesystems, which takes longer than a control request may
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		var s daemon.Status
+		if err := jsonRequestResponse(httpc, daemon.StatusFilter{Job: jobName}.StatusEndpoint(), struct{}{}, &s); err != nil {
+			return err
+		}
+		js, ok := s.Jobs[jobName]
+		if !ok {
+			return errors.Errorf("Job %s does not exist", jobName)
+		}
+		rep := pruneDryRunReport(js)
+		if rep == nil || rep.StartAt.Before(requested) || !rep.Done() {
+			continue
+		}
+		printPruneDryRun(os.Stdout, rep)
+		return nil
+	}
+}
+
+func pruneDryRunReport(s *job.Status) *job.PruneDryRunReport {
+	switch st := s.JobSpecific.(type) {
+	case *job.ActiveSideStatus:
+		return st.PruneDryRun
+	case *job.SnapJobStatus:
+		return st.PruneDryRun
+	case *job.PassiveStatus:
+		return st.PruneDryRun
+	default:
+		return nil
+	}
+}
+
+func printPruneDryRun(w io.Writer, rep *job.PruneDryRunReport) {
+	for i, side := range rep.Sides {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if side.Report.Error != "" {
+			fmt.Fprintf(w, "%s: error: %s\n", side.Side, side.Report.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", side.Side)
+		for _, fs := range side.Report.Completed {
+			printPruneDryRunFS(w, fs)
+		}
+	}
+}
+
+func printPruneDryRunFS(w io.Writer, fs pruner.FSReport) {
+	if !fs.SkipReason.NotSkipped() {
+		fmt.Fprintf(w, "  %s: skipped: %s\n", fs.Filesystem, fs.SkipReason)
+		return
+	}
+	if fs.LastError != "" {
+		fmt.Fprintf(w, "  %s: error: %s\n", fs.Filesystem, fs.LastError)
+		return
+	}
+	rules := "keep rules"
+	if fs.Override != "" {
+		rules = fmt.Sprintf("keep rules of %s", fs.Override)
+	}
+	if len(fs.BookmarkList) > 0 {
+		fmt.Fprintf(w, "  %s: destroy %d of %d snapshots and %d of %d bookmarks (%s)\n", fs.Filesystem,
+			len(fs.DestroyList), len(fs.SnapshotList), len(fs.BookmarkDestroyList), len(fs.BookmarkList), rules)
+	} else {
+		fmt.Fprintf(w, "  %s: destroy %d of %d snapshots (%s)\n", fs.Filesystem, len(fs.DestroyList), len(fs.SnapshotList), rules)
+	}
+	printPruneDryRunList(w, "@", fs.SnapshotList, fs.DestroyList)
+	printPruneDryRunList(w, "#", fs.BookmarkList, fs.BookmarkDestroyList)
+}
+
+// sep is @ for snapshots and # for bookmarks
+func printPruneDryRunList(w io.Writer, sep string, list, destroyList []pruner.SnapshotReport) {
+	destroy := make(map[string]bool, len(destroyList))
+	for _, s := range destroyList {
+		destroy[s.Name] = true
+	}
+	for _, s := range list {
+		if destroy[s.Name] {
+			fmt.Fprintf(w, "    destroy  %s%s\n", sep, s.Name)
+			continue
+		}
+		keptBy := "no keep rules"
+		if len(s.KeptBy) > 0 {
+			keptBy = strings.Join(s.KeptBy, ", ")
+		}
+		fmt.Fprintf(w, "    keep     %s%s  (%s)\n", sep, s.Name, keptBy)
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon"
+)
+
+var DaemonReloadCmd = &cli.Subcommand{
+	Use:   "reload",
+	Short: "make the running daemon re-read its config file and apply the changed jobs (same as SIGHUP)",
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		return runDaemonReloadCmd(subcommand.Config(), args)
+	},
+}
+
+func runDaemonReloadCmd(config *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errors.Errorf("Expected no arguments")
+	}
+
+	httpc, err := controlHttpClient(config.Global.Control.SockPath)
+	if err != nil {
+		return err
+	}
+
+	var res daemon.ReloadResponse
+	err = jsonRequestResponse(httpc, daemon.ControlJobEndpointReload, struct{}{}, &res)
+	if err != nil {
+		return err
+	}
+	for _, l := range []struct {
+		what string
+		jobs []string
+	}{
+		{"started", res.Started},
+		{"stopped", res.Stopped},
+		{"restarted", res.Restarted},
+		{"reconfigured", res.Reconfigured},
+		{"unchanged", res.Unchanged},
+	} {
+		if len(l.jobs) > 0 {
+			fmt.Printf("%s: %s\n", l.what, strings.Join(l.jobs, ", "))
+		}
+	}
+	if len(res.Stopped) > 0 || len(res.Restarted) > 0 {
+		fmt.Println("stopped and restarted jobs finish their current replication step first, new jobs start afterwards")
+	}
+	return nil
+}
@@ -4,23 +4,37 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 
 	"github.com/zrepl/zrepl/cli"
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon"
 )
 
+var signalCmdFlags struct {
+	Filesystems []string
+}
+
 var SignalCmd = &cli.Subcommand{
-	Use:   "signal [wakeup|reset] JOB",
-	Short: "wake up a job from wait state or abort its current invocation",
+	Use:   "signal [wakeup|reset|plan] JOB",
+	Short: "wake up a job from wait state, abort its current invocation, or plan its replication without executing it (see `zrepl status`)",
+	Example: `  zrepl signal wakeup backup_job
+  zrepl signal wakeup backup_job --fs pool/db --fs 'pool/vm<'`,
 	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
 		return runSignalCmd(subcommand.Config(), args)
 	},
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.StringArrayVar(&signalCmdFlags.Filesystems, "fs", nil,
+			"wakeup only: replicate only this filesystem (sending-side name, suffix `<` for the filesystem and its descendants), may be repeated")
+	},
 }
 
 func runSignalCmd(config *config.Config, args []string) error {
 	if len(args) != 2 {
-		return errors.Errorf("Expected 2 arguments: [wakeup|reset] JOB")
+		return errors.Errorf("Expected 2 arguments: [wakeup|reset|plan] JOB")
+	}
+	if len(signalCmdFlags.Filesystems) > 0 && args[0] != "wakeup" {
+		return errors.Errorf("--fs is only supported for wakeup")
 	}
 
 	httpc, err := controlHttpClient(config.Global.Control.SockPath)
@@ -30,11 +44,13 @@ func runSignalCmd(config *config.Config, args []string) error {
 
 	err = jsonRequestResponse(httpc, daemon.ControlJobEndpointSignal,
 		struct {
-			Name string
-			Op   string
+			Name        string
+			Op          string
+			Filesystems []string `json:",omitempty"`
 		}{
-			Name: args[1],
-			Op:   args[0],
+			Name:        args[1],
+			Op:          args[0],
+			Filesystems: signalCmdFlags.Filesystems,
 		},
 		struct{}{},
 	)
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon"
+)
+
+var snapshotCmdFlags struct {
+	Filesystems []string
+}
+
+var SnapshotCmd = &cli.Subcommand{
+	Use:   "snapshot JOB",
+	Short: "make a running job take snapshots right away, including its snapshotting hooks (see `zrepl status`)",
+	Example: `  zrepl snapshot backup_job
+  zrepl snapshot backup_job --fs pool/db --fs 'pool/vm<'`,
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		return runSnapshotCmd(subcommand.Config(), args)
+	},
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.StringArrayVar(&snapshotCmdFlags.Filesystems, "fs", nil,
+			"snapshot only this filesystem of the job (suffix `<` for the filesystem and its descendants), may be repeated")
+	},
+}
+
+func runSnapshotCmd(config *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("Expected 1 argument: JOB")
+	}
+
+	httpc, err := controlHttpClient(config.Global.Control.SockPath)
+	if err != nil {
+		return err
+	}
+
+	return jsonRequestResponse(httpc, daemon.ControlJobEndpointSnapshot,
+		daemon.SnapshotRequest{
+			Name:        args[0],
+			Filesystems: snapshotCmdFlags.Filesystems,
+		},
+		struct{}{},
+	)
+}
@@ -81,9 +81,12 @@ type tui struct {
 	x, y   int
 	indent int
 
-	lock   sync.Mutex //For report and error
-	report map[string]*job.Status
-	err    error
+	lock      sync.Mutex //For report and error
+	report    map[string]*job.Status
+	after     map[string]*daemon.AfterStatus
+	shutdown  *daemon.ShutdownStatus
+	selfCheck *daemon.SelfCheckStatus
+	err       error
 
 	jobFilter string
 
@@ -167,16 +170,28 @@ func (t *tui) addIndent(indent int) {
 }
 
 var statusFlags struct {
-	Raw bool
-	Job string
+	Raw         bool
+	Format      string
+	Job         string
+	Filesystems []string
+}
+
+// statusFilter is applied by the daemon, so that only the matching parts of the status are transferred.
+func statusFilter() daemon.StatusFilter {
+	return daemon.StatusFilter{Job: statusFlags.Job, Filesystems: statusFlags.Filesystems}
 }
 
 var StatusCmd = &cli.Subcommand{
 	Use:   "status",
 	Short: "show job activity or dump as JSON for monitoring",
+	Example: `  zrepl status --job prod_to_backups --fs 'pool/db/*'
+  zrepl status --format json --fs 'pool/vm<'`,
 	SetupFlags: func(f *pflag.FlagSet) {
 		f.BoolVar(&statusFlags.Raw, "raw", false, "dump raw status description from zrepl daemon")
+		f.StringVar(&statusFlags.Format, "format", "", "dump status once in the given format instead of showing it interactively (json)")
 		f.StringVar(&statusFlags.Job, "job", "", "only dump specified job")
+		f.StringArrayVar(&statusFlags.Filesystems, "fs", nil,
+			"only dump filesystems matching this pattern (e.g. 'pool/db/*', suffix `<` for the filesystem and its descendants), may be repeated")
 	},
 	Run: runStatus,
 }
@@ -187,8 +202,22 @@ func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
 		return err
 	}
 
+	if err := statusFilter().Validate(); err != nil {
+		return err
+	}
+	if statusFlags.Raw && statusFlags.Format != "" {
+		return errors.New("--raw and --format are mutually exclusive")
+	}
+	switch statusFlags.Format {
+	case "":
+	case "json":
+		return runStatusJSON(httpc)
+	default:
+		return errors.Errorf("unsupported --format %q, must be json", statusFlags.Format)
+	}
+
 	if statusFlags.Raw {
-		resp, err := httpc.Get("http://unix" + daemon.ControlJobEndpointStatus)
+		resp, err := httpc.Get("http://unix" + statusFilter().StatusEndpoint())
 		if err != nil {
 			return err
 		}
@@ -222,7 +251,7 @@ func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
 	update := func() {
 		var m daemon.Status
 
-		err2 := jsonRequestResponse(httpc, daemon.ControlJobEndpointStatus,
+		err2 := jsonRequestResponse(httpc, statusFilter().StatusEndpoint(),
 			struct{}{},
 			&m,
 		)
@@ -230,6 +259,9 @@ func runStatus(ctx context.Context, s *cli.Subcommand, args []string) error {
 		t.lock.Lock()
 		t.err = err2
 		t.report = m.Jobs
+		t.after = m.After
+		t.shutdown = m.Shutdown
+		t.selfCheck = m.SelfCheck
 		t.lock.Unlock()
 		t.draw()
 	}
@@ -286,6 +318,13 @@ func (t *tui) draw() {
 	if t.err != nil {
 		t.write(t.err.Error())
 	} else {
+		if t.shutdown != nil {
+			t.renderShutdownStatus(t.shutdown)
+		}
+		if t.selfCheck != nil && t.jobFilter == "" {
+			t.renderSelfCheckStatus(t.selfCheck)
+		}
+
 		//Iterate over map in alphabetical order
 		keys := make([]string, 0, len(t.report))
 		for k := range t.report {
@@ -318,20 +357,33 @@ func (t *tui) draw() {
 			t.printf("Type: %s", v.Type)
 			t.setIndent(1)
 			t.newline()
+			if after, ok := t.after[k]; ok {
+				t.renderAfterStatus(after)
+			}
 
-			if v.Type == job.TypePush || v.Type == job.TypePull {
+			if v.Type == job.TypePush || v.Type == job.TypePull || v.Type == job.TypeLocal {
 				activeStatus, ok := v.JobSpecific.(*job.ActiveSideStatus)
 				if !ok || activeStatus == nil {
 					t.printf("ActiveSideStatus is null")
 					t.newline()
 					continue
 				}
+				t.renderFailureBackoff(activeStatus.FailureBackoff)
 
-				t.printf("Replication:")
-				t.newline()
-				t.addIndent(1)
-				t.renderReplicationReport(activeStatus.Replication, t.getReplicationProgressHistory(k))
-				t.addIndent(-1)
+				if len(activeStatus.Targets) == 0 {
+					t.renderActiveSideReplication(activeStatus.Replication, activeStatus.DryRun, t.getReplicationProgressHistory(k))
+				}
+				for _, target := range activeStatus.Targets {
+					t.printf("Target %s:", target.Name)
+					t.newline()
+					t.addIndent(1)
+					t.renderActiveSideReplication(target.Replication, target.DryRun, t.getReplicationProgressHistory(k+"/"+target.Name))
+					t.printf("Pruning Receiver:")
+					t.newline()
+					t.addIndent(1)
+					t.renderPrunerReport(target.PruningReceiver)
+					t.addIndent(-2)
+				}
 
 				t.printf("Pruning Sender:")
 				t.newline()
@@ -339,13 +391,16 @@ func (t *tui) draw() {
 				t.renderPrunerReport(activeStatus.PruningSender)
 				t.addIndent(-1)
 
-				t.printf("Pruning Receiver:")
-				t.newline()
-				t.addIndent(1)
-				t.renderPrunerReport(activeStatus.PruningReceiver)
-				t.addIndent(-1)
+				if len(activeStatus.Targets) == 0 {
+					t.printf("Pruning Receiver:")
+					t.newline()
+					t.addIndent(1)
+					t.renderPrunerReport(activeStatus.PruningReceiver)
+					t.addIndent(-1)
+				}
+				t.renderScheduledPruning(activeStatus.ScheduledPruning)
 
-				if v.Type == job.TypePush {
+				if v.Type == job.TypePush || v.Type == job.TypeLocal {
 					t.printf("Snapshotting:")
 					t.newline()
 					t.addIndent(1)
@@ -360,6 +415,7 @@ func (t *tui) draw() {
 					t.newline()
 					continue
 				}
+				t.renderFailureBackoff(snapStatus.FailureBackoff)
 				t.printf("Pruning snapshots:")
 				t.newline()
 				t.addIndent(1)
@@ -370,9 +426,28 @@ func (t *tui) draw() {
 				t.addIndent(1)
 				t.renderSnapperReport(snapStatus.Snapshotting)
 				t.addIndent(-1)
+			} else if v.Type == job.TypeVerify {
+				st, ok := v.JobSpecific.(*job.VerifyJobStatus)
+				if !ok || st == nil {
+					t.printf("VerifyJobStatus is null")
+					t.newline()
+					continue
+				}
+				t.printf("Verification:")
+				t.newline()
+				t.addIndent(1)
+				t.renderVerifyReport(st.Report)
+				t.addIndent(-1)
 			} else if v.Type == job.TypeSource {
 
 				st := v.JobSpecific.(*job.PassiveStatus)
+				if st.Pruning != nil {
+					t.printf("Pruning snapshots:")
+					t.newline()
+					t.addIndent(1)
+					t.renderPrunerReport(st.Pruning)
+					t.addIndent(-1)
+				}
 				t.printf("Snapshotting:\n")
 				t.addIndent(1)
 				t.renderSnapperReport(st.Snapper)
@@ -396,6 +471,130 @@ func (t *tui) draw() {
 	termbox.Flush()
 }
 
+func (t *tui) renderAfterStatus(s *daemon.AfterStatus) {
+	t.printf("After (runs once all completed successfully):")
+	t.newline()
+	t.addIndent(1)
+	for _, j := range s.Jobs {
+		var state string
+		switch {
+		case j.Completed:
+			state = "completed"
+		case j.Latest == nil:
+			state = "waiting, no invocation completed yet"
+		case j.Latest.Error != "":
+			state = "waiting, latest invocation failed"
+		default:
+			state = "waiting"
+		}
+		t.printf("%s: %s", j.Name, state)
+		if j.Latest != nil {
+			t.printf(" (latest invocation completed %s ago)", humanizeDuration(time.Since(j.Latest.CompletedAt)))
+		}
+		t.newline()
+	}
+	t.addIndent(-1)
+}
+
+func (t *tui) renderFailureBackoff(s *job.FailureBackoffStatus) {
+	if s == nil {
+		return
+	}
+	t.printf("Backing off until %s (in %s) after %d failed invocation(s), `zrepl signal wakeup` invokes the job now",
+		s.Until.Format(time.Stamp), humanizeDuration(time.Until(s.Until)), s.Failures)
+	t.newline()
+	t.addIndent(1)
+	if s.Deferred {
+		t.printf("A trigger arrived in the meantime, the job is invoked when the backoff ends")
+		t.newline()
+	}
+	t.printfDrawIndentedAndWrappedIfMultiline("Latest error: %s", s.LastError)
+	t.newline()
+	t.addIndent(-1)
+}
+
+func (t *tui) renderScheduledPruning(r *job.ScheduledPruningReport) {
+	if r == nil {
+		return
+	}
+	if !r.Done() {
+		t.printf("Scheduled Pruning: started %s ago", humanizeDuration(time.Since(r.StartAt)))
+		t.newline()
+		return
+	}
+	t.printf("Scheduled Pruning: finished at %s", r.DoneAt.Format(time.Stamp))
+	t.newline()
+	t.addIndent(1)
+	for _, side := range r.Sides {
+		t.printf("%s:", side.Side)
+		t.newline()
+		t.addIndent(1)
+		t.renderPrunerReport(side.Report)
+		t.addIndent(-1)
+	}
+	t.addIndent(-1)
+}
+
+func (t *tui) renderShutdownStatus(s *daemon.ShutdownStatus) {
+	t.setIndent(0)
+	abortIn := time.Until(s.Deadline)
+	if abortIn < 0 {
+		abortIn = 0
+	}
+	t.printf("Daemon is shutting down (for %s), jobs that are still running are aborted in %s",
+		humanizeDuration(time.Since(s.Since)), humanizeDuration(abortIn))
+	t.newline()
+	t.setIndent(1)
+	if len(s.Draining) > 0 {
+		t.printf("Waiting for the current step of: %s", strings.Join(s.Draining, ", "))
+	} else {
+		t.printf("All jobs drained")
+	}
+	t.newline()
+	t.setIndent(0)
+	t.newline()
+}
+
+func (t *tui) renderSelfCheckStatus(s *daemon.SelfCheckStatus) {
+	t.setIndent(0)
+	if s.Last == nil {
+		t.printf("Self-check: no check completed yet (interval %s), `zrepl signal wakeup _self_check` runs it now", s.Interval)
+		t.newline()
+		t.newline()
+		return
+	}
+	t.printf("Self-check: %d invariant violation(s), %d error(s) (completed %s ago)",
+		len(s.Last.Violations), len(s.Last.Errors), humanizeDuration(time.Since(s.Last.FinishAt)))
+	t.newline()
+	t.setIndent(1)
+	for _, v := range s.Last.Violations {
+		t.printfDrawIndentedAndWrappedIfMultiline("%s: %s (job %s): %s", v.Invariant, v.Filesystem, v.Job, v.Description)
+		t.newline()
+	}
+	for _, e := range s.Last.Errors {
+		t.printfDrawIndentedAndWrappedIfMultiline("error: %s", e)
+		t.newline()
+	}
+	t.setIndent(0)
+	t.newline()
+}
+
+func (t *tui) renderActiveSideReplication(rep *report.Report, dryRun *report.AttemptReport, history *bytesProgressHistory) {
+	t.printf("Replication:")
+	t.newline()
+	t.addIndent(1)
+	t.renderReplicationReport(rep, history)
+	t.addIndent(-1)
+
+	if dryRun != nil {
+		t.printf("Replication Plan (dry run):")
+		t.newline()
+		t.addIndent(1)
+		t.renderDryRunReport(dryRun)
+		t.addIndent(-1)
+	}
+}
+
 func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgressHistory) {
 	if rep == nil {
 		t.printf("...\n")
@@ -450,12 +649,19 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 
 	t.printf("Status: %s", latest.State)
 	t.newline()
+	if len(latest.SelectedFilesystems) > 0 {
+		t.printf("Selected filesystems: %s", strings.Join(latest.SelectedFilesystems, ", "))
+		t.newline()
+	}
 	if latest.State == report.AttemptPlanningError {
 		t.printf("Problem: ")
 		t.printfDrawIndentedAndWrappedIfMultiline("%s", latest.PlanError)
 		t.newline()
 	} else if latest.State == report.AttemptFanOutError {
 		t.printf("Problem: one or more of the filesystems encountered errors")
+		if skipped := len(latest.FilesystemsByState()[report.FilesystemSkipped]); skipped > 0 {
+			t.printf(", %d filesystem(s) skipped (on_error: %s)", skipped, latest.OnError)
+		}
 		t.newline()
 	}
 
@@ -465,7 +671,11 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 		expected, replicated, containsInvalidSizeEstimates := latest.BytesSum()
 		rate, changeCount := history.Update(replicated)
 		eta := time.Duration(0)
-		if rate > 0 {
+		if latest.BytesPerSecond > 0 {
+			// computed by the daemon over a sliding window
+			rate, eta = latest.BytesPerSecond, latest.ETA
+		} else if rate > 0 {
+			// daemon does not report throughput
 			eta = time.Duration((expected-replicated)/rate) * time.Second
 		}
 		t.write("Progress: ")
@@ -494,6 +704,134 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 
 }
 
+func (t *tui) renderDryRunReport(rep *report.AttemptReport) {
+	t.printf("Status: %s", rep.State)
+	if !rep.FinishAt.IsZero() {
+		t.printf(" (planned at %s, took %s)", rep.FinishAt.Round(time.Second), rep.FinishAt.Sub(rep.StartAt).Round(time.Millisecond))
+	}
+	t.newline()
+	if rep.State == report.AttemptPlanningError {
+		t.printf("Problem: ")
+		t.printfDrawIndentedAndWrappedIfMultiline("%s", rep.PlanError)
+		t.newline()
+		return
+	}
+	if rep.State != report.AttemptDone {
+		return
+	}
+	if len(rep.Filesystems) == 0 {
+		t.printf("no filesystems to replicate")
+		t.newline()
+		return
+	}
+	expected, _, containsInvalidSizeEstimates := rep.BytesSum()
+	t.printf("Total: %s", ByteCountBinary(expected))
+	if containsInvalidSizeEstimates {
+		t.printf(" (some steps lack size estimation)")
+	}
+	t.newline()
+	for _, fs := range rep.Filesystems {
+		if fs.State == report.FilesystemPlanningErrored {
+			t.printfDrawIndentedAndWrappedIfMultiline("%s: CONFLICT or ERROR: %s", fs.Info.Name, fs.PlanError)
+			t.newline()
+			continue
+		}
+		if len(fs.Steps) == 0 {
+			t.printf("%s: up to date", fs.Info.Name)
+			t.newline()
+			continue
+		}
+		fsExpected, _, _ := fs.BytesSum()
+		t.printf("%s: %d step(s), %s", fs.Info.Name, len(fs.Steps), ByteCountBinary(fsExpected))
+		t.newline()
+		t.addIndent(1)
+		for _, s := range fs.Steps {
+			from := s.Info.From
+			if from == "" {
+				from = "full"
+			}
+			resumed := ""
+			if s.Info.Resumed {
+				resumed = " (resumed)"
+			}
+			size := "size unknown"
+			if s.Info.BytesExpected > 0 {
+				size = ByteCountBinary(s.Info.BytesExpected)
+			}
+			t.printf("%s => %s%s, %s", from, s.Info.To, resumed, size)
+			t.newline()
+		}
+		t.addIndent(-1)
+	}
+}
+
+func (t *tui) renderVerifyReport(r *job.VerifyReport) {
+	if r == nil {
+		t.printf("...\n")
+		return
+	}
+	if r.FinishAt.IsZero() {
+		t.printf("Status: running since %s\n", r.StartAt.Format(time.RFC3339))
+	} else {
+		t.printf("Status: done at %s (took %s)\n", r.FinishAt.Format(time.RFC3339), humanizeDuration(r.FinishAt.Sub(r.StartAt)))
+	}
+	if r.Err != "" {
+		t.printfDrawIndentedAndWrappedIfMultiline("ERROR: %s\n", r.Err)
+		return
+	}
+	if len(r.Filesystems) == 0 {
+		t.printf("no replicated filesystems\n")
+		return
+	}
+	mismatches, errs := r.Mismatches()
+	var total, done int
+	var maxFSname int
+	for _, fs := range r.Filesystems {
+		for _, p := range fs.Pairs {
+			total++
+			if p.State != job.VerifyPairPending {
+				done++
+			}
+		}
+		if maxFSname < len(fs.Name) {
+			maxFSname = len(fs.Name)
+		}
+	}
+	t.printf("Progress: %d/%d snapshot(s), %d mismatch(es), %d error(s)\n", done, total, mismatches, errs)
+
+	for _, fs := range r.Filesystems {
+		t.write(rightPad(fs.Name, maxFSname, " "))
+		t.write(" ")
+		if fs.Err != "" {
+			t.printfDrawIndentedAndWrappedIfMultiline("ERROR: %s\n", fs.Err)
+			continue
+		}
+		if len(fs.Pairs) == 0 {
+			t.printf("no common snapshots\n")
+			continue
+		}
+		t.newline()
+		t.addIndent(1)
+		for _, p := range fs.Pairs {
+			stream := fmt.Sprintf("full %s", p.To)
+			if p.From != "" {
+				stream = fmt.Sprintf("%s => %s", p.From, p.To)
+			}
+			switch p.State {
+			case job.VerifyPairMismatch:
+				t.printf("%s MISMATCH (sender %s, receiver %s)\n", stream, p.SenderDigest, p.ReceiverDigest)
+			case job.VerifyPairError:
+				t.printfDrawIndentedAndWrappedIfMultiline("%s ERROR: %s\n", stream, p.Err)
+			case job.VerifyPairMatch:
+				t.printf("%s match (%s)\n", stream, ByteCountBinary(p.StreamSize))
+			default:
+				t.printf("%s %s\n", stream, p.State)
+			}
+		}
+		t.addIndent(-1)
+	}
+}
+
 func (t *tui) renderPrunerReport(r *pruner.Report) {
 	if r == nil {
 		t.printf("...\n")
@@ -543,6 +881,10 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 		totalDestroyCount += len(fs.DestroyList)
 		if fs.completed {
 			completedDestroyCount += len(fs.DestroyList)
+		} else if fs.DestroysDone < len(fs.DestroyList) {
+			completedDestroyCount += fs.DestroysDone // the snapshots are destroyed before the bookmarks
+		} else {
+			completedDestroyCount += len(fs.DestroyList)
 		}
 		if maxFSname < len(fs.Filesystem) {
 			maxFSname = len(fs.Filesystem)
@@ -585,12 +927,27 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 
 		pruneRuleActionStr := fmt.Sprintf("(destroy %d of %d snapshots)",
 			len(fs.DestroyList), len(fs.SnapshotList))
+		if len(fs.KeptList) > 0 {
+			pruneRuleActionStr = fmt.Sprintf("(destroy %d of %d snapshots, %d kept by target: %s)",
+				len(fs.DestroyList)-len(fs.KeptList), len(fs.SnapshotList), len(fs.KeptList), fs.KeptList[0].KeptReason)
+		}
+		if len(fs.BookmarkList) > 0 {
+			pruneRuleActionStr = fmt.Sprintf("%s, %d of %d bookmarks)", strings.TrimSuffix(pruneRuleActionStr, ")"),
+				len(fs.BookmarkDestroyList)-len(fs.BookmarkKeptList), len(fs.BookmarkList))
+		}
+		if fs.Override != "" {
+			pruneRuleActionStr = fmt.Sprintf("%s, keep rules of %s)", strings.TrimSuffix(pruneRuleActionStr, ")"), fs.Override)
+		}
 
 		if fs.completed {
 			t.printf("Completed  %s\n", pruneRuleActionStr)
 			continue
 		}
 
+		if fs.DestroysDone > 0 {
+			t.printf("Destroying %d/%d %s\n", fs.DestroysDone, len(fs.DestroyList)+len(fs.BookmarkDestroyList), pruneRuleActionStr)
+			continue
+		}
 		t.write("Pending    ") // whitespace is padding 10
 		if len(fs.DestroyList) == 1 {
 			t.write(fs.DestroyList[0].Name)
@@ -600,6 +957,17 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 		t.newline()
 	}
 
+	if sr := r.SpaceReclaim; sr != nil {
+		switch {
+		case sr.Waiting:
+			t.printf("Space reclaim: waiting for destroyed snapshots to be freed (since %s)\n", sr.StartedAt.Format(time.Stamp))
+		case sr.Error != "":
+			t.printf("Space reclaim: ERROR: %s\n", sr.Error)
+		default:
+			t.printf("Space reclaim: done (took %s)\n", sr.DoneAt.Sub(sr.StartedAt).Round(time.Second))
+		}
+	}
+
 }
 
 func (t *tui) renderSnapperReport(r *snapper.Report) {
@@ -608,6 +976,9 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 		return
 	}
 
+	if r.Rule != "" {
+		t.printf("Rule: %s\n", r.Rule)
+	}
 	t.printf("Status: %s", r.State)
 	t.newline()
 
@@ -655,6 +1026,9 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 		case snapper.SnapError:
 			r.duration = dur(fs.DoneAt.Sub(fs.StartAt))
 			r.remainder = fmt.Sprintf("snap name: %q", fs.SnapName)
+		case snapper.SnapSkipped:
+			r.duration = ""
+			r.remainder = "unchanged since last snapshot"
 		}
 		rows[i] = r
 		if len(r.path) > widths.path {
@@ -680,6 +1054,9 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 		t.newline()
 	}
 
+	for _, rule := range r.Rules {
+		t.renderSnapperReport(rule)
+	}
 }
 
 func times(str string, n int) (out string) {
@@ -728,10 +1105,15 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 		sizeEstimationImpreciseNotice = " (step lacks size estimation)"
 	}
 
-	status := fmt.Sprintf("%s (step %d/%d, %s/%s)%s",
+	var rate string
+	if bytesPerSecond := rep.BytesPerSecond(); bytesPerSecond > 0 {
+		rate = fmt.Sprintf(" @ %s/s", ByteCountBinary(bytesPerSecond))
+	}
+
+	status := fmt.Sprintf("%s (step %d/%d, %s/%s%s)%s",
 		strings.ToUpper(string(rep.State)),
 		rep.CurrentStep, len(rep.Steps),
-		ByteCountBinary(replicated), ByteCountBinary(expected),
+		ByteCountBinary(replicated), ByteCountBinary(expected), rate,
 		sizeEstimationImpreciseNotice,
 	)
 
@@ -759,6 +1141,9 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 			if nextStep.Info.Resumed {
 				attribs = append(attribs, "resumed")
 			}
+			if nextStep.Info.Deferred {
+				attribs = append(attribs, "deferred")
+			}
 
 			attribs = append(attribs, fmt.Sprintf("encrypted=%s", nextStep.Info.Encrypted))
 
@@ -771,6 +1156,19 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 	t.printfDrawIndentedAndWrappedIfMultiline("%s", next)
 
 	t.newline()
+
+	if len(rep.Info.Downstream) > 0 {
+		t.addIndent(1)
+		for _, d := range rep.Info.Downstream {
+			if d.Cursor == "" {
+				t.printf("downstream %s: nothing replicated yet", d.Job)
+			} else {
+				t.printf("downstream %s: up to %s (lag %s)", d.Job, d.Cursor, humanizeDuration(time.Since(d.CursorCreation)))
+			}
+			t.newline()
+		}
+		t.addIndent(-1)
+	}
 }
 
 func ByteCountBinary(b int64) string {
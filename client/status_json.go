@@ -0,0 +1,524 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// statusJSONSchemaVersion is the version of the schema of `zrepl status --format json`.
+//
+// Unlike the daemon's status (`zrepl status --raw`), whose types change between releases,
+// the schema only changes compatibly, i.e., by adding fields, unless the version is incremented.
+const statusJSONSchemaVersion = 1
+
+// The types of the schema: timestamps are RFC 3339 strings, null if the event did not happen (yet).
+// Optional fields are absent if they do not apply to the job.
+//
+// The states are constants of the schema, not the names of the daemon's internal states,
+// so that renaming the latter does not break scripts. Internal states without a schema constant are reported as unknown.
+
+const statusJSONStateUnknown = "unknown"
+
+// states of statusJSONReplication
+const (
+	statusJSONReplicationPlanning      = "planning"
+	statusJSONReplicationPlanningError = "planning-error"
+	statusJSONReplicationFanOutFSs     = "fan-out-filesystems"
+	statusJSONReplicationFSError       = "filesystem-error"
+	statusJSONReplicationDone          = "done"
+)
+
+// states of statusJSONReplicationFS
+const (
+	statusJSONReplicationFSPlanning      = "planning"
+	statusJSONReplicationFSPlanningError = "planning-error"
+	statusJSONReplicationFSStepping      = "stepping"
+	statusJSONReplicationFSStepError     = "step-error"
+	statusJSONReplicationFSDone          = "done"
+	statusJSONReplicationFSSkipped       = "skipped"
+)
+
+// states of statusJSONPruneSide
+const (
+	statusJSONPruneSidePlan      = "plan"
+	statusJSONPruneSidePlanError = "plan-error"
+	statusJSONPruneSideExec      = "exec"
+	statusJSONPruneSideExecError = "exec-error"
+	statusJSONPruneSideDone      = "done"
+)
+
+// states of statusJSONPruneFS
+const (
+	statusJSONPruneFSPending = "pending"
+	statusJSONPruneFSDone    = "done"
+	statusJSONPruneFSSkipped = "skipped"
+	statusJSONPruneFSError   = "error"
+)
+
+// states of statusJSONSnapshotting
+const (
+	statusJSONSnapshottingSyncUp        = "sync-up"
+	statusJSONSnapshottingSyncUpErrWait = "sync-up-error-wait"
+	statusJSONSnapshottingPlanning      = "planning"
+	statusJSONSnapshottingSnapshotting  = "snapshotting"
+	statusJSONSnapshottingWaiting       = "waiting"
+	statusJSONSnapshottingErrorWait     = "error-wait"
+	statusJSONSnapshottingStopped       = "stopped"
+)
+
+// states of statusJSONSnapshotFS
+const (
+	statusJSONSnapshotFSPending = "pending"
+	statusJSONSnapshotFSStarted = "started"
+	statusJSONSnapshotFSDone    = "done"
+	statusJSONSnapshotFSError   = "error"
+	statusJSONSnapshotFSSkipped = "skipped"
+)
+
+type statusJSON struct {
+	SchemaVersion int `json:"schema_version"`
+	// ordered by name, without internal jobs
+	Jobs []*statusJSONJob `json:"jobs"`
+}
+
+type statusJSONJob struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// push and pull jobs, absent until the first replication; push jobs with `targets` report Targets instead
+	Replication *statusJSONReplication `json:"replication,omitempty"`
+	Targets     []*statusJSONTarget    `json:"targets,omitempty"`
+	// the most recent pruning of each side of the job, and of its scheduled pruning (see field `pruning.triggers`)
+	Pruning      []*statusJSONPruneSide  `json:"pruning,omitempty"`
+	Snapshotting *statusJSONSnapshotting `json:"snapshotting,omitempty"`
+	// absent unless the job backs off after failed invocations
+	FailureBackoff *statusJSONFailureBackoff `json:"failure_backoff,omitempty"`
+	// verify jobs, absent until the first verification
+	Verify *statusJSONVerify `json:"verify,omitempty"`
+}
+
+type statusJSONTarget struct {
+	Name        string                 `json:"name"`
+	Replication *statusJSONReplication `json:"replication,omitempty"`
+	Pruning     *statusJSONPruneSide   `json:"pruning,omitempty"`
+}
+
+// statusJSONReplication is the most recent replication, its fields other than StartAt, FinishAt
+// and Attempts are those of its most recent attempt.
+type statusJSONReplication struct {
+	StartAt  *time.Time `json:"start_at"`
+	FinishAt *time.Time `json:"finish_at"`
+	Attempts int        `json:"attempts"`
+	// planning, planning-error, fan-out-filesystems, filesystem-error or done, empty if there was no attempt yet
+	State string `json:"state"`
+	// the planning error, or the error that makes the replication wait for reconnection
+	Error           string                     `json:"error,omitempty"`
+	BytesExpected   int64                      `json:"bytes_expected"`
+	BytesReplicated int64                      `json:"bytes_replicated"`
+	BytesPerSecond  int64                      `json:"bytes_per_second"`
+	ETASeconds      int64                      `json:"eta_seconds"`
+	Filesystems     []*statusJSONReplicationFS `json:"filesystems"`
+}
+
+type statusJSONReplicationFS struct {
+	Name string `json:"name"`
+	// planning, planning-error, stepping, step-error, done or skipped
+	State           string `json:"state"`
+	Error           string `json:"error,omitempty"`
+	StepsDone       int    `json:"steps_done"`
+	Steps           int    `json:"steps"`
+	BytesExpected   int64  `json:"bytes_expected"`
+	BytesReplicated int64  `json:"bytes_replicated"`
+}
+
+type statusJSONPruneSide struct {
+	// sender, receiver or local (snap and source jobs), "receiver (target NAME)" for push jobs with `targets`
+	Side string `json:"side"`
+	// true for the pruning triggered by field `pruning.triggers`
+	Scheduled bool `json:"scheduled"`
+	// plan, plan-error, exec, exec-error or done, empty while a scheduled pruning plans
+	State       string               `json:"state"`
+	Error       string               `json:"error,omitempty"`
+	Filesystems []*statusJSONPruneFS `json:"filesystems"`
+}
+
+type statusJSONPruneFS struct {
+	Name string `json:"name"`
+	// pending, done, skipped or error
+	State string `json:"state"`
+	// the skip reason in state skipped, the error in state error
+	Error     string `json:"error,omitempty"`
+	Snapshots int    `json:"snapshots"`
+	// names of the snapshots and bookmarks that are destroyed, without the filesystem
+	Destroy          []string `json:"destroy"`
+	DestroyBookmarks []string `json:"destroy_bookmarks,omitempty"`
+	// the number of destroys of Destroy, followed by DestroyBookmarks, that are done so far
+	DestroysDone int `json:"destroys_done"`
+}
+
+type statusJSONSnapshotting struct {
+	Rule string `json:"rule,omitempty"`
+	// sync-up, sync-up-error-wait, planning, snapshotting, waiting, error-wait or stopped
+	State       string                    `json:"state"`
+	SleepUntil  *time.Time                `json:"sleep_until"`
+	Error       string                    `json:"error,omitempty"`
+	Filesystems []*statusJSONSnapshotFS   `json:"filesystems"`
+	Rules       []*statusJSONSnapshotting `json:"rules,omitempty"`
+}
+
+type statusJSONSnapshotFS struct {
+	Name string `json:"name"`
+	// pending, started, done, error or skipped
+	State         string     `json:"state"`
+	Snapshot      string     `json:"snapshot,omitempty"`
+	StartAt       *time.Time `json:"start_at"`
+	DoneAt        *time.Time `json:"done_at"`
+	HooksHadError bool       `json:"hooks_had_error"`
+}
+
+type statusJSONFailureBackoff struct {
+	Failures  int        `json:"failures"`
+	LastError string     `json:"last_error"`
+	Until     *time.Time `json:"until"`
+	Deferred  bool       `json:"deferred"`
+}
+
+type statusJSONVerify struct {
+	StartAt  *time.Time `json:"start_at"`
+	FinishAt *time.Time `json:"finish_at"`
+	Error    string     `json:"error,omitempty"`
+	// of the verified filesystems and snapshot pairs
+	Mismatches int `json:"mismatches"`
+	Errors     int `json:"errors"`
+}
+
+func writeStatusJSON(w io.Writer, s *daemon.Status) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(statusJSONFromDaemon(s))
+}
+
+func statusJSONFromDaemon(s *daemon.Status) *statusJSON {
+	names := make([]string, 0, len(s.Jobs))
+	for name := range s.Jobs {
+		if name == "" || daemon.IsInternalJobName(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := &statusJSON{SchemaVersion: statusJSONSchemaVersion, Jobs: make([]*statusJSONJob, 0, len(names))}
+	for _, name := range names {
+		out.Jobs = append(out.Jobs, statusJSONJobFromStatus(name, s.Jobs[name]))
+	}
+	return out
+}
+
+func statusJSONJobFromStatus(name string, s *job.Status) *statusJSONJob {
+	j := &statusJSONJob{Name: name, Type: string(s.Type)}
+	switch st := s.JobSpecific.(type) {
+	case *job.ActiveSideStatus:
+		j.Replication = statusJSONReplicationFromReport(st.Replication)
+		for _, t := range st.Targets {
+			j.Targets = append(j.Targets, &statusJSONTarget{
+				Name:        t.Name,
+				Replication: statusJSONReplicationFromReport(t.Replication),
+				Pruning:     statusJSONPruneSideFromReport(fmt.Sprintf("receiver (target %s)", t.Name), false, t.PruningReceiver),
+			})
+		}
+		j.Pruning = appendStatusJSONPruneSides(j.Pruning,
+			statusJSONPruneSideFromReport("sender", false, st.PruningSender),
+			statusJSONPruneSideFromReport("receiver", false, st.PruningReceiver))
+		if sp := st.ScheduledPruning; sp != nil {
+			for _, side := range sp.Sides {
+				j.Pruning = appendStatusJSONPruneSides(j.Pruning, statusJSONPruneSideFromReport(side.Side, true, side.Report))
+			}
+		}
+		j.Snapshotting = statusJSONSnapshottingFromReport(st.Snapshotting)
+		j.FailureBackoff = statusJSONFailureBackoffFromStatus(st.FailureBackoff)
+	case *job.SnapJobStatus:
+		j.Pruning = appendStatusJSONPruneSides(j.Pruning, statusJSONPruneSideFromReport("local", false, st.Pruning))
+		j.Snapshotting = statusJSONSnapshottingFromReport(st.Snapshotting)
+		j.FailureBackoff = statusJSONFailureBackoffFromStatus(st.FailureBackoff)
+	case *job.PassiveStatus:
+		j.Pruning = appendStatusJSONPruneSides(j.Pruning, statusJSONPruneSideFromReport("local", false, st.Pruning))
+		j.Snapshotting = statusJSONSnapshottingFromReport(st.Snapper)
+	case *job.VerifyJobStatus:
+		if r := st.Report; r != nil {
+			j.Verify = &statusJSONVerify{StartAt: jsonTime(r.StartAt), FinishAt: jsonTime(r.FinishAt), Error: r.Err}
+			j.Verify.Mismatches, j.Verify.Errors = r.Mismatches()
+		}
+	}
+	return j
+}
+
+// jsonTime returns nil for the zero time
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// returns nil if r is nil
+func statusJSONReplicationFromReport(r *report.Report) *statusJSONReplication {
+	if r == nil {
+		return nil
+	}
+	out := &statusJSONReplication{
+		StartAt:     jsonTime(r.StartAt),
+		FinishAt:    jsonTime(r.FinishAt),
+		Attempts:    len(r.Attempts),
+		Filesystems: []*statusJSONReplicationFS{},
+	}
+	if r.WaitReconnectError != nil {
+		out.Error = r.WaitReconnectError.Err
+	}
+	if len(r.Attempts) == 0 {
+		return out
+	}
+	a := r.Attempts[len(r.Attempts)-1]
+	out.State = statusJSONReplicationState(a.State)
+	if a.PlanError != nil {
+		out.Error = a.PlanError.Err
+	}
+	out.BytesExpected, out.BytesReplicated, _ = a.BytesSum()
+	out.BytesPerSecond = a.BytesPerSecond
+	out.ETASeconds = int64(a.ETA / time.Second)
+	for _, fs := range a.Filesystems {
+		f := &statusJSONReplicationFS{
+			Name:      fs.Info.Name,
+			State:     statusJSONReplicationFSState(fs.State),
+			StepsDone: fs.CurrentStep,
+			Steps:     len(fs.Steps),
+		}
+		if err := fs.Error(); err != nil {
+			f.Error = err.Err
+		}
+		f.BytesExpected, f.BytesReplicated, _ = fs.BytesSum()
+		out.Filesystems = append(out.Filesystems, f)
+	}
+	return out
+}
+
+// returns nil if r is nil
+func statusJSONPruneSideFromReport(side string, scheduled bool, r *pruner.Report) *statusJSONPruneSide {
+	if r == nil {
+		return nil
+	}
+	out := &statusJSONPruneSide{
+		Side:        side,
+		Scheduled:   scheduled,
+		State:       statusJSONPruneSideState(r.State),
+		Error:       r.Error,
+		Filesystems: []*statusJSONPruneFS{},
+	}
+	add := func(fs pruner.FSReport, state string) {
+		f := &statusJSONPruneFS{
+			Name:         fs.Filesystem,
+			State:        state,
+			Snapshots:    len(fs.SnapshotList),
+			Destroy:      snapshotReportNames(fs.DestroyList),
+			DestroysDone: fs.DestroysDone,
+		}
+		if len(fs.BookmarkDestroyList) > 0 {
+			f.DestroyBookmarks = snapshotReportNames(fs.BookmarkDestroyList)
+		}
+		switch {
+		case !fs.SkipReason.NotSkipped():
+			f.State, f.Error = statusJSONPruneFSSkipped, string(fs.SkipReason)
+		case fs.LastError != "":
+			f.State, f.Error = statusJSONPruneFSError, fs.LastError
+		}
+		out.Filesystems = append(out.Filesystems, f)
+	}
+	for _, fs := range r.Pending {
+		add(fs, statusJSONPruneFSPending)
+	}
+	for _, fs := range r.Completed {
+		add(fs, statusJSONPruneFSDone)
+	}
+	return out
+}
+
+func snapshotReportNames(l []pruner.SnapshotReport) []string {
+	names := make([]string, len(l))
+	for i, s := range l {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// skips nil sides
+func appendStatusJSONPruneSides(sides []*statusJSONPruneSide, add ...*statusJSONPruneSide) []*statusJSONPruneSide {
+	for _, s := range add {
+		if s != nil {
+			sides = append(sides, s)
+		}
+	}
+	return sides
+}
+
+// returns nil if r is nil
+func statusJSONSnapshottingFromReport(r *snapper.Report) *statusJSONSnapshotting {
+	if r == nil {
+		return nil
+	}
+	out := &statusJSONSnapshotting{
+		Rule:        r.Rule,
+		State:       statusJSONSnapshottingState(r.State),
+		SleepUntil:  jsonTime(r.SleepUntil),
+		Error:       r.Error,
+		Filesystems: []*statusJSONSnapshotFS{},
+	}
+	for _, fs := range r.Progress {
+		out.Filesystems = append(out.Filesystems, &statusJSONSnapshotFS{
+			Name:          fs.Path,
+			State:         statusJSONSnapshotFSState(fs.State),
+			Snapshot:      fs.SnapName,
+			StartAt:       jsonTime(fs.StartAt),
+			DoneAt:        jsonTime(fs.DoneAt),
+			HooksHadError: fs.HooksHadError,
+		})
+	}
+	for _, rule := range r.Rules {
+		out.Rules = append(out.Rules, statusJSONSnapshottingFromReport(rule))
+	}
+	return out
+}
+
+func statusJSONReplicationState(s report.AttemptState) string {
+	switch s {
+	case report.AttemptPlanning:
+		return statusJSONReplicationPlanning
+	case report.AttemptPlanningError:
+		return statusJSONReplicationPlanningError
+	case report.AttemptFanOutFSs:
+		return statusJSONReplicationFanOutFSs
+	case report.AttemptFanOutError:
+		return statusJSONReplicationFSError
+	case report.AttemptDone:
+		return statusJSONReplicationDone
+	default:
+		return statusJSONStateUnknown
+	}
+}
+
+func statusJSONReplicationFSState(s report.FilesystemState) string {
+	switch s {
+	case report.FilesystemPlanning:
+		return statusJSONReplicationFSPlanning
+	case report.FilesystemPlanningErrored:
+		return statusJSONReplicationFSPlanningError
+	case report.FilesystemStepping:
+		return statusJSONReplicationFSStepping
+	case report.FilesystemSteppingErrored:
+		return statusJSONReplicationFSStepError
+	case report.FilesystemDone:
+		return statusJSONReplicationFSDone
+	case report.FilesystemSkipped:
+		return statusJSONReplicationFSSkipped
+	default:
+		return statusJSONStateUnknown
+	}
+}
+
+// s is the name of a pruner.State, empty while a scheduled pruning plans
+func statusJSONPruneSideState(s string) string {
+	if s == "" {
+		return ""
+	}
+	state, err := pruner.StateString(s)
+	if err != nil {
+		return statusJSONStateUnknown
+	}
+	switch state {
+	case pruner.Plan:
+		return statusJSONPruneSidePlan
+	case pruner.PlanErr:
+		return statusJSONPruneSidePlanError
+	case pruner.Exec:
+		return statusJSONPruneSideExec
+	case pruner.ExecErr:
+		return statusJSONPruneSideExecError
+	case pruner.Done:
+		return statusJSONPruneSideDone
+	default:
+		return statusJSONStateUnknown
+	}
+}
+
+func statusJSONSnapshottingState(s snapper.State) string {
+	switch s {
+	case snapper.SyncUp:
+		return statusJSONSnapshottingSyncUp
+	case snapper.SyncUpErrWait:
+		return statusJSONSnapshottingSyncUpErrWait
+	case snapper.Planning:
+		return statusJSONSnapshottingPlanning
+	case snapper.Snapshotting:
+		return statusJSONSnapshottingSnapshotting
+	case snapper.Waiting:
+		return statusJSONSnapshottingWaiting
+	case snapper.ErrorWait:
+		return statusJSONSnapshottingErrorWait
+	case snapper.Stopped:
+		return statusJSONSnapshottingStopped
+	default:
+		return statusJSONStateUnknown
+	}
+}
+
+func statusJSONSnapshotFSState(s snapper.SnapState) string {
+	switch s {
+	case snapper.SnapPending:
+		return statusJSONSnapshotFSPending
+	case snapper.SnapStarted:
+		return statusJSONSnapshotFSStarted
+	case snapper.SnapDone:
+		return statusJSONSnapshotFSDone
+	case snapper.SnapError:
+		return statusJSONSnapshotFSError
+	case snapper.SnapSkipped:
+		return statusJSONSnapshotFSSkipped
+	default:
+		return statusJSONStateUnknown
+	}
+}
+
+// returns nil if s is nil
+func statusJSONFailureBackoffFromStatus(s *job.FailureBackoffStatus) *statusJSONFailureBackoff {
+	if s == nil {
+		return nil
+	}
+	return &statusJSONFailureBackoff{
+		Failures:  s.Failures,
+		LastError: s.LastError,
+		Until:     jsonTime(s.Until),
+		Deferred:  s.Deferred,
+	}
+}
+
+func runStatusJSON(httpc http.Client) error {
+	var s daemon.Status
+	if err := jsonRequestResponse(httpc, statusFilter().StatusEndpoint(), struct{}{}, &s); err != nil {
+		return err
+	}
+	if _, ok := s.Jobs[statusFlags.Job]; statusFlags.Job != "" && !ok {
+		return errors.Errorf("job %q does not exist", statusFlags.Job)
+	}
+	return writeStatusJSON(os.Stdout, &s)
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// The schema is what monitoring scripts depend on, so this test pins the JSON, not the Go types.
+func TestStatusJSON(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	s := &daemon.Status{Jobs: map[string]*job.Status{
+		"_control": {Type: job.TypeInternal},
+		"prod_to_backups": {Type: job.TypePush, JobSpecific: &job.ActiveSideStatus{
+			Replication: &report.Report{
+				StartAt: start,
+				Attempts: []*report.AttemptReport{{
+					State:   report.AttemptFanOutFSs,
+					StartAt: start,
+					Filesystems: []*report.FilesystemReport{{
+						Info:        &report.FilesystemInfo{Name: "zroot/a"},
+						State:       report.FilesystemStepping,
+						CurrentStep: 1,
+						Steps: []*report.StepReport{
+							{Info: &report.StepInfo{BytesExpected: 10, BytesReplicated: 10}},
+							{Info: &report.StepInfo{BytesExpected: 20, BytesReplicated: 5}},
+						},
+					}},
+				}},
+			},
+			PruningSender: &pruner.Report{
+				State: pruner.Done.String(),
+				Completed: []pruner.FSReport{
+					{Filesystem: "zroot/a", SnapshotList: make([]pruner.SnapshotReport, 3), DestroyList: []pruner.SnapshotReport{{Name: "zrepl_1"}}, DestroysDone: 1},
+					{Filesystem: "zroot/b", LastError: "dataset is busy", DestroyList: []pruner.SnapshotReport{}},
+				},
+			},
+			Snapshotting: &snapper.Report{
+				State: snapper.Snapshotting,
+				Progress: []*snapper.ReportFilesystem{
+					{Path: "zroot/a", State: snapper.SnapDone, SnapName: "zrepl_1", StartAt: start, DoneAt: start},
+					{Path: "zroot/b", State: snapper.SnapError, SnapName: "zrepl_1", StartAt: start, DoneAt: start, HooksHadError: true},
+					{Path: "zroot/c", State: snapper.SnapStarted, SnapName: "zrepl_1", StartAt: start},
+					{Path: "zroot/d", State: snapper.SnapSkipped},
+					{Path: "zroot/e", State: snapper.SnapPending},
+				},
+				Rules: []*snapper.Report{
+					{Rule: "hourly", State: snapper.Waiting, SleepUntil: start},
+				},
+			},
+		}},
+		"snapshots": {Type: job.TypeSnap, JobSpecific: &job.SnapJobStatus{
+			Snapshotting: &snapper.Report{State: snapper.ErrorWait, Error: "cannot list filesystems"},
+		}},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeStatusJSON(&buf, s))
+	assert.JSONEq(t, `{
+  "schema_version": 1,
+  "jobs": [{
+    "name": "prod_to_backups",
+    "type": "push",
+    "replication": {
+      "start_at": "2020-01-01T10:00:00Z",
+      "finish_at": null,
+      "attempts": 1,
+      "state": "fan-out-filesystems",
+      "bytes_expected": 30,
+      "bytes_replicated": 15,
+      "bytes_per_second": 0,
+      "eta_seconds": 0,
+      "filesystems": [{
+        "name": "zroot/a",
+        "state": "stepping",
+        "steps_done": 1,
+        "steps": 2,
+        "bytes_expected": 30,
+        "bytes_replicated": 15
+      }]
+    },
+    "pruning": [{
+      "side": "sender",
+      "scheduled": false,
+      "state": "done",
+      "filesystems": [
+        {"name": "zroot/a", "state": "done", "snapshots": 3, "destroy": ["zrepl_1"], "destroys_done": 1},
+        {"name": "zroot/b", "state": "error", "error": "dataset is busy", "snapshots": 0, "destroy": [], "destroys_done": 0}
+      ]
+    }],
+    "snapshotting": {
+      "state": "snapshotting",
+      "sleep_until": null,
+      "filesystems": [
+        {"name": "zroot/a", "state": "done", "snapshot": "zrepl_1", "start_at": "2020-01-01T10:00:00Z", "done_at": "2020-01-01T10:00:00Z", "hooks_had_error": false},
+        {"name": "zroot/b", "state": "error", "snapshot": "zrepl_1", "start_at": "2020-01-01T10:00:00Z", "done_at": "2020-01-01T10:00:00Z", "hooks_had_error": true},
+        {"name": "zroot/c", "state": "started", "snapshot": "zrepl_1", "start_at": "2020-01-01T10:00:00Z", "done_at": null, "hooks_had_error": false},
+        {"name": "zroot/d", "state": "skipped", "start_at": null, "done_at": null, "hooks_had_error": false},
+        {"name": "zroot/e", "state": "pending", "start_at": null, "done_at": null, "hooks_had_error": false}
+      ],
+      "rules": [
+        {"rule": "hourly", "state": "waiting", "sleep_until": "2020-01-01T10:00:00Z", "filesystems": []}
+      ]
+    }
+  }, {
+    "name": "snapshots",
+    "type": "snap",
+    "snapshotting": {
+      "state": "error-wait",
+      "sleep_until": null,
+      "error": "cannot list filesystems",
+      "filesystems": []
+    }
+  }]
+}`, buf.String())
+}
+
+func TestStatusJSONUnknownState(t *testing.T) {
+	assert.Equal(t, statusJSONStateUnknown, statusJSONSnapshottingState(snapper.State(0)))
+	assert.Equal(t, statusJSONStateUnknown, statusJSONSnapshotFSState(snapper.SnapState(0)))
+	assert.Equal(t, statusJSONStateUnknown, statusJSONReplicationState(report.AttemptState("renamed")))
+	assert.Equal(t, statusJSONStateUnknown, statusJSONPruneSideState("Renamed"))
+	assert.Equal(t, "", statusJSONPruneSideState(""))
+}
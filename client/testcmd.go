@@ -60,8 +60,12 @@ func runTestFilterCmd(ctx context.Context, subcommand *cli.Subcommand, args []st
 		confFilter = j.Filesystems
 	case *config.PushJob:
 		confFilter = j.Filesystems
+	case *config.LocalJob:
+		confFilter = j.Filesystems
 	case *config.SnapJob:
 		confFilter = j.Filesystems
+	case *config.VerifyJob:
+		confFilter = j.Filesystems
 	default:
 		return fmt.Errorf("job type %T does not have filesystems filter", j)
 	}
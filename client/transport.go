@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/transport/noise"
+)
+
+var TransportCmd = &cli.Subcommand{
+	Use:   "transport",
+	Short: "helpers for setting up transports",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			transportCmdKeygen,
+		}
+	},
+}
+
+var transportCmdKeygen = &cli.Subcommand{
+	Use:             "keygen",
+	Short:           "generate a key pair for the noise transport",
+	NoRequireConfig: true,
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		if len(args) != 0 {
+			return errors.New("keygen takes no arguments")
+		}
+		private, public, err := noise.GenerateKeypair()
+		if err != nil {
+			return errors.Wrap(err, "cannot generate key pair")
+		}
+		fmt.Printf("private_key: %q # keep secret, for the serve or connect section of this host\n", private)
+		fmt.Printf("public_key: %q # for the peer's config\n", public)
+		return nil
+	},
+}
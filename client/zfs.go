@@ -0,0 +1,25 @@
+package client
+
+import (
+	"github.com/zrepl/zrepl/cli"
+)
+
+var ZFSCmd = &cli.Subcommand{
+	Use:   "zfs",
+	Short: "inspect ZFS state that is relevant to zrepl",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			zfsCmdRecvResumeToken,
+		}
+	},
+}
+
+var zfsCmdRecvResumeToken = &cli.Subcommand{
+	Use:   "recv-resume-token",
+	Short: "work with the receive_resume_token of interrupted receives",
+	SetupSubcommands: func() []*cli.Subcommand {
+		return []*cli.Subcommand{
+			zfsCmdRecvResumeTokenInspect,
+		}
+	},
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var zfsRecvResumeTokenInspectFlags struct {
+	Json bool
+}
+
+var zfsCmdRecvResumeTokenInspect = &cli.Subcommand{
+	Use:             "inspect FILESYSTEM",
+	Short:           "decode the receive_resume_token of FILESYSTEM and show the progress of the interrupted receive",
+	NoRequireConfig: true,
+	Run:             doZFSRecvResumeTokenInspect,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.BoolVar(&zfsRecvResumeTokenInspectFlags.Json, "json", false, "emit json instead of pretty-printed")
+	},
+}
+
+type zfsRecvResumeTokenInspectOutput struct {
+	Filesystem string
+	Token      string
+	Decoded    *zfs.ResumeToken
+}
+
+func doZFSRecvResumeTokenInspect(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expecting exactly one positional argument: the filesystem")
+	}
+	fs, err := zfs.NewDatasetPath(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid filesystem")
+	}
+
+	token, err := zfs.ZFSGetReceiveResumeTokenOrEmptyStringIfNotSupported(ctx, fs)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("filesystem %q has no receive_resume_token (no interrupted receive, or resumable receive not supported)", fs.ToString())
+	}
+
+	decoded, err := zfs.ParseResumeToken(ctx, token)
+	if err != nil {
+		return errors.Wrap(err, "cannot decode receive_resume_token")
+	}
+
+	out := zfsRecvResumeTokenInspectOutput{
+		Filesystem: fs.ToString(),
+		Token:      token,
+		Decoded:    decoded,
+	}
+
+	if zfsRecvResumeTokenInspectFlags.Json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	fmt.Printf("filesystem:  %s\n", out.Filesystem)
+	fmt.Printf("toname:      %s\n", decoded.ToName)
+	fmt.Printf("toguid:      %#x\n", decoded.ToGUID)
+	if decoded.HasFromGUID {
+		fmt.Printf("fromguid:    %#x (incremental)\n", decoded.FromGUID)
+	} else {
+		fmt.Printf("fromguid:    - (full)\n")
+	}
+	if decoded.HasRawOk || decoded.HasCompressOK {
+		fmt.Printf("rawok:       %v\n", decoded.RawOK)
+		fmt.Printf("compressok:  %v\n", decoded.CompressOK)
+	}
+	if decoded.HasEmbedOK || decoded.HasLargeBlockOK {
+		fmt.Printf("embedok:     %v\n", decoded.EmbedOK)
+		fmt.Printf("largeblockok: %v\n", decoded.LargeBlockOK)
+	}
+	if decoded.HasObject && decoded.HasOffset {
+		fmt.Printf("position:    object %d, offset %d\n", decoded.Object, decoded.Offset)
+	}
+	if decoded.HasBytes {
+		fmt.Printf("received:    %s (%d bytes)\n", ByteCountBinary(int64(decoded.Bytes)), decoded.Bytes)
+	} else {
+		fmt.Printf("received:    unknown\n")
+	}
+	return nil
+}
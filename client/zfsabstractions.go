@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/daemon"
 	"github.com/zrepl/zrepl/daemon/filters"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/zfs"
@@ -23,17 +24,31 @@ var (
 				zabsCmdReleaseAll,
 				zabsCmdReleaseStale,
 				zabsCmdCreate,
+				zabsCmdExport,
+				zabsCmdImport,
+				zabsCmdDoctor,
 			}
 		},
 	}
 )
 
+// If the config could be parsed, use its zfs abstractions namespace.
+// Otherwise, zfs-abstraction subcommands operate on the default namespace.
+func setupZFSAbstractionsNamespace(sc *cli.Subcommand) error {
+	conf := sc.Config()
+	if conf == nil {
+		return nil
+	}
+	return endpoint.SetAbstractionsNamespace(conf.Global.ZFSAbstractionsNamespace)
+}
+
 // a common set of CLI flags that map to the fields of an
 // endpoint.ListZFSHoldsAndBookmarksQuery
 type zabsFilterFlags struct {
 	Filesystems FilesystemsFilterFlag
 	Job         JobIDFlag
 	Types       AbstractionTypesFlag
+	Client      string
 	Concurrency int64
 }
 
@@ -45,9 +60,35 @@ func (f zabsFilterFlags) Query() (endpoint.ListZFSHoldsAndBookmarksQuery, error)
 		JobID:       f.Job.FlagValue(),
 		Concurrency: f.Concurrency,
 	}
+	if f.Client != "" {
+		q.ClientIdentity = &f.Client
+	}
 	return q, q.Validate()
 }
 
+// produce the wire representation of Query() for the daemon's control socket
+func (f zabsFilterFlags) DaemonRequest() daemon.ZFSAbstractionsListRequest {
+	req := daemon.ZFSAbstractionsListRequest{
+		FS:          f.Filesystems.F.FS,
+		FSFilter:    f.Filesystems.mappings,
+		Concurrency: f.Concurrency,
+	}
+	if req.FS == nil && req.FSFilter == nil {
+		req.FSFilter = map[string]string{"<": "ok"} // all filesystems
+	}
+	for t := range f.Types.FlagValue() {
+		req.What = append(req.What, string(t))
+	}
+	if j := f.Job.FlagValue(); j != nil {
+		s := j.String()
+		req.JobID = &s
+	}
+	if f.Client != "" {
+		req.ClientIdentity = &f.Client
+	}
+	return req
+}
+
 func (f *zabsFilterFlags) registerZabsFilterFlags(s *pflag.FlagSet, verb string) {
 	// Note: the default value is defined in the .FlagValue methods
 	s.Var(&f.Filesystems, "fs", fmt.Sprintf("only %s holds on the specified filesystem [default: all filesystems] [comma-separated list of <dataset-pattern>:<ok|!> pairs]", verb))
@@ -61,7 +102,9 @@ func (f *zabsFilterFlags) registerZabsFilterFlags(s *pflag.FlagSet, verb string)
 	variantsJoined := strings.Join(variants, "|")
 	s.Var(&f.Types, "type", fmt.Sprintf("only %s holds of the specified type [default: all] [comma-separated list of %s]", verb, variantsJoined))
 
-	s.Int64VarP(&f.Concurrency, "concurrency", "p", 1, "number of concurrently queried filesystems")
+	s.StringVar(&f.Client, "client", "", fmt.Sprintf("only %s proxied step holds created on behalf of the specified client identity [default: any client]", verb))
+
+	s.Int64VarP(&f.Concurrency, "concurrency", "p", 1, "number of concurrently queried filesystems per pool")
 }
 
 type JobIDFlag struct{ J *endpoint.JobID }
@@ -106,6 +149,8 @@ func (f AbstractionTypesFlag) FlagValue() map[endpoint.AbstractionType]bool {
 
 type FilesystemsFilterFlag struct {
 	F endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter
+	// the <dataset-pattern>:<ok|!> pairs that F.Filter was built from
+	mappings map[string]string
 }
 
 func (flag *FilesystemsFilterFlag) Set(s string) error {
@@ -118,6 +163,7 @@ func (flag *FilesystemsFilterFlag) Set(s string) error {
 	}
 
 	f := filters.NewDatasetMapFilter(len(mappings), true)
+	flag.mappings = make(map[string]string, len(mappings))
 	for _, m := range mappings {
 		thisMappingErr := fmt.Errorf("expecting comma-separated list of <dataset-pattern>:<ok|!> pairs, got %q", m)
 		lhsrhs := strings.SplitN(m, ":", 2)
@@ -128,6 +174,7 @@ func (flag *FilesystemsFilterFlag) Set(s string) error {
 		if err != nil {
 			return fmt.Errorf("%s: %s", thisMappingErr, err)
 		}
+		flag.mappings[lhsrhs[0]] = lhsrhs[1]
 	}
 	flag.F = endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{
 		Filter: f,
@@ -139,8 +186,7 @@ func (flag FilesystemsFilterFlag) String() string {
 	return fmt.Sprintf("%v", flag.F)
 }
 func (flag FilesystemsFilterFlag) FlagValue() endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter {
-	var z FilesystemsFilterFlag
-	if flag == z {
+	if flag.F.FS == nil && flag.F.Filter == nil {
 		return endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{Filter: zfs.NoFilter()}
 	}
 	return flag.F
@@ -29,6 +29,9 @@ var zabsCmdCreateStepHold = &cli.Subcommand{
 }
 
 func doZabsCreateStep(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
 	if len(args) > 0 {
 		return errors.New("subcommand takes no arguments")
 	}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+var zabsDoctorFlags struct {
+	Filter zabsFilterFlags
+	Yes    bool
+	DryRun bool
+	Json   bool
+}
+
+var zabsCmdDoctor = &cli.Subcommand{
+	Use:   "doctor",
+	Short: `find (and release) zrepl ZFS abstractions owned by jobs that no longer exist in the config`,
+	Run:   doZabsDoctor,
+	SetupFlags: func(f *pflag.FlagSet) {
+		zabsDoctorFlags.Filter.registerZabsFilterFlags(f, "check")
+		f.BoolVarP(&zabsDoctorFlags.Yes, "yes", "y", false, "release the leaked abstractions without asking for confirmation")
+		f.BoolVar(&zabsDoctorFlags.DryRun, "dry-run", false, "print which abstractions would be released, but do not release them")
+		f.BoolVar(&zabsDoctorFlags.Json, "json", false, "emit json instead of pretty-printed")
+	},
+}
+
+func doZabsDoctor(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		return errors.New("this subcommand takes no positional arguments")
+	}
+
+	knownJobs, err := job.JobIDsFromConfig(sc.Config())
+	if err != nil {
+		return errors.Wrap(err, "determine job IDs from config")
+	}
+
+	q, err := zabsDoctorFlags.Filter.Query()
+	if err != nil {
+		return errors.Wrap(err, "invalid filter specification on command line")
+	}
+
+	abstractions, listErrors, err := endpoint.ListAbstractions(ctx, q)
+	if err != nil {
+		return err // context clear by invocation of command
+	}
+	if len(listErrors) > 0 {
+		color.New(color.FgRed).Fprintf(os.Stderr, "there were errors in listing the abstractions:\n%s\n", endpoint.ListAbstractionsErrors(listErrors))
+		// proceed anyways with rest of abstractions
+	}
+
+	leaked := endpoint.AbstractionsOfUnknownJobs(abstractions, knownJobs)
+	if len(leaked) == 0 {
+		fmt.Fprintf(os.Stderr, "no abstractions of unknown jobs found\n")
+		return nil
+	}
+
+	if !zabsDoctorFlags.DryRun && !zabsDoctorFlags.Yes {
+		fmt.Fprintf(os.Stderr, "the following abstractions are owned by jobs that do not exist in the config:\n")
+		for _, a := range leaked {
+			fmt.Fprintf(os.Stderr, "  %s\n", a)
+		}
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			return fmt.Errorf("refusing to release %d abstractions without confirmation (use --yes)", len(leaked))
+		}
+		fmt.Fprintf(os.Stderr, "release %d abstractions? [y/N] ", len(leaked))
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return errors.Wrap(err, "read confirmation")
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	return doZabsRelease_Common(ctx, leaked, zabsDoctorFlags.DryRun, zabsDoctorFlags.Json)
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+var zabsExportFlags struct {
+	Filter zabsFilterFlags
+}
+
+var zabsCmdExport = &cli.Subcommand{
+	Use:             "export",
+	Short:           `export zrepl ZFS abstractions as JSON to stdout (for use with the import subcommand)`,
+	Run:             doZabsExport,
+	NoRequireConfig: true,
+	SetupFlags: func(f *pflag.FlagSet) {
+		zabsExportFlags.Filter.registerZabsFilterFlags(f, "export")
+	},
+}
+
+func doZabsExport(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("this subcommand takes no positional arguments")
+	}
+
+	q, err := zabsExportFlags.Filter.Query()
+	if err != nil {
+		return errors.Wrap(err, "invalid filter specification on command line")
+	}
+
+	abstractions, listErrors, err := endpoint.ListAbstractions(ctx, q)
+	if err != nil {
+		return err // context clear by invocation of command
+	}
+	if len(listErrors) > 0 {
+		// an incomplete export is worse than none at all
+		return endpoint.ListAbstractionsErrors(listErrors)
+	}
+
+	out := make([]endpoint.AbstractionJSON, len(abstractions))
+	for i := range abstractions {
+		out[i] = endpoint.AbstractionJSON{Abstraction: abstractions[i]}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+var zabsImportFlags struct {
+	DryRun bool
+}
+
+var zabsCmdImport = &cli.Subcommand{
+	Use:             "import FILE|-",
+	Short:           `re-create zrepl ZFS abstractions from the output of the export subcommand`,
+	Run:             doZabsImport,
+	NoRequireConfig: true,
+	SetupFlags: func(f *pflag.FlagSet) {
+		f.BoolVar(&zabsImportFlags.DryRun, "dry-run", false, "print which abstractions would be created, but do not create them")
+	},
+}
+
+func doZabsImport(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("this subcommand takes exactly one positional argument")
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var abstractions []endpoint.AbstractionJSON
+	if err := json.NewDecoder(in).Decode(&abstractions); err != nil {
+		return errors.Wrap(err, "decode input")
+	}
+
+	colorErr := color.New(color.FgRed)
+	printfSuccess := color.New(color.FgGreen).FprintfFunc()
+	printfSection := color.New(color.Bold).FprintfFunc()
+
+	hadErr := false
+	for _, a := range abstractions {
+		if zabsImportFlags.DryRun {
+			fmt.Printf("would create %s\n", a.Abstraction)
+			continue
+		}
+		printfSection(os.Stdout, "create %s ...", a.Abstraction)
+		_, err := endpoint.ImportAbstraction(ctx, a.Abstraction)
+		if err != nil {
+			hadErr = true
+			colorErr.Fprintf(os.Stdout, " failed:\n%s\n", err)
+		} else {
+			printfSuccess(os.Stdout, " OK\n")
+		}
+	}
+
+	if hadErr {
+		colorErr.Add(color.Bold).Fprintf(os.Stderr, "there were errors in creating the abstractions")
+		return fmt.Errorf("")
+	}
+	return nil
+}
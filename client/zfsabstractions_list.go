@@ -1,9 +1,12 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"sync"
 
@@ -12,13 +15,17 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/daemon"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/util/chainlock"
 )
 
 var zabsListFlags struct {
-	Filter zabsFilterFlags
-	Json   bool
+	Filter  zabsFilterFlags
+	Json    bool
+	Daemon  bool
+	OrderBy string
+	Limit   int64
 }
 
 var zabsCmdList = &cli.Subcommand{
@@ -29,10 +36,16 @@ var zabsCmdList = &cli.Subcommand{
 	SetupFlags: func(f *pflag.FlagSet) {
 		zabsListFlags.Filter.registerZabsFilterFlags(f, "list")
 		f.BoolVar(&zabsListFlags.Json, "json", false, "emit JSON")
+		f.StringVar(&zabsListFlags.OrderBy, "order-by", "", fmt.Sprintf("sort the abstractions [%s|%s] [default: no particular order]", endpoint.OrderByCreateTXGAsc, endpoint.OrderByCreateTXGDesc))
+		f.Int64Var(&zabsListFlags.Limit, "limit", 0, "list at most this many abstractions (the first ones according to --order-by) [default: no limit]")
+		f.BoolVar(&zabsListFlags.Daemon, "daemon", false, "let the running daemon do the listing and stream the results over the control socket")
 	},
 }
 
 func doZabsList(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
 	var err error
 
 	if len(args) > 0 {
@@ -43,8 +56,25 @@ func doZabsList(ctx context.Context, sc *cli.Subcommand, args []string) error {
 	if err != nil {
 		return errors.Wrap(err, "invalid filter specification on command line")
 	}
+	q.OrderBy = endpoint.ListZFSHoldsAndBookmarksQueryOrderBy(zabsListFlags.OrderBy)
+	q.Limit = zabsListFlags.Limit
+	if err := q.Validate(); err != nil {
+		return errors.Wrap(err, "invalid --order-by or --limit")
+	}
 
-	abstractions, errors, err := endpoint.ListAbstractionsStreamed(ctx, q)
+	var abstractions <-chan endpoint.Abstraction
+	var errors <-chan endpoint.ListAbstractionsError
+	if zabsListFlags.Daemon {
+		if sc.Config() == nil {
+			return fmt.Errorf("--daemon requires a valid config file")
+		}
+		req := zabsListFlags.Filter.DaemonRequest()
+		req.OrderBy = zabsListFlags.OrderBy
+		req.Limit = zabsListFlags.Limit
+		abstractions, errors, err = listAbstractionsViaDaemon(sc.Config().Global.Control.SockPath, req)
+	} else {
+		abstractions, errors, err = endpoint.ListAbstractionsStreamed(ctx, q)
+	}
 	if err != nil {
 		return err // context clear by invocation of command
 	}
@@ -97,3 +127,55 @@ func doZabsList(ctx context.Context, sc *cli.Subcommand, args []string) error {
 	}
 
 }
+
+// Like endpoint.ListAbstractionsStreamed, but performed by the daemon.
+// The daemon streams the results as newline-delimited JSON.
+func listAbstractionsViaDaemon(sockpath string, req daemon.ZFSAbstractionsListRequest) (<-chan endpoint.Abstraction, <-chan endpoint.ListAbstractionsError, error) {
+	httpc, err := controlHttpClient(sockpath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req); err != nil {
+		return nil, nil, err
+	}
+	resp, err := httpc.Post("http://unix"+daemon.ControlJobEndpointZFSAbstractionsList, "application/json", &buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var msg bytes.Buffer
+		_, _ = io.CopyN(&msg, resp.Body, 4096) // ignore error, just display what we got
+		return nil, nil, errors.Errorf("%s", msg.String())
+	}
+
+	out := make(chan endpoint.Abstraction)
+	outErrs := make(chan endpoint.ListAbstractionsError)
+	go func() {
+		defer resp.Body.Close()
+		defer close(out)
+		defer close(outErrs)
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var item daemon.ZFSAbstractionsListResponseItem
+			err := dec.Decode(&item)
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				outErrs <- endpoint.ListAbstractionsError{What: "decode daemon response", Err: err}
+				return
+			}
+			switch {
+			case item.Abstraction != nil:
+				out <- item.Abstraction.Abstraction
+			case item.Error != nil:
+				outErrs <- item.Error.ListAbstractionsError()
+			default:
+				outErrs <- endpoint.ListAbstractionsError{What: "decode daemon response", Err: errors.New("empty response item")}
+			}
+		}
+	}()
+	return out, outErrs, nil
+}
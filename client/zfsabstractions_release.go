@@ -16,15 +16,16 @@ import (
 
 // shared between release-all and release-step
 var zabsReleaseFlags struct {
-	Filter zabsFilterFlags
-	Json   bool
-	DryRun bool
+	Filter       zabsFilterFlags
+	Json         bool
+	DryRun       bool
+	AllowPartial bool // release-stale only
 }
 
 func registerZabsReleaseFlags(s *pflag.FlagSet) {
 	zabsReleaseFlags.Filter.registerZabsFilterFlags(s, "release")
 	s.BoolVar(&zabsReleaseFlags.Json, "json", false, "emit json instead of pretty-printed")
-	s.BoolVar(&zabsReleaseFlags.DryRun, "dry-run", false, "do a dry-run")
+	s.BoolVar(&zabsReleaseFlags.DryRun, "dry-run", false, "print which abstractions would be released, but do not release them")
 }
 
 var zabsCmdReleaseAll = &cli.Subcommand{
@@ -40,10 +41,16 @@ var zabsCmdReleaseStale = &cli.Subcommand{
 	Run:             doZabsReleaseStale,
 	NoRequireConfig: true,
 	Short:           `release stale zrepl ZFS abstractions (useful if zrepl has a bug and does not do it by itself)`,
-	SetupFlags:      registerZabsReleaseFlags,
+	SetupFlags: func(f *pflag.FlagSet) {
+		registerZabsReleaseFlags(f)
+		f.BoolVar(&zabsReleaseFlags.AllowPartial, "allow-partial", false, "skip filesystems that cannot be listed instead of aborting")
+	},
 }
 
 func doZabsReleaseAll(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
 	var err error
 
 	if len(args) > 0 {
@@ -64,10 +71,13 @@ func doZabsReleaseAll(ctx context.Context, sc *cli.Subcommand, args []string) er
 		// proceed anyways with rest of abstractions
 	}
 
-	return doZabsRelease_Common(ctx, abstractions)
+	return doZabsRelease_Common(ctx, abstractions, zabsReleaseFlags.DryRun, zabsReleaseFlags.Json)
 }
 
 func doZabsReleaseStale(ctx context.Context, sc *cli.Subcommand, args []string) error {
+	if err := setupZFSAbstractionsNamespace(sc); err != nil {
+		return err
+	}
 
 	var err error
 
@@ -80,35 +90,23 @@ func doZabsReleaseStale(ctx context.Context, sc *cli.Subcommand, args []string)
 		return errors.Wrap(err, "invalid filter specification on command line")
 	}
 
+	q.AllowPartial = zabsReleaseFlags.AllowPartial
+
 	stalenessInfo, err := endpoint.ListStale(ctx, q)
 	if err != nil {
 		return err // context clear by invocation of command
 	}
+	if len(stalenessInfo.ListErrors) > 0 {
+		color.New(color.FgRed).Fprintf(os.Stderr, "skipping filesystems that could not be listed:\n%s\n", endpoint.ListAbstractionsErrors(stalenessInfo.ListErrors))
+		// proceed anyways with rest of abstractions
+	}
 
-	return doZabsRelease_Common(ctx, stalenessInfo.Stale)
+	return doZabsRelease_Common(ctx, stalenessInfo.Stale, zabsReleaseFlags.DryRun, zabsReleaseFlags.Json)
 }
 
-func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction) error {
-
-	if zabsReleaseFlags.DryRun {
-		if zabsReleaseFlags.Json {
-			m, err := json.MarshalIndent(destroy, "", "  ")
-			if err != nil {
-				panic(err)
-			}
-			if _, err := os.Stdout.Write(m); err != nil {
-				panic(err)
-			}
-			fmt.Println()
-		} else {
-			for _, a := range destroy {
-				fmt.Printf("would destroy %s\n", a)
-			}
-		}
-		return nil
-	}
+func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction, dryRun, jsonOutput bool) error {
 
-	outcome := endpoint.BatchDestroy(ctx, destroy)
+	outcome := endpoint.BatchDestroy(ctx, destroy, dryRun)
 	hadErr := false
 
 	enc := json.NewEncoder(os.Stdout)
@@ -119,11 +117,13 @@ func doZabsRelease_Common(ctx context.Context, destroy []endpoint.Abstraction) e
 
 	for res := range outcome {
 		hadErr = hadErr || res.DestroyErr != nil
-		if zabsReleaseFlags.Json {
+		if jsonOutput {
 			err := enc.Encode(res)
 			if err != nil {
 				colorErr.Fprintf(os.Stderr, "cannot marshal there were errors in destroying the abstractions")
 			}
+		} else if res.DryRun {
+			fmt.Printf("would destroy %s\n", res.Abstraction)
 		} else {
 			printfSection(os.Stdout, "destroy %s ...", res.Abstraction)
 			if res.DestroyErr != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log/syslog"
+	"net"
 	"os"
 	"reflect"
 	"regexp"
@@ -45,6 +46,10 @@ func (j JobEnum) Name() string {
 		name = v.Name
 	case *SourceJob:
 		name = v.Name
+	case *VerifyJob:
+		name = v.Name
+	case *LocalJob:
+		name = v.Name
 	default:
 		panic(fmt.Sprintf("unknown job type %T", v))
 	}
@@ -52,12 +57,49 @@ func (j JobEnum) Name() string {
 }
 
 type ActiveJob struct {
-	Type        string                `yaml:"type"`
-	Name        string                `yaml:"name"`
-	Connect     ConnectEnum           `yaml:"connect"`
-	Pruning     PruningSenderReceiver `yaml:"pruning"`
-	Debug       JobDebugSettings      `yaml:"debug,optional"`
-	Replication *Replication          `yaml:"replication,optional,fromdefaults"`
+	Type               string                `yaml:"type"`
+	Name               string                `yaml:"name"`
+	Connect            ConnectEnum           `yaml:"connect,optional"` // push jobs may use `targets` instead
+	Pruning            PruningSenderReceiver `yaml:"pruning"`
+	Debug              JobDebugSettings      `yaml:"debug,optional"`
+	Replication        *Replication          `yaml:"replication,optional,fromdefaults"`
+	ConflictResolution *ConflictResolution   `yaml:"conflict_resolution,optional,fromdefaults"`
+	// names of the jobs whose successful invocations trigger this job's invocations
+	After []string `yaml:"after,optional"`
+	// outlets for the logs of this job only, in addition to global.logging
+	Logging []LoggingOutletEnum `yaml:"logging,optional"`
+	// how much of the budget in global.scheduler each operation of this job consumes
+	Weight int `yaml:"weight,optional,positive,default=1"`
+	// defers the invocations after failed invocations
+	FailureBackoff *FailureBackoff `yaml:"failure_backoff,optional,fromdefaults"`
+	// commands that are notified about the lifecycle events of this job
+	EventHooks []EventHook `yaml:"event_hooks,optional"`
+	// if not empty, replace the job's default trigger, i.e., the snapshotting or the `interval` of pull jobs
+	Triggers []TriggerEnum `yaml:"triggers,optional"`
+}
+
+// EventHook runs the command at Path for each of Events, with the event as JSON on stdin.
+type EventHook struct {
+	Events  []string      `yaml:"events"`
+	Path    string        `yaml:"path"`
+	Timeout time.Duration `yaml:"timeout,optional,positive,default=30s"`
+}
+
+// FailureBackoff defers the invocations of a job after failed invocations.
+// After the n-th consecutive failure, the job is not invoked for
+// min(InitialInterval * Multiplier^(n-1), MaxInterval), randomly increased or decreased by the fraction Jitter.
+// An InitialInterval of 0 disables the backoff.
+type FailureBackoff struct {
+	InitialInterval time.Duration `yaml:"initial_interval,optional,zeropositive,default=1m"`
+	Multiplier      float64       `yaml:"multiplier,optional,default=2"`
+	MaxInterval     time.Duration `yaml:"max_interval,optional,zeropositive,default=1h"`
+	Jitter          float64       `yaml:"jitter,optional,default=0.1"`
+}
+
+func (j *ActiveJob) GetConflictResolution() *ConflictResolution { return j.ConflictResolution }
+
+type ConflictResolution struct {
+	ReceiverRollback bool `yaml:"receiver_rollback,optional,default=false"`
 }
 
 type PassiveJob struct {
@@ -65,6 +107,18 @@ type PassiveJob struct {
 	Name  string           `yaml:"name"`
 	Serve ServeEnum        `yaml:"serve"`
 	Debug JobDebugSettings `yaml:"debug,optional"`
+	// see ActiveJob.Logging
+	Logging []LoggingOutletEnum `yaml:"logging,optional"`
+	// see ActiveJob.Weight
+	Weight int `yaml:"weight,optional,positive,default=1"`
+	// see ActiveJob.EventHooks
+	EventHooks []EventHook   `yaml:"event_hooks,optional"`
+	Hooks      *PassiveHooks `yaml:"hooks,optional,fromdefaults"`
+}
+
+type PassiveHooks struct {
+	// run around each replication step that the active side performs against the job, see ReplicationHooks.Step
+	Step HookList `yaml:"step,optional"`
 }
 
 type SnapJob struct {
@@ -74,10 +128,44 @@ type SnapJob struct {
 	Debug        JobDebugSettings  `yaml:"debug,optional"`
 	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
 	Filesystems  FilesystemsFilter `yaml:"filesystems"`
+	// see ActiveJob.After
+	After []string `yaml:"after,optional"`
+	// see ActiveJob.Logging
+	Logging []LoggingOutletEnum `yaml:"logging,optional"`
+	// see ActiveJob.Weight
+	Weight int `yaml:"weight,optional,positive,default=1"`
+	// see ActiveJob.FailureBackoff
+	FailureBackoff *FailureBackoff `yaml:"failure_backoff,optional,fromdefaults"`
+	// see ActiveJob.EventHooks
+	EventHooks []EventHook `yaml:"event_hooks,optional"`
+	// see ActiveJob.Triggers
+	Triggers []TriggerEnum `yaml:"triggers,optional"`
+}
+
+type VerifyJob struct {
+	Type        string                   `yaml:"type"`
+	Name        string                   `yaml:"name"`
+	Connect     ConnectEnum              `yaml:"connect"`
+	Filesystems FilesystemsFilter        `yaml:"filesystems"`
+	Interval    PositiveDurationOrManual `yaml:"interval"`
+	// "latest" or "all"
+	Snapshots string           `yaml:"snapshots,optional,default=latest"`
+	Raw       bool             `yaml:"raw,optional,default=false"`
+	Debug     JobDebugSettings `yaml:"debug,optional"`
+	// see ActiveJob.Logging
+	Logging []LoggingOutletEnum `yaml:"logging,optional"`
+	// see ActiveJob.Weight
+	Weight int `yaml:"weight,optional,positive,default=1"`
 }
 
 type SendOptions struct {
-	Encrypted bool `yaml:"encrypted,optional,default=false"`
+	Encrypted    bool `yaml:"encrypted,optional,default=false"`
+	Raw          bool `yaml:"raw,optional,default=false"`
+	Compressed   bool `yaml:"compressed,optional,default=false"`
+	EmbeddedData bool `yaml:"embedded_data,optional,default=false"`
+	LargeBlocks  bool `yaml:"large_blocks,optional,default=false"`
+	// "true" (send -p), "backup" (send -b) or "false"
+	Properties string `yaml:"properties,optional,default=false"`
 }
 
 type RecvOptions struct {
@@ -86,10 +174,71 @@ type RecvOptions struct {
 
 	// Future:
 	// Reencrypt bool `yaml:"reencrypt"`
+
+	Zvol *RecvZvolOptions `yaml:"zvol,optional,fromdefaults"`
+}
+
+// RecvZvolOptions only apply to send streams of volumes.
+type RecvZvolOptions struct {
+	// "keep" or a value for the volmode property (e.g. "none")
+	Volmode string `yaml:"volmode,optional,default=keep"`
+	// "keep", "none" or "auto"
+	Refreservation string `yaml:"refreservation,optional,default=keep"`
 }
 
 type Replication struct {
-	Protection *ReplicationOptionsProtection `yaml:"protection,optional,fromdefaults"`
+	Protection     *ReplicationOptionsProtection  `yaml:"protection,optional,fromdefaults"`
+	SizeEstimates  bool                           `yaml:"size_estimates,optional,default=true"`
+	Concurrency    *ReplicationOptionsConcurrency `yaml:"concurrency,optional,fromdefaults"`
+	BandwidthLimit string                         `yaml:"bandwidth_limit,optional,default=unlimited"`
+	Windows        []*ReplicationWindow           `yaml:"windows,optional"`
+	StepStateFile  string                         `yaml:"step_state_file,optional"`
+	Retry          *ReplicationOptionsRetry       `yaml:"retry,optional,fromdefaults"`
+	// "per_snapshot", "intermediates" or "direct"
+	IncrementalSteps string                 `yaml:"incremental_steps,optional,default=per_snapshot"`
+	Priorities       []*ReplicationPriority `yaml:"priorities,optional"`
+	Hooks            *ReplicationHooks      `yaml:"hooks,optional,fromdefaults"`
+	// "continue", "fail_job" or "fail_fs_subtree"
+	OnError     string                         `yaml:"on_error,optional,default=continue"`
+	LargeSteps  *ReplicationOptionsLargeSteps  `yaml:"large_steps,optional,fromdefaults"`
+	StepResume  *ReplicationOptionsStepResume  `yaml:"step_resume,optional,fromdefaults"`
+	Compression *ReplicationOptionsCompression `yaml:"compression,optional,fromdefaults"`
+}
+
+type ReplicationOptionsCompression struct {
+	// "none", "zstd" or "lz4"
+	Algorithm string `yaml:"algorithm,optional,default=none"`
+	// 0 selects the algorithm's default level
+	Level int `yaml:"level,optional,default=0"`
+}
+
+type ReplicationOptionsStepResume struct {
+	MaxAttempts  int           `yaml:"max_attempts,optional,default=3"`
+	TokenTimeout time.Duration `yaml:"token_timeout,optional,zeropositive,default=1m"`
+}
+
+type ReplicationOptionsLargeSteps struct {
+	Threshold string `yaml:"threshold,optional,default=unlimited"` // e.g. 500GiB
+	// "defer" or "skip"
+	Action string `yaml:"action,optional,default=defer"`
+}
+
+type ReplicationHooks struct {
+	Replication HookList `yaml:"replication,optional"`
+	Step        HookList `yaml:"step,optional"`
+}
+
+type ReplicationPriority struct {
+	Regex    string `yaml:"regex"`
+	Priority int    `yaml:"priority"`
+}
+
+type ReplicationWindow struct {
+	Days           []string `yaml:"days,optional"`
+	From           string   `yaml:"from"`
+	To             string   `yaml:"to"`
+	Pause          bool     `yaml:"pause,optional,default=false"`
+	BandwidthLimit string   `yaml:"bandwidth_limit,optional"`
 }
 
 type ReplicationOptionsProtection struct {
@@ -97,11 +246,41 @@ type ReplicationOptionsProtection struct {
 	Incremental string `yaml:"incremental,optional,default=guarantee_resumability"`
 }
 
+type ReplicationOptionsConcurrency struct {
+	// zero if not set, see job.activeSide for the default
+	Steps int `yaml:"steps,optional"`
+	FS    int `yaml:"fs,optional,default=0"`
+}
+
+type ReplicationOptionsRetry struct {
+	Planning *ReplicationRetryPolicy `yaml:"planning,optional,fromdefaults"`
+	Network  *ReplicationRetryPolicy `yaml:"network,optional,fromdefaults"`
+	ZFS      *ReplicationRetryPolicy `yaml:"zfs,optional,fromdefaults"`
+}
+
+// The pointer fields are nil if not set, their defaults depend on the policy,
+// see job.retryPoliciesFromConfig.
+type ReplicationRetryPolicy struct {
+	MaxAttempts     *int           `yaml:"max_attempts,optional"`
+	InitialInterval *time.Duration `yaml:"initial_interval,optional"`
+	Multiplier      float64        `yaml:"multiplier,optional,default=1"`
+	Jitter          float64        `yaml:"jitter,optional,default=0"`
+	GiveUpTimeout   *time.Duration `yaml:"give_up_timeout,optional"`
+}
+
 type PushJob struct {
 	ActiveJob    `yaml:",inline"`
 	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
 	Filesystems  FilesystemsFilter `yaml:"filesystems"`
 	Send         *SendOptions      `yaml:"send,fromdefaults,optional"`
+	Targets      []*PushTarget     `yaml:"targets,optional"`
+}
+
+// A PushTarget is one of multiple receivers of a push job.
+// It is mutually exclusive with the job's `connect` field.
+type PushTarget struct {
+	Name    string      `yaml:"name"`
+	Connect ConnectEnum `yaml:"connect"`
 }
 
 func (j *PushJob) GetFilesystems() FilesystemsFilter { return j.Filesystems }
@@ -110,14 +289,34 @@ func (j *PushJob) GetSendOptions() *SendOptions      { return j.Send }
 type PullJob struct {
 	ActiveJob `yaml:",inline"`
 	RootFS    string                   `yaml:"root_fs"`
-	Interval  PositiveDurationOrManual `yaml:"interval"`
+	Interval  PositiveDurationOrManual `yaml:"interval,optional"` // zero if `triggers` is set instead
 	Recv      *RecvOptions             `yaml:"recv,fromdefaults,optional"`
+	// names of the push, local or source jobs that replicate the received filesystems further
+	DownstreamJobs []string `yaml:"downstream_jobs,optional"`
 }
 
 func (j *PullJob) GetRootFS() string             { return j.RootFS }
 func (j *PullJob) GetAppendClientIdentity() bool { return false }
 func (j *PullJob) GetRecvOptions() *RecvOptions  { return j.Recv }
 
+// A LocalJob replicates filesystems to root_fs on the same host, with sender and receiver in the daemon's process.
+type LocalJob struct {
+	ActiveJob    `yaml:",inline"`
+	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
+	Filesystems  FilesystemsFilter `yaml:"filesystems"`
+	Send         *SendOptions      `yaml:"send,fromdefaults,optional"`
+	RootFS       string            `yaml:"root_fs"`
+	Recv         *RecvOptions      `yaml:"recv,fromdefaults,optional"`
+	// see PullJob.DownstreamJobs
+	DownstreamJobs []string `yaml:"downstream_jobs,optional"`
+}
+
+func (j *LocalJob) GetFilesystems() FilesystemsFilter { return j.Filesystems }
+func (j *LocalJob) GetSendOptions() *SendOptions      { return j.Send }
+func (j *LocalJob) GetRootFS() string                 { return j.RootFS }
+func (j *LocalJob) GetAppendClientIdentity() bool     { return false }
+func (j *LocalJob) GetRecvOptions() *RecvOptions      { return j.Recv }
+
 type PositiveDurationOrManual struct {
 	Interval time.Duration
 	Manual   bool
@@ -153,17 +352,37 @@ type SinkJob struct {
 	PassiveJob `yaml:",inline"`
 	RootFS     string       `yaml:"root_fs"`
 	Recv       *RecvOptions `yaml:"recv,optional,fromdefaults"`
+	// names of the push, local or source jobs that replicate the received filesystems further
+	DownstreamJobs []string `yaml:"downstream_jobs,optional"`
+	// where the filesystems of specific clients are received instead of root_fs/<client identity>,
+	// the first entry whose client pattern matches applies
+	ClientMapping []SinkClientMapping `yaml:"client_mapping,optional"`
+	// whether push jobs may roll back diverged filesystems below root_fs
+	ConflictResolution *ConflictResolution `yaml:"conflict_resolution,optional,fromdefaults"`
+}
+
+type SinkClientMapping struct {
+	// client identity, may contain shell patterns
+	Client string `yaml:"client"`
+	// template below the job's root_fs with variables ${client} and ${source_pool}
+	RootFS                string            `yaml:"root_fs"`
+	Quota                 string            `yaml:"quota,optional"`
+	PlaceholderProperties map[string]string `yaml:"placeholder_properties,optional"`
 }
 
-func (j *SinkJob) GetRootFS() string             { return j.RootFS }
-func (j *SinkJob) GetAppendClientIdentity() bool { return true }
-func (j *SinkJob) GetRecvOptions() *RecvOptions  { return j.Recv }
+func (j *SinkJob) GetRootFS() string                          { return j.RootFS }
+func (j *SinkJob) GetAppendClientIdentity() bool              { return true }
+func (j *SinkJob) GetRecvOptions() *RecvOptions               { return j.Recv }
+func (j *SinkJob) GetConflictResolution() *ConflictResolution { return j.ConflictResolution }
 
 type SourceJob struct {
-	PassiveJob   `yaml:",inline"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
-	Send         *SendOptions      `yaml:"send,optional,fromdefaults"`
+	PassiveJob       `yaml:",inline"`
+	Snapshotting     SnapshottingEnum  `yaml:"snapshotting"`
+	Filesystems      FilesystemsFilter `yaml:"filesystems"`
+	Send             *SendOptions      `yaml:"send,optional,fromdefaults"`
+	ProxiedStepHolds bool              `yaml:"proxied_step_holds,optional,default=false"`
+	// pruning on the source side, nil if the pull jobs prune the source's snapshots
+	Pruning *PruningLocal `yaml:"pruning,optional"`
 }
 
 func (j *SourceJob) GetFilesystems() FilesystemsFilter { return j.Filesystems }
@@ -176,23 +395,125 @@ type SnapshottingEnum struct {
 }
 
 type SnapshottingPeriodic struct {
-	Type     string        `yaml:"type"`
+	Type   string `yaml:"type"`
+	Prefix string `yaml:"prefix,optional"`
+	// if not empty, the snapshot names are created from this text/template instead of Prefix and the time, see snapper.NameTemplateData
+	NameTemplate  string        `yaml:"name_template,optional"`
+	Interval      time.Duration `yaml:"interval,optional,zeropositive"` // must be set unless Classes is set
+	Hooks         HookList      `yaml:"hooks,optional"`
+	SkipUnchanged bool          `yaml:"skip_unchanged,optional,default=false"`
+	// the first rule whose Regex matches a filesystem's name overrides Interval and Prefix for that filesystem
+	Rules []*SnapshottingPeriodicRule `yaml:"rules,optional"`
+	// if not empty, each class snapshots all filesystems with its own Prefix and Interval,
+	// and the keep rules of the pruning can refer to the snapshots of a class by its Name
+	Classes []*SnapshottingPeriodicClass `yaml:"classes,optional"`
+}
+
+type SnapshottingPeriodicRule struct {
+	Regex    string        `yaml:"regex"`
+	Interval time.Duration `yaml:"interval,positive"`
+	Prefix   string        `yaml:"prefix,optional"` // empty means the prefix of the snapshotting
+}
+
+type SnapshottingPeriodicClass struct {
+	Name     string        `yaml:"name"`
 	Prefix   string        `yaml:"prefix"`
 	Interval time.Duration `yaml:"interval,positive"`
-	Hooks    HookList      `yaml:"hooks,optional"`
+}
+
+// SnapshottingCron takes snapshots at the wall-clock times of a crontab(5) schedule.
+type SnapshottingCron struct {
+	Type         string `yaml:"type"`
+	Prefix       string `yaml:"prefix,optional"`
+	NameTemplate string `yaml:"name_template,optional"`
+	// minute hour day-of-month month day-of-week
+	Cron string `yaml:"cron"`
+	// IANA time zone name, e.g., Europe/Berlin, in which Cron is evaluated. Empty means local time.
+	TimeZone      string   `yaml:"time_zone,optional"`
+	Hooks         HookList `yaml:"hooks,optional"`
+	SkipUnchanged bool     `yaml:"skip_unchanged,optional,default=false"`
 }
 
 type SnapshottingManual struct {
 	Type string `yaml:"type"`
+	// if Prefix or NameTemplate is set, `zrepl snapshot` takes snapshots named like those of SnapshottingPeriodic
+	Prefix        string   `yaml:"prefix,optional"`
+	NameTemplate  string   `yaml:"name_template,optional"`
+	Hooks         HookList `yaml:"hooks,optional"`
+	SkipUnchanged bool     `yaml:"skip_unchanged,optional,default=false"`
+}
+
+type TriggerEnum struct {
+	Ret interface{}
+}
+
+type TriggerPeriodic struct {
+	Type     string        `yaml:"type"`
+	Interval time.Duration `yaml:"interval,positive"`
+}
+
+type TriggerCron struct {
+	Type string `yaml:"type"`
+	// minute hour day-of-month month day-of-week, in local time
+	Cron string `yaml:"cron"`
+}
+
+// TriggerManual disables the automatic invocations of the job, it must be the only trigger.
+type TriggerManual struct {
+	Type string `yaml:"type"`
+}
+
+// TriggerFilesystemEvent fires when a snapshot is created on one of the job's filesystems.
+type TriggerFilesystemEvent struct {
+	Type         string        `yaml:"type"`
+	PollInterval time.Duration `yaml:"poll_interval,optional,positive,default=1m"`
 }
 
 type PruningSenderReceiver struct {
-	KeepSender   []PruningEnum `yaml:"keep_sender"`
-	KeepReceiver []PruningEnum `yaml:"keep_receiver"`
+	KeepSender          []PruningEnum `yaml:"keep_sender"`
+	KeepReceiver        []PruningEnum `yaml:"keep_receiver"`
+	WaitForSpaceReclaim bool          `yaml:"wait_for_space_reclaim,optional,default=false"`
+	// what to do with snapshots that are to be destroyed but have clones: skip or defer
+	Clones string `yaml:"clones,optional,default=skip"`
+	// keep rules for the bookmarks that zrepl did not create, empty means that bookmarks are not pruned
+	KeepSenderBookmarks   []PruningEnum `yaml:"keep_sender_bookmarks,optional"`
+	KeepReceiverBookmarks []PruningEnum `yaml:"keep_receiver_bookmarks,optional"`
+	// if not empty, the job additionally prunes whenever one of these triggers fires,
+	// independent of its invocations, only types periodic and cron are supported
+	Triggers []TriggerEnum `yaml:"triggers,optional"`
+	// number of filesystems whose snapshots are destroyed concurrently per side, 0 means the default
+	Concurrency int `yaml:"concurrency,optional,zeropositive,default=0"`
+	// snapshots and bookmarks destroyed per minute per side, in addition to global.scheduler, 0 means unlimited
+	DestroysPerMinute int `yaml:"destroys_per_minute,optional,zeropositive,default=0"`
+	// the first override whose regex matches a filesystem replaces the keep rules for it
+	Overrides []*PruningSenderReceiverOverride `yaml:"overrides,optional"`
+}
+
+type PruningSenderReceiverOverride struct {
+	Regex string `yaml:"regex"`
+	// empty means the keep rules of the side in PruningSenderReceiver
+	KeepSender   []PruningEnum `yaml:"keep_sender,optional"`
+	KeepReceiver []PruningEnum `yaml:"keep_receiver,optional"`
 }
 
 type PruningLocal struct {
-	Keep []PruningEnum `yaml:"keep"`
+	Keep                []PruningEnum `yaml:"keep"`
+	WaitForSpaceReclaim bool          `yaml:"wait_for_space_reclaim,optional,default=false"`
+	// see PruningSenderReceiver.Clones
+	Clones string `yaml:"clones,optional,default=skip"`
+	// see PruningSenderReceiver.KeepSenderBookmarks
+	KeepBookmarks []PruningEnum `yaml:"keep_bookmarks,optional"`
+	// see PruningSenderReceiver.Concurrency
+	Concurrency int `yaml:"concurrency,optional,zeropositive,default=0"`
+	// see PruningSenderReceiver.DestroysPerMinute
+	DestroysPerMinute int `yaml:"destroys_per_minute,optional,zeropositive,default=0"`
+	// see PruningSenderReceiver.Overrides
+	Overrides []*PruningLocalOverride `yaml:"overrides,optional"`
+}
+
+type PruningLocalOverride struct {
+	Regex string        `yaml:"regex"`
+	Keep  []PruningEnum `yaml:"keep"`
 }
 
 type LoggingOutletEnumList []LoggingOutletEnum
@@ -215,10 +536,44 @@ format: "human"
 var _ yaml.Defaulter = &LoggingOutletEnumList{}
 
 type Global struct {
-	Logging    *LoggingOutletEnumList `yaml:"logging,optional,fromdefaults"`
-	Monitoring []MonitoringEnum       `yaml:"monitoring,optional"`
-	Control    *GlobalControl         `yaml:"control,optional,fromdefaults"`
-	Serve      *GlobalServe           `yaml:"serve,optional,fromdefaults"`
+	Logging                  *LoggingOutletEnumList `yaml:"logging,optional,fromdefaults"`
+	Monitoring               []MonitoringEnum       `yaml:"monitoring,optional"`
+	Control                  *GlobalControl         `yaml:"control,optional,fromdefaults"`
+	Serve                    *GlobalServe           `yaml:"serve,optional,fromdefaults"`
+	ZFSAbstractionsNamespace string                 `yaml:"zfs_abstractions_namespace,optional,default=zrepl"`
+	ZFSBackend               string                 `yaml:"zfs_backend,optional,default=cli"`
+	ZFSConcurrency           *GlobalZFSConcurrency  `yaml:"zfs_concurrency,optional,fromdefaults"`
+	Shutdown                 *GlobalShutdown        `yaml:"shutdown,optional,fromdefaults"`
+	Scheduler                *GlobalScheduler       `yaml:"scheduler,optional,fromdefaults"`
+	SelfCheck                *GlobalSelfCheck       `yaml:"self_check,optional"`
+}
+
+// GlobalSelfCheck enables the internal job that periodically verifies the invariants
+// of the zfs abstractions and placeholders of the jobs. nil disables it.
+type GlobalSelfCheck struct {
+	Interval   time.Duration `yaml:"interval,optional,positive,default=1h"`
+	EventHooks []EventHook   `yaml:"event_hooks,optional"`
+}
+
+// GlobalScheduler is the budget that all jobs of the daemon share, see package daemon/scheduler.
+// 0 means unlimited.
+type GlobalScheduler struct {
+	MaxConcurrentReplications int `yaml:"max_concurrent_replications,optional,zeropositive,default=0"`
+	MaxConcurrentZFSCommands  int `yaml:"max_concurrent_zfs_commands,optional,zeropositive,default=0"`
+	MaxPruneDestroysPerMinute int `yaml:"max_prune_destroys_per_minute,optional,zeropositive,default=0"`
+}
+
+// GlobalShutdown configures how the daemon exits on SIGINT and SIGTERM.
+type GlobalShutdown struct {
+	// time for the jobs to finish their current replication step or pruning, 0 aborts them immediately
+	DrainTimeout time.Duration `yaml:"drain_timeout,optional,zeropositive,default=60s"`
+}
+
+// GlobalZFSConcurrency bounds the number of zfs send and zfs recv processes
+// that run concurrently across all jobs of the daemon. 0 means unlimited.
+type GlobalZFSConcurrency struct {
+	Send int `yaml:"send,optional,default=0"`
+	Recv int `yaml:"recv,optional,default=0"`
 }
 
 func Default(i interface{}) {
@@ -238,13 +593,34 @@ type ConnectEnum struct {
 }
 
 type ConnectCommon struct {
-	Type string `yaml:"type"`
+	Type     string           `yaml:"type"`
+	Timeouts *ConnectTimeouts `yaml:"timeouts,optional,fromdefaults"`
+}
+
+func (c *ConnectCommon) connectCommon() *ConnectCommon { return c }
+
+// Common returns the fields shared by all connect types, or nil if t is empty.
+func (t *ConnectEnum) Common() *ConnectCommon {
+	if c, ok := t.Ret.(interface{ connectCommon() *ConnectCommon }); ok {
+		return c.connectCommon()
+	}
+	return nil
+}
+
+type ConnectTimeouts struct {
+	// zero if not set, see rpc.ClientTimeoutsFromConfig for the default
+	Handshake     time.Duration `yaml:"handshake,optional,zeropositive"`
+	Idle          time.Duration `yaml:"idle,optional,positive,default=10s"`
+	SendKeepalive time.Duration `yaml:"send_keepalive,optional,positive,default=5s"`
 }
 
 type TCPConnect struct {
 	ConnectCommon `yaml:",inline"`
 	Address       string        `yaml:"address,hostport"`
 	DialTimeout   time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	// socks5://[user:password@]host:port or http://[user:password@]host:port
+	Proxy  string            `yaml:"proxy,optional"`
+	Socket *TCPSocketOptions `yaml:"socket,optional,fromdefaults"`
 }
 
 type TLSConnect struct {
@@ -255,6 +631,32 @@ type TLSConnect struct {
 	Key           string        `yaml:"key"`
 	ServerCN      string        `yaml:"server_cn"`
 	DialTimeout   time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	// socks5://[user:password@]host:port or http://[user:password@]host:port
+	Proxy  string            `yaml:"proxy,optional"`
+	Socket *TCPSocketOptions `yaml:"socket,optional,fromdefaults"`
+}
+
+type NoiseConnect struct {
+	ConnectCommon `yaml:",inline"`
+	Address       string `yaml:"address,hostport"`
+	// base64, see `zrepl transport keygen`
+	PrivateKey      string        `yaml:"private_key"`
+	ServerPublicKey string        `yaml:"server_public_key"`
+	DialTimeout     time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	// socks5://[user:password@]host:port or http://[user:password@]host:port
+	Proxy  string            `yaml:"proxy,optional"`
+	Socket *TCPSocketOptions `yaml:"socket,optional,fromdefaults"`
+}
+
+// TCPSocketOptions are the socket options of the tcp, tls and noise transports.
+// Options that are not set keep the operating system's defaults.
+type TCPSocketOptions struct {
+	// sizes such as 4MiB
+	SendBuffer    string `yaml:"send_buffer,optional"`
+	ReceiveBuffer string `yaml:"receive_buffer,optional"`
+	NoDelay       bool   `yaml:"no_delay,optional,default=true"`
+	// Linux only, e.g. bbr
+	CongestionControl string `yaml:"congestion_control,optional"`
 }
 
 type SSHStdinserverConnect struct {
@@ -269,6 +671,19 @@ type SSHStdinserverConnect struct {
 	DialTimeout          time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
 }
 
+type SSHConnect struct {
+	ConnectCommon `yaml:",inline"`
+	Host          string        `yaml:"host"`
+	Port          uint16        `yaml:"port,optional,default=22"`
+	User          string        `yaml:"user"`
+	IdentityFile  string        `yaml:"identity_file"`
+	Certificate   string        `yaml:"certificate,optional"`
+	KnownHosts    string        `yaml:"known_hosts"`
+	DialTimeout   time.Duration `yaml:"dial_timeout,zeropositive,default=10s"`
+	// socks5://[user:password@]host:port or http://[user:password@]host:port
+	Proxy string `yaml:"proxy,optional"`
+}
+
 type LocalConnect struct {
 	ConnectCommon  `yaml:",inline"`
 	ListenerName   string        `yaml:"listener_name"`
@@ -286,20 +701,85 @@ type ServeCommon struct {
 
 type TCPServe struct {
 	ServeCommon    `yaml:",inline"`
-	Listen         string            `yaml:"listen,hostport"`
-	ListenFreeBind bool              `yaml:"listen_freebind,default=false"`
-	Clients        map[string]string `yaml:"clients"`
+	Listen         ListenAddresses     `yaml:"listen"`
+	ListenFreeBind bool                `yaml:"listen_freebind,default=false"`
+	Clients        map[string]string   `yaml:"clients"`
+	ClientNetworks map[string][]string `yaml:"client_networks,optional"`
+	Socket         *TCPSocketOptions   `yaml:"socket,optional,fromdefaults"`
 }
 
 type TLSServe struct {
 	ServeCommon      `yaml:",inline"`
-	Listen           string        `yaml:"listen,hostport"`
-	ListenFreeBind   bool          `yaml:"listen_freebind,default=false"`
-	Ca               string        `yaml:"ca"`
-	Cert             string        `yaml:"cert"`
-	Key              string        `yaml:"key"`
-	ClientCNs        []string      `yaml:"client_cns"`
-	HandshakeTimeout time.Duration `yaml:"handshake_timeout,zeropositive,default=10s"`
+	Listen           ListenAddresses `yaml:"listen"`
+	ListenFreeBind   bool            `yaml:"listen_freebind,default=false"`
+	Ca               string          `yaml:"ca"`
+	Cert             string          `yaml:"cert"`
+	Key              string          `yaml:"key"`
+	ClientCNs        []string        `yaml:"client_cns"`
+	ServerNames      []string        `yaml:"server_names,optional"`
+	HandshakeTimeout time.Duration   `yaml:"handshake_timeout,zeropositive,default=10s"`
+	CRL              *TLSServeCRL    `yaml:"crl,optional"`
+	OCSP             *TLSServeOCSP   `yaml:"ocsp,optional"`
+	// client identity => CIDRs or IP addresses
+	ClientNetworks map[string][]string `yaml:"client_networks,optional"`
+	Socket         *TCPSocketOptions   `yaml:"socket,optional,fromdefaults"`
+}
+
+// ListenAddresses is a single host:port address or a list of them.
+type ListenAddresses []string
+
+var _ yaml.Unmarshaler = (*ListenAddresses)(nil)
+
+func (l *ListenAddresses) UnmarshalYAML(u func(interface{}, bool) error) error {
+	var addrs []string
+	var single string
+	if err := u(&single, true); err == nil {
+		addrs = []string{single}
+	} else if err := u(&addrs, true); err != nil {
+		return fmt.Errorf("value must be a host:port address or a list of them")
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("value must not be empty")
+	}
+	seen := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		if _, _, err := net.SplitHostPort(a); err != nil {
+			return fmt.Errorf("invalid listen address %q: %s", a, err)
+		}
+		if seen[a] {
+			return fmt.Errorf("duplicate listen address %q", a)
+		}
+		seen[a] = true
+	}
+	*l = addrs
+	return nil
+}
+
+type NoiseServe struct {
+	ServeCommon    `yaml:",inline"`
+	Listen         ListenAddresses `yaml:"listen"`
+	ListenFreeBind bool            `yaml:"listen_freebind,default=false"`
+	// base64, see `zrepl transport keygen`
+	PrivateKey string `yaml:"private_key"`
+	// client identity => base64 public key
+	Clients          map[string]string `yaml:"clients"`
+	HandshakeTimeout time.Duration     `yaml:"handshake_timeout,zeropositive,default=10s"`
+	// client identity => CIDRs or IP addresses
+	ClientNetworks map[string][]string `yaml:"client_networks,optional"`
+	Socket         *TCPSocketOptions   `yaml:"socket,optional,fromdefaults"`
+}
+
+type TLSServeCRL struct {
+	File            string        `yaml:"file"`
+	RefreshInterval time.Duration `yaml:"refresh_interval,optional,zeropositive,default=1h"`
+}
+
+type TLSServeOCSP struct {
+	// if empty, the responder in the client certificate's Authority Information Access extension
+	Responder string        `yaml:"responder,optional"`
+	Timeout   time.Duration `yaml:"timeout,optional,zeropositive,default=5s"`
+	CacheTime time.Duration `yaml:"cache_time,optional,zeropositive,default=1h"`
+	FailOpen  bool          `yaml:"fail_open,optional,default=false"`
 }
 
 type StdinserverServer struct {
@@ -307,6 +787,34 @@ type StdinserverServer struct {
 	ClientIdentities []string `yaml:"client_identities"`
 }
 
+type SSHServe struct {
+	ServeCommon      `yaml:",inline"`
+	Listen           ListenAddresses   `yaml:"listen"`
+	ListenFreeBind   bool              `yaml:"listen_freebind,default=false"`
+	HostKey          string            `yaml:"host_key"`
+	HostCertificate  string            `yaml:"host_certificate,optional"`
+	Clients          []*SSHServeClient `yaml:"clients,optional"`
+	UserCA           *SSHServeUserCA   `yaml:"user_ca,optional"`
+	HandshakeTimeout time.Duration     `yaml:"handshake_timeout,zeropositive,default=10s"`
+}
+
+// SSHServeUserCA accepts clients with OpenSSH user certificates.
+// The client identity is the user name of the connection, which must be a principal of the certificate.
+type SSHServeUserCA struct {
+	// in authorized_keys format
+	PublicKeys []string `yaml:"public_keys"`
+	// client identities that certificates may grant, with at most one '*' placeholder each
+	Identities []string `yaml:"identities"`
+	// file with revoked user keys or CA keys in authorized_keys format
+	RevokedKeys string `yaml:"revoked_keys,optional"`
+}
+
+type SSHServeClient struct {
+	Identity string `yaml:"identity"`
+	// in authorized_keys format, e.g. "ssh-ed25519 AAAA... comment"
+	PublicKey string `yaml:"public_key"`
+}
+
 type LocalServe struct {
 	ServeCommon  `yaml:",inline"`
 	ListenerName string `yaml:"listener_name"`
@@ -325,6 +833,8 @@ type PruneKeepLastN struct {
 	Type  string `yaml:"type"`
 	Count int    `yaml:"count"`
 	Regex string `yaml:"regex,optional"`
+	// the name of a snapshot class of the job (see SnapshottingPeriodicClass), alternative to Regex
+	Class string `yaml:"class,optional"`
 }
 
 type PruneKeepRegex struct { // FIXME rename to KeepRegex
@@ -333,6 +843,32 @@ type PruneKeepRegex struct { // FIXME rename to KeepRegex
 	Negate bool   `yaml:"negate,optional,default=false"`
 }
 
+// PruneGFS keeps the first snapshot of each of the most recent Daily days, Weekly weeks,
+// Monthly months and Yearly years that have snapshots (grandfather-father-son).
+type PruneGFS struct {
+	Type    string `yaml:"type"`
+	Daily   int    `yaml:"daily,optional,default=0"`
+	Weekly  int    `yaml:"weekly,optional,default=0"`
+	Monthly int    `yaml:"monthly,optional,default=0"`
+	Yearly  int    `yaml:"yearly,optional,default=0"`
+	// the day on which weeks start, e.g., "sunday"
+	Weekday string `yaml:"weekday,optional,default=monday"`
+	// the day on which months start, and on which years start in January
+	DayOfMonth int `yaml:"day_of_month,optional,default=1"`
+	// IANA time zone name for the periods, empty means the local time of the daemon
+	TimeZone string `yaml:"time_zone,optional"`
+	Regex    string `yaml:"regex,optional"`
+	Class    string `yaml:"class,optional"` // see PruneKeepLastN.Class
+}
+
+// PruneKeepUserProperty keeps the snapshots on which ZFS user property Property is set,
+// to Value if Value is not empty.
+type PruneKeepUserProperty struct {
+	Type     string `yaml:"type"`
+	Property string `yaml:"property"`
+	Value    string `yaml:"value,optional"`
+}
+
 type LoggingOutletEnum struct {
 	Ret interface{}
 }
@@ -363,6 +899,11 @@ type TCPLoggingOutlet struct {
 	TLS                 *TCPLoggingOutletTLS `yaml:"tls,optional"`
 }
 
+type FileLoggingOutlet struct {
+	LoggingOutletCommon `yaml:",inline"`
+	Path                string `yaml:"path"`
+}
+
 type TCPLoggingOutletTLS struct {
 	CA   string `yaml:"ca"`
 	Cert string `yaml:"cert"`
@@ -388,7 +929,26 @@ func (f *SyslogFacility) SetDefault() {
 var _ yaml.Defaulter = (*SyslogFacility)(nil)
 
 type GlobalControl struct {
-	SockPath string `yaml:"sockpath,default=/var/run/zrepl/control"`
+	SockPath string       `yaml:"sockpath,default=/var/run/zrepl/control"`
+	HTTP     *ControlHTTP `yaml:"http,optional"`
+	// the jobs created through the control socket are persisted in this directory,
+	// empty disables the creation of jobs at runtime
+	JobsDir string `yaml:"jobs_dir,optional"`
+}
+
+type ControlHTTP struct {
+	Listen         string             `yaml:"listen,hostport"`
+	ListenFreeBind bool               `yaml:"listen_freebind,default=false"`
+	TokenFile      string             `yaml:"token_file"`
+	Cert           string             `yaml:"cert,optional"`
+	Key            string             `yaml:"key,optional"`
+	Health         *ControlHTTPHealth `yaml:"health,optional,fromdefaults"`
+}
+
+// ControlHTTPHealth configures the unauthenticated health endpoints of the HTTP control API.
+type ControlHTTPHealth struct {
+	// by job name: the readiness check fails if the job did not complete an invocation successfully for longer
+	StaleAfter map[string]time.Duration `yaml:"stale_after,optional"`
 }
 
 type GlobalServe struct {
@@ -434,9 +994,30 @@ type HookMySQLLockTables struct {
 	Filesystems        FilesystemsFilter `yaml:"filesystems"`
 }
 
+// HookFSFreeze freezes the filesystem mounted at Mountpoint while the snapshot is taken (Linux only).
+type HookFSFreeze struct {
+	HookSettingsCommon `yaml:",inline"`
+	// empty means the mountpoint of the snapshotted filesystem
+	Mountpoint  string            `yaml:"mountpoint,optional"`
+	Timeout     time.Duration     `yaml:"timeout,optional,positive,default=10s"`
+	Filesystems FilesystemsFilter `yaml:"filesystems"` // required, freezing blocks all writes
+}
+
+// HookQEMUGuestAgent freezes the filesystems of a VM through its QEMU guest agent while the snapshot of its zvols is taken.
+type HookQEMUGuestAgent struct {
+	HookSettingsCommon `yaml:",inline"`
+	// maps zvols, using the patterns of FilesystemsFilter, to the guest agent socket of their VM
+	Sockets map[string]string `yaml:"sockets"`
+	Timeout time.Duration     `yaml:"timeout,optional,positive,default=30s"`
+}
+
 type HookSettingsCommon struct {
 	Type       string `yaml:"type"`
 	ErrIsFatal bool   `yaml:"err_is_fatal,optional,default=false"`
+	// referenced by the DependsOn of other hooks of the same list
+	Name string `yaml:"name,optional"`
+	// if any hook of a list has DependsOn, the hooks of the list run in parallel, ordered only by DependsOn
+	DependsOn []string `yaml:"depends_on,optional"`
 }
 
 func enumUnmarshal(u func(interface{}, bool) error, types map[string]interface{}) (interface{}, error) {
@@ -467,6 +1048,8 @@ func (t *JobEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 		"sink":   &SinkJob{},
 		"pull":   &PullJob{},
 		"source": &SourceJob{},
+		"verify": &VerifyJob{},
+		"local":  &LocalJob{},
 	})
 	return
 }
@@ -476,6 +1059,8 @@ func (t *ConnectEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error)
 		"tcp":             &TCPConnect{},
 		"tls":             &TLSConnect{},
 		"ssh+stdinserver": &SSHStdinserverConnect{},
+		"ssh":             &SSHConnect{},
+		"noise":           &NoiseConnect{},
 		"local":           &LocalConnect{},
 	})
 	return
@@ -486,6 +1071,8 @@ func (t *ServeEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 		"tcp":         &TCPServe{},
 		"tls":         &TLSServe{},
 		"stdinserver": &StdinserverServer{},
+		"ssh":         &SSHServe{},
+		"noise":       &NoiseServe{},
 		"local":       &LocalServe{},
 	})
 	return
@@ -497,6 +1084,8 @@ func (t *PruningEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error)
 		"last_n":         &PruneKeepLastN{},
 		"grid":           &PruneGrid{},
 		"regex":          &PruneKeepRegex{},
+		"gfs":            &PruneGFS{},
+		"user_property":  &PruneKeepUserProperty{},
 	})
 	return
 }
@@ -504,16 +1093,28 @@ func (t *PruningEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error)
 func (t *SnapshottingEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
 		"periodic": &SnapshottingPeriodic{},
+		"cron":     &SnapshottingCron{},
 		"manual":   &SnapshottingManual{},
 	})
 	return
 }
 
+func (t *TriggerEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
+		"periodic":         &TriggerPeriodic{},
+		"cron":             &TriggerCron{},
+		"manual":           &TriggerManual{},
+		"filesystem_event": &TriggerFilesystemEvent{},
+	})
+	return
+}
+
 func (t *LoggingOutletEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
 		"stdout": &StdoutLoggingOutlet{},
 		"syslog": &SyslogLoggingOutlet{},
 		"tcp":    &TCPLoggingOutlet{},
+		"file":   &FileLoggingOutlet{},
 	})
 	return
 }
@@ -584,6 +1185,8 @@ func (t *HookEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 		"command":             &HookCommand{},
 		"postgres-checkpoint": &HookPostgresCheckpoint{},
 		"mysql-lock-tables":   &HookMySQLLockTables{},
+		"fsfreeze":            &HookFSFreeze{},
+		"qemu-guest-agent":    &HookQEMUGuestAgent{},
 	})
 	return
 }
@@ -631,6 +1234,18 @@ func ParseConfigBytes(bytes []byte) (*Config, error) {
 	return c, nil
 }
 
+// ParseJobBytes parses a single job in the schema of the entries of field `jobs`.
+func ParseJobBytes(bytes []byte) (JobEnum, error) {
+	var j *JobEnum
+	if err := yaml.UnmarshalStrict(bytes, &j); err != nil {
+		return JobEnum{}, err
+	}
+	if j == nil {
+		return JobEnum{}, fmt.Errorf("job is empty or only consists of comments")
+	}
+	return *j, nil
+}
+
 var durationStringRegex *regexp.Regexp = regexp.MustCompile(`^\s*(\d+)\s*(s|m|h|d|w)\s*$`)
 
 func parsePositiveDuration(e string) (d time.Duration, err error) {
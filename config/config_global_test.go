@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/syslog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -52,9 +53,14 @@ global:
       ca: /etc/zrepl/log/ca.crt
       cert: /etc/zrepl/log/key.pem
       key: /etc/zrepl/log/cert.pem
+  - type: file
+    level: info
+    format: logfmt
+    path: /var/log/zrepl.log
 `)
-	assert.Equal(t, 4, len(*conf.Global.Logging))
+	assert.Equal(t, 5, len(*conf.Global.Logging))
 	assert.NotNil(t, (*conf.Global.Logging)[3].Ret.(*TCPLoggingOutlet).TLS)
+	assert.Equal(t, "/var/log/zrepl.log", (*conf.Global.Logging)[4].Ret.(*FileLoggingOutlet).Path)
 }
 
 func TestDefaultLoggingOutlet(t *testing.T) {
@@ -75,6 +81,135 @@ global:
 	assert.Equal(t, ":9091", conf.Global.Monitoring[0].Ret.(*PrometheusMonitoring).Listen)
 }
 
+func TestControlHTTP(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Nil(t, conf.Global.Control.HTTP)
+
+	conf = testValidGlobalSection(t, `
+global:
+  control:
+    http:
+      listen: ':9811'
+      token_file: /etc/zrepl/control.token
+      cert: /etc/zrepl/control.crt
+      key: /etc/zrepl/control.key
+`)
+	assert.Equal(t, "/var/run/zrepl/control", conf.Global.Control.SockPath)
+	h := conf.Global.Control.HTTP
+	require.NotNil(t, h)
+	assert.Equal(t, ":9811", h.Listen)
+	assert.Equal(t, "/etc/zrepl/control.token", h.TokenFile)
+	assert.Equal(t, "/etc/zrepl/control.key", h.Key)
+	require.NotNil(t, h.Health)
+	assert.Empty(t, h.Health.StaleAfter)
+
+	conf = testValidGlobalSection(t, `
+global:
+  control:
+    http:
+      listen: ':9811'
+      token_file: /etc/zrepl/control.token
+      health:
+        stale_after:
+          prod_to_backups: 25h
+          snap: 90m
+`)
+	assert.Equal(t, map[string]time.Duration{
+		"prod_to_backups": 25 * time.Hour,
+		"snap":            90 * time.Minute,
+	}, conf.Global.Control.HTTP.Health.StaleAfter)
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, 60*time.Second, conf.Global.Shutdown.DrainTimeout)
+
+	conf = testValidGlobalSection(t, `
+global:
+  shutdown:
+    drain_timeout: 10m
+`)
+	assert.Equal(t, 10*time.Minute, conf.Global.Shutdown.DrainTimeout)
+
+	conf = testValidGlobalSection(t, `
+global:
+  shutdown:
+    drain_timeout: 0s
+`)
+	assert.Equal(t, time.Duration(0), conf.Global.Shutdown.DrainTimeout)
+}
+
+func TestScheduler(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Equal(t, GlobalScheduler{}, *conf.Global.Scheduler)
+	assert.Equal(t, 1, conf.Jobs[0].Ret.(*SinkJob).Weight)
+
+	conf = testValidGlobalSection(t, `
+global:
+  scheduler:
+    max_concurrent_replications: 2
+    max_concurrent_zfs_commands: 8
+    max_prune_destroys_per_minute: 600
+`)
+	assert.Equal(t, GlobalScheduler{
+		MaxConcurrentReplications: 2,
+		MaxConcurrentZFSCommands:  8,
+		MaxPruneDestroysPerMinute: 600,
+	}, *conf.Global.Scheduler)
+
+	_, err := testConfig(t, `
+global:
+  scheduler:
+    max_concurrent_replications: -1
+jobs: []
+`)
+	assert.Error(t, err)
+
+	_, err = testConfig(t, `
+jobs:
+- name: dummyjob
+  type: sink
+  weight: 0
+  serve:
+    type: local
+    listener_name: dummyjob
+  root_fs: zroot/foo
+`)
+	assert.Error(t, err)
+}
+
+func TestSelfCheck(t *testing.T) {
+	conf := testValidGlobalSection(t, "")
+	assert.Nil(t, conf.Global.SelfCheck)
+
+	conf = testValidGlobalSection(t, `
+global:
+  self_check: {}
+`)
+	require.NotNil(t, conf.Global.SelfCheck)
+	assert.Equal(t, time.Hour, conf.Global.SelfCheck.Interval)
+
+	conf = testValidGlobalSection(t, `
+global:
+  self_check:
+    interval: 6h
+    event_hooks:
+    - events: [self_check_completed]
+      path: /etc/zrepl/hooks/notify.sh
+`)
+	assert.Equal(t, 6*time.Hour, conf.Global.SelfCheck.Interval)
+	require.Len(t, conf.Global.SelfCheck.EventHooks, 1)
+	assert.Equal(t, 30*time.Second, conf.Global.SelfCheck.EventHooks[0].Timeout)
+
+	_, err := testConfig(t, `
+global:
+  self_check:
+    interval: 0s
+jobs: []
+`)
+	assert.Error(t, err)
+}
+
 func TestSyslogLoggingOutletFacility(t *testing.T) {
 	type SyslogFacilityPriority struct {
 		Facility string
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneGFS(t *testing.T) {
+	c := testValidConfig(t, `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: gfs
+      daily: 7
+      weekly: 4
+    - type: gfs
+      monthly: 12
+      yearly: 5
+      weekday: sunday
+      day_of_month: 15
+      time_zone: Europe/Berlin
+      regex: "^zrepl_"
+`)
+	keep := c.Jobs[0].Ret.(*SnapJob).Pruning.Keep
+	assert.Equal(t, &PruneGFS{Type: "gfs", Daily: 7, Weekly: 4, Weekday: "monday", DayOfMonth: 1}, keep[0].Ret)
+	assert.Equal(t, &PruneGFS{
+		Type:       "gfs",
+		Monthly:    12,
+		Yearly:     5,
+		Weekday:    "sunday",
+		DayOfMonth: 15,
+		TimeZone:   "Europe/Berlin",
+		Regex:      "^zrepl_",
+	}, keep[1].Ret)
+}
+
+func TestPruneGridAlign(t *testing.T) {
+	c := testValidConfig(t, `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: grid
+      grid: 1x1h(keep=all) | 24x1h | 14x1d
+      regex: "^zrepl_"
+    - type: grid
+      grid: 1x1d | 4x1w
+      regex: "^zrepl_"
+      align: week
+      weekday: sunday
+      time_zone: Europe/Berlin
+`)
+	keep := c.Jobs[0].Ret.(*SnapJob).Pruning.Keep
+	unaligned := keep[0].Ret.(*PruneGrid)
+	assert.Equal(t, "", unaligned.Align)
+	assert.Equal(t, "monday", unaligned.Weekday)
+	assert.Equal(t, "", unaligned.TimeZone)
+	aligned := keep[1].Ret.(*PruneGrid)
+	assert.Equal(t, "week", aligned.Align)
+	assert.Equal(t, "sunday", aligned.Weekday)
+	assert.Equal(t, "Europe/Berlin", aligned.TimeZone)
+}
+
+func TestPruneKeepUserProperty(t *testing.T) {
+	c := testValidConfig(t, `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: user_property
+      property: com.example:keep
+    - type: user_property
+      property: com.example:retain
+      value: "yes"
+`)
+	keep := c.Jobs[0].Ret.(*SnapJob).Pruning.Keep
+	assert.Equal(t, &PruneKeepUserProperty{Type: "user_property", Property: "com.example:keep"}, keep[0].Ret)
+	assert.Equal(t, &PruneKeepUserProperty{Type: "user_property", Property: "com.example:retain", Value: "yes"}, keep[1].Ret)
+}
+
+func TestPruneClones(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	assert.Equal(t, "skip", c.Jobs[0].Ret.(*SnapJob).Pruning.Clones)
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, "    clones: defer"))
+	assert.Equal(t, "defer", c.Jobs[0].Ret.(*SnapJob).Pruning.Clones)
+}
+
+func TestPruneKeepBookmarks(t *testing.T) {
+	c := testValidConfig(t, `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+    keep_sender_bookmarks:
+    - type: last_n
+      count: 5
+`)
+	p := c.Jobs[0].Ret.(*PushJob).Pruning
+	assert.Equal(t, []PruningEnum{{Ret: &PruneKeepLastN{Type: "last_n", Count: 5}}}, p.KeepSenderBookmarks)
+	assert.Empty(t, p.KeepReceiverBookmarks)
+}
+
+func TestPruneTriggers(t *testing.T) {
+	c := testValidConfig(t, `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+    triggers:
+    - type: cron
+      cron: "0 3 * * *"
+`)
+	p := c.Jobs[0].Ret.(*PushJob).Pruning
+	assert.Equal(t, []TriggerEnum{{Ret: &TriggerCron{Type: "cron", Cron: "0 3 * * *"}}}, p.Triggers)
+}
+
+func TestPruneConcurrencyAndRate(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+%s
+`
+	c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+	p := c.Jobs[0].Ret.(*SnapJob).Pruning
+	assert.Equal(t, 0, p.Concurrency)
+	assert.Equal(t, 0, p.DestroysPerMinute)
+
+	c = testValidConfig(t, fmt.Sprintf(tmpl, "    concurrency: 2\n    destroys_per_minute: 30"))
+	p = c.Jobs[0].Ret.(*SnapJob).Pruning
+	assert.Equal(t, 2, p.Concurrency)
+	assert.Equal(t, 30, p.DestroysPerMinute)
+
+	_, err := ParseConfigBytes([]byte(fmt.Sprintf(tmpl, "    destroys_per_minute: -1")))
+	assert.Error(t, err)
+}
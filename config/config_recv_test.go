@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecvZvolOptions(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/recv"
+  serve:
+    type: local
+    listener_name: foo
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("recv_not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		zvol := c.Jobs[0].Ret.(*SinkJob).Recv.Zvol
+		assert.Equal(t, "keep", zvol.Volmode)
+		assert.Equal(t, "keep", zvol.Refreservation)
+	})
+
+	t.Run("zvol_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  recv:
+    zvol:
+      volmode: none
+      refreservation: none
+`))
+		zvol := c.Jobs[0].Ret.(*SinkJob).Recv.Zvol
+		assert.Equal(t, "none", zvol.Volmode)
+		assert.Equal(t, "none", zvol.Refreservation)
+	})
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationOptions(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  %s
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("replication_not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		r := c.Jobs[0].Ret.(*PushJob).Replication
+		assert.True(t, r.SizeEstimates)
+		assert.Equal(t, 0, r.Concurrency.Steps) // default depends on a deprecated environment variable
+		assert.Equal(t, 0, r.Concurrency.FS)
+		assert.Equal(t, "unlimited", r.BandwidthLimit)
+		assert.Empty(t, r.Windows)
+		assert.Equal(t, "per_snapshot", r.IncrementalSteps)
+		assert.Empty(t, r.Priorities)
+		assert.Empty(t, r.Hooks.Replication)
+		assert.Empty(t, r.Hooks.Step)
+		assert.Equal(t, "continue", r.OnError)
+		assert.Equal(t, ReplicationOptionsLargeSteps{Threshold: "unlimited", Action: "defer"}, *r.LargeSteps)
+		// the defaults of the other fields depend on the policy
+		assert.Equal(t, ReplicationRetryPolicy{Multiplier: 1}, *r.Retry.Planning)
+		assert.Equal(t, ReplicationRetryPolicy{Multiplier: 1}, *r.Retry.Network)
+		assert.Equal(t, ReplicationRetryPolicy{Multiplier: 1}, *r.Retry.ZFS)
+		assert.Equal(t, ReplicationOptionsCompression{Algorithm: "none"}, *r.Compression)
+	})
+
+	t.Run("conflict_resolution", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.False(t, c.Jobs[0].Ret.(*PushJob).ConflictResolution.ReceiverRollback)
+		c = testValidConfig(t, fill(`
+  conflict_resolution:
+    receiver_rollback: true
+`))
+		assert.True(t, c.Jobs[0].Ret.(*PushJob).ConflictResolution.ReceiverRollback)
+
+		// the receiving side of push jobs opts in separately
+		sink := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/recv"
+  serve:
+    type: local
+    listener_name: foo
+%s
+`
+		c = testValidConfig(t, fmt.Sprintf(sink, ""))
+		assert.False(t, c.Jobs[0].Ret.(*SinkJob).ConflictResolution.ReceiverRollback)
+		c = testValidConfig(t, fmt.Sprintf(sink, `
+  conflict_resolution:
+    receiver_rollback: true
+`))
+		assert.True(t, c.Jobs[0].Ret.(*SinkJob).ConflictResolution.ReceiverRollback)
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    hooks:
+      replication:
+      - type: command
+        path: /etc/zrepl/hooks/notify.sh
+      step:
+      - type: command
+        path: /etc/zrepl/hooks/step.sh
+        timeout: 10s
+        err_is_fatal: true
+        filesystems:
+          "zroot/db<": true
+`))
+		h := c.Jobs[0].Ret.(*PushJob).Replication.Hooks
+		assert.Len(t, h.Replication, 1)
+		assert.Equal(t, "/etc/zrepl/hooks/notify.sh", h.Replication[0].Ret.(*HookCommand).Path)
+		assert.Len(t, h.Step, 1)
+		step := h.Step[0].Ret.(*HookCommand)
+		assert.Equal(t, 10*time.Second, step.Timeout)
+		assert.True(t, step.ErrIsFatal)
+
+		// passive jobs run step hooks, too
+		sink := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/recv"
+  serve:
+    type: local
+    listener_name: foo
+%s
+`
+		c = testValidConfig(t, fmt.Sprintf(sink, ""))
+		assert.Empty(t, c.Jobs[0].Ret.(*SinkJob).Hooks.Step)
+		c = testValidConfig(t, fmt.Sprintf(sink, `
+  hooks:
+    step:
+    - type: command
+      path: /etc/zrepl/hooks/step.sh
+`))
+		assert.Len(t, c.Jobs[0].Ret.(*SinkJob).Hooks.Step, 1)
+	})
+
+	t.Run("replication_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    size_estimates: false
+    incremental_steps: intermediates
+    on_error: fail_fs_subtree
+    large_steps:
+      threshold: 500GiB
+      action: skip
+    concurrency:
+      steps: 4
+      fs: 8
+    bandwidth_limit: 50MiB/s
+    windows:
+    - from: "22:00"
+      to: "06:00"
+      bandwidth_limit: unlimited
+    - days: [sat, sun]
+      from: "01:00"
+      to: "03:00"
+      pause: true
+    priorities:
+    - regex: "^zroot/vm/"
+      priority: 100
+    - regex: "^zroot/media(/|$)"
+      priority: -10
+    retry:
+      network:
+        max_attempts: 0
+        initial_interval: 5s
+        multiplier: 2
+        jitter: 0.2
+        give_up_timeout: 1h
+      zfs:
+        max_attempts: 10
+    compression:
+      algorithm: zstd
+      level: 9
+`))
+		r := c.Jobs[0].Ret.(*PushJob).Replication
+		assert.False(t, r.SizeEstimates)
+		assert.Equal(t, "intermediates", r.IncrementalSteps)
+		assert.Equal(t, "fail_fs_subtree", r.OnError)
+		assert.Equal(t, ReplicationOptionsLargeSteps{Threshold: "500GiB", Action: "skip"}, *r.LargeSteps)
+		assert.Equal(t, 4, r.Concurrency.Steps)
+		assert.Equal(t, 8, r.Concurrency.FS)
+		assert.Equal(t, "50MiB/s", r.BandwidthLimit)
+		assert.Len(t, r.Windows, 2)
+		assert.Equal(t, &ReplicationWindow{From: "22:00", To: "06:00", BandwidthLimit: "unlimited"}, r.Windows[0])
+		assert.Equal(t, &ReplicationWindow{Days: []string{"sat", "sun"}, From: "01:00", To: "03:00", Pause: true}, r.Windows[1])
+		assert.Equal(t, []*ReplicationPriority{{Regex: "^zroot/vm/", Priority: 100}, {Regex: "^zroot/media(/|$)", Priority: -10}}, r.Priorities)
+		assert.Nil(t, r.Retry.Planning.MaxAttempts)
+		zero, ten := 0, 10
+		initial, giveUp := 5*time.Second, time.Hour
+		assert.Equal(t, ReplicationRetryPolicy{MaxAttempts: &zero, InitialInterval: &initial, Multiplier: 2, Jitter: 0.2, GiveUpTimeout: &giveUp}, *r.Retry.Network)
+		assert.Equal(t, ReplicationRetryPolicy{MaxAttempts: &ten, Multiplier: 1}, *r.Retry.ZFS)
+		assert.Equal(t, ReplicationOptionsCompression{Algorithm: "zstd", Level: 9}, *r.Compression)
+	})
+}
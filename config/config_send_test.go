@@ -71,4 +71,13 @@ jobs:
 		assert.NotNil(t, c)
 	})
 
+	t.Run("properties", func(t *testing.T) {
+		c = testValidConfig(t, fill(send_not_specified))
+		assert.Equal(t, "false", c.Jobs[0].Ret.(*PushJob).Send.Properties)
+		for _, v := range []string{"true", "backup", "false"} {
+			c = testValidConfig(t, fill(fmt.Sprintf("\n  send:\n    properties: %s\n", v)))
+			assert.Equal(t, v, c.Jobs[0].Ret.(*PushJob).Send.Properties)
+		}
+	})
+
 }
@@ -37,6 +37,12 @@ jobs:
     prefix: zrepl_
     interval: 10m
 `
+	cron := `
+  snapshotting:
+    type: cron
+    prefix: zrepl_
+    cron: "0 */4 * * *"
+`
 
 	hooks := `
   snapshotting:
@@ -50,15 +56,26 @@ jobs:
       path: /tmp/path/to/command
       filesystems: { "zroot<": true, "<": false }
     - type: postgres-checkpoint
+      name: postgres
       dsn: "host=localhost port=5432 user=postgres sslmode=disable"
       filesystems: {
           "tank/postgres/data11": true
       }
     - type: mysql-lock-tables
       dsn: "root@tcp(localhost)/"
+      depends_on: [postgres]
       filesystems: {
         "tank/mysql": true
       }
+    - type: fsfreeze
+      mountpoint: /mnt/vm
+      filesystems: {
+        "tank/vm/disk0": true
+      }
+    - type: qemu-guest-agent
+      sockets: {
+        "tank/vm-100<": "/var/run/qemu-server/100.qga"
+      }
 `
 
 	fillSnapshotting := func(s string) string { return fmt.Sprintf(tmpl, s) }
@@ -76,6 +93,72 @@ jobs:
 		assert.Equal(t, "periodic", snp.Type)
 		assert.Equal(t, 10*time.Minute, snp.Interval)
 		assert.Equal(t, "zrepl_", snp.Prefix)
+		assert.False(t, snp.SkipUnchanged)
+	})
+
+	t.Run("periodic_skip_unchanged", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(periodic+"    skip_unchanged: true\n"))
+		snp := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic)
+		assert.True(t, snp.SkipUnchanged)
+	})
+
+	t.Run("periodic_rules", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(periodic+`    rules:
+    - regex: "^tank/db/"
+      interval: 5m
+      prefix: zrepl_db_
+    - regex: "^tank/media$"
+      interval: 24h
+`))
+		snp := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic)
+		if assert.Len(t, snp.Rules, 2) {
+			assert.Equal(t, &SnapshottingPeriodicRule{Regex: "^tank/db/", Interval: 5 * time.Minute, Prefix: "zrepl_db_"}, snp.Rules[0])
+			assert.Equal(t, &SnapshottingPeriodicRule{Regex: "^tank/media$", Interval: 24 * time.Hour}, snp.Rules[1])
+		}
+	})
+
+	t.Run("periodic_classes", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(`
+  snapshotting:
+    type: periodic
+    classes:
+    - name: hourly
+      prefix: zrepl_hourly_
+      interval: 1h
+    - name: daily
+      prefix: zrepl_daily_
+      interval: 24h
+`))
+		snp := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic)
+		assert.Equal(t, time.Duration(0), snp.Interval)
+		if assert.Len(t, snp.Classes, 2) {
+			assert.Equal(t, &SnapshottingPeriodicClass{Name: "hourly", Prefix: "zrepl_hourly_", Interval: time.Hour}, snp.Classes[0])
+			assert.Equal(t, &SnapshottingPeriodicClass{Name: "daily", Prefix: "zrepl_daily_", Interval: 24 * time.Hour}, snp.Classes[1])
+		}
+	})
+
+	t.Run("name_template", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(`
+  snapshotting:
+    type: periodic
+    name_template: 'zrepl_{{.Time.Format "2006-01-02_15:04"}}_{{.JobID}}'
+    interval: 10m
+`))
+		snp := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic)
+		assert.Equal(t, "", snp.Prefix)
+		assert.Equal(t, `zrepl_{{.Time.Format "2006-01-02_15:04"}}_{{.JobID}}`, snp.NameTemplate)
+	})
+
+	t.Run("cron", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(cron))
+		snc := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingCron)
+		assert.Equal(t, "cron", snc.Type)
+		assert.Equal(t, "0 */4 * * *", snc.Cron)
+		assert.Equal(t, "", snc.TimeZone)
+
+		c = testValidConfig(t, fillSnapshotting(cron+"    time_zone: Europe/Berlin\n"))
+		snc = c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingCron)
+		assert.Equal(t, "Europe/Berlin", snc.TimeZone)
 	})
 
 	t.Run("hooks", func(t *testing.T) {
@@ -85,6 +168,19 @@ jobs:
 		assert.Equal(t, hs[1].Ret.(*HookCommand).Filesystems["zroot<"], true)
 		assert.Equal(t, hs[2].Ret.(*HookPostgresCheckpoint).Filesystems["tank/postgres/data11"], true)
 		assert.Equal(t, hs[3].Ret.(*HookMySQLLockTables).Filesystems["tank/mysql"], true)
+		assert.Equal(t, "postgres", hs[2].Ret.(*HookPostgresCheckpoint).Name)
+		assert.Equal(t, []string{"postgres"}, hs[3].Ret.(*HookMySQLLockTables).DependsOn)
+		assert.Equal(t, &HookFSFreeze{
+			HookSettingsCommon: HookSettingsCommon{Type: "fsfreeze"},
+			Mountpoint:         "/mnt/vm",
+			Timeout:            10 * time.Second,
+			Filesystems:        FilesystemsFilter{"tank/vm/disk0": true},
+		}, hs[4].Ret.(*HookFSFreeze))
+		assert.Equal(t, &HookQEMUGuestAgent{
+			HookSettingsCommon: HookSettingsCommon{Type: "qemu-guest-agent"},
+			Sockets:            map[string]string{"tank/vm-100<": "/var/run/qemu-server/100.qga"},
+			Timeout:            30 * time.Second,
+		}, hs[5].Ret.(*HookQEMUGuestAgent))
 	})
 
 }
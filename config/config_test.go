@@ -86,3 +86,31 @@ func TestTrimSpaceEachLineAndPad(t *testing.T) {
 	`
 	assert.Equal(t, "  \n  foo\n  bar baz\n  \n", trimSpaceEachLineAndPad(foo, "  "))
 }
+
+func TestParseJobBytes(t *testing.T) {
+	j, err := ParseJobBytes([]byte(`
+name: "tenant_a"
+type: sink
+root_fs: "pool/tenants/a"
+serve:
+  type: local
+  listener_name: tenant_a
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "tenant_a", j.Name())
+	assert.IsType(t, &SinkJob{}, j.Ret)
+
+	_, err = ParseJobBytes([]byte("# only a comment\n"))
+	assert.Error(t, err)
+
+	_, err = ParseJobBytes([]byte(`
+name: "tenant_a"
+type: sink
+root_fs: "pool/tenants/a"
+unknown_field: true
+serve:
+  type: local
+  listener_name: tenant_a
+`))
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -75,6 +76,26 @@ jobs:
 			server_cn: "server1"
 			`,
 		},
+		{
+			Name:        "noise_with_address_and_port",
+			ExpectError: false,
+			Connect: `
+			type: noise
+			address: "server1.foo.bar:8888"
+			private_key: "TzL/MXcVBVGzPMD1C2SBGQL4zmP189RCZ+0RS74TZII="
+			server_public_key: "3hylLmFWct5+1Qm0FxwnG6TgOa/tlZnFQWxbZmTfVn4="
+			`,
+		},
+		{
+			Name:        "noise_without_port",
+			ExpectError: true,
+			Connect: `
+			type: noise
+			address: "server1.foo.bar"
+			private_key: "TzL/MXcVBVGzPMD1C2SBGQL4zmP189RCZ+0RS74TZII="
+			server_public_key: "3hylLmFWct5+1Qm0FxwnG6TgOa/tlZnFQWxbZmTfVn4="
+			`,
+		},
 	}
 
 	for _, tc := range testTable {
@@ -97,3 +118,111 @@ jobs:
 	}
 
 }
+
+func TestTLSServeRevocation(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/backups"
+  serve:
+    type: tls
+    listen: ":8888"
+    ca:   /etc/zrepl/ca.crt
+    cert: /etc/zrepl/prod.fullchain
+    key:  /etc/zrepl/prod.key
+    client_cns: ["laptop1"]
+%s
+`
+	serve := func(t *testing.T, revocation string) *TLSServe {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, revocation))
+		return c.Jobs[0].Ret.(*SinkJob).Serve.Ret.(*TLSServe)
+	}
+
+	s := serve(t, "")
+	require.Nil(t, s.CRL)
+	require.Nil(t, s.OCSP)
+
+	s = serve(t, `
+    crl:
+      file: /etc/zrepl/ca.crl
+    ocsp: {}
+`)
+	require.Equal(t, "/etc/zrepl/ca.crl", s.CRL.File)
+	require.Equal(t, time.Hour, s.CRL.RefreshInterval)
+	require.Equal(t, "", s.OCSP.Responder)
+	require.Equal(t, 5*time.Second, s.OCSP.Timeout)
+	require.False(t, s.OCSP.FailOpen)
+}
+
+func TestConnectTimeouts(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: pull
+  root_fs: "pool/backups"
+  interval: manual
+  connect:
+    type: tcp
+    address: "server1.foo.bar:8888"
+%s
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	connect := func(t *testing.T, timeouts string) ConnectEnum {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, timeouts))
+		return c.Jobs[0].Ret.(*PullJob).Connect
+	}
+
+	c := connect(t, "")
+	require.Equal(t, &ConnectTimeouts{
+		Handshake:     0, // default depends on deprecated environment variables
+		Idle:          10 * time.Second,
+		SendKeepalive: 5 * time.Second,
+	}, c.Common().Timeouts)
+
+	c = connect(t, `
+    timeouts:
+      idle: 1m
+`)
+	require.Equal(t, time.Minute, c.Common().Timeouts.Idle)
+	require.Equal(t, 5*time.Second, c.Common().Timeouts.SendKeepalive)
+
+	_, err := testConfig(t, fmt.Sprintf(tmpl, `
+    timeouts:
+      handshake: -1s
+`))
+	require.Error(t, err)
+
+	require.Nil(t, (&ConnectEnum{}).Common())
+}
+
+func TestServeListenAddresses(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  root_fs: "pool/backups"
+  serve:
+    type: tcp
+    listen: %s
+    clients: {"10.0.0.1": "foo"}
+`
+	listen := func(t *testing.T, listen string) ListenAddresses {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, listen))
+		return c.Jobs[0].Ret.(*SinkJob).Serve.Ret.(*TCPServe).Listen
+	}
+
+	require.Equal(t, ListenAddresses{":8888"}, listen(t, `":8888"`))
+	require.Equal(t, ListenAddresses{"192.168.1.1:8888", "[fd00::1]:8888"}, listen(t, `["192.168.1.1:8888", "[fd00::1]:8888"]`))
+
+	for _, invalid := range []string{`"192.168.1.1"`, `[]`, `[":8888", ":8888"]`, `{a: b}`} {
+		_, err := testConfig(t, fmt.Sprintf(tmpl, invalid))
+		require.Error(t, err, invalid)
+	}
+}
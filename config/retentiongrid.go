@@ -13,7 +13,15 @@ type RetentionIntervalList []RetentionInterval
 type PruneGrid struct {
 	Type  string                `yaml:"type"`
 	Grid  RetentionIntervalList `yaml:"grid"`
-	Regex string                `yaml:"regex"`
+	Regex string                `yaml:"regex,optional"`
+	Class string                `yaml:"class,optional"` // see PruneKeepLastN.Class
+	// if set, one of hour, day, week and month: the buckets that span at least one of these periods
+	// are aligned to the start of the periods, see retentiongrid.NewAlignedGrid
+	Align string `yaml:"align,optional"`
+	// see PruneGFS.Weekday, only for align week
+	Weekday string `yaml:"weekday,optional,default=monday"`
+	// see PruneGFS.TimeZone
+	TimeZone string `yaml:"time_zone,optional"`
 }
 
 type RetentionInterval struct {
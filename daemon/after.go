@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/after"
+)
+
+// AfterStatus is the status of a job with field `after`.
+type AfterStatus struct {
+	Jobs []*AfterJobStatus // in the order of field `after`
+}
+
+type AfterJobStatus struct {
+	Name string
+	// the job completed an invocation successfully since the job with `after` was last triggered
+	Completed bool
+	// nil if the job did not complete an invocation yet
+	Latest *InvocationStatus
+}
+
+type InvocationStatus struct {
+	CompletedAt time.Time
+	Error       string // empty if the invocation succeeded
+}
+
+// dependencies triggers the jobs with field `after` once all the jobs that they run after
+// completed an invocation successfully since they were last triggered, see package after.
+// It records the outcomes of the invocations of all jobs, which the health checks use, too.
+type dependencies struct {
+	mtx       sync.Mutex
+	after     map[string][]string          // by job name, only jobs with `after`
+	triggers  map[string]after.TriggerFunc // by job name, like after
+	completed map[string]map[string]bool   // by job name, like after: the jobs that completed since the last trigger
+	latest    map[string]*InvocationStatus // by job name, of all jobs
+	succeeded map[string]time.Time         // by job name, of all jobs: the latest successful invocation
+}
+
+func newDependencies() *dependencies {
+	return &dependencies{
+		after:     make(map[string][]string),
+		triggers:  make(map[string]after.TriggerFunc),
+		completed: make(map[string]map[string]bool),
+		latest:    make(map[string]*InvocationStatus),
+		succeeded: make(map[string]time.Time),
+	}
+}
+
+// add registers j, which was started with trigger.
+func (d *dependencies) add(j job.Job, trigger after.TriggerFunc) {
+	aj, ok := j.(job.AfterJob)
+	if !ok || len(aj.After()) == 0 {
+		return
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.after[j.Name()] = aj.After()
+	d.triggers[j.Name()] = trigger
+	d.completed[j.Name()] = make(map[string]bool)
+}
+
+// remove unregisters the job, e.g., because it is restarted after a config reload.
+// The invocations that the job completed still count for the jobs that run after it.
+func (d *dependencies) remove(jobName string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.after, jobName)
+	delete(d.triggers, jobName)
+	delete(d.completed, jobName)
+}
+
+// invocationCompleted records that job jobName completed an invocation, err is nil if it succeeded,
+// and triggers the jobs that run after jobName and all of whose other jobs completed as well.
+func (d *dependencies) invocationCompleted(jobName string, err error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	latest := &InvocationStatus{CompletedAt: time.Now()}
+	if err != nil {
+		latest.Error = err.Error()
+	}
+	d.latest[jobName] = latest
+	if err != nil {
+		return
+	}
+	d.succeeded[jobName] = latest.CompletedAt
+
+	for dependent, names := range d.after {
+		for _, name := range names {
+			if name != jobName {
+				continue
+			}
+			completed := d.completed[dependent]
+			completed[jobName] = true
+			if len(completed) == len(names) {
+				d.completed[dependent] = make(map[string]bool)
+				d.triggers[dependent]()
+			}
+		}
+	}
+}
+
+// lastSuccess returns when job jobName last completed an invocation successfully,
+// ok is false if it did not since the daemon started.
+func (d *dependencies) lastSuccess(jobName string) (_ time.Time, ok bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	t, ok := d.succeeded[jobName]
+	return t, ok
+}
+
+func (d *dependencies) status() map[string]*AfterStatus {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	s := make(map[string]*AfterStatus, len(d.after))
+	for dependent, names := range d.after {
+		st := &AfterStatus{Jobs: make([]*AfterJobStatus, len(names))}
+		for i, name := range names {
+			st.Jobs[i] = &AfterJobStatus{
+				Name:      name,
+				Completed: d.completed[dependent][name],
+			}
+			if latest, ok := d.latest[name]; ok {
+				l := *latest
+				st.Jobs[i].Latest = &l
+			}
+		}
+		s[dependent] = st
+	}
+	return s
+}
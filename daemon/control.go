@@ -13,7 +13,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/ready"
 	"github.com/zrepl/zrepl/daemon/nethelpers"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
@@ -26,17 +28,29 @@ import (
 type controlJob struct {
 	sockaddr *net.UnixAddr
 	jobs     *jobs
+	reloader *reloader
+	http     *controlHTTP // nil => control socket only
 }
 
-func newControlJob(sockpath string, jobs *jobs) (j *controlJob, err error) {
-	j = &controlJob{jobs: jobs}
+// health is served by the HTTP control API, if configured
+func newControlJob(conf *config.GlobalControl, jobs *jobs, reloader *reloader, health *health) (j *controlJob, err error) {
+	j = &controlJob{jobs: jobs, reloader: reloader}
 
-	j.sockaddr, err = net.ResolveUnixAddr("unix", sockpath)
+	j.sockaddr, err = net.ResolveUnixAddr("unix", conf.SockPath)
 	if err != nil {
 		err = errors.Wrap(err, "cannot resolve unix address")
 		return
 	}
 
+	if conf.HTTP != nil {
+		j.http, err = newControlHTTPFromConfig(conf.HTTP)
+		if err != nil {
+			err = errors.Wrap(err, "cannot build HTTP control API")
+			return
+		}
+		j.http.health = health
+	}
+
 	return
 }
 
@@ -77,6 +91,16 @@ const (
 	ControlJobEndpointVersion string = "/version"
 	ControlJobEndpointStatus  string = "/status"
 	ControlJobEndpointSignal  string = "/signal"
+	ControlJobEndpointReload  string = "/reload"
+	ControlJobEndpointJobs    string = "/jobs"
+
+	ControlJobEndpointBandwidthLimit string = "/bandwidth-limit"
+
+	ControlJobEndpointSnapshot string = "/snapshot"
+
+	ControlJobEndpointPruneDryRun string = "/prune/dry-run"
+
+	ControlJobEndpointZFSAbstractionsList string = "/zfs-abstractions/list"
 )
 
 func (j *controlJob) Run(ctx context.Context) {
@@ -115,10 +139,18 @@ func (j *controlJob) Run(ctx context.Context) {
 			return version.NewZreplVersionInformation(), nil
 		}}})
 
-	mux.Handle(ControlJobEndpointStatus,
+	mux.Handle(ControlJobEndpointStatus, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := StatusFilterFromQuery(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			if _, err := io.WriteString(w, err.Error()); err != nil {
+				log.WithError(err).Error("control handler io error")
+			}
+			return
+		}
 		// don't log requests to status endpoint, too spammy
 		jsonResponder{log, func() (interface{}, error) {
-			jobs := j.jobs.status()
+			jobs := filter.apply(j.jobs.status())
 			globalZFS := zfscmd.GetReport()
 			envconstReport := envconst.GetReport()
 			s := Status{
@@ -126,33 +158,106 @@ func (j *controlJob) Run(ctx context.Context) {
 				Global: GlobalStatus{
 					ZFSCmds:  globalZFS,
 					Envconst: envconstReport,
-				}}
+				},
+				After:    j.jobs.dependencies.status(),
+				Shutdown: j.jobs.shutdownStatus(),
+			}
+			if sc, ok := j.jobs.get(jobNameSelfCheck); ok {
+				s.SelfCheck = sc.(*selfCheckJob).status()
+			}
 			return s, nil
-		}})
+		}}.ServeHTTP(w, r)
+	}))
 
 	mux.Handle(ControlJobEndpointSignal,
 		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
 			type reqT struct {
 				Name string
 				Op   string
+				// only for Op == "wakeup", see wakeup.Request
+				Filesystems []string
 			}
 			var req reqT
 			if decoder(&req) != nil {
 				return nil, errors.Errorf("decode failed")
 			}
+			if len(req.Filesystems) > 0 && req.Op != "wakeup" {
+				return nil, errors.Errorf("operation %q does not support a filesystem selection", req.Op)
+			}
 
 			var err error
 			switch req.Op {
 			case "wakeup":
-				err = j.jobs.wakeup(req.Name)
+				err = j.jobs.wakeup(req.Name, req.Filesystems)
 			case "reset":
 				err = j.jobs.reset(req.Name)
+			case "plan":
+				err = j.jobs.dryRun(req.Name)
 			default:
 				err = fmt.Errorf("operation %q is invalid", req.Op)
 			}
 
 			return struct{}{}, err
 		}}})
+
+	mux.Handle(ControlJobEndpointReload,
+		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
+			var req struct{}
+			if decoder(&req) != nil {
+				return nil, errors.Errorf("decode failed")
+			}
+			return j.reloader.reload()
+		}}})
+
+	mux.Handle(ControlJobEndpointJobs,
+		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
+			var req JobsRequest
+			if decoder(&req) != nil {
+				return nil, errors.Errorf("decode failed")
+			}
+			return j.reloader.manageJobs(req)
+		}}})
+
+	mux.Handle(ControlJobEndpointSnapshot,
+		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
+			var req SnapshotRequest
+			if decoder(&req) != nil {
+				return nil, errors.Errorf("decode failed")
+			}
+			return struct{}{}, j.jobs.snapshot(ctx, req.Name, req.Filesystems)
+		}}})
+
+	mux.Handle(ControlJobEndpointPruneDryRun,
+		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
+			var req PruneDryRunRequest
+			if decoder(&req) != nil {
+				return nil, errors.Errorf("decode failed")
+			}
+			return struct{}{}, j.jobs.pruneDryRun(req.Name)
+		}}})
+
+	mux.Handle(ControlJobEndpointBandwidthLimit,
+		requestLogger{log: log, handler: jsonRequestResponder{log, func(decoder jsonDecoder) (interface{}, error) {
+			var req BandwidthLimitRequest
+			if decoder(&req) != nil {
+				return nil, errors.Errorf("decode failed")
+			}
+			rate, err := j.jobs.bandwidthLimit(req.Name, req.Rate)
+			return BandwidthLimitResponse{Rate: rate}, err
+		}}})
+
+	mux.Handle(ControlJobEndpointZFSAbstractionsList,
+		requestLogger{log: log, handler: zfsAbstractionsListHandler{log}})
+
+	if j.http != nil {
+		if hl, err := j.http.listenTCP(); err != nil {
+			log.WithError(err).Error("cannot listen for HTTP control API")
+		} else {
+			go j.http.serve(ctx, log, hl, mux)
+		}
+	}
+	ready.Ready(ctx)
+
 	server := http.Server{
 		Handler: mux,
 		// control socket is local, 1s timeout should be more than sufficient, even on a loaded system
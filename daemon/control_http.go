@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+// The endpoints of the control socket that the HTTP control API exposes,
+// and the HTTP methods that it accepts for them.
+// Endpoints that change the daemon's state only accept POST.
+var controlHTTPEndpoints = map[string][]string{
+	ControlJobEndpointVersion:             {http.MethodGet, http.MethodPost},
+	ControlJobEndpointStatus:              {http.MethodGet, http.MethodPost},
+	ControlJobEndpointSignal:              {http.MethodPost},
+	ControlJobEndpointSnapshot:            {http.MethodPost},
+	ControlJobEndpointPruneDryRun:         {http.MethodPost},
+	ControlJobEndpointZFSAbstractionsList: {http.MethodPost},
+}
+
+// a shorter token would be guessable
+const controlHTTPMinTokenLen = 16
+
+// controlHTTP serves the controlHTTPEndpoints of the control socket over TCP.
+// Clients authenticate with the token as a bearer token.
+type controlHTTP struct {
+	listen    string
+	freeBind  bool
+	token     []byte
+	tlsConfig *tls.Config // nil => plain HTTP
+	health    *health     // serves the health endpoints, which do not require authentication
+}
+
+func newControlHTTPFromConfig(in *config.ControlHTTP) (*controlHTTP, error) {
+	if _, _, err := net.SplitHostPort(in.Listen); err != nil {
+		return nil, errors.Wrap(err, "invalid field 'listen'")
+	}
+
+	token, err := ioutil.ReadFile(in.TokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read field 'token_file'")
+	}
+	token = bytes.TrimSpace(token)
+	if len(token) < controlHTTPMinTokenLen {
+		return nil, errors.Errorf("token in %q must be at least %d characters long", in.TokenFile, controlHTTPMinTokenLen)
+	}
+	c := &controlHTTP{listen: in.Listen, freeBind: in.ListenFreeBind, token: token}
+
+	if (in.Cert == "") != (in.Key == "") {
+		return nil, errors.New("fields 'cert' and 'key' must be specified together")
+	}
+	if in.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(in.Cert, in.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot load certificate and key")
+		}
+		c.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	return c, nil
+}
+
+// handler restricts controlSocket, the handler of the control socket, to the controlHTTPEndpoints
+// and requires authentication. It also serves the health endpoints, see health.
+func (c *controlHTTP) handler(controlSocket http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// orchestrators and monitoring probe these without credentials, they reveal no more than job names
+		switch r.URL.Path {
+		case ControlHTTPEndpointHealthz:
+			c.health.handler(c.health.live).ServeHTTP(w, r)
+			return
+		case ControlHTTPEndpointReadyz:
+			c.health.handler(c.health.ready).ServeHTTP(w, r)
+			return
+		}
+		// authenticate first so that unauthenticated clients learn nothing about the endpoints
+		const bearer = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, bearer) || subtle.ConstantTimeCompare([]byte(auth[len(bearer):]), c.token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zrepl"`)
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		methods, ok := controlHTTPEndpoints[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		for _, m := range methods {
+			if r.Method == m {
+				controlSocket.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})
+}
+
+func (c *controlHTTP) listenTCP() (net.Listener, error) {
+	return tcpsock.Listen(c.listen, c.freeBind)
+}
+
+func (c *controlHTTP) serve(ctx context.Context, log Logger, l net.Listener, controlSocket http.Handler) {
+	server := http.Server{
+		Handler:   c.handler(controlSocket),
+		TLSConfig: c.tlsConfig,
+		// unlike the control socket, clients may be on remote hosts
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		// HTTP/2 does not support hijacking, which the zfs-abstractions list handler requires
+		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+	}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.WithError(err).Error("cannot shutdown HTTP control API server")
+		}
+	}()
+	var err error
+	if c.tlsConfig != nil {
+		err = server.ServeTLS(l, "", "")
+	} else {
+		err = server.Serve(l)
+	}
+	if err != http.ErrServerClosed {
+		log.WithError(err).Error("error serving HTTP control API")
+	}
+}
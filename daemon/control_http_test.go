@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestControlHTTPHandler(t *testing.T) {
+	const token = "0123456789abcdef"
+	c := &controlHTTP{token: []byte(token)}
+	var served []string
+	h := c.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, path, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tcs := []struct {
+		name, method, path, auth string
+		code                     int
+	}{
+		{"missing_token", http.MethodGet, ControlJobEndpointStatus, "", http.StatusUnauthorized},
+		{"wrong_token", http.MethodGet, ControlJobEndpointStatus, "Bearer fedcba9876543210", http.StatusUnauthorized},
+		{"token_prefix", http.MethodGet, ControlJobEndpointStatus, "Bearer " + token[:8], http.StatusUnauthorized},
+		{"not_bearer", http.MethodGet, ControlJobEndpointStatus, "Basic " + token, http.StatusUnauthorized},
+		// authentication comes first so that unauthenticated clients learn nothing about the endpoints
+		{"unknown_endpoint_without_token", http.MethodPost, "/nonexistent", "", http.StatusUnauthorized},
+		{"unknown_endpoint", http.MethodPost, "/nonexistent", "Bearer " + token, http.StatusNotFound},
+		{"endpoint_not_exposed", http.MethodPost, ControlJobEndpointReload, "Bearer " + token, http.StatusNotFound},
+		{"method_not_allowed", http.MethodGet, ControlJobEndpointSignal, "Bearer " + token, http.StatusMethodNotAllowed},
+		{"allowed_get", http.MethodGet, ControlJobEndpointStatus, "Bearer " + token, http.StatusOK},
+		{"allowed_post", http.MethodPost, ControlJobEndpointSignal, "Bearer " + token, http.StatusOK},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			served = nil
+			w := do(tc.method, tc.path, tc.auth)
+			assert.Equal(t, tc.code, w.Code)
+			switch tc.code {
+			case http.StatusOK:
+				assert.Equal(t, []string{tc.method + " " + tc.path}, served)
+			case http.StatusUnauthorized:
+				assert.Equal(t, `Bearer realm="zrepl"`, w.Header().Get("WWW-Authenticate"))
+				assert.Empty(t, served)
+			case http.StatusMethodNotAllowed:
+				assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+				assert.Empty(t, served)
+			default:
+				assert.Empty(t, served)
+			}
+		})
+	}
+}
+
+func TestControlHTTPFromConfigToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-control-http")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("0123456789abcdef\n"), 0600))
+	c, err := newControlHTTPFromConfig(&config.ControlHTTP{Listen: ":9812", TokenFile: tokenFile})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), c.token, "trailing newline must be trimmed")
+
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("tooshort\n"), 0600))
+	_, err = newControlHTTPFromConfig(&config.ControlHTTP{Listen: ":9812", TokenFile: tokenFile})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// JobsRequest is the request of ControlJobEndpointJobs, which manages the jobs in field `global.control.jobs_dir`.
+type JobsRequest struct {
+	Op string // "create", "modify", "delete" or "list"
+	// for "create" and "modify", the job in the schema of the entries of the config file's field `jobs`,
+	// as YAML or JSON. "modify" replaces the spec of the job with the same name.
+	Spec string
+	// only for "delete"
+	Name string
+}
+
+type JobsResponse struct {
+	// how the change affected the running jobs, like for a reload of the config file. nil for "list".
+	Reload *ReloadResponse `json:",omitempty"`
+	// only for "list": the persisted specs by job name
+	Specs map[string]string `json:",omitempty"`
+}
+
+func (r *reloader) manageJobs(req JobsRequest) (*JobsResponse, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.jobsDir == nil {
+		return nil, errors.New("jobs cannot be managed at runtime, field `global.control.jobs_dir` is not set")
+	}
+
+	if req.Op == "list" {
+		specs, err := r.jobsDir.specs()
+		if err != nil {
+			return nil, err
+		}
+		res := &JobsResponse{Specs: make(map[string]string, len(specs))}
+		for name, spec := range specs {
+			res.Specs[name] = string(spec)
+		}
+		return res, nil
+	}
+
+	var (
+		name    string
+		spec    []byte
+		dynamic []config.JobEnum
+	)
+	switch req.Op {
+	case "create", "modify":
+		if req.Name != "" {
+			return nil, errors.Errorf("operation %q takes the name from the spec", req.Op)
+		}
+		spec = []byte(req.Spec)
+		j, err := config.ParseJobBytes(spec)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse job spec")
+		}
+		name = j.Name()
+		if req.Op == "create" {
+			for _, c := range r.conf.Jobs {
+				if c.Name() == name {
+					return nil, errors.Errorf("job %q already exists", name)
+				}
+			}
+			dynamic = append([]config.JobEnum(nil), r.dynamic...)
+		} else if dynamic = r.withoutDynamic(name); dynamic == nil {
+			return nil, r.notDynamicErr(name)
+		}
+		// same order as jobsDir.load
+		dynamic = append(dynamic, j)
+		sort.Slice(dynamic, func(i, k int) bool { return dynamic[i].Name() < dynamic[k].Name() })
+	case "delete":
+		name = req.Name
+		if dynamic = r.withoutDynamic(name); dynamic == nil {
+			return nil, r.notDynamicErr(name)
+		}
+	default:
+		return nil, errors.Errorf("operation %q is invalid", req.Op)
+	}
+
+	conf, err := withJobs(r.fileConf, dynamic)
+	if err != nil {
+		return nil, err
+	}
+	apply, err := r.prepare(conf)
+	if err != nil {
+		return nil, err
+	}
+	// persist first: if the daemon restarts, it should run the jobs that we report
+	if req.Op == "delete" {
+		err = r.jobsDir.remove(name)
+	} else {
+		err = r.jobsDir.write(name, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.dynamic = dynamic
+	r.log.WithField("job", name).WithField("op", req.Op).Info("changed job through control socket")
+	return &JobsResponse{Reload: apply()}, nil
+}
+
+// withoutDynamic returns r.dynamic without job name, or nil if name is not in r.dynamic.
+func (r *reloader) withoutDynamic(name string) []config.JobEnum {
+	found := false
+	without := []config.JobEnum{}
+	for _, j := range r.dynamic {
+		if j.Name() == name {
+			found = true
+			continue
+		}
+		without = append(without, j)
+	}
+	if !found {
+		return nil
+	}
+	return without
+}
+
+func (r *reloader) notDynamicErr(name string) error {
+	for _, j := range r.fileConf.Jobs {
+		if j.Name() == name {
+			return errors.Errorf("job %q is defined in the config file, edit it there and reload", name)
+		}
+	}
+	return errors.Errorf("job %q does not exist", name)
+}
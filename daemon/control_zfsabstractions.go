@@ -0,0 +1,212 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// The wire representation of an endpoint.ListZFSHoldsAndBookmarksQuery.
+// (The query itself is not serializable because of its zfs.DatasetFilter.)
+type ZFSAbstractionsListRequest struct {
+	// FS != nil XOR FSFilter != nil
+	FS *string
+	// maps <dataset-pattern> to ok|!, see filters.DatasetMapFilter
+	FSFilter map[string]string
+
+	What           []string
+	JobID          *string
+	ClientIdentity *string
+	Concurrency    int64
+	OrderBy        string
+	Limit          int64
+}
+
+func (r *ZFSAbstractionsListRequest) Query() (endpoint.ListZFSHoldsAndBookmarksQuery, error) {
+	var q endpoint.ListZFSHoldsAndBookmarksQuery
+
+	if r.FS != nil {
+		q.FS.FS = r.FS
+	} else {
+		f := filters.NewDatasetMapFilter(len(r.FSFilter), true)
+		for pattern, mapping := range r.FSFilter {
+			if err := f.Add(pattern, mapping); err != nil {
+				return q, errors.Wrapf(err, "filesystem filter entry %q", pattern)
+			}
+		}
+		q.FS.Filter = f
+	}
+
+	what, err := endpoint.AbstractionTypeSetFromStrings(r.What)
+	if err != nil {
+		return q, err
+	}
+	q.What = what
+
+	if r.JobID != nil {
+		jobID, err := endpoint.MakeJobID(*r.JobID)
+		if err != nil {
+			return q, errors.Wrap(err, "job id")
+		}
+		q.JobID = &jobID
+	}
+	q.ClientIdentity = r.ClientIdentity
+	q.Concurrency = r.Concurrency
+	q.OrderBy = endpoint.ListZFSHoldsAndBookmarksQueryOrderBy(r.OrderBy)
+	q.Limit = r.Limit
+
+	return q, q.Validate()
+}
+
+// ZFSAbstractionsListResponseItem is one line of the newline-delimited JSON
+// response of ControlJobEndpointZFSAbstractionsList.
+// Exactly one of the fields is not nil.
+type ZFSAbstractionsListResponseItem struct {
+	Abstraction *endpoint.AbstractionJSON `json:",omitempty"`
+	Error       *ZFSAbstractionsListError `json:",omitempty"`
+}
+
+type ZFSAbstractionsListError struct {
+	FS   string
+	Snap string
+	What string
+	Err  string
+}
+
+func (e *ZFSAbstractionsListError) ListAbstractionsError() endpoint.ListAbstractionsError {
+	return endpoint.ListAbstractionsError{
+		FS:   e.FS,
+		Snap: e.Snap,
+		What: e.What,
+		Err:  errors.New(e.Err),
+	}
+}
+
+var zfsAbstractionsListChunkWriteTimeout = envconst.Duration("ZREPL_DAEMON_CONTROL_ZFS_ABSTRACTIONS_LIST_CHUNK_WRITE_TIMEOUT", 1*time.Second)
+
+// Streams the result of endpoint.ListAbstractionsStreamed as newline-delimited JSON
+// so that the daemon never materializes the full listing in memory.
+//
+// The control server's WriteTimeout applies to the entire response, which is too short
+// for large listings. Hence, the handler takes over the connection and applies the
+// timeout per written chunk instead.
+// The request context is not canceled for a hijacked connection, so the handler
+// cancels the listing itself once the client disconnects or a write fails.
+type zfsAbstractionsListHandler struct {
+	log Logger
+}
+
+func (h zfsAbstractionsListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req ZFSAbstractionsListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.logIoErr(io.WriteString(w, err.Error()))
+		return
+	}
+	q, err := req.Query()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.logIoErr(io.WriteString(w, err.Error()))
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		h.log.Error("control handler: response writer does not support hijacking")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	abstractions, listErrs, err := endpoint.ListAbstractionsStreamed(ctx, q)
+	if err != nil {
+		h.log.WithError(err).Error("control handler error")
+		w.WriteHeader(http.StatusInternalServerError)
+		h.logIoErr(io.WriteString(w, err.Error()))
+		return
+	}
+
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		h.log.WithError(err).Error("control handler: cannot hijack connection")
+		// the producer blocks until we have consumed all of its output
+		go func() {
+			for range abstractions {
+			}
+		}()
+		for range listErrs {
+		}
+		return
+	}
+	defer conn.Close()
+
+	// the client does not send anything after the request, the read returns once it disconnects
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, bufrw.Reader)
+		cancel()
+	}()
+
+	var writeErr error
+	enc := json.NewEncoder(bufrw)
+	put := func(item ZFSAbstractionsListResponseItem) {
+		if writeErr != nil {
+			return // drain
+		}
+		if writeErr = conn.SetWriteDeadline(time.Now().Add(zfsAbstractionsListChunkWriteTimeout)); writeErr != nil {
+			return
+		}
+		if writeErr = enc.Encode(item); writeErr != nil {
+			cancel()
+		}
+	}
+
+	if _, writeErr = fmt.Fprintf(bufrw, "HTTP/1.1 200 OK\r\nContent-Type: application/x-ndjson\r\nConnection: close\r\n\r\n"); writeErr != nil {
+		cancel()
+	}
+	for abstractions != nil || listErrs != nil {
+		select {
+		case a, ok := <-abstractions:
+			if !ok {
+				abstractions = nil
+				continue
+			}
+			put(ZFSAbstractionsListResponseItem{Abstraction: &endpoint.AbstractionJSON{Abstraction: a}})
+		case e, ok := <-listErrs:
+			if !ok {
+				listErrs = nil
+				continue
+			}
+			put(ZFSAbstractionsListResponseItem{Error: &ZFSAbstractionsListError{
+				FS:   e.FS,
+				Snap: e.Snap,
+				What: e.What,
+				Err:  e.Err.Error(),
+			}})
+		}
+	}
+	if writeErr == nil {
+		if writeErr = conn.SetWriteDeadline(time.Now().Add(zfsAbstractionsListChunkWriteTimeout)); writeErr == nil {
+			writeErr = bufrw.Flush()
+		}
+	}
+	if writeErr != nil {
+		h.log.WithError(writeErr).Error("control handler io error")
+	}
+}
+
+func (h zfsAbstractionsListHandler) logIoErr(_ int, err error) {
+	if err != nil {
+		h.log.WithError(err).Error("control handler io error")
+	}
+}
@@ -19,49 +19,51 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/after"
+	"github.com/zrepl/zrepl/daemon/job/dryrun"
+	"github.com/zrepl/zrepl/daemon/job/ready"
 	"github.com/zrepl/zrepl/daemon/job/reset"
+	"github.com/zrepl/zrepl/daemon/job/stop"
 	"github.com/zrepl/zrepl/daemon/job/wakeup"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/scheduler"
 	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
+	"github.com/zrepl/zrepl/rpc/versionhandshake"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
 	"github.com/zrepl/zrepl/version"
+	"github.com/zrepl/zrepl/zfs"
 	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
-func Run(ctx context.Context, conf *config.Config) error {
+// Run runs the daemon with conf, which was parsed from configPath (empty for the default locations).
+func Run(ctx context.Context, conf *config.Config, configPath string) error {
 	ctx, cancel := context.WithCancel(ctx)
 
 	defer cancel()
-	sigChan := make(chan os.Signal, 1)
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		cancel()
-	}()
+	defer signal.Stop(sigChan)
 
-	outlets, err := logging.OutletsFromConfig(*conf.Global.Logging)
+	jobsDir, err := newJobsDir(conf.Global.Control.JobsDir)
 	if err != nil {
-		return errors.Wrap(err, "cannot build logging from config")
+		return err
 	}
-	outlets.Add(newPrometheusLogOutlet(), logger.Debug)
-
-	confJobs, err := job.JobsFromConfig(conf)
+	dynamic, err := jobsDir.load()
 	if err != nil {
-		return errors.Wrap(err, "cannot build jobs from config")
+		return err
+	}
+	fileConf := conf
+	if conf, err = withJobs(fileConf, dynamic); err != nil {
+		return err
 	}
 
-	log := logger.NewLogger(outlets, 1*time.Second)
-	log.Info(version.NewZreplVersionInformation().String())
-
-	ctx = logging.WithLoggers(ctx, logging.SubsystemLoggersWithUniversalLogger(log))
-	trace.RegisterCallback(trace.Callback{
-		OnBegin: func(ctx context.Context) { logging.GetLogger(ctx, logging.SubsysTraceData).Debug("begin span") },
-		OnEnd: func(ctx context.Context, spanInfo trace.SpanInfo) {
-			logging.
-				GetLogger(ctx, logging.SubsysTraceData).
-				WithField("duration_s", spanInfo.EndedAt().Sub(spanInfo.StartedAt()).Seconds()).
-				Debug("finished span " + spanInfo.TaskAndSpanStack(trace.SpanStackKindAnnotation))
-		},
-	})
+	ctx, log, confJobs, err := setup(ctx, conf)
+	if err != nil {
+		return err
+	}
 
 	for _, job := range confJobs {
 		if IsInternalJobName(job.Name()) {
@@ -70,13 +72,60 @@ func Run(ctx context.Context, conf *config.Config) error {
 	}
 
 	jobs := newJobs()
+	reloader := newReloader(ctx, log, configPath, jobsDir, fileConf, dynamic, conf, jobs)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+		}
+		notifyStopping(log)
+		drainTimeout := conf.Global.Shutdown.DrainTimeout
+		if drainTimeout == 0 {
+			log.Info("received signal, shutting down")
+			cancel()
+			return
+		}
+		log.WithField("drain_timeout", drainTimeout).
+			Info("received signal, waiting for jobs to finish their current step, send again to abort")
+		select {
+		case <-jobs.drain(drainTimeout):
+			if draining := jobs.shutdownStatus().Draining; len(draining) > 0 {
+				log.WithField("jobs", draining).Warn("drain timeout elapsed, aborting the remaining jobs")
+			} else {
+				log.Info("all jobs drained")
+			}
+		case <-sigChan:
+			log.Info("received signal, aborting jobs")
+		}
+		cancel()
+	}()
+
+	startup := newStartup()
+	daemonHealth := &health{
+		alive:     newHealthCheck(conf.Global.Control.SockPath, jobs),
+		startup:   startup,
+		jobs:      jobs,
+		startedAt: time.Now(),
+	}
+	if conf.Global.Control.HTTP != nil {
+		daemonHealth.staleAfter = conf.Global.Control.HTTP.Health.StaleAfter
+	}
+
+	// the jobs that must be ready before we notify the service manager
+	var started []startedJob
+	start := func(j job.Job, internal bool) {
+		ready, done := jobs.start(ctx, j, internal)
+		started = append(started, startedJob{name: j.Name(), ready: ready, done: done})
+	}
 
 	// start control socket
-	controlJob, err := newControlJob(conf.Global.Control.SockPath, jobs)
+	controlJob, err := newControlJob(conf.Global.Control, jobs, reloader, daemonHealth)
 	if err != nil {
-		panic(err) // FIXME
+		return errors.Wrap(err, "cannot build control job")
 	}
-	jobs.start(ctx, controlJob, true)
+	start(controlJob, true)
 
 	for i, jc := range conf.Global.Monitoring {
 		var (
@@ -92,7 +141,15 @@ func Run(ctx context.Context, conf *config.Config) error {
 		if err != nil {
 			return errors.Wrapf(err, "cannot build monitoring job #%d", i)
 		}
-		jobs.start(ctx, job, true)
+		start(job, true)
+	}
+
+	if conf.Global.SelfCheck != nil {
+		selfCheck, err := newSelfCheckJobFromConfig(conf.Global.SelfCheck, reloader)
+		if err != nil {
+			return errors.Wrap(err, "cannot build self-check job from field `global.self_check`")
+		}
+		start(selfCheck, true)
 	}
 
 	// register global (=non job-local) metrics
@@ -100,17 +157,52 @@ func Run(ctx context.Context, conf *config.Config) error {
 	zfscmd.RegisterMetrics(prometheus.DefaultRegisterer)
 	trace.RegisterMetrics(prometheus.DefaultRegisterer)
 	endpoint.RegisterMetrics(prometheus.DefaultRegisterer)
+	transporttls.RegisterMetrics(prometheus.DefaultRegisterer)
+	compression.RegisterMetrics(prometheus.DefaultRegisterer)
+	versionhandshake.RegisterMetrics(prometheus.DefaultRegisterer)
 
 	log.Info("starting daemon")
 
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				log.Info("received SIGHUP, reloading config")
+				res, err := reloader.reload()
+				if err != nil {
+					log.WithError(err).Error("cannot reload config, jobs continue with the previous config")
+					continue
+				}
+				log.WithField("started", res.Started).
+					WithField("stopped", res.Stopped).
+					WithField("restarted", res.Restarted).
+					WithField("reconfigured", res.Reconfigured).
+					Info("reloaded config")
+			}
+		}
+	}()
+	go func() {
+		if err := transporttls.WatchCertificates(ctx); err != nil {
+			log.WithError(err).Error("cannot watch tls certificate files for changes, send SIGHUP to reload them")
+		}
+	}()
+
 	// start regular jobs
 	for _, j := range confJobs {
-		jobs.start(ctx, j, false)
+		start(j, false)
 	}
 
+	go startup.wait(ctx, log, started)
+	go notifyReady(ctx, log, startup, daemonHealth.alive)
+
 	select {
 	case <-jobs.wait():
 		log.Info("all jobs finished")
+		notifyStopping(log)
 	case <-ctx.Done():
 		log.WithError(ctx.Err()).Info("context finished")
 	}
@@ -120,21 +212,86 @@ func Run(ctx context.Context, conf *config.Config) error {
 	return nil
 }
 
+// setup applies the global config and builds the jobs of conf.
+// The returned ctx carries the loggers of the logging config.
+func setup(ctx context.Context, conf *config.Config) (_ context.Context, _ logger.Logger, _ []job.Job, err error) {
+	outlets, err := logging.OutletsFromConfig(*conf.Global.Logging)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot build logging from config")
+	}
+	outlets.Add(newPrometheusLogOutlet(), logger.Debug)
+
+	if err := zfs.SetBackend(zfs.Backend(conf.Global.ZFSBackend)); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot configure zfs backend")
+	}
+
+	// must happen before building the jobs because job names are validated against the abstraction names
+	if err := endpoint.SetAbstractionsNamespace(conf.Global.ZFSAbstractionsNamespace); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot configure zfs abstractions namespace")
+	}
+
+	if err := endpoint.SetMaxConcurrentSendRecv(conf.Global.ZFSConcurrency.Send, conf.Global.ZFSConcurrency.Recv); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot configure field `global.zfs_concurrency`")
+	}
+
+	if err := scheduler.Configure(scheduler.Limits{
+		Replications:      conf.Global.Scheduler.MaxConcurrentReplications,
+		ZFSCommands:       conf.Global.Scheduler.MaxConcurrentZFSCommands,
+		DestroysPerMinute: conf.Global.Scheduler.MaxPruneDestroysPerMinute,
+	}); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot configure field `global.scheduler`")
+	}
+	zfscmd.SetBudget(scheduler.AcquireZFSCommand)
+
+	confJobs, err := job.JobsFromConfig(conf)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "cannot build jobs from config")
+	}
+
+	log := logger.NewLogger(outlets, 1*time.Second)
+	log.Info(version.NewZreplVersionInformation().String())
+
+	ctx = logging.WithLoggers(ctx, logging.SubsystemLoggersWithUniversalLogger(log))
+	trace.RegisterCallback(trace.Callback{
+		OnBegin: func(ctx context.Context) { logging.GetLogger(ctx, logging.SubsysTraceData).Debug("begin span") },
+		OnEnd: func(ctx context.Context, spanInfo trace.SpanInfo) {
+			logging.
+				GetLogger(ctx, logging.SubsysTraceData).
+				WithField("duration_s", spanInfo.EndedAt().Sub(spanInfo.StartedAt()).Seconds()).
+				Debug("finished span " + spanInfo.TaskAndSpanStack(trace.SpanStackKindAnnotation))
+		},
+	})
+	return ctx, log, confJobs, nil
+}
+
 type jobs struct {
 	wg sync.WaitGroup
 
 	// m protects all fields below it
-	m       sync.RWMutex
-	wakeups map[string]wakeup.Func // by Job.Name
-	resets  map[string]reset.Func  // by Job.Name
-	jobs    map[string]job.Job
+	m           sync.RWMutex
+	wakeups     map[string]wakeup.Func    // by Job.Name
+	resets      map[string]reset.Func     // by Job.Name
+	dryRuns     map[string]dryrun.Func    // by Job.Name
+	stops       map[string]stop.Func      // by Job.Name
+	dones       map[string]chan struct{}  // by Job.Name, closed when the job's Run returned
+	registerers map[string]*jobRegisterer // by Job.Name
+	jobs        map[string]job.Job
+	shutdown    *ShutdownStatus // nil unless the daemon is shutting down, see drain
+
+	dependencies *dependencies
 }
 
 func newJobs() *jobs {
 	return &jobs{
-		wakeups: make(map[string]wakeup.Func),
-		resets:  make(map[string]reset.Func),
-		jobs:    make(map[string]job.Job),
+		wakeups:     make(map[string]wakeup.Func),
+		resets:      make(map[string]reset.Func),
+		dryRuns:     make(map[string]dryrun.Func),
+		stops:       make(map[string]stop.Func),
+		dones:       make(map[string]chan struct{}),
+		registerers: make(map[string]*jobRegisterer),
+		jobs:        make(map[string]job.Job),
+
+		dependencies: newDependencies(),
 	}
 }
 
@@ -150,6 +307,12 @@ func (s *jobs) wait() <-chan struct{} {
 type Status struct {
 	Jobs   map[string]*job.Status
 	Global GlobalStatus
+	// by job name, only for jobs with field `after`
+	After map[string]*AfterStatus `json:",omitempty"`
+	// nil unless the daemon is shutting down
+	Shutdown *ShutdownStatus `json:",omitempty"`
+	// nil unless field `global.self_check` is set
+	SelfCheck *SelfCheckStatus `json:",omitempty"`
 }
 
 type GlobalStatus struct {
@@ -183,15 +346,23 @@ func (s *jobs) status() map[string]*job.Status {
 	return ret
 }
 
-func (s *jobs) wakeup(job string) error {
+func (s *jobs) wakeup(jobName string, filesystems []string) error {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
-	wu, ok := s.wakeups[job]
+	wu, ok := s.wakeups[jobName]
 	if !ok {
-		return errors.Errorf("Job %s does not exist", job)
+		return errors.Errorf("Job %s does not exist", jobName)
 	}
-	return wu()
+	if len(filesystems) > 0 {
+		if _, ok := s.jobs[jobName].(*job.ActiveSide); !ok {
+			return errors.Errorf("Job %s does not replicate, cannot select filesystems", jobName)
+		}
+		if err := driver.FilesystemSelection(filesystems).Validate(); err != nil {
+			return err
+		}
+	}
+	return wu(filesystems...)
 }
 
 func (s *jobs) reset(job string) error {
@@ -205,20 +376,138 @@ func (s *jobs) reset(job string) error {
 	return wu()
 }
 
+func (s *jobs) dryRun(jobName string) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	dr, ok := s.dryRuns[jobName]
+	if !ok {
+		return errors.Errorf("Job %s does not exist", jobName)
+	}
+	if _, ok := s.jobs[jobName].(*job.ActiveSide); !ok {
+		return errors.Errorf("Job %s does not replicate, cannot plan replication", jobName)
+	}
+	return dr()
+}
+
+type SnapshotRequest struct {
+	Name string
+	// if non-empty, only these filesystems are snapshotted (see driver.FilesystemSelection)
+	Filesystems []string
+}
+
+func (s *jobs) snapshot(ctx context.Context, jobName string, filesystems []string) error {
+	// not held while the job lists its filesystems to check the selection
+	s.m.RLock()
+	j, ok := s.jobs[jobName]
+	s.m.RUnlock()
+	if !ok {
+		return errors.Errorf("Job %s does not exist", jobName)
+	}
+	sj, ok := j.(interface {
+		SnapshotNow(ctx context.Context, selection func(fs string) bool) error
+	})
+	if !ok {
+		return errors.Errorf("Job %s does not snapshot", jobName)
+	}
+	var selection func(fs string) bool
+	if len(filesystems) > 0 {
+		if err := driver.FilesystemSelection(filesystems).Validate(); err != nil {
+			return err
+		}
+		selection = driver.FilesystemSelection(filesystems).Matches
+	}
+	ctx, endTask := trace.WithTask(ctx, "snapshot-request")
+	defer endTask()
+	if err := sj.SnapshotNow(ctx, selection); err != nil {
+		return errors.Wrapf(err, "Job %s", jobName)
+	}
+	return nil
+}
+
+type PruneDryRunRequest struct {
+	Name string
+}
+
+func (s *jobs) pruneDryRun(jobName string) error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	j, ok := s.jobs[jobName]
+	if !ok {
+		return errors.Errorf("Job %s does not exist", jobName)
+	}
+	pj, ok := j.(interface {
+		PruneDryRun() error
+	})
+	if !ok {
+		return errors.Errorf("Job %s does not prune", jobName)
+	}
+	if err := pj.PruneDryRun(); err != nil {
+		return errors.Wrapf(err, "Job %s", jobName)
+	}
+	return nil
+}
+
+type BandwidthLimitRequest struct {
+	Name string
+	Rate string // empty for querying the current rate without changing it
+}
+
+type BandwidthLimitResponse struct {
+	Rate int64 // bytes per second, 0 means no limit
+}
+
+func (s *jobs) bandwidthLimit(job string, rate string) (int64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	j, ok := s.jobs[job]
+	if !ok {
+		return 0, errors.Errorf("Job %s does not exist", job)
+	}
+	bwj, ok := j.(interface {
+		BandwidthLimiter() *bandwidthlimit.Limiter
+	})
+	if !ok {
+		return 0, errors.Errorf("Job %s does not support bandwidth limiting", job)
+	}
+	l := bwj.BandwidthLimiter()
+	if rate != "" {
+		bytesPerSecond, err := bandwidthlimit.ParseRate(rate)
+		if err != nil {
+			return 0, err
+		}
+		l.SetRate(bytesPerSecond)
+	}
+	return l.Rate(), nil
+}
+
 const (
 	jobNamePrometheus = "_prometheus"
 	jobNameControl    = "_control"
+	jobNameSelfCheck  = "_self_check"
 )
 
 func IsInternalJobName(s string) bool {
 	return strings.HasPrefix(s, "_")
 }
 
-func (s *jobs) start(ctx context.Context, j job.Job, internal bool) {
+// start runs j in a new goroutine.
+// The returned channels are closed once j is ready (see package ready) and once j's Run returned, respectively.
+func (s *jobs) start(ctx context.Context, j job.Job, internal bool) (<-chan struct{}, <-chan struct{}) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	var outlets *logging.JobOutlets
+	if lj, ok := j.(job.LoggingJob); ok {
+		outlets = lj.Logging()
+	}
+	ctx = outlets.WithLoggers(ctx)
 	ctx = logging.WithInjectedField(ctx, logging.JobField, j.Name())
+	if wj, ok := j.(job.WeightedJob); ok {
+		ctx = scheduler.WithWeight(ctx, wj.Weight())
+	}
 
 	jobName := j.Name()
 	if !internal && IsInternalJobName(jobName) {
@@ -231,20 +520,123 @@ func (s *jobs) start(ctx context.Context, j job.Job, internal bool) {
 		panic(fmt.Sprintf("duplicate job name %s", jobName))
 	}
 
-	j.RegisterMetrics(prometheus.DefaultRegisterer)
+	registerer := &jobRegisterer{Registerer: prometheus.DefaultRegisterer}
+	j.RegisterMetrics(registerer)
+	s.registerers[jobName] = registerer
 
 	s.jobs[jobName] = j
 	ctx = zfscmd.WithJobID(ctx, j.Name())
 	ctx, wakeup := wakeup.Context(ctx)
 	ctx, resetFunc := reset.Context(ctx)
+	ctx, dryRunFunc := dryrun.Context(ctx)
+	ctx, stopFunc := stop.Context(ctx)
+	ctx, readyChan := ready.Context(ctx)
+	ctx, trigger := after.Context(ctx, func(err error) {
+		s.dependencies.invocationCompleted(jobName, err)
+	})
+	s.dependencies.add(j, trigger)
 	s.wakeups[jobName] = wakeup
 	s.resets[jobName] = resetFunc
+	s.dryRuns[jobName] = dryRunFunc
+	s.stops[jobName] = stopFunc
+	done := make(chan struct{})
+	s.dones[jobName] = done
+
+	// the certificates of the job's tls transports are reloaded while it runs
+	unregisterCerts := func() {}
+	if cj, ok := j.(job.CertificatesJob); ok {
+		unregisterCerts = cj.Certificates().Register()
+	}
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
+		defer close(done)
+		defer unregisterCerts()
+		defer func() {
+			if err := outlets.Close(); err != nil {
+				job.GetLogger(ctx).WithError(err).Error("cannot close log outlets of job")
+			}
+		}()
 		job.GetLogger(ctx).Info("starting job")
 		defer job.GetLogger(ctx).Info("job exited")
 		j.Run(ctx)
 	}()
+	return readyChan, done
+}
+
+func (s *jobs) get(jobName string) (job.Job, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	j, ok := s.jobs[jobName]
+	return j, ok
+}
+
+// stop asks the job to exit gracefully (see package stop) and removes it once it exited,
+// so that a job of the same name can be started afterwards.
+// The returned channel is closed once the job was removed.
+func (s *jobs) stop(jobName string) (<-chan struct{}, error) {
+	s.m.RLock()
+	stopFunc, ok := s.stops[jobName]
+	done := s.dones[jobName]
+	s.m.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("Job %s does not exist", jobName)
+	}
+	stopFunc()
+
+	removed := make(chan struct{})
+	go func() {
+		defer close(removed)
+		<-done
+		s.m.Lock()
+		registerer := s.registerers[jobName]
+		delete(s.wakeups, jobName)
+		delete(s.resets, jobName)
+		delete(s.dryRuns, jobName)
+		delete(s.stops, jobName)
+		delete(s.dones, jobName)
+		delete(s.registerers, jobName)
+		delete(s.jobs, jobName)
+		s.dependencies.remove(jobName)
+		s.m.Unlock()
+		registerer.unregisterAll()
+	}()
+	return removed, nil
+}
+
+// jobRegisterer records the metrics that a job registers
+// so that they can be unregistered when the job is removed.
+type jobRegisterer struct {
+	prometheus.Registerer
+
+	mtx        sync.Mutex
+	collectors []prometheus.Collector
+}
+
+func (r *jobRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+func (r *jobRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *jobRegisterer) unregisterAll() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, c := range r.collectors {
+		r.Registerer.Unregister(c)
+	}
+	r.collectors = nil
 }
@@ -143,6 +143,16 @@ func (m DatasetMapFilter) Map(source *zfs.DatasetPath) (target *zfs.DatasetPath,
 	return
 }
 
+// Lookup returns the mapping of the most specific entry for source as is,
+// for mappings whose values are not dataset paths.
+func (m DatasetMapFilter) Lookup(source *zfs.DatasetPath) (mapping string, found bool) {
+	mi, found := m.mostSpecificPrefixMapping(source)
+	if !found {
+		return "", false
+	}
+	return m.entries[mi].mapping, true
+}
+
 func (m DatasetMapFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
 
 	if !m.filterMode {
@@ -160,6 +170,31 @@ func (m DatasetMapFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
 	return
 }
 
+// FilterSubtree returns whether m passes root or any dataset below it.
+func (m DatasetMapFilter) FilterSubtree(root *zfs.DatasetPath) (pass bool, err error) {
+	if pass, err = m.Filter(root); err != nil || pass {
+		return pass, err
+	}
+	// datasets below root without an entry of their own are subject to the most specific subtree entry for root,
+	// which is not necessarily the one for root itself
+	lcp, lcpIdx := -1, -1
+	for i, e := range m.entries {
+		switch {
+		case e.path.Length() > root.Length() && e.path.HasPrefix(root):
+			// the most specific entry for e.path, or a more specific entry passes a dataset below e.path
+			if pass, err = m.parseDatasetFilterResult(e.mapping); err != nil || pass {
+				return pass, err
+			}
+		case e.subtreeMatch && root.HasPrefix(e.path) && e.path.Length() > lcp:
+			lcp, lcpIdx = e.path.Length(), i
+		}
+	}
+	if lcpIdx < 0 {
+		return false, nil
+	}
+	return m.parseDatasetFilterResult(m.entries[lcpIdx].mapping)
+}
+
 // Construct a new filter-only DatasetMapFilter from a mapping
 // The new filter allows exactly those paths that were not forbidden by the mapping.
 func (m DatasetMapFilter) InvertedFilter() (inv *DatasetMapFilter, err error) {
@@ -87,3 +87,69 @@ func TestDatasetMapFilter(t *testing.T) {
 	}
 
 }
+
+func TestDatasetMapFilterLookup(t *testing.T) {
+	m := NewDatasetMapFilter(3, false)
+	for p, mapping := range map[string]string{
+		"tank/vm<":      "/run/qga/default.sock",
+		"tank/vm/100<":  "/run/qga/100.sock",
+		"tank/vm/100/x": "/run/qga/x.sock",
+	} {
+		if err := m.Add(p, mapping); err != nil {
+			t.Fatalf("incorrect mapping spec: %s", err)
+		}
+	}
+	for p, exp := range map[string]string{
+		"tank":            "",
+		"tank/vm":         "/run/qga/default.sock",
+		"tank/vm/101":     "/run/qga/default.sock",
+		"tank/vm/100":     "/run/qga/100.sock",
+		"tank/vm/100/a":   "/run/qga/100.sock",
+		"tank/vm/100/x":   "/run/qga/x.sock",
+		"tank/vm/100/x/y": "/run/qga/100.sock",
+	} {
+		zp, err := zfs.NewDatasetPath(p)
+		if err != nil {
+			t.Fatalf("incorrect path spec: %s", err)
+		}
+		mapping, found := m.Lookup(zp)
+		if found != (exp != "") || mapping != exp {
+			t.Errorf("%q: exp=%q act=%q (found=%v)", p, exp, mapping, found)
+		}
+	}
+}
+
+func TestDatasetMapFilterFilterSubtree(t *testing.T) {
+	f, err := DatasetMapFilterFromConfig(map[string]bool{
+		"pool<":              true,
+		"pool/backup<":       false,
+		"pool/backup/zroot<": true,
+		"pool/excluded":      false,
+		"pool/subtree<":      false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for root, exp := range map[string]bool{
+		"pool/backup":      true,  // through pool/backup/zroot
+		"pool/backup/vm":   false, // pool/backup< excludes it
+		"pool/other":       true,  // through pool<
+		"pool/excluded":    true,  // only pool/excluded itself is excluded
+		"pool/excluded/a":  true,
+		"pool/subtree":     false,
+		"pool/subtree/b/c": false,
+		"other":            false,
+	} {
+		zp, err := zfs.NewDatasetPath(root)
+		if err != nil {
+			t.Fatalf("incorrect path spec: %s", err)
+		}
+		pass, err := f.FilterSubtree(zp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pass != exp {
+			t.Errorf("%q: exp=%v act=%v", root, exp, pass)
+		}
+	}
+}
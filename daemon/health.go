@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+const (
+	ControlHTTPEndpointHealthz = "/healthz"
+	ControlHTTPEndpointReadyz  = "/readyz"
+)
+
+// HealthResponse is the response of the health endpoints of the HTTP control API.
+type HealthResponse struct {
+	OK       bool
+	Problems []string `json:",omitempty"`
+}
+
+// health implements the health endpoints of the HTTP control API:
+// the liveness check fails if a restart of the daemon would help, the readiness check if the daemon
+// does not (yet, or no longer) do what it is configured to do.
+type health struct {
+	alive      *healthCheck
+	startup    *startup
+	jobs       *jobs
+	staleAfter map[string]time.Duration // by job name
+	startedAt  time.Time
+}
+
+// orchestrators time out probes after a few seconds, e.g., after one second by default for Kubernetes
+var healthCheckTimeout = envconst.Duration("ZREPL_DAEMON_HEALTH_CHECK_TIMEOUT", 400*time.Millisecond)
+
+// live returns the problems that make the daemon fail the liveness check:
+// the control socket does not respond or a job is deadlocked, like for the systemd watchdog.
+func (h *health) live() (problems []string) {
+	if err := h.alive.check(healthCheckTimeout); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// ready returns the problems that make the daemon fail the readiness check:
+// it did not start up yet, it is shutting down, a job exited, e.g., because it could not listen,
+// or a job in staleAfter did not complete an invocation successfully for too long.
+func (h *health) ready() (problems []string) {
+	if !h.startup.completed() {
+		problems = append(problems, "daemon is starting up")
+	}
+	if h.jobs.shuttingDown() {
+		problems = append(problems, "daemon is shutting down")
+	}
+
+	h.jobs.m.RLock()
+	var exited []string
+	for name, done := range h.jobs.dones {
+		if IsInternalJobName(name) {
+			continue
+		}
+		select {
+		case <-done:
+			exited = append(exited, name)
+		default:
+		}
+	}
+	h.jobs.m.RUnlock()
+	sort.Strings(exited)
+	for _, name := range exited {
+		problems = append(problems, fmt.Sprintf("job %q exited, e.g., because it could not listen", name))
+	}
+
+	names := make([]string, 0, len(h.staleAfter))
+	for name := range h.staleAfter {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		since := h.startedAt
+		if t, ok := h.jobs.dependencies.lastSuccess(name); ok {
+			since = t
+		}
+		if age := time.Since(since); age > h.staleAfter[name] {
+			problems = append(problems, fmt.Sprintf("job %q did not complete an invocation successfully for %s (stale_after %s)",
+				name, age.Truncate(time.Second), h.staleAfter[name]))
+		}
+	}
+	return problems
+}
+
+// handler serves check as JSON HealthResponse, with status 503 if there are problems.
+func (h *health) handler(check func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		problems := check()
+		res := HealthResponse{OK: len(problems) == 0, Problems: problems}
+		w.Header().Set("Content-Type", "application/json")
+		if !res.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(res) // the client went away, nothing to do
+	})
+}
@@ -1,6 +1,7 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/zrepl/zrepl/config"
@@ -17,11 +18,49 @@ func HookFromConfig(in config.HookEnum) (Hook, error) {
 		return PgChkptHookFromConfig(v)
 	case *config.HookMySQLLockTables:
 		return MyLockTablesFromConfig(v)
+	case *config.HookFSFreeze:
+		return FSFreezeFromConfig(v)
+	case *config.HookQEMUGuestAgent:
+		return QEMUGuestAgentFromConfig(v)
 	default:
 		return nil, fmt.Errorf("unknown hook type %T", v)
 	}
 }
 
+func hookSettingsCommonFromConfig(in config.HookEnum) *config.HookSettingsCommon {
+	switch v := in.Ret.(type) {
+	case *config.HookCommand:
+		return &v.HookSettingsCommon
+	case *config.HookPostgresCheckpoint:
+		return &v.HookSettingsCommon
+	case *config.HookMySQLLockTables:
+		return &v.HookSettingsCommon
+	case *config.HookFSFreeze:
+		return &v.HookSettingsCommon
+	case *config.HookQEMUGuestAgent:
+		return &v.HookSettingsCommon
+	default:
+		return &config.HookSettingsCommon{}
+	}
+}
+
+// listHook is a Hook of a List that has a `name` or whose List has `depends_on`.
+type listHook struct {
+	Hook
+	name string
+	// nil if no hook of the List has `depends_on`, i.e., the hooks run sequentially in configuration order.
+	// Otherwise, the names of all hooks that this hook depends on, directly or transitively,
+	// so that a Plan orders the hooks correctly even if CopyFilteredForFilesystem removes some of them.
+	dependsOn map[string]bool
+}
+
+func (h *listHook) String() string {
+	if h.name == "" {
+		return h.Hook.String()
+	}
+	return fmt.Sprintf("%s (%s)", h.name, h.Hook)
+}
+
 func ListFromConfig(in *config.HookList) (r *List, err error) {
 	hl := make(List, len(*in))
 
@@ -32,9 +71,143 @@ func ListFromConfig(in *config.HookList) (r *List, err error) {
 		}
 	}
 
+	settings := make([]*config.HookSettingsCommon, len(*in))
+	byName := make(map[string]int, len(*in))
+	parallel := false
+	for i, h := range *in {
+		settings[i] = hookSettingsCommonFromConfig(h)
+		if name := settings[i].Name; name != "" {
+			if _, ok := byName[name]; ok {
+				return nil, fmt.Errorf("hook #%d: duplicate `name` %q", i+1, name)
+			}
+			byName[name] = i
+		}
+		parallel = parallel || len(settings[i].DependsOn) > 0
+	}
+
+	// transitive dependencies, detecting cycles
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	visit := make([]int, len(settings))
+	dependsOn := make([]map[string]bool, len(settings))
+	var resolve func(i int) error
+	resolve = func(i int) error {
+		switch visit[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("hook #%d: `depends_on` forms a cycle", i+1)
+		}
+		visit[i] = visiting
+		dependsOn[i] = make(map[string]bool)
+		for _, dep := range settings[i].DependsOn {
+			j, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("hook #%d: `depends_on`: no hook with `name` %q", i+1, dep)
+			}
+			if err := resolve(j); err != nil {
+				return err
+			}
+			dependsOn[i][dep] = true
+			for transitive := range dependsOn[j] {
+				dependsOn[i][transitive] = true
+			}
+		}
+		visit[i] = visited
+		return nil
+	}
+
+	for i := range hl {
+		if !parallel && settings[i].Name == "" {
+			continue
+		}
+		lh := &listHook{Hook: hl[i], name: settings[i].Name}
+		if parallel {
+			if err := resolve(i); err != nil {
+				return nil, err
+			}
+			lh.dependsOn = dependsOn[i]
+		}
+		hl[i] = lh
+	}
+
 	return &hl, nil
 }
 
+func (l List) snapshotRunHooks() (hooks []SnapshotRunHook) {
+	for _, h := range l {
+		if lh, ok := h.(*listHook); ok {
+			h = lh.Hook
+		}
+		if rh, ok := h.(SnapshotRunHook); ok {
+			hooks = append(hooks, rh)
+		}
+	}
+	return hooks
+}
+
+// SnapshotRunOrder returns fss in the order in which they should be snapshotted:
+// the filesystems of a group of a SnapshotRunHook (e.g., the zvols of a VM) follow the first of them,
+// all others keep their position.
+// If the groups of several hooks overlap, those of the first hook take precedence.
+func (l List) SnapshotRunOrder(fss []*zfs.DatasetPath) []*zfs.DatasetPath {
+	hooks := l.snapshotRunHooks()
+	ordered := make([]*zfs.DatasetPath, 0, len(fss))
+	done := make([]bool, len(fss))
+	for i, fs := range fss {
+		if done[i] {
+			continue
+		}
+		ordered = append(ordered, fs)
+		done[i] = true
+		for _, rh := range hooks {
+			group, ok := rh.SnapshotRunGroup(fs)
+			if !ok {
+				continue
+			}
+			for j := i + 1; j < len(fss); j++ {
+				if g, ok := rh.SnapshotRunGroup(fss[j]); !done[j] && ok && g == group {
+					ordered = append(ordered, fss[j])
+					done[j] = true
+				}
+			}
+			break
+		}
+	}
+	return ordered
+}
+
+// SnapshotRun is a snapshotting run of the hooks of a List that implement SnapshotRunHook.
+type SnapshotRun struct {
+	hooks []SnapshotRunHook
+}
+
+// BeginSnapshotRun begins a snapshotting run of fss for the hooks of l that implement SnapshotRunHook.
+// The caller must call EndFilesystem for each of fss once its plan ran or was skipped,
+// and End once the plans of all filesystems ran or were skipped.
+func (l List) BeginSnapshotRun(fss []*zfs.DatasetPath) *SnapshotRun {
+	r := &SnapshotRun{hooks: l.snapshotRunHooks()}
+	for _, rh := range r.hooks {
+		rh.BeginSnapshotRun(fss)
+	}
+	return r
+}
+
+func (r *SnapshotRun) EndFilesystem(ctx context.Context, fs *zfs.DatasetPath) {
+	for _, rh := range r.hooks {
+		rh.EndSnapshotRunFilesystem(ctx, fs)
+	}
+}
+
+func (r *SnapshotRun) End(ctx context.Context) {
+	for _, rh := range r.hooks {
+		rh.EndSnapshotRun(ctx)
+	}
+}
+
 func (l List) CopyFilteredForFilesystem(fs *zfs.DatasetPath) (ret List, err error) {
 	ret = make(List, 0, len(l))
 
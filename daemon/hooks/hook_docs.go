@@ -7,10 +7,11 @@
 //
 // Use For Other Kinds Of ExpectStepReports
 //
-// This package REQUIRES REFACTORING before it can be used for other activities than snapshots, e.g. pre- and post-replication:
+// Besides snapshots (PhaseSnapshot), the package is used for hooks around replication steps (PhaseReplicationStep,
+// see package logic) and around a job's replication as a whole (PhaseReplication, see package job).
 //
 // The Hook interface requires a hook to provide a Filesystems() filter, which doesn't make sense for
-// all kinds of activities.
+// all kinds of activities: PhaseReplication plans ignore it and use a CallbackHook with a nil filter.
 //
 // The hook implementations should move out of this package.
 // However, there is a lot of tight coupling which to untangle isn't worth it ATM.
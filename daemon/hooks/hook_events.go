@@ -0,0 +1,258 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// An Event is a lifecycle event of a job that the commands in the job's field `event_hooks` are notified about.
+//
+// Unlike the hooks of a Plan, event hooks cannot influence the job:
+// they run in the background, one at a time per job and in the order of the events,
+// and their errors are only logged.
+type Event string
+
+const (
+	EventReplicationStarted    Event = "replication_started"
+	EventReplicationSucceeded  Event = "replication_succeeded"
+	EventReplicationFailed     Event = "replication_failed"
+	EventPruningCompleted      Event = "pruning_completed"
+	EventSnapshottingCompleted Event = "snapshotting_completed"
+	EventSelfCheckCompleted    Event = "self_check_completed"
+)
+
+const (
+	EnvEvent HookEnvVar = "ZREPL_EVENT"
+)
+
+// EventInfo is passed as JSON on stdin to the commands of the event hooks.
+type EventInfo struct {
+	Event Event     `json:"event"`
+	Job   string    `json:"job"`
+	Time  time.Time `json:"time"`
+	// the target of a push job with field `targets`, see WithEventTarget
+	Target string `json:"target,omitempty"`
+	// the errors that occurred, e.g., why the replication failed
+	Error string `json:"error,omitempty"`
+	// *ReplicationEventDetails, *PruningEventDetails, *SnapshottingEventDetails, *SelfCheckEventDetails, or nil
+	Details interface{} `json:"details,omitempty"`
+}
+
+// for EventReplicationSucceeded and EventReplicationFailed
+type ReplicationEventDetails struct {
+	BytesReplicated int64 `json:"bytes_replicated"`
+	// -1 if the replication failed before the filesystems were planned
+	FailedFilesystems int `json:"failed_filesystems"`
+}
+
+type PruningEventDetails struct {
+	// "sender", "receiver" or "local"
+	Side               string `json:"side"`
+	DestroyedSnapshots int    `json:"destroyed_snapshots"`
+	FailedFilesystems  int    `json:"failed_filesystems"`
+}
+
+type SnapshottingEventDetails struct {
+	Snapshots          int `json:"snapshots"`
+	SkippedFilesystems int `json:"skipped_filesystems"`
+	FailedFilesystems  int `json:"failed_filesystems"`
+}
+
+type SelfCheckEventDetails struct {
+	Violations []SelfCheckViolation `json:"violations"`
+	// the checks that could not be completed
+	Errors []string `json:"errors,omitempty"`
+}
+
+type SelfCheckViolation struct {
+	Invariant   string `json:"invariant"`
+	Job         string `json:"job,omitempty"`
+	Filesystem  string `json:"filesystem"`
+	Description string `json:"description"`
+}
+
+// maximum number of events that wait for the commands of a job, further events are dropped
+var maxQueuedEvents = envconst.Int("ZREPL_EVENT_HOOKS_MAX_QUEUED", 64)
+
+// EventHooks are the event hooks of a job. A nil *EventHooks has no hooks.
+type EventHooks struct {
+	job   string
+	hooks []*eventHook
+
+	mtx     sync.Mutex
+	queue   []EventInfo
+	running bool
+}
+
+type eventHook struct {
+	events  map[Event]bool
+	command string
+	timeout time.Duration
+}
+
+// EventHooksFromConfig returns nil if in is empty.
+// supported are the events that the job emits.
+func EventHooksFromConfig(job string, in []config.EventHook, supported ...Event) (*EventHooks, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	isSupported := make(map[Event]bool, len(supported))
+	for _, e := range supported {
+		isSupported[e] = true
+	}
+	h := &EventHooks{job: job}
+	for i, c := range in {
+		if len(c.Events) == 0 {
+			return nil, fmt.Errorf("event hook #%d: no events", i+1)
+		}
+		eh := &eventHook{
+			events:  make(map[Event]bool, len(c.Events)),
+			command: c.Path,
+			timeout: c.Timeout,
+		}
+		for _, e := range c.Events {
+			if !isSupported[Event(e)] {
+				return nil, fmt.Errorf("event hook #%d: this job does not emit event %q, supported events are %v", i+1, e, supported)
+			}
+			eh.events[Event(e)] = true
+		}
+		h.hooks = append(h.hooks, eh)
+	}
+	return h, nil
+}
+
+type contextKey int
+
+const (
+	contextKeyEventHooks contextKey = 1 + iota
+	contextKeyEventTarget
+)
+
+// WithEventHooks makes NotifyEvent notify h for the operations that run with ctx.
+func WithEventHooks(ctx context.Context, h *EventHooks) context.Context {
+	return context.WithValue(ctx, contextKeyEventHooks, h)
+}
+
+// WithEventTarget sets EventInfo.Target for the events of the operations that run with ctx.
+func WithEventTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, contextKeyEventTarget, target)
+}
+
+// NotifyEvent queues event for the event hooks of ctx (see WithEventHooks) and returns immediately.
+// err is the error of the operation, if any, details is one of the types in EventInfo.Details.
+func NotifyEvent(ctx context.Context, event Event, err error, details interface{}) {
+	h, _ := ctx.Value(contextKeyEventHooks).(*EventHooks)
+	if h == nil {
+		return
+	}
+	info := EventInfo{
+		Event:   event,
+		Job:     h.job,
+		Time:    time.Now(),
+		Details: details,
+	}
+	info.Target, _ = ctx.Value(contextKeyEventTarget).(string)
+	if err != nil {
+		info.Error = err.Error()
+	}
+	h.notify(ctx, info)
+}
+
+func (h *EventHooks) notify(ctx context.Context, info EventInfo) {
+	matches := false
+	for _, eh := range h.hooks {
+		matches = matches || eh.events[info.Event]
+	}
+	if !matches {
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if len(h.queue) >= maxQueuedEvents {
+		getLogger(ctx).WithField("event", info.Event).Warn("too many events wait for the event hooks, dropping event")
+		return
+	}
+	h.queue = append(h.queue, info)
+	if h.running {
+		return
+	}
+	h.running = true
+	// ctx is that of the operation that emitted the event, which may end before the hooks run
+	runCtx := logging.WithInherit(context.Background(), ctx)
+	runCtx = trace.WithInherit(runCtx, ctx)
+	go func() {
+		runCtx, endTask := trace.WithTask(runCtx, "event-hooks")
+		defer endTask()
+		h.drain(runCtx)
+	}()
+}
+
+func (h *EventHooks) drain(ctx context.Context) {
+	for {
+		h.mtx.Lock()
+		if len(h.queue) == 0 {
+			h.running = false
+			h.mtx.Unlock()
+			return
+		}
+		info := h.queue[0]
+		h.queue = h.queue[1:]
+		h.mtx.Unlock()
+
+		for _, eh := range h.hooks {
+			if !eh.events[info.Event] {
+				continue
+			}
+			l := getLogger(ctx).WithField("command", eh.command).WithField("event", info.Event)
+			if err := eh.run(ctx, l, info); err != nil {
+				l.WithError(err).Error("event hook failed")
+			} else {
+				l.Debug("event hook succeeded")
+			}
+		}
+	}
+}
+
+func (eh *eventHook) run(ctx context.Context, l Logger, info EventInfo) error {
+	stdin, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, eh.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, eh.command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", EnvJob, info.Job),
+		fmt.Sprintf("%s=%s", EnvEvent, info.Event),
+		fmt.Sprintf("%s=%.f", EnvTimeout, eh.timeout.Seconds()),
+	)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var scanMutex sync.Mutex
+	logErrWriter := NewLogWriter(&scanMutex, l, logger.Warn, "stderr")
+	logOutWriter := NewLogWriter(&scanMutex, l, logger.Info, "stdout")
+	defer logErrWriter.Close()
+	defer logOutWriter.Close()
+	cmd.Stderr = logErrWriter
+	cmd.Stdout = logOutWriter
+
+	err = cmd.Run()
+	if err != nil && cmdCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s: %s", eh.timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+func TestEventHooksFromConfig(t *testing.T) {
+	h, err := hooks.EventHooksFromConfig("job", nil, hooks.EventPruningCompleted)
+	require.NoError(t, err)
+	assert.Nil(t, h)
+
+	_, err = hooks.EventHooksFromConfig("job", []config.EventHook{{Path: "/bin/true"}}, hooks.EventPruningCompleted)
+	assert.Error(t, err)
+
+	_, err = hooks.EventHooksFromConfig("job", []config.EventHook{
+		{Events: []string{"replication_started"}, Path: "/bin/true"},
+	}, hooks.EventPruningCompleted, hooks.EventSnapshottingCompleted)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "replication_started")
+}
+
+func TestNotifyEvent(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	dir, err := ioutil.TempDir("", "zrepl-event-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	require.NoError(t, os.Setenv("ZREPL_TEST_EVENT_OUT", out))
+	defer os.Unsetenv("ZREPL_TEST_EVENT_OUT")
+	script, err := filepath.Abs("test/test-event.sh")
+	require.NoError(t, err)
+
+	h, err := hooks.EventHooksFromConfig("myjob", []config.EventHook{
+		{Events: []string{"replication_failed"}, Path: script, Timeout: 10 * time.Second},
+		{Events: []string{"replication_started", "replication_failed"}, Path: script, Timeout: 10 * time.Second},
+	}, hooks.EventReplicationStarted, hooks.EventReplicationSucceeded, hooks.EventReplicationFailed)
+	require.NoError(t, err)
+
+	// no hooks in ctx
+	hooks.NotifyEvent(ctx, hooks.EventReplicationStarted, nil, nil)
+
+	ctx = hooks.WithEventHooks(ctx, h)
+	ctx = hooks.WithEventTarget(ctx, "mytarget")
+	hooks.NotifyEvent(ctx, hooks.EventReplicationStarted, nil, nil)
+	hooks.NotifyEvent(ctx, hooks.EventReplicationSucceeded, nil, nil) // no matching hook
+	hooks.NotifyEvent(ctx, hooks.EventReplicationFailed, errors.New("it failed"), &hooks.ReplicationEventDetails{
+		BytesReplicated:   23,
+		FailedFilesystems: 1,
+	})
+
+	// the hooks run in the background
+	var lines []string
+	deadline := time.Now().Add(10 * time.Second)
+	for len(lines) < 6 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		b, err := ioutil.ReadFile(out)
+		if err != nil && !os.IsNotExist(err) {
+			require.NoError(t, err)
+		}
+		lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+	require.Len(t, lines, 6)
+
+	assert.Equal(t, "myjob replication_started 10", lines[0])
+	var started hooks.EventInfo
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &started))
+	assert.Equal(t, hooks.EventReplicationStarted, started.Event)
+	assert.Equal(t, "myjob", started.Job)
+	assert.Equal(t, "mytarget", started.Target)
+	assert.Empty(t, started.Error)
+	assert.Nil(t, started.Details)
+
+	for _, i := range []int{2, 4} {
+		assert.Equal(t, "myjob replication_failed 10", lines[i])
+		var failed struct {
+			hooks.EventInfo
+			Details hooks.ReplicationEventDetails `json:"details"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(lines[i+1]), &failed))
+		assert.Equal(t, hooks.EventReplicationFailed, failed.Event)
+		assert.Equal(t, "it failed", failed.Error)
+		assert.Equal(t, hooks.ReplicationEventDetails{BytesReplicated: 23, FailedFilesystems: 1}, failed.Details)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zrepl/zrepl/daemon/logging/trace"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -18,7 +19,7 @@ type Filter zfs.DatasetFilter
 type Hook interface {
 	Filesystems() Filter
 
-	// If true and the Pre edge invocation of Run fails, Post edge will not run and other Pre edges will not run.
+	// If true and the Pre edge invocation of Run fails, Post edge will not run and Pre edges that have not started will not run.
 	ErrIsFatal() bool
 
 	// Run is invoked by HookPlan for a Pre edge.
@@ -28,11 +29,27 @@ type Hook interface {
 	String() string
 }
 
+// A Hook that implements SnapshotRunHook spans the filesystems of a snapshotting run,
+// e.g., because it freezes a VM with several zvols once for all of them, see List.BeginSnapshotRun.
+type SnapshotRunHook interface {
+	// SnapshotRunGroup returns the group of fs, ok is false if fs is in no group.
+	// The filesystems of a group are snapshotted one after another, see List.SnapshotRunOrder.
+	SnapshotRunGroup(fs *zfs.DatasetPath) (group string, ok bool)
+	// BeginSnapshotRun is called with the filesystems to be snapshotted before the plan of any of them runs.
+	BeginSnapshotRun(fss []*zfs.DatasetPath)
+	// EndSnapshotRunFilesystem is called after the plan of fs ran or was skipped.
+	EndSnapshotRunFilesystem(ctx context.Context, fs *zfs.DatasetPath)
+	// EndSnapshotRun is called after the plans of all filesystems ran or were skipped.
+	EndSnapshotRun(ctx context.Context)
+}
+
 type Phase string
 
 const (
-	PhaseSnapshot = Phase("snapshot")
-	PhaseTesting  = Phase("testing")
+	PhaseSnapshot        = Phase("snapshot")
+	PhaseReplication     = Phase("replication")
+	PhaseReplicationStep = Phase("replication_step")
+	PhaseTesting         = Phase("testing")
 )
 
 func (p Phase) String() string {
@@ -102,6 +119,10 @@ type Plan struct {
 	cb    *Step
 	post  []*Step // not reversed, i.e. entry at index i corresponds to pre-edge in pre[i]
 
+	// deps[i] are the indices of the hooks whose pre-edges complete before pre[i] starts
+	// and whose post-edges start after post[i] completed, dependents is the inverse relation
+	deps, dependents [][]int
+
 	phase Phase
 	env   Env
 }
@@ -134,6 +155,24 @@ func NewPlan(hooks *List, phase Phase, cb *CallbackHook, extra Env) (*Plan, erro
 		Status: StepPending,
 	}
 
+	// without `depends_on`, each hook depends on its predecessor, see listHook
+	deps := make([][]int, len(*hooks))
+	dependents := make([][]int, len(*hooks))
+	for i, hook := range *hooks {
+		if lh, ok := hook.(*listHook); ok && lh.dependsOn != nil {
+			for j, other := range *hooks {
+				if olh, ok := other.(*listHook); ok && olh.name != "" && lh.dependsOn[olh.name] {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		} else if i > 0 {
+			deps[i] = []int{i - 1}
+		}
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
 	steps := make([]*Step, 0, len(pre)+len(post)+1)
 	steps = append(steps, pre...)
 	steps = append(steps, cbE)
@@ -148,6 +187,9 @@ func NewPlan(hooks *List, phase Phase, cb *CallbackHook, extra Env) (*Plan, erro
 		pre:   pre,
 		post:  post,
 		cb:    cbE,
+
+		deps:       deps,
+		dependents: dependents,
 	}
 
 	return plan, nil
@@ -191,12 +233,32 @@ func (r PlanReport) String() string {
 	return strings.Join(stepStrings, "\n")
 }
 
+// runInOrder runs f for each index of order concurrently,
+// but f(i) starts only after f(j) returned for all j in order[i].
+func runInOrder(ctx context.Context, order [][]int, f func(ctx context.Context, i int)) {
+	done := make([]chan struct{}, len(order))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for i := range order {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			for _, j := range order[i] {
+				<-done[j]
+			}
+			ctx, endTask := trace.WithTask(ctx, "hook")
+			defer endTask()
+			f(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+}
+
 func (p *Plan) Run(ctx context.Context, dryRun bool) {
-	p.mtx.RLock()
-	defer p.mtx.RUnlock()
 	w := func(f func()) {
-		p.mtx.RUnlock()
-		defer p.mtx.RLock()
 		p.mtx.Lock()
 		defer p.mtx.Unlock()
 		f()
@@ -219,63 +281,73 @@ func (p *Plan) Run(ctx context.Context, dryRun bool) {
 
 	l := getLogger(ctx)
 
-	// it's a stack, execute until we reach the end of the list (last item in)
-	// or fail inbetween
-	l.Info("run pre-edges in configuration order")
-	next := 0
-	for ; next < len(p.pre); next++ {
-		e := p.pre[next]
-		l := l.WithField("hook", e.Hook)
+	// Without `depends_on`, the pre-edges form a stack: they execute in configuration order
+	// until we reach the end of the list or a fatal error.
+	// With `depends_on`, pre-edges whose dependencies completed execute in parallel,
+	// and a fatal error prevents those that have not started yet.
+	l.Info("run pre-edges in dependency order")
+	hadFatalErr := false
+	runInOrder(ctx, p.deps, func(ctx context.Context, i int) {
+		e := p.pre[i]
+		l := getLogger(ctx).WithField("hook", e.Hook)
+		skip := false
+		w(func() {
+			if hadFatalErr {
+				skip = true
+				e.Status = StepSkippedDueToFatalErr
+				p.post[i].Status = StepSkippedDueToFatalErr
+			}
+		})
+		if skip {
+			return
+		}
 		r := runHook(e, ctx, Pre)
 		if r.HadError() {
 			l.WithError(r).Error("hook invocation failed for pre-edge")
 			if e.Hook.ErrIsFatal() {
 				l.Error("the hook run was aborted due to a fatal error in this hook")
-				break
+				w(func() {
+					hadFatalErr = true
+					p.post[i].Status = StepSkippedDueToFatalErr
+				})
 			}
 		}
-	}
+	})
 
-	hadFatalErr := next != len(p.pre)
 	if hadFatalErr {
-		l.Error("fatal error in a pre-snapshot hook invocation")
-		l.Error("no snapshot will be taken")
+		l.Error(fmt.Sprintf("fatal error in a pre-%s hook invocation", p.phase))
+		l.Error(fmt.Sprintf("%s will not run", p.cb.Hook))
 		l.Error("only running post-edges for successful pre-edges")
 		w(func() {
-			p.post[next].Status = StepSkippedDueToFatalErr
-			for i := next + 1; i < len(p.pre); i++ {
-				p.pre[i].Status = StepSkippedDueToFatalErr
-				p.post[i].Status = StepSkippedDueToFatalErr
-			}
 			p.cb.Status = StepSkippedDueToFatalErr
 		})
-		return
-	}
-
-	l.Info("running callback")
-	cbR := runHook(p.cb, ctx, Callback)
-	if cbR.HadError() {
-		l.WithError(cbR).Error("callback failed")
+	} else {
+		l.Info("running callback")
+		cbR := runHook(p.cb, ctx, Callback)
+		if cbR.HadError() {
+			l.WithError(cbR).Error("callback failed")
+		}
 	}
 
-	l.Info("run post-edges for successful pre-edges in reverse configuration order")
-
-	// the constructor produces pre and post entries
-	// post is NOT reversed
-	next-- // now at index of last executed pre-edge
-	for ; next >= 0; next-- {
-		e := p.post[next]
-		l := l.WithField("hook", e.Hook)
+	l.Info("run post-edges for successful pre-edges in reverse dependency order")
+	runInOrder(ctx, p.dependents, func(ctx context.Context, i int) {
+		e := p.post[i]
+		l := getLogger(ctx).WithField("hook", e.Hook)
 
-		if p.pre[next].Status != StepOk {
-			if p.pre[next].Status != StepErr {
-				panic(fmt.Sprintf("expecting a pre-edge hook report to be either Ok or Err, got %s", p.pre[next].Status))
+		var preStatus, status StepStatus
+		w(func() { preStatus, status = p.pre[i].Status, e.Status })
+		if status != StepPending {
+			return // skipped due to fatal error
+		}
+		if preStatus != StepOk {
+			if preStatus != StepErr {
+				panic(fmt.Sprintf("expecting a pre-edge hook report to be either Ok or Err, got %s", preStatus))
 			}
 			l.Info("skip post-edge because pre-edge failed")
 			w(func() {
 				e.Status = StepSkippedDueToPreErr
 			})
-			continue
+			return
 		}
 
 		report := runHook(e, ctx, Post)
@@ -286,7 +358,5 @@ func (p *Plan) Run(ctx context.Context, dryRun bool) {
 		}
 
 		// ErrIsFatal is only relevant for Pre
-
-	}
-
+	})
 }
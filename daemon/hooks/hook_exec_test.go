@@ -0,0 +1,216 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+// orderHook records the order of its invocations in events.
+type orderHook struct {
+	name       string
+	fail       bool
+	errIsFatal bool
+	// if not nil, the pre-edge waits until the channel is closed
+	preWait <-chan struct{}
+	// if not nil, closed when the pre-edge starts
+	preStarted chan struct{}
+	events     *orderEvents
+}
+
+type orderEvents struct {
+	mtx    sync.Mutex
+	events []string
+}
+
+func (e *orderEvents) add(ev string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.events = append(e.events, ev)
+}
+
+func (e *orderEvents) index(ev string) int {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for i, x := range e.events {
+		if x == ev {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *orderHook) Filesystems() Filter { return nil }
+func (h *orderHook) ErrIsFatal() bool    { return h.errIsFatal }
+func (h *orderHook) String() string      { return h.name }
+
+func (h *orderHook) Run(ctx context.Context, edge Edge, phase Phase, dryRun bool, extra Env, state map[interface{}]interface{}) HookReport {
+	if edge == Pre {
+		if h.preStarted != nil {
+			close(h.preStarted)
+		}
+		if h.preWait != nil {
+			<-h.preWait
+		}
+	}
+	h.events.add(fmt.Sprintf("%s %s", edge, h.name))
+	var err error
+	if h.fail && edge == Pre {
+		err = errors.New("failed")
+	}
+	return &CallbackHookReport{Name: h.name, Err: err}
+}
+
+// orderPlan builds a plan of orderHooks from a hook list config with the given names and depends_on.
+func orderPlan(t *testing.T, hooks []*orderHook, dependsOn map[string][]string) (*Plan, *orderEvents) {
+	events := &orderEvents{}
+	var in config.HookList
+	for _, h := range hooks {
+		h.events = events
+		in = append(in, config.HookEnum{Ret: &config.HookCommand{
+			Path:               "/bin/true",
+			HookSettingsCommon: config.HookSettingsCommon{Type: "command", Name: h.name, DependsOn: dependsOn[h.name]},
+		}})
+	}
+	list, err := ListFromConfig(&in)
+	require.NoError(t, err)
+	for i, h := range hooks {
+		if lh, ok := (*list)[i].(*listHook); ok {
+			lh.Hook = h
+		} else {
+			(*list)[i] = h
+		}
+	}
+	cb := NewCallbackHook("callback", func(ctx context.Context) error {
+		events.add("callback")
+		return nil
+	}, nil)
+	plan, err := NewPlan(list, PhaseTesting, cb, Env{})
+	require.NoError(t, err)
+	return plan, events
+}
+
+func stepStatuses(plan *Plan) map[string]StepStatus {
+	res := make(map[string]StepStatus)
+	for _, s := range plan.Report() {
+		hook := s.Hook
+		if lh, ok := hook.(*listHook); ok {
+			hook = lh.Hook
+		}
+		res[fmt.Sprintf("%s %s", s.Edge, hook)] = s.Status
+	}
+	return res
+}
+
+func TestPlanDependsOn(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	t.Run("parallel", func(t *testing.T) {
+		// c has no dependencies and thus runs in parallel to a, which waits for c to start
+		cStarted := make(chan struct{})
+		hooks := []*orderHook{
+			{name: "a", preWait: cStarted},
+			{name: "b"},
+			{name: "c", preStarted: cStarted},
+		}
+		plan, events := orderPlan(t, hooks, map[string][]string{"b": {"a"}})
+		plan.Run(ctx, false)
+
+		assert.False(t, plan.Report().HadError())
+		assert.Len(t, events.events, 7)
+		assert.True(t, events.index("Pre a") < events.index("Pre b"))
+		assert.True(t, events.index("Pre b") < events.index("callback"))
+		assert.True(t, events.index("Pre c") < events.index("callback"))
+		assert.True(t, events.index("callback") < events.index("Post b"))
+		assert.True(t, events.index("Post b") < events.index("Post a"))
+	})
+
+	t.Run("fatal-error-runs-posts-of-successful-pres", func(t *testing.T) {
+		for _, parallel := range []bool{false, true} {
+			hooks := []*orderHook{
+				{name: "a"},
+				{name: "b", fail: true, errIsFatal: true},
+				{name: "c"},
+			}
+			dependsOn := map[string][]string{}
+			if parallel {
+				dependsOn = map[string][]string{"b": {"a"}, "c": {"b"}}
+			}
+			plan, events := orderPlan(t, hooks, dependsOn)
+			plan.Run(ctx, false)
+
+			assert.Equal(t, []string{"Pre a", "Pre b", "Post a"}, events.events, "parallel=%v", parallel)
+			assert.Equal(t, map[string]StepStatus{
+				"Pre a":             StepOk,
+				"Pre b":             StepErr,
+				"Pre c":             StepSkippedDueToFatalErr,
+				"Callback callback": StepSkippedDueToFatalErr,
+				"Post c":            StepSkippedDueToFatalErr,
+				"Post b":            StepSkippedDueToFatalErr,
+				"Post a":            StepOk,
+			}, stepStatuses(plan), "parallel=%v", parallel)
+			assert.True(t, plan.Report().HadFatalError())
+		}
+	})
+
+	t.Run("transitive-dependency-of-filtered-hook", func(t *testing.T) {
+		events := &orderEvents{}
+		a := &orderHook{name: "a", events: events}
+		c := &orderHook{name: "c", events: events}
+		// b, which c depends on and which depends on a, does not match the filesystem
+		list := List{
+			&listHook{Hook: a, name: "a", dependsOn: map[string]bool{}},
+			&listHook{Hook: c, name: "c", dependsOn: map[string]bool{"a": true, "b": true}},
+		}
+		plan, err := NewPlan(&list, PhaseTesting, NewCallbackHook("callback", func(ctx context.Context) error { return nil }, nil), Env{})
+		require.NoError(t, err)
+		plan.Run(ctx, false)
+		assert.Equal(t, []string{"Pre a", "Pre c", "Post c", "Post a"}, events.events)
+	})
+}
+
+func TestListFromConfigDependsOn(t *testing.T) {
+	hook := func(name string, dependsOn ...string) config.HookEnum {
+		return config.HookEnum{Ret: &config.HookCommand{
+			Path:               "/bin/true",
+			HookSettingsCommon: config.HookSettingsCommon{Type: "command", Name: name, DependsOn: dependsOn},
+		}}
+	}
+
+	list, err := ListFromConfig(&config.HookList{hook(""), hook("")})
+	require.NoError(t, err)
+	for _, h := range *list {
+		_, ok := h.(*listHook)
+		assert.False(t, ok, "hooks without name and depends_on are not wrapped")
+	}
+
+	list, err = ListFromConfig(&config.HookList{hook("a"), hook("b", "a"), hook("c", "b"), hook("")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, (*list)[2].(*listHook).dependsOn)
+	assert.Equal(t, map[string]bool{}, (*list)[3].(*listHook).dependsOn)
+	assert.Contains(t, (*list)[1].String(), "b (")
+
+	for _, c := range []struct {
+		in  config.HookList
+		err string
+	}{
+		{config.HookList{hook("a"), hook("a")}, "hook #2: duplicate `name` \"a\""},
+		{config.HookList{hook("a", "x")}, "hook #1: `depends_on`: no hook with `name` \"x\""},
+		{config.HookList{hook("a", "b"), hook("b", "a")}, "`depends_on` forms a cycle"},
+		{config.HookList{hook("a", "a")}, "`depends_on` forms a cycle"},
+	} {
+		_, err := ListFromConfig(&c.in)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
@@ -27,6 +27,14 @@ const (
 	EnvFS       HookEnvVar = "ZREPL_FS"
 	EnvSnapshot HookEnvVar = "ZREPL_SNAPNAME"
 	EnvTimeout  HookEnvVar = "ZREPL_TIMEOUT"
+
+	// replication hooks
+	EnvJob               HookEnvVar = "ZREPL_JOB"
+	EnvFrom              HookEnvVar = "ZREPL_FROM" // empty for full sends
+	EnvTo                HookEnvVar = "ZREPL_TO"
+	EnvBytesReplicated   HookEnvVar = "ZREPL_BYTES_REPLICATED"   // post edge only
+	EnvError             HookEnvVar = "ZREPL_ERROR"              // post edge only, empty if the step succeeded
+	EnvFailedFilesystems HookEnvVar = "ZREPL_FAILED_FILESYSTEMS" // post edge only
 )
 
 type Env map[HookEnvVar]string
@@ -0,0 +1,228 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// FSFreeze freezes the filesystem at a mountpoint from the pre-edge until the post-edge,
+// like fsfreeze(8), for applications that cannot be quiesced otherwise.
+// It is mostly useful for filesystems on zvols, e.g., ext4 or xfs.
+//
+// The filesystem is thawed after timeout if the post-edge does not run or fails,
+// e.g., because the snapshot hangs, so that the application does not block forever.
+type FSFreeze struct {
+	errIsFatal  bool
+	mountpoint  string // empty means the mountpoint of the snapshotted filesystem
+	timeout     time.Duration
+	filesystems Filter
+
+	// freeze and getMountpoint are replaced by tests
+	freeze        func(mountpoint string) (thaw func() error, err error)
+	getMountpoint func(ctx context.Context, fs *zfs.DatasetPath) (string, error)
+}
+
+type fsFreezeStateKey int
+
+const (
+	fsFreezeFrozen fsFreezeStateKey = 1 + iota
+)
+
+func FSFreezeFromConfig(in *config.HookFSFreeze) (*FSFreeze, error) {
+	filesystems, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	if err != nil {
+		return nil, errors.Wrap(err, "`filesystems` invalid")
+	}
+	if in.Mountpoint != "" && !strings.HasPrefix(in.Mountpoint, "/") {
+		return nil, fmt.Errorf("`mountpoint` must be an absolute path, got %q", in.Mountpoint)
+	}
+	return &FSFreeze{
+		errIsFatal:    in.ErrIsFatal,
+		mountpoint:    in.Mountpoint,
+		timeout:       in.Timeout,
+		filesystems:   filesystems,
+		freeze:        fsfreeze,
+		getMountpoint: zfsMountpoint,
+	}, nil
+}
+
+func (h *FSFreeze) ErrIsFatal() bool    { return h.errIsFatal }
+func (h *FSFreeze) Filesystems() Filter { return h.filesystems }
+func (h *FSFreeze) String() string {
+	if h.mountpoint != "" {
+		return fmt.Sprintf("fsfreeze %s", h.mountpoint)
+	}
+	return "fsfreeze"
+}
+
+type FSFreezeReport struct {
+	What       string
+	Mountpoint string
+	Err        error
+}
+
+func (r *FSFreezeReport) HadError() bool { return r.Err != nil }
+func (r *FSFreezeReport) Error() string  { return r.String() }
+func (r *FSFreezeReport) String() string {
+	var s strings.Builder
+	s.WriteString(r.What)
+	if r.Mountpoint != "" {
+		fmt.Fprintf(&s, " %s", r.Mountpoint)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&s, ": %s", r.Err)
+	}
+	return s.String()
+}
+
+func (h *FSFreeze) Run(ctx context.Context, edge Edge, phase Phase, dryRun bool, extra Env, state map[interface{}]interface{}) HookReport {
+	fs, ok := extra[EnvFS]
+	if !ok {
+		panic(extra)
+	}
+	dp, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		panic(err)
+	}
+	if pass, err := h.filesystems.Filter(dp); err != nil {
+		return &FSFreezeReport{What: "filesystem filter", Err: err}
+	} else if !pass {
+		getLogger(ctx).Debug("filesystem does not match filter, skipping")
+		return &FSFreezeReport{What: "filesystem filter skipped this filesystem"}
+	}
+
+	switch edge {
+	case Pre:
+		mountpoint, err := h.doRunPre(ctx, dp, dryRun, state)
+		return &FSFreezeReport{"freeze", mountpoint, err}
+	case Post:
+		mountpoint, err := h.doRunPost(ctx, dryRun, state)
+		return &FSFreezeReport{"thaw", mountpoint, err}
+	}
+	return &FSFreezeReport{What: "skipped this edge"}
+}
+
+// fsFreezeFrozenState is the frozen filesystem between the pre- and post-edge.
+type fsFreezeFrozenState struct {
+	target string // the mountpoint, or what else was frozen
+	// calls thaw after the timeout, stopped by the post-edge
+	watchdog *time.Timer
+	thawOnce sync.Once
+	thawFunc func() error
+	thawErr  error
+}
+
+func (s *fsFreezeFrozenState) thaw() error {
+	s.thawOnce.Do(func() {
+		s.thawErr = s.thawFunc()
+	})
+	return s.thawErr
+}
+
+func (h *FSFreeze) doRunPre(ctx context.Context, fs *zfs.DatasetPath, dry bool, state map[interface{}]interface{}) (mountpoint string, err error) {
+	mountpoint = h.mountpoint
+	if mountpoint == "" {
+		if mountpoint, err = h.getMountpoint(ctx, fs); err != nil {
+			return "", err
+		}
+	}
+	if dry {
+		getLogger(ctx).Debug("dry-run - do not freeze")
+		return mountpoint, nil
+	}
+
+	l := getLogger(ctx).WithField("mountpoint", mountpoint)
+	l.Debug("freeze filesystem")
+	frozen, err := freezeWithTimeout(l, h.timeout, mountpoint, func() (func() error, error) {
+		return h.freeze(mountpoint)
+	})
+	if err != nil {
+		return mountpoint, err
+	}
+	state[fsFreezeFrozen] = frozen
+	return mountpoint, nil
+}
+
+// freezeWithTimeout calls freeze, which may take long, e.g., because it syncs the filesystem first,
+// and returns an error if it does not return within timeout. A freeze that completes after the timeout is thawed right away.
+// A successful freeze is thawed after timeout unless the post-edge stops the watchdog of the returned state first.
+func freezeWithTimeout(l Logger, timeout time.Duration, target string, freeze func() (thaw func() error, err error)) (*fsFreezeFrozenState, error) {
+	type result struct {
+		thaw func() error
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		thaw, err := freeze()
+		done <- result{thaw, err}
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		frozen := &fsFreezeFrozenState{target: target, thawFunc: r.thaw}
+		frozen.watchdog = time.AfterFunc(timeout, func() {
+			l.WithField("timeout", timeout).Warn("filesystem frozen for longer than timeout, thawing")
+			if err := frozen.thaw(); err != nil {
+				l.WithError(err).Error("cannot thaw filesystem")
+			}
+		})
+		return frozen, nil
+	case <-t.C:
+		go func() {
+			if r := <-done; r.err == nil {
+				l.Warn("freeze completed after timeout, thawing")
+				if err := r.thaw(); err != nil {
+					l.WithError(err).Error("cannot thaw filesystem")
+				}
+			}
+		}()
+		return nil, fmt.Errorf("freeze timed out after %s", timeout)
+	}
+}
+
+func (h *FSFreeze) doRunPost(ctx context.Context, dry bool, state map[interface{}]interface{}) (mountpoint string, err error) {
+	if dry {
+		return h.mountpoint, nil
+	}
+	frozen, ok := state[fsFreezeFrozen].(*fsFreezeFrozenState)
+	if !ok {
+		return h.mountpoint, errors.New("implementation error: post-edge without frozen filesystem")
+	}
+	getLogger(ctx).WithField("mountpoint", frozen.target).Debug("thaw filesystem")
+	return frozen.target, thawFrozen(frozen, h.timeout)
+}
+
+// thawFrozen thaws frozen unless its watchdog has done so already,
+// in which case the snapshot was taken after the thaw.
+func thawFrozen(frozen *fsFreezeFrozenState, timeout time.Duration) error {
+	if !frozen.watchdog.Stop() {
+		return fmt.Errorf("filesystem was thawed after timeout %s, snapshot may be inconsistent", timeout)
+	}
+	return frozen.thaw()
+}
+
+// zfsMountpoint returns the mountpoint of fs if it is a mounted filesystem.
+func zfsMountpoint(ctx context.Context, fs *zfs.DatasetPath) (string, error) {
+	props, err := zfs.ZFSGet(ctx, fs, []string{"mountpoint", "mounted"})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get mountpoint")
+	}
+	mountpoint := props.Get("mountpoint")
+	if !strings.HasPrefix(mountpoint, "/") || props.Get("mounted") != "yes" {
+		return "", fmt.Errorf("%s is not mounted at a path (mountpoint=%q), set `mountpoint` for filesystems on zvols", fs.ToString(), mountpoint)
+	}
+	return mountpoint, nil
+}
@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// see linux/fs.h
+const (
+	ioctlFIFREEZE = 0xc0045877 // _IOWR('X', 119, int)
+	ioctlFITHAW   = 0xc0045878 // _IOWR('X', 120, int)
+)
+
+// fsfreeze freezes the filesystem mounted at mountpoint, like fsfreeze(8).
+func fsfreeze(mountpoint string) (thaw func() error, err error) {
+	f, err := os.Open(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.IoctlSetInt(int(f.Fd()), ioctlFIFREEZE, 0); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "FIFREEZE %s", mountpoint)
+	}
+	return func() error {
+		defer f.Close()
+		if err := unix.IoctlSetInt(int(f.Fd()), ioctlFITHAW, 0); err != nil {
+			return errors.Wrapf(err, "FITHAW %s", mountpoint)
+		}
+		return nil
+	}, nil
+}
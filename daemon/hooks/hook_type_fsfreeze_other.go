@@ -0,0 +1,11 @@
+// +build !linux
+
+package hooks
+
+import (
+	"errors"
+)
+
+func fsfreeze(mountpoint string) (thaw func() error, err error) {
+	return nil, errors.New("fsfreeze is only supported on Linux")
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// fakeFreezer records the freezes and thaws of its mountpoints.
+type fakeFreezer struct {
+	mtx    sync.Mutex
+	events []string
+	// if not nil, freeze waits until the channel is closed
+	freezeWait <-chan struct{}
+}
+
+func (f *fakeFreezer) add(ev string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.events = append(f.events, ev)
+}
+
+func (f *fakeFreezer) state() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]string(nil), f.events...)
+}
+
+func (f *fakeFreezer) freeze(mountpoint string) (func() error, error) {
+	if f.freezeWait != nil {
+		<-f.freezeWait
+	}
+	f.add("freeze " + mountpoint)
+	return func() error {
+		f.add("thaw " + mountpoint)
+		return nil
+	}, nil
+}
+
+func TestFSFreeze(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	env := Env{EnvFS: "pool/vm"}
+	newHook := func(timeout time.Duration) (*FSFreeze, *fakeFreezer) {
+		f := &fakeFreezer{}
+		return &FSFreeze{
+			timeout:     timeout,
+			filesystems: allFilesystems{},
+			freeze:      f.freeze,
+			getMountpoint: func(ctx context.Context, fs *zfs.DatasetPath) (string, error) {
+				return "/" + fs.ToString(), nil
+			},
+		}, f
+	}
+
+	t.Run("freeze-thaw", func(t *testing.T) {
+		h, f := newHook(time.Minute)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		assert.Equal(t, []string{"freeze /pool/vm"}, f.state())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, state).HadError())
+		assert.Equal(t, []string{"freeze /pool/vm", "thaw /pool/vm"}, f.state())
+	})
+
+	t.Run("explicit-mountpoint", func(t *testing.T) {
+		h, f := newHook(time.Minute)
+		h.mountpoint = "/mnt/vm"
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, state).HadError())
+		assert.Equal(t, []string{"freeze /mnt/vm", "thaw /mnt/vm"}, f.state())
+	})
+
+	t.Run("watchdog-thaws", func(t *testing.T) {
+		h, f := newHook(20 * time.Millisecond)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		assert.Eventually(t, func() bool { return len(f.state()) == 2 }, 10*time.Second, 10*time.Millisecond)
+		r := h.Run(ctx, Post, PhaseSnapshot, false, env, state)
+		if assert.True(t, r.HadError()) {
+			assert.Contains(t, r.Error(), "thawed after timeout")
+		}
+		assert.Equal(t, []string{"freeze /pool/vm", "thaw /pool/vm"}, f.state())
+	})
+
+	t.Run("freeze-timeout", func(t *testing.T) {
+		h, f := newHook(20 * time.Millisecond)
+		freezeWait := make(chan struct{})
+		f.freezeWait = freezeWait
+		state := make(map[interface{}]interface{})
+		r := h.Run(ctx, Pre, PhaseSnapshot, false, env, state)
+		if assert.True(t, r.HadError()) {
+			assert.Contains(t, r.Error(), "timed out")
+		}
+		// a freeze that completes after the timeout is thawed right away
+		close(freezeWait)
+		assert.Eventually(t, func() bool { return len(f.state()) == 2 }, 10*time.Second, 10*time.Millisecond)
+		assert.Equal(t, []string{"freeze /pool/vm", "thaw /pool/vm"}, f.state())
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		h, f := newHook(time.Minute)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, true, env, state).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, true, env, state).HadError())
+		assert.Empty(t, f.state())
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	sqldriver "database/sql/driver"
 
@@ -30,16 +32,21 @@ import (
 //    	Unmount the snapshot.
 //
 //	Similar snapshot capabilities may be available in other file systems, such as LVM or ZFS.
+//
+// The lock is held by a single MySQL session, from the pre-edge until the post-edge.
+// If the post-edge does not run or fails, e.g., because the snapshot hangs,
+// the session is closed after timeout, which releases the lock.
 type MySQLLockTables struct {
 	errIsFatal  bool
 	connector   sqldriver.Connector
+	timeout     time.Duration
 	filesystems Filter
 }
 
 type myLockTablesStateKey int
 
 const (
-	myLockTablesConnection myLockTablesStateKey = 1 + iota
+	myLockTablesSession myLockTablesStateKey = 1 + iota
 )
 
 func MyLockTablesFromConfig(in *config.HookMySQLLockTables) (*MySQLLockTables, error) {
@@ -60,6 +67,7 @@ func MyLockTablesFromConfig(in *config.HookMySQLLockTables) (*MySQLLockTables, e
 	return &MySQLLockTables{
 		in.ErrIsFatal,
 		cn,
+		in.Timeout,
 		filesystems,
 	}, nil
 }
@@ -111,32 +119,88 @@ func (h *MySQLLockTables) Run(ctx context.Context, edge Edge, phase Phase, dryRu
 	return &MyLockTablesReport{What: "skipped this edge", Err: nil}
 }
 
+// myLockTablesSessionState is the MySQL session that holds the lock between the pre- and post-edge.
+type myLockTablesSessionState struct {
+	db   *sql.DB
+	conn *sql.Conn
+	// calls close after the timeout, stopped by the post-edge
+	watchdog  *time.Timer
+	closeOnce sync.Once
+}
+
+// close ends the session, which releases the lock if it is still held
+func (s *myLockTablesSessionState) close() {
+	s.closeOnce.Do(func() {
+		s.conn.Close()
+		s.db.Close()
+	})
+}
+
 func (h *MySQLLockTables) doRunPre(ctx context.Context, fs *zfs.DatasetPath, dry bool, state map[interface{}]interface{}) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
 	db := sql.OpenDB(h.connector)
+	if dry {
+		defer db.Close()
+		getLogger(ctx).Debug("dry-run - use ping instead of FLUSH TABLES WITH READ LOCK")
+		return db.PingContext(ctx)
+	}
+	// the lock belongs to the session, so make sure that sql.DB does not keep a released connection
+	db.SetMaxIdleConns(0)
 	defer func(err *error) {
 		if *err != nil {
 			db.Close()
 		}
 	}(&err)
 
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(err *error) {
+		if *err != nil {
+			conn.Close()
+		}
+	}(&err)
+
 	getLogger(ctx).Debug("do FLUSH TABLES WITH READ LOCK")
-	_, err = db.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	_, err = conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s: %s", h.timeout, err)
+		}
 		return
 	}
 
-	state[myLockTablesConnection] = db
+	session := &myLockTablesSessionState{db: db, conn: conn}
+	l := getLogger(ctx)
+	session.watchdog = time.AfterFunc(h.timeout, func() {
+		l.WithField("timeout", h.timeout).Warn("lock held for longer than timeout, closing session to release it")
+		session.close()
+	})
+	state[myLockTablesSession] = session
 
 	return nil
 }
 
 func (h *MySQLLockTables) doRunPost(ctx context.Context, fs *zfs.DatasetPath, dry bool, state map[interface{}]interface{}) error {
+	if dry {
+		return nil
+	}
+	session, ok := state[myLockTablesSession].(*myLockTablesSessionState)
+	if !ok {
+		return errors.New("implementation error: post-edge without lock session")
+	}
+	defer session.close()
+	if !session.watchdog.Stop() {
+		return fmt.Errorf("lock was released after timeout %s, snapshot may be inconsistent", h.timeout)
+	}
 
-	db := state[myLockTablesConnection].(*sql.DB)
-	defer db.Close()
-
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	getLogger(ctx).Debug("do UNLOCK TABLES")
-	_, err := db.ExecContext(ctx, "UNLOCK TABLES")
+	_, err := session.conn.ExecContext(ctx, "UNLOCK TABLES")
 	if err != nil {
 		return err
 	}
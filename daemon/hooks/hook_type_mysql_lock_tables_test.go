@@ -0,0 +1,125 @@
+package hooks
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// fakeMySQL records the statements of its connections and which connections were closed.
+type fakeMySQL struct {
+	mtx    sync.Mutex
+	nconns int
+	execs  []string // "conn N: STATEMENT"
+	closed map[int]bool
+}
+
+type fakeMySQLConn struct {
+	db *fakeMySQL
+	id int
+}
+
+func (f *fakeMySQL) Connect(ctx context.Context) (driver.Conn, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.nconns++
+	return &fakeMySQLConn{f, f.nconns}, nil
+}
+
+func (f *fakeMySQL) Driver() driver.Driver { panic("not implemented") }
+
+func (c *fakeMySQLConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mtx.Lock()
+	defer c.db.mtx.Unlock()
+	if c.db.closed[c.id] {
+		return nil, driver.ErrBadConn
+	}
+	c.db.execs = append(c.db.execs, fmt.Sprintf("%d: %s", c.id, query))
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeMySQLConn) Close() error {
+	c.db.mtx.Lock()
+	defer c.db.mtx.Unlock()
+	c.db.closed[c.id] = true
+	return nil
+}
+
+func (c *fakeMySQLConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeMySQLConn) Begin() (driver.Tx, error) { return nil, errors.New("not implemented") }
+
+func (f *fakeMySQL) state() ([]string, map[int]bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	closed := make(map[int]bool, len(f.closed))
+	for id, c := range f.closed {
+		closed[id] = c
+	}
+	return append([]string(nil), f.execs...), closed
+}
+
+func TestMySQLLockTablesSession(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	env := Env{EnvFS: "pool/mysql"}
+	newHook := func(timeout time.Duration) (*MySQLLockTables, *fakeMySQL) {
+		db := &fakeMySQL{closed: make(map[int]bool)}
+		return &MySQLLockTables{connector: db, timeout: timeout, filesystems: allFilesystems{}}, db
+	}
+
+	t.Run("unlock-same-session", func(t *testing.T) {
+		h, db := newHook(time.Minute)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		execs, closed := db.state()
+		assert.Equal(t, []string{"1: FLUSH TABLES WITH READ LOCK"}, execs)
+		assert.Empty(t, closed)
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, state).HadError())
+		execs, closed = db.state()
+		assert.Equal(t, []string{"1: FLUSH TABLES WITH READ LOCK", "1: UNLOCK TABLES"}, execs)
+		assert.Equal(t, map[int]bool{1: true}, closed)
+	})
+
+	t.Run("watchdog-releases-lock", func(t *testing.T) {
+		h, db := newHook(20 * time.Millisecond)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		time.Sleep(100 * time.Millisecond)
+		_, closed := db.state()
+		assert.Equal(t, map[int]bool{1: true}, closed)
+		r := h.Run(ctx, Post, PhaseSnapshot, false, env, state)
+		if assert.True(t, r.HadError()) {
+			assert.Contains(t, r.Error(), "released after timeout")
+		}
+		execs, _ := db.state()
+		assert.Equal(t, []string{"1: FLUSH TABLES WITH READ LOCK"}, execs)
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		h, db := newHook(time.Minute)
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, true, env, state).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, true, env, state).HadError())
+		execs, closed := db.state()
+		assert.Empty(t, execs)
+		assert.Equal(t, map[int]bool{1: true}, closed)
+	})
+}
+
+type allFilesystems struct{}
+
+func (allFilesystems) Filter(p *zfs.DatasetPath) (bool, error) { return true, nil }
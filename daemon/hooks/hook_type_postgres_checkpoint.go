@@ -18,6 +18,7 @@ import (
 type PgChkptHook struct {
 	errIsFatal  bool
 	connector   *pq.Connector
+	timeout     time.Duration
 	filesystems Filter
 }
 
@@ -34,6 +35,7 @@ func PgChkptHookFromConfig(in *config.HookPostgresCheckpoint) (*PgChkptHook, err
 	return &PgChkptHook{
 		in.ErrIsFatal,
 		cn,
+		in.Timeout,
 		filesystems,
 	}, nil
 }
@@ -77,22 +79,33 @@ func (h *PgChkptHook) doRunPre(ctx context.Context, fs *zfs.DatasetPath, dry boo
 		return err
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
 	db := sql.OpenDB(h.connector)
 	defer db.Close()
-	dl, ok := ctx.Deadline()
-	if ok {
-		timeout := uint64(math.Floor(time.Until(dl).Seconds() * 1000)) // TODO go1.13 milliseconds
-		getLogger(ctx).WithField("statement_timeout", timeout).Debug("setting statement timeout for CHECKPOINT")
-		_, err := db.ExecContext(ctx, "SET statement_timeout TO ?", timeout)
-		if err != nil {
-			return err
-		}
-	}
 	if dry {
 		getLogger(ctx).Debug("dry-run - use ping instead of CHECKPOINT")
 		return db.PingContext(ctx)
 	}
+
+	// statement_timeout is a setting of the session, so SET and CHECKPOINT must use the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	dl, _ := ctx.Deadline()
+	timeout := uint64(math.Floor(time.Until(dl).Seconds() * 1000)) // TODO go1.13 milliseconds
+	getLogger(ctx).WithField("statement_timeout", timeout).Debug("setting statement timeout for CHECKPOINT")
+	// SET does not support parameters, timeout is an integer
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET statement_timeout TO %d", timeout)); err != nil {
+		return err
+	}
 	getLogger(ctx).Info("execute CHECKPOINT command")
-	_, err := db.ExecContext(ctx, "CHECKPOINT")
+	_, err = conn.ExecContext(ctx, "CHECKPOINT")
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s: %s", h.timeout, err)
+	}
 	return err
 }
@@ -0,0 +1,374 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// QEMUGuestAgent freezes the filesystems of a VM from the pre-edge until the post-edge
+// using the guest-fsfreeze-freeze and guest-fsfreeze-thaw commands of the QEMU guest agent in the VM,
+// so that the snapshots of the zvols that back the VM are application-consistent.
+//
+// Within a snapshotting run (see SnapshotRunHook), a guest is frozen once for all of its zvols:
+// from the pre-edge of its first zvol until the post-edge of its last, so that the snapshots of
+// the zvols are consistent with each other. The zvols of a guest form a group of the run and are
+// thus snapshotted one after another. If the remaining zvols of a guest are skipped, e.g., because
+// of the fatal error of another hook, the guest is thawed right away.
+// Outside of a run, each zvol is frozen separately.
+//
+// Like FSFreeze, the guest is thawed after timeout if the post-edge does not run or fails.
+type QEMUGuestAgent struct {
+	errIsFatal bool
+	// maps the zvols to the guest agent socket of their VM
+	sockets     *filters.DatasetMapFilter
+	timeout     time.Duration
+	filesystems Filter
+
+	mtx sync.Mutex
+	// per socket, nil if there is no snapshotting run
+	guests map[string]*qemuGuestAgentGuest
+
+	// replaced by tests
+	execute func(socket string, timeout time.Duration, command string, ret interface{}) error
+}
+
+// qemuGuestAgentGuest is the state of a guest in a snapshotting run.
+type qemuGuestAgentGuest struct {
+	// the zvols of the guest in the run whose plan has not ended yet
+	pending int
+	// nil if not frozen
+	frozen   *fsFreezeFrozenState
+	frozenAt time.Time
+}
+
+type qemuGuestAgentStateKey int
+
+const (
+	qemuGuestAgentFrozen qemuGuestAgentStateKey = 1 + iota
+)
+
+func QEMUGuestAgentFromConfig(in *config.HookQEMUGuestAgent) (*QEMUGuestAgent, error) {
+	if len(in.Sockets) == 0 {
+		return nil, errors.New("`sockets` must not be empty")
+	}
+	sockets := filters.NewDatasetMapFilter(len(in.Sockets), false)
+	for pattern, socket := range in.Sockets {
+		if !strings.HasPrefix(socket, "/") {
+			return nil, fmt.Errorf("`sockets`: %q: socket must be an absolute path, got %q", pattern, socket)
+		}
+		if err := sockets.Add(pattern, socket); err != nil {
+			return nil, errors.Wrapf(err, "`sockets`: invalid pattern %q", pattern)
+		}
+	}
+	return &QEMUGuestAgent{
+		errIsFatal:  in.ErrIsFatal,
+		sockets:     sockets,
+		timeout:     in.Timeout,
+		filesystems: sockets.AsFilter(),
+		execute:     qgaExecute,
+	}, nil
+}
+
+func (h *QEMUGuestAgent) ErrIsFatal() bool    { return h.errIsFatal }
+func (h *QEMUGuestAgent) Filesystems() Filter { return h.filesystems }
+func (h *QEMUGuestAgent) String() string      { return "qemu-guest-agent" }
+
+type QEMUGuestAgentReport struct {
+	What   string
+	Socket string
+	Err    error
+}
+
+func (r *QEMUGuestAgentReport) HadError() bool { return r.Err != nil }
+func (r *QEMUGuestAgentReport) Error() string  { return r.String() }
+func (r *QEMUGuestAgentReport) String() string {
+	var s strings.Builder
+	s.WriteString(r.What)
+	if r.Socket != "" {
+		fmt.Fprintf(&s, " via %s", r.Socket)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&s, ": %s", r.Err)
+	}
+	return s.String()
+}
+
+func (h *QEMUGuestAgent) Run(ctx context.Context, edge Edge, phase Phase, dryRun bool, extra Env, state map[interface{}]interface{}) HookReport {
+	fs, ok := extra[EnvFS]
+	if !ok {
+		panic(extra)
+	}
+	dp, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		panic(err)
+	}
+	socket, ok := h.sockets.Lookup(dp)
+	if !ok {
+		getLogger(ctx).Debug("filesystem has no guest agent socket, skipping")
+		return &QEMUGuestAgentReport{What: "no guest agent socket for this filesystem"}
+	}
+
+	h.mtx.Lock()
+	guest := h.guests[socket]
+	h.mtx.Unlock()
+	if guest != nil && !dryRun {
+		switch edge {
+		case Pre:
+			what, err := h.doRunPreGuest(ctx, socket, guest)
+			return &QEMUGuestAgentReport{what, socket, err}
+		case Post:
+			what, err := h.doRunPostGuest(ctx, socket, guest)
+			return &QEMUGuestAgentReport{what, socket, err}
+		}
+		return &QEMUGuestAgentReport{What: "skipped this edge"}
+	}
+
+	switch edge {
+	case Pre:
+		return &QEMUGuestAgentReport{"freeze guest", socket, h.doRunPre(ctx, socket, dryRun, state)}
+	case Post:
+		return &QEMUGuestAgentReport{"thaw guest", socket, h.doRunPost(ctx, socket, dryRun, state)}
+	}
+	return &QEMUGuestAgentReport{What: "skipped this edge"}
+}
+
+var _ SnapshotRunHook = (*QEMUGuestAgent)(nil)
+
+// SnapshotRunGroup groups the zvols by guest agent socket, i.e., by VM.
+func (h *QEMUGuestAgent) SnapshotRunGroup(fs *zfs.DatasetPath) (group string, ok bool) {
+	return h.sockets.Lookup(fs)
+}
+
+func (h *QEMUGuestAgent) BeginSnapshotRun(fss []*zfs.DatasetPath) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.guests = make(map[string]*qemuGuestAgentGuest)
+	for _, fs := range fss {
+		socket, ok := h.sockets.Lookup(fs)
+		if !ok {
+			continue
+		}
+		if h.guests[socket] == nil {
+			h.guests[socket] = &qemuGuestAgentGuest{}
+		}
+		h.guests[socket].pending++
+	}
+}
+
+// EndSnapshotRunFilesystem thaws the guest of fs if fs was its last zvol in the run
+// and the post-edge of fs did not thaw it, e.g., because the snapshot of fs was skipped.
+func (h *QEMUGuestAgent) EndSnapshotRunFilesystem(ctx context.Context, fs *zfs.DatasetPath) {
+	socket, ok := h.sockets.Lookup(fs)
+	if !ok {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	guest := h.guests[socket]
+	if guest == nil {
+		return
+	}
+	guest.pending--
+	if guest.pending > 0 || guest.frozen == nil {
+		return
+	}
+	frozen := guest.frozen
+	guest.frozen = nil
+	l := getLogger(ctx).WithField("socket", socket)
+	l.Debug("thaw guest filesystems, its remaining zvols were skipped")
+	if err := thawFrozen(frozen, h.timeout); err != nil {
+		l.WithError(err).Error("cannot thaw guest")
+	}
+}
+
+// EndSnapshotRun thaws the guests that are still frozen, which only happens
+// if EndSnapshotRunFilesystem was not called for their last zvol.
+func (h *QEMUGuestAgent) EndSnapshotRun(ctx context.Context) {
+	h.mtx.Lock()
+	guests := h.guests
+	h.guests = nil
+	h.mtx.Unlock()
+	for socket, guest := range guests {
+		if guest.frozen == nil {
+			continue
+		}
+		l := getLogger(ctx).WithField("socket", socket)
+		l.Debug("thaw guest filesystems at the end of the snapshotting run")
+		if err := thawFrozen(guest.frozen, h.timeout); err != nil {
+			l.WithError(err).Error("cannot thaw guest")
+		}
+	}
+}
+
+// doRunPreGuest freezes guest unless a previous zvol of the run froze it already.
+func (h *QEMUGuestAgent) doRunPreGuest(ctx context.Context, socket string, guest *qemuGuestAgentGuest) (what string, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock() // the zvols of a run are snapshotted one after another
+	// the post-edge does not run if the pre-edge fails
+	if guest.frozen != nil {
+		if time.Since(guest.frozenAt) >= h.timeout {
+			guest.frozen = nil // the watchdog thawed it
+			return "guest frozen for previous zvol", fmt.Errorf("guest was thawed after timeout %s", h.timeout)
+		}
+		return "guest frozen for previous zvol", nil
+	}
+	l := getLogger(ctx).WithField("socket", socket)
+	l.Debug("freeze guest filesystems for all of its zvols")
+	frozen, err := freezeWithTimeout(l, h.timeout, socket, func() (func() error, error) {
+		return h.freeze(socket)
+	})
+	if err != nil {
+		return "freeze guest", err
+	}
+	guest.frozen, guest.frozenAt = frozen, time.Now()
+	return "freeze guest", nil
+}
+
+// doRunPostGuest thaws guest in the post-edge of its last zvol.
+func (h *QEMUGuestAgent) doRunPostGuest(ctx context.Context, socket string, guest *qemuGuestAgentGuest) (what string, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	// pending includes this zvol until EndSnapshotRunFilesystem
+	if guest.pending > 1 {
+		return "guest stays frozen for its other zvols", nil
+	}
+	if guest.frozen == nil {
+		return "", errors.New("implementation error: post-edge without frozen guest")
+	}
+	frozen := guest.frozen
+	guest.frozen = nil
+	getLogger(ctx).WithField("socket", socket).Debug("thaw guest filesystems")
+	return "thaw guest", thawFrozen(frozen, h.timeout)
+}
+
+func (h *QEMUGuestAgent) doRunPre(ctx context.Context, socket string, dry bool, state map[interface{}]interface{}) error {
+	l := getLogger(ctx).WithField("socket", socket)
+	if dry {
+		l.Debug("dry-run - only ping the guest agent")
+		return h.execute(socket, h.timeout, "guest-ping", nil)
+	}
+
+	l.Debug("freeze guest filesystems")
+	frozen, err := freezeWithTimeout(l, h.timeout, socket, func() (func() error, error) {
+		return h.freeze(socket)
+	})
+	if err != nil {
+		return err
+	}
+	state[qemuGuestAgentFrozen] = frozen
+	return nil
+}
+
+func (h *QEMUGuestAgent) freeze(socket string) (thaw func() error, err error) {
+	var frozenCount int
+	if err := h.execute(socket, h.timeout, "guest-fsfreeze-freeze", &frozenCount); err != nil {
+		if _, ok := errors.Cause(err).(*qgaError); !ok {
+			// the guest may be frozen even though its response was lost
+			_ = h.execute(socket, h.timeout, "guest-fsfreeze-thaw", nil)
+		}
+		return nil, err
+	}
+	return func() error {
+		return h.execute(socket, h.timeout, "guest-fsfreeze-thaw", nil)
+	}, nil
+}
+
+func (h *QEMUGuestAgent) doRunPost(ctx context.Context, socket string, dry bool, state map[interface{}]interface{}) error {
+	if dry {
+		return nil
+	}
+	frozen, ok := state[qemuGuestAgentFrozen].(*fsFreezeFrozenState)
+	if !ok {
+		return errors.New("implementation error: post-edge without frozen guest")
+	}
+	getLogger(ctx).WithField("socket", socket).Debug("thaw guest filesystems")
+	return thawFrozen(frozen, h.timeout)
+}
+
+// qgaError is an error response of the guest agent.
+type qgaError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *qgaError) Error() string { return fmt.Sprintf("guest agent error %s: %s", e.Class, e.Desc) }
+
+type qgaResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *qgaError       `json:"error"`
+}
+
+// qgaExecute executes command through the guest agent socket at socket and decodes the return value into ret, if not nil.
+// The connection is closed afterwards so that it does not block other clients of the socket.
+func qgaExecute(socket string, timeout time.Duration, command string, ret interface{}) error {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to guest agent")
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	// The guest agent may have partial input of a previous client buffered, and responses that no one read.
+	// 0xff makes the agent discard its input, and it precedes the response to guest-sync-delimited with 0xff.
+	id := rand.Int31()
+	syncCmd := fmt.Sprintf(`{"execute":"guest-sync-delimited","arguments":{"id":%d}}`, id)
+	if _, err := conn.Write(append([]byte{0xff}, syncCmd...)); err != nil {
+		return errors.Wrap(err, "cannot sync with guest agent")
+	}
+	r := bufio.NewReader(conn)
+	var dec *json.Decoder
+	for {
+		// 0xff never occurs in JSON text
+		if _, err := r.ReadBytes(0xff); err != nil {
+			return errors.Wrap(err, "cannot sync with guest agent")
+		}
+		dec = json.NewDecoder(r)
+		var syncID int32
+		if err := qgaDecode(dec, &syncID); err != nil {
+			return errors.Wrap(err, "cannot sync with guest agent")
+		}
+		if syncID == id {
+			break
+		}
+		// the response to the guest-sync-delimited of a previous client
+		r = bufio.NewReader(io.MultiReader(dec.Buffered(), r))
+	}
+
+	if _, err := fmt.Fprintf(conn, `{"execute":%q}`, command); err != nil {
+		return errors.Wrapf(err, "cannot execute %s", command)
+	}
+	if err := qgaDecode(dec, ret); err != nil {
+		return errors.Wrapf(err, "%s", command)
+	}
+	return nil
+}
+
+func qgaDecode(dec *json.Decoder, ret interface{}) error {
+	var resp qgaResponse
+	if err := dec.Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if ret == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Return, ret)
+}
@@ -0,0 +1,280 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// fakeGuestAgent serves the guest agent protocol on a unix socket and records the executed commands.
+type fakeGuestAgent struct {
+	l net.Listener
+
+	mtx      sync.Mutex
+	commands []string
+	frozen   bool
+	// written to each connection before the responses, e.g., stale output of a previous client
+	stale string
+}
+
+func newFakeGuestAgent(t *testing.T, socket string) *fakeGuestAgent {
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	a := &fakeGuestAgent{l: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			a.serve(conn)
+		}
+	}()
+	return a
+}
+
+func (a *fakeGuestAgent) set(f func(a *fakeGuestAgent)) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	f(a)
+}
+
+func (a *fakeGuestAgent) isFrozen() bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.frozen
+}
+
+func (a *fakeGuestAgent) state() []string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]string(nil), a.commands...)
+}
+
+func (a *fakeGuestAgent) serve(conn net.Conn) {
+	defer conn.Close()
+	a.mtx.Lock()
+	stale := a.stale
+	a.mtx.Unlock()
+	if _, err := conn.Write([]byte(stale)); err != nil {
+		return
+	}
+	// the client resets the parser of the agent first
+	var delim [1]byte
+	if _, err := conn.Read(delim[:]); err != nil || delim[0] != 0xff {
+		return
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var cmd struct {
+			Execute   string
+			Arguments struct{ ID int32 }
+		}
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+		var resp string
+		a.mtx.Lock()
+		switch cmd.Execute {
+		case "guest-sync-delimited":
+			resp = fmt.Sprintf("\xff{\"return\": %d}\n", cmd.Arguments.ID)
+		case "guest-ping":
+			a.commands = append(a.commands, cmd.Execute)
+			resp = `{"return": {}}`
+		case "guest-fsfreeze-freeze":
+			a.commands = append(a.commands, cmd.Execute)
+			if a.frozen {
+				resp = `{"error": {"class": "GenericError", "desc": "Command guest-fsfreeze-freeze has been disabled: the agent is in frozen state"}}`
+			} else {
+				a.frozen = true
+				resp = `{"return": 2}`
+			}
+		case "guest-fsfreeze-thaw":
+			a.commands = append(a.commands, cmd.Execute)
+			a.frozen = false
+			resp = `{"return": 2}`
+		default:
+			resp = `{"error": {"class": "CommandNotFound", "desc": "unknown command"}}`
+		}
+		a.mtx.Unlock()
+		if _, err := conn.Write([]byte(resp + "\n")); err != nil {
+			return
+		}
+	}
+}
+
+func TestQEMUGuestAgent(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	dir, err := ioutil.TempDir("", "zrepl-qga")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "100.sock")
+	agent := newFakeGuestAgent(t, socket)
+	defer agent.l.Close()
+
+	h, err := QEMUGuestAgentFromConfig(&config.HookQEMUGuestAgent{
+		Sockets: map[string]string{
+			"tank/vm-100<": socket,
+			"tank/vm-101<": filepath.Join(dir, "101.sock"), // not listening
+		},
+		Timeout: 10 * time.Second,
+	})
+	require.NoError(t, err)
+
+	pass := func(fs string) bool {
+		dp, err := zfs.NewDatasetPath(fs)
+		require.NoError(t, err)
+		pass, err := h.Filesystems().Filter(dp)
+		require.NoError(t, err)
+		return pass
+	}
+	assert.True(t, pass("tank/vm-100/disk-0"))
+	assert.True(t, pass("tank/vm-101"))
+	assert.False(t, pass("tank/vm-102"))
+
+	env := Env{EnvFS: "tank/vm-100/disk-0"}
+
+	t.Run("freeze-thaw", func(t *testing.T) {
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		assert.True(t, agent.isFrozen())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, state).HadError())
+		assert.False(t, agent.isFrozen())
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, agent.state())
+	})
+
+	t.Run("snapshot-run", func(t *testing.T) {
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		fss := func(names ...string) (fss []*zfs.DatasetPath) {
+			for _, n := range names {
+				fs, err := zfs.NewDatasetPath(n)
+				require.NoError(t, err)
+				fss = append(fss, fs)
+			}
+			return fss
+		}
+		disk1 := Env{EnvFS: "tank/vm-100/disk-1"}
+
+		disks := fss("tank/vm-100/disk-0", "tank/vm-100/disk-1")
+
+		// the guest stays frozen from the first zvol's pre-edge until the last zvol's post-edge
+		h.BeginSnapshotRun(append(fss("tank/other"), disks...))
+		s0, s1 := make(map[interface{}]interface{}), make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, s0).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, s0).HadError())
+		h.EndSnapshotRunFilesystem(ctx, disks[0])
+		assert.True(t, agent.isFrozen())
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, disk1, s1).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, disk1, s1).HadError())
+		assert.False(t, agent.isFrozen())
+		h.EndSnapshotRunFilesystem(ctx, disks[1])
+		h.EndSnapshotRun(ctx)
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, agent.state())
+
+		// the guest is thawed as soon as its remaining zvols are skipped
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		h.BeginSnapshotRun(disks)
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, s0).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, s0).HadError())
+		h.EndSnapshotRunFilesystem(ctx, disks[0])
+		assert.True(t, agent.isFrozen())
+		h.EndSnapshotRunFilesystem(ctx, disks[1])
+		assert.False(t, agent.isFrozen())
+		h.EndSnapshotRun(ctx)
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, agent.state())
+
+		// after a failed freeze, the next zvol of the guest freezes it
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil; a.frozen = true })
+		h.BeginSnapshotRun(disks)
+		require.True(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, s0).HadError())
+		h.EndSnapshotRunFilesystem(ctx, disks[0])
+		agent.set(func(a *fakeGuestAgent) { a.frozen = false })
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, disk1, s1).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, disk1, s1).HadError())
+		assert.False(t, agent.isFrozen())
+		h.EndSnapshotRunFilesystem(ctx, disks[1])
+		h.EndSnapshotRun(ctx)
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, agent.state())
+
+		// the zvols of a guest are snapshotted one after another
+		order := List{h}.SnapshotRunOrder(fss("tank/vm-100/disk-0", "tank/vm-100a", "tank/vm-101", "tank/vm-100/disk-1", "tank/other"))
+		var names []string
+		for _, fs := range order {
+			names = append(names, fs.ToString())
+		}
+		assert.Equal(t, []string{"tank/vm-100/disk-0", "tank/vm-100/disk-1", "tank/vm-100a", "tank/vm-101", "tank/other"}, names)
+	})
+
+	t.Run("stale-output", func(t *testing.T) {
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		agent.set(func(a *fakeGuestAgent) { a.stale = "{\"retu\xff{\"return\": 42}\n{\"return\": 2}\n" })
+		defer agent.set(func(a *fakeGuestAgent) { a.stale = "" })
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, false, env, state).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, false, env, state).HadError())
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, agent.state())
+	})
+
+	t.Run("agent-error", func(t *testing.T) {
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		agent.set(func(a *fakeGuestAgent) { a.frozen = true })
+		defer agent.set(func(a *fakeGuestAgent) { a.frozen = false })
+		state := make(map[interface{}]interface{})
+		r := h.Run(ctx, Pre, PhaseSnapshot, false, env, state)
+		if assert.True(t, r.HadError()) {
+			assert.Contains(t, r.Error(), "agent is in frozen state")
+		}
+		// an error response means that the guest was not frozen by this hook
+		assert.Equal(t, []string{"guest-fsfreeze-freeze"}, agent.state())
+	})
+
+	t.Run("no-agent", func(t *testing.T) {
+		state := make(map[interface{}]interface{})
+		r := h.Run(ctx, Pre, PhaseSnapshot, false, Env{EnvFS: "tank/vm-101/disk-0"}, state)
+		if assert.True(t, r.HadError()) {
+			assert.Contains(t, r.Error(), "cannot connect to guest agent")
+		}
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		agent.set(func(a *fakeGuestAgent) { a.commands = nil })
+		state := make(map[interface{}]interface{})
+		require.False(t, h.Run(ctx, Pre, PhaseSnapshot, true, env, state).HadError())
+		require.False(t, h.Run(ctx, Post, PhaseSnapshot, true, env, state).HadError())
+		assert.Equal(t, []string{"guest-ping"}, agent.state())
+	})
+}
+
+func TestQEMUGuestAgentFromConfig(t *testing.T) {
+	for _, c := range []struct {
+		sockets map[string]string
+		err     string
+	}{
+		{map[string]string{}, "`sockets` must not be empty"},
+		{map[string]string{"tank/vm-100<": "qga.sock"}, "must be an absolute path"},
+		{map[string]string{"tank/<vm": "/run/qga.sock"}, "invalid pattern"},
+	} {
+		_, err := QEMUGuestAgentFromConfig(&config.HookQEMUGuestAgent{Sockets: c.sockets, Timeout: time.Second})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+#!/bin/sh -eu
+
+{ echo "$ZREPL_JOB $ZREPL_EVENT $ZREPL_TIMEOUT"; cat; echo; } >> "$ZREPL_TEST_EVENT_OUT"
@@ -3,6 +3,10 @@ package job
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,35 +17,71 @@ import (
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/after"
+	"github.com/zrepl/zrepl/daemon/job/dryrun"
+	"github.com/zrepl/zrepl/daemon/job/ready"
 	"github.com/zrepl/zrepl/daemon/job/reset"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/job/trigger"
 	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/scheduler"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/replication"
 	"github.com/zrepl/zrepl/replication/driver"
 	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/opwindow"
 	"github.com/zrepl/zrepl/replication/report"
 	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/util/semaphore"
 	"github.com/zrepl/zrepl/zfs"
 )
 
 type ActiveSide struct {
 	mode      activeMode
 	name      endpoint.JobID
-	connecter transport.Connecter
+	connecter transport.Connecter // nil if targets is non-empty
+	targets   []*activeSideTarget // non-empty for push jobs with `targets`
 
-	prunerFactory *pruner.PrunerFactory
+	prunerFactoryMtx sync.Mutex
+	prunerFactory    *pruner.PrunerFactory // replaced by Reconfigure
+
+	after   []string                   // names of the jobs whose successful invocations trigger the invocations, see package after
+	logging *logging.JobOutlets        // may be nil
+	weight  int                        // see package scheduler
+	certs   *transporttls.Certificates // see CertificatesJob
+
+	failureBackoff *failureBackoff
+	eventHooks     *hooks.EventHooks // may be nil
+	triggers       *trigger.List     // nil if the snapshotting or the `interval` of pull jobs trigger the job
+
+	replicationDriverConfig driver.Config
+	replicationHooks        *hooks.List        // may be nil
+	operatingWindows        *opwindow.Schedule // may be nil
 
 	promRepStateSecs      *prometheus.HistogramVec // labels: state
 	promPruneSecs         *prometheus.HistogramVec // labels: prune_side
 	promBytesReplicated   *prometheus.CounterVec   // labels: filesystem
 	promReplicationErrors prometheus.Gauge
+	transportMetrics      *transport.Metrics
 
-	tasksMtx sync.Mutex
-	tasks    activeSideTasks
+	activeSideTasksState
+
+	dryRunMtx    sync.Mutex
+	dryRunReport *report.AttemptReport // nil if no dry run was requested
+
+	pruneDryRuns     *pruneDryRuns
+	pruneLock        pruneLock // of the sender, and of the receiver unless targets is non-empty
+	scheduledPruning *scheduledPruning
 }
 
 //go:generate enumer -type=ActiveSideState
@@ -68,7 +108,12 @@ type activeSideTasks struct {
 	prunerSenderCancel, prunerReceiverCancel context.CancelFunc
 }
 
-func (a *ActiveSide) updateTasks(u func(*activeSideTasks)) activeSideTasks {
+type activeSideTasksState struct {
+	tasksMtx sync.Mutex
+	tasks    activeSideTasks
+}
+
+func (a *activeSideTasksState) updateTasks(u func(*activeSideTasks)) activeSideTasks {
 	a.tasksMtx.Lock()
 	defer a.tasksMtx.Unlock()
 	copy := a.tasks
@@ -84,6 +129,8 @@ type activeMode interface {
 	ConnectEndpoints(ctx context.Context, connecter transport.Connecter)
 	DisconnectEndpoints()
 	SenderReceiver() (logic.Sender, logic.Receiver)
+	// endpoints independent of ConnectEndpoints, for use by dry runs
+	DryRunEndpoints(ctx context.Context, connecter transport.Connecter) (logic.Sender, logic.Receiver, func())
 	Type() Type
 	PlannerPolicy() logic.PlannerPolicy
 	RunPeriodic(ctx context.Context, wakeUpCommon chan<- struct{})
@@ -92,12 +139,16 @@ type activeMode interface {
 }
 
 type modePush struct {
-	setupMtx      sync.Mutex
-	sender        *endpoint.Sender
-	receiver      *rpc.Client
-	senderConfig  *endpoint.SenderConfig
-	plannerPolicy *logic.PlannerPolicy
-	snapper       *snapper.PeriodicOrManual
+	setupMtx          sync.Mutex
+	sender            *endpoint.Sender
+	receiver          *rpc.Client
+	senderConfig      *endpoint.SenderConfig
+	plannerPolicy     *logic.PlannerPolicy
+	snapper           *snapper.PeriodicOrManual
+	streamCompression compression.Config
+	connectTimeouts   rpc.ClientTimeouts
+	// the jobs for which new snapshots are step-held, see pushStepHoldJobIDs
+	stepHoldJobIDs []endpoint.JobID
 }
 
 func (m *modePush) ConnectEndpoints(ctx context.Context, connecter transport.Connecter) {
@@ -107,7 +158,7 @@ func (m *modePush) ConnectEndpoints(ctx context.Context, connecter transport.Con
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.sender = endpoint.NewSender(*m.senderConfig)
-	m.receiver = rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+	m.receiver = rpc.NewClient(connecter, m.streamCompression, m.connectTimeouts, rpc.GetLoggersOrPanic(ctx))
 }
 
 func (m *modePush) DisconnectEndpoints() {
@@ -124,6 +175,11 @@ func (m *modePush) SenderReceiver() (logic.Sender, logic.Receiver) {
 	return m.sender, m.receiver
 }
 
+func (m *modePush) DryRunEndpoints(ctx context.Context, connecter transport.Connecter) (logic.Sender, logic.Receiver, func()) {
+	receiver := rpc.NewClient(connecter, m.streamCompression, m.connectTimeouts, rpc.GetLoggersOrPanic(ctx))
+	return endpoint.NewSender(*m.senderConfig), receiver, receiver.Close
+}
+
 func (m *modePush) Type() Type { return TypePush }
 
 func (m *modePush) PlannerPolicy() logic.PlannerPolicy { return *m.plannerPolicy }
@@ -144,6 +200,15 @@ func (m *modePush) ResetConnectBackoff() {
 	}
 }
 
+// connectTimeoutsFromConfig returns the default timeouts if in is empty, e.g., for push jobs with `targets`.
+func connectTimeoutsFromConfig(in config.ConnectEnum) (rpc.ClientTimeouts, error) {
+	var timeouts *config.ConnectTimeouts
+	if c := in.Common(); c != nil {
+		timeouts = c.Timeouts
+	}
+	return rpc.ClientTimeoutsFromConfig(timeouts)
+}
+
 func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.JobID) (*modePush, error) {
 	m := &modePush{}
 	var err error
@@ -153,17 +218,24 @@ func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.Job
 		return nil, errors.Wrap(err, "sender config")
 	}
 
-	replicationConfig, err := logic.ReplicationConfigFromConfig(in.Replication)
+	m.streamCompression, err = compression.FromConfig(in.Replication.Compression)
 	if err != nil {
-		return nil, errors.Wrap(err, "field `replication`")
+		return nil, errors.Wrap(err, "field `replication.compression`")
+	}
+	m.connectTimeouts, err = connectTimeoutsFromConfig(in.Connect)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `connect.timeouts`")
 	}
 
-	m.plannerPolicy = &logic.PlannerPolicy{
-		EncryptedSend:     logic.TriFromBool(in.Send.Encrypted),
-		ReplicationConfig: *replicationConfig,
+	if m.plannerPolicy, err = plannerPolicyFromConfig(&in.ActiveJob); err != nil {
+		return nil, err
 	}
+	setSendPolicy(m.plannerPolicy, in.Send)
 
-	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting); err != nil {
+	if m.stepHoldJobIDs, err = pushStepHoldJobIDs(in, jobID); err != nil {
+		return nil, err
+	}
+	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting, jobID, endpoint.NewSnapshotStepHolds{JobIDs: m.stepHoldJobIDs}); err != nil {
 		return nil, errors.Wrap(err, "cannot build snapper")
 	}
 
@@ -171,12 +243,14 @@ func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.Job
 }
 
 type modePull struct {
-	setupMtx       sync.Mutex
-	receiver       *endpoint.Receiver
-	receiverConfig endpoint.ReceiverConfig
-	sender         *rpc.Client
-	plannerPolicy  *logic.PlannerPolicy
-	interval       config.PositiveDurationOrManual
+	setupMtx          sync.Mutex
+	receiver          *endpoint.Receiver
+	receiverConfig    endpoint.ReceiverConfig
+	sender            *rpc.Client
+	plannerPolicy     *logic.PlannerPolicy
+	interval          config.PositiveDurationOrManual
+	streamCompression compression.Config
+	connectTimeouts   rpc.ClientTimeouts
 }
 
 func (m *modePull) ConnectEndpoints(ctx context.Context, connecter transport.Connecter) {
@@ -186,7 +260,7 @@ func (m *modePull) ConnectEndpoints(ctx context.Context, connecter transport.Con
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.receiver = endpoint.NewReceiver(m.receiverConfig)
-	m.sender = rpc.NewClient(connecter, rpc.GetLoggersOrPanic(ctx))
+	m.sender = rpc.NewClient(connecter, m.streamCompression, m.connectTimeouts, rpc.GetLoggersOrPanic(ctx))
 }
 
 func (m *modePull) DisconnectEndpoints() {
@@ -203,6 +277,11 @@ func (m *modePull) SenderReceiver() (logic.Sender, logic.Receiver) {
 	return m.sender, m.receiver
 }
 
+func (m *modePull) DryRunEndpoints(ctx context.Context, connecter transport.Connecter) (logic.Sender, logic.Receiver, func()) {
+	sender := rpc.NewClient(connecter, m.streamCompression, m.connectTimeouts, rpc.GetLoggersOrPanic(ctx))
+	return sender, endpoint.NewReceiver(m.receiverConfig), sender.Close
+}
+
 func (*modePull) Type() Type { return TypePull }
 
 func (m *modePull) PlannerPolicy() logic.PlannerPolicy { return *m.plannerPolicy }
@@ -213,6 +292,9 @@ func (m *modePull) RunPeriodic(ctx context.Context, wakeUpCommon chan<- struct{}
 		// "waiting for wakeups" is printed in common ActiveSide.do
 		return
 	}
+	if m.interval.Interval == 0 {
+		return // field `triggers` replaces the interval
+	}
 	t := time.NewTicker(m.interval.Interval)
 	defer t.Stop()
 	for {
@@ -224,7 +306,11 @@ func (m *modePull) RunPeriodic(ctx context.Context, wakeUpCommon chan<- struct{}
 				GetLogger(ctx).
 					WithField("pull_interval", m.interval).
 					Warn("pull job took longer than pull interval")
-				wakeUpCommon <- struct{}{} // block anyways, to queue up the wakeup
+				select { // block anyways, to queue up the wakeup
+				case wakeUpCommon <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
 			}
 		case <-ctx.Done():
 			return
@@ -247,16 +333,23 @@ func (m *modePull) ResetConnectBackoff() {
 func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.JobID) (m *modePull, err error) {
 	m = &modePull{}
 	m.interval = in.Interval
+	if (m.interval == config.PositiveDurationOrManual{}) == (len(in.Triggers) == 0) {
+		return nil, fmt.Errorf("exactly one of fields `interval` and `triggers` must be set")
+	}
 
-	replicationConfig, err := logic.ReplicationConfigFromConfig(in.Replication)
+	m.streamCompression, err = compression.FromConfig(in.Replication.Compression)
 	if err != nil {
-		return nil, errors.Wrap(err, "field `replication`")
+		return nil, errors.Wrap(err, "field `replication.compression`")
+	}
+	m.connectTimeouts, err = connectTimeoutsFromConfig(in.Connect)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `connect.timeouts`")
 	}
 
-	m.plannerPolicy = &logic.PlannerPolicy{
-		EncryptedSend:     logic.DontCare,
-		ReplicationConfig: *replicationConfig,
+	if m.plannerPolicy, err = plannerPolicyFromConfig(&in.ActiveJob); err != nil {
+		return nil, err
 	}
+	m.plannerPolicy.EncryptedSend = logic.DontCare // the source job's send options apply
 
 	m.receiverConfig, err = buildReceiverConfig(in, jobID)
 	if err != nil {
@@ -266,25 +359,231 @@ func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.Job
 	return m, nil
 }
 
+// plannerPolicyFromConfig builds the parts of the planner policy that all active jobs configure alike.
+// The send options are left at their zero values, see setSendPolicy.
+func plannerPolicyFromConfig(in *config.ActiveJob) (*logic.PlannerPolicy, error) {
+	replicationConfig, err := logic.ReplicationConfigFromConfig(in.Replication)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	bandwidthLimiter, err := bandwidthLimiterFromConfig(in.Replication)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	stepStateFile, err := stepStateFileFromConfig(in.Replication)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	incrementalSteps, err := logic.IncrementalStepsFromConfig(in.Replication.IncrementalSteps)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.incremental_steps`")
+	}
+	stepHooks, err := stepHooksFromConfig(in.Replication.Hooks.Step)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.hooks.step`")
+	}
+	largeSteps, err := logic.LargeStepsFromConfig(in.Replication.LargeSteps)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.large_steps`")
+	}
+	stepResume, err := logic.StepResumeFromConfig(in.Replication.StepResume)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.step_resume`")
+	}
+
+	return &logic.PlannerPolicy{
+		ReplicationConfig: *replicationConfig,
+		SizeEstimates:     in.Replication.SizeEstimates,
+		SizeEstimateCache: logic.NewSizeEstimateCache(),
+		BandwidthLimiter:  bandwidthLimiter,
+		StepStateFile:     stepStateFile,
+		ReceiverRollback:  in.ConflictResolution.ReceiverRollback,
+		IncrementalSteps:  incrementalSteps,
+		StepHooks:         stepHooks,
+		LargeSteps:        largeSteps,
+		StepResume:        stepResume,
+	}, nil
+}
+
+// setSendPolicy applies the send options of jobs whose sender runs in the daemon's process.
+func setSendPolicy(p *logic.PlannerPolicy, send *config.SendOptions) {
+	p.EncryptedSend = logic.TriFromBool(send.Encrypted)
+	p.RawSend = send.Raw
+	p.CompressedSend = send.Compressed
+	p.EmbeddedDataSend = send.EmbeddedData
+	p.LargeBlocksSend = send.LargeBlocks
+}
+
+// The returned limiter is shared by all replication steps of the job
+// and can be adjusted at runtime through ActiveSide.BandwidthLimiter.
+func bandwidthLimiterFromConfig(in *config.Replication) (*bandwidthlimit.Limiter, error) {
+	rate, err := bandwidthlimit.ParseRate(in.BandwidthLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `bandwidth_limit`")
+	}
+	return bandwidthlimit.NewLimiter(rate), nil
+}
+
+// Returns nil if in does not configure a step state file.
+func stepStateFileFromConfig(in *config.Replication) (*logic.StepStateFile, error) {
+	if in.StepStateFile == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(in.StepStateFile) {
+		return nil, errors.Errorf("field `step_state_file` must be an absolute path, got %q", in.StepStateFile)
+	}
+	f, err := logic.LoadStepStateFile(in.StepStateFile)
+	return f, errors.Wrap(err, "field `step_state_file`")
+}
+
+// deprecated: the environment variables predate field `replication`,
+// they only apply to the fields that are not set
+var deprecatedReplicationEnvVars = []string{
+	"ZREPL_REPLICATION_MAX_ATTEMPTS",
+	"ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT",
+	"ZREPL_REPLICATION_TEMPORARY_ZFS_ERROR_RETRY_INTERVAL",
+	"ZREPL_REPLICATION_EXPERIMENTAL_REPLICATION_CONCURRENCY",
+}
+
+func warnDeprecatedReplicationEnvVars(log Logger) {
+	for _, v := range deprecatedReplicationEnvVars {
+		if os.Getenv(v) != "" {
+			log.WithField("variable", v).Warn("deprecated environment variable is set, use field `replication` of the job config instead")
+		}
+	}
+}
+
+func retryPolicyFromConfig(in *config.ReplicationRetryPolicy, def driver.RetryPolicy) driver.RetryPolicy {
+	p := def
+	if in.MaxAttempts != nil {
+		p.MaxAttempts = *in.MaxAttempts
+	}
+	if in.InitialInterval != nil {
+		p.InitialInterval = *in.InitialInterval
+	}
+	if in.GiveUpTimeout != nil {
+		p.GiveUpTimeout = *in.GiveUpTimeout
+	}
+	p.Multiplier = in.Multiplier
+	p.Jitter = in.Jitter
+	return p
+}
+
+func retryPoliciesFromConfig(in *config.ReplicationOptionsRetry) driver.RetryPolicies {
+	def := driver.DefaultRetryPolicies()
+	maxAttempts := envconst.Int("ZREPL_REPLICATION_MAX_ATTEMPTS", def.Network.MaxAttempts)
+	def.Network.MaxAttempts = maxAttempts
+	def.ZFS.MaxAttempts = maxAttempts
+	def.Network.GiveUpTimeout = envconst.Duration("ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT", def.Network.GiveUpTimeout)
+	def.ZFS.InitialInterval = envconst.Duration("ZREPL_REPLICATION_TEMPORARY_ZFS_ERROR_RETRY_INTERVAL", def.ZFS.InitialInterval)
+	return driver.RetryPolicies{
+		Planning: retryPolicyFromConfig(in.Planning, def.Planning),
+		Network:  retryPolicyFromConfig(in.Network, def.Network),
+		ZFS:      retryPolicyFromConfig(in.ZFS, def.ZFS),
+	}
+}
+
+func filesystemPrioritiesFromConfig(in []*config.ReplicationPriority) (driver.FilesystemPriorities, error) {
+	priorities := make(driver.FilesystemPriorities, len(in))
+	for i, p := range in {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regex %q", p.Regex)
+		}
+		priorities[i] = driver.FilesystemPriority{Regex: re, Priority: p.Priority}
+	}
+	return priorities, nil
+}
+
 func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (j *ActiveSide, err error) {
 
-	j = &ActiveSide{}
+	j = &ActiveSide{pruneDryRuns: newPruneDryRuns(), pruneLock: newPruneLock()}
 	j.name, err = endpoint.MakeJobID(in.Name)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid job name")
 	}
+	j.transportMetrics = transport.NewMetrics(j.name.String())
+	j.after = in.After
+	if j.logging, err = logging.JobOutletsFromConfig(in.Logging); err != nil {
+		return nil, errors.Wrap(err, "field `logging`")
+	}
+	j.weight = in.Weight
+	if j.failureBackoff, err = failureBackoffFromConfig(in.FailureBackoff); err != nil {
+		return nil, errors.Wrap(err, "field `failure_backoff`")
+	}
 
+	var fsf zfs.DatasetFilter // the filesystems on this host, nil for pull jobs
 	switch v := configJob.(type) {
 	case *config.PushJob:
-		j.mode, err = modePushFromConfig(g, v, j.name) // shadow
+		var push *modePush
+		push, err = modePushFromConfig(g, v, j.name)
+		if err == nil && len(v.Targets) > 0 {
+			j.targets, err = pushTargetsFromConfig(g, v, push, j.transportMetrics)
+		}
+		if err == nil {
+			fsf = push.senderConfig.FSF
+		}
+		j.mode = push
 	case *config.PullJob:
 		j.mode, err = modePullFromConfig(g, v, j.name) // shadow
+	case *config.LocalJob:
+		var local *modeLocal
+		local, err = modeLocalFromConfig(g, v, j.name)
+		if err == nil {
+			fsf = local.senderConfig.FSF
+		}
+		j.mode = local
 	default:
 		panic(fmt.Sprintf("implementation error: unknown job type %T", v))
 	}
 	if err != nil {
 		return nil, err // no wrapping required
 	}
+	if j.triggers, err = trigger.FromConfig(in.Triggers, fsf); err != nil {
+		return nil, errors.Wrap(err, "field `triggers`")
+	}
+
+	events := []hooks.Event{hooks.EventReplicationStarted, hooks.EventReplicationSucceeded, hooks.EventReplicationFailed, hooks.EventPruningCompleted}
+	if _, ok := j.mode.(*modePull); !ok {
+		events = append(events, hooks.EventSnapshottingCompleted)
+	}
+	if j.eventHooks, err = hooks.EventHooksFromConfig(j.name.String(), in.EventHooks, events...); err != nil {
+		return nil, errors.Wrap(err, "field `event_hooks`")
+	}
+
+	stepConcurrency := in.Replication.Concurrency.Steps
+	if stepConcurrency == 0 {
+		stepConcurrency = envconst.Int("ZREPL_REPLICATION_EXPERIMENTAL_REPLICATION_CONCURRENCY", 1)
+	}
+	j.replicationDriverConfig = driver.Config{
+		StepQueueConcurrency:  stepConcurrency,
+		FilesystemConcurrency: in.Replication.Concurrency.FS,
+		Retry:                 retryPoliciesFromConfig(in.Replication.Retry),
+	}
+	j.replicationDriverConfig.Priorities, err = filesystemPrioritiesFromConfig(in.Replication.Priorities)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.priorities`")
+	}
+	j.replicationDriverConfig.OnError, err = driver.OnErrorFromConfig(in.Replication.OnError)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.on_error`")
+	}
+	if err := j.replicationDriverConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "field `replication`")
+	}
+	if len(in.Replication.Hooks.Replication) > 0 {
+		j.replicationHooks, err = hooks.ListFromConfig(&in.Replication.Hooks.Replication)
+		if err != nil {
+			return nil, errors.Wrap(err, "field `replication.hooks.replication`")
+		}
+	}
+	j.operatingWindows, err = opwindow.ScheduleFromConfig(in.Replication)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `replication.windows`")
+	}
+	if j.operatingWindows != nil {
+		j.replicationDriverConfig.StepGate = j.operatingWindows
+	}
 
 	j.promRepStateSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   "zrepl",
@@ -309,9 +608,21 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	})
 
-	j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot build client")
+	switch {
+	case j.mode.Type() == TypeLocal:
+		// sender and receiver run in-process
+	case len(j.targets) > 0 && in.Connect.Ret != nil:
+		return nil, errors.New("fields `connect` and `targets` are mutually exclusive")
+	case len(j.targets) > 0:
+		// each target has its own connecter
+	case in.Connect.Ret == nil:
+		return nil, errors.New("field `connect` is required")
+	default:
+		j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build client")
+		}
+		j.connecter = j.transportMetrics.Connecter(j.connecter, fromconfig.PeerFromConfig(in.Connect))
 	}
 
 	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
@@ -321,10 +632,13 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		Help:        "seconds spent in pruner",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"prune_side"})
-	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.promPruneSecs)
+	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.snapshotClasses(), j.promPruneSecs)
 	if err != nil {
 		return nil, err
 	}
+	if j.scheduledPruning, err = scheduledPruningFromConfig(in.Pruning.Triggers); err != nil {
+		return nil, errors.Wrap(err, "field `pruning.triggers`")
+	}
 
 	return j, nil
 }
@@ -334,14 +648,50 @@ func (j *ActiveSide) RegisterMetrics(registerer prometheus.Registerer) {
 	registerer.MustRegister(j.promPruneSecs)
 	registerer.MustRegister(j.promBytesReplicated)
 	registerer.MustRegister(j.promReplicationErrors)
+	j.transportMetrics.Register(registerer)
 }
 
 func (j *ActiveSide) Name() string { return j.name.String() }
 
+func (j *ActiveSide) After() []string { return j.after }
+
+func (j *ActiveSide) Logging() *logging.JobOutlets { return j.logging }
+
+func (j *ActiveSide) Weight() int { return j.weight }
+
+func (j *ActiveSide) Certificates() *transporttls.Certificates { return j.certs }
+
+func (j *ActiveSide) setCertificates(c *transporttls.Certificates) { j.certs = c }
+
+func (j *ActiveSide) BandwidthLimiter() *bandwidthlimit.Limiter {
+	return j.mode.PlannerPolicy().BandwidthLimiter
+}
+
+// SnapshotNow makes the job take snapshots right away, see snapper.Snapper.SnapshotNow.
+func (j *ActiveSide) SnapshotNow(ctx context.Context, selection func(fs string) bool) error {
+	switch m := j.mode.(type) {
+	case *modePush:
+		return m.snapper.SnapshotNow(ctx, selection)
+	case *modeLocal:
+		return m.snapper.SnapshotNow(ctx, selection)
+	default:
+		return errors.New("pull jobs do not snapshot")
+	}
+}
+
 type ActiveSideStatus struct {
 	Replication                    *report.Report
+	DryRun                         *report.AttemptReport // result of the most recent `zrepl signal plan`
+	PruneDryRun                    *PruneDryRunReport    `json:",omitempty"` // result of the most recent `zrepl prune --dry-run`
 	PruningSender, PruningReceiver *pruner.Report
-	Snapshotting                   *snapper.Report
+	// result of the most recent pruning triggered by field `pruning.triggers`
+	ScheduledPruning *ScheduledPruningReport `json:",omitempty"`
+	Snapshotting     *snapper.Report
+	// push jobs with `targets`: replication, dry run and receiver pruning per target,
+	// Replication, DryRun and PruningReceiver are nil
+	Targets []*ActiveSideTargetStatus `json:",omitempty"`
+	// nil unless the job backs off after failed invocations
+	FailureBackoff *FailureBackoffStatus `json:",omitempty"`
 }
 
 func (j *ActiveSide) Status() *Status {
@@ -359,25 +709,42 @@ func (j *ActiveSide) Status() *Status {
 		s.PruningReceiver = tasks.prunerReceiver.Report()
 	}
 	s.Snapshotting = j.mode.SnapperReport()
+	for _, target := range j.targets {
+		s.Targets = append(s.Targets, target.status())
+	}
+	j.dryRunMtx.Lock()
+	s.DryRun = j.dryRunReport
+	j.dryRunMtx.Unlock()
+	s.PruneDryRun = j.pruneDryRuns.status()
+	s.ScheduledPruning = j.scheduledPruning.status()
+	s.FailureBackoff = j.failureBackoff.status(time.Now())
 	return &Status{Type: t, JobSpecific: s}
 }
 
 func (j *ActiveSide) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
-	pull, ok := j.mode.(*modePull)
-	if !ok {
-		_ = j.mode.(*modePush) // make sure we didn't introduce a new job type
+	switch m := j.mode.(type) {
+	case *modePull:
+		return m.receiverConfig.RootWithoutClientComponent.Copy(), true
+	case *modeLocal:
+		return m.receiverConfig.RootWithoutClientComponent.Copy(), true
+	case *modePush:
 		return nil, false
+	default:
+		panic(fmt.Sprintf("implementation error: unknown mode %T", m))
 	}
-	return pull.receiverConfig.RootWithoutClientComponent.Copy(), true
 }
 
 func (j *ActiveSide) SenderConfig() *endpoint.SenderConfig {
-	push, ok := j.mode.(*modePush)
-	if !ok {
-		_ = j.mode.(*modePull) // make sure we didn't introduce a new job type
+	switch m := j.mode.(type) {
+	case *modePush:
+		return m.senderConfig
+	case *modeLocal:
+		return m.senderConfig
+	case *modePull:
 		return nil
+	default:
+		panic(fmt.Sprintf("implementation error: unknown mode %T", m))
 	}
-	return push.senderConfig
 }
 
 // The active side of a replication uses one end (sender or receiver)
@@ -394,42 +761,186 @@ func (j *ActiveSide) Run(ctx context.Context) {
 	defer endTask()
 
 	ctx = context.WithValue(ctx, endpoint.ClientIdentityKey, FakeActiveSideDirectMethodInvocationClientIdentity(j.name))
+	ctx = hooks.WithEventHooks(ctx, j.eventHooks)
 
 	log := GetLogger(ctx)
 
 	defer log.Info("job exiting")
+	ready.Ready(ctx) // active jobs do not listen
+	warnDeprecatedReplicationEnvVars(log)
 
 	periodicDone := make(chan struct{})
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	periodicCtx, endTask := trace.WithTask(ctx, "periodic")
 	defer endTask()
-	go j.mode.RunPeriodic(periodicCtx, periodicDone)
+	periodicReturned := make(chan struct{})
+	go func() {
+		defer close(periodicReturned)
+		j.mode.RunPeriodic(periodicCtx, periodicDone)
+	}()
+	defer func() {
+		cancel()
+		<-periodicReturned // its tasks, e.g., those of the snapper, must end before the periodic task
+	}()
+	triggered := j.triggers.Run(periodicCtx)
+
+	dryRunCtx, endTask := trace.WithTask(ctx, "dry-runs")
+	defer endTask()
+	go j.runDryRuns(dryRunCtx)
+
+	pruneDryRunCtx, endTask := trace.WithTask(ctx, "prune-dry-runs")
+	defer endTask()
+	go j.pruneDryRuns.run(pruneDryRunCtx, j.planPruning)
+
+	scheduledPruningCtx, endTask := trace.WithTask(ctx, "scheduled-pruning")
+	defer endTask()
+	go j.scheduledPruning.run(scheduledPruningCtx, j.pruneScheduled)
+
+	if j.operatingWindows != nil {
+		windowsCtx, endTask := trace.WithTask(ctx, "operating-windows")
+		defer endTask()
+		go j.operatingWindows.Run(windowsCtx, j.BandwidthLimiter())
+	}
 
 	invocationCount := 0
 outer:
 	for {
 		log.Info("wait for wakeups")
+		var selection driver.FilesystemSelection // nil for periodic invocations
+		deferrable := false                      // wakeups are not deferred
+		backoffEnd, stopBackoffTimer := j.failureBackoff.deferredTrigger()
 		select {
 		case <-ctx.Done():
 			log.WithError(ctx.Err()).Info("context")
 			break outer
+		case <-stop.Wait(ctx):
+			log.Info("stop requested")
+			break outer
 
-		case <-wakeup.Wait(ctx):
+		case req := <-wakeup.Wait(ctx):
 			j.mode.ResetConnectBackoff()
+			for _, target := range j.targets {
+				target.mode.ResetConnectBackoff()
+			}
+			j.failureBackoff.end()
+			selection = req.Filesystems
+		case <-after.Wait(ctx):
+			log.Info("triggered by the jobs in field `after`")
+			deferrable = true
 		case <-periodicDone:
+			if len(j.after) > 0 || j.triggers != nil {
+				// the snapshots are taken, but the jobs in `after` or field `triggers` trigger the replication
+				continue
+			}
+			deferrable = true
+		case <-triggered:
+			log.Info("triggered by field `triggers`")
+			deferrable = true
+		case <-backoffEnd:
+			log.Info("backoff after failed invocations ended, running the deferred invocation")
+		}
+		stopBackoffTimer()
+		if deferrable && j.failureBackoff.deferTrigger(time.Now()) {
+			log.Debug("backing off after failed invocations, deferring the trigger")
+			continue
 		}
 		invocationCount++
 		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
-		j.do(invocationCtx)
+		if len(selection) > 0 {
+			log.WithField("filesystems", selection).Info("replicating only the filesystems selected by the wakeup")
+		}
+		j.do(invocationCtx, selection)
+		if ctx.Err() == nil && !stop.Requested(ctx) {
+			err := j.invocationErr()
+			after.Completed(ctx, err)
+			logFailureBackoff(log, j.failureBackoff.completed(err, time.Now()))
+		}
 		endSpan()
 	}
 }
 
-func (j *ActiveSide) do(ctx context.Context) {
+// runDryRuns plans replication whenever requested through dryrun.Wait, independent of
+// the job's replication. Requests that arrive while a dry run is in progress are rejected.
+func (j *ActiveSide) runDryRuns(ctx context.Context) {
+	log := GetLogger(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-dryrun.Wait(ctx):
+		}
+		if len(j.targets) > 0 {
+			j.dryRunTargets(ctx)
+			continue
+		}
+		log.Info("start replication dry run")
+		policy := j.mode.PlannerPolicy()
+		policy.StepStateFile = nil // a dry run must not alter the persisted steps
+		j.dryRunMtx.Lock()
+		j.dryRunReport = &report.AttemptReport{State: report.AttemptPlanning, StartAt: time.Now()}
+		j.dryRunMtx.Unlock()
+
+		sender, receiver, closeEndpoints := j.mode.DryRunEndpoints(ctx, j.connecter)
+		planner := logic.NewPlanner(nil, nil, sender, receiver, policy)
+		rep := replication.DryRun(ctx, planner)
+		closeEndpoints()
+
+		j.dryRunMtx.Lock()
+		j.dryRunReport = rep
+		j.dryRunMtx.Unlock()
+		log.WithField("state", rep.State).Info("replication dry run finished")
+	}
+}
 
-	j.mode.ConnectEndpoints(ctx, j.connecter)
-	defer j.mode.DisconnectEndpoints()
+// PruneDryRun makes the job plan the pruning of sender and receiver without destroying snapshots.
+// The result is reported in ActiveSideStatus.PruneDryRun.
+func (j *ActiveSide) PruneDryRun() error {
+	return j.pruneDryRuns.request()
+}
+
+// planPruning dry-runs the pruning of the sender and the receiver, independent of the job's invocations.
+func (j *ActiveSide) planPruning(ctx context.Context) []*PruneSide {
+	return j.pruneSides(ctx, planPruneSide)
+}
+
+// pruneScheduled prunes the sender and the receiver, independent of the job's invocations, see field `pruning.triggers`.
+// With push jobs, the sender's pruning only requires the sender, and thus continues while the receiver is down.
+func (j *ActiveSide) pruneScheduled(ctx context.Context) []*PruneSide {
+	return j.pruneSides(ctx, runPrunerUnlessLocked)
+}
+
+// pruneSide is called with the pruner of each side of the job, in order, and the lock of the side.
+// It returns nil if it skipped the side.
+type pruneSide func(ctx context.Context, side string, lock pruneLock, p *pruner.Pruner) *PruneSide
+
+// pruneSides calls prune with each side of the job, with endpoints that are independent of the job's invocations.
+func (j *ActiveSide) pruneSides(ctx context.Context, prune pruneSide) []*PruneSide {
+	if len(j.targets) > 0 {
+		return j.pruneSidesTargets(ctx, prune)
+	}
+	sender, receiver, closeEndpoints := j.mode.DryRunEndpoints(ctx, j.connecter)
+	defer closeEndpoints()
+	f := j.getPrunerFactory()
+	return appendPruneSides(nil,
+		prune(ctx, "sender", j.pruneLock, f.BuildSenderPruner(ctx, sender, sender)),
+		prune(ctx, "receiver", j.pruneLock, f.BuildReceiverPruner(ctx, receiver, sender)),
+	)
+}
+
+// appendPruneSides appends the sides that are not nil.
+func appendPruneSides(sides []*PruneSide, add ...*PruneSide) []*PruneSide {
+	for _, s := range add {
+		if s != nil {
+			sides = append(sides, s)
+		}
+	}
+	return sides
+}
+
+// do replicates, then prunes sender and receiver.
+// A non-nil selection restricts the replication to the selected filesystems.
+func (j *ActiveSide) do(ctx context.Context, selection driver.FilesystemSelection) {
 
 	// allow cancellation of an invocation (this function)
 	ctx, cancelThisRun := context.WithCancel(ctx)
@@ -443,73 +954,57 @@ func (j *ActiveSide) do(ctx context.Context) {
 		}
 	}()
 
+	if len(j.targets) > 0 {
+		j.doTargets(ctx, selection)
+		return
+	}
+
+	j.mode.ConnectEndpoints(ctx, j.connecter)
+	defer j.mode.DisconnectEndpoints()
+
 	sender, receiver := j.mode.SenderReceiver()
 
 	{
 		select {
 		case <-ctx.Done():
 			return
+		case <-stop.Wait(ctx):
+			return
 		default:
 		}
-		ctx, endSpan := trace.WithSpan(ctx, "replication")
-		ctx, repCancel := context.WithCancel(ctx)
-		var repWait driver.WaitFunc
-		j.updateTasks(func(tasks *activeSideTasks) {
-			// reset it
-			*tasks = activeSideTasks{}
-			tasks.replicationCancel = func() { repCancel(); endSpan() }
-			tasks.replicationReport, repWait = replication.Do(
-				ctx, logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, j.mode.PlannerPolicy()),
-			)
-			tasks.state = ActiveSideReplicating
-		})
-		GetLogger(ctx).Info("start replication")
-		repWait(true) // wait blocking
-		repCancel()   // always cancel to free up context resources
-
-		replicationReport := j.tasks.replicationReport()
+		replicationReport := j.replicate(ctx, &j.activeSideTasksState, j.mode.PlannerPolicy(), selection, sender, receiver)
 		j.promReplicationErrors.Set(float64(replicationReport.GetFailedFilesystemsCountInLatestAttempt()))
+	}
 
-		endSpan()
+	if _, ok := j.mode.(*modePull); ok {
+		// the source job cannot know what we received otherwise, see ackReceived
+		ackReceived(ctx, selection, sender.(ackReceivedSender), receiver)
 	}
 
+	if err := j.pruneLock.lock(ctx); err != nil {
+		return
+	}
+	defer j.pruneLock.unlock()
+
 	{
 		select {
 		case <-ctx.Done():
 			return
+		case <-stop.Wait(ctx):
+			return
 		default:
 		}
-		ctx, endSpan := trace.WithSpan(ctx, "prune_sender")
-		ctx, senderCancel := context.WithCancel(ctx)
-		tasks := j.updateTasks(func(tasks *activeSideTasks) {
-			tasks.prunerSender = j.prunerFactory.BuildSenderPruner(ctx, sender, sender)
-			tasks.prunerSenderCancel = func() { senderCancel(); endSpan() }
-			tasks.state = ActiveSidePruneSender
-		})
-		GetLogger(ctx).Info("start pruning sender")
-		tasks.prunerSender.Prune()
-		GetLogger(ctx).Info("finished pruning sender")
-		senderCancel()
-		endSpan()
+		j.pruneSender(ctx, sender, sender)
 	}
 	{
 		select {
 		case <-ctx.Done():
 			return
+		case <-stop.Wait(ctx):
+			return
 		default:
 		}
-		ctx, endSpan := trace.WithSpan(ctx, "prune_recever")
-		ctx, receiverCancel := context.WithCancel(ctx)
-		tasks := j.updateTasks(func(tasks *activeSideTasks) {
-			tasks.prunerReceiver = j.prunerFactory.BuildReceiverPruner(ctx, receiver, sender)
-			tasks.prunerReceiverCancel = func() { receiverCancel(); endSpan() }
-			tasks.state = ActiveSidePruneReceiver
-		})
-		GetLogger(ctx).Info("start pruning receiver")
-		tasks.prunerReceiver.Prune()
-		GetLogger(ctx).Info("finished pruning receiver")
-		receiverCancel()
-		endSpan()
+		j.pruneReceiver(ctx, &j.activeSideTasksState, receiver, sender)
 	}
 
 	j.updateTasks(func(tasks *activeSideTasks) {
@@ -517,3 +1012,184 @@ func (j *ActiveSide) do(ctx context.Context) {
 	})
 
 }
+
+// replicate resets tasks and records the replication from sender to receiver in it.
+// The replication is surrounded by the job's replication hooks,
+// its outcome is notified to the job's event hooks.
+func (j *ActiveSide) replicate(ctx context.Context, tasks *activeSideTasksState, policy logic.PlannerPolicy, selection driver.FilesystemSelection, sender logic.Sender, receiver logic.Receiver) (rep *report.Report) {
+	defer func() { notifyReplicationCompleted(ctx, rep) }()
+	if j.replicationHooks == nil {
+		return j.doReplicate(ctx, tasks, policy, selection, sender, receiver)
+	}
+
+	tasks.updateTasks(func(tasks *activeSideTasks) {
+		*tasks = activeSideTasks{state: ActiveSideReplicating}
+	})
+	// the callback adds the variables that are only known after replication to env,
+	// they are visible to the post-edges
+	env := hooks.Env{hooks.EnvJob: j.name.String()}
+	cb := hooks.NewCallbackHook("replication", func(ctx context.Context) error {
+		rep = j.doReplicate(ctx, tasks, policy, selection, sender, receiver)
+		env[hooks.EnvBytesReplicated] = strconv.FormatInt(bytesReplicated(rep), 10)
+		env[hooks.EnvFailedFilesystems] = strconv.Itoa(rep.GetFailedFilesystemsCountInLatestAttempt())
+		return nil
+	}, nil)
+	plan, err := hooks.NewPlan(j.replicationHooks, hooks.PhaseReplication, cb, env)
+	if err != nil {
+		GetLogger(ctx).WithError(err).Error("cannot create replication hook plan, replicating without hooks")
+		return j.doReplicate(ctx, tasks, policy, selection, sender, receiver)
+	}
+	plan.Run(ctx, false)
+
+	planReport := plan.Report()
+	if planReport.HadError() {
+		GetLogger(ctx).WithField("report", planReport.String()).Warn("replication hook invocation failed")
+	}
+	if rep == nil {
+		rep = skippedReplication(tasks, fmt.Sprintf("replication skipped because of a fatal error in a pre-replication hook:\n%s", planReport))
+	}
+	return rep
+}
+
+func bytesReplicated(rep *report.Report) (sum int64) {
+	for _, a := range rep.Attempts {
+		_, replicated, _ := a.BytesSum()
+		sum += replicated
+	}
+	return sum
+}
+
+// notifyReplicationCompleted notifies the event hooks of ctx about the outcome of the replication that produced rep.
+func notifyReplicationCompleted(ctx context.Context, rep *report.Report) {
+	details := &hooks.ReplicationEventDetails{
+		BytesReplicated:   bytesReplicated(rep),
+		FailedFilesystems: rep.GetFailedFilesystemsCountInLatestAttempt(),
+	}
+	switch failed := details.FailedFilesystems; {
+	case failed < 0:
+		err := errors.New("planning failed")
+		if latest := rep.Attempts[len(rep.Attempts)-1]; latest.PlanError != nil {
+			err = latest.PlanError
+		}
+		hooks.NotifyEvent(ctx, hooks.EventReplicationFailed, err, details)
+	case failed > 0:
+		hooks.NotifyEvent(ctx, hooks.EventReplicationFailed, fmt.Errorf("%d filesystem(s) failed", failed), details)
+	default:
+		hooks.NotifyEvent(ctx, hooks.EventReplicationSucceeded, nil, details)
+	}
+}
+
+// skippedReplication records a replication that did not start in tasks.
+func skippedReplication(tasks *activeSideTasksState, reason string) *report.Report {
+	now := time.Now()
+	rep := &report.Report{
+		StartAt:  now,
+		FinishAt: now,
+		Attempts: []*report.AttemptReport{{
+			State:     report.AttemptPlanningError,
+			StartAt:   now,
+			FinishAt:  now,
+			PlanError: report.NewTimedError(reason, now),
+		}},
+	}
+	tasks.updateTasks(func(tasks *activeSideTasks) {
+		tasks.replicationReport = func() *report.Report { return rep }
+	})
+	return rep
+}
+
+func (j *ActiveSide) doReplicate(ctx context.Context, tasks *activeSideTasksState, policy logic.PlannerPolicy, selection driver.FilesystemSelection, sender logic.Sender, receiver logic.Receiver) *report.Report {
+	ctx, endSpan := trace.WithSpan(ctx, "replication")
+	defer endSpan()
+	tasks.updateTasks(func(tasks *activeSideTasks) {
+		*tasks = activeSideTasks{state: ActiveSideReplicating}
+	})
+	guard, err := acquireReplicationBudget(ctx)
+	if err != nil {
+		return skippedReplication(tasks, fmt.Sprintf("replication skipped while waiting for the daemon-wide replication budget: %s", err))
+	}
+	defer guard.Release()
+	hooks.NotifyEvent(ctx, hooks.EventReplicationStarted, nil, nil)
+	ctx, repCancel := context.WithCancel(ctx)
+	var repWait driver.WaitFunc
+	driverConfig := j.replicationDriverConfig
+	driverConfig.Filesystems = selection
+	driverConfig.Stop = stop.Wait(ctx)
+	t := tasks.updateTasks(func(tasks *activeSideTasks) {
+		// reset it
+		*tasks = activeSideTasks{}
+		tasks.replicationCancel = func() { repCancel(); endSpan() }
+		tasks.replicationReport, repWait = replication.Do(
+			ctx, driverConfig, logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, policy),
+		)
+		tasks.state = ActiveSideReplicating
+	})
+	GetLogger(ctx).Info("start replication")
+	repWait(true) // wait blocking
+	repCancel()   // always cancel to free up context resources
+	return t.replicationReport()
+}
+
+// acquireReplicationBudget waits until the daemon-wide budget (see package scheduler) allows the replication to start.
+// A stop request (see package stop) aborts the wait.
+func acquireReplicationBudget(ctx context.Context) (*semaphore.AcquireGuard, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop.Wait(ctx):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return scheduler.AcquireReplication(ctx)
+}
+
+// snapshotClasses returns the snapshot classes of the job's snapshotting for the keep rules,
+// see snapper.PeriodicOrManual.ClassNameRegexes. Pull jobs do not snapshot.
+func (j *ActiveSide) snapshotClasses() map[string]string {
+	switch m := j.mode.(type) {
+	case *modePush:
+		return m.snapper.ClassNameRegexes()
+	case *modeLocal:
+		return m.snapper.ClassNameRegexes()
+	default:
+		return nil
+	}
+}
+
+func (j *ActiveSide) getPrunerFactory() *pruner.PrunerFactory {
+	j.prunerFactoryMtx.Lock()
+	defer j.prunerFactoryMtx.Unlock()
+	return j.prunerFactory
+}
+
+func (j *ActiveSide) pruneSender(ctx context.Context, sender pruner.Target, history pruner.History) {
+	ctx, endSpan := trace.WithSpan(ctx, "prune_sender")
+	defer endSpan()
+	ctx, senderCancel := context.WithCancel(ctx)
+	tasks := j.updateTasks(func(tasks *activeSideTasks) {
+		tasks.prunerSender = j.getPrunerFactory().BuildSenderPruner(ctx, sender, history)
+		tasks.prunerSenderCancel = func() { senderCancel(); endSpan() }
+		tasks.state = ActiveSidePruneSender
+	})
+	GetLogger(ctx).Info("start pruning sender")
+	tasks.prunerSender.Prune()
+	GetLogger(ctx).Info("finished pruning sender")
+	senderCancel()
+}
+
+func (j *ActiveSide) pruneReceiver(ctx context.Context, tasks *activeSideTasksState, receiver pruner.Target, sender pruner.History) {
+	ctx, endSpan := trace.WithSpan(ctx, "prune_recever")
+	defer endSpan()
+	ctx, receiverCancel := context.WithCancel(ctx)
+	t := tasks.updateTasks(func(tasks *activeSideTasks) {
+		tasks.prunerReceiver = j.getPrunerFactory().BuildReceiverPruner(ctx, receiver, sender)
+		tasks.prunerReceiverCancel = func() { receiverCancel(); endSpan() }
+		tasks.state = ActiveSidePruneReceiver
+	})
+	GetLogger(ctx).Info("start pruning receiver")
+	t.prunerReceiver.Prune()
+	GetLogger(ctx).Info("finished pruning receiver")
+	receiverCancel()
+}
@@ -0,0 +1,108 @@
+package job
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/transport"
+)
+
+// modeLocal replicates to a root_fs on the same host, like a push job connected to a sink job
+// through the local transport, but the planner invokes sender and receiver directly instead of
+// through the RPC layer. The connecter is always nil.
+type modeLocal struct {
+	setupMtx       sync.Mutex
+	sender         *endpoint.Sender
+	receiver       *endpoint.Receiver
+	senderConfig   *endpoint.SenderConfig
+	receiverConfig endpoint.ReceiverConfig
+	plannerPolicy  *logic.PlannerPolicy
+	snapper        *snapper.PeriodicOrManual
+}
+
+func (m *modeLocal) ConnectEndpoints(ctx context.Context, _ transport.Connecter) {
+	m.setupMtx.Lock()
+	defer m.setupMtx.Unlock()
+	if m.receiver != nil || m.sender != nil {
+		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
+	}
+	m.sender = endpoint.NewSender(*m.senderConfig)
+	m.receiver = endpoint.NewReceiver(m.receiverConfig)
+}
+
+func (m *modeLocal) DisconnectEndpoints() {
+	m.setupMtx.Lock()
+	defer m.setupMtx.Unlock()
+	m.sender = nil
+	m.receiver = nil
+}
+
+func (m *modeLocal) SenderReceiver() (logic.Sender, logic.Receiver) {
+	m.setupMtx.Lock()
+	defer m.setupMtx.Unlock()
+	return m.sender, m.receiver
+}
+
+func (m *modeLocal) DryRunEndpoints(ctx context.Context, _ transport.Connecter) (logic.Sender, logic.Receiver, func()) {
+	return endpoint.NewSender(*m.senderConfig), endpoint.NewReceiver(m.receiverConfig), func() {}
+}
+
+func (m *modeLocal) Type() Type { return TypeLocal }
+
+func (m *modeLocal) PlannerPolicy() logic.PlannerPolicy { return *m.plannerPolicy }
+
+func (m *modeLocal) RunPeriodic(ctx context.Context, wakeUpCommon chan<- struct{}) {
+	m.snapper.Run(ctx, wakeUpCommon)
+}
+
+func (m *modeLocal) SnapperReport() *snapper.Report {
+	return m.snapper.Report()
+}
+
+func (m *modeLocal) ResetConnectBackoff() {} // there is no connection
+
+func modeLocalFromConfig(g *config.Global, in *config.LocalJob, jobID endpoint.JobID) (*modeLocal, error) {
+	m := &modeLocal{}
+	var err error
+
+	if in.Connect.Ret != nil {
+		return nil, errors.New("field `connect` is not supported for local jobs")
+	}
+	if in.Replication.Compression.Algorithm != "none" {
+		// the stream does not leave the process, see modePush.streamCompression
+		return nil, errors.New("field `replication.compression` is not supported for local jobs")
+	}
+
+	m.senderConfig, err = buildSenderConfig(in, jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "sender config")
+	}
+	m.receiverConfig, err = buildReceiverConfig(in, jobID)
+	if err != nil {
+		return nil, err
+	}
+	// otherwise, each invocation would replicate the filesystems received by the previous one
+	if pass, err := m.senderConfig.FSF.(*filters.DatasetMapFilter).FilterSubtree(m.receiverConfig.RootWithoutClientComponent); err != nil {
+		return nil, errors.Wrap(err, "cannot apply filesystem filter to root_fs")
+	} else if pass {
+		return nil, errors.Errorf("field `filesystems` must not match root_fs %q or any filesystem below it", in.RootFS)
+	}
+
+	if m.plannerPolicy, err = plannerPolicyFromConfig(&in.ActiveJob); err != nil {
+		return nil, err
+	}
+	setSendPolicy(m.plannerPolicy, in.Send)
+
+	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting, jobID, endpoint.NewSnapshotStepHolds{JobIDs: []endpoint.JobID{jobID}}); err != nil {
+		return nil, errors.Wrap(err, "cannot build snapper")
+	}
+
+	return m, nil
+}
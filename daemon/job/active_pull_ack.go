@@ -0,0 +1,105 @@
+package job
+
+import (
+	"context"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// ackReceivedSender is the sender of a pull job, i.e., the rpc.Client connected to the source job.
+type ackReceivedSender interface {
+	logic.Sender
+	AckReceived(ctx context.Context, req *pdu.AckReceivedReq) (*pdu.AckReceivedRes, error)
+}
+
+// ackReceived reports the most recent snapshot of each filesystem in selection that the receiver
+// has in common with the sender to the sender (see endpoint.Sender.AckReceived),
+// so that the source job can prune with keep rule `not_replicated`.
+//
+// Errors are only logged: the acknowledgements are repeated after each replication,
+// and the snapshots remain protected by the replication cursor that was acknowledged before.
+func ackReceived(ctx context.Context, selection driver.FilesystemSelection, sender ackReceivedSender, receiver logic.Receiver) {
+	ctx, endSpan := trace.WithSpan(ctx, "ack-received")
+	defer endSpan()
+	log := GetLogger(ctx)
+
+	sfss, err := sender.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		log.WithError(err).Error("cannot list sender filesystems, not acknowledging received snapshots")
+		return
+	}
+	rfss, err := receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		log.WithError(err).Error("cannot list receiver filesystems, not acknowledging received snapshots")
+		return
+	}
+	onSender := make(map[string]bool, len(sfss.GetFilesystems()))
+	for _, fs := range sfss.GetFilesystems() {
+		onSender[fs.GetPath()] = true
+	}
+
+	for _, rfs := range rfss.GetFilesystems() {
+		path := rfs.GetPath()
+		if rfs.GetIsPlaceholder() || !onSender[path] || !selection.Matches(path) {
+			continue
+		}
+		log := log.WithField("fs", path)
+
+		rvs, err := receiver.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: path})
+		if err != nil {
+			log.WithError(err).Error("cannot list receiver filesystem versions")
+			continue
+		}
+		svs, err := sender.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: path})
+		if err != nil {
+			log.WithError(err).Error("cannot list sender filesystem versions")
+			continue
+		}
+		latest := latestCommonSnapshot(svs.GetVersions(), rvs.GetVersions())
+		if latest == nil {
+			log.Debug("no common snapshot, nothing to acknowledge")
+			continue
+		}
+
+		_, err = sender.AckReceived(ctx, &pdu.AckReceivedReq{Filesystem: path, Guid: latest.GetGuid()})
+		if st, ok := status.FromError(err); ok && st.Code() == codes.Unimplemented {
+			log.Info("source job does not support acknowledgements of received snapshots (older zrepl version)")
+			return
+		} else if err != nil {
+			log.WithError(err).WithField("snapshot", latest.RelName()).Error("cannot acknowledge received snapshot")
+			continue
+		}
+		log.WithField("snapshot", latest.RelName()).Debug("acknowledged received snapshot")
+	}
+}
+
+// latestCommonSnapshot returns the receiver's most recent snapshot that also exists on the sender, or nil.
+func latestCommonSnapshot(sender, receiver []*pdu.FilesystemVersion) *pdu.FilesystemVersion {
+	onSender := make(map[uint64]bool, len(sender))
+	for _, v := range sender {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot {
+			onSender[v.GetGuid()] = true
+		}
+	}
+	var common []*pdu.FilesystemVersion
+	for _, v := range receiver {
+		if v.GetType() == pdu.FilesystemVersion_Snapshot && onSender[v.GetGuid()] {
+			common = append(common, v)
+		}
+	}
+	if len(common) == 0 {
+		return nil
+	}
+	// the receiver's createtxg, the sender's could be on a different pool
+	sort.Slice(common, func(i, j int) bool {
+		return common[i].GetCreateTXG() < common[j].GetCreateTXG()
+	})
+	return common[len(common)-1]
+}
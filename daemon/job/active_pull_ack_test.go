@@ -0,0 +1,93 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+type ackTestSender struct {
+	logic.Sender // nil, only the listing methods are used
+	verifyTestEndpoint
+	unimplemented bool
+	acked         map[string]uint64
+}
+
+func (s *ackTestSender) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	return s.verifyTestEndpoint.ListFilesystems(ctx, req)
+}
+
+func (s *ackTestSender) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return s.verifyTestEndpoint.ListFilesystemVersions(ctx, req)
+}
+
+func (s *ackTestSender) AckReceived(ctx context.Context, req *pdu.AckReceivedReq) (*pdu.AckReceivedRes, error) {
+	if s.unimplemented {
+		return nil, status.Error(codes.Unimplemented, "unknown method AckReceived")
+	}
+	s.acked[req.GetFilesystem()] = req.GetGuid()
+	return &pdu.AckReceivedRes{}, nil
+}
+
+type ackTestReceiver struct {
+	logic.Receiver // nil, only the listing methods are used
+	verifyTestEndpoint
+}
+
+func (r *ackTestReceiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	return r.verifyTestEndpoint.ListFilesystems(ctx, req)
+}
+
+func (r *ackTestReceiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return r.verifyTestEndpoint.ListFilesystemVersions(ctx, req)
+}
+
+func TestAckReceived(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	a, b, c := verifyTestSnap("a", 1), verifyTestSnap("b", 2), verifyTestSnap("c", 3)
+	bookmark := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: "c", Guid: 3, CreateTXG: 3}
+	newSender := func() *ackTestSender {
+		return &ackTestSender{
+			verifyTestEndpoint: verifyTestEndpoint{
+				fss: []*pdu.Filesystem{{Path: "pool/a"}, {Path: "pool/b"}, {Path: "pool/none"}, {Path: "pool/notreceived"}},
+				versions: map[string][]*pdu.FilesystemVersion{
+					"pool/a":    {a, b, c},
+					"pool/b":    {b, c},
+					"pool/none": {c},
+				},
+			},
+			acked: make(map[string]uint64),
+		}
+	}
+	receiver := &ackTestReceiver{verifyTestEndpoint: verifyTestEndpoint{
+		fss: []*pdu.Filesystem{{Path: "pool", IsPlaceholder: true}, {Path: "pool/a"}, {Path: "pool/b"}, {Path: "pool/none"}},
+		versions: map[string][]*pdu.FilesystemVersion{
+			"pool/a":    {a, b, bookmark, verifyTestSnap("receiver-only", 4)},
+			"pool/b":    {b},
+			"pool/none": {a},
+		},
+	}}
+
+	sender := newSender()
+	ackReceived(ctx, nil, sender, receiver)
+	assert.Equal(t, map[string]uint64{"pool/a": 2, "pool/b": 2}, sender.acked)
+
+	sender = newSender()
+	ackReceived(ctx, driver.FilesystemSelection{"pool/b"}, sender, receiver)
+	assert.Equal(t, map[string]uint64{"pool/b": 2}, sender.acked)
+
+	sender = newSender()
+	sender.unimplemented = true
+	ackReceived(ctx, nil, sender, receiver)
+	assert.Empty(t, sender.acked)
+}
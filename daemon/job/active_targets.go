@@ -0,0 +1,323 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication"
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// activeSideTarget is one of the receivers of a push job with `targets`.
+//
+// Each target replicates with its own job ID (see pushTargetJobID), and thus has its own
+// replication cursors, step holds and last-received holds, as well as its own replication
+// runs (including their retry state) and receiver pruning.
+// The targets share the job's snapper, filesystems, send options and bandwidth limiter.
+type activeSideTarget struct {
+	name      string
+	jobID     endpoint.JobID
+	mode      *modePush // snapper is nil, the job's mode does the snapshotting
+	connecter transport.Connecter
+
+	activeSideTasksState // prunerSender is always nil
+
+	pruneLock pruneLock // of the target's receiver
+
+	dryRunMtx    sync.Mutex
+	dryRunReport *report.AttemptReport // nil if no dry run was requested
+}
+
+type ActiveSideTargetStatus struct {
+	Name            string
+	Replication     *report.Report
+	DryRun          *report.AttemptReport
+	PruningReceiver *pruner.Report
+}
+
+// pushTargetJobID returns the job ID with which push job jobName replicates to its target targetName.
+func pushTargetJobID(jobName, targetName string) (endpoint.JobID, error) {
+	return endpoint.MakeJobID(fmt.Sprintf("%s_%s", jobName, targetName))
+}
+
+// pushStepHoldJobIDs returns the job IDs that replicate the snapshots of push job in,
+// i.e., the job IDs of its targets if it has `targets`.
+// New snapshots are step-held for each of them, as each releases only its own step holds.
+func pushStepHoldJobIDs(in *config.PushJob, jobID endpoint.JobID) ([]endpoint.JobID, error) {
+	if len(in.Targets) == 0 {
+		return []endpoint.JobID{jobID}, nil
+	}
+	ids := make([]endpoint.JobID, len(in.Targets))
+	for i, t := range in.Targets {
+		id, err := pushTargetJobID(in.Name, t.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid name of target %q", t.Name)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func pushTargetsFromConfig(g *config.Global, in *config.PushJob, m *modePush, metrics *transport.Metrics) ([]*activeSideTarget, error) {
+	targets := make([]*activeSideTarget, 0, len(in.Targets))
+	names := make(map[string]bool, len(in.Targets))
+	for i, t := range in.Targets {
+		if t.Name == "" {
+			return nil, errors.Errorf("field `targets[%d].name` must not be empty", i)
+		}
+		if names[t.Name] {
+			return nil, errors.Errorf("duplicate target name %q", t.Name)
+		}
+		names[t.Name] = true
+
+		target, err := pushTargetFromConfig(g, in, m, t, metrics)
+		if err != nil {
+			return nil, errors.Wrapf(err, "target %q", t.Name)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func pushTargetFromConfig(g *config.Global, in *config.PushJob, m *modePush, t *config.PushTarget, metrics *transport.Metrics) (*activeSideTarget, error) {
+	jobID, err := pushTargetJobID(in.Name, t.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid target name")
+	}
+	senderConfig, err := buildSenderConfig(in, jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "sender config")
+	}
+
+	policy := *m.plannerPolicy
+	if in.Replication.StepStateFile != "" {
+		// the persisted steps are specific to the receiver
+		policy.StepStateFile, err = logic.LoadStepStateFile(fmt.Sprintf("%s.%s", in.Replication.StepStateFile, t.Name))
+		if err != nil {
+			return nil, errors.Wrap(err, "field `replication.step_state_file`")
+		}
+	}
+
+	connecter, err := fromconfig.ConnecterFromConfig(g, t.Connect)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build client")
+	}
+	connectTimeouts, err := connectTimeoutsFromConfig(t.Connect)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `connect.timeouts`")
+	}
+
+	return &activeSideTarget{
+		name:  t.Name,
+		jobID: jobID,
+		mode: &modePush{
+			senderConfig:      senderConfig,
+			plannerPolicy:     &policy,
+			streamCompression: m.streamCompression,
+			connectTimeouts:   connectTimeouts,
+		},
+		connecter: metrics.Connecter(connecter, fromconfig.PeerFromConfig(t.Connect)),
+		pruneLock: newPruneLock(),
+	}, nil
+}
+
+func (t *activeSideTarget) status() *ActiveSideTargetStatus {
+	tasks := t.updateTasks(nil)
+	s := &ActiveSideTargetStatus{Name: t.name}
+	if tasks.replicationReport != nil {
+		s.Replication = tasks.replicationReport()
+	}
+	if tasks.prunerReceiver != nil {
+		s.PruningReceiver = tasks.prunerReceiver.Report()
+	}
+	t.dryRunMtx.Lock()
+	s.DryRun = t.dryRunReport
+	t.dryRunMtx.Unlock()
+	return s
+}
+
+// doTargets replicates to all targets concurrently, each followed by the target's receiver pruning.
+// The sender is pruned once all targets are done, see targetsHistory.
+func (j *ActiveSide) doTargets(ctx context.Context, selection driver.FilesystemSelection) {
+	push := j.mode.(*modePush)
+
+	j.updateTasks(func(tasks *activeSideTasks) {
+		*tasks = activeSideTasks{state: ActiveSideReplicating}
+	})
+
+	var failedMtx sync.Mutex
+	failed := 0 // sum of GetFailedFilesystemsCountInLatestAttempt, -1 if any target failed before enumerating the filesystems
+	_, add, wait := trace.WithTaskGroup(ctx, "targets")
+	for _, target := range j.targets {
+		target := target
+		add(func(ctx context.Context) {
+			ctx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("target-%s", target.name))
+			defer endSpan()
+			n := j.doTarget(ctx, target, selection)
+			failedMtx.Lock()
+			defer failedMtx.Unlock()
+			if n < 0 || failed < 0 {
+				failed = -1
+			} else {
+				failed += n
+			}
+		})
+	}
+	wait()
+	j.promReplicationErrors.Set(float64(failed))
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-stop.Wait(ctx):
+		return
+	default:
+	}
+	history := &targetsHistory{
+		sender: endpoint.NewSender(*push.senderConfig),
+		jobIDs: make([]endpoint.JobID, len(j.targets)),
+	}
+	for i := range j.targets {
+		history.jobIDs[i] = j.targets[i].jobID
+	}
+	if err := j.pruneLock.lock(ctx); err != nil {
+		return
+	}
+	defer j.pruneLock.unlock()
+	j.pruneSender(ctx, history.sender, history)
+
+	j.updateTasks(func(tasks *activeSideTasks) {
+		tasks.state = ActiveSideDone
+	})
+}
+
+// doTarget returns the number of filesystems that failed replication in the latest attempt.
+func (j *ActiveSide) doTarget(ctx context.Context, target *activeSideTarget, selection driver.FilesystemSelection) int {
+	ctx = hooks.WithEventTarget(ctx, target.name)
+	target.mode.ConnectEndpoints(ctx, target.connecter)
+	defer target.mode.DisconnectEndpoints()
+
+	sender, receiver := target.mode.SenderReceiver()
+
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-stop.Wait(ctx):
+		return 0
+	default:
+	}
+	replicationReport := j.replicate(ctx, &target.activeSideTasksState, target.mode.PlannerPolicy(), selection, sender, receiver)
+	failed := replicationReport.GetFailedFilesystemsCountInLatestAttempt()
+
+	select {
+	case <-ctx.Done():
+		return failed
+	case <-stop.Wait(ctx):
+		return failed
+	default:
+	}
+	if err := target.pruneLock.lock(ctx); err != nil {
+		return failed
+	}
+	defer target.pruneLock.unlock()
+	j.pruneReceiver(ctx, &target.activeSideTasksState, receiver, sender)
+
+	target.updateTasks(func(tasks *activeSideTasks) {
+		tasks.state = ActiveSideDone
+	})
+	return failed
+}
+
+func (j *ActiveSide) dryRunTargets(ctx context.Context) {
+	for _, target := range j.targets {
+		log := GetLogger(ctx).WithField("target", target.name)
+		log.Info("start replication dry run")
+		policy := target.mode.PlannerPolicy()
+		policy.StepStateFile = nil // a dry run must not alter the persisted steps
+		target.dryRunMtx.Lock()
+		target.dryRunReport = &report.AttemptReport{State: report.AttemptPlanning, StartAt: time.Now()}
+		target.dryRunMtx.Unlock()
+
+		sender, receiver, closeEndpoints := target.mode.DryRunEndpoints(ctx, target.connecter)
+		planner := logic.NewPlanner(nil, nil, sender, receiver, policy)
+		rep := replication.DryRun(ctx, planner)
+		closeEndpoints()
+
+		target.dryRunMtx.Lock()
+		target.dryRunReport = rep
+		target.dryRunMtx.Unlock()
+		log.WithField("state", rep.State).Info("replication dry run finished")
+	}
+}
+
+// pruneSidesTargets is pruneSides for push jobs with `targets`:
+// the sender, like doTargets, and then the receiver of each target.
+func (j *ActiveSide) pruneSidesTargets(ctx context.Context, prune pruneSide) []*PruneSide {
+	push := j.mode.(*modePush)
+	f := j.getPrunerFactory()
+
+	history := &targetsHistory{
+		sender: endpoint.NewSender(*push.senderConfig),
+		jobIDs: make([]endpoint.JobID, len(j.targets)),
+	}
+	for i := range j.targets {
+		history.jobIDs[i] = j.targets[i].jobID
+	}
+	sides := appendPruneSides(nil, prune(ctx, "sender", j.pruneLock, f.BuildSenderPruner(ctx, history.sender, history)))
+
+	for _, target := range j.targets {
+		sender, receiver, closeEndpoints := target.mode.DryRunEndpoints(ctx, target.connecter)
+		side := fmt.Sprintf("receiver (target %s)", target.name)
+		sides = appendPruneSides(sides, prune(ctx, side, target.pruneLock, f.BuildReceiverPruner(ctx, receiver, sender)))
+		closeEndpoints()
+	}
+	return sides
+}
+
+// targetsHistory is the pruner.History for the sender of a push job with `targets`.
+// Its replication cursor is the oldest of the targets' replication cursors,
+// so that keep rule `not_replicated` keeps the snapshots that were not yet replicated to all targets.
+type targetsHistory struct {
+	sender *endpoint.Sender // the job's sender, for listing filesystems
+	jobIDs []endpoint.JobID // of the targets
+}
+
+var _ pruner.History = (*targetsHistory)(nil)
+
+func (h *targetsHistory) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	return h.sender.ListFilesystems(ctx, req)
+}
+
+func (h *targetsHistory) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	var oldest *zfs.FilesystemVersion
+	for _, jobID := range h.jobIDs {
+		cursor, err := endpoint.GetMostRecentReplicationCursorOfJob(ctx, req.GetFilesystem(), jobID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get replication cursor of job id %q", jobID.String())
+		}
+		if cursor == nil {
+			// a target that never received the filesystem
+			return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Notexist{Notexist: true}}, nil
+		}
+		if oldest == nil || cursor.CreateTXG < oldest.CreateTXG {
+			oldest = cursor
+		}
+	}
+	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: oldest.Guid}}, nil
+}
@@ -1,13 +1,19 @@
 package job
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/driver"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/envconst"
 )
 
 func TestFakeActiveSideDirectMethodInvocationClientIdentityDoesNotPassValidityTest(t *testing.T) {
@@ -18,3 +24,77 @@ func TestFakeActiveSideDirectMethodInvocationClientIdentityDoesNotPassValidityTe
 	err = transport.ValidateClientIdentity(clientIdentity)
 	assert.Error(t, err)
 }
+
+func TestRetryPoliciesFromConfig(t *testing.T) {
+	unset := func() *config.ReplicationOptionsRetry {
+		return &config.ReplicationOptionsRetry{
+			Planning: &config.ReplicationRetryPolicy{Multiplier: 1},
+			Network:  &config.ReplicationRetryPolicy{Multiplier: 1},
+			ZFS:      &config.ReplicationRetryPolicy{Multiplier: 1},
+		}
+	}
+	defer envconst.Reset()
+
+	envconst.Reset()
+	assert.Equal(t, driver.DefaultRetryPolicies(), retryPoliciesFromConfig(unset()))
+
+	// the deprecated environment variables only apply to the fields that are not set
+	for _, v := range deprecatedReplicationEnvVars {
+		defer os.Unsetenv(v)
+	}
+	os.Setenv("ZREPL_REPLICATION_MAX_ATTEMPTS", "0")
+	os.Setenv("ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT", "1h")
+	os.Setenv("ZREPL_REPLICATION_TEMPORARY_ZFS_ERROR_RETRY_INTERVAL", "1m")
+	envconst.Reset()
+	p := retryPoliciesFromConfig(unset())
+	assert.Equal(t, driver.DefaultRetryPolicies().Planning, p.Planning)
+	assert.Equal(t, driver.RetryPolicy{MaxAttempts: 0, Multiplier: 1, GiveUpTimeout: time.Hour}, p.Network)
+	assert.Equal(t, driver.RetryPolicy{MaxAttempts: 0, InitialInterval: time.Minute, Multiplier: 1}, p.ZFS)
+
+	c := unset()
+	maxAttempts, interval := 5, 20*time.Second
+	c.ZFS.MaxAttempts, c.ZFS.InitialInterval = &maxAttempts, &interval
+	p = retryPoliciesFromConfig(c)
+	assert.Equal(t, driver.RetryPolicy{MaxAttempts: 5, InitialInterval: 20 * time.Second, Multiplier: 1}, p.ZFS)
+}
+
+func TestStepConcurrencyDeprecatedEnv(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  replication:
+    concurrency: %s
+`
+	build := func(concurrency string) *ActiveSide {
+		c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, concurrency)))
+		require.NoError(t, err)
+		jobs, err := JobsFromConfig(c)
+		require.NoError(t, err)
+		return jobs[0].(*ActiveSide)
+	}
+	defer envconst.Reset()
+	defer os.Unsetenv("ZREPL_REPLICATION_EXPERIMENTAL_REPLICATION_CONCURRENCY")
+
+	envconst.Reset()
+	assert.Equal(t, 1, build("{}").replicationDriverConfig.StepQueueConcurrency)
+
+	os.Setenv("ZREPL_REPLICATION_EXPERIMENTAL_REPLICATION_CONCURRENCY", "4")
+	envconst.Reset()
+	assert.Equal(t, 4, build("{}").replicationDriverConfig.StepQueueConcurrency)
+	assert.Equal(t, 2, build("{steps: 2}").replicationDriverConfig.StepQueueConcurrency)
+}
@@ -0,0 +1,49 @@
+// Package after connects the jobs that run after other jobs (config field `after`) with the daemon:
+// jobs report the outcome of their invocations, and the daemon triggers the jobs that run after them.
+package after
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	contextKeyTrigger contextKey = iota
+	contextKeyCompleted
+)
+
+// Wait returns the channel on which the job is triggered
+// because all jobs that it runs after completed successfully.
+func Wait(ctx context.Context) <-chan struct{} {
+	tc, ok := ctx.Value(contextKeyTrigger).(chan struct{})
+	if !ok {
+		tc = make(chan struct{})
+	}
+	return tc
+}
+
+// Completed reports the outcome of an invocation of the job, err is nil if it succeeded.
+func Completed(ctx context.Context, err error) {
+	if cf, ok := ctx.Value(contextKeyCompleted).(CompletedFunc); ok {
+		cf(err)
+	}
+}
+
+// CompletedFunc receives the outcomes that the job reports through Completed.
+type CompletedFunc func(err error)
+
+// TriggerFunc triggers the job. Triggers that the job did not pick up yet are coalesced.
+type TriggerFunc func()
+
+func Context(ctx context.Context, completed CompletedFunc) (context.Context, TriggerFunc) {
+	tc := make(chan struct{}, 1)
+	tf := func() {
+		select {
+		case tc <- struct{}{}:
+		default:
+		}
+	}
+	ctx = context.WithValue(ctx, contextKeyCompleted, completed)
+	return context.WithValue(ctx, contextKeyTrigger, tc), tf
+}
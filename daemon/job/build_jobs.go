@@ -2,27 +2,77 @@ package job
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
 )
 
 func JobsFromConfig(c *config.Config) ([]Job, error) {
+	if err := validateListenAddressesDoNotOverlap(c); err != nil {
+		return nil, err
+	}
+	if err := validateStepStateFilesAreUnique(c); err != nil {
+		return nil, err
+	}
+	sharedListeners, sharedCerts, err := sharedListenerFactoriesFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
 	js := make([]Job, len(c.Jobs))
 	for i := range c.Jobs {
-		j, err := buildJob(c.Global, c.Jobs[i])
+		var j Job
+		certs := transporttls.CollectCertificates(func() {
+			j, err = buildJob(c.Global, c.Jobs[i], sharedListeners[i])
+		})
 		if err != nil {
 			return nil, err
 		}
 		if j == nil || j.Name() == "" {
 			panic(fmt.Sprintf("implementation error: job builder returned nil job type %T", c.Jobs[i].Ret))
 		}
+		if cj, ok := j.(certificatesJob); ok {
+			cj.setCertificates(certs.Add(sharedCerts[i]))
+		}
 		js[i] = j
 	}
 
+	// receiving jobs protect the snapshots that their downstream jobs have not replicated yet
+	for i := range c.Jobs {
+		var names []string
+		var rc *endpoint.ReceiverConfig
+		switch v := c.Jobs[i].Ret.(type) {
+		case *config.SinkJob:
+			names, rc = v.DownstreamJobs, &js[i].(*PassiveSide).mode.(*modeSink).receiverConfig
+		case *config.PullJob:
+			names, rc = v.DownstreamJobs, &js[i].(*ActiveSide).mode.(*modePull).receiverConfig
+		case *config.LocalJob:
+			names, rc = v.DownstreamJobs, &js[i].(*ActiveSide).mode.(*modeLocal).receiverConfig
+		}
+		if len(names) == 0 {
+			continue
+		}
+		ds, err := downstreamJobsFromConfig(c, names)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build job %q: field `downstream_jobs`", c.Jobs[i].Name())
+		}
+		rc.Downstream = ds
+	}
+
+	if err := validateAfter(c); err != nil {
+		return nil, err
+	}
+	if err := validateHealthStaleAfter(c); err != nil {
+		return nil, err
+	}
+
 	// receiving-side root filesystems must not overlap
 	{
 		rfss := make([]string, 0, len(js))
@@ -38,22 +88,228 @@ func JobsFromConfig(c *config.Config) ([]Job, error) {
 		}
 	}
 
+	// the job IDs of push job targets must not be used by other jobs
+	{
+		ids := make(map[string]bool, len(js))
+		for _, j := range js {
+			ids[j.Name()] = true
+		}
+		for _, j := range js {
+			active, ok := j.(*ActiveSide)
+			if !ok {
+				continue
+			}
+			for _, t := range active.targets {
+				if ids[t.jobID.String()] {
+					return nil, fmt.Errorf("job %q: job id %q of target %q is already in use", j.Name(), t.jobID.String(), t.name)
+				}
+				ids[t.jobID.String()] = true
+			}
+		}
+	}
+
 	return js, nil
 }
 
-func buildJob(c *config.Global, in config.JobEnum) (j Job, err error) {
+// Returns the JobIDs of all jobs in c, i.e., the job IDs
+// that the endpoint abstractions (holds, bookmarks) of the configured jobs can have.
+func JobIDsFromConfig(c *config.Config) (map[endpoint.JobID]bool, error) {
+	ids := make(map[endpoint.JobID]bool, len(c.Jobs))
+	for _, j := range c.Jobs {
+		id, err := endpoint.MakeJobID(j.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid job name %q", j.Name())
+		}
+		ids[id] = true
+		if push, ok := j.Ret.(*config.PushJob); ok {
+			for _, t := range push.Targets {
+				id, err := pushTargetJobID(j.Name(), t.Name)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid target name %q of job %q", t.Name, j.Name())
+				}
+				ids[id] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// sharedListenerFactories are the listener factories of passive jobs that share their listener with other jobs,
+// indexed like c.Jobs, see fromconfig.SharedListenerFactoriesFromConfig.
+// certs are the certificates of the shared listeners, which each of its jobs uses.
+func sharedListenerFactoriesFromConfig(c *config.Config) (lfs []transport.AuthenticatedListenerFactory, certs []*transporttls.Certificates, err error) {
+	serves := make([]config.ServeEnum, len(c.Jobs))
+	for i, j := range c.Jobs {
+		switch v := j.Ret.(type) {
+		case *config.SinkJob:
+			serves[i] = v.Serve
+		case *config.SourceJob:
+			serves[i] = v.Serve
+		}
+	}
+	// build each shared listener on its own to tell which jobs use its certificates
+	groups := make(map[string][]int)
+	var order []string
+	for i, s := range serves {
+		if addr, ok := fromconfig.SharedListenAddress(s); ok {
+			if _, ok := groups[addr]; !ok {
+				order = append(order, addr)
+			}
+			groups[addr] = append(groups[addr], i)
+		}
+	}
+	lfs = make([]transport.AuthenticatedListenerFactory, len(c.Jobs))
+	certs = make([]*transporttls.Certificates, len(c.Jobs))
+	for _, addr := range order {
+		idxs := groups[addr]
+		if len(idxs) < 2 {
+			continue
+		}
+		group := make([]config.ServeEnum, len(serves))
+		for _, i := range idxs {
+			group[i] = serves[i]
+		}
+		var groupLFs []transport.AuthenticatedListenerFactory
+		groupCerts := transporttls.CollectCertificates(func() {
+			groupLFs, err = fromconfig.SharedListenerFactoriesFromConfig(c.Global, group)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, i := range idxs {
+			lfs[i], certs[i] = groupLFs[i], groupCerts
+		}
+	}
+	return lfs, certs, nil
+}
+
+// validateStepStateFilesAreUnique refuses jobs that persist their planned steps to the same file
+// (see field `replication.step_state_file`), as they would overwrite each other's steps.
+// A push job with `targets` uses one file per target, whose name has the target's name appended.
+func validateStepStateFilesAreUnique(c *config.Config) error {
+	used := make(map[string]string) // path => job name
+	for _, j := range c.Jobs {
+		var repl *config.Replication
+		var targets []*config.PushTarget
+		switch v := j.Ret.(type) {
+		case *config.PushJob:
+			repl, targets = v.Replication, v.Targets
+		case *config.PullJob:
+			repl = v.Replication
+		case *config.LocalJob:
+			repl = v.Replication
+		default:
+			continue
+		}
+		if repl == nil || repl.StepStateFile == "" {
+			continue
+		}
+		paths := []string{repl.StepStateFile}
+		if len(targets) > 0 {
+			paths = paths[:0]
+			for _, t := range targets {
+				paths = append(paths, fmt.Sprintf("%s.%s", repl.StepStateFile, t.Name))
+			}
+		}
+		for _, p := range paths {
+			p = filepath.Clean(p)
+			// duplicate target names are refused when the targets are built
+			if other, ok := used[p]; ok && other != j.Name() {
+				return fmt.Errorf("jobs %q and %q use the same step state file %q, each job needs its own", other, j.Name(), p)
+			}
+			used[p] = j.Name()
+		}
+	}
+	return nil
+}
+
+// validateListenAddressesDoNotOverlap refuses serve sections of passive jobs that listen on the same address
+// but do not share a listener, which would otherwise only fail once the daemon starts listening.
+func validateListenAddressesDoNotOverlap(c *config.Config) error {
+	type listen struct {
+		job, addr string
+		// serve sections with the same non-empty shared key share a listener, see fromconfig.SharedListenAddress
+		shared string
+	}
+	var listens []listen
+	for _, j := range c.Jobs {
+		var serve config.ServeEnum
+		switch v := j.Ret.(type) {
+		case *config.SinkJob:
+			serve = v.Serve
+		case *config.SourceJob:
+			serve = v.Serve
+		default:
+			continue
+		}
+		addrs, ok := fromconfig.ListenAddresses(serve)
+		if !ok {
+			continue
+		}
+		for i, addr := range addrs {
+			for _, other := range addrs[:i] {
+				if fromconfig.ListenAddressesOverlap(addr, other) {
+					return fmt.Errorf("job %q listens on overlapping addresses %q and %q", j.Name(), other, addr)
+				}
+			}
+		}
+		shared, _ := fromconfig.SharedListenAddress(serve)
+		for _, addr := range addrs {
+			for _, l := range listens {
+				if shared != "" && shared == l.shared || !fromconfig.ListenAddressesOverlap(addr, l.addr) {
+					continue
+				}
+				return fmt.Errorf("jobs %q and %q listen on overlapping addresses %q and %q: "+
+					"jobs can only share a listener if their serve sections are of type tcp or tls and have the same listen addresses",
+					l.job, j.Name(), l.addr, addr)
+			}
+		}
+		for _, addr := range addrs {
+			listens = append(listens, listen{j.Name(), addr, shared})
+		}
+	}
+	return nil
+}
+
+// SharedListenerGroups returns the names of the jobs in c that share a listener, by listen address.
+func SharedListenerGroups(c *config.Config) map[string][]string {
+	groups := make(map[string][]string)
+	for _, j := range c.Jobs {
+		var serve config.ServeEnum
+		switch v := j.Ret.(type) {
+		case *config.SinkJob:
+			serve = v.Serve
+		case *config.SourceJob:
+			serve = v.Serve
+		default:
+			continue
+		}
+		if addr, ok := fromconfig.SharedListenAddress(serve); ok {
+			groups[addr] = append(groups[addr], j.Name())
+		}
+	}
+	for addr, names := range groups {
+		if len(names) < 2 {
+			delete(groups, addr)
+		}
+	}
+	return groups
+}
+
+// sharedListener is nil unless in is a passive job that shares its listener with other jobs
+func buildJob(c *config.Global, in config.JobEnum, sharedListener transport.AuthenticatedListenerFactory) (j Job, err error) {
 	cannotBuildJob := func(e error, name string) (Job, error) {
 		return nil, errors.Wrapf(e, "cannot build job %q", name)
 	}
 	// FIXME prettify this
 	switch v := in.Ret.(type) {
 	case *config.SinkJob:
-		j, err = passiveSideFromConfig(c, &v.PassiveJob, v)
+		j, err = passiveSideFromConfig(c, &v.PassiveJob, v, sharedListener)
 		if err != nil {
 			return cannotBuildJob(err, v.Name)
 		}
 	case *config.SourceJob:
-		j, err = passiveSideFromConfig(c, &v.PassiveJob, v)
+		j, err = passiveSideFromConfig(c, &v.PassiveJob, v, sharedListener)
 		if err != nil {
 			return cannotBuildJob(err, v.Name)
 		}
@@ -72,6 +328,16 @@ func buildJob(c *config.Global, in config.JobEnum) (j Job, err error) {
 		if err != nil {
 			return cannotBuildJob(err, v.Name)
 		}
+	case *config.LocalJob:
+		j, err = activeSide(c, &v.ActiveJob, v)
+		if err != nil {
+			return cannotBuildJob(err, v.Name)
+		}
+	case *config.VerifyJob:
+		j, err = verifyJobFromConfig(c, v)
+		if err != nil {
+			return cannotBuildJob(err, v.Name)
+		}
 	default:
 		panic(fmt.Sprintf("implementation error: unknown job type %T", v))
 	}
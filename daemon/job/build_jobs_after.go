@@ -0,0 +1,125 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// AfterJob is implemented by the jobs that support field `after`.
+type AfterJob interface {
+	Job
+	// The names of the jobs whose successful invocations trigger the invocations of this job,
+	// see package after. Empty if the job triggers itself.
+	After() []string
+}
+
+var _ AfterJob = (*ActiveSide)(nil)
+var _ AfterJob = (*SnapJob)(nil)
+
+func afterFromConfig(j config.JobEnum) (after []string, ok bool) {
+	switch v := j.Ret.(type) {
+	case *config.PushJob:
+		return v.After, true
+	case *config.PullJob:
+		return v.After, true
+	case *config.LocalJob:
+		return v.After, true
+	case *config.SnapJob:
+		return v.After, true
+	default:
+		return nil, false
+	}
+}
+
+// validateAfter checks that the jobs in the `after` fields of c exist, support `after` themselves
+// (otherwise, they would not report their invocations) and do not form a cycle.
+func validateAfter(c *config.Config) error {
+	graph := make(map[string][]string, len(c.Jobs))
+	supported := make(map[string]bool, len(c.Jobs))
+	for _, j := range c.Jobs {
+		graph[j.Name()], supported[j.Name()] = afterFromConfig(j)
+	}
+
+	for _, j := range c.Jobs {
+		seen := make(map[string]bool, len(graph[j.Name()]))
+		for _, name := range graph[j.Name()] {
+			if seen[name] {
+				return fmt.Errorf("job %q: field `after`: duplicate job %q", j.Name(), name)
+			}
+			seen[name] = true
+			ok, exists := supported[name]
+			switch {
+			case name == j.Name():
+				return fmt.Errorf("job %q: field `after`: job cannot run after itself", j.Name())
+			case !exists:
+				return fmt.Errorf("job %q: field `after`: job %q does not exist", j.Name(), name)
+			case !ok:
+				return fmt.Errorf("job %q: field `after`: job %q must be a push, pull, local or snap job", j.Name(), name)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(c.Jobs))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					return fmt.Errorf("jobs cannot run after each other in a cycle: %s", strings.Join(append(path[i:], name), " after "))
+				}
+			}
+			panic("implementation error: visiting job is not on the path")
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range graph[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, j := range c.Jobs {
+		if err := visit(j.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateHealthStaleAfter checks that the jobs in field `global.control.http.health.stale_after`
+// exist and report their invocations, like the jobs in field `after`.
+func validateHealthStaleAfter(c *config.Config) error {
+	if c.Global == nil || c.Global.Control == nil || c.Global.Control.HTTP == nil {
+		return nil
+	}
+	supported := make(map[string]bool, len(c.Jobs))
+	for _, j := range c.Jobs {
+		_, supported[j.Name()] = afterFromConfig(j)
+	}
+	for name, d := range c.Global.Control.HTTP.Health.StaleAfter {
+		ok, exists := supported[name]
+		switch {
+		case !exists:
+			return fmt.Errorf("field `global.control.http.health.stale_after`: job %q does not exist", name)
+		case !ok:
+			return fmt.Errorf("field `global.control.http.health.stale_after`: job %q must be a push, pull, local or snap job", name)
+		case d <= 0:
+			return fmt.Errorf("field `global.control.http.health.stale_after`: duration of job %q must be positive", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package job
+
+import (
+	transporttls "github.com/zrepl/zrepl/transport/tls"
+)
+
+// CertificatesJob is implemented by the jobs that can use tls transports.
+type CertificatesJob interface {
+	Job
+	// The certificates loaded by the job's tls transports, nil if it has none.
+	// The caller registers them while Run is running so that they are reloaded, see transporttls.Certificates.
+	Certificates() *transporttls.Certificates
+}
+
+type certificatesJob interface {
+	CertificatesJob
+	setCertificates(c *transporttls.Certificates)
+}
+
+var _ certificatesJob = (*ActiveSide)(nil)
+var _ certificatesJob = (*PassiveSide)(nil)
+var _ certificatesJob = (*VerifyJob)(nil)
@@ -0,0 +1,78 @@
+package job
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+// downstreamJobsFromConfig resolves the `downstream_jobs` of a receiving job
+// to the job IDs and filesystems of the referenced push, local or source jobs in c.
+func downstreamJobsFromConfig(c *config.Config, names []string) ([]endpoint.DownstreamJob, error) {
+	jobs := make(map[string]config.JobEnum, len(c.Jobs))
+	for _, j := range c.Jobs {
+		jobs[j.Name()] = j
+	}
+
+	var ds []endpoint.DownstreamJob
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate downstream job %q", name)
+		}
+		seen[name] = true
+
+		j, ok := jobs[name]
+		if !ok {
+			return nil, fmt.Errorf("downstream job %q does not exist", name)
+		}
+		var filesystems config.FilesystemsFilter
+		var ids []endpoint.JobID
+		switch v := j.Ret.(type) {
+		case *config.PushJob:
+			filesystems = v.Filesystems
+			if len(v.Targets) == 0 {
+				id, err := endpoint.MakeJobID(v.Name)
+				if err != nil {
+					return nil, err
+				}
+				ids = append(ids, id)
+			}
+			for _, t := range v.Targets {
+				id, err := pushTargetJobID(v.Name, t.Name)
+				if err != nil {
+					return nil, err
+				}
+				ids = append(ids, id)
+			}
+		case *config.LocalJob:
+			filesystems = v.Filesystems
+			id, err := endpoint.MakeJobID(v.Name)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		case *config.SourceJob:
+			filesystems = v.Filesystems
+			id, err := endpoint.MakeJobID(v.Name)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		default:
+			return nil, fmt.Errorf("downstream job %q must be a push, local or source job, got %T", name, v)
+		}
+		fsf, err := filters.DatasetMapFilterFromConfig(filesystems)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build filesystem filter of downstream job %q", name)
+		}
+		for _, id := range ids {
+			ds = append(ds, endpoint.DownstreamJob{JobID: id, FSF: fsf})
+		}
+	}
+	return ds, nil
+}
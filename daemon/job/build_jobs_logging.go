@@ -0,0 +1,19 @@
+package job
+
+import (
+	"github.com/zrepl/zrepl/daemon/logging"
+)
+
+// LoggingJob is implemented by the jobs that support field `logging`.
+type LoggingJob interface {
+	Job
+	// The outlets that receive the log entries of this job in addition to the outlets of global.logging,
+	// nil if the job has none. The caller applies them to the context passed to Run and closes them
+	// once Run returned.
+	Logging() *logging.JobOutlets
+}
+
+var _ LoggingJob = (*ActiveSide)(nil)
+var _ LoggingJob = (*PassiveSide)(nil)
+var _ LoggingJob = (*SnapJob)(nil)
+var _ LoggingJob = (*VerifyJob)(nil)
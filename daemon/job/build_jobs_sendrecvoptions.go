@@ -21,10 +21,27 @@ func buildSenderConfig(in SendingJobConfig, jobID endpoint.JobID) (*endpoint.Sen
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
 
+	var properties, backupProperties bool
+	switch in.GetSendOptions().Properties {
+	case "true":
+		properties = true
+	case "backup":
+		backupProperties = true
+	case "false":
+	default:
+		return nil, errors.Errorf("invalid value for send.properties: %q (must be true, backup or false)", in.GetSendOptions().Properties)
+	}
+
 	return &endpoint.SenderConfig{
-		FSF:     fsf,
-		Encrypt: &zfs.NilBool{B: in.GetSendOptions().Encrypted},
-		JobID:   jobID,
+		FSF:              fsf,
+		Encrypt:          &zfs.NilBool{B: in.GetSendOptions().Encrypted},
+		Raw:              in.GetSendOptions().Raw,
+		Compressed:       in.GetSendOptions().Compressed,
+		EmbeddedData:     in.GetSendOptions().EmbeddedData,
+		LargeBlocks:      in.GetSendOptions().LargeBlocks,
+		Properties:       properties,
+		BackupProperties: backupProperties,
+		JobID:            jobID,
 	}, nil
 }
 
@@ -32,6 +49,7 @@ type ReceivingJobConfig interface {
 	GetRootFS() string
 	GetAppendClientIdentity() bool
 	GetRecvOptions() *config.RecvOptions
+	GetConflictResolution() *config.ConflictResolution // must not be nil
 }
 
 func buildReceiverConfig(in ReceivingJobConfig, jobID endpoint.JobID) (rc endpoint.ReceiverConfig, err error) {
@@ -47,6 +65,15 @@ func buildReceiverConfig(in ReceivingJobConfig, jobID endpoint.JobID) (rc endpoi
 		JobID:                      jobID,
 		RootWithoutClientComponent: rootFs,
 		AppendClientIdentity:       in.GetAppendClientIdentity(),
+		AllowRollback:              in.GetConflictResolution().ReceiverRollback,
+	}
+	if recvOpts := in.GetRecvOptions(); recvOpts != nil && recvOpts.Zvol != nil {
+		if recvOpts.Zvol.Volmode != "keep" {
+			rc.Zvol.Volmode = recvOpts.Zvol.Volmode
+		}
+		if recvOpts.Zvol.Refreservation != "keep" {
+			rc.Zvol.Refreservation = recvOpts.Zvol.Refreservation
+		}
 	}
 	if err := rc.Validate(); err != nil {
 		return rc, errors.Wrap(err, "cannot build receiver config")
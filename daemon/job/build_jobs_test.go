@@ -1,17 +1,23 @@
 package job
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/zfs"
 )
 
 func TestValidateReceivingSidesDoNotOverlap(t *testing.T) {
@@ -144,3 +150,1152 @@ func TestSampleConfigsAreBuiltWithoutErrors(t *testing.T) {
 	}
 
 }
+
+func TestPushJobTargets(t *testing.T) {
+	tmpl := `
+jobs:
+- name: push
+  type: push
+%s
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+%s
+`
+	connect := func(name string) string {
+		return fmt.Sprintf(`
+    connect:
+      type: local
+      listener_name: %s
+      client_identity: push`, name)
+	}
+	targets := func(names ...string) string {
+		s := "  targets:"
+		for _, n := range names {
+			s += fmt.Sprintf("\n  - name: %s", n) + connect(n)
+		}
+		return s
+	}
+
+	type Case struct {
+		name      string
+		job       string
+		otherJobs string
+		valid     bool
+		targetIDs []string
+	}
+	cases := []Case{
+		{name: "connect", job: "  connect:\n    type: local\n    listener_name: foo\n    client_identity: push", valid: true},
+		{name: "targets", job: targets("a", "b"), valid: true, targetIDs: []string{"push_a", "push_b"}},
+		{name: "neither", job: "", valid: false},
+		{name: "both", job: targets("a") + "\n  connect:\n    type: local\n    listener_name: foo\n    client_identity: push", valid: false},
+		{name: "duplicate target", job: targets("a", "a"), valid: false},
+		{name: "invalid target name", job: targets("a/b"), valid: false},
+		{
+			name: "target job id in use",
+			job:  targets("a"),
+			otherJobs: `
+- name: push_a
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10`,
+			valid: false,
+		},
+	}
+
+	for i := range cases {
+		t.Run(cases[i].name, func(t *testing.T) {
+			c := cases[i]
+
+			conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, c.job, c.otherJobs)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(conf)
+			if !c.valid {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			active := jobs[0].(*ActiveSide)
+			var ids []string
+			for _, target := range active.targets {
+				ids = append(ids, target.jobID.String())
+			}
+			assert.Equal(t, c.targetIDs, ids)
+
+			// each target releases only its own step holds, so new snapshots must be held for each target
+			var stepHoldIDs []string
+			for _, id := range active.mode.(*modePush).stepHoldJobIDs {
+				stepHoldIDs = append(stepHoldIDs, id.String())
+			}
+			if c.targetIDs != nil {
+				assert.Equal(t, c.targetIDs, stepHoldIDs)
+			} else {
+				assert.Equal(t, []string{"push"}, stepHoldIDs)
+			}
+
+			known, err := JobIDsFromConfig(conf)
+			require.NoError(t, err)
+			for _, id := range c.targetIDs {
+				assert.True(t, known[endpoint.MustMakeJobID(id)], id)
+			}
+		})
+	}
+}
+
+func TestSinkDownstreamJobs(t *testing.T) {
+	tmpl := `
+jobs:
+- name: sink
+  type: sink
+  root_fs: pool/sink
+  serve:
+    type: local
+    listener_name: sink
+  downstream_jobs: [%s]
+- name: push_c
+  type: push
+  filesystems: {"pool/sink<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+  targets:
+  - name: a
+    connect:
+      type: local
+      listener_name: a
+      client_identity: b
+  - name: b
+    connect:
+      type: local
+      listener_name: b
+      client_identity: b
+- name: source_c
+  type: source
+  filesystems: {"pool/sink<": true}
+  snapshotting:
+    type: manual
+  serve:
+    type: local
+    listener_name: source_c
+`
+	type Case struct {
+		downstream string
+		valid      bool
+		ids        []string
+	}
+	cases := []Case{
+		{downstream: "", valid: true},
+		{downstream: "push_c", valid: true, ids: []string{"push_c_a", "push_c_b"}},
+		{downstream: "source_c, push_c", valid: true, ids: []string{"source_c", "push_c_a", "push_c_b"}},
+		{downstream: "doesnotexist", valid: false},
+		{downstream: "sink", valid: false},
+		{downstream: "source_c, source_c", valid: false},
+	}
+	for i := range cases {
+		t.Run(cases[i].downstream, func(t *testing.T) {
+			c := cases[i]
+			conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, c.downstream)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(conf)
+			if !c.valid {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			rc := jobs[0].(*PassiveSide).mode.(*modeSink).receiverConfig
+			fs, err := zfs.NewDatasetPath("pool/sink/client/fs")
+			require.NoError(t, err)
+			var ids []string
+			for _, d := range rc.Downstream {
+				ids = append(ids, d.JobID.String())
+				pass, err := d.FSF.Filter(fs)
+				require.NoError(t, err)
+				assert.True(t, pass)
+			}
+			assert.Equal(t, c.ids, ids)
+		})
+	}
+}
+
+func TestSharedListener(t *testing.T) {
+	tmpl := `
+jobs:
+- name: sink_a
+  type: sink
+  root_fs: pool/a
+  serve:
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.1": "a", "10.1.0.0/24": "office-*"}
+- name: sink_b
+  type: sink
+  root_fs: pool/b
+  serve:
+%s
+`
+	cases := []struct {
+		name  string
+		serve string
+		valid bool
+	}{
+		{"disjoint_identities", `
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.2": "b"}`, true},
+		{"other_port", `
+    type: tcp
+    listen: ":8889"
+    clients: {"10.0.0.1": "a"}`, true},
+		{"duplicate_identity", `
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.2": "a"}`, false},
+		{"duplicate_client", `
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.1": "b"}`, false},
+		{"different_freebind", `
+    type: tcp
+    listen: ":8888"
+    listen_freebind: true
+    clients: {"10.0.0.2": "b"}`, false},
+		{"different_transport", `
+    type: tls
+    listen: ":8888"
+    ca: /etc/zrepl/ca.crt
+    cert: /etc/zrepl/prod.crt
+    key: /etc/zrepl/prod.key
+    client_cns: ["b"]`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, c.serve)))
+			require.NoError(t, err)
+			_, err = JobsFromConfig(conf)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSharedListenerAddresses(t *testing.T) {
+	tmpl := `
+jobs:
+- name: sink_a
+  type: sink
+  root_fs: pool/a
+  serve:
+    type: tcp
+    listen: ["10.0.0.1:8888", "[fd00::1]:8888"]
+    clients: {"10.0.0.1": "a"}
+- name: sink_b
+  type: sink
+  root_fs: pool/b
+  serve:
+%s
+`
+	cases := []struct {
+		name  string
+		serve string
+		valid bool
+	}{
+		{"same_addresses_other_order", `
+    type: tcp
+    listen: ["[fd00::1]:8888", "10.0.0.1:8888"]
+    clients: {"10.0.0.2": "b"}`, true},
+		{"partially_overlapping", `
+    type: tcp
+    listen: ["10.0.0.1:8888", "10.0.0.2:8888"]
+    clients: {"10.0.0.2": "b"}`, false},
+		{"wildcard", `
+    type: tcp
+    listen: ":8888"
+    clients: {"10.0.0.2": "b"}`, false},
+		{"ipv4_wildcard", `
+    type: tcp
+    listen: "0.0.0.0:8888"
+    clients: {"10.0.0.2": "b"}`, false},
+		{"other_host", `
+    type: tcp
+    listen: "10.0.0.2:8888"
+    clients: {"10.0.0.2": "b"}`, true},
+		{"overlapping_within_job", `
+    type: tcp
+    listen: [":8889", "10.0.0.1:8889"]
+    clients: {"10.0.0.2": "b"}`, false},
+		{"unshared_transport", `
+    type: ssh
+    listen: "10.0.0.1:8888"
+    host_key: /etc/zrepl/ssh_host_ed25519_key
+    clients:
+    - identity: b
+      public_key: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKnZ6oPVwrfUVTkl3KBAaUqKOkvQG8HCtCfT3LY1c0ij b"`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, c.serve)))
+			require.NoError(t, err)
+			err = validateListenAddressesDoNotOverlap(conf)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConnectTimeouts(t *testing.T) {
+	tmpl := `
+jobs:
+- name: pull
+  type: pull
+  root_fs: pool/backups
+  interval: manual
+  connect:
+    type: tcp
+    address: "10.0.0.1:8888"
+    timeouts:
+%s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	cases := []struct {
+		name     string
+		timeouts string
+		valid    bool
+	}{
+		{"defaults", `      {}`, true},
+		{"flaky_link", `
+      handshake: 1m
+      idle: 2m
+      send_keepalive: 8s`, true},
+		{"keepalive_not_less_than_server_idle", `
+      idle: 2m
+      send_keepalive: 10s`, false},
+		{"keepalive_not_less_than_idle", `
+      idle: 20s
+      send_keepalive: 20s`, false},
+		{"keepalive_too_frequent", `
+      send_keepalive: 1s`, false},
+		{"idle_less_than_server_keepalive", `
+      idle: 4s
+      send_keepalive: 3s`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, c.timeouts)))
+			require.NoError(t, err)
+			_, err = JobsFromConfig(conf)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateAfter(t *testing.T) {
+	job := func(name, typ string, after ...string) string {
+		s := fmt.Sprintf(`
+- name: %s
+  type: %s`, name, typ)
+		switch typ {
+		case "snap":
+			s += `
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10`
+		case "sink":
+			s += `
+  root_fs: zroot/sink
+  serve:
+    type: local
+    listener_name: sink`
+		}
+		if len(after) > 0 {
+			s += fmt.Sprintf("\n  after: [%s]", strings.Join(after, ", "))
+		}
+		return s
+	}
+	tcs := map[string]struct {
+		jobs []string
+		err  string
+	}{
+		"none":       {jobs: []string{job("a", "snap"), job("b", "snap")}},
+		"chain":      {jobs: []string{job("a", "snap", "b"), job("b", "snap", "c"), job("c", "snap")}},
+		"diamond":    {jobs: []string{job("a", "snap", "b", "c"), job("b", "snap", "d"), job("c", "snap", "d"), job("d", "snap")}},
+		"self":       {jobs: []string{job("a", "snap", "a")}, err: "cannot run after itself"},
+		"duplicate":  {jobs: []string{job("a", "snap", "b", "b"), job("b", "snap")}, err: "duplicate job"},
+		"not exists": {jobs: []string{job("a", "snap", "b")}, err: "does not exist"},
+		"sink":       {jobs: []string{job("a", "snap", "b"), job("b", "sink")}, err: "must be a push, pull, local or snap job"},
+		"cycle":      {jobs: []string{job("x", "snap"), job("a", "snap", "b"), job("b", "snap", "c"), job("c", "snap", "a")}, err: "a after b after c after a"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte("jobs:" + strings.Join(tc.jobs, "")))
+			require.NoError(t, err)
+			err = validateAfter(c)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestValidateStepStateFilesAreUnique(t *testing.T) {
+	job := func(name, typ, file string, targets ...string) string {
+		s := fmt.Sprintf(`
+- name: %s
+  type: %s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+  replication:
+    step_state_file: %s`, name, typ, file)
+		switch typ {
+		case "push":
+			s += `
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual`
+			if len(targets) == 0 {
+				s += `
+  connect:
+    type: local
+    listener_name: sink
+    client_identity: push`
+			} else {
+				s += "\n  targets:"
+				for _, tn := range targets {
+					s += fmt.Sprintf("\n  - name: %s\n    connect: {type: local, listener_name: %s, client_identity: push}", tn, tn)
+				}
+			}
+		case "pull":
+			s += `
+  root_fs: zroot/pull
+  interval: manual
+  connect:
+    type: local
+    listener_name: source
+    client_identity: pull`
+		}
+		return s
+	}
+	tcs := map[string]struct {
+		jobs []string
+		err  string
+	}{
+		"distinct":        {jobs: []string{job("a", "push", "/var/lib/zrepl/a"), job("b", "pull", "/var/lib/zrepl/b")}},
+		"same":            {jobs: []string{job("a", "push", "/var/lib/zrepl/steps"), job("b", "pull", "/var/lib/zrepl/steps")}, err: `jobs "a" and "b" use the same step state file`},
+		"same cleaned":    {jobs: []string{job("a", "push", "/var/lib/zrepl/steps"), job("b", "pull", "/var/lib/zrepl/../zrepl/steps")}, err: "the same step state file"},
+		"targets":         {jobs: []string{job("a", "push", "/var/lib/zrepl/steps", "x", "y"), job("b", "pull", "/var/lib/zrepl/steps")}},
+		"target conflict": {jobs: []string{job("a", "push", "/var/lib/zrepl/steps", "x"), job("b", "pull", "/var/lib/zrepl/steps.x")}, err: `"/var/lib/zrepl/steps.x"`},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte("jobs:" + strings.Join(tc.jobs, "")))
+			require.NoError(t, err)
+			err = validateStepStateFilesAreUnique(c)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestValidateHealthStaleAfter(t *testing.T) {
+	const jobs = `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+- name: sink
+  type: sink
+  root_fs: zroot/sink
+  serve:
+    type: local
+    listener_name: sink
+`
+	tcs := map[string]struct {
+		staleAfter string
+		err        string
+	}{
+		"none":       {staleAfter: "{}"},
+		"snap":       {staleAfter: "{snap: 25h}"},
+		"not exists": {staleAfter: "{push: 25h}", err: "does not exist"},
+		"sink":       {staleAfter: "{sink: 25h}", err: "must be a push, pull, local or snap job"},
+		"zero":       {staleAfter: "{snap: 0s}", err: "must be positive"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(`
+global:
+  control:
+    http:
+      listen: ':9811'
+      token_file: /etc/zrepl/control.token
+      health:
+        stale_after: %s
+%s`, tc.staleAfter, jobs)))
+			require.NoError(t, err)
+			err = validateHealthStaleAfter(c)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestJobLogging(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+  logging:
+%s
+`
+	tcs := map[string]struct {
+		logging string
+		err     string
+	}{
+		"file": {logging: `
+  - type: file
+    level: debug
+    format: json
+    path: /var/log/zrepl/snap.log`},
+		"file and syslog": {logging: `
+  - type: file
+    level: info
+    format: human
+    path: /var/log/zrepl/snap.log
+  - type: syslog
+    level: warn
+    format: logfmt
+    facility: local3`},
+		"relative path": {logging: `
+  - type: file
+    level: info
+    format: human
+    path: snap.log`, err: "absolute path"},
+		"tcp": {logging: `
+  - type: tcp
+    level: info
+    format: json
+    address: logserver.example.com:1234`, err: "only 'file' and 'syslog' outlets are supported"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.logging)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "field `logging`")
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.NotNil(t, jobs[0].(LoggingJob).Logging())
+		})
+	}
+}
+
+func TestLocalJob(t *testing.T) {
+	tmpl := `
+jobs:
+- name: local
+  type: local
+  filesystems: {%s}
+  root_fs: backup/zrepl
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+%s
+`
+	tcs := map[string]struct {
+		filesystems, extra string
+		err                string
+	}{
+		"valid":                {filesystems: `"zroot<": true`},
+		"filesystems match":    {filesystems: `"<": true`, err: "must not match root_fs"},
+		"filesystems excluded": {filesystems: `"<": true, "backup/zrepl<": false`},
+		// root_fs itself is excluded, but the filesystems received below it are not
+		"filesystems below root_fs":  {filesystems: `"<": true, "backup/zrepl": false`, err: "must not match root_fs"},
+		"filesystems inside root_fs": {filesystems: `"zroot<": true, "backup/zrepl/zroot<": true`, err: "must not match root_fs"},
+		"connect": {filesystems: `"zroot<": true`, extra: `  connect:
+    type: tcp
+    address: "10.0.0.1:8888"`, err: "field `connect` is not supported"},
+		"compression": {filesystems: `"zroot<": true`, extra: `  replication:
+    compression:
+      algorithm: zstd`, err: "field `replication.compression` is not supported"},
+		"downstream of sink": {filesystems: `"zroot<": true`, extra: `
+- name: sink
+  type: sink
+  root_fs: zroot/sink
+  downstream_jobs: [local]
+  serve:
+    type: local
+    listener_name: sink`},
+		"overlapping sink": {filesystems: `"zroot<": true`, extra: `
+- name: sink
+  type: sink
+  root_fs: backup/zrepl/sink
+  serve:
+    type: local
+    listener_name: sink`, err: "overlapping root filesystems"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.filesystems, tc.extra)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			j := jobs[0].(*ActiveSide)
+			assert.Equal(t, TypeLocal, j.mode.Type())
+			assert.Nil(t, j.connecter)
+			root, ok := j.OwnedDatasetSubtreeRoot()
+			require.True(t, ok)
+			assert.Equal(t, "backup/zrepl", root.ToString())
+			assert.NotNil(t, j.SenderConfig())
+		})
+	}
+}
+
+func TestSourceJobPruning(t *testing.T) {
+	tmpl := `
+jobs:
+- name: source
+  type: source
+  serve:
+    type: local
+    listener_name: source
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+%s
+`
+	tcs := map[string]struct {
+		pruning string
+		err     string
+	}{
+		"none": {},
+		"not_replicated": {pruning: `  pruning:
+    keep:
+    - type: not_replicated
+    - type: last_n
+      count: 10`},
+		"invalid rule": {pruning: `  pruning:
+    keep:
+    - type: last_n
+      count: 10
+      regex: "("`, err: "field `pruning`"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.pruning)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			m := jobs[0].(*PassiveSide).mode.(*modeSource)
+			assert.Equal(t, tc.pruning != "", m.prunerFactory != nil)
+		})
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	tmpl := `
+jobs:
+- name: pull
+  type: pull
+  connect:
+    type: tcp
+    address: "10.0.0.1:8888"
+  root_fs: backup/zrepl
+%s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: periodic
+    prefix: zrepl_
+    interval: 10m
+  triggers:
+  - type: filesystem_event
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+`
+	tcs := map[string]struct {
+		pull, err, triggers string
+	}{
+		"interval": {pull: `  interval: 10m`},
+		"triggers": {pull: `  triggers:
+  - type: cron
+    cron: "0,30 * * * 1-5"
+  - type: cron
+    cron: "0 * * * sat,sun"
+  - type: periodic
+    interval: 6h`, triggers: `cron "0,30 * * * 1-5", cron "0 * * * sat,sun", periodic 6h0m0s`},
+		"manual": {pull: `  triggers:
+  - type: manual`, triggers: "manual"},
+		"neither": {err: "exactly one of fields `interval` and `triggers` must be set"},
+		"both": {pull: `  interval: 10m
+  triggers:
+  - type: manual`, err: "exactly one of fields `interval` and `triggers` must be set"},
+		"manual and others": {pull: `  triggers:
+  - type: manual
+  - type: periodic
+    interval: 1h`, err: "type manual must be the only trigger"},
+		"invalid cron": {pull: `  triggers:
+  - type: cron
+    cron: "0 * *"`, err: "invalid cron expression"},
+		"filesystem_event": {pull: `  triggers:
+  - type: filesystem_event`, err: "requires the job's filesystems on this host"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.pull)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			pull := jobs[0].(*ActiveSide)
+			if tc.triggers == "" {
+				assert.Nil(t, pull.triggers)
+			} else if assert.NotNil(t, pull.triggers) {
+				assert.Equal(t, tc.triggers, pull.triggers.String())
+			}
+			assert.Equal(t, "filesystem_event (poll interval 1m0s)", jobs[1].(*SnapJob).triggers.String())
+		})
+	}
+}
+
+func TestSinkClientMapping(t *testing.T) {
+	tmpl := `
+jobs:
+- name: sink
+  type: sink
+  root_fs: pool/sink
+  serve:
+    type: local
+    listener_name: sink
+  client_mapping:
+%s
+`
+	tcs := map[string]struct {
+		mapping, err string
+	}{
+		"valid": {mapping: `  - client: db1
+    root_fs: pool/sink/db1/data
+    placeholder_properties:
+      canmount: "off"
+  - client: "web-*"
+    root_fs: pool/sink/web-${client}/${source_pool}
+    quota: 2T`},
+		"overlaps unmapped client": {mapping: `  - client: db1
+    root_fs: pool/sink/databases`, err: `overlaps the root_fs of client "databases"`},
+		"outside root_fs": {mapping: `  - client: db1
+    root_fs: pool/other/${client}`, err: "must be below root_fs"},
+		"pattern without client variable": {mapping: `  - client: "web-*"
+    root_fs: pool/sink/web`, err: "can match multiple clients"},
+		"quota on shared root": {mapping: `  - client: "*"
+    root_fs: pool/sink/${source_pool}/${client}
+    quota: 1T`, err: "quota requires"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.mapping)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			rc := jobs[0].(*PassiveSide).mode.(*modeSink).receiverConfig
+			require.Len(t, rc.ClientMappings, 2)
+			assert.Equal(t, "pool/sink/web-${client}/${source_pool}", rc.ClientMappings[1].RootTemplate)
+			assert.Equal(t, "2T", rc.ClientMappings[1].Quota)
+			assert.Equal(t, map[string]string{"canmount": "off"}, rc.ClientMappings[0].PlaceholderProperties)
+		})
+	}
+}
+
+func TestSnapshottingCron(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: cron
+    prefix: zrepl_
+%s
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+`
+	tcs := map[string]struct {
+		snapshotting, err string
+	}{
+		"local time":        {snapshotting: `    cron: "0 */4 * * *"`},
+		"time zone":         {snapshotting: "    cron: \"0 */4 * * *\"\n    time_zone: UTC"},
+		"invalid cron":      {snapshotting: `    cron: "0 */4 * *"`, err: "invalid cron expression"},
+		"invalid time zone": {snapshotting: "    cron: \"0 */4 * * *\"\n    time_zone: Nowhere/Special", err: "invalid time_zone"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, tc.snapshotting)))
+			require.NoError(t, err)
+			_, err = JobsFromConfig(c)
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSnapshottingRules(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"tank<": true}
+  snapshotting:
+    type: periodic
+    prefix: zrepl_
+    interval: 1h
+    rules:
+%s
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+`
+	c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, `    - regex: "^tank/db/"
+      interval: 5m
+      prefix: zrepl_db_
+    - regex: "^tank/media$"
+      interval: 24h`)))
+	require.NoError(t, err)
+	jobs, err := JobsFromConfig(c)
+	require.NoError(t, err)
+	r := jobs[0].(*SnapJob).snapper.Report()
+	require.NotNil(t, r)
+	assert.Equal(t, `no rule matches (every 1h0m0s, prefix "zrepl_")`, r.Rule)
+	var rules []string
+	for _, rr := range r.Rules {
+		rules = append(rules, rr.Rule)
+	}
+	assert.Equal(t, []string{
+		`regex "^tank/db/" (every 5m0s, prefix "zrepl_db_")`,
+		`regex "^tank/media$" (every 24h0m0s, prefix "zrepl_")`,
+	}, rules)
+
+	c, err = config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, `    - regex: "^tank/(db"
+      interval: 5m`)))
+	require.NoError(t, err)
+	_, err = JobsFromConfig(c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rule #1: invalid regex")
+	}
+}
+
+func TestSnapshottingNameTemplate(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"tank<": true}
+  snapshotting:
+    type: periodic
+    interval: 1h
+%s
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+`
+	snapshotNames := func(snapshotting string) ([]string, error) {
+		c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, snapshotting)))
+		require.NoError(t, err)
+		jobs, err := JobsFromConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return jobs[0].(*SnapJob).snapper.NameRegexes(), nil
+	}
+
+	regexes, err := snapshotNames(`    prefix: zrepl_`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`^zrepl_`}, regexes)
+
+	regexes, err = snapshotNames(`    name_template: 'zrepl_{{.Time.Format "2006-01-02_15:04"}}_{{.JobID}}'`)
+	require.NoError(t, err)
+	require.Len(t, regexes, 1)
+	re := regexp.MustCompile(regexes[0])
+	now := time.Date(2020, 3, 29, 1, 30, 0, 0, time.UTC)
+	assert.True(t, re.MatchString("zrepl_"+now.Format("2006-01-02_15:04")+"_snap"))
+	assert.False(t, re.MatchString("zrepl_"+now.Format("2006-01-02_15:04")+"_other"))
+	assert.False(t, re.MatchString("zrepl_20200329_013000_000"))
+	assert.False(t, re.MatchString("manual_"+now.Format("2006-01-02_15:04")+"_snap"))
+
+	regexes, err = snapshotNames(`    prefix: auto_
+    name_template: '{{.Prefix}}{{.Time.Local.Format "Mon_Jan__2_03.04.05.000pm_MST"}}'
+    rules:
+    - regex: "^tank/db/"
+      interval: 5m
+      prefix: db_`)
+	require.NoError(t, err)
+	require.Len(t, regexes, 2)
+	for i, prefix := range []string{"auto_", "db_"} {
+		re := regexp.MustCompile(regexes[i])
+		for _, loc := range []string{"UTC", "Europe/Berlin", "America/St_Johns"} {
+			l, err := time.LoadLocation(loc)
+			require.NoError(t, err)
+			name := prefix + now.In(l).Format("Mon_Jan__2_03.04.05.000pm_MST")
+			assert.True(t, re.MatchString(name), "%s %s", re, name)
+		}
+	}
+
+	for _, c := range []struct{ snapshotting, err string }{
+		{`    name_template: ""`, "prefix must not be empty"},
+		{`    name_template: 'zrepl_{{.JobID}}'`, "must contain {{.Time.Format"},
+		{`    name_template: 'zrepl_{{.Time.Unix}}'`, "unsupported action"},
+		{`    name_template: 'zrepl_{{if .JobID}}x{{end}}{{.Time.Format "2006"}}'`, "unsupported template element"},
+		{`    name_template: 'zrepl_{{.Time.Format "2006/01/02"}}'`, "invalid snapshot name"},
+		{`    name_template: 'zrepl_{{.Time.Format'`, "invalid name_template"},
+	} {
+		_, err := snapshotNames(c.snapshotting)
+		if assert.Error(t, err, c.snapshotting) {
+			assert.Contains(t, err.Error(), c.err, c.snapshotting)
+		}
+	}
+}
+
+func TestSnapshottingClasses(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"tank<": true}
+  snapshotting:
+    type: periodic
+%s
+  pruning:
+    keep:
+%s
+`
+	classes := `    classes:
+    - name: frequent
+      prefix: zrepl_frequent_
+      interval: 15m
+    - name: daily
+      prefix: zrepl_daily_
+      interval: 24h`
+	keep := `    - type: last_n
+      count: 4
+      class: frequent
+    - type: grid
+      grid: 7x1d
+      class: daily`
+	build := func(snapshotting, keep string) (*SnapJob, error) {
+		c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, snapshotting, keep)))
+		require.NoError(t, err)
+		jobs, err := JobsFromConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return jobs[0].(*SnapJob), nil
+	}
+
+	j, err := build(classes, keep)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"frequent": `^zrepl_frequent_`, "daily": `^zrepl_daily_`}, j.snapper.ClassNameRegexes())
+	report := j.snapper.Report()
+	require.Len(t, report.Rules, 1)
+	assert.Contains(t, report.Rule, `class "frequent"`)
+	assert.Contains(t, report.Rules[0].Rule, `class "daily"`)
+
+	j, err = build(`    prefix: zrepl_
+    interval: 1h`, `    - type: last_n
+      count: 4`)
+	require.NoError(t, err)
+	assert.Nil(t, j.snapper.ClassNameRegexes())
+
+	for _, c := range []struct{ snapshotting, keep, err string }{
+		{classes, "    - type: last_n\n      count: 4\n      class: hourly", `no snapshot class "hourly"`},
+		{classes, "    - type: last_n\n      count: 4\n      class: daily\n      regex: ^zrepl_", "mutually exclusive"},
+		{"    prefix: zrepl_\n    interval: 1h", "    - type: grid\n      grid: 7x1d\n      class: daily", `no snapshot class "daily"`},
+		{classes, "    - type: grid\n      grid: 7x1d", "one of `regex` and `class` is required"},
+		{classes, "    - type: gfs\n      daily: 7", "one of `regex` and `class` is required"},
+		{classes, "    - type: gfs\n      daily: 7\n      class: daily\n      regex: ^zrepl_", "mutually exclusive"},
+		{"    prefix: zrepl_\n" + classes, keep, "must be set per class"},
+		{classes + "\n    rules:\n    - regex: ^tank/db\n      interval: 5m", keep, "mutually exclusive"},
+		{classes + "\n    - name: daily\n      prefix: zrepl_d_\n      interval: 1h", keep, `duplicate class "daily"`},
+		{classes + "\n    - name: all\n      prefix: zrepl_\n      interval: 1h", keep, "overlap"},
+		{"    name_template: 'zrepl_{{.Time.Format \"2006-01-02_15:04\"}}'\n" + classes, keep, "overlap"},
+	} {
+		_, err := build(c.snapshotting, c.keep)
+		if assert.Error(t, err, c.snapshotting) {
+			assert.Contains(t, err.Error(), c.err, c.snapshotting)
+		}
+	}
+}
+
+func TestSnapshotNow(t *testing.T) {
+	tmpl := `
+jobs:
+- name: snap
+  type: snap
+  filesystems: {"tank<": true}
+  snapshotting:
+%s
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+- name: pull
+  type: pull
+  connect:
+    type: tcp
+    address: "server:8888"
+  root_fs: "pool/backup"
+  interval: 10m
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	build := func(snapshotting string) (*SnapJob, *ActiveSide) {
+		c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, snapshotting)))
+		require.NoError(t, err)
+		jobs, err := JobsFromConfig(c)
+		require.NoError(t, err)
+		return jobs[0].(*SnapJob), jobs[1].(*ActiveSide)
+	}
+
+	ctx := context.Background()
+	snap, pull := build("    type: manual")
+	assert.Error(t, snap.SnapshotNow(ctx, nil), "manual snapshotting without naming")
+	assert.Error(t, pull.SnapshotNow(ctx, nil))
+	assert.Nil(t, snap.snapper.Report())
+
+	snap, _ = build("    type: manual\n    prefix: zrepl_\n    skip_unchanged: true")
+	require.NoError(t, snap.SnapshotNow(ctx, nil))
+	assert.NoError(t, snap.snapper.Once(context.Background()), "manual snapshotting takes no snapshots on its own")
+	assert.Len(t, snap.snapper.NameRegexes(), 1, "the keep rules can refer to the snapshots")
+
+	c, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, "    type: manual\n    skip_unchanged: true")))
+	require.NoError(t, err)
+	_, err = JobsFromConfig(c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "require field `prefix` or `name_template`")
+	}
+
+	snap, _ = build("    type: periodic\n    prefix: zrepl_\n    interval: 10m")
+	require.NoError(t, snap.SnapshotNow(ctx, nil))
+	// the snapper does not run and thus does not serve the first request
+	err = snap.SnapshotNow(ctx, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already pending")
+	}
+}
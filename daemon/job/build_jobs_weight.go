@@ -0,0 +1,14 @@
+package job
+
+// WeightedJob is implemented by the jobs that support field `weight`.
+type WeightedJob interface {
+	Job
+	// How much of the daemon-wide budget each operation of this job consumes, see package scheduler.
+	// The caller applies it to the context passed to Run.
+	Weight() int
+}
+
+var _ WeightedJob = (*ActiveSide)(nil)
+var _ WeightedJob = (*PassiveSide)(nil)
+var _ WeightedJob = (*SnapJob)(nil)
+var _ WeightedJob = (*VerifyJob)(nil)
@@ -0,0 +1,36 @@
+package dryrun
+
+import (
+	"context"
+	"errors"
+)
+
+type contextKey int
+
+const contextKeyDryRun contextKey = iota
+
+func Wait(ctx context.Context) <-chan struct{} {
+	wc, ok := ctx.Value(contextKeyDryRun).(chan struct{})
+	if !ok {
+		wc = make(chan struct{})
+	}
+	return wc
+}
+
+type Func func() error
+
+var AlreadyRequested = errors.New("dry run already requested or in progress")
+
+func Context(ctx context.Context) (context.Context, Func) {
+	// buffered so that a request is not lost while the job is busy, e.g., replicating
+	wc := make(chan struct{}, 1)
+	drf := func() error {
+		select {
+		case wc <- struct{}{}:
+			return nil
+		default:
+			return AlreadyRequested
+		}
+	}
+	return context.WithValue(ctx, contextKeyDryRun, wc), drf
+}
@@ -0,0 +1,132 @@
+package job
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// failureBackoff defers the invocations of a job after failed invocations (field `failure_backoff`).
+// Triggers that arrive while the job backs off are coalesced into a single invocation at the end of the backoff.
+// A wakeup ends the backoff.
+type failureBackoff struct {
+	initial, max time.Duration // initial == 0 disables the backoff
+	multiplier   float64
+	jitter       float64
+	rnd          func() float64 // in [0, 1)
+
+	mtx       sync.Mutex
+	failures  int       // consecutive failed invocations
+	lastError string    // of the latest failed invocation
+	until     time.Time // zero if not backing off
+	deferred  bool      // a trigger arrived before until
+}
+
+func failureBackoffFromConfig(in *config.FailureBackoff) (*failureBackoff, error) {
+	if in.Multiplier < 1 {
+		return nil, fmt.Errorf("multiplier must be >= 1, got %v", in.Multiplier)
+	}
+	if in.Jitter < 0 || in.Jitter > 1 {
+		return nil, fmt.Errorf("jitter must be in [0, 1], got %v", in.Jitter)
+	}
+	if in.MaxInterval < in.InitialInterval {
+		return nil, fmt.Errorf("max interval must be >= initial interval")
+	}
+	return &failureBackoff{
+		initial:    in.InitialInterval,
+		max:        in.MaxInterval,
+		multiplier: in.Multiplier,
+		jitter:     in.Jitter,
+		rnd:        rand.Float64,
+	}, nil
+}
+
+// completed records the result of an invocation that completed at now.
+// It returns the status of the backoff that follows, nil if the job does not back off.
+func (b *failureBackoff) completed(err error, now time.Time) *FailureBackoffStatus {
+	b.mtx.Lock()
+	b.deferred = false
+	if err == nil || b.initial == 0 {
+		b.failures, b.lastError, b.until = 0, "", time.Time{}
+		b.mtx.Unlock()
+		return nil
+	}
+	b.failures++
+	b.lastError = err.Error()
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(b.failures-1))
+	if d > float64(b.max) {
+		d = float64(b.max)
+	}
+	d *= 1 + b.jitter*(2*b.rnd()-1)
+	b.until = now.Add(time.Duration(d))
+	b.mtx.Unlock()
+	return b.status(now)
+}
+
+// deferTrigger returns true if the job backs off at now, the trigger then runs at the end of the backoff.
+func (b *failureBackoff) deferTrigger(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !now.Before(b.until) {
+		return false
+	}
+	b.deferred = true
+	return true
+}
+
+// deferredTrigger returns a channel that fires at the end of the backoff if a trigger was deferred, nil otherwise.
+// The caller must call stop once it no longer waits for the channel.
+func (b *failureBackoff) deferredTrigger() (_ <-chan time.Time, stop func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.deferred {
+		return nil, func() {}
+	}
+	t := time.NewTimer(time.Until(b.until))
+	return t.C, func() { t.Stop() }
+}
+
+// end ends the backoff, e.g., on a wakeup. The count of consecutive failures is kept.
+func (b *failureBackoff) end() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.until, b.deferred = time.Time{}, false
+}
+
+type FailureBackoffStatus struct {
+	// consecutive failed invocations
+	Failures  int
+	LastError string
+	// the job is not invoked before Until, a wakeup invokes it immediately
+	Until time.Time
+	// a trigger arrived during the backoff, the job is invoked at Until
+	Deferred bool
+}
+
+// status returns nil if the job does not back off at now.
+func (b *failureBackoff) status(now time.Time) *FailureBackoffStatus {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !now.Before(b.until) {
+		return nil
+	}
+	return &FailureBackoffStatus{
+		Failures:  b.failures,
+		LastError: b.lastError,
+		Until:     b.until,
+		Deferred:  b.deferred,
+	}
+}
+
+// s is the result of failureBackoff.completed
+func logFailureBackoff(log Logger, s *FailureBackoffStatus) {
+	if s != nil {
+		log.WithField("failures", s.Failures).
+			WithField("until", s.Until.Format(time.RFC3339)).
+			Warn("invocation failed, deferring the next invocations")
+	}
+}
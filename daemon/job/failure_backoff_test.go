@@ -0,0 +1,68 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	b, err := failureBackoffFromConfig(&config.FailureBackoff{
+		InitialInterval: time.Minute,
+		Multiplier:      2,
+		MaxInterval:     5 * time.Minute,
+		Jitter:          0.1,
+	})
+	require.NoError(t, err)
+	b.rnd = func() float64 { return 0.5 } // no jitter
+
+	now := time.Now()
+	assert.Nil(t, b.completed(nil, now))
+	assert.False(t, b.deferTrigger(now))
+
+	var expect []time.Duration
+	for i := 0; i < 4; i++ {
+		s := b.completed(errors.New("peer down"), now)
+		require.NotNil(t, s)
+		assert.Equal(t, i+1, s.Failures)
+		assert.Equal(t, "peer down", s.LastError)
+		expect = append(expect, s.Until.Sub(now))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}, expect)
+
+	c, _ := b.deferredTrigger()
+	assert.Nil(t, c, "no trigger deferred yet")
+	assert.True(t, b.deferTrigger(now.Add(time.Minute)))
+	assert.True(t, b.status(now).Deferred)
+	assert.False(t, b.deferTrigger(now.Add(5*time.Minute)), "the backoff ended")
+	c, stop := b.deferredTrigger()
+	assert.NotNil(t, c)
+	stop()
+
+	b.end()
+	assert.Nil(t, b.status(now))
+	assert.False(t, b.deferTrigger(now))
+
+	// the jitter randomly increases or decreases the backoff
+	b.rnd = func() float64 { return 0 }
+	assert.Equal(t, 5*time.Minute*9/10, b.completed(errors.New("peer down"), now).Until.Sub(now))
+
+	// success resets the failures
+	assert.Nil(t, b.completed(nil, now))
+	assert.Equal(t, 1, b.completed(errors.New("peer down"), now).Failures)
+
+	disabled, err := failureBackoffFromConfig(&config.FailureBackoff{Multiplier: 2, MaxInterval: time.Hour})
+	require.NoError(t, err)
+	assert.Nil(t, disabled.completed(errors.New("peer down"), now))
+	assert.False(t, disabled.deferTrigger(now))
+
+	_, err = failureBackoffFromConfig(&config.FailureBackoff{InitialInterval: time.Minute, Multiplier: 0.5, MaxInterval: time.Hour})
+	assert.Error(t, err)
+	_, err = failureBackoffFromConfig(&config.FailureBackoff{InitialInterval: time.Hour, Multiplier: 2, MaxInterval: time.Minute})
+	assert.Error(t, err)
+}
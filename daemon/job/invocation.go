@@ -0,0 +1,92 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+// invocationErr returns the errors of the replication and pruning of the latest invocation, nil if it succeeded.
+func (j *ActiveSide) invocationErr() error {
+	var errs invocationErrors
+	j.addInvocationErrors(&errs)
+	return errs.err()
+}
+
+func (j *ActiveSide) addInvocationErrors(errs *invocationErrors) {
+	if len(j.targets) == 0 {
+		errs.addTasks("", j.updateTasks(nil))
+		return
+	}
+	errs.addPruner("pruning sender", j.updateTasks(nil).prunerSender)
+	for _, target := range j.targets {
+		errs.addTasks(fmt.Sprintf("target %q: ", target.name), target.updateTasks(nil))
+	}
+}
+
+// invocationErr returns the errors of the pruning of the latest invocation, nil if it succeeded.
+func (j *SnapJob) invocationErr() error {
+	var errs invocationErrors
+	j.addInvocationErrors(&errs)
+	return errs.err()
+}
+
+func (j *SnapJob) addInvocationErrors(errs *invocationErrors) {
+	errs.addPruner("pruning", j.pruner)
+}
+
+// invocationErrors collects the errors of an invocation for reporting them as a single error.
+type invocationErrors []string
+
+func (e *invocationErrors) add(what string, err error) {
+	if err != nil {
+		*e = append(*e, fmt.Sprintf("%s: %s", what, err))
+	}
+}
+
+// addTasks adds the errors of the replication and pruning in tasks, each prefixed with prefix.
+func (e *invocationErrors) addTasks(prefix string, tasks activeSideTasks) {
+	if tasks.replicationReport == nil {
+		*e = append(*e, prefix+"replication did not run")
+		return
+	}
+	rep := tasks.replicationReport()
+	switch failed := rep.GetFailedFilesystemsCountInLatestAttempt(); {
+	case failed < 0:
+		latest := rep.Attempts[len(rep.Attempts)-1]
+		*e = append(*e, fmt.Sprintf("%sreplication: %s", prefix, latest.PlanError))
+	case failed > 0:
+		*e = append(*e, fmt.Sprintf("%sreplication: %d filesystem(s) failed", prefix, failed))
+	}
+	if tasks.prunerSender != nil {
+		e.addPruner(prefix+"pruning sender", tasks.prunerSender)
+	}
+	e.addPruner(prefix+"pruning receiver", tasks.prunerReceiver)
+}
+
+// addPruner adds the errors of p, a nil p did not run.
+func (e *invocationErrors) addPruner(what string, p *pruner.Pruner) {
+	if p == nil {
+		*e = append(*e, what+": did not run")
+		return
+	}
+	rep := p.Report()
+	if rep.Error != "" {
+		*e = append(*e, fmt.Sprintf("%s: %s", what, rep.Error))
+	}
+	for _, fs := range append(rep.Pending, rep.Completed...) {
+		if fs.LastError != "" {
+			*e = append(*e, fmt.Sprintf("%s: %s: %s", what, fs.Filesystem, fs.LastError))
+		}
+	}
+}
+
+func (e invocationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(e, "\n"))
+}
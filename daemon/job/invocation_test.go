@@ -0,0 +1,63 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestInvocationErrors(t *testing.T) {
+	now := time.Now()
+	tasksWith := func(a *report.AttemptReport) activeSideTasks {
+		rep := &report.Report{Attempts: []*report.AttemptReport{a}}
+		return activeSideTasks{
+			replicationReport: func() *report.Report { return rep },
+			prunerSender:      &pruner.Pruner{},
+			prunerReceiver:    &pruner.Pruner{},
+		}
+	}
+	failedFS := &report.FilesystemReport{State: report.FilesystemSteppingErrored, StepError: report.NewTimedError("step failed", now)}
+
+	tcs := map[string]struct {
+		tasks  activeSideTasks
+		expect []string
+	}{
+		"success": {
+			tasks: tasksWith(&report.AttemptReport{State: report.AttemptDone}),
+		},
+		"not run": {
+			tasks:  activeSideTasks{},
+			expect: []string{"replication did not run"},
+		},
+		"planning error": {
+			tasks: tasksWith(&report.AttemptReport{
+				State:     report.AttemptPlanningError,
+				PlanError: report.NewTimedError("cannot connect", now),
+			}),
+			expect: []string{"replication: cannot connect"},
+		},
+		"failed filesystems, receiver not pruned": {
+			tasks: func() activeSideTasks {
+				t := tasksWith(&report.AttemptReport{
+					State:       report.AttemptFanOutError,
+					Filesystems: []*report.FilesystemReport{failedFS, {State: report.FilesystemDone}, failedFS},
+				})
+				t.prunerReceiver = nil
+				return t
+			}(),
+			expect: []string{"replication: 2 filesystem(s) failed", "pruning receiver: did not run"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var errs invocationErrors
+			errs.addTasks("", tc.tasks)
+			assert.Equal(t, invocationErrors(tc.expect), errs)
+			assert.Equal(t, len(tc.expect) > 0, errs.err() != nil)
+		})
+	}
+}
@@ -39,6 +39,8 @@ const (
 	TypeSink     Type = "sink"
 	TypePull     Type = "pull"
 	TypeSource   Type = "source"
+	TypeVerify   Type = "verify"
+	TypeLocal    Type = "local"
 )
 
 type Status struct {
@@ -87,6 +89,8 @@ func (s *Status) UnmarshalJSON(in []byte) (err error) {
 
 	case TypePull:
 		fallthrough
+	case TypeLocal:
+		fallthrough
 	case TypePush:
 		var st ActiveSideStatus
 		err = json.Unmarshal(jobJSON, &st)
@@ -99,6 +103,11 @@ func (s *Status) UnmarshalJSON(in []byte) (err error) {
 		err = json.Unmarshal(jobJSON, &st)
 		s.JobSpecific = &st
 
+	case TypeVerify:
+		var st VerifyJobStatus
+		err = json.Unmarshal(jobJSON, &st)
+		s.JobSpecific = &st
+
 	case TypeInternal:
 		// internal jobs do not report specifics
 	default:
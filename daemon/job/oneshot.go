@@ -0,0 +1,75 @@
+package job
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+// OneshotJob is implemented by the jobs that can run exactly once instead of
+// waiting for their triggers, e.g., for `zrepl oneshot`.
+type OneshotJob interface {
+	Job
+	// Once does what a single invocation of Run does, but snapshots first regardless of the
+	// snapshotting interval. It returns an error if any part of the invocation failed.
+	// Must not be used concurrently with Run.
+	Once(ctx context.Context) error
+}
+
+var _ OneshotJob = (*ActiveSide)(nil)
+var _ OneshotJob = (*SnapJob)(nil)
+
+// Once takes the snapshots of push and local jobs with periodic snapshotting, then replicates and prunes.
+// The snapshots of pull jobs are taken by the source job.
+func (j *ActiveSide) Once(ctx context.Context) error {
+	ctx, endTask := trace.WithTaskAndSpan(ctx, "active-side-job-once", j.Name())
+	defer endTask()
+	ctx = context.WithValue(ctx, endpoint.ClientIdentityKey, FakeActiveSideDirectMethodInvocationClientIdentity(j.name))
+	log := GetLogger(ctx)
+
+	var errs invocationErrors
+	var snap *snapper.PeriodicOrManual
+	switch m := j.mode.(type) {
+	case *modePush:
+		snap = m.snapper
+	case *modeLocal:
+		snap = m.snapper
+	}
+	if snap != nil {
+		log.Info("start snapshotting")
+		// replicate regardless, like Run does after snapshotting errors
+		errs.add("snapshotting", snap.Once(ctx))
+	}
+
+	j.do(ctx, nil)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if stop.Requested(ctx) {
+		return errors.New("stopped before replication and pruning completed")
+	}
+
+	j.addInvocationErrors(&errs)
+	return errs.err()
+}
+
+// Once takes snapshots, then prunes.
+func (j *SnapJob) Once(ctx context.Context) error {
+	ctx, endTask := trace.WithTaskAndSpan(ctx, "snap-job-once", j.Name())
+	defer endTask()
+
+	var errs invocationErrors
+	GetLogger(ctx).Info("start snapshotting")
+	errs.add("snapshotting", j.snapper.Once(ctx))
+	j.doPrune(ctx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	j.addInvocationErrors(&errs)
+	return errs.err()
+}
@@ -3,6 +3,7 @@ package job
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -10,19 +11,32 @@ import (
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/ready"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/scheduler"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/rpc"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
 	"github.com/zrepl/zrepl/zfs"
 )
 
 type PassiveSide struct {
-	mode   passiveMode
-	name   endpoint.JobID
-	listen transport.AuthenticatedListenerFactory
+	mode             passiveMode
+	name             endpoint.JobID
+	listen           transport.AuthenticatedListenerFactory
+	transportMetrics *transport.Metrics
+	logging          *logging.JobOutlets        // may be nil
+	weight           int                        // see package scheduler
+	certs            *transporttls.Certificates // see CertificatesJob
+	eventHooks       *hooks.EventHooks          // may be nil
 }
 
 type passiveMode interface {
@@ -34,12 +48,17 @@ type passiveMode interface {
 
 type modeSink struct {
 	receiverConfig endpoint.ReceiverConfig
+	stepHooks      logic.StepHooks // may be nil
 }
 
 func (m *modeSink) Type() Type { return TypeSink }
 
 func (m *modeSink) Handler() rpc.Handler {
-	return endpoint.NewReceiver(m.receiverConfig)
+	r := endpoint.NewReceiver(m.receiverConfig)
+	if m.stepHooks == nil {
+		return r
+	}
+	return &stepHooksHandler{Handler: r, hooks: m.stepHooks, localFilesystem: r.LocalFilesystem}
 }
 
 func (m *modeSink) RunPeriodic(_ context.Context)  {}
@@ -53,12 +72,47 @@ func modeSinkFromConfig(g *config.Global, in *config.SinkJob, jobID endpoint.Job
 		return nil, err
 	}
 
+	for _, c := range in.ClientMapping {
+		m.receiverConfig.ClientMappings = append(m.receiverConfig.ClientMappings, endpoint.ReceiverClientMapping{
+			Client:                c.Client,
+			RootTemplate:          c.RootFS,
+			Quota:                 c.Quota,
+			PlaceholderProperties: c.PlaceholderProperties,
+		})
+	}
+	if err := m.receiverConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "field `client_mapping`")
+	}
+
+	if m.stepHooks, err = stepHooksFromConfig(in.Hooks.Step); err != nil {
+		return nil, errors.Wrap(err, "field `hooks.step`")
+	}
+
 	return m, nil
 }
 
 type modeSource struct {
 	senderConfig *endpoint.SenderConfig
 	snapper      *snapper.PeriodicOrManual
+	stepHooks    logic.StepHooks // may be nil
+
+	// nil unless field `pruning` is set
+	prunerFactoryMtx sync.Mutex
+	prunerFactory    *pruner.LocalPrunerFactory // replaced by Reconfigure
+
+	promPruneSecs *prometheus.HistogramVec // labels: prune_side
+	prunerMtx     sync.Mutex
+	pruner        *pruner.Pruner // the most recent one
+	pruneDryRuns  *pruneDryRuns  // nil unless field `pruning` is set
+}
+
+// sourceStepHolds returns the step holds for the new snapshots of a source job.
+// With proxied step holds, each pull client releases only its own holds, so they are put for each client.
+func sourceStepHolds(senderConfig *endpoint.SenderConfig) endpoint.NewSnapshotStepHolds {
+	return endpoint.NewSnapshotStepHolds{
+		JobIDs:  []endpoint.JobID{senderConfig.JobID},
+		Proxied: senderConfig.ProxiedStepHolds,
+	}
 }
 
 func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint.JobID) (m *modeSource, err error) {
@@ -69,29 +123,131 @@ func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint
 	if err != nil {
 		return nil, errors.Wrap(err, "send options")
 	}
+	m.senderConfig.ProxiedStepHolds = in.ProxiedStepHolds
+
+	if m.stepHooks, err = stepHooksFromConfig(in.Hooks.Step); err != nil {
+		return nil, errors.Wrap(err, "field `hooks.step`")
+	}
 
-	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting); err != nil {
+	if m.snapper, err = snapper.FromConfig(g, m.senderConfig.FSF, in.Snapshotting, jobID, sourceStepHolds(m.senderConfig)); err != nil {
 		return nil, errors.Wrap(err, "cannot build snapper")
 	}
 
+	if in.Pruning != nil {
+		m.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "pruning",
+			Name:        "time",
+			Help:        "seconds spent in pruner",
+			ConstLabels: prometheus.Labels{"zrepl_job": jobID.String()},
+		}, []string{"prune_side"})
+		if m.prunerFactory, err = pruner.NewSourcePrunerFactory(*in.Pruning, m.snapper.ClassNameRegexes(), m.promPruneSecs); err != nil {
+			return nil, errors.Wrap(err, "field `pruning`")
+		}
+		m.pruneDryRuns = newPruneDryRuns()
+	}
+
 	return m, nil
 }
 
 func (m *modeSource) Type() Type { return TypeSource }
 
 func (m *modeSource) Handler() rpc.Handler {
-	return endpoint.NewSender(*m.senderConfig)
+	s := endpoint.NewSender(*m.senderConfig)
+	if m.stepHooks == nil {
+		return s
+	}
+	return &stepHooksHandler{Handler: s, hooks: m.stepHooks, localFilesystem: func(_ context.Context, fs string) (*zfs.DatasetPath, error) {
+		return zfs.NewDatasetPath(fs)
+	}}
 }
 
 func (m *modeSource) RunPeriodic(ctx context.Context) {
-	m.snapper.Run(ctx, nil)
+	m.prunerFactoryMtx.Lock()
+	prunes := m.prunerFactory != nil
+	m.prunerFactoryMtx.Unlock()
+	if !prunes {
+		m.snapper.Run(ctx, nil)
+		return
+	}
+
+	snapshotsTaken := make(chan struct{})
+	snapperCtx, endTask := trace.WithTask(ctx, "snapshotting") // runs concurrently with the pruning spans
+	snapperReturned := make(chan struct{})
+	go func() {
+		defer close(snapperReturned)
+		m.snapper.Run(snapperCtx, snapshotsTaken)
+	}()
+	defer func() {
+		<-snapperReturned // ctx is done
+		endTask()
+	}()
+	pruneDryRunCtx, endTask := trace.WithTask(ctx, "prune-dry-runs")
+	pruneDryRunsReturned := make(chan struct{})
+	go func() {
+		defer close(pruneDryRunsReturned)
+		m.pruneDryRuns.run(pruneDryRunCtx, m.planPruning)
+	}()
+	defer func() {
+		<-pruneDryRunsReturned // ctx is done
+		endTask()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wakeup.Wait(ctx):
+		case <-snapshotsTaken:
+		}
+		m.prune(ctx)
+	}
+}
+
+// prune prunes the snapshots of the source job on its own side, like a snap job.
+// Keep rule `not_replicated` uses the replication cursor that the pull jobs move
+// (see endpoint.Sender.AckReceived and SendCompleted).
+func (m *modeSource) prune(ctx context.Context) {
+	ctx, endSpan := trace.WithSpan(ctx, "source-job-do-prune")
+	defer endSpan()
+	log := GetLogger(ctx)
+
+	p := m.buildPruner(ctx)
+	m.prunerMtx.Lock()
+	m.pruner = p
+	m.prunerMtx.Unlock()
+	log.Info("start pruning")
+	p.Prune()
+	log.Info("finished pruning")
+}
+
+func (m *modeSource) buildPruner(ctx context.Context) *pruner.Pruner {
+	sender := endpoint.NewSender(*m.senderConfig)
+	m.prunerFactoryMtx.Lock()
+	prunerFactory := m.prunerFactory
+	m.prunerFactoryMtx.Unlock()
+	return prunerFactory.BuildLocalPruner(ctx, sender, sender)
+}
+
+func (m *modeSource) planPruning(ctx context.Context) []*PruneSide {
+	return []*PruneSide{dryRunPruner("local", m.buildPruner(ctx))}
 }
 
 func (m *modeSource) SnapperReport() *snapper.Report {
 	return m.snapper.Report()
 }
 
-func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob interface{}) (s *PassiveSide, err error) {
+// PrunerReport returns nil unless the source job prunes and pruned at least once.
+func (m *modeSource) PrunerReport() *pruner.Report {
+	m.prunerMtx.Lock()
+	defer m.prunerMtx.Unlock()
+	if m.pruner == nil {
+		return nil
+	}
+	return m.pruner.Report()
+}
+
+// sharedListener is used instead of the listener of in.Serve if not nil
+func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob interface{}, sharedListener transport.AuthenticatedListenerFactory) (s *PassiveSide, err error) {
 
 	s = &PassiveSide{}
 
@@ -99,34 +255,68 @@ func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob in
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid job name")
 	}
+	if s.logging, err = logging.JobOutletsFromConfig(in.Logging); err != nil {
+		return nil, errors.Wrap(err, "field `logging`")
+	}
+	s.weight = in.Weight
 
+	var events []hooks.Event // sink jobs emit no events
 	switch v := configJob.(type) {
 	case *config.SinkJob:
 		s.mode, err = modeSinkFromConfig(g, v, s.name) // shadow
 	case *config.SourceJob:
 		s.mode, err = modeSourceFromConfig(g, v, s.name) // shadow
+		events = append(events, hooks.EventSnapshottingCompleted)
+		if v.Pruning != nil {
+			events = append(events, hooks.EventPruningCompleted)
+		}
 	}
 	if err != nil {
 		return nil, err // no wrapping necessary
 	}
+	if s.eventHooks, err = hooks.EventHooksFromConfig(s.name.String(), in.EventHooks, events...); err != nil {
+		return nil, errors.Wrap(err, "field `event_hooks`")
+	}
 
-	if s.listen, err = fromconfig.ListenerFactoryFromConfig(g, in.Serve); err != nil {
+	if sharedListener != nil {
+		s.listen = sharedListener
+	} else if s.listen, err = fromconfig.ListenerFactoryFromConfig(g, in.Serve); err != nil {
 		return nil, errors.Wrap(err, "cannot build listener factory")
 	}
+	s.transportMetrics = transport.NewMetrics(s.name.String())
+	s.listen = s.transportMetrics.ListenerFactory(s.listen)
 
 	return s, nil
 }
 
 func (j *PassiveSide) Name() string { return j.name.String() }
 
+func (j *PassiveSide) Logging() *logging.JobOutlets { return j.logging }
+
+func (j *PassiveSide) Weight() int { return j.weight }
+
+func (j *PassiveSide) Certificates() *transporttls.Certificates { return j.certs }
+
+func (j *PassiveSide) setCertificates(c *transporttls.Certificates) { j.certs = c }
+
 type PassiveStatus struct {
 	Snapper *snapper.Report
+	// only source jobs with field `pruning`, nil until the first pruning
+	Pruning *pruner.Report `json:",omitempty"`
+	// only source jobs with field `pruning`, see ActiveSideStatus.PruneDryRun
+	PruneDryRun *PruneDryRunReport `json:",omitempty"`
 }
 
 func (s *PassiveSide) Status() *Status {
 	st := &PassiveStatus{
 		Snapper: s.mode.SnapperReport(),
 	}
+	if source, ok := s.mode.(*modeSource); ok {
+		st.Pruning = source.PrunerReport()
+		if source.pruneDryRuns != nil {
+			st.PruneDryRun = source.pruneDryRuns.status()
+		}
+	}
 	return &Status{Type: s.mode.Type(), JobSpecific: st}
 }
 
@@ -148,30 +338,64 @@ func (j *PassiveSide) SenderConfig() *endpoint.SenderConfig {
 	return source.senderConfig
 }
 
-func (*PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {}
+// SnapshotNow makes the job take snapshots right away, see snapper.Snapper.SnapshotNow.
+func (j *PassiveSide) SnapshotNow(ctx context.Context, selection func(fs string) bool) error {
+	source, ok := j.mode.(*modeSource)
+	if !ok {
+		return errors.New("sink jobs do not snapshot")
+	}
+	return source.snapper.SnapshotNow(ctx, selection)
+}
+
+// PruneDryRun makes a source job with field `pruning` plan its pruning without destroying snapshots.
+// The result is reported in PassiveStatus.PruneDryRun.
+func (j *PassiveSide) PruneDryRun() error {
+	source, ok := j.mode.(*modeSource)
+	if !ok || source.pruneDryRuns == nil {
+		return errors.New("job does not prune")
+	}
+	return source.pruneDryRuns.request()
+}
+
+func (j *PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {
+	j.transportMetrics.Register(registerer)
+	if source, ok := j.mode.(*modeSource); ok && source.promPruneSecs != nil {
+		registerer.MustRegister(source.promPruneSecs)
+	}
+}
 
 func (j *PassiveSide) Run(ctx context.Context) {
 	ctx, endTask := trace.WithTaskAndSpan(ctx, "passive-side-job", j.Name())
 	defer endTask()
+	ctx = hooks.WithEventHooks(ctx, j.eventHooks)
 	log := GetLogger(ctx)
 	defer log.Info("job exiting")
 	{
 		ctx, endTask := trace.WithTask(ctx, "periodic") // shadowing
 		defer endTask()
 		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		go j.mode.RunPeriodic(ctx)
+		periodicReturned := make(chan struct{})
+		go func() {
+			defer close(periodicReturned)
+			j.mode.RunPeriodic(ctx)
+		}()
+		defer func() {
+			cancel()
+			<-periodicReturned // its tasks, e.g., those of the snapper, must end before the periodic task
+		}()
 	}
 
-	handler := j.mode.Handler()
-	if handler == nil {
+	modeHandler := j.mode.Handler()
+	if modeHandler == nil {
 		panic(fmt.Sprintf("implementation error: j.mode.Handler() returned nil: %#v", j))
 	}
+	handler := newDrainHandler(modeHandler)
 
 	ctxInterceptor := func(handlerCtx context.Context, info rpc.HandlerContextInterceptorData, handler func(ctx context.Context)) {
 		// the handlerCtx is clean => need to inherit logging and tracing config from job context
 		handlerCtx = logging.WithInherit(handlerCtx, ctx)
 		handlerCtx = trace.WithInherit(handlerCtx, ctx)
+		handlerCtx = scheduler.WithInherit(handlerCtx, ctx)
 
 		handlerCtx, endTask := trace.WithTaskAndSpan(handlerCtx, "handler", fmt.Sprintf("job=%q client=%q method=%q", j.Name(), info.ClientIdentity(), info.FullMethod()))
 		defer endTask()
@@ -186,6 +410,25 @@ func (j *PassiveSide) Run(ctx context.Context) {
 		log.WithError(err).Error("cannot listen")
 		return
 	}
-
+	ready.Ready(ctx)
+
+	// a stop lets the replication steps that are executing finish,
+	// the active side retries the steps that the handler refuses meanwhile and the connections that the cancellation interrupts
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop.Wait(ctx):
+			log.Info("stop requested, waiting for the replication steps that are executing")
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-handler.drain():
+			log.Info("replication steps finished")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 	server.Serve(ctx, listener)
 }
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+)
+
+var errPassiveSideDraining = errors.New("job is stopping, it does not start new replication steps")
+
+// drainHandler keeps track of the replication steps, i.e., the Send and Receive requests, that a passive job serves.
+// Once drain was called, it refuses new steps so that the job can stop after the executing ones finished.
+// The active side retries the refused steps like those that fail for other reasons.
+type drainHandler struct {
+	rpc.Handler
+
+	mtx      sync.Mutex
+	steps    int
+	draining bool
+	idle     chan struct{} // closed once draining and steps == 0
+}
+
+func newDrainHandler(h rpc.Handler) *drainHandler {
+	return &drainHandler{Handler: h, idle: make(chan struct{})}
+}
+
+// drain refuses new steps and returns a channel that is closed once the executing steps finished.
+func (h *drainHandler) drain() <-chan struct{} {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if !h.draining {
+		h.draining = true
+		if h.steps == 0 {
+			close(h.idle)
+		}
+	}
+	return h.idle
+}
+
+func (h *drainHandler) beginStep() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.draining {
+		return errPassiveSideDraining
+	}
+	h.steps++
+	return nil
+}
+
+func (h *drainHandler) endStep() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.steps--
+	if h.draining && h.steps == 0 {
+		close(h.idle)
+	}
+}
+
+func (h *drainHandler) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	if err := h.beginStep(); err != nil {
+		receive.Close()
+		return nil, err
+	}
+	defer h.endStep()
+	return h.Handler.Receive(ctx, req, receive)
+}
+
+// Send's step ends when the server closes the stream, i.e., once it was transferred.
+func (h *drainHandler) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	if req.GetDryRun() {
+		return h.Handler.Send(ctx, req)
+	}
+	if err := h.beginStep(); err != nil {
+		return nil, nil, err
+	}
+	res, stream, err := h.Handler.Send(ctx, req)
+	if err != nil || stream == nil {
+		h.endStep()
+		return res, stream, err
+	}
+	return res, &drainStream{ReadCloser: stream, h: h}, nil
+}
+
+type drainStream struct {
+	io.ReadCloser
+	h    *drainHandler
+	once sync.Once
+}
+
+func (s *drainStream) Close() error {
+	err := s.ReadCloser.Close()
+	s.once.Do(s.h.endStep)
+	return err
+}
@@ -0,0 +1,78 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// blockingReceiveHandler receives until release is closed
+type blockingReceiveHandler struct {
+	fakeStepHandler
+	receiving chan struct{}
+	release   chan struct{}
+}
+
+func (b *blockingReceiveHandler) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	close(b.receiving)
+	<-b.release
+	return b.fakeStepHandler.Receive(ctx, req, receive)
+}
+
+func TestDrainHandler(t *testing.T) {
+	ctx := context.Background()
+	inner := &blockingReceiveHandler{receiving: make(chan struct{}), release: make(chan struct{})}
+	h := newDrainHandler(inner)
+
+	received := make(chan error)
+	go func() {
+		_, err := h.Receive(ctx, &pdu.ReceiveReq{}, ioutil.NopCloser(bytes.NewReader([]byte("stream"))))
+		received <- err
+	}()
+	<-inner.receiving
+	idle := h.drain()
+	select {
+	case <-idle:
+		t.Fatal("drain must wait for the executing step")
+	default:
+	}
+
+	// new steps are refused
+	stream := &closeRecorder{Reader: bytes.NewReader(nil)}
+	_, err := h.Receive(ctx, &pdu.ReceiveReq{}, stream)
+	assert.Equal(t, errPassiveSideDraining, err)
+	assert.True(t, stream.closed)
+	_, _, err = h.Send(ctx, &pdu.SendReq{})
+	assert.Equal(t, errPassiveSideDraining, err)
+	// size estimates are no steps
+	res, _, err := h.Send(ctx, &pdu.SendReq{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(23), res.GetExpectedSize())
+
+	close(inner.release)
+	require.NoError(t, <-received)
+	<-idle
+	assert.Equal(t, idle, h.drain())
+}
+
+func TestDrainHandlerSend(t *testing.T) {
+	h := newDrainHandler(&fakeStepHandler{stream: []byte("snapshot")})
+	_, stream, err := h.Send(context.Background(), &pdu.SendReq{})
+	require.NoError(t, err)
+	idle := h.drain()
+	select {
+	case <-idle:
+		t.Fatal("the step of a send ends when its stream is closed")
+	default:
+	}
+	require.NoError(t, stream.Close())
+	require.NoError(t, stream.Close())
+	<-idle
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+// pruneDryRuns plans the pruning of a job whenever requested through request, independent of
+// the job's pruning. Requests that arrive while a dry run is in progress are rejected.
+type pruneDryRuns struct {
+	requests chan struct{}
+
+	mtx    sync.Mutex
+	report *PruneDryRunReport // nil if no dry run was requested
+}
+
+// The result of the most recent `zrepl prune --dry-run`.
+type PruneDryRunReport struct {
+	StartAt, DoneAt time.Time // DoneAt is zero while the dry run is in progress
+	Sides           []*PruneSide
+}
+
+func (r *PruneDryRunReport) Done() bool { return !r.DoneAt.IsZero() }
+
+type PruneSide struct {
+	Side   string // e.g., "sender", or "receiver (target offsite)" for push jobs with `targets`
+	Report *pruner.Report
+}
+
+var PruneDryRunAlreadyRequested = errors.New("prune dry run already requested or in progress")
+
+func newPruneDryRuns() *pruneDryRuns {
+	return &pruneDryRuns{requests: make(chan struct{})}
+}
+
+func (d *pruneDryRuns) request() error {
+	select {
+	case d.requests <- struct{}{}:
+		return nil
+	default:
+		return PruneDryRunAlreadyRequested
+	}
+}
+
+// run returns when ctx is done. plan dry-runs the pruners of the job's sides, see pruner.Pruner.DryRun.
+func (d *pruneDryRuns) run(ctx context.Context, plan func(ctx context.Context) []*PruneSide) {
+	log := GetLogger(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.requests:
+		}
+		log.Info("start pruning dry run")
+		startAt := time.Now()
+		d.mtx.Lock()
+		d.report = &PruneDryRunReport{StartAt: startAt}
+		d.mtx.Unlock()
+
+		sides := plan(ctx)
+
+		d.mtx.Lock()
+		d.report = &PruneDryRunReport{StartAt: startAt, DoneAt: time.Now(), Sides: sides}
+		d.mtx.Unlock()
+		log.Info("pruning dry run finished")
+	}
+}
+
+func (d *pruneDryRuns) status() *PruneDryRunReport {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.report
+}
+
+// dryRunPruner returns the report of p's dry run as side.
+func dryRunPruner(side string, p *pruner.Pruner) *PruneSide {
+	p.DryRun()
+	return &PruneSide{Side: side, Report: p.Report()}
+}
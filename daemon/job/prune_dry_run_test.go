@@ -0,0 +1,53 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+func TestPruneDryRuns(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := newPruneDryRuns()
+	assert.Nil(t, d.status())
+	assert.Equal(t, PruneDryRunAlreadyRequested, d.request(), "no dry runs before run")
+
+	planning, proceed := make(chan struct{}), make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		ctx, endTask := trace.WithTask(ctx, "prune-dry-runs")
+		defer endTask()
+		d.run(ctx, func(ctx context.Context) []*PruneSide {
+			planning <- struct{}{}
+			<-proceed
+			return []*PruneSide{{Side: "local", Report: &pruner.Report{State: pruner.Done.String()}}}
+		})
+	}()
+
+	require.Eventually(t, func() bool { return d.request() == nil }, time.Second, time.Millisecond)
+	<-planning
+	rep := d.status()
+	require.NotNil(t, rep)
+	assert.False(t, rep.Done())
+	assert.Equal(t, PruneDryRunAlreadyRequested, d.request(), "dry run in progress")
+
+	close(proceed)
+	require.Eventually(t, func() bool { return d.status().Done() }, time.Second, time.Millisecond)
+	rep = d.status()
+	assert.Len(t, rep.Sides, 1)
+	assert.Equal(t, "local", rep.Sides[0].Side)
+
+	cancel()
+	<-returned
+}
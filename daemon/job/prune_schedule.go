@@ -0,0 +1,129 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/trigger"
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+// pruneLock serializes the pruning of one side of a job by the job's invocations and by its scheduled pruning,
+// so that no two pruners of the job destroy the same snapshots.
+// The destroys on each filesystem are further serialized with the other operations
+// on the filesystem by the filesystem locks of package endpoint.
+type pruneLock chan struct{}
+
+func newPruneLock() pruneLock { return make(pruneLock, 1) }
+
+// lock returns ctx.Err() if ctx is done before the pruning could be locked.
+func (l pruneLock) lock(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryLock returns false if the pruning is locked.
+func (l pruneLock) tryLock() bool {
+	select {
+	case l <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l pruneLock) unlock() { <-l }
+
+// scheduledPruning prunes the sides of a job whenever the triggers in field `pruning.triggers` fire,
+// independent of the job's invocations. That way, the keep rules are enforced on the sides that
+// are reachable while the replication fails, e.g., because the other side is down for days.
+type scheduledPruning struct {
+	triggers *trigger.List // nil if field `pruning.triggers` is empty
+
+	mtx    sync.Mutex
+	report *ScheduledPruningReport // nil until the first scheduled pruning
+}
+
+// The result of the most recent scheduled pruning, see field `pruning.triggers`.
+type ScheduledPruningReport struct {
+	StartAt, DoneAt time.Time // DoneAt is zero while the pruning is in progress
+	Sides           []*PruneSide
+}
+
+func (r *ScheduledPruningReport) Done() bool { return !r.DoneAt.IsZero() }
+
+// scheduledPruningFromConfig returns a scheduledPruning without triggers if in is empty.
+func scheduledPruningFromConfig(in []config.TriggerEnum) (*scheduledPruning, error) {
+	for i, e := range in {
+		switch e.Ret.(type) {
+		case *config.TriggerPeriodic, *config.TriggerCron:
+		default:
+			return nil, fmt.Errorf("trigger #%d: only types periodic and cron are supported", i+1)
+		}
+	}
+	triggers, err := trigger.FromConfig(in, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build triggers")
+	}
+	return &scheduledPruning{triggers: triggers}, nil
+}
+
+// run returns when ctx is done. prune prunes the job's sides, see ActiveSide.pruneSides and runPrunerUnlessLocked.
+func (s *scheduledPruning) run(ctx context.Context, prune func(ctx context.Context) []*PruneSide) {
+	triggered := s.triggers.Run(ctx)
+	if triggered == nil {
+		return
+	}
+	log := GetLogger(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-triggered:
+		}
+		log.Info("start scheduled pruning")
+		startAt := time.Now()
+		s.mtx.Lock()
+		s.report = &ScheduledPruningReport{StartAt: startAt}
+		s.mtx.Unlock()
+
+		sides := prune(ctx)
+
+		s.mtx.Lock()
+		s.report = &ScheduledPruningReport{StartAt: startAt, DoneAt: time.Now(), Sides: sides}
+		s.mtx.Unlock()
+		log.Info("scheduled pruning finished")
+	}
+}
+
+func (s *scheduledPruning) status() *ScheduledPruningReport {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.report
+}
+
+// runPrunerUnlessLocked prunes with p and returns its report as side,
+// or returns nil if lock is locked, i.e., if the job's invocation prunes side.
+func runPrunerUnlessLocked(ctx context.Context, side string, lock pruneLock, p *pruner.Pruner) *PruneSide {
+	if !lock.tryLock() {
+		GetLogger(ctx).WithField("prune_side", side).Info("invocation of the job prunes this side, skipping its scheduled pruning")
+		return nil
+	}
+	defer lock.unlock()
+	p.Prune()
+	return &PruneSide{Side: side, Report: p.Report()}
+}
+
+// planPruneSide is dryRunPruner for ActiveSide.pruneSides.
+func planPruneSide(ctx context.Context, side string, lock pruneLock, p *pruner.Pruner) *PruneSide {
+	return dryRunPruner(side, p)
+}
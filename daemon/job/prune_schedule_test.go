@@ -0,0 +1,81 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/daemon/pruner"
+)
+
+func TestScheduledPruningFromConfig(t *testing.T) {
+	s, err := scheduledPruningFromConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, s.triggers)
+	assert.Nil(t, s.status())
+
+	_, err = scheduledPruningFromConfig([]config.TriggerEnum{
+		{Ret: &config.TriggerCron{Type: "cron", Cron: "0 3 * * *"}},
+		{Ret: &config.TriggerManual{Type: "manual"}},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "trigger #2")
+	}
+}
+
+func TestScheduledPruning(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s, err := scheduledPruningFromConfig([]config.TriggerEnum{
+		{Ret: &config.TriggerPeriodic{Type: "periodic", Interval: 10 * time.Millisecond}},
+	})
+	require.NoError(t, err)
+
+	lock := newPruneLock()
+	require.NoError(t, lock.lock(ctx), "the job's invocation prunes")
+
+	pruned := make(chan []*PruneSide)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		ctx, endTask := trace.WithTask(ctx, "scheduled-pruning")
+		defer endTask()
+		s.run(ctx, func(ctx context.Context) []*PruneSide {
+			side := runPrunerUnlessLocked(ctx, "sender", lock, nil) // nil pruner: must not prune while locked
+			sides := appendPruneSides(nil, side)
+			pruned <- sides
+			return sides
+		})
+	}()
+
+	assert.Empty(t, <-pruned, "skips the side while the invocation prunes it")
+	require.Eventually(t, func() bool { return s.status() != nil && s.status().Done() }, time.Second, time.Millisecond)
+	assert.Empty(t, s.status().Sides)
+
+	cancel()
+	for {
+		select {
+		case <-pruned:
+		case <-returned:
+			lock.unlock()
+			assert.True(t, lock.tryLock())
+			assert.False(t, lock.tryLock())
+			return
+		}
+	}
+}
+
+func TestAppendPruneSides(t *testing.T) {
+	a := &PruneSide{Side: "sender", Report: &pruner.Report{}}
+	b := &PruneSide{Side: "receiver", Report: &pruner.Report{}}
+	assert.Equal(t, []*PruneSide{a, b}, appendPruneSides(nil, a, nil, b))
+	assert.Empty(t, appendPruneSides(nil, nil))
+}
@@ -0,0 +1,30 @@
+// Package ready lets the daemon wait until a started job is up, e.g., listening for connections,
+// so that it can report readiness to the service manager (see package sdnotify).
+package ready
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey int
+
+const contextKeyReady contextKey = iota
+
+// Ready reports that the job is up: jobs that listen call it once they listen, other jobs when they start.
+// It may be called more than once.
+func Ready(ctx context.Context) {
+	if rf, ok := ctx.Value(contextKeyReady).(func()); ok {
+		rf()
+	}
+}
+
+// Context returns a channel that is closed once the job calls Ready.
+func Context(ctx context.Context) (context.Context, <-chan struct{}) {
+	rc := make(chan struct{})
+	var once sync.Once
+	rf := func() {
+		once.Do(func() { close(rc) })
+	}
+	return context.WithValue(ctx, contextKeyReady, rf), rc
+}
@@ -0,0 +1,223 @@
+package job
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Reconfigure prepares applying next, the changed configuration of the running job j, without restarting j.
+// cur is the configuration that j was built from.
+//
+// Only changes to the fields `pruning` and `snapshotting` can be applied that way:
+// the next pruning uses the new rules, and the snapper switches to the new settings
+// as soon as it is not taking snapshots. Changes to field `pruning.triggers` require a restart.
+// If next differs from cur in other fields, ok is false and j must be restarted instead.
+// If err is not nil, next is invalid.
+func Reconfigure(g *config.Global, j Job, cur, next config.JobEnum) (apply func(), ok bool, err error) {
+	switch c := cur.Ret.(type) {
+	case *config.PushJob:
+		n, sameType := next.Ret.(*config.PushJob)
+		if !sameType {
+			return nil, false, nil
+		}
+		other := *c
+		other.Pruning, other.Snapshotting = n.Pruning, n.Snapshotting
+		other.Pruning.Triggers = c.Pruning.Triggers
+		if !reflect.DeepEqual(&other, n) {
+			return nil, false, nil
+		}
+		apply, err = j.(*ActiveSide).reconfigure(g, changedPruningOrSnapshotting(c.Pruning, n.Pruning, c.Snapshotting, n.Snapshotting), changedSnapshotting(c.Snapshotting, n.Snapshotting))
+	case *config.LocalJob:
+		n, sameType := next.Ret.(*config.LocalJob)
+		if !sameType {
+			return nil, false, nil
+		}
+		other := *c
+		other.Pruning, other.Snapshotting = n.Pruning, n.Snapshotting
+		other.Pruning.Triggers = c.Pruning.Triggers
+		if !reflect.DeepEqual(&other, n) {
+			return nil, false, nil
+		}
+		apply, err = j.(*ActiveSide).reconfigure(g, changedPruningOrSnapshotting(c.Pruning, n.Pruning, c.Snapshotting, n.Snapshotting), changedSnapshotting(c.Snapshotting, n.Snapshotting))
+	case *config.PullJob:
+		n, sameType := next.Ret.(*config.PullJob)
+		if !sameType {
+			return nil, false, nil
+		}
+		other := *c
+		other.Pruning = n.Pruning
+		other.Pruning.Triggers = c.Pruning.Triggers
+		if !reflect.DeepEqual(&other, n) {
+			return nil, false, nil
+		}
+		apply, err = j.(*ActiveSide).reconfigure(g, changedPruning(c.Pruning, n.Pruning), nil)
+	case *config.SourceJob:
+		n, sameType := next.Ret.(*config.SourceJob)
+		if !sameType {
+			return nil, false, nil
+		}
+		other := *c
+		other.Snapshotting = n.Snapshotting
+		if !reflect.DeepEqual(&other, n) {
+			return nil, false, nil
+		}
+		apply, err = j.(*PassiveSide).reconfigure(g, n.Pruning, changedSnapshotting(c.Snapshotting, n.Snapshotting))
+	case *config.SnapJob:
+		n, sameType := next.Ret.(*config.SnapJob)
+		if !sameType {
+			return nil, false, nil
+		}
+		other := *c
+		other.Pruning, other.Snapshotting = n.Pruning, n.Snapshotting
+		if !reflect.DeepEqual(&other, n) {
+			return nil, false, nil
+		}
+		var pruning *config.PruningLocal
+		// the keep rules may refer to the snapshot classes of the snapshotting
+		if !reflect.DeepEqual(c.Pruning, n.Pruning) || !reflect.DeepEqual(c.Snapshotting, n.Snapshotting) {
+			pruning = &n.Pruning
+		}
+		apply, err = j.(*SnapJob).reconfigure(g, pruning, changedSnapshotting(c.Snapshotting, n.Snapshotting))
+	default:
+		// sink and verify jobs have neither pruning nor snapshotting
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "cannot reconfigure job %q", cur.Name())
+	}
+	return apply, true, nil
+}
+
+// returns nil if next equals cur
+func changedPruning(cur, next config.PruningSenderReceiver) *config.PruningSenderReceiver {
+	if reflect.DeepEqual(cur, next) {
+		return nil
+	}
+	return &next
+}
+
+// returns nil if both nextPruning and nextSnapshotting equal their cur,
+// the keep rules of the pruning may refer to the snapshot classes of the snapshotting
+func changedPruningOrSnapshotting(curPruning, nextPruning config.PruningSenderReceiver, curSnapshotting, nextSnapshotting config.SnapshottingEnum) *config.PruningSenderReceiver {
+	if reflect.DeepEqual(curPruning, nextPruning) && reflect.DeepEqual(curSnapshotting, nextSnapshotting) {
+		return nil
+	}
+	return &nextPruning
+}
+
+// returns nil if next equals cur
+func changedSnapshotting(cur, next config.SnapshottingEnum) *config.SnapshottingEnum {
+	if reflect.DeepEqual(cur, next) {
+		return nil
+	}
+	return &next
+}
+
+// pruning and snapshotting are nil if unchanged
+func (j *ActiveSide) reconfigure(g *config.Global, pruning *config.PruningSenderReceiver, snapshotting *config.SnapshottingEnum) (func(), error) {
+	var cur, snap *snapper.PeriodicOrManual
+	if snapshotting != nil {
+		var fsf zfs.DatasetFilter
+		var stepHolds endpoint.NewSnapshotStepHolds
+		switch m := j.mode.(type) { // pull jobs do not snapshot
+		case *modePush:
+			cur, fsf, stepHolds = m.snapper, m.senderConfig.FSF, endpoint.NewSnapshotStepHolds{JobIDs: m.stepHoldJobIDs}
+		case *modeLocal:
+			cur, fsf, stepHolds = m.snapper, m.senderConfig.FSF, endpoint.NewSnapshotStepHolds{JobIDs: []endpoint.JobID{j.name}}
+		default:
+			panic(fmt.Sprintf("implementation error: mode %T does not snapshot", m))
+		}
+		var err error
+		if snap, err = snapper.FromConfig(g, fsf, *snapshotting, j.name, stepHolds); err != nil {
+			return nil, errors.Wrap(err, "cannot build snapper")
+		}
+	}
+	var prunerFactory *pruner.PrunerFactory
+	if pruning != nil {
+		classes := j.snapshotClasses()
+		if snap != nil {
+			classes = snap.ClassNameRegexes()
+		}
+		var err error
+		if prunerFactory, err = pruner.NewPrunerFactory(*pruning, classes, j.promPruneSecs); err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		if prunerFactory != nil {
+			j.prunerFactoryMtx.Lock()
+			j.prunerFactory = prunerFactory
+			j.prunerFactoryMtx.Unlock()
+		}
+		if snap != nil {
+			cur.Replace(snap)
+		}
+	}, nil
+}
+
+// snapshotting is nil if unchanged, pruning is the unchanged pruning of the source job
+func (j *PassiveSide) reconfigure(g *config.Global, pruning *config.PruningLocal, snapshotting *config.SnapshottingEnum) (func(), error) {
+	if snapshotting == nil {
+		return func() {}, nil
+	}
+	source := j.mode.(*modeSource) // sink jobs do not snapshot
+	snap, err := snapper.FromConfig(g, source.senderConfig.FSF, *snapshotting, j.name, sourceStepHolds(source.senderConfig))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build snapper")
+	}
+	// the keep rules may refer to the snapshot classes of the snapshotting
+	var prunerFactory *pruner.LocalPrunerFactory
+	if pruning != nil {
+		if prunerFactory, err = pruner.NewSourcePrunerFactory(*pruning, snap.ClassNameRegexes(), source.promPruneSecs); err != nil {
+			return nil, errors.Wrap(err, "field `pruning`")
+		}
+	}
+	return func() {
+		if prunerFactory != nil {
+			source.prunerFactoryMtx.Lock()
+			source.prunerFactory = prunerFactory
+			source.prunerFactoryMtx.Unlock()
+		}
+		source.snapper.Replace(snap)
+	}, nil
+}
+
+// pruning and snapshotting are nil if unchanged
+func (j *SnapJob) reconfigure(g *config.Global, pruning *config.PruningLocal, snapshotting *config.SnapshottingEnum) (func(), error) {
+	var snap *snapper.PeriodicOrManual
+	if snapshotting != nil {
+		var err error
+		if snap, err = snapper.FromConfig(g, j.fsfilter, *snapshotting, j.name, endpoint.NewSnapshotStepHolds{}); err != nil {
+			return nil, errors.Wrap(err, "cannot build snapper")
+		}
+	}
+	var prunerFactory *pruner.LocalPrunerFactory
+	if pruning != nil {
+		classes := j.snapper.ClassNameRegexes()
+		if snap != nil {
+			classes = snap.ClassNameRegexes()
+		}
+		var err error
+		if prunerFactory, err = pruner.NewLocalPrunerFactory(*pruning, classes, j.promPruneSecs); err != nil {
+			return nil, errors.Wrap(err, "cannot build snapjob pruning rules")
+		}
+	}
+	return func() {
+		if prunerFactory != nil {
+			j.prunerFactoryMtx.Lock()
+			j.prunerFactory = prunerFactory
+			j.prunerFactoryMtx.Unlock()
+		}
+		if snap != nil {
+			j.snapper.Replace(snap)
+		}
+	}, nil
+}
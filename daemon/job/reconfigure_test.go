@@ -0,0 +1,102 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+func TestReconfigure(t *testing.T) {
+	tmpl := `
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: push
+  filesystems: {%s: true}
+  snapshotting:
+%s
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+%s
+`
+	manual := "    type: manual"
+	periodic := "    type: periodic\n    prefix: zrepl_\n    interval: 10m"
+	lastN := func(n int) string { return fmt.Sprintf("    - type: last_n\n      count: %d", n) }
+	parse := func(fs, snapshotting, keepReceiver string) config.JobEnum {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, fs, snapshotting, keepReceiver)))
+		require.NoError(t, err)
+		return conf.Jobs[0]
+	}
+
+	cur := parse(`"pool<"`, manual, lastN(10))
+	jobs, err := JobsFromConfig(&config.Config{Jobs: []config.JobEnum{cur}})
+	require.NoError(t, err)
+	j := jobs[0].(*ActiveSide)
+
+	t.Run("filesystems require a restart", func(t *testing.T) {
+		_, ok, err := Reconfigure(nil, j, cur, parse(`"other<"`, manual, lastN(10)))
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("pruning triggers require a restart", func(t *testing.T) {
+		triggers := lastN(10) + "\n    triggers:\n    - type: periodic\n      interval: 1h"
+		_, ok, err := Reconfigure(nil, j, cur, parse(`"pool<"`, manual, triggers))
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid pruning", func(t *testing.T) {
+		_, _, err := Reconfigure(nil, j, cur, parse(`"pool<"`, manual, "    - type: regex\n      regex: '('"))
+		assert.Error(t, err)
+	})
+
+	t.Run("keep rules refer to the classes of the new snapshotting", func(t *testing.T) {
+		classes := "    type: periodic\n    classes:\n    - name: hourly\n      prefix: zrepl_hourly_\n      interval: 1h"
+		keepHourly := lastN(5) + "\n      class: hourly"
+		_, _, err := Reconfigure(nil, j, cur, parse(`"pool<"`, manual, keepHourly))
+		assert.Error(t, err)
+		_, ok, err := Reconfigure(nil, j, cur, parse(`"pool<"`, classes, keepHourly))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("pruning and snapshotting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+		push := j.mode.(*modePush)
+		snapperDone := make(chan struct{})
+		go func() {
+			defer close(snapperDone)
+			push.snapper.Run(ctx, nil)
+		}()
+		defer func() {
+			cancel()
+			<-snapperDone
+		}()
+
+		prunerFactory := j.getPrunerFactory()
+		apply, ok, err := Reconfigure(nil, j, cur, parse(`"pool<"`, periodic, lastN(5)))
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.True(t, prunerFactory == j.getPrunerFactory(), "must not change before apply")
+		assert.Nil(t, push.snapper.Report(), "manual snapshotting")
+
+		apply()
+		assert.False(t, prunerFactory == j.getPrunerFactory())
+		// the running snapper switches to periodic snapshotting
+		assert.Eventually(t, func() bool { return push.snapper.Report() != nil }, 10*time.Second, 10*time.Millisecond)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,7 +14,13 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/after"
+	"github.com/zrepl/zrepl/daemon/job/ready"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/job/trigger"
 	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/daemon/pruner"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
@@ -24,33 +32,64 @@ type SnapJob struct {
 	name     endpoint.JobID
 	fsfilter zfs.DatasetFilter
 	snapper  *snapper.PeriodicOrManual
+	after    []string            // see ActiveSide.after
+	logging  *logging.JobOutlets // may be nil
+	weight   int                 // see package scheduler
 
-	prunerFactory *pruner.LocalPrunerFactory
+	failureBackoff *failureBackoff
+	eventHooks     *hooks.EventHooks // may be nil
+	triggers       *trigger.List     // nil if the snapshotting triggers the job
+
+	prunerFactoryMtx sync.Mutex
+	prunerFactory    *pruner.LocalPrunerFactory // replaced by Reconfigure
 
 	promPruneSecs *prometheus.HistogramVec // labels: prune_side
 
 	pruner *pruner.Pruner
+
+	pruneDryRuns *pruneDryRuns
 }
 
 func (j *SnapJob) Name() string { return j.name.String() }
 
 func (j *SnapJob) Type() Type { return TypeSnap }
 
+func (j *SnapJob) After() []string { return j.after }
+
+func (j *SnapJob) Logging() *logging.JobOutlets { return j.logging }
+
+func (j *SnapJob) Weight() int { return j.weight }
+
 func snapJobFromConfig(g *config.Global, in *config.SnapJob) (j *SnapJob, err error) {
-	j = &SnapJob{}
+	j = &SnapJob{pruneDryRuns: newPruneDryRuns()}
 	fsf, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
 	j.fsfilter = fsf
-
-	if j.snapper, err = snapper.FromConfig(g, fsf, in.Snapshotting); err != nil {
-		return nil, errors.Wrap(err, "cannot build snapper")
+	j.after = in.After
+	if j.logging, err = logging.JobOutletsFromConfig(in.Logging); err != nil {
+		return nil, errors.Wrap(err, "field `logging`")
 	}
+	j.weight = in.Weight
+	if j.failureBackoff, err = failureBackoffFromConfig(in.FailureBackoff); err != nil {
+		return nil, errors.Wrap(err, "field `failure_backoff`")
+	}
+
 	j.name, err = endpoint.MakeJobID(in.Name)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid job name")
 	}
+	if j.snapper, err = snapper.FromConfig(g, fsf, in.Snapshotting, j.name, endpoint.NewSnapshotStepHolds{}); err != nil {
+		return nil, errors.Wrap(err, "cannot build snapper")
+	}
+	if j.triggers, err = trigger.FromConfig(in.Triggers, fsf); err != nil {
+		return nil, errors.Wrap(err, "field `triggers`")
+	}
+	j.eventHooks, err = hooks.EventHooksFromConfig(j.name.String(), in.EventHooks, hooks.EventSnapshottingCompleted, hooks.EventPruningCompleted)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `event_hooks`")
+	}
 	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   "zrepl",
 		Subsystem:   "pruning",
@@ -58,7 +97,7 @@ func snapJobFromConfig(g *config.Global, in *config.SnapJob) (j *SnapJob, err er
 		Help:        "seconds spent in pruner",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"prune_side"})
-	j.prunerFactory, err = pruner.NewLocalPrunerFactory(in.Pruning, j.promPruneSecs)
+	j.prunerFactory, err = pruner.NewLocalPrunerFactory(in.Pruning, j.snapper.ClassNameRegexes(), j.promPruneSecs)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build snapjob pruning rules")
 	}
@@ -72,6 +111,9 @@ func (j *SnapJob) RegisterMetrics(registerer prometheus.Registerer) {
 type SnapJobStatus struct {
 	Pruning      *pruner.Report
 	Snapshotting *snapper.Report // may be nil
+	// see ActiveSideStatus.FailureBackoff
+	FailureBackoff *FailureBackoffStatus `json:",omitempty"`
+	PruneDryRun    *PruneDryRunReport    `json:",omitempty"`
 }
 
 func (j *SnapJob) Status() *Status {
@@ -81,6 +123,8 @@ func (j *SnapJob) Status() *Status {
 		s.Pruning = j.pruner.Report()
 	}
 	s.Snapshotting = j.snapper.Report()
+	s.FailureBackoff = j.failureBackoff.status(time.Now())
+	s.PruneDryRun = j.pruneDryRuns.status()
 	return &Status{Type: t, JobSpecific: s}
 }
 
@@ -90,36 +134,85 @@ func (j *SnapJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
 
 func (j *SnapJob) SenderConfig() *endpoint.SenderConfig { return nil }
 
+// SnapshotNow makes the job take snapshots right away, see snapper.Snapper.SnapshotNow.
+func (j *SnapJob) SnapshotNow(ctx context.Context, selection func(fs string) bool) error {
+	return j.snapper.SnapshotNow(ctx, selection)
+}
+
 func (j *SnapJob) Run(ctx context.Context) {
 	ctx, endTask := trace.WithTaskAndSpan(ctx, "snap-job", j.Name())
 	defer endTask()
+	ctx = hooks.WithEventHooks(ctx, j.eventHooks)
 	log := GetLogger(ctx)
 
 	defer log.Info("job exiting")
+	ready.Ready(ctx) // snap jobs do not listen
 
 	periodicDone := make(chan struct{})
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	periodicCtx, endTask := trace.WithTask(ctx, "snapshotting")
 	defer endTask()
-	go j.snapper.Run(periodicCtx, periodicDone)
+	snapperReturned := make(chan struct{})
+	go func() {
+		defer close(snapperReturned)
+		j.snapper.Run(periodicCtx, periodicDone)
+	}()
+	defer func() {
+		cancel()
+		<-snapperReturned // the snapper's tasks must end before the snapshotting task
+	}()
+	triggered := j.triggers.Run(periodicCtx)
+
+	pruneDryRunCtx, endTask := trace.WithTask(ctx, "prune-dry-runs")
+	defer endTask()
+	go j.pruneDryRuns.run(pruneDryRunCtx, j.planPruning)
 
 	invocationCount := 0
 outer:
 	for {
 		log.Info("wait for wakeups")
+		deferrable := false // wakeups are not deferred
+		backoffEnd, stopBackoffTimer := j.failureBackoff.deferredTrigger()
 		select {
 		case <-ctx.Done():
 			log.WithError(ctx.Err()).Info("context")
 			break outer
+		case <-stop.Wait(ctx):
+			log.Info("stop requested")
+			break outer
 
 		case <-wakeup.Wait(ctx):
+			j.failureBackoff.end()
+		case <-after.Wait(ctx):
+			log.Info("triggered by the jobs in field `after`")
+			deferrable = true
 		case <-periodicDone:
+			if len(j.after) > 0 || j.triggers != nil {
+				// the snapshots are taken, but the jobs in `after` or field `triggers` trigger the pruning
+				continue
+			}
+			deferrable = true
+		case <-triggered:
+			log.Info("triggered by field `triggers`")
+			deferrable = true
+		case <-backoffEnd:
+			log.Info("backoff after failed invocations ended, running the deferred invocation")
+		}
+		stopBackoffTimer()
+		if deferrable && j.failureBackoff.deferTrigger(time.Now()) {
+			log.Debug("backing off after failed invocations, deferring the trigger")
+			continue
 		}
 		invocationCount++
 
 		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
 		j.doPrune(invocationCtx)
+		if ctx.Err() == nil {
+			err := j.invocationErr()
+			after.Completed(ctx, err)
+			logFailureBackoff(log, j.failureBackoff.completed(err, time.Now()))
+		}
 		endSpan()
 	}
 }
@@ -167,18 +260,36 @@ func (h alwaysUpToDateReplicationCursorHistory) ListFilesystems(ctx context.Cont
 	return h.target.ListFilesystems(ctx, req)
 }
 
-func (j *SnapJob) doPrune(ctx context.Context) {
-	ctx, endSpan := trace.WithSpan(ctx, "snap-job-do-prune")
-	defer endSpan()
-	log := GetLogger(ctx)
+// buildPruner builds the pruner of the job's filesystems.
+func (j *SnapJob) buildPruner(ctx context.Context) *pruner.Pruner {
 	sender := endpoint.NewSender(endpoint.SenderConfig{
 		JobID: j.name,
 		FSF:   j.fsfilter,
 		// FIXME encryption setting is irrelevant for SnapJob because the endpoint is only used as pruner.Target
 		Encrypt: &zfs.NilBool{B: true},
 	})
-	j.pruner = j.prunerFactory.BuildLocalPruner(ctx, sender, alwaysUpToDateReplicationCursorHistory{sender})
+	j.prunerFactoryMtx.Lock()
+	prunerFactory := j.prunerFactory
+	j.prunerFactoryMtx.Unlock()
+	return prunerFactory.BuildLocalPruner(ctx, sender, alwaysUpToDateReplicationCursorHistory{sender})
+}
+
+func (j *SnapJob) doPrune(ctx context.Context) {
+	ctx, endSpan := trace.WithSpan(ctx, "snap-job-do-prune")
+	defer endSpan()
+	log := GetLogger(ctx)
+	j.pruner = j.buildPruner(ctx)
 	log.Info("start pruning")
 	j.pruner.Prune()
 	log.Info("finished pruning")
 }
+
+// PruneDryRun makes the job plan its pruning without destroying snapshots.
+// The result is reported in SnapJobStatus.PruneDryRun.
+func (j *SnapJob) PruneDryRun() error {
+	return j.pruneDryRuns.request()
+}
+
+func (j *SnapJob) planPruning(ctx context.Context) []*PruneSide {
+	return []*PruneSide{dryRunPruner("local", j.buildPruner(ctx))}
+}
@@ -0,0 +1,151 @@
+package job
+
+import (
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// FilterFilesystems returns a copy of s whose reports only contain the filesystems for which match returns true.
+// The reports of s are not modified, they may be shared with the job.
+func (s *Status) FilterFilesystems(match func(fs string) bool) *Status {
+	out := &Status{Type: s.Type, JobSpecific: s.JobSpecific}
+	switch st := s.JobSpecific.(type) {
+	case *ActiveSideStatus:
+		c := *st
+		c.Replication = filterReplicationReport(c.Replication, match)
+		c.DryRun = filterAttemptReport(c.DryRun, match)
+		c.PruneDryRun = filterPruneDryRunReport(c.PruneDryRun, match)
+		c.PruningSender = filterPrunerReport(c.PruningSender, match)
+		c.PruningReceiver = filterPrunerReport(c.PruningReceiver, match)
+		if c.ScheduledPruning != nil {
+			sp := *c.ScheduledPruning
+			sp.Sides = filterPruneSides(sp.Sides, match)
+			c.ScheduledPruning = &sp
+		}
+		c.Snapshotting = filterSnapperReport(c.Snapshotting, match)
+		if c.Targets != nil {
+			c.Targets = make([]*ActiveSideTargetStatus, len(st.Targets))
+			for i, t := range st.Targets {
+				tc := *t
+				tc.Replication = filterReplicationReport(t.Replication, match)
+				tc.DryRun = filterAttemptReport(t.DryRun, match)
+				tc.PruningReceiver = filterPrunerReport(t.PruningReceiver, match)
+				c.Targets[i] = &tc
+			}
+		}
+		out.JobSpecific = &c
+	case *PassiveStatus:
+		c := *st
+		c.Snapper = filterSnapperReport(c.Snapper, match)
+		c.Pruning = filterPrunerReport(c.Pruning, match)
+		c.PruneDryRun = filterPruneDryRunReport(c.PruneDryRun, match)
+		out.JobSpecific = &c
+	case *SnapJobStatus:
+		c := *st
+		c.Pruning = filterPrunerReport(c.Pruning, match)
+		c.Snapshotting = filterSnapperReport(c.Snapshotting, match)
+		c.PruneDryRun = filterPruneDryRunReport(c.PruneDryRun, match)
+		out.JobSpecific = &c
+	case *VerifyJobStatus:
+		c := *st
+		if c.Report != nil {
+			r := *c.Report
+			r.Filesystems = nil
+			for _, fs := range st.Report.Filesystems {
+				if match(fs.Name) {
+					r.Filesystems = append(r.Filesystems, fs)
+				}
+			}
+			c.Report = &r
+		}
+		out.JobSpecific = &c
+	}
+	return out
+}
+
+func filterReplicationReport(r *report.Report, match func(string) bool) *report.Report {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Attempts = make([]*report.AttemptReport, len(r.Attempts))
+	for i, a := range r.Attempts {
+		c.Attempts[i] = filterAttemptReport(a, match)
+	}
+	return &c
+}
+
+func filterAttemptReport(a *report.AttemptReport, match func(string) bool) *report.AttemptReport {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Filesystems = nil
+	for _, fs := range a.Filesystems {
+		if match(fs.Info.Name) {
+			c.Filesystems = append(c.Filesystems, fs)
+		}
+	}
+	return &c
+}
+
+func filterPrunerReport(r *pruner.Report, match func(string) bool) *pruner.Report {
+	if r == nil {
+		return nil
+	}
+	filter := func(l []pruner.FSReport) (out []pruner.FSReport) {
+		for _, fs := range l {
+			if match(fs.Filesystem) {
+				out = append(out, fs)
+			}
+		}
+		return out
+	}
+	c := *r
+	c.Pending = filter(r.Pending)
+	c.Completed = filter(r.Completed)
+	return &c
+}
+
+func filterPruneSides(sides []*PruneSide, match func(string) bool) []*PruneSide {
+	if sides == nil {
+		return nil
+	}
+	out := make([]*PruneSide, len(sides))
+	for i, s := range sides {
+		c := *s
+		c.Report = filterPrunerReport(s.Report, match)
+		out[i] = &c
+	}
+	return out
+}
+
+func filterPruneDryRunReport(r *PruneDryRunReport, match func(string) bool) *PruneDryRunReport {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Sides = filterPruneSides(r.Sides, match)
+	return &c
+}
+
+func filterSnapperReport(r *snapper.Report, match func(string) bool) *snapper.Report {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Progress = nil
+	for _, fs := range r.Progress {
+		if match(fs.Path) {
+			c.Progress = append(c.Progress, fs)
+		}
+	}
+	if r.Rules != nil {
+		c.Rules = make([]*snapper.Report, len(r.Rules))
+		for i, rule := range r.Rules {
+			c.Rules[i] = filterSnapperReport(rule, match)
+		}
+	}
+	return &c
+}
@@ -0,0 +1,59 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestStatusFilterFilesystems(t *testing.T) {
+	fsReport := func(name string) *report.FilesystemReport {
+		return &report.FilesystemReport{Info: &report.FilesystemInfo{Name: name}}
+	}
+	st := &ActiveSideStatus{
+		Replication: &report.Report{Attempts: []*report.AttemptReport{
+			{Filesystems: []*report.FilesystemReport{fsReport("pool/db"), fsReport("pool/vm")}},
+		}},
+		PruningSender: &pruner.Report{
+			Pending:   []pruner.FSReport{{Filesystem: "pool/vm"}},
+			Completed: []pruner.FSReport{{Filesystem: "pool/db"}},
+		},
+		ScheduledPruning: &ScheduledPruningReport{Sides: []*PruneSide{
+			{Side: "sender", Report: &pruner.Report{Completed: []pruner.FSReport{{Filesystem: "pool/db"}, {Filesystem: "pool/vm"}}}},
+		}},
+		Snapshotting: &snapper.Report{
+			Progress: []*snapper.ReportFilesystem{{Path: "pool/vm"}},
+			Rules:    []*snapper.Report{{Rule: "db", Progress: []*snapper.ReportFilesystem{{Path: "pool/db"}}}},
+		},
+		Targets: []*ActiveSideTargetStatus{{Name: "offsite", PruningReceiver: &pruner.Report{
+			Completed: []pruner.FSReport{{Filesystem: "pool/db"}},
+		}}},
+	}
+	s := &Status{Type: TypePush, JobSpecific: st}
+
+	filtered := s.FilterFilesystems(func(fs string) bool { return fs == "pool/db" })
+	require.Equal(t, TypePush, filtered.Type)
+	f := filtered.JobSpecific.(*ActiveSideStatus)
+
+	require.Len(t, f.Replication.Attempts, 1)
+	assert.Equal(t, []*report.FilesystemReport{fsReport("pool/db")}, f.Replication.Attempts[0].Filesystems)
+	assert.Empty(t, f.PruningSender.Pending)
+	assert.Equal(t, []pruner.FSReport{{Filesystem: "pool/db"}}, f.PruningSender.Completed)
+	assert.Nil(t, f.PruningReceiver)
+	assert.Equal(t, []pruner.FSReport{{Filesystem: "pool/db"}}, f.ScheduledPruning.Sides[0].Report.Completed)
+	assert.Empty(t, f.Snapshotting.Progress)
+	assert.Equal(t, "pool/db", f.Snapshotting.Rules[0].Progress[0].Path)
+	assert.Equal(t, "offsite", f.Targets[0].Name)
+	assert.Len(t, f.Targets[0].PruningReceiver.Completed, 1)
+
+	// the reports may be shared with the job
+	assert.Len(t, st.Replication.Attempts[0].Filesystems, 2)
+	assert.Len(t, st.PruningSender.Pending, 1)
+	assert.Len(t, st.ScheduledPruning.Sides[0].Report.Completed, 2)
+	assert.Len(t, st.Snapshotting.Progress, 1)
+}
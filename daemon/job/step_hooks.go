@@ -0,0 +1,209 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// stepHooks runs the step hooks of a job (field `replication.hooks.step` of active jobs,
+// field `hooks.step` of passive jobs) around replication steps.
+type stepHooks struct {
+	hooks *hooks.List
+}
+
+// Returns nil if in is empty.
+func stepHooksFromConfig(in config.HookList) (logic.StepHooks, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	l, err := hooks.ListFromConfig(&in)
+	if err != nil {
+		return nil, err
+	}
+	return &stepHooks{l}, nil
+}
+
+// RunStep runs step as the callback of a hook plan that consists of the hooks that match the step's filesystem.
+//
+// Errors of pre-edges that are not fatal and errors of post-edges are logged but do not fail the step,
+// whereas a fatal pre-edge error fails the step without replicating anything.
+func (h *stepHooks) RunStep(ctx context.Context, info logic.StepHookInfo, step func(ctx context.Context) (int64, error)) error {
+	fs, err := zfs.NewDatasetPath(info.Filesystem)
+	if err != nil {
+		return err
+	}
+	filtered, err := h.hooks.CopyFilteredForFilesystem(fs)
+	if err != nil {
+		return fmt.Errorf("cannot filter step hooks: %s", err)
+	}
+	if len(filtered) == 0 {
+		_, err := step(ctx)
+		return err
+	}
+
+	// the callback adds the variables that are only known after the step to env,
+	// they are visible to the post-edges
+	env := hooks.Env{
+		hooks.EnvFS:   info.Filesystem,
+		hooks.EnvFrom: info.From,
+		hooks.EnvTo:   info.To,
+	}
+	var stepErr error
+	cb := hooks.NewCallbackHookForFilesystem("replication step", fs, func(ctx context.Context) error {
+		var bytesReplicated int64
+		bytesReplicated, stepErr = step(ctx)
+		env[hooks.EnvBytesReplicated] = strconv.FormatInt(bytesReplicated, 10)
+		if stepErr != nil {
+			env[hooks.EnvError] = stepErr.Error()
+		} else {
+			env[hooks.EnvError] = ""
+		}
+		return stepErr
+	})
+	plan, err := hooks.NewPlan(&filtered, hooks.PhaseReplicationStep, cb, env)
+	if err != nil {
+		return fmt.Errorf("cannot create step hook plan: %s", err)
+	}
+
+	plan.Run(ctx, false)
+	planReport := plan.Report()
+	if planReport.HadFatalError() {
+		return fmt.Errorf("step skipped because of a fatal error in a pre-step hook:\n%s", planReport)
+	}
+	for _, e := range planReport {
+		if e.Edge != hooks.Callback && e.Status == hooks.StepErr {
+			GetLogger(ctx).WithField("report", planReport.String()).Warn("step hook invocation failed")
+			break
+		}
+	}
+	return stepErr
+}
+
+// stepHooksHandler runs the step hooks of a passive job around the Send and Receive requests
+// of the active side, each of which is one replication step.
+type stepHooksHandler struct {
+	rpc.Handler
+	hooks logic.StepHooks
+	// maps the filesystem of a request to the filesystem on this host
+	localFilesystem func(ctx context.Context, fs string) (*zfs.DatasetPath, error)
+}
+
+// The versions are those of a request, they have not been validated yet.
+func stepHookInfo(fs string, from, to *pdu.FilesystemVersion) logic.StepHookInfo {
+	relName := func(v *pdu.FilesystemVersion) string {
+		if v == nil {
+			return ""
+		}
+		zv, err := v.ZFSFilesystemVersion()
+		if err != nil {
+			return "" // the handler rejects the request
+		}
+		return zv.RelName()
+	}
+	return logic.StepHookInfo{Filesystem: fs, From: relName(from), To: relName(to)}
+}
+
+func (h *stepHooksHandler) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	fs, err := h.localFilesystem(ctx, req.GetFilesystem())
+	if err != nil {
+		return h.Handler.Receive(ctx, req, receive) // reports the invalid request
+	}
+	var res *pdu.ReceiveRes
+	called := false
+	err = h.hooks.RunStep(ctx, stepHookInfo(fs.ToString(), req.GetFrom(), req.GetTo()), func(ctx context.Context) (int64, error) {
+		called = true
+		counted := &hookedStream{ReadCloser: receive}
+		var err error
+		res, err = h.Handler.Receive(ctx, req, counted)
+		return counted.bytes, err
+	})
+	if !called {
+		receive.Close()
+	}
+	return res, err
+}
+
+// Send runs the pre-edges before the send, the post-edges once the stream was transferred,
+// i.e., when the server closes the stream.
+func (h *stepHooksHandler) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	if req.GetDryRun() {
+		return h.Handler.Send(ctx, req)
+	}
+	fs, err := h.localFilesystem(ctx, req.GetFilesystem())
+	if err != nil {
+		return h.Handler.Send(ctx, req)
+	}
+
+	type sendResult struct {
+		res    *pdu.SendRes
+		stream io.ReadCloser
+		err    error
+	}
+	sent := make(chan sendResult, 1)
+	hooksDone := make(chan struct{})
+	go func() {
+		defer close(hooksDone)
+		called := false
+		err := h.hooks.RunStep(ctx, stepHookInfo(fs.ToString(), req.GetFrom(), req.GetTo()), func(ctx context.Context) (int64, error) {
+			called = true
+			res, stream, err := h.Handler.Send(ctx, req)
+			if err != nil || stream == nil {
+				sent <- sendResult{res, stream, err}
+				return 0, err
+			}
+			s := &hookedStream{ReadCloser: stream, closed: make(chan struct{}), hooksDone: hooksDone}
+			sent <- sendResult{res, s, nil}
+			<-s.closed
+			return s.bytes, s.readErr
+		})
+		if !called {
+			sent <- sendResult{err: err}
+		}
+	}()
+	r := <-sent
+	return r.res, r.stream, r.err
+}
+
+// hookedStream counts the bytes read from the stream.
+// If closed is not nil, Close signals it and waits for hooksDone, i.e., for the post-edges.
+type hookedStream struct {
+	io.ReadCloser
+	bytes   int64
+	readErr error // the first error other than io.EOF
+
+	closed    chan struct{}
+	hooksDone <-chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (s *hookedStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.bytes += int64(n)
+	if err != nil && err != io.EOF && s.readErr == nil {
+		s.readErr = err
+	}
+	return n, err
+}
+
+func (s *hookedStream) Close() error {
+	if s.closed == nil {
+		return s.ReadCloser.Close()
+	}
+	s.closeOnce.Do(func() {
+		s.closeErr = s.ReadCloser.Close()
+		close(s.closed)
+		<-s.hooksDone
+	})
+	return s.closeErr
+}
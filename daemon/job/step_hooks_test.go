@@ -0,0 +1,143 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// recordingStepHooks records the steps, fatal makes the pre-edges prevent them
+type recordingStepHooks struct {
+	fatal bool
+	info  []logic.StepHookInfo
+	bytes []int64
+	errs  []error
+	// called after the step returned, i.e., where the post-edges run
+	post func()
+}
+
+func (h *recordingStepHooks) RunStep(ctx context.Context, info logic.StepHookInfo, step func(ctx context.Context) (int64, error)) error {
+	h.info = append(h.info, info)
+	if h.fatal {
+		return errors.New("fatal pre-step hook error")
+	}
+	n, err := step(ctx)
+	h.bytes = append(h.bytes, n)
+	h.errs = append(h.errs, err)
+	if h.post != nil {
+		h.post()
+	}
+	return err
+}
+
+type fakeStepHandler struct {
+	rpc.Handler // unused methods panic
+	received    []byte
+	stream      []byte
+}
+
+func (f *fakeStepHandler) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	defer receive.Close()
+	var err error
+	f.received, err = ioutil.ReadAll(receive)
+	return &pdu.ReceiveRes{}, err
+}
+
+func (f *fakeStepHandler) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	if req.GetDryRun() {
+		return &pdu.SendRes{ExpectedSize: 23}, nil, nil
+	}
+	return &pdu.SendRes{}, ioutil.NopCloser(bytes.NewReader(f.stream)), nil
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error { c.closed = true; return nil }
+
+func TestStepHooksHandlerReceive(t *testing.T) {
+	ctx := context.Background()
+	snap := func(name string) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Creation: pdu.FilesystemVersionCreation(time.Now())}
+	}
+	req := &pdu.ReceiveReq{Filesystem: "pool/data", From: snap("a"), To: snap("b")}
+	localFilesystem := func(_ context.Context, fs string) (*zfs.DatasetPath, error) {
+		return zfs.NewDatasetPath("sink/client/" + fs)
+	}
+
+	h := &recordingStepHooks{}
+	inner := &fakeStepHandler{}
+	handler := &stepHooksHandler{Handler: inner, hooks: h, localFilesystem: localFilesystem}
+	_, err := handler.Receive(ctx, req, ioutil.NopCloser(bytes.NewReader([]byte("stream"))))
+	require.NoError(t, err)
+	assert.Equal(t, []logic.StepHookInfo{{Filesystem: "sink/client/pool/data", From: "@a", To: "@b"}}, h.info)
+	assert.Equal(t, []int64{6}, h.bytes)
+	assert.Equal(t, "stream", string(inner.received))
+
+	// a fatal pre-step hook prevents the receive
+	h = &recordingStepHooks{fatal: true}
+	handler.hooks = h
+	inner.received = nil
+	stream := &closeRecorder{Reader: bytes.NewReader([]byte("stream"))}
+	_, err = handler.Receive(ctx, req, stream)
+	assert.Error(t, err)
+	assert.Nil(t, inner.received)
+	assert.True(t, stream.closed, "the stream must be closed although the receive did not run")
+}
+
+func TestStepHooksHandlerSend(t *testing.T) {
+	ctx := context.Background()
+	req := &pdu.SendReq{Filesystem: "pool/data", To: &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "b", Creation: pdu.FilesystemVersionCreation(time.Now())}}
+	identity := func(_ context.Context, fs string) (*zfs.DatasetPath, error) { return zfs.NewDatasetPath(fs) }
+
+	postRan := make(chan struct{})
+	h := &recordingStepHooks{post: func() { close(postRan) }}
+	handler := &stepHooksHandler{Handler: &fakeStepHandler{stream: []byte("snapshot")}, hooks: h, localFilesystem: identity}
+
+	_, stream, err := handler.Send(ctx, req)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "snapshot", string(data))
+	select {
+	case <-postRan:
+		t.Fatal("post-edges must only run once the stream is closed")
+	default:
+	}
+	require.NoError(t, stream.Close())
+	select {
+	case <-postRan:
+	default:
+		t.Fatal("Close must wait for the post-edges")
+	}
+	assert.Equal(t, []logic.StepHookInfo{{Filesystem: "pool/data", To: "@b"}}, h.info)
+	assert.Equal(t, []int64{8}, h.bytes)
+	assert.Equal(t, []error{nil}, h.errs)
+
+	// size estimates are no replication steps
+	res, stream, err := handler.Send(ctx, &pdu.SendReq{Filesystem: "pool/data", To: req.To, DryRun: true})
+	require.NoError(t, err)
+	assert.Nil(t, stream)
+	assert.Equal(t, int64(23), res.GetExpectedSize())
+	assert.Len(t, h.info, 1)
+
+	// a fatal pre-step hook prevents the send
+	handler.hooks = &recordingStepHooks{fatal: true}
+	_, stream, err = handler.Send(ctx, req)
+	assert.Error(t, err)
+	assert.Nil(t, stream)
+}
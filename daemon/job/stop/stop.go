@@ -0,0 +1,44 @@
+// Package stop asks a running job to exit gracefully, e.g., because it was removed from the config.
+// Unlike the cancellation of the job's context, a stop lets the job finish what it is doing
+// up to the next safe point, e.g., the replication step that is executing.
+package stop
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey int
+
+const contextKeyStop contextKey = iota
+
+// Wait returns a channel that is closed when the job is asked to stop.
+func Wait(ctx context.Context) <-chan struct{} {
+	sc, ok := ctx.Value(contextKeyStop).(chan struct{})
+	if !ok {
+		sc = make(chan struct{})
+	}
+	return sc
+}
+
+// Requested returns true if the job was asked to stop.
+func Requested(ctx context.Context) bool {
+	select {
+	case <-Wait(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// Func asks the job to stop. It may be called more than once.
+type Func func()
+
+func Context(ctx context.Context) (context.Context, Func) {
+	sc := make(chan struct{})
+	var once sync.Once
+	sf := func() {
+		once.Do(func() { close(sc) })
+	}
+	return context.WithValue(ctx, contextKeyStop, sc), sf
+}
@@ -0,0 +1,214 @@
+package trigger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a schedule in the format of crontab(5): minute hour day-of-month month day-of-week.
+// Each field is a comma-separated list of `*`, values and ranges `a-b`, optionally with a step `/n`.
+// Months and days of the week may be given by their three-letter English names, Sunday is 0 or 7.
+// As in crontab(5), if neither day-of-month nor day-of-week starts with `*`,
+// a day matches if it matches either of them.
+type Cron struct {
+	spec                     string
+	minute, hour, dom, month uint64 // bit i is set if value i matches
+	dow                      uint64 // Sunday is bit 0
+	domStar, dowStar         bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] is value min+i
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day-of-week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+func ParseCron(spec string) (*Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		var err error
+		if bits[i], err = cronFields[i].parse(f); err != nil {
+			return nil, fmt.Errorf("%s %q: %s", cronFields[i].name, f, err)
+		}
+	}
+	c := &Cron{
+		spec:    spec,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule never matches")
+	}
+	return c, nil
+}
+
+func (f cronField) parse(s string) (bits uint64, _ error) {
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			var err error
+			rng = item[:i]
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", item[i+1:])
+			}
+		}
+		var from, to int
+		switch {
+		case rng == "*":
+			from, to = f.min, f.max
+		case strings.IndexByte(rng, '-') >= 0:
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if from, err = f.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if to, err = f.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+			if to < from {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			var err error
+			if from, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			to = from
+			if step != 1 {
+				to = f.max // `a/n` means `a-max/n`
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, n := range f.names {
+		if strings.EqualFold(s, n) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, must be in [%d, %d]", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (c *Cron) String() string { return c.spec }
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that matches the schedule, in t's location,
+// or the zero time if there is none within the next five years.
+//
+// The schedule applies to the wall-clock time of t's location, i.e., it is not affected by daylight saving time:
+// a wall-clock time that is skipped when the clocks go forward matches the first instant after the gap,
+// and a wall-clock time that occurs twice when the clocks go back only matches its first occurrence after t.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// wall-clock times are represented as UTC times with the same fields
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	limit := wall.AddDate(5, 0, 0)
+	for {
+		wall = c.nextWallClock(wall, limit)
+		if wall.IsZero() {
+			return wall
+		}
+		if next := wallClockInstant(wall, loc, t); !next.IsZero() {
+			return next
+		}
+	}
+}
+
+// nextWallClock is Next for wall-clock time w in UTC, it returns the zero time if there is no match before limit.
+func (c *Cron) nextWallClock(w, limit time.Time) time.Time {
+	w = w.Add(time.Minute)
+	for w.Before(limit) {
+		y, m, d := w.Date()
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			w = time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(w):
+			w = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(w.Hour())) == 0:
+			w = time.Date(y, m, d, w.Hour()+1, 0, 0, 0, time.UTC)
+		case c.minute&(1<<uint(w.Minute())) == 0:
+			w = w.Add(time.Minute)
+		default:
+			return w
+		}
+	}
+	return time.Time{}
+}
+
+// wallClockInstant returns the first instant after t at which the clocks of loc show wall-clock time w (in UTC),
+// or the end of the gap if the clocks of loc skip w.
+// It returns the zero time if w only occurs before t, i.e., if t is in the second occurrence of a repeated wall-clock time.
+func wallClockInstant(w time.Time, loc *time.Location, t time.Time) time.Time {
+	// a day before and after w, the offsets of loc are the ones before and after a transition at w, if any
+	_, offBefore := w.Add(-24 * time.Hour).In(loc).Zone()
+	_, offAfter := w.Add(24 * time.Hour).In(loc).Zone()
+	occurs := false
+	first := time.Time{}
+	for _, off := range []int{offBefore, offAfter} {
+		u := w.Add(-time.Duration(off) * time.Second).In(loc)
+		if _, o := u.Zone(); o != off {
+			continue // w does not occur with this offset
+		}
+		occurs = true
+		if u.After(t) && (first.IsZero() || u.Before(first)) {
+			first = u
+		}
+	}
+	if occurs {
+		return first
+	}
+	// w is in the gap between the instants lo and hi, find the transition
+	lo := w.Add(-time.Duration(offAfter) * time.Second)
+	hi := w.Add(-time.Duration(offBefore) * time.Second)
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if _, o := mid.In(loc).Zone(); o == offAfter {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	if gapEnd := hi.In(loc); gapEnd.After(t) {
+		return gapEnd
+	}
+	return time.Time{}
+}
@@ -0,0 +1,128 @@
+package trigger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"x * * * *",
+		"0 0 30 feb *",
+	} {
+		_, err := ParseCron(spec)
+		assert.Error(t, err, "%q", spec)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc := time.UTC
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+		require.NoError(t, err)
+		return tm
+	}
+
+	type next struct {
+		after, expect string
+	}
+	tcs := []struct {
+		spec string
+		next []next
+	}{
+		{"* * * * *", []next{
+			{"2020-09-07 10:00:00", "2020-09-07 10:01:00"},
+			{"2020-09-07 10:00:59", "2020-09-07 10:01:00"},
+		}},
+		// :00 and :30 on weekdays, hourly on weekends is two triggers
+		{"0,30 * * * 1-5", []next{
+			{"2020-09-07 10:00:00", "2020-09-07 10:30:00"}, // Monday
+			{"2020-09-07 10:30:00", "2020-09-07 11:00:00"},
+			{"2020-09-11 23:30:00", "2020-09-14 00:00:00"}, // Friday to Monday
+		}},
+		{"0 * * * sat,SUN", []next{
+			{"2020-09-11 23:30:00", "2020-09-12 00:00:00"},
+			{"2020-09-13 23:00:00", "2020-09-19 00:00:00"},
+		}},
+		{"*/15 2-4 * * *", []next{
+			{"2020-09-07 04:45:00", "2020-09-08 02:00:00"},
+			{"2020-09-07 02:14:00", "2020-09-07 02:15:00"},
+		}},
+		{"10/20 * * * *", []next{
+			{"2020-09-07 10:10:00", "2020-09-07 10:30:00"},
+			{"2020-09-07 10:50:00", "2020-09-07 11:10:00"},
+		}},
+		{"0 0 29 feb *", []next{
+			{"2020-03-01 00:00:00", "2024-02-29 00:00:00"},
+		}},
+		// either day-of-month or day-of-week
+		{"0 12 1 * 0", []next{
+			{"2020-09-01 12:00:00", "2020-09-06 12:00:00"}, // Sunday
+			{"2020-09-27 12:00:00", "2020-10-01 12:00:00"},
+		}},
+		// Sunday is also 7
+		{"0 0 * * 7", []next{
+			{"2020-09-07 00:00:00", "2020-09-13 00:00:00"},
+		}},
+		{"0 0 1 jan-mar/2 *", []next{
+			{"2020-01-01 00:00:00", "2020-03-01 00:00:00"},
+			{"2020-03-01 00:00:00", "2021-01-01 00:00:00"},
+		}},
+	}
+	for _, tc := range tcs {
+		c, err := ParseCron(tc.spec)
+		require.NoError(t, err, "%q", tc.spec)
+		for _, n := range tc.next {
+			assert.Equal(t, at(n.expect), c.Next(at(n.after)), "%q after %s", tc.spec, n.after)
+		}
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %s", err)
+	}
+	cest := time.FixedZone("CEST", 2*60*60)
+	cet := time.FixedZone("CET", 1*60*60)
+
+	type next struct {
+		spec          string
+		after, expect time.Time
+	}
+	for _, n := range []next{
+		// 2:30 does not exist on 2020-03-29, the clocks go from 2:00 CET to 3:00 CEST
+		{"30 2 * * *", time.Date(2020, 3, 28, 3, 0, 0, 0, cet), time.Date(2020, 3, 29, 3, 0, 0, 0, cest)},
+		{"30 2 * * *", time.Date(2020, 3, 29, 3, 0, 0, 0, cest), time.Date(2020, 3, 30, 2, 30, 0, 0, cest)},
+		{"*/15 * * * *", time.Date(2020, 3, 29, 1, 45, 0, 0, cet), time.Date(2020, 3, 29, 3, 0, 0, 0, cest)},
+		{"*/15 * * * *", time.Date(2020, 3, 29, 3, 0, 0, 0, cest), time.Date(2020, 3, 29, 3, 15, 0, 0, cest)},
+		// 2:30 exists twice on 2020-10-25, the clocks go from 3:00 CEST to 2:00 CET
+		{"30 2 * * *", time.Date(2020, 10, 25, 0, 0, 0, 0, cest), time.Date(2020, 10, 25, 2, 30, 0, 0, cest)},
+		{"30 2 * * *", time.Date(2020, 10, 25, 2, 30, 0, 0, cest), time.Date(2020, 10, 26, 2, 30, 0, 0, cet)},
+		{"0 * * * *", time.Date(2020, 10, 25, 2, 0, 0, 0, cest), time.Date(2020, 10, 25, 3, 0, 0, 0, cet)},
+		// a daemon that starts in the second occurrence
+		{"30 2 * * *", time.Date(2020, 10, 25, 2, 10, 0, 0, cet), time.Date(2020, 10, 25, 2, 30, 0, 0, cet)},
+		// daily schedules keep their wall-clock time across transitions
+		{"0 12 * * *", time.Date(2020, 3, 28, 12, 0, 0, 0, cet), time.Date(2020, 3, 29, 12, 0, 0, 0, cest)},
+		{"0 12 * * *", time.Date(2020, 10, 24, 12, 0, 0, 0, cest), time.Date(2020, 10, 25, 12, 0, 0, 0, cet)},
+	} {
+		c, err := ParseCron(n.spec)
+		require.NoError(t, err)
+		got := c.Next(n.after.In(loc))
+		assert.True(t, n.expect.Equal(got), "%q after %s: expected %s, got %s", n.spec, n.after, n.expect, got)
+		assert.Equal(t, loc, got.Location())
+	}
+}
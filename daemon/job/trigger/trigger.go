@@ -0,0 +1,211 @@
+// Package trigger implements the triggers that invoke push, pull, local and snap jobs (config field `triggers`).
+// The triggers replace the default trigger of the job, i.e., the snapshotting or the `interval` of pull jobs.
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func getLogger(ctx context.Context) logger.Logger {
+	return logging.GetLogger(ctx, logging.SubsysJob)
+}
+
+type trigger interface {
+	// run calls fire whenever the trigger fires, until ctx is done
+	run(ctx context.Context, fire func())
+	String() string
+}
+
+// List are the triggers of a job. A nil *List means that the job uses its default trigger.
+type List struct {
+	triggers []trigger
+	manual   bool
+}
+
+// FromConfig returns nil if in is empty.
+// fsf are the job's local filesystems, nil if the job has none (pull jobs).
+func FromConfig(in []config.TriggerEnum, fsf zfs.DatasetFilter) (*List, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	l := &List{}
+	for i, e := range in {
+		var t trigger
+		switch v := e.Ret.(type) {
+		case *config.TriggerPeriodic:
+			t = periodic(v.Interval)
+		case *config.TriggerCron:
+			c, err := ParseCron(v.Cron)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger #%d: invalid cron expression", i+1)
+			}
+			t = cron{c}
+		case *config.TriggerManual:
+			if len(in) > 1 {
+				return nil, fmt.Errorf("trigger #%d: type manual must be the only trigger", i+1)
+			}
+			l.manual = true
+			continue
+		case *config.TriggerFilesystemEvent:
+			if fsf == nil {
+				return nil, fmt.Errorf("trigger #%d: type filesystem_event requires the job's filesystems on this host", i+1)
+			}
+			t = &filesystemEvent{fsf: fsf, pollInterval: v.PollInterval}
+		default:
+			panic(fmt.Sprintf("implementation error: unknown trigger type %T", v))
+		}
+		l.triggers = append(l.triggers, t)
+	}
+	return l, nil
+}
+
+func (l *List) String() string {
+	if l.manual {
+		return "manual"
+	}
+	s := make([]string, len(l.triggers))
+	for i, t := range l.triggers {
+		s[i] = t.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Run starts the triggers and returns the channel on which the job is triggered, until ctx is done.
+// Triggers that the job did not pick up yet are coalesced.
+// Run returns a nil channel if l is nil or manual.
+func (l *List) Run(ctx context.Context) <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	if l.manual {
+		getLogger(ctx).Info("manual trigger configured, the job is only invoked by wakeups")
+		return nil
+	}
+	getLogger(ctx).WithField("triggers", l.String()).Info("start triggers")
+	c := make(chan struct{}, 1)
+	fire := func() {
+		select {
+		case c <- struct{}{}:
+		default:
+			getLogger(ctx).Debug("job is already triggered, coalescing the trigger")
+		}
+	}
+	for _, t := range l.triggers {
+		go t.run(ctx, fire)
+	}
+	return c
+}
+
+type periodic time.Duration
+
+func (p periodic) String() string { return fmt.Sprintf("periodic %s", time.Duration(p)) }
+
+func (p periodic) run(ctx context.Context, fire func()) {
+	t := time.NewTicker(time.Duration(p))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fire()
+		}
+	}
+}
+
+type cron struct{ *Cron }
+
+func (c cron) String() string { return fmt.Sprintf("cron %q", c.spec) }
+
+func (c cron) run(ctx context.Context, fire func()) {
+	for {
+		next := c.Next(time.Now())
+		if next.IsZero() {
+			getLogger(ctx).WithField("cron", c.spec).Error("cron schedule does not match any time within the next five years")
+			return
+		}
+		getLogger(ctx).WithField("cron", c.spec).WithField("next", next.Format(time.RFC3339)).Debug("wait for next cron trigger")
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+			fire()
+		}
+	}
+}
+
+// filesystemEvent polls the latest snapshot of each filesystem that fsf matches
+// and fires if a filesystem has a snapshot that is newer than at the previous poll.
+type filesystemEvent struct {
+	fsf          zfs.DatasetFilter
+	pollInterval time.Duration
+}
+
+func (e *filesystemEvent) String() string {
+	return fmt.Sprintf("filesystem_event (poll interval %s)", e.pollInterval)
+}
+
+func (e *filesystemEvent) run(ctx context.Context, fire func()) {
+	t := time.NewTicker(e.pollInterval)
+	defer t.Stop()
+	var prev map[string]uint64 // nil until the first successful poll
+	for {
+		cur, err := latestSnapshotTXGs(ctx, e.fsf)
+		if err != nil {
+			getLogger(ctx).WithError(err).Warn("cannot list snapshots for trigger filesystem_event")
+		} else {
+			if prev != nil && hasNewerSnapshot(prev, cur) {
+				getLogger(ctx).Info("snapshots created since the previous poll, triggering the job")
+				fire()
+			}
+			prev = cur
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// latestSnapshotTXGs returns the createtxg of the latest snapshot of each filesystem, 0 if it has none.
+func latestSnapshotTXGs(ctx context.Context, fsf zfs.DatasetFilter) (map[string]uint64, error) {
+	fss, err := zfs.ZFSListMapping(ctx, fsf)
+	if err != nil {
+		return nil, errors.Wrap(err, "list filesystems")
+	}
+	versions, err := zfs.ZFSListFilesystemVersionsBulk(ctx, fss, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return nil, errors.Wrap(err, "list snapshots")
+	}
+	res := make(map[string]uint64, len(versions))
+	for fs, vs := range versions {
+		for _, v := range vs {
+			if v.CreateTXG > res[fs] {
+				res[fs] = v.CreateTXG
+			}
+		}
+	}
+	return res, nil
+}
+
+func hasNewerSnapshot(prev, cur map[string]uint64) bool {
+	for fs, txg := range cur {
+		if txg > prev[fs] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,496 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// VerifyJob compares the snapshots that were replicated from this host to a sink
+// by computing the digest of the same zfs send stream on both sides (see zfs.SendStreamDigest).
+//
+// The job connects to the sink like the push job that replicates the filesystems,
+// and thus sees the same filesystems below the sink's root_fs.
+type VerifyJob struct {
+	name            endpoint.JobID
+	fsfilter        zfs.DatasetFilter
+	connecter       transport.Connecter
+	connectTimeouts rpc.ClientTimeouts
+	interval        config.PositiveDurationOrManual
+	snapshots       VerifySnapshots
+	raw             bool
+	logging         *logging.JobOutlets        // may be nil
+	weight          int                        // see package scheduler
+	certs           *transporttls.Certificates // see CertificatesJob
+
+	promMismatches   prometheus.Gauge
+	transportMetrics *transport.Metrics
+
+	mtx    sync.Mutex
+	report *VerifyReport
+	// pairs whose digests matched in a previous run are not verified again
+	verified map[verifyPairKey]*VerifyPairReport
+}
+
+// VerifySnapshots determines which of the snapshots that exist on both sides are verified.
+type VerifySnapshots string
+
+const (
+	// the incremental stream between the two most recent common snapshots,
+	// or the full stream if there is only one
+	VerifySnapshotsLatest VerifySnapshots = "latest"
+	// the full stream of the oldest common snapshot and the incremental streams
+	// between all consecutive common snapshots
+	VerifySnapshotsAll VerifySnapshots = "all"
+)
+
+func (j *VerifyJob) Name() string { return j.name.String() }
+
+func (j *VerifyJob) Logging() *logging.JobOutlets { return j.logging }
+
+func (j *VerifyJob) Weight() int { return j.weight }
+
+func (j *VerifyJob) Certificates() *transporttls.Certificates { return j.certs }
+
+func (j *VerifyJob) setCertificates(c *transporttls.Certificates) { j.certs = c }
+
+func (j *VerifyJob) Type() Type { return TypeVerify }
+
+func verifyJobFromConfig(g *config.Global, in *config.VerifyJob) (j *VerifyJob, err error) {
+	j = &VerifyJob{
+		interval: in.Interval,
+		raw:      in.Raw,
+		verified: make(map[verifyPairKey]*VerifyPairReport),
+	}
+	j.name, err = endpoint.MakeJobID(in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid job name")
+	}
+	if j.fsfilter, err = filters.DatasetMapFilterFromConfig(in.Filesystems); err != nil {
+		return nil, errors.Wrap(err, "cannot build filesystem filter")
+	}
+	if j.logging, err = logging.JobOutletsFromConfig(in.Logging); err != nil {
+		return nil, errors.Wrap(err, "field `logging`")
+	}
+	j.weight = in.Weight
+	if j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect); err != nil {
+		return nil, errors.Wrap(err, "cannot build client")
+	}
+	j.transportMetrics = transport.NewMetrics(j.name.String())
+	j.connecter = j.transportMetrics.Connecter(j.connecter, fromconfig.PeerFromConfig(in.Connect))
+	if j.connectTimeouts, err = connectTimeoutsFromConfig(in.Connect); err != nil {
+		return nil, errors.Wrap(err, "field `connect.timeouts`")
+	}
+	switch s := VerifySnapshots(in.Snapshots); s {
+	case VerifySnapshotsLatest, VerifySnapshotsAll:
+		j.snapshots = s
+	default:
+		return nil, errors.Errorf("field `snapshots`: invalid value %q, must be %q or %q", in.Snapshots, VerifySnapshotsLatest, VerifySnapshotsAll)
+	}
+	j.promMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "verify",
+		Name:        "mismatches",
+		Help:        "number of snapshot pairs whose send stream digests did not match in the latest verification",
+		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
+	})
+	return j, nil
+}
+
+func (j *VerifyJob) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.promMismatches)
+	j.transportMetrics.Register(registerer)
+}
+
+type VerifyJobStatus struct {
+	Report *VerifyReport // nil if the job has not run yet
+}
+
+type VerifyReport struct {
+	StartAt, FinishAt time.Time
+	Err               string // e.g. cannot list filesystems on the sink
+	Filesystems       []*VerifyFilesystemReport
+}
+
+type VerifyFilesystemReport struct {
+	Name  string
+	Err   string
+	Pairs []*VerifyPairReport
+}
+
+type VerifyPairState string
+
+const (
+	VerifyPairPending  VerifyPairState = "pending"
+	VerifyPairMatch    VerifyPairState = "match"
+	VerifyPairMismatch VerifyPairState = "mismatch"
+	VerifyPairError    VerifyPairState = "error"
+)
+
+type VerifyPairReport struct {
+	From           string // empty for full streams
+	To             string
+	State          VerifyPairState
+	Err            string
+	SenderDigest   string
+	ReceiverDigest string
+	StreamSize     int64
+	VerifiedAt     time.Time
+}
+
+// Mismatches returns the number of mismatching pairs and of pairs that could not be verified.
+func (r *VerifyReport) Mismatches() (mismatches, errs int) {
+	for _, fs := range r.Filesystems {
+		if fs.Err != "" {
+			errs++
+		}
+		for _, p := range fs.Pairs {
+			switch p.State {
+			case VerifyPairMismatch:
+				mismatches++
+			case VerifyPairError:
+				errs++
+			}
+		}
+	}
+	return mismatches, errs
+}
+
+func (j *VerifyJob) Status() *Status {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	s := &VerifyJobStatus{}
+	if j.report != nil {
+		// deep copy because the running verification updates the report
+		r := *j.report
+		r.Filesystems = make([]*VerifyFilesystemReport, len(j.report.Filesystems))
+		for i, fs := range j.report.Filesystems {
+			fsCopy := *fs
+			fsCopy.Pairs = make([]*VerifyPairReport, len(fs.Pairs))
+			for k, p := range fs.Pairs {
+				pCopy := *p
+				fsCopy.Pairs[k] = &pCopy
+			}
+			r.Filesystems[i] = &fsCopy
+		}
+		s.Report = &r
+	}
+	return &Status{Type: j.Type(), JobSpecific: s}
+}
+
+func (j *VerifyJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
+	return nil, false
+}
+
+func (j *VerifyJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *VerifyJob) Run(ctx context.Context) {
+	ctx, endTask := trace.WithTaskAndSpan(ctx, "verify-job", j.Name())
+	defer endTask()
+	log := GetLogger(ctx)
+
+	defer log.Info("job exiting")
+
+	var periodic <-chan time.Time
+	if j.interval.Manual {
+		log.Info("manual verification configured, periodic verification disabled")
+	} else {
+		t := time.NewTicker(j.interval.Interval)
+		defer t.Stop()
+		periodic = t.C
+	}
+
+	invocationCount := 0
+outer:
+	for {
+		log.Info("wait for wakeups")
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Info("context")
+			break outer
+		case <-stop.Wait(ctx):
+			log.Info("stop requested")
+			break outer
+
+		case <-wakeup.Wait(ctx):
+		case <-periodic:
+		}
+		invocationCount++
+
+		invocationCtx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("invocation-%d", invocationCount))
+		j.doVerify(invocationCtx)
+		endSpan()
+	}
+}
+
+func (j *VerifyJob) doVerify(ctx context.Context) {
+	sender := endpoint.NewSender(endpoint.SenderConfig{
+		JobID: j.name,
+		FSF:   j.fsfilter,
+		// irrelevant, the sender endpoint is only used for listing and SendStreamDigest
+		Encrypt: &zfs.NilBool{B: false},
+	})
+	// only used for listing and SendStreamDigest, no streams are transferred
+	receiver := rpc.NewClient(j.connecter, compression.Config{}, j.connectTimeouts, rpc.GetLoggersOrPanic(ctx))
+	defer receiver.Close()
+
+	j.verify(ctx, sender, receiver)
+}
+
+// verifyEndpoint is implemented by endpoint.Sender, endpoint.Receiver and rpc.Client
+type verifyEndpoint interface {
+	ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error)
+	ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error)
+	SendStreamDigest(ctx context.Context, req *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error)
+}
+
+type verifyPairKey struct {
+	fs       string
+	from, to uint64 // guids, from is 0 for full streams
+}
+
+type verifyPair struct {
+	from, to *pdu.FilesystemVersion // from is nil for full streams
+}
+
+func (j *VerifyJob) verify(ctx context.Context, sender, receiver verifyEndpoint) {
+	log := GetLogger(ctx)
+
+	rep := &VerifyReport{StartAt: time.Now()}
+	j.mtx.Lock()
+	j.report = rep
+	j.mtx.Unlock()
+	update := func(f func()) {
+		j.mtx.Lock()
+		defer j.mtx.Unlock()
+		f()
+	}
+	defer update(func() { rep.FinishAt = time.Now() })
+
+	log.Info("start verification")
+	fss, err := verifyListFilesystems(ctx, sender, receiver)
+	if err != nil {
+		log.WithError(err).Error("cannot list filesystems")
+		update(func() { rep.Err = err.Error() })
+		j.promMismatches.Set(0)
+		return
+	}
+
+	// plan all filesystems first so that the status shows the total amount of work
+	fsPairs := make([][]verifyPair, len(fss))
+	planned := make(map[verifyPairKey]bool)
+	planErr := make(map[string]bool)
+	for i, fs := range fss {
+		fsRep := &VerifyFilesystemReport{Name: fs}
+		pairs, err := j.planFilesystem(ctx, sender, receiver, fs)
+		if err != nil {
+			log.WithField("filesystem", fs).WithError(err).Error("cannot determine common snapshots")
+			fsRep.Err = err.Error()
+			planErr[fs] = true
+		}
+		fsPairs[i] = pairs
+		for _, p := range pairs {
+			planned[verifyPairKey{fs, p.from.GetGuid(), p.to.GetGuid()}] = true
+			fsRep.Pairs = append(fsRep.Pairs, &VerifyPairReport{
+				From:  verifyRelName(p.from),
+				To:    p.to.RelName(),
+				State: VerifyPairPending,
+			})
+		}
+		update(func() { rep.Filesystems = append(rep.Filesystems, fsRep) })
+	}
+	// forget the pairs of filesystems and snapshots that no longer exist (or are no longer verified),
+	// but not those of filesystems whose snapshots could not be listed this time
+	update(func() {
+		for key := range j.verified {
+			if !planned[key] && !planErr[key.fs] {
+				delete(j.verified, key)
+			}
+		}
+	})
+
+	for i, fs := range fss {
+		for k, p := range fsPairs[i] {
+			pairRep := rep.Filesystems[i].Pairs[k]
+			key := verifyPairKey{fs, p.from.GetGuid(), p.to.GetGuid()}
+			j.mtx.Lock()
+			prev, ok := j.verified[key]
+			if ok {
+				*pairRep = *prev
+			}
+			j.mtx.Unlock()
+			if ok {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			res := j.verifyPair(ctx, sender, receiver, fs, p)
+			update(func() {
+				*pairRep = *res
+				if res.State == VerifyPairMatch {
+					j.verified[key] = res
+				}
+			})
+		}
+	}
+
+	mismatches, errs := rep.Mismatches()
+	j.promMismatches.Set(float64(mismatches))
+	log.WithField("mismatches", mismatches).WithField("errors", errs).Info("finished verification")
+}
+
+// verifyListFilesystems returns the filesystems that exist on the sender and were received by the receiver.
+func verifyListFilesystems(ctx context.Context, sender, receiver verifyEndpoint) ([]string, error) {
+	sfss, err := sender.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		return nil, errors.Wrap(err, "sender")
+	}
+	rfss, err := receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		return nil, errors.Wrap(err, "receiver")
+	}
+	received := make(map[string]bool, len(rfss.GetFilesystems()))
+	for _, fs := range rfss.GetFilesystems() {
+		received[fs.GetPath()] = !fs.GetIsPlaceholder()
+	}
+	var fss []string
+	for _, fs := range sfss.GetFilesystems() {
+		if received[fs.GetPath()] {
+			fss = append(fss, fs.GetPath())
+		}
+	}
+	sort.Strings(fss)
+	return fss, nil
+}
+
+func (j *VerifyJob) planFilesystem(ctx context.Context, sender, receiver verifyEndpoint, fs string) ([]verifyPair, error) {
+	req := &pdu.ListFilesystemVersionsReq{Filesystem: fs}
+	svs, err := sender.ListFilesystemVersions(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "sender")
+	}
+	rvs, err := receiver.ListFilesystemVersions(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "receiver")
+	}
+	return verifyPairsFromVersions(svs.GetVersions(), rvs.GetVersions(), j.snapshots), nil
+}
+
+// verifyPairsFromVersions returns the pairs of snapshots that exist on both sides (same GUID)
+// that must be verified according to policy.
+func verifyPairsFromVersions(sender, receiver []*pdu.FilesystemVersion, policy VerifySnapshots) []verifyPair {
+	received := make(map[uint64]bool, len(receiver))
+	for _, v := range receiver {
+		if v.Type == pdu.FilesystemVersion_Snapshot {
+			received[v.GetGuid()] = true
+		}
+	}
+	var common []*pdu.FilesystemVersion
+	for _, v := range sender {
+		if v.Type == pdu.FilesystemVersion_Snapshot && received[v.GetGuid()] {
+			common = append(common, v)
+		}
+	}
+	sort.Slice(common, func(i, j int) bool {
+		return common[i].CreateTXG < common[j].CreateTXG
+	})
+
+	var pairs []verifyPair
+	switch {
+	case len(common) == 0:
+	case policy == VerifySnapshotsLatest && len(common) >= 2:
+		pairs = append(pairs, verifyPair{common[len(common)-2], common[len(common)-1]})
+	case policy == VerifySnapshotsLatest:
+		pairs = append(pairs, verifyPair{nil, common[0]})
+	default:
+		pairs = append(pairs, verifyPair{nil, common[0]})
+		for i := 1; i < len(common); i++ {
+			pairs = append(pairs, verifyPair{common[i-1], common[i]})
+		}
+	}
+	return pairs
+}
+
+func (j *VerifyJob) verifyPair(ctx context.Context, sender, receiver verifyEndpoint, fs string, p verifyPair) *VerifyPairReport {
+	log := GetLogger(ctx).WithField("filesystem", fs).WithField("from", verifyRelName(p.from)).WithField("to", p.to.RelName())
+	res := &VerifyPairReport{
+		From:       verifyRelName(p.from),
+		To:         p.to.RelName(),
+		VerifiedAt: time.Now(),
+	}
+	req := &pdu.SendStreamDigestReq{
+		Filesystem: fs,
+		From:       p.from,
+		To:         p.to,
+		Raw:        j.raw,
+	}
+
+	log.Debug("compute send stream digests")
+	// both sides stream concurrently
+	var (
+		senderRes, receiverRes *pdu.SendStreamDigestRes
+		senderErr, receiverErr error
+	)
+	_, add, wait := trace.WithTaskGroup(ctx, "digests")
+	add(func(ctx context.Context) {
+		senderRes, senderErr = sender.SendStreamDigest(ctx, req)
+	})
+	add(func(ctx context.Context) {
+		receiverRes, receiverErr = receiver.SendStreamDigest(ctx, req)
+	})
+	wait()
+
+	if senderErr != nil {
+		res.State, res.Err = VerifyPairError, fmt.Sprintf("sender: %s", senderErr)
+	} else if receiverErr != nil {
+		res.State, res.Err = VerifyPairError, fmt.Sprintf("receiver: %s", receiverErr)
+	}
+	if res.State == VerifyPairError {
+		log.WithField("err", res.Err).Error("cannot verify snapshot")
+		return res
+	}
+
+	res.SenderDigest = senderRes.GetDigest()
+	res.ReceiverDigest = receiverRes.GetDigest()
+	res.StreamSize = senderRes.GetStreamSize()
+	if res.SenderDigest != res.ReceiverDigest {
+		res.State = VerifyPairMismatch
+		log.WithField("sender_digest", res.SenderDigest).WithField("receiver_digest", res.ReceiverDigest).
+			Error("send stream digests of sender and receiver do not match")
+	} else {
+		res.State = VerifyPairMatch
+		log.WithField("digest", res.SenderDigest).Info("send stream digests match")
+	}
+	return res
+}
+
+// v may be nil (full streams)
+func verifyRelName(v *pdu.FilesystemVersion) string {
+	if v == nil {
+		return ""
+	}
+	return v.RelName()
+}
@@ -0,0 +1,138 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+type verifyTestEndpoint struct {
+	fss      []*pdu.Filesystem
+	versions map[string][]*pdu.FilesystemVersion
+	digests  map[string]string // key: fs@to, missing entries fail
+	calls    int
+}
+
+func (e *verifyTestEndpoint) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	return &pdu.ListFilesystemRes{Filesystems: e.fss}, nil
+}
+
+func (e *verifyTestEndpoint) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return &pdu.ListFilesystemVersionsRes{Versions: e.versions[req.GetFilesystem()]}, nil
+}
+
+func (e *verifyTestEndpoint) SendStreamDigest(ctx context.Context, req *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error) {
+	e.calls++
+	key := req.GetFilesystem() + req.GetTo().RelName()
+	d, ok := e.digests[key]
+	if !ok {
+		return nil, fmt.Errorf("cannot send %s", key)
+	}
+	return &pdu.SendStreamDigestRes{Digest: d, StreamSize: 23}, nil
+}
+
+func verifyTestSnap(name string, guid uint64) *pdu.FilesystemVersion {
+	return &pdu.FilesystemVersion{
+		Type:      pdu.FilesystemVersion_Snapshot,
+		Name:      name,
+		Guid:      guid,
+		CreateTXG: guid,
+		Creation:  "2020-01-01T00:00:00Z",
+	}
+}
+
+func TestVerifyPairsFromVersions(t *testing.T) {
+	a, b, c := verifyTestSnap("a", 1), verifyTestSnap("b", 2), verifyTestSnap("c", 3)
+	bookmark := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: "c", Guid: 3, CreateTXG: 3}
+	sender := []*pdu.FilesystemVersion{c, a, b} // order must not matter
+	receiver := []*pdu.FilesystemVersion{a, b, verifyTestSnap("other", 4)}
+
+	assert.Equal(t, []verifyPair{{a, b}}, verifyPairsFromVersions(sender, receiver, VerifySnapshotsLatest))
+	assert.Equal(t, []verifyPair{{nil, a}, {a, b}}, verifyPairsFromVersions(sender, receiver, VerifySnapshotsAll))
+	assert.Equal(t, []verifyPair{{nil, a}}, verifyPairsFromVersions(sender, []*pdu.FilesystemVersion{a, bookmark}, VerifySnapshotsLatest))
+	assert.Empty(t, verifyPairsFromVersions(sender, nil, VerifySnapshotsAll))
+}
+
+func TestVerifyJob(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	a, b := verifyTestSnap("a", 1), verifyTestSnap("b", 2)
+	sender := &verifyTestEndpoint{
+		fss: []*pdu.Filesystem{{Path: "pool/ok"}, {Path: "pool/bad"}, {Path: "pool/notreplicated"}, {Path: "pool/err"}},
+		versions: map[string][]*pdu.FilesystemVersion{
+			"pool/ok":  {a, b},
+			"pool/bad": {a, b},
+			"pool/err": {a},
+		},
+		digests: map[string]string{"pool/ok@a": "1", "pool/ok@b": "2", "pool/bad@a": "3", "pool/bad@b": "4", "pool/err@a": "5"},
+	}
+	receiver := &verifyTestEndpoint{
+		fss: []*pdu.Filesystem{{Path: "pool/ok"}, {Path: "pool/bad"}, {Path: "pool/err"}, {Path: "pool", IsPlaceholder: true}},
+		versions: map[string][]*pdu.FilesystemVersion{
+			"pool/ok":  {a, b},
+			"pool/bad": {a, b},
+			"pool/err": {a},
+		},
+		digests: map[string]string{"pool/ok@a": "1", "pool/ok@b": "2", "pool/bad@a": "3", "pool/bad@b": "corrupted"},
+	}
+
+	j := &VerifyJob{
+		snapshots:      VerifySnapshotsAll,
+		verified:       make(map[verifyPairKey]*VerifyPairReport),
+		promMismatches: prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"}),
+	}
+	j.verify(ctx, sender, receiver)
+
+	rep := j.Status().JobSpecific.(*VerifyJobStatus).Report
+	require.NotNil(t, rep)
+	assert.False(t, rep.FinishAt.IsZero())
+	states := make(map[string][]VerifyPairState)
+	for _, fs := range rep.Filesystems {
+		for _, p := range fs.Pairs {
+			states[fs.Name] = append(states[fs.Name], p.State)
+		}
+	}
+	assert.Equal(t, map[string][]VerifyPairState{
+		"pool/bad": {VerifyPairMatch, VerifyPairMismatch},
+		"pool/err": {VerifyPairError},
+		"pool/ok":  {VerifyPairMatch, VerifyPairMatch},
+	}, states)
+	mismatches, errs := rep.Mismatches()
+	assert.Equal(t, 1, mismatches)
+	assert.Equal(t, 1, errs)
+	assert.Equal(t, 5, receiver.calls)
+
+	// matching pairs are not verified again
+	j.verify(ctx, sender, receiver)
+	assert.Equal(t, 5+2, receiver.calls)
+	rep = j.Status().JobSpecific.(*VerifyJobStatus).Report
+	mismatches, _ = rep.Mismatches()
+	assert.Equal(t, 1, mismatches)
+	assert.Len(t, j.verified, 3)
+
+	// the pairs of destroyed snapshots and filesystems are forgotten
+	c := verifyTestSnap("c", 3)
+	sender.versions["pool/ok"] = []*pdu.FilesystemVersion{b, c}
+	receiver.versions["pool/ok"] = []*pdu.FilesystemVersion{b, c}
+	sender.digests["pool/ok@c"], receiver.digests["pool/ok@c"] = "6", "6"
+	sender.fss = sender.fss[:1]
+	j.verify(ctx, sender, receiver)
+	assert.Equal(t, map[verifyPairKey]bool{
+		{"pool/ok", 0, 2}: true,
+		{"pool/ok", 2, 3}: true,
+	}, func() map[verifyPairKey]bool {
+		keys := make(map[verifyPairKey]bool)
+		for k := range j.verified {
+			keys[k] = true
+		}
+		return keys
+	}())
+}
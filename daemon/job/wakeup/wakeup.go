@@ -9,23 +9,29 @@ type contextKey int
 
 const contextKeyWakeup contextKey = iota
 
-func Wait(ctx context.Context) <-chan struct{} {
-	wc, ok := ctx.Value(contextKeyWakeup).(chan struct{})
+// Request is delivered to the job for every wakeup.
+type Request struct {
+	// if non-empty, the job only replicates these filesystems (see driver.FilesystemSelection)
+	Filesystems []string
+}
+
+func Wait(ctx context.Context) <-chan Request {
+	wc, ok := ctx.Value(contextKeyWakeup).(chan Request)
 	if !ok {
-		wc = make(chan struct{})
+		wc = make(chan Request)
 	}
 	return wc
 }
 
-type Func func() error
+type Func func(filesystems ...string) error
 
 var AlreadyWokenUp = errors.New("already woken up")
 
 func Context(ctx context.Context) (context.Context, Func) {
-	wc := make(chan struct{})
-	wuf := func() error {
+	wc := make(chan Request)
+	wuf := func(filesystems ...string) error {
 		select {
-		case wc <- struct{}{}:
+		case wc <- Request{Filesystems: filesystems}:
 			return nil
 		default:
 			return AlreadyWokenUp
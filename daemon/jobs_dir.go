@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// jobsDir persists the jobs created through the control socket (field `global.control.jobs_dir`).
+// Each job is stored in file <name>.yml, with the spec as it was submitted,
+// in the schema of the entries of the config file's field `jobs`.
+type jobsDir struct {
+	path string
+}
+
+const jobsDirSuffix = ".yml"
+
+// newJobsDir returns nil if path is empty, i.e., if jobs cannot be created at runtime.
+func newJobsDir(path string) (*jobsDir, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		return nil, errors.Errorf("field `global.control.jobs_dir` must be an absolute path: %q", path)
+	}
+	// the specs may contain hook commands, like the config file
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot create jobs directory")
+	}
+	return &jobsDir{path: path}, nil
+}
+
+func (d *jobsDir) file(name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return "", errors.Errorf("invalid job name %q", name)
+	}
+	return filepath.Join(d.path, name+jobsDirSuffix), nil
+}
+
+// specs returns the persisted specs by job name. d may be nil.
+func (d *jobsDir) specs() (map[string][]byte, error) {
+	specs := make(map[string][]byte)
+	if d == nil {
+		return specs, nil
+	}
+	entries, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read jobs directory")
+	}
+	for _, e := range entries {
+		// skips the temporary files of write
+		if !e.Mode().IsRegular() || !strings.HasSuffix(e.Name(), jobsDirSuffix) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		spec, err := ioutil.ReadFile(filepath.Join(d.path, e.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read job spec")
+		}
+		specs[strings.TrimSuffix(e.Name(), jobsDirSuffix)] = spec
+	}
+	return specs, nil
+}
+
+// load parses the persisted jobs, sorted by name. d may be nil.
+func (d *jobsDir) load() ([]config.JobEnum, error) {
+	specs, err := d.specs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	jobs := make([]config.JobEnum, 0, len(names))
+	for _, name := range names {
+		j, err := config.ParseJobBytes(specs[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse job spec %q", name+jobsDirSuffix)
+		}
+		if j.Name() != name {
+			return nil, errors.Errorf("job spec %q defines job %q", name+jobsDirSuffix, j.Name())
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// write replaces the spec of job name atomically.
+func (d *jobsDir) write(name string, spec []byte) error {
+	path, err := d.file(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(d.path, "."+name)
+	if err != nil {
+		return errors.Wrap(err, "cannot write job spec")
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed
+	if _, err := tmp.Write(spec); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "cannot write job spec")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "cannot write job spec")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "cannot write job spec")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "cannot write job spec")
+}
+
+func (d *jobsDir) remove(name string) error {
+	path, err := d.file(name)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.Remove(path), "cannot remove job spec")
+}
+
+// withJobs returns a copy of conf, the config parsed from the config file, that also contains jobs.
+func withJobs(conf *config.Config, jobs []config.JobEnum) (*config.Config, error) {
+	inFile := make(map[string]bool, len(conf.Jobs))
+	for _, j := range conf.Jobs {
+		inFile[j.Name()] = true
+	}
+	for _, j := range jobs {
+		if inFile[j.Name()] {
+			return nil, errors.Errorf("job %q is defined both in the config file and in field `global.control.jobs_dir`", j.Name())
+		}
+	}
+	merged := *conf
+	merged.Jobs = append(append([]config.JobEnum(nil), conf.Jobs...), jobs...)
+	return &merged, nil
+}
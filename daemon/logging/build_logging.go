@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"io"
 	"log/syslog"
 	"os"
+	"path/filepath"
 
 	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
@@ -234,6 +236,12 @@ func ParseOutlet(in config.LoggingOutletEnum) (o logger.Outlet, level logger.Lev
 			break
 		}
 		o, err = parseSyslogOutlet(v, f)
+	case *config.FileLoggingOutlet:
+		level, f, err = parseCommon(v.LoggingOutletCommon)
+		if err != nil {
+			break
+		}
+		o, err = parseFileOutlet(v, f)
 	default:
 		panic(v)
 	}
@@ -301,3 +309,72 @@ func parseSyslogOutlet(in *config.SyslogLoggingOutlet, formatter EntryFormatter)
 	out.RetryInterval = in.RetryInterval
 	return out, nil
 }
+
+func parseFileOutlet(in *config.FileLoggingOutlet, formatter EntryFormatter) (*FileOutlet, error) {
+	if !filepath.IsAbs(in.Path) {
+		return nil, errors.Errorf("field 'path' must be an absolute path, got %q", in.Path)
+	}
+	formatter.SetMetadataFlags(MetadataAll &^ MetadataColor)
+	return NewFileOutlet(formatter, in.Path), nil
+}
+
+// JobOutlets are the outlets of a job's `logging` field.
+// Unlike the global outlets, they are closed when the job exits, e.g., because a reload removed it.
+type JobOutlets struct {
+	outlets []logger.Outlet
+	levels  []logger.Level
+}
+
+// JobOutletsFromConfig builds the outlets of a job's `logging` field, nil if in is empty.
+// Only file and syslog outlets are supported, they connect on their first entry.
+func JobOutletsFromConfig(in []config.LoggingOutletEnum) (*JobOutlets, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	o := &JobOutlets{}
+	for i, le := range in {
+		switch le.Ret.(type) {
+		case *config.FileLoggingOutlet, *config.SyslogLoggingOutlet:
+		default:
+			return nil, errors.Errorf("outlet #%d: only 'file' and 'syslog' outlets are supported for jobs", i)
+		}
+		outlet, level, err := ParseOutlet(le)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse outlet #%d", i)
+		}
+		o.outlets = append(o.outlets, outlet)
+		o.levels = append(o.levels, level)
+	}
+	return o, nil
+}
+
+// WithLoggers returns a ctx whose loggers (see WithLoggers) also log to o.
+// o may be nil.
+func (o *JobOutlets) WithLoggers(ctx context.Context) context.Context {
+	if o == nil {
+		return ctx
+	}
+	loggers := make(SubsystemLoggers)
+	for subsys, l := range GetLoggers(ctx) {
+		for i := range o.outlets {
+			l = l.WithOutlet(o.outlets[i], o.levels[i])
+		}
+		loggers[subsys] = l
+	}
+	return WithLoggers(ctx, loggers)
+}
+
+// Close closes the outlets, later entries are dropped.
+// o may be nil.
+func (o *JobOutlets) Close() error {
+	if o == nil {
+		return nil
+	}
+	var firstErr error
+	for _, outlet := range o.outlets {
+		if err := outlet.(io.Closer).Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
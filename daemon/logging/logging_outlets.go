@@ -7,6 +7,8 @@ import (
 	"io"
 	"log/syslog"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -132,11 +134,18 @@ type SyslogOutlet struct {
 	Formatter          EntryFormatter
 	RetryInterval      time.Duration
 	Facility           syslog.Priority
+	mtx                sync.Mutex // protects the fields below, see Close
 	writer             *syslog.Writer
 	lastConnectAttempt time.Time
+	closed             bool
 }
 
 func (o *SyslogOutlet) WriteEntry(entry logger.Entry) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.closed {
+		return nil // the job that owned the outlet exited, see JobOutlets
+	}
 
 	bytes, err := o.Formatter.Format(&entry)
 	if err != nil {
@@ -172,3 +181,122 @@ func (o *SyslogOutlet) WriteEntry(entry logger.Entry) error {
 	}
 
 }
+
+// Close closes the connection to syslog, later entries are dropped.
+func (o *SyslogOutlet) Close() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.closed = true
+	if o.writer == nil {
+		return nil
+	}
+	err := o.writer.Close()
+	o.writer = nil
+	return err
+}
+
+// FileOutlet appends to the file at Path, which it opens on the first entry.
+// See ReopenFileOutlets for log rotation.
+type FileOutlet struct {
+	formatter EntryFormatter
+	path      string
+
+	mtx    sync.Mutex
+	file   *os.File // nil until the next entry after construction or Reopen
+	closed bool
+}
+
+func NewFileOutlet(formatter EntryFormatter, path string) *FileOutlet {
+	return &FileOutlet{formatter: formatter, path: path}
+}
+
+func (o *FileOutlet) String() string { return o.path }
+
+func (o *FileOutlet) WriteEntry(entry logger.Entry) error {
+	bytes, err := o.formatter.Format(&entry)
+	if err != nil {
+		return err
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.closed {
+		return nil // the job that owned the outlet exited, see JobOutlets
+	}
+	if o.file == nil {
+		o.file, err = os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			o.file = nil
+			return err
+		}
+		fileOutlets.register(o)
+	}
+	_, err = o.file.Write(append(bytes, '\n'))
+	return err
+}
+
+// Reopen closes the file so that the next entry opens it again, e.g., after logrotate moved it.
+func (o *FileOutlet) Reopen() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+// Close closes the file, later entries are dropped.
+func (o *FileOutlet) Close() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.closed = true
+	fileOutlets.unregister(o)
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+// fileOutlets are the FileOutlets that opened their file, for ReopenFileOutlets.
+// Outlets register lazily so that outlets that are built for validation only need not be closed.
+var fileOutlets = fileOutletRegistry{outlets: make(map[*FileOutlet]struct{})}
+
+type fileOutletRegistry struct {
+	mtx     sync.Mutex
+	outlets map[*FileOutlet]struct{}
+}
+
+func (r *fileOutletRegistry) register(o *FileOutlet) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.outlets[o] = struct{}{}
+}
+
+func (r *fileOutletRegistry) unregister(o *FileOutlet) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.outlets, o)
+}
+
+// ReopenFileOutlets makes all FileOutlets reopen their file on the next entry, see FileOutlet.Reopen.
+// It returns the first error, but reopens all outlets regardless.
+func ReopenFileOutlets() error {
+	fileOutlets.mtx.Lock()
+	outlets := make([]*FileOutlet, 0, len(fileOutlets.outlets))
+	for o := range fileOutlets.outlets {
+		outlets = append(outlets, o)
+	}
+	fileOutlets.mtx.Unlock()
+
+	var firstErr error
+	for _, o := range outlets {
+		if err := o.Reopen(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "cannot close log file %q", o.path)
+		}
+	}
+	return firstErr
+}
@@ -13,6 +13,6 @@ var DaemonCmd = &cli.Subcommand{
 	Use:   "daemon",
 	Short: "run the zrepl daemon",
 	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
-		return Run(ctx, subcommand.Config())
+		return Run(ctx, subcommand.Config(), subcommand.ConfigPath())
 	},
 }
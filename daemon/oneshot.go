@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/cli"
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/stop"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+var OneshotCmd = &cli.Subcommand{
+	Use:   "oneshot JOB",
+	Short: "run a push, pull, local or snap job once in the foreground, exit non-zero if it failed",
+	Run: func(ctx context.Context, subcommand *cli.Subcommand, args []string) error {
+		if len(args) != 1 {
+			return errors.New("expected exactly one argument: the name of the job")
+		}
+		return RunOneshot(ctx, subcommand.Config(), args[0])
+	},
+}
+
+// RunOneshot runs the job jobName of conf once, see job.OneshotJob.
+func RunOneshot(ctx context.Context, conf *config.Config, jobName string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ctx, log, confJobs, err := setup(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	var j job.OneshotJob
+	for _, cj := range confJobs {
+		if cj.Name() != jobName {
+			continue
+		}
+		var ok bool
+		if j, ok = cj.(job.OneshotJob); !ok {
+			return errors.Errorf("job %q cannot run once, only push, pull, local and snap jobs can", jobName)
+		}
+	}
+	if j == nil {
+		return errors.Errorf("job %q not defined in config", jobName)
+	}
+
+	// the metrics are not exposed, but the job requires them to be registered
+	j.RegisterMetrics(prometheus.NewRegistry())
+
+	ctx = logging.WithInjectedField(ctx, logging.JobField, j.Name())
+	ctx = zfscmd.WithJobID(ctx, j.Name())
+	ctx, stopFunc := stop.Context(ctx)
+
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+		}
+		log.Info("received signal, stopping job, send again to abort")
+		stopFunc()
+		select {
+		case <-ctx.Done():
+		case <-sigChan:
+			log.Info("received signal, aborting job")
+			cancel()
+		}
+	}()
+
+	log.WithField("job", j.Name()).Info("running job once")
+	if err := j.Once(ctx); err != nil {
+		return errors.Wrapf(err, "job %q failed", j.Name())
+	}
+	log.WithField("job", j.Name()).Info("job finished successfully")
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/ready"
 	"github.com/zrepl/zrepl/daemon/logging"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
@@ -66,11 +67,15 @@ func (j *prometheusJob) Run(ctx context.Context) {
 
 	log := job.GetLogger(ctx)
 
+	// the inventory is only useful if someone scrapes it, hence it is driven by the prometheus job
+	go endpoint.RunAbstractionsInventoryMetrics(ctx)
+
 	l, err := tcpsock.Listen(j.listen, j.freeBind)
 	if err != nil {
 		log.WithError(err).Error("cannot listen")
 		return
 	}
+	ready.Ready(ctx)
 	go func() {
 		<-ctx.Done()
 		l.Close()
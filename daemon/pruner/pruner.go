@@ -12,11 +12,16 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/hooks"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/daemon/scheduler"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/pruning"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/util/ratelimit"
 )
 
 // Try to keep it compatible with github.com/zrepl/zrepl/endpoint.Endpoint
@@ -32,6 +37,25 @@ type Target interface {
 	DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error)
 }
 
+// A Target that implements SpaceReclaimWaiter supports waiting until the space of the
+// destroyed snapshots has been freed (ZFS frees it in the background after the destroy returns).
+//
+// Implemented by the local endpoints (github.com/zrepl/zrepl/endpoint), not by remote targets.
+type SpaceReclaimWaiter interface {
+	WaitForSpaceReclaim(ctx context.Context, fss []string) error
+}
+
+// A Target that implements LastReceivedLister reports the snapshot that it received most recently,
+// i.e., the one that its last-received-hold holds. For keep rule `not_replicated`,
+// that snapshot marks the replication state of the Target like the History's replication cursor does,
+// and takes precedence over the cursor if it is more recent or if the cursor is unavailable.
+//
+// Implemented by the local endpoint.Receiver, i.e., the receiving side of a pull job, not by remote targets.
+type LastReceivedLister interface {
+	// LastReceived returns nil if fs has no last-received-hold
+	LastReceived(ctx context.Context, fs string) (*pdu.FilesystemVersion, error)
+}
+
 type Logger = logger.Logger
 
 type contextKey int
@@ -46,13 +70,18 @@ func GetLogger(ctx context.Context) Logger {
 }
 
 type args struct {
-	ctx                            context.Context
-	target                         Target
-	receiver                       History
-	rules                          []pruning.KeepRule
-	retryWait                      time.Duration
-	considerSnapAtCursorReplicated bool
-	promPruneSecs                  prometheus.Observer
+	ctx                 context.Context
+	target              Target
+	receiver            History
+	rules               *keepRules
+	bookmarkRules       *ruleSet // nil if bookmarks are not pruned
+	retryWait           time.Duration
+	promPruneSecs       prometheus.Observer
+	waitForSpaceReclaim bool
+	deferClones         bool
+	limits              execLimits
+	// plan only, see DryRun
+	dryRun bool
 }
 
 type Pruner struct {
@@ -67,67 +96,206 @@ type Pruner struct {
 
 	// State Exec
 	execQueue *execQueue
+
+	// nil unless waitForSpaceReclaim
+	spaceReclaim *SpaceReclaimReport
 }
 
 type PrunerFactory struct {
-	senderRules                    []pruning.KeepRule
-	receiverRules                  []pruning.KeepRule
-	retryWait                      time.Duration
-	considerSnapAtCursorReplicated bool
-	promPruneSecs                  *prometheus.HistogramVec
+	senderRules           *keepRules
+	receiverRules         *keepRules
+	senderBookmarkRules   *ruleSet
+	receiverBookmarkRules *ruleSet
+	retryWait             time.Duration
+	promPruneSecs         *prometheus.HistogramVec
+	waitForSpaceReclaim   bool
+	deferClones           bool
+	senderLimits          execLimits
+	receiverLimits        execLimits
 }
 
 type LocalPrunerFactory struct {
-	keepRules     []pruning.KeepRule
-	retryWait     time.Duration
-	promPruneSecs *prometheus.HistogramVec
+	keepRules           *keepRules
+	bookmarkRules       *ruleSet
+	retryWait           time.Duration
+	promPruneSecs       *prometheus.HistogramVec
+	waitForSpaceReclaim bool
+	deferClones         bool
+	limits              execLimits
+}
+
+// execLimits limit the destroys of one side of a job, see fields `concurrency` and `destroys_per_minute` of the pruning config.
+// The limiter is shared by the pruners that a factory builds, i.e., it also applies across invocations of the job.
+type execLimits struct {
+	concurrency int                // number of filesystems that are destroyed concurrently
+	destroys    *ratelimit.Limiter // nil if unlimited
+	batchSize   int                // destroys per pdu.DestroySnapshotsReq, 0 if destroys is nil
+}
+
+func newExecLimits(concurrency, destroysPerMinute int) (execLimits, error) {
+	if concurrency < 0 || destroysPerMinute < 0 {
+		return execLimits{}, errors.New("`concurrency` and `destroys_per_minute` must not be negative")
+	}
+	l := execLimits{concurrency: concurrency}
+	if l.concurrency == 0 {
+		l.concurrency = maxConcurrentExec
+	}
+	if destroysPerMinute > 0 {
+		l.destroys = ratelimit.New(destroysPerMinute, time.Minute)
+		// at most one second's worth of destroys per zfs destroy, so that the rate is smooth
+		l.batchSize = (destroysPerMinute + 59) / 60
+	}
+	return l, nil
+}
+
+// batches splits destroyList into the batches that are destroyed one after another.
+// Without a rate limit, destroyList is destroyed at once.
+func (l execLimits) batches(destroyList []*pdu.FilesystemVersion) [][]*pdu.FilesystemVersion {
+	if l.destroys == nil || len(destroyList) <= l.batchSize {
+		return [][]*pdu.FilesystemVersion{destroyList}
+	}
+	var batches [][]*pdu.FilesystemVersion
+	for len(destroyList) > 0 {
+		n := l.batchSize
+		if n > len(destroyList) {
+			n = len(destroyList)
+		}
+		batches = append(batches, destroyList[:n])
+		destroyList = destroyList[n:]
+	}
+	return batches
 }
 
-func NewLocalPrunerFactory(in config.PruningLocal, promPruneSecs *prometheus.HistogramVec) (*LocalPrunerFactory, error) {
-	rules, err := pruning.RulesFromConfig(in.Keep)
+// parseClones parses the `clones` field of the pruning config,
+// see pdu.DestroySnapshotsReq.DeferSnapshotsWithClones.
+// The empty string, i.e., a config that was not parsed from YAML, means skip, the default.
+func parseClones(clones string) (bool, error) {
+	switch clones {
+	case "", "skip":
+		return false, nil
+	case "defer":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid value for `clones`: %q, must be one of skip, defer", clones)
+	}
+}
+
+func NewLocalPrunerFactory(in config.PruningLocal, classes map[string]string, promPruneSecs *prometheus.HistogramVec) (*LocalPrunerFactory, error) {
+	keep := [][]config.PruningEnum{in.Keep}
+	for _, o := range in.Overrides {
+		keep = append(keep, o.Keep)
+	}
+	for _, k := range keep {
+		for _, r := range k {
+			if _, ok := r.Ret.(*config.PruneKeepNotReplicated); ok {
+				// rule NotReplicated  for a local pruner doesn't make sense
+				// because no replication happens with that job type
+				return nil, fmt.Errorf("single-site pruner cannot support `not_replicated` keep rule")
+			}
+		}
+	}
+	return newLocalPrunerFactory(in, classes, promPruneSecs, false)
+}
+
+// NewSourcePrunerFactory is NewLocalPrunerFactory for the pruning of a source job on its own side.
+// It supports keep rule `not_replicated`: the History passed to BuildLocalPruner must report
+// the replication cursor that the pulling jobs move (see endpoint.Sender.AckReceived).
+func NewSourcePrunerFactory(in config.PruningLocal, classes map[string]string, promPruneSecs *prometheus.HistogramVec) (*LocalPrunerFactory, error) {
+	return newLocalPrunerFactory(in, classes, promPruneSecs, true)
+}
+
+func newLocalPrunerFactory(in config.PruningLocal, classes map[string]string, promPruneSecs *prometheus.HistogramVec, cursorSide bool) (*LocalPrunerFactory, error) {
+	def, err := newRuleSet(in.Keep, classes, cursorSide)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build pruning rules")
 	}
-	for _, r := range in.Keep {
-		if _, ok := r.Ret.(*config.PruneKeepNotReplicated); ok {
-			// rule NotReplicated  for a local pruner doesn't make sense
-			// because no replication happens with that job type
-			return nil, fmt.Errorf("single-site pruner cannot support `not_replicated` keep rule")
+	deferClones, err := parseClones(in.Clones)
+	if err != nil {
+		return nil, err
+	}
+	rules := &keepRules{def: def}
+	for i, o := range in.Overrides {
+		if err := rules.addOverride(i, o.Regex, o.Keep, classes, cursorSide); err != nil {
+			return nil, errors.Wrap(err, "cannot build pruning rules")
 		}
 	}
+	bookmarkRules, err := newBookmarkRuleSet(in.KeepBookmarks, classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build bookmark pruning rules")
+	}
+	limits, err := newExecLimits(in.Concurrency, in.DestroysPerMinute)
+	if err != nil {
+		return nil, err
+	}
 	f := &LocalPrunerFactory{
-		keepRules:     rules,
-		retryWait:     envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
-		promPruneSecs: promPruneSecs,
+		keepRules:           rules,
+		bookmarkRules:       bookmarkRules,
+		retryWait:           envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
+		promPruneSecs:       promPruneSecs,
+		waitForSpaceReclaim: in.WaitForSpaceReclaim,
+		deferClones:         deferClones,
+		limits:              limits,
 	}
 	return f, nil
 }
 
-func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus.HistogramVec) (*PrunerFactory, error) {
-	keepRulesReceiver, err := pruning.RulesFromConfig(in.KeepReceiver)
+// classes are the snapshot classes of the job, see pruning.RulesFromConfig.
+func NewPrunerFactory(in config.PruningSenderReceiver, classes map[string]string, promPruneSecs *prometheus.HistogramVec) (*PrunerFactory, error) {
+	receiverDef, err := newRuleSet(in.KeepReceiver, classes, false)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build receiver pruning rules")
 	}
+	keepRulesReceiver := &keepRules{def: receiverDef}
 
-	keepRulesSender, err := pruning.RulesFromConfig(in.KeepSender)
+	senderDef, err := newRuleSet(in.KeepSender, classes, true)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build sender pruning rules")
 	}
+	keepRulesSender := &keepRules{def: senderDef}
 
-	considerSnapAtCursorReplicated := false
-	for _, r := range in.KeepSender {
-		knr, ok := r.Ret.(*config.PruneKeepNotReplicated)
-		if !ok {
-			continue
+	senderBookmarkRules, err := newBookmarkRuleSet(in.KeepSenderBookmarks, classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build sender bookmark pruning rules")
+	}
+	receiverBookmarkRules, err := newBookmarkRuleSet(in.KeepReceiverBookmarks, classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build receiver bookmark pruning rules")
+	}
+
+	deferClones, err := parseClones(in.Clones)
+	if err != nil {
+		return nil, err
+	}
+	// each side has its own rate limit, the destroys of the sides load different pools
+	senderLimits, err := newExecLimits(in.Concurrency, in.DestroysPerMinute)
+	if err != nil {
+		return nil, err
+	}
+	receiverLimits, err := newExecLimits(in.Concurrency, in.DestroysPerMinute)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, o := range in.Overrides {
+		if err := keepRulesReceiver.addOverride(i, o.Regex, o.KeepReceiver, classes, false); err != nil {
+			return nil, errors.Wrap(err, "cannot build receiver pruning rules")
+		}
+		if err := keepRulesSender.addOverride(i, o.Regex, o.KeepSender, classes, true); err != nil {
+			return nil, errors.Wrap(err, "cannot build sender pruning rules")
 		}
-		considerSnapAtCursorReplicated = considerSnapAtCursorReplicated || !knr.KeepSnapshotAtCursor
 	}
+
 	f := &PrunerFactory{
-		senderRules:                    keepRulesSender,
-		receiverRules:                  keepRulesReceiver,
-		retryWait:                      envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
-		considerSnapAtCursorReplicated: considerSnapAtCursorReplicated,
-		promPruneSecs:                  promPruneSecs,
+		senderRules:           keepRulesSender,
+		receiverRules:         keepRulesReceiver,
+		senderBookmarkRules:   senderBookmarkRules,
+		receiverBookmarkRules: receiverBookmarkRules,
+		retryWait:             envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
+		promPruneSecs:         promPruneSecs,
+		waitForSpaceReclaim:   in.WaitForSpaceReclaim,
+		deferClones:           deferClones,
+		senderLimits:          senderLimits,
+		receiverLimits:        receiverLimits,
 	}
 	return f, nil
 }
@@ -135,13 +303,16 @@ func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus
 func (f *PrunerFactory) BuildSenderPruner(ctx context.Context, target Target, receiver History) *Pruner {
 	p := &Pruner{
 		args: args{
-			context.WithValue(ctx, contextKeyPruneSide, "sender"),
-			target,
-			receiver,
-			f.senderRules,
-			f.retryWait,
-			f.considerSnapAtCursorReplicated,
-			f.promPruneSecs.WithLabelValues("sender"),
+			ctx:                 context.WithValue(ctx, contextKeyPruneSide, "sender"),
+			target:              target,
+			receiver:            receiver,
+			rules:               f.senderRules,
+			bookmarkRules:       f.senderBookmarkRules,
+			retryWait:           f.retryWait,
+			promPruneSecs:       f.promPruneSecs.WithLabelValues("sender"),
+			waitForSpaceReclaim: f.waitForSpaceReclaim,
+			deferClones:         f.deferClones,
+			limits:              f.senderLimits,
 		},
 		state: Plan,
 	}
@@ -151,13 +322,16 @@ func (f *PrunerFactory) BuildSenderPruner(ctx context.Context, target Target, re
 func (f *PrunerFactory) BuildReceiverPruner(ctx context.Context, target Target, receiver History) *Pruner {
 	p := &Pruner{
 		args: args{
-			context.WithValue(ctx, contextKeyPruneSide, "receiver"),
-			target,
-			receiver,
-			f.receiverRules,
-			f.retryWait,
-			false, // senseless here anyways
-			f.promPruneSecs.WithLabelValues("receiver"),
+			ctx:                 context.WithValue(ctx, contextKeyPruneSide, "receiver"),
+			target:              target,
+			receiver:            receiver,
+			rules:               f.receiverRules,
+			bookmarkRules:       f.receiverBookmarkRules,
+			retryWait:           f.retryWait,
+			promPruneSecs:       f.promPruneSecs.WithLabelValues("receiver"),
+			waitForSpaceReclaim: f.waitForSpaceReclaim,
+			deferClones:         f.deferClones,
+			limits:              f.receiverLimits,
 		},
 		state: Plan,
 	}
@@ -167,13 +341,16 @@ func (f *PrunerFactory) BuildReceiverPruner(ctx context.Context, target Target,
 func (f *LocalPrunerFactory) BuildLocalPruner(ctx context.Context, target Target, receiver History) *Pruner {
 	p := &Pruner{
 		args: args{
-			context.WithValue(ctx, contextKeyPruneSide, "local"),
-			target,
-			receiver,
-			f.keepRules,
-			f.retryWait,
-			false, // considerSnapAtCursorReplicated is not relevant for local pruning
-			f.promPruneSecs.WithLabelValues("local"),
+			ctx:                 context.WithValue(ctx, contextKeyPruneSide, "local"),
+			target:              target,
+			receiver:            receiver,
+			rules:               f.keepRules,
+			bookmarkRules:       f.bookmarkRules,
+			retryWait:           f.retryWait,
+			promPruneSecs:       f.promPruneSecs.WithLabelValues("local"),
+			waitForSpaceReclaim: f.waitForSpaceReclaim,
+			deferClones:         f.deferClones,
+			limits:              f.limits,
 		},
 		state: Plan,
 	}
@@ -193,6 +370,8 @@ const (
 
 type updater func(func(*Pruner))
 
+var maxConcurrentExec = envconst.Int("ZREPL_PRUNER_MAX_CONCURRENT_FILESYSTEMS", 8)
+
 func (p *Pruner) Prune() {
 	p.prune(p.args)
 }
@@ -209,25 +388,85 @@ func (p *Pruner) prune(args args) {
 	// including figuring out how to resume a plan after being interrupted by network errors
 	// The non-retrying code in this package should move straight to replication/logic.
 	doOneAttempt(&args, u)
+	p.notifyCompleted(args.ctx)
+}
+
+// DryRun plans the pruning like Prune, but neither destroys snapshots nor notifies the event hooks.
+// Once it returns, the Report lists all filesystems as completed, with the DestroyList that Prune would destroy,
+// and the keep rules that keep each snapshot of the SnapshotList that is not destroyed (see SnapshotReport.KeptBy).
+func (p *Pruner) DryRun() {
+	u := func(f func(*Pruner)) {
+		p.mtx.Lock()
+		defer p.mtx.Unlock()
+		f(p)
+	}
+	args := p.args
+	args.dryRun = true
+	doOneAttempt(&args, u)
+}
+
+func (p *Pruner) notifyCompleted(ctx context.Context) {
+	rep := p.Report()
+	details := &hooks.PruningEventDetails{Side: ctx.Value(contextKeyPruneSide).(string)}
+	for _, fs := range append(rep.Pending, rep.Completed...) {
+		if fs.LastError != "" {
+			details.FailedFilesystems++
+		}
+	}
+	for _, fs := range rep.Completed {
+		if fs.LastError == "" {
+			details.DestroyedSnapshots += len(fs.DestroyList) - len(fs.KeptList)
+		}
+	}
+	var err error
+	switch {
+	case rep.Error != "":
+		err = errors.New(rep.Error)
+	case details.FailedFilesystems > 0:
+		err = fmt.Errorf("%d filesystem(s) failed", details.FailedFilesystems)
+	}
+	hooks.NotifyEvent(ctx, hooks.EventPruningCompleted, err, details)
 }
 
 type Report struct {
 	State              string
 	Error              string
 	Pending, Completed []FSReport
+	SpaceReclaim       *SpaceReclaimReport
+}
+
+// Waiting for the space of the destroyed snapshots to be freed, see SpaceReclaimWaiter.
+type SpaceReclaimReport struct {
+	Waiting           bool
+	StartedAt, DoneAt time.Time
+	Error             string
 }
 
 type FSReport struct {
 	Filesystem                string
 	SnapshotList, DestroyList []SnapshotReport
-	SkipReason                FSSkipReason
-	LastError                 string
+	// snapshots of DestroyList that the target did not destroy on purpose, see pdu.DestroySnapshotRes.KeptReason
+	KeptList []SnapshotReport `json:",omitempty"`
+	// the bookmarks that zrepl did not create, only if bookmarks are pruned (see config.PruningLocal.KeepBookmarks)
+	BookmarkList, BookmarkDestroyList []SnapshotReport `json:",omitempty"`
+	BookmarkKeptList                  []SnapshotReport `json:",omitempty"`
+	// the override of the keep rules that applies to the filesystem, empty for the default rules
+	Override   string `json:",omitempty"`
+	SkipReason FSSkipReason
+	LastError  string
+
+	// the number of entries of DestroyList, followed by BookmarkDestroyList, that the target has processed so far,
+	// including those that it kept (the pruner destroys them in batches if field `destroys_per_minute` is set)
+	DestroysDone int `json:",omitempty"`
 }
 
 type SnapshotReport struct {
 	Name       string
 	Replicated bool
 	Date       time.Time
+	KeptReason string `json:",omitempty"`
+	// only for dry runs, the keep rules that keep the snapshot, see Pruner.DryRun
+	KeptBy []string `json:",omitempty"`
 }
 
 func (p *Pruner) Report() *Report {
@@ -244,6 +483,11 @@ func (p *Pruner) Report() *Report {
 		r.Pending, r.Completed = p.execQueue.Report()
 	}
 
+	if p.spaceReclaim != nil {
+		sr := *p.spaceReclaim
+		r.SpaceReclaim = &sr
+	}
+
 	return &r
 }
 
@@ -270,6 +514,16 @@ type fs struct {
 	// destroy list returned by pruning.PruneSnapshots(snaps)
 	// (type snapshot)
 	destroyList []pruning.Snapshot
+	// like snaps and destroyList, for the bookmarks that zrepl did not create, empty unless args.bookmarkRules
+	bookmarks, bookmarkDestroyList []pruning.Snapshot
+	// RelName of snapshot or bookmark => pdu.DestroySnapshotRes.KeptReason
+	kept map[string]string
+	// see FSReport.Override
+	override string
+	// only for dry runs: RelName of snapshot or bookmark => the keep rules that keep it, see SnapshotReport.KeptBy
+	keptBy map[string][]string
+	// see FSReport.DestroysDone
+	destroysDone int
 
 	mtx sync.RWMutex
 
@@ -296,6 +550,8 @@ func (f *fs) Report() FSReport {
 	r := FSReport{}
 	r.Filesystem = f.path
 	r.SkipReason = f.skipReason
+	r.Override = f.override
+	r.DestroysDone = f.destroysDone
 	if !r.SkipReason.NotSkipped() {
 		return r
 	}
@@ -306,17 +562,38 @@ func (f *fs) Report() FSReport {
 		r.LastError = f.execErrLast.Error()
 	}
 
-	r.SnapshotList = make([]SnapshotReport, len(f.snaps))
-	for i, snap := range f.snaps {
-		r.SnapshotList[i] = snap.(snapshot).Report()
+	r.SnapshotList = f.reportList(f.snaps)
+	r.DestroyList, r.KeptList = f.reportDestroyList(f.destroyList)
+	if len(f.bookmarks) > 0 {
+		r.BookmarkList = f.reportList(f.bookmarks)
+		r.BookmarkDestroyList, r.BookmarkKeptList = f.reportDestroyList(f.bookmarkDestroyList)
 	}
 
-	r.DestroyList = make([]SnapshotReport, len(f.destroyList))
-	for i, snap := range f.destroyList {
-		r.DestroyList[i] = snap.(snapshot).Report()
+	return r
+}
+
+// f.mtx must be held
+func (f *fs) reportList(snaps []pruning.Snapshot) []SnapshotReport {
+	l := make([]SnapshotReport, len(snaps))
+	for i, snap := range snaps {
+		l[i] = snap.(snapshot).Report()
+		l[i].KeptBy = f.keptBy[snap.(snapshot).fsv.RelName()]
 	}
+	return l
+}
 
-	return r
+// f.mtx must be held
+func (f *fs) reportDestroyList(destroyList []pruning.Snapshot) (destroy, kept []SnapshotReport) {
+	destroy = make([]SnapshotReport, len(destroyList))
+	for i, snap := range destroyList {
+		destroy[i] = snap.(snapshot).Report()
+		if reason, ok := f.kept[snap.(snapshot).fsv.RelName()]; ok {
+			k := destroy[i]
+			k.KeptReason = reason
+			kept = append(kept, k)
+		}
+	}
+	return destroy, kept
 }
 
 type snapshot struct {
@@ -341,6 +618,66 @@ func (s snapshot) Replicated() bool { return s.replicated }
 
 func (s snapshot) Date() time.Time { return s.date }
 
+func (s snapshot) UserProperty(name string) string { return s.fsv.GetUserProperties()[name] }
+
+// targetCursor is the replication state of a filesystem of the prune target, see replicationCursorOnTarget.
+type targetCursor struct {
+	guid uint64
+	// of the cursor's version on the target, 0 if the target does not have it
+	createTXG uint64
+}
+
+// replicated returns whether snapshot s of the target filesystem was replicated:
+// the snapshots older than the cursor were, the snapshot at the cursor only counts if atCursorReplicated.
+func (c *targetCursor) replicated(s *pdu.FilesystemVersion, atCursorReplicated bool) bool {
+	if s.GetGuid() == c.guid {
+		return atCursorReplicated
+	}
+	return s.GetCreateTXG() < c.createTXG
+}
+
+// replicationCursorOnTarget locates the replication state of filesystem fs in tfsvs, its versions on target.
+// It returns nil if neither history has a replication cursor for fs nor target a last-received snapshot (see LastReceivedLister).
+//
+// The cursor is located by guid among all versions, not only the snapshots, because the cursor bookmark
+// remains after its snapshot was destroyed. Since the located version and the snapshots are on the same pool,
+// their CreateTXGs are comparable, whereas those of target and history are not if they are on different pools.
+// If target has neither the cursor's snapshot nor its bookmark, the replication state is unknown and an error is returned,
+// unless target's last-received snapshot determines it.
+func replicationCursorOnTarget(ctx context.Context, fs string, tfsvs []*pdu.FilesystemVersion, history History, target Target) (*targetCursor, error) {
+	rc, err := history.ReplicationCursor(ctx, &pdu.ReplicationCursorReq{Filesystem: fs})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get replication cursor bookmark")
+	}
+	var cursor *targetCursor
+	cursorNotFound := false
+	if !rc.GetNotexist() {
+		cursor = &targetCursor{guid: rc.GetGuid()}
+		cursorNotFound = true
+		for _, v := range tfsvs {
+			if v.GetGuid() == cursor.guid {
+				cursor.createTXG = v.GetCreateTXG()
+				cursorNotFound = false
+				break
+			}
+		}
+	}
+	if l, ok := target.(LastReceivedLister); ok {
+		lr, err := l.LastReceived(ctx, fs)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get last-received-hold")
+		}
+		if lr != nil && (cursor == nil || lr.GetCreateTXG() > cursor.createTXG) {
+			cursor = &targetCursor{guid: lr.GetGuid(), createTXG: lr.GetCreateTXG()}
+			cursorNotFound = false
+		}
+	}
+	if cursorNotFound {
+		return nil, errors.New("replication cursor not found in prune target filesystem versions")
+	}
+	return cursor, nil
+}
+
 func doOneAttempt(a *args, u updater) {
 
 	ctx, target, receiver := a.ctx, a.target, a.receiver
@@ -390,6 +727,9 @@ tfss_loop:
 			continue
 		}
 
+		rules := a.rules.forFilesystem(tfs.Path)
+		pfs.override = rules.override
+
 		pfsPlanErrAndLog := func(err error, message string) {
 			t := fmt.Sprintf("%T", err)
 			pfs.planErr = err
@@ -397,7 +737,10 @@ tfss_loop:
 			l.WithField("orig_err_type", t).WithError(err).Error(fmt.Sprintf("%s: plan error, skipping filesystem", message))
 		}
 
-		tfsvsres, err := target.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: tfs.Path})
+		tfsvsres, err := target.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{
+			Filesystem:     tfs.Path,
+			UserProperties: rules.userProperties,
+		})
 		if err != nil {
 			pfsPlanErrAndLog(err, "cannot list filesystem versions")
 			continue tfss_loop
@@ -407,35 +750,22 @@ tfss_loop:
 
 		pfs.snaps = make([]pruning.Snapshot, 0, len(tfsvs))
 
-		rcReq := &pdu.ReplicationCursorReq{
-			Filesystem: tfs.Path,
-		}
-		rc, err := receiver.ReplicationCursor(ctx, rcReq)
+		// the reports list the snapshots from older to newer
+		sort.Slice(tfsvs, func(i, j int) bool {
+			return tfsvs[i].CreateTXG < tfsvs[j].CreateTXG
+		})
+
+		cursor, err := replicationCursorOnTarget(ctx, tfs.Path, tfsvs, receiver, target)
 		if err != nil {
-			pfsPlanErrAndLog(err, "cannot get replication cursor bookmark")
+			pfsPlanErrAndLog(err, "")
 			continue tfss_loop
 		}
-		if rc.GetNotexist() {
+		if cursor == nil {
 			err := errors.New("replication cursor bookmark does not exist (one successful replication is required before pruning works)")
 			pfsPlanErrAndLog(err, "")
 			continue tfss_loop
 		}
 
-		// scan from older to newer, all snapshots older than cursor are interpreted as replicated
-		sort.Slice(tfsvs, func(i, j int) bool {
-			return tfsvs[i].CreateTXG < tfsvs[j].CreateTXG
-		})
-
-		haveCursorSnapshot := false
-		for _, tfsv := range tfsvs {
-			if tfsv.Type != pdu.FilesystemVersion_Snapshot {
-				continue
-			}
-			if tfsv.Guid == rc.GetGuid() {
-				haveCursorSnapshot = true
-			}
-		}
-		preCursor := haveCursorSnapshot
 		for _, tfsv := range tfsvs {
 			if tfsv.Type != pdu.FilesystemVersion_Snapshot {
 				continue
@@ -446,22 +776,67 @@ tfss_loop:
 				pfsPlanErrAndLog(err, "fs version with invalid creation date")
 				continue tfss_loop
 			}
-			// note that we cannot use CreateTXG because target and receiver could be on different pools
-			atCursor := tfsv.Guid == rc.GetGuid()
-			preCursor = preCursor && !atCursor
+			for _, prop := range rules.userProperties {
+				// a target that predates pdu.ListFilesystemVersionsReq.UserProperties does not list them,
+				// and keep rule `user_property` would not keep the snapshots that it should keep
+				if _, ok := tfsv.GetUserProperties()[prop]; !ok {
+					err := fmt.Errorf("%s: target did not list user property %q (keep rule `user_property` requires zrepl on the target side to support it)", tfsv.RelName(), prop)
+					pfsPlanErrAndLog(err, "")
+					continue tfss_loop
+				}
+			}
 			pfs.snaps = append(pfs.snaps, snapshot{
-				replicated: preCursor || (a.considerSnapAtCursorReplicated && atCursor),
+				replicated: cursor.replicated(tfsv, rules.considerSnapAtCursorReplicated),
 				date:       creation,
 				fsv:        tfsv,
 			})
 		}
-		if preCursor {
-			pfsPlanErrAndLog(fmt.Errorf("replication cursor not found in prune target filesystem versions"), "")
-			continue tfss_loop
+		if a.bookmarkRules != nil {
+			for _, tfsv := range tfsvs {
+				// the target does not destroy the bookmarks of zrepl's abstractions anyways,
+				// but they must not count for the keep rules, e.g., `last_n`
+				if tfsv.Type != pdu.FilesystemVersion_Bookmark || endpoint.IsAbstractionBookmark(tfs.Path, tfsv.Name) {
+					continue
+				}
+				creation, err := tfsv.CreationAsTime()
+				if err != nil {
+					err := fmt.Errorf("%s: %s", tfsv.RelName(), err)
+					pfsPlanErrAndLog(err, "fs version with invalid creation date")
+					continue tfss_loop
+				}
+				pfs.bookmarks = append(pfs.bookmarks, snapshot{date: creation, fsv: tfsv})
+			}
 		}
 
 		// Apply prune rules
-		pfs.destroyList = pruning.PruneSnapshots(pfs.snaps, a.rules)
+		if rules.override != "" {
+			l.WithField("override", rules.override).Debug("apply keep rules of override")
+		}
+		pfs.destroyList = pruning.PruneSnapshots(pfs.snaps, rules.rules)
+		if a.bookmarkRules != nil {
+			pfs.bookmarkDestroyList = pruning.PruneSnapshots(pfs.bookmarks, a.bookmarkRules.rules)
+		}
+		if a.dryRun {
+			pfs.keptBy = make(map[string][]string)
+			addKeptBy(pfs.keptBy, pfs.snaps, rules)
+			if a.bookmarkRules != nil {
+				addKeptBy(pfs.keptBy, pfs.bookmarks, a.bookmarkRules)
+			}
+		}
+	}
+
+	if a.dryRun {
+		u(func(pruner *Pruner) {
+			pruner.execQueue = newExecQueue(len(pfss))
+			pruner.state = Done
+			for _, pfs := range pfss {
+				pruner.execQueue.Put(pfs, nil, true)
+				if pfs.skipReason.NotSkipped() && pfs.planErr != nil {
+					pruner.state = ExecErr
+				}
+			}
+		})
+		return
 	}
 
 	u(func(pruner *Pruner) {
@@ -472,16 +847,32 @@ tfss_loop:
 		pruner.state = Exec
 	})
 
-	for {
-		var pfs *fs
-		u(func(pruner *Pruner) {
-			pfs = pruner.execQueue.Pop()
-		})
-		if pfs == nil {
-			break
-		}
-		doOneAttemptExec(a, u, pfs)
+	// Filesystems are destroyed concurrently, the target limits the concurrency per pool
+	// (see zfs.AcquirePoolSlot), so that a slow pool does not hold up the others.
+	var wg sync.WaitGroup
+	execCtx, endSpan := trace.WithSpan(ctx, "exec")
+	for i := 0; i < a.limits.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, endTask := trace.WithTask(execCtx, "prune-exec-worker")
+			defer endTask()
+			a := *a
+			a.ctx = ctx
+			for {
+				var pfs *fs
+				u(func(pruner *Pruner) {
+					pfs = pruner.execQueue.Pop()
+				})
+				if pfs == nil {
+					return
+				}
+				doOneAttemptExec(&a, u, pfs)
+			}
+		}()
 	}
+	wg.Wait()
+	endSpan()
 
 	var rep *Report
 	{
@@ -492,6 +883,9 @@ tfss_loop:
 		})
 		rep = pruner.Report()
 	}
+	if a.waitForSpaceReclaim {
+		waitForSpaceReclaim(a, u, rep)
+	}
 	u(func(p *Pruner) {
 		if len(rep.Pending) > 0 {
 			panic("queue should not have pending items at this point")
@@ -509,45 +903,93 @@ tfss_loop:
 
 }
 
+// addKeptBy adds the descriptions of the rules that keep each of snaps to keptBy, see fs.keptBy.
+func addKeptBy(keptBy map[string][]string, snaps []pruning.Snapshot, rules *ruleSet) {
+	for snap, ruleIdxs := range pruning.KeptBy(snaps, rules.rules) {
+		descs := make([]string, len(ruleIdxs))
+		for i, idx := range ruleIdxs {
+			descs[i] = rules.descriptions[idx]
+		}
+		keptBy[snap.(snapshot).fsv.RelName()] = descs
+	}
+}
+
 // attempts to exec pfs, puts it back into the queue with the result
 func doOneAttemptExec(a *args, u updater, pfs *fs) {
 
-	destroyList := make([]*pdu.FilesystemVersion, len(pfs.destroyList))
-	for i := range destroyList {
-		destroyList[i] = pfs.destroyList[i].(snapshot).fsv
+	destroyList := make([]*pdu.FilesystemVersion, 0, len(pfs.destroyList)+len(pfs.bookmarkDestroyList))
+	for _, snap := range pfs.destroyList {
+		destroyList = append(destroyList, snap.(snapshot).fsv)
 		GetLogger(a.ctx).
 			WithField("fs", pfs.path).
-			WithField("destroy_snap", destroyList[i].Name).
+			WithField("destroy_snap", snap.Name()).
 			Debug("policy destroys snapshot")
 	}
-	req := pdu.DestroySnapshotsReq{
-		Filesystem: pfs.path,
-		Snapshots:  destroyList,
+	for _, bm := range pfs.bookmarkDestroyList {
+		destroyList = append(destroyList, bm.(snapshot).fsv)
+		GetLogger(a.ctx).
+			WithField("fs", pfs.path).
+			WithField("destroy_bookmark", bm.Name()).
+			Debug("policy destroys bookmark")
 	}
-	GetLogger(a.ctx).WithField("fs", pfs.path).Debug("destroying snapshots")
-	res, err := a.target.DestroySnapshots(a.ctx, &req)
-	if err != nil {
-		u(func(pruner *Pruner) {
-			pruner.execQueue.Put(pfs, err, false)
-		})
-		return
+	results := make([]*pdu.DestroySnapshotRes, 0, len(destroyList))
+	for _, batch := range a.limits.batches(destroyList) {
+		// the budget is that of this daemon, even if the target is remote
+		err := scheduler.WaitDestroys(a.ctx, len(batch))
+		if err == nil && a.limits.destroys != nil {
+			err = a.limits.destroys.Wait(a.ctx, float64(len(batch)))
+		}
+		if err != nil {
+			u(func(pruner *Pruner) {
+				pruner.execQueue.Put(pfs, err, false)
+			})
+			return
+		}
+		req := pdu.DestroySnapshotsReq{
+			Filesystem:               pfs.path,
+			Snapshots:                batch,
+			DeferSnapshotsWithClones: a.deferClones,
+		}
+		GetLogger(a.ctx).WithField("fs", pfs.path).WithField("count", len(batch)).Debug("destroying snapshots")
+		res, err := a.target.DestroySnapshots(a.ctx, &req)
+		if err != nil {
+			u(func(pruner *Pruner) {
+				pruner.execQueue.Put(pfs, err, false)
+			})
+			return
+		}
+		results = append(results, res.Results...)
+		pfs.mtx.Lock()
+		pfs.destroysDone += len(batch)
+		pfs.mtx.Unlock()
 	}
 	// check if all snapshots were destroyed
 	destroyResults := make(map[string]*pdu.DestroySnapshotRes)
-	for _, fsres := range res.Results {
-		destroyResults[fsres.Snapshot.Name] = fsres
+	for _, fsres := range results {
+		destroyResults[fsres.Snapshot.RelName()] = fsres
 	}
-	err = nil
+	var err error
 	destroyFails := make([]*pdu.DestroySnapshotRes, 0)
+	kept := make(map[string]string)
 	for _, reqDestroy := range destroyList {
-		res, ok := destroyResults[reqDestroy.Name]
+		res, ok := destroyResults[reqDestroy.RelName()]
 		if !ok {
 			err = fmt.Errorf("missing destroy-result for %s", reqDestroy.RelName())
 			break
 		} else if res.Error != "" {
 			destroyFails = append(destroyFails, res)
+		} else if res.KeptReason != "" {
+			kept[reqDestroy.RelName()] = res.KeptReason
+			GetLogger(a.ctx).
+				WithField("fs", pfs.path).
+				WithField("snap", reqDestroy.RelName()).
+				WithField("reason", res.KeptReason).
+				Info("target kept snapshot")
 		}
 	}
+	pfs.mtx.Lock()
+	pfs.kept = kept
+	pfs.mtx.Unlock()
 	if err == nil && len(destroyFails) > 0 {
 		names := make([]string, len(destroyFails))
 		pairs := make([]string, len(destroyFails))
@@ -574,3 +1016,44 @@ func doOneAttemptExec(a *args, u updater, pfs *fs) {
 		return
 	}
 }
+
+// The state remains Exec while waiting.
+// Errors are only reported, they do not make the pruning attempt fail.
+func waitForSpaceReclaim(a *args, u updater, rep *Report) {
+	var fss []string
+	for _, fsr := range rep.Completed {
+		if fsr.SkipReason.NotSkipped() && fsr.LastError == "" && len(fsr.DestroyList) > 0 {
+			fss = append(fss, fsr.Filesystem)
+		}
+	}
+	if len(fss) == 0 {
+		return
+	}
+
+	l := GetLogger(a.ctx)
+	// the remote side of push and pull jobs prunes on the other host, the option applies to the local side only
+	w, ok := a.target.(SpaceReclaimWaiter)
+	if !ok {
+		l.Debug("prune target does not support waiting for space reclaim, skipping")
+		return
+	}
+	sr := &SpaceReclaimReport{Waiting: true, StartedAt: time.Now()}
+	u(func(p *Pruner) {
+		p.spaceReclaim = sr
+	})
+
+	l.Info("wait for space of destroyed snapshots to be freed")
+	err := w.WaitForSpaceReclaim(a.ctx, fss)
+	if err != nil {
+		l.WithError(err).Error("cannot wait for space of destroyed snapshots to be freed")
+	} else {
+		l.Info("space of destroyed snapshots has been freed")
+	}
+
+	u(func(p *Pruner) {
+		p.spaceReclaim = &SpaceReclaimReport{StartedAt: sr.StartedAt, DoneAt: time.Now()}
+		if err != nil {
+			p.spaceReclaim.Error = err.Error()
+		}
+	})
+}
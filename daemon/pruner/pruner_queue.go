@@ -9,6 +9,7 @@ import (
 type execQueue struct {
 	mtx                sync.Mutex
 	pending, completed []*fs
+	executing          []*fs // popped but not yet put back, reported as pending
 }
 
 func newExecQueue(cap int) *execQueue {
@@ -23,9 +24,12 @@ func (q *execQueue) Report() (pending, completed []FSReport) {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
-	pending = make([]FSReport, len(q.pending))
-	for i, fs := range q.pending {
-		pending[i] = fs.Report()
+	pending = make([]FSReport, 0, len(q.executing)+len(q.pending))
+	for _, fs := range q.executing {
+		pending = append(pending, fs.Report())
+	}
+	for _, fs := range q.pending {
+		pending = append(pending, fs.Report())
 	}
 	completed = make([]FSReport, len(q.completed))
 	for i, fs := range q.completed {
@@ -47,27 +51,35 @@ func (q *execQueue) HasCompletedFSWithErrors() bool {
 }
 
 func (q *execQueue) Pop() *fs {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
 	if len(q.pending) == 0 {
 		return nil
 	}
 	fs := q.pending[0]
 	q.pending = q.pending[1:]
+	q.executing = append(q.executing, fs)
 	return fs
 }
 
 func (q *execQueue) Put(fs *fs, err error, done bool) {
 	fs.mtx.Lock()
 	fs.execErrLast = err
+	fs.mtx.Unlock()
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for i, e := range q.executing {
+		if e == fs {
+			q.executing = append(q.executing[:i], q.executing[i+1:]...)
+			break
+		}
+	}
 	if done || err != nil {
-		fs.mtx.Unlock()
-		q.mtx.Lock()
 		q.completed = append(q.completed, fs)
-		q.mtx.Unlock()
 		return
 	}
-	fs.mtx.Unlock()
 
-	q.mtx.Lock()
 	// inefficient priority q
 	q.pending = append(q.pending, fs)
 	sort.SliceStable(q.pending, func(i, j int) bool {
@@ -77,6 +89,4 @@ func (q *execQueue) Put(fs *fs, err error, done bool) {
 		defer q.pending[j].mtx.Unlock()
 		return strings.Compare(q.pending[i].path, q.pending[j].path) == -1
 	})
-	q.mtx.Unlock()
-
 }
@@ -0,0 +1,133 @@
+package pruner
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/pruning"
+)
+
+// keepRules are the keep rules of a prune side,
+// with the overrides for the filesystems that match their regex (see config.PruningSenderReceiver.Overrides).
+type keepRules struct {
+	def       ruleSet
+	overrides []ruleOverride
+}
+
+// ruleSet are the keep rules for a filesystem.
+type ruleSet struct {
+	rules []pruning.KeepRule
+	// describe rules for reports, see ruleDescription
+	descriptions []string
+	// the user properties that the rules refer to, listed along with the snapshots
+	userProperties []string
+	// whether the snapshot at the replication cursor counts as replicated,
+	// see config.PruneKeepNotReplicated.KeepSnapshotAtCursor
+	considerSnapAtCursorReplicated bool
+	// describes the override that the rules come from, empty for the default rules of the side
+	override string
+}
+
+type ruleOverride struct {
+	re *regexp.Regexp
+	ruleSet
+}
+
+// forFilesystem returns the rules of the first override that matches fs, or the default rules.
+func (r *keepRules) forFilesystem(fs string) *ruleSet {
+	for i := range r.overrides {
+		if r.overrides[i].re.MatchString(fs) {
+			return &r.overrides[i].ruleSet
+		}
+	}
+	return &r.def
+}
+
+// newRuleSet builds the rules of in. The snapshot at the replication cursor is
+// only considered replicated if cursorSide is true, i.e., on the sending side.
+func newRuleSet(in []config.PruningEnum, classes map[string]string, cursorSide bool) (ruleSet, error) {
+	rules, err := pruning.RulesFromConfig(in, classes)
+	if err != nil {
+		return ruleSet{}, err
+	}
+	s := ruleSet{
+		rules:          rules,
+		descriptions:   make([]string, len(in)),
+		userProperties: pruning.UserPropertiesOfRules(in),
+	}
+	for i := range in {
+		s.descriptions[i] = ruleDescription(i, in[i])
+	}
+	if cursorSide {
+		for _, r := range in {
+			if knr, ok := r.Ret.(*config.PruneKeepNotReplicated); ok {
+				s.considerSnapAtCursorReplicated = s.considerSnapAtCursorReplicated || !knr.KeepSnapshotAtCursor
+			}
+		}
+	}
+	return s, nil
+}
+
+// newBookmarkRuleSet builds the keep rules for the bookmarks that zrepl did not create,
+// nil if in is empty, i.e., if bookmarks are not pruned.
+func newBookmarkRuleSet(in []config.PruningEnum, classes map[string]string) (*ruleSet, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	for i, r := range in {
+		switch r.Ret.(type) {
+		case *config.PruneKeepNotReplicated, *config.PruneKeepUserProperty:
+			// bookmarks are not replicated and have no user properties
+			return nil, fmt.Errorf("%s is not supported for bookmarks", ruleDescription(i, r))
+		}
+	}
+	s, err := newRuleSet(in, classes, false)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// addOverride adds an override with the rules of in,
+// or with the default rules if in is empty, in which case the filesystems that match regex
+// are not subject to later overrides either.
+func (r *keepRules) addOverride(i int, regex string, in []config.PruningEnum, classes map[string]string, cursorSide bool) error {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return errors.Wrapf(err, "override #%d: invalid regex %q", i+1, regex)
+	}
+	o := ruleOverride{re: re, ruleSet: r.def}
+	if len(in) > 0 {
+		if o.ruleSet, err = newRuleSet(in, classes, cursorSide); err != nil {
+			return errors.Wrapf(err, "override #%d", i+1)
+		}
+		o.override = fmt.Sprintf("override #%d (regex %q)", i+1, regex)
+	}
+	r.overrides = append(r.overrides, o)
+	return nil
+}
+
+// ruleDescription describes the i-th keep rule of a list by its position and type, e.g., `rule #2 (last_n)`.
+func ruleDescription(i int, in config.PruningEnum) string {
+	var typ string
+	switch v := in.Ret.(type) {
+	case *config.PruneKeepNotReplicated:
+		typ = v.Type
+	case *config.PruneKeepLastN:
+		typ = v.Type
+	case *config.PruneKeepRegex:
+		typ = v.Type
+	case *config.PruneGrid:
+		typ = v.Type
+	case *config.PruneGFS:
+		typ = v.Type
+	case *config.PruneKeepUserProperty:
+		typ = v.Type
+	default:
+		typ = fmt.Sprintf("%T", v)
+	}
+	return fmt.Sprintf("rule #%d (%s)", i+1, typ)
+}
@@ -0,0 +1,125 @@
+package pruner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestPruningOverrides(t *testing.T) {
+	c, err := config.ParseConfigBytes([]byte(`
+jobs:
+- name: push
+  type: push
+  connect:
+    type: local
+    listener_name: sink
+    client_identity: push
+  filesystems: {"tank<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+    overrides:
+    - regex: ^tank/finance(/|$)
+      keep_receiver:
+      - type: last_n
+        count: 100
+    - regex: ^tank/
+      keep_sender:
+      - type: not_replicated
+        keep_snapshot_at_cursor: false
+      keep_receiver:
+      - type: last_n
+        count: 1
+`))
+	require.NoError(t, err)
+	f, err := NewPrunerFactory(c.Jobs[0].Ret.(*config.PushJob).Pruning, nil, nil)
+	require.NoError(t, err)
+
+	// tank/finance matches the first override, which only overrides the receiver rules
+	s := f.senderRules.forFilesystem("tank/finance/2020")
+	assert.Equal(t, "", s.override)
+	assert.Len(t, s.rules, 2)
+	assert.False(t, s.considerSnapAtCursorReplicated)
+	r := f.receiverRules.forFilesystem("tank/finance/2020")
+	assert.Equal(t, `override #1 (regex "^tank/finance(/|$)")`, r.override)
+	assert.Len(t, r.rules, 1)
+
+	s = f.senderRules.forFilesystem("tank/scratch")
+	assert.Equal(t, `override #2 (regex "^tank/")`, s.override)
+	assert.True(t, s.considerSnapAtCursorReplicated)
+	assert.Equal(t, `override #2 (regex "^tank/")`, f.receiverRules.forFilesystem("tank/scratch").override)
+
+	assert.Equal(t, "", f.senderRules.forFilesystem("tank").override)
+	assert.Equal(t, "", f.receiverRules.forFilesystem("tank").override)
+	assert.Len(t, f.receiverRules.forFilesystem("tank").rules, 1)
+}
+
+func TestLocalPruningOverrides(t *testing.T) {
+	local := func(overrides ...*config.PruningLocalOverride) config.PruningLocal {
+		return config.PruningLocal{
+			Keep:      []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 10}}},
+			Overrides: overrides,
+		}
+	}
+	notReplicated := []config.PruningEnum{{Ret: &config.PruneKeepNotReplicated{Type: "not_replicated"}}}
+
+	f, err := NewLocalPrunerFactory(local(&config.PruningLocalOverride{
+		Regex: "^tank/scratch$",
+		Keep:  []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 1}}},
+	}), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `override #1 (regex "^tank/scratch$")`, f.keepRules.forFilesystem("tank/scratch").override)
+	assert.Equal(t, "", f.keepRules.forFilesystem("tank/scratch/x").override)
+
+	_, err = NewLocalPrunerFactory(local(&config.PruningLocalOverride{Regex: "^tank/", Keep: notReplicated}), nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "`not_replicated`")
+	}
+
+	f, err = NewSourcePrunerFactory(local(&config.PruningLocalOverride{Regex: "^tank/", Keep: notReplicated}), nil, nil)
+	require.NoError(t, err)
+	assert.True(t, f.keepRules.forFilesystem("tank/x").considerSnapAtCursorReplicated)
+	assert.False(t, f.keepRules.forFilesystem("tank").considerSnapAtCursorReplicated)
+
+	_, err = NewLocalPrunerFactory(local(&config.PruningLocalOverride{Regex: "(", Keep: notReplicated[:0]}), nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "override #1: invalid regex")
+	}
+}
+
+func TestPruningClones(t *testing.T) {
+	local := func(clones string) config.PruningLocal {
+		return config.PruningLocal{
+			Keep:   []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 10}}},
+			Clones: clones,
+		}
+	}
+
+	f, err := NewLocalPrunerFactory(local("skip"), nil, nil)
+	require.NoError(t, err)
+	assert.False(t, f.deferClones)
+
+	f, err = NewLocalPrunerFactory(local(""), nil, nil)
+	require.NoError(t, err)
+	assert.False(t, f.deferClones)
+
+	f, err = NewLocalPrunerFactory(local("defer"), nil, nil)
+	require.NoError(t, err)
+	assert.True(t, f.deferClones)
+
+	_, err = NewLocalPrunerFactory(local("promote"), nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "`clones`")
+	}
+}
@@ -0,0 +1,423 @@
+package pruner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// dryRunTarget is a Target and History whose replication cursor is the most recent snapshot.
+type dryRunTarget struct {
+	t   *testing.T
+	fss map[string][]*pdu.FilesystemVersion
+}
+
+func (d *dryRunTarget) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	res := &pdu.ListFilesystemRes{}
+	for fs := range d.fss {
+		res.Filesystems = append(res.Filesystems, &pdu.Filesystem{Path: fs})
+	}
+	return res, nil
+}
+
+func (d *dryRunTarget) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return &pdu.ListFilesystemVersionsRes{Versions: d.fss[req.Filesystem]}, nil
+}
+
+func (d *dryRunTarget) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	fsvs := d.fss[req.Filesystem]
+	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: fsvs[len(fsvs)-1].Guid}}, nil
+}
+
+func (d *dryRunTarget) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	d.t.Errorf("dry run must not destroy snapshots, got destroy of %v", req.Snapshots)
+	return &pdu.DestroySnapshotsRes{}, nil
+}
+
+func TestDryRun(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	snaps := func(names ...string) []*pdu.FilesystemVersion {
+		fsvs := make([]*pdu.FilesystemVersion, len(names))
+		for i, name := range names {
+			fsvs[i] = &pdu.FilesystemVersion{
+				Type:      pdu.FilesystemVersion_Snapshot,
+				Name:      name,
+				Guid:      uint64(i + 1),
+				CreateTXG: uint64(i + 1),
+				Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(i), 0)),
+			}
+		}
+		return fsvs
+	}
+	target := &dryRunTarget{t, map[string][]*pdu.FilesystemVersion{
+		"tank/a": snaps("zrepl_1", "manual", "zrepl_2", "zrepl_3"),
+		"tank/b": snaps("zrepl_1", "zrepl_2"),
+	}}
+
+	f, err := NewLocalPrunerFactory(config.PruningLocal{
+		Keep: []config.PruningEnum{
+			{Ret: &config.PruneKeepRegex{Type: "regex", Regex: "^manual$"}},
+			{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 2, Regex: "^zrepl_"}},
+		},
+		Overrides: []*config.PruningLocalOverride{{
+			Regex: "^tank/b$",
+			Keep:  []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 1}}},
+		}},
+	}, nil, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"prune_side"}))
+	require.NoError(t, err)
+
+	p := f.BuildLocalPruner(ctx, target, target)
+	p.DryRun()
+
+	rep := p.Report()
+	assert.Equal(t, Done.String(), rep.State)
+	assert.Empty(t, rep.Pending)
+	require.Len(t, rep.Completed, 2)
+	byFS := make(map[string]FSReport)
+	for _, fsr := range rep.Completed {
+		byFS[fsr.Filesystem] = fsr
+	}
+
+	keptBy := func(fsr FSReport) map[string][]string {
+		m := make(map[string][]string)
+		for _, s := range fsr.SnapshotList {
+			m[s.Name] = s.KeptBy
+		}
+		return m
+	}
+	destroyed := func(fsr FSReport) (names []string) {
+		for _, s := range fsr.DestroyList {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+
+	a := byFS["tank/a"]
+	assert.Equal(t, "", a.Override)
+	assert.Equal(t, []string{"zrepl_1"}, destroyed(a))
+	assert.Equal(t, map[string][]string{
+		"zrepl_1": nil,
+		"manual":  {"rule #1 (regex)"},
+		"zrepl_2": {"rule #2 (last_n)"},
+		"zrepl_3": {"rule #2 (last_n)"},
+	}, keptBy(a))
+
+	b := byFS["tank/b"]
+	assert.Equal(t, `override #1 (regex "^tank/b$")`, b.Override)
+	assert.Equal(t, []string{"zrepl_1"}, destroyed(b))
+	assert.Equal(t, []string{"rule #1 (last_n)"}, keptBy(b)["zrepl_2"])
+}
+
+func TestDryRunUserPropertyNotListed(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	fsv := func(name string, i int, props map[string]string) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Type:           pdu.FilesystemVersion_Snapshot,
+			Name:           name,
+			Guid:           uint64(i),
+			CreateTXG:      uint64(i),
+			Creation:       pdu.FilesystemVersionCreation(time.Unix(int64(i), 0)),
+			UserProperties: props,
+		}
+	}
+	// tank/old mimics a target that does not list user properties
+	target := &dryRunTarget{t, map[string][]*pdu.FilesystemVersion{
+		"tank/new": {
+			fsv("zrepl_1", 1, map[string]string{"com.example:keep": "true"}),
+			fsv("zrepl_2", 2, map[string]string{"com.example:keep": ""}),
+		},
+		"tank/old": {fsv("zrepl_1", 1, nil), fsv("zrepl_2", 2, nil)},
+	}}
+
+	f, err := NewLocalPrunerFactory(config.PruningLocal{
+		Keep: []config.PruningEnum{
+			{Ret: &config.PruneKeepUserProperty{Type: "user_property", Property: "com.example:keep"}},
+		},
+	}, nil, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"prune_side"}))
+	require.NoError(t, err)
+
+	p := f.BuildLocalPruner(ctx, target, target)
+	p.DryRun()
+
+	rep := p.Report()
+	assert.Equal(t, ExecErr.String(), rep.State)
+	byFS := make(map[string]FSReport)
+	for _, fsr := range rep.Completed {
+		byFS[fsr.Filesystem] = fsr
+	}
+	require.Len(t, byFS["tank/new"].DestroyList, 1)
+	assert.Equal(t, "zrepl_2", byFS["tank/new"].DestroyList[0].Name)
+	assert.Contains(t, byFS["tank/old"].LastError, "com.example:keep")
+	assert.Empty(t, byFS["tank/old"].DestroyList)
+}
+
+func TestDryRunBookmarks(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	cursor, err := endpoint.ReplicationCursorBookmarkName("tank/a", 1, endpoint.MustMakeJobID("job"))
+	require.NoError(t, err)
+	fsv := func(typ pdu.FilesystemVersion_VersionType, name string, i int) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Type:      typ,
+			Name:      name,
+			Guid:      uint64(i),
+			CreateTXG: uint64(i),
+			Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(i), 0)),
+		}
+	}
+	target := &dryRunTarget{t, map[string][]*pdu.FilesystemVersion{
+		"tank/a": {
+			fsv(pdu.FilesystemVersion_Bookmark, "other_1", 1),
+			fsv(pdu.FilesystemVersion_Bookmark, cursor, 1),
+			fsv(pdu.FilesystemVersion_Bookmark, "other_2", 2),
+			fsv(pdu.FilesystemVersion_Bookmark, "other_3", 3),
+			fsv(pdu.FilesystemVersion_Snapshot, "zrepl_4", 4),
+		},
+	}}
+
+	in := config.PruningLocal{
+		Keep: []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 1}}},
+	}
+	promPruneSecs := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"prune_side"})
+
+	f, err := NewLocalPrunerFactory(in, nil, promPruneSecs)
+	require.NoError(t, err)
+	p := f.BuildLocalPruner(ctx, target, target)
+	p.DryRun()
+	rep := p.Report()
+	require.Len(t, rep.Completed, 1)
+	assert.Empty(t, rep.Completed[0].BookmarkList, "bookmarks are not pruned without keep_bookmarks")
+
+	in.KeepBookmarks = []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 1}}}
+	f, err = NewLocalPrunerFactory(in, nil, promPruneSecs)
+	require.NoError(t, err)
+	p = f.BuildLocalPruner(ctx, target, target)
+	p.DryRun()
+	rep = p.Report()
+	assert.Equal(t, Done.String(), rep.State)
+	require.Len(t, rep.Completed, 1)
+	fsr := rep.Completed[0]
+
+	names := func(l []SnapshotReport) (names []string) {
+		for _, s := range l {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"other_1", "other_2", "other_3"}, names(fsr.BookmarkList), "the replication cursor is not subject to the keep rules")
+	assert.ElementsMatch(t, []string{"other_1", "other_2"}, names(fsr.BookmarkDestroyList))
+	assert.Equal(t, []string{"rule #1 (last_n)"}, fsr.BookmarkList[2].KeptBy)
+	assert.Empty(t, fsr.DestroyList)
+
+	in.KeepBookmarks = []config.PruningEnum{{Ret: &config.PruneKeepNotReplicated{Type: "not_replicated"}}}
+	_, err = NewSourcePrunerFactory(in, nil, promPruneSecs)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not supported for bookmarks")
+	}
+}
+
+// execTarget is a dryRunTarget that records the destroys
+type execTarget struct {
+	*dryRunTarget
+	mtx     sync.Mutex
+	batches [][]string
+}
+
+func (e *execTarget) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	res := &pdu.DestroySnapshotsRes{}
+	var names []string
+	for _, s := range req.Snapshots {
+		names = append(names, s.Name)
+		res.Results = append(res.Results, &pdu.DestroySnapshotRes{Snapshot: s})
+	}
+	e.batches = append(e.batches, names)
+	return res, nil
+}
+
+func TestPruneDestroysPerMinute(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	var fsvs []*pdu.FilesystemVersion
+	for i := 1; i <= 6; i++ {
+		fsvs = append(fsvs, &pdu.FilesystemVersion{
+			Type:      pdu.FilesystemVersion_Snapshot,
+			Name:      fmt.Sprintf("zrepl_%d", i),
+			Guid:      uint64(i),
+			CreateTXG: uint64(i),
+			Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(i), 0)),
+		})
+	}
+	target := &execTarget{dryRunTarget: &dryRunTarget{t, map[string][]*pdu.FilesystemVersion{"tank/a": fsvs}}}
+
+	f, err := NewLocalPrunerFactory(config.PruningLocal{
+		Keep:              []config.PruningEnum{{Ret: &config.PruneKeepLastN{Type: "last_n", Count: 1}}},
+		Concurrency:       1,
+		DestroysPerMinute: 120, // 2 per batch, the bucket starts full
+	}, nil, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"prune_side"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, f.limits.concurrency)
+
+	p := f.BuildLocalPruner(ctx, target, target.dryRunTarget)
+	p.Prune()
+
+	rep := p.Report()
+	assert.Equal(t, Done.String(), rep.State)
+	require.Len(t, rep.Completed, 1)
+	assert.Len(t, rep.Completed[0].DestroyList, 5)
+	assert.Equal(t, 5, rep.Completed[0].DestroysDone)
+	require.Len(t, target.batches, 3)
+	for _, b := range target.batches[:2] {
+		assert.Len(t, b, 2)
+	}
+	assert.Len(t, target.batches[2], 1)
+}
+
+func TestExecLimits(t *testing.T) {
+	l, err := newExecLimits(0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, maxConcurrentExec, l.concurrency)
+	assert.Nil(t, l.destroys)
+	assert.Len(t, l.batches(nil), 1, "an empty destroy list is still one request")
+
+	l, err = newExecLimits(2, 61)
+	require.NoError(t, err)
+	assert.Equal(t, 2, l.concurrency)
+	assert.Equal(t, 2, l.batchSize)
+	assert.Len(t, l.batches(make([]*pdu.FilesystemVersion, 5)), 3)
+
+	_, err = newExecLimits(-1, 0)
+	assert.Error(t, err)
+}
+
+// cursorHistory is a History whose replication cursor of each filesystem is the version with the guid in cursors,
+// a filesystem without guid has no cursor.
+type cursorHistory struct {
+	*dryRunTarget
+	cursors map[string]uint64
+}
+
+func (h *cursorHistory) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	guid, ok := h.cursors[req.Filesystem]
+	if !ok {
+		return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Notexist{Notexist: true}}, nil
+	}
+	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: guid}}, nil
+}
+
+// lastReceivedTarget is a dryRunTarget that implements LastReceivedLister like the receiver of a pull job
+type lastReceivedTarget struct {
+	*dryRunTarget
+	lastReceived map[string]*pdu.FilesystemVersion
+}
+
+func (l *lastReceivedTarget) LastReceived(ctx context.Context, fs string) (*pdu.FilesystemVersion, error) {
+	return l.lastReceived[fs], nil
+}
+
+func TestDryRunNotReplicated(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	fsv := func(typ pdu.FilesystemVersion_VersionType, name string, i int) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Type:      typ,
+			Name:      name,
+			Guid:      uint64(i),
+			CreateTXG: uint64(i),
+			Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(i), 0)),
+		}
+	}
+	snap := func(name string, i int) *pdu.FilesystemVersion { return fsv(pdu.FilesystemVersion_Snapshot, name, i) }
+	cursor, err := endpoint.ReplicationCursorBookmarkName("tank/a", 2, endpoint.MustMakeJobID("job"))
+	require.NoError(t, err)
+
+	f, err := NewPrunerFactory(config.PruningSenderReceiver{
+		KeepSender:   []config.PruningEnum{{Ret: &config.PruneKeepNotReplicated{Type: "not_replicated"}}},
+		KeepReceiver: []config.PruningEnum{{Ret: &config.PruneKeepNotReplicated{Type: "not_replicated"}}},
+	}, nil, prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"prune_side"}))
+	require.NoError(t, err)
+
+	// DestroyList is not ordered
+	destroyed := func(p *Pruner) map[string][]string {
+		p.DryRun()
+		m := make(map[string][]string)
+		for _, fsr := range p.Report().Completed {
+			assert.Empty(t, fsr.LastError, "%s", fsr.Filesystem)
+			m[fsr.Filesystem] = []string{}
+			for _, s := range fsr.DestroyList {
+				m[fsr.Filesystem] = append(m[fsr.Filesystem], s.Name)
+			}
+			sort.Strings(m[fsr.Filesystem])
+		}
+		return m
+	}
+
+	t.Run("sender with bookmark-only cursor", func(t *testing.T) {
+		// zrepl_2 was replicated and destroyed, its cursor bookmark remains
+		sender := &dryRunTarget{t, map[string][]*pdu.FilesystemVersion{
+			"tank/a": {
+				snap("zrepl_1", 1),
+				fsv(pdu.FilesystemVersion_Bookmark, cursor, 2),
+				snap("zrepl_3", 3),
+			},
+		}}
+		history := &cursorHistory{sender, map[string]uint64{"tank/a": 2}}
+		assert.Equal(t, map[string][]string{"tank/a": {"zrepl_1"}}, destroyed(f.BuildSenderPruner(ctx, sender, history)))
+	})
+
+	// the receiver of a pull job, whose sender is the source job
+	receiverFSS := map[string][]*pdu.FilesystemVersion{
+		"tank/a": {snap("zrepl_1", 1), snap("zrepl_2", 2), snap("zrepl_3", 3), snap("zrepl_4", 4)},
+	}
+	t.Run("pull receiver without last-received-hold", func(t *testing.T) {
+		receiver := &dryRunTarget{t, receiverFSS}
+		history := &cursorHistory{receiver, map[string]uint64{"tank/a": 2}}
+		assert.Equal(t, map[string][]string{"tank/a": {"zrepl_1"}}, destroyed(f.BuildReceiverPruner(ctx, receiver, history)))
+
+		// the receiver does not have the cursor's version, e.g., because it was received with a different guid
+		history = &cursorHistory{receiver, map[string]uint64{"tank/a": 23}}
+		p := f.BuildReceiverPruner(ctx, receiver, history)
+		p.DryRun()
+		rep := p.Report()
+		require.Len(t, rep.Completed, 1)
+		assert.Contains(t, rep.Completed[0].LastError, "replication cursor not found")
+		assert.Empty(t, rep.Completed[0].DestroyList)
+	})
+	t.Run("pull receiver with last-received-hold", func(t *testing.T) {
+		receiver := &lastReceivedTarget{
+			&dryRunTarget{t, receiverFSS},
+			map[string]*pdu.FilesystemVersion{"tank/a": snap("zrepl_3", 3)},
+		}
+		// the source job's cursor lags behind, e.g., because its acknowledgement was lost
+		history := &cursorHistory{receiver.dryRunTarget, map[string]uint64{"tank/a": 2}}
+		assert.Equal(t, map[string][]string{"tank/a": {"zrepl_1", "zrepl_2"}}, destroyed(f.BuildReceiverPruner(ctx, receiver, history)))
+
+		// the source job has no cursor, e.g., because it predates replication cursors for pull jobs
+		history = &cursorHistory{receiver.dryRunTarget, nil}
+		assert.Equal(t, map[string][]string{"tank/a": {"zrepl_1", "zrepl_2"}}, destroyed(f.BuildReceiverPruner(ctx, receiver, history)))
+
+		// the cursor is ahead of the last-received-hold
+		history = &cursorHistory{receiver.dryRunTarget, map[string]uint64{"tank/a": 4}}
+		assert.Equal(t, map[string][]string{"tank/a": {"zrepl_1", "zrepl_2", "zrepl_3"}}, destroyed(f.BuildReceiverPruner(ctx, receiver, history)))
+	})
+}
@@ -0,0 +1,273 @@
+package daemon
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	transporttls "github.com/zrepl/zrepl/transport/tls"
+)
+
+// ReloadResponse lists the jobs by how a reload affected them.
+type ReloadResponse struct {
+	Started      []string
+	Stopped      []string
+	Restarted    []string
+	Reconfigured []string // pruning or snapshotting changed
+	Unchanged    []string
+}
+
+// reloader re-parses the config file and applies the changes to the running jobs (SIGHUP or `zrepl daemon reload`).
+//
+// Jobs that were removed from the config are stopped gracefully, see package stop.
+// Jobs whose pruning or snapshotting changed are reconfigured while they run, see job.Reconfigure.
+// Jobs with other changes are stopped gracefully and then started with the new config.
+// New jobs, including the restarted ones, are started once all stopped jobs have exited,
+// because a new job may use the datasets or the listener of a stopped job.
+//
+// The jobs created through the control socket (see jobsDir) are managed the same way,
+// but changing one of them does not re-read the config file.
+type reloader struct {
+	ctx        context.Context // the jobs are started with it
+	log        logger.Logger
+	configPath string   // empty for the default locations
+	jobsDir    *jobsDir // nil if jobs cannot be created at runtime
+	jobs       *jobs
+
+	mtx      sync.Mutex
+	fileConf *config.Config   // the config file of the running jobs
+	dynamic  []config.JobEnum // the running jobs of jobsDir
+	conf     *config.Config   // the config of the running jobs: fileConf with dynamic
+	applied  chan struct{}    // closed when the previous reload has been applied
+}
+
+// conf must be fileConf with dynamic, see withJobs
+func newReloader(ctx context.Context, log logger.Logger, configPath string, jobsDir *jobsDir, fileConf *config.Config, dynamic []config.JobEnum, conf *config.Config, jobs *jobs) *reloader {
+	applied := make(chan struct{})
+	close(applied)
+	return &reloader{ctx: ctx, log: log, configPath: configPath, jobsDir: jobsDir, jobs: jobs,
+		fileConf: fileConf, dynamic: dynamic, conf: conf, applied: applied}
+}
+
+type reloadAction int
+
+const (
+	reloadUnchanged reloadAction = iota
+	reloadReconfigure
+	reloadRestart
+	reloadStart
+	reloadStop
+)
+
+// config returns the config of the running jobs.
+func (r *reloader) config() *config.Config {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.conf
+}
+
+func (r *reloader) reload() (*ReloadResponse, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// also if the config cannot be applied, the certificates do not depend on it
+	defer transporttls.ReloadCertificates(r.ctx)
+	// e.g., after logrotate moved the log files away
+	defer func() {
+		if err := logging.ReopenFileOutlets(); err != nil {
+			r.log.WithError(err).Error("cannot reopen log files")
+		}
+	}()
+
+	fileConf, err := config.ParseConfig(r.configPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse config")
+	}
+	if !reflect.DeepEqual(fileConf.Global, r.fileConf.Global) {
+		return nil, errors.New("changes to the `global` section require a daemon restart")
+	}
+	// the job specs might have been changed on disk, too
+	dynamic, err := r.jobsDir.load()
+	if err != nil {
+		return nil, err
+	}
+	conf, err := withJobs(fileConf, dynamic)
+	if err != nil {
+		return nil, err
+	}
+	apply, err := r.prepare(conf)
+	if err != nil {
+		return nil, err
+	}
+	r.fileConf, r.dynamic = fileConf, dynamic
+	return apply(), nil
+}
+
+// prepare validates conf, the next config of the running jobs, and returns the function that applies it.
+// The caller must hold r.mtx.
+func (r *reloader) prepare(conf *config.Config) (apply func() *ReloadResponse, err error) {
+	select {
+	case <-r.applied:
+	default:
+		return nil, errors.New("the previous reload is still in progress: stopped jobs have not exited yet")
+	}
+	if r.jobs.shuttingDown() {
+		return nil, errors.New("the daemon is shutting down")
+	}
+
+	// The jobs that are not started are discarded, including those of a rejected reload.
+	// Their tls certificates are thus never registered, see jobs.start.
+	built, err := job.JobsFromConfig(conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build jobs from config")
+	}
+	for _, j := range built {
+		if IsInternalJobName(j.Name()) {
+			return nil, errors.Errorf("internal job name used for config job '%s'", j.Name())
+		}
+	}
+
+	cur := make(map[string]config.JobEnum, len(r.conf.Jobs))
+	for _, j := range r.conf.Jobs {
+		cur[j.Name()] = j
+	}
+	actions := make(map[string]reloadAction)
+	applies := make(map[string]func())
+	for _, next := range conf.Jobs {
+		name := next.Name()
+		c, ok := cur[name]
+		switch {
+		case !ok:
+			actions[name] = reloadStart
+		case reflect.DeepEqual(c, next):
+			actions[name] = reloadUnchanged
+		default:
+			running, ok := r.jobs.get(name)
+			if !ok {
+				return nil, errors.Errorf("job %q is not running", name)
+			}
+			apply, ok, err := job.Reconfigure(conf.Global, running, c, next)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				actions[name] = reloadReconfigure
+				applies[name] = apply
+			} else {
+				actions[name] = reloadRestart
+			}
+		}
+	}
+	for name := range cur {
+		if _, ok := actions[name]; !ok {
+			actions[name] = reloadStop
+		}
+	}
+
+	// receiving jobs protect the snapshots of their downstream jobs, see job.JobsFromConfig
+	for _, next := range conf.Jobs {
+		var downstream []string
+		switch v := next.Ret.(type) {
+		case *config.SinkJob:
+			downstream = v.DownstreamJobs
+		case *config.PullJob:
+			downstream = v.DownstreamJobs
+		case *config.LocalJob:
+			downstream = v.DownstreamJobs
+		}
+		for _, d := range downstream {
+			if a := actions[d]; a != reloadUnchanged && a != reloadReconfigure && actions[next.Name()] != reloadStart {
+				actions[next.Name()] = reloadRestart
+				delete(applies, next.Name())
+			}
+		}
+	}
+
+	// a shared listener cannot be rebuilt while some of its jobs keep running
+	for _, groups := range []map[string][]string{job.SharedListenerGroups(r.conf), job.SharedListenerGroups(conf)} {
+		for addr, names := range groups {
+			var keep, replace []string
+			for _, name := range names {
+				if a := actions[name]; a == reloadUnchanged || a == reloadReconfigure {
+					keep = append(keep, name)
+				} else {
+					replace = append(replace, name)
+				}
+			}
+			if len(keep) > 0 && len(replace) > 0 {
+				return nil, errors.Errorf("jobs %q and %q share a listener on %q: their changes require a daemon restart", keep, replace, addr)
+			}
+		}
+	}
+
+	return func() *ReloadResponse {
+		return r.apply(conf, built, actions, applies)
+	}, nil
+}
+
+func (r *reloader) apply(conf *config.Config, built []job.Job, actions map[string]reloadAction, applies map[string]func()) *ReloadResponse {
+	res := &ReloadResponse{}
+	var stopped []<-chan struct{}
+	var start []job.Job
+	for _, j := range built {
+		switch actions[j.Name()] {
+		case reloadUnchanged:
+			res.Unchanged = append(res.Unchanged, j.Name())
+		case reloadReconfigure:
+			res.Reconfigured = append(res.Reconfigured, j.Name())
+			applies[j.Name()]()
+		case reloadRestart:
+			res.Restarted = append(res.Restarted, j.Name())
+			start = append(start, j)
+		case reloadStart:
+			res.Started = append(res.Started, j.Name())
+			start = append(start, j)
+		}
+	}
+	for name, a := range actions {
+		if a != reloadStop && a != reloadRestart {
+			continue
+		}
+		if a == reloadStop {
+			res.Stopped = append(res.Stopped, name)
+		}
+		removed, err := r.jobs.stop(name)
+		if err != nil {
+			r.log.WithError(err).WithField("job", name).Error("cannot stop job")
+			continue
+		}
+		r.log.WithField("job", name).Info("stopping job")
+		stopped = append(stopped, removed)
+	}
+	sort.Strings(res.Stopped)
+	r.conf = conf
+
+	applied := make(chan struct{})
+	r.applied = applied
+	go func() {
+		defer close(applied)
+		for _, removed := range stopped {
+			select {
+			case <-removed:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+		if r.jobs.shuttingDown() {
+			r.log.Info("daemon is shutting down, not starting the reloaded jobs")
+			return
+		}
+		for _, j := range start {
+			r.jobs.start(r.ctx, j, false)
+		}
+	}()
+
+	return res
+}
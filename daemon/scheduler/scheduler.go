@@ -0,0 +1,148 @@
+// Package scheduler enforces the daemon-wide budget configured in field `global.scheduler`.
+// The budget is shared by all jobs of the daemon, so that adding jobs does not multiply the load on the system:
+//
+//   - the number of concurrent replications of the active jobs,
+//   - the number of concurrent zfs commands (see AcquireZFSCommand for the exceptions),
+//   - the number of snapshots that the pruners destroy per minute.
+//
+// Each operation of a job consumes the job's weight (field `weight` of the job, see WithWeight) from the budget,
+// i.e., a job with weight 2 counts twice towards the limits.
+// A weight greater than a limit consumes the entire limit.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/util/ratelimit"
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+type Limits struct {
+	// 0 means unlimited for all fields
+	Replications      int
+	ZFSCommands       int
+	DestroysPerMinute int
+}
+
+type budget struct {
+	limits       Limits
+	replications *semaphore.S
+	zfsCommands  *semaphore.S
+	destroys     *ratelimit.Limiter
+}
+
+// nil means unlimited
+var global *budget
+
+// Configure sets the daemon-wide limits.
+//
+// Must be called before any other function in this package is used,
+// i.e., during daemon initialization.
+func Configure(l Limits) error {
+	if l.Replications < 0 || l.ZFSCommands < 0 || l.DestroysPerMinute < 0 {
+		return errors.New("limits must not be negative")
+	}
+	b := &budget{limits: l}
+	if l.Replications > 0 {
+		b.replications = semaphore.New(int64(l.Replications))
+	}
+	if l.ZFSCommands > 0 {
+		b.zfsCommands = semaphore.New(int64(l.ZFSCommands))
+	}
+	if l.DestroysPerMinute > 0 {
+		b.destroys = ratelimit.New(l.DestroysPerMinute, time.Minute)
+	}
+	global = b
+	return nil
+}
+
+type contextKey int
+
+const contextKeyWeight contextKey = 1
+
+// WithWeight sets the weight of the operations that run with ctx, i.e., of a job.
+// Operations without a weight, e.g., those of the daemon's internal jobs, have weight 1.
+func WithWeight(ctx context.Context, weight int) context.Context {
+	return context.WithValue(ctx, contextKeyWeight, weight)
+}
+
+// WithInherit returns ctx with the weight of inheritFrom, e.g., for the handlers of RPCs that a job serves.
+func WithInherit(ctx, inheritFrom context.Context) context.Context {
+	if w, ok := inheritFrom.Value(contextKeyWeight).(int); ok {
+		return WithWeight(ctx, w)
+	}
+	return ctx
+}
+
+func weight(ctx context.Context, limit int) int64 {
+	w, ok := ctx.Value(contextKeyWeight).(int)
+	if !ok || w < 1 {
+		w = 1
+	}
+	if w > limit {
+		w = limit
+	}
+	return int64(w)
+}
+
+func getLogger(ctx context.Context) logger.Logger {
+	return logging.GetLogger(ctx, logging.SubsysJob)
+}
+
+// logLevel is the level of the message that the operation has to wait, zfs commands are too frequent for info
+func acquire(ctx context.Context, s *semaphore.S, limit int, what string, logLevel logger.Level) (*semaphore.AcquireGuard, error) {
+	if s == nil {
+		return nil, nil
+	}
+	n := weight(ctx, limit)
+	if g := s.TryAcquireN(n); g != nil {
+		return g, nil
+	}
+	getLogger(ctx).WithField("weight", n).WithField("limit", limit).
+		Log(logLevel, "waiting for daemon-wide "+what+" budget")
+	return s.AcquireN(ctx, n)
+}
+
+// AcquireReplication blocks until the replication that runs with ctx may start or ctx is done.
+// The caller must release the returned guard when the replication is complete.
+// The guard is nil if replications are unlimited, AcquireGuard.Release is a no-op for a nil guard.
+func AcquireReplication(ctx context.Context) (*semaphore.AcquireGuard, error) {
+	if global == nil {
+		return nil, nil
+	}
+	return acquire(ctx, global.replications, global.limits.Replications, "replication", logger.Info)
+}
+
+// AcquireZFSCommand is AcquireReplication for a zfs command.
+//
+// The daemon sets it as the budget of package zfscmd (see zfscmd.SetBudget), which acquires it
+// for the commands whose output is read at once, and so does zfs.ZFSList.
+// zfs send, zfs recv and listings whose output is streamed to the caller are not limited:
+// they run for as long as the caller consumes them, and a caller that holds the
+// budget while waiting for another command could wait forever.
+// Sends and receives are limited through field `global.zfs_concurrency` instead.
+func AcquireZFSCommand(ctx context.Context) (*semaphore.AcquireGuard, error) {
+	if global == nil {
+		return nil, nil
+	}
+	return acquire(ctx, global.zfsCommands, global.limits.ZFSCommands, "zfs command", logger.Debug)
+}
+
+// WaitDestroys blocks until n snapshots may be destroyed by the pruner that runs with ctx, or ctx is done.
+func WaitDestroys(ctx context.Context, n int) error {
+	if global == nil || global.destroys == nil {
+		return nil
+	}
+	w := weight(ctx, global.limits.DestroysPerMinute)
+	for i := 0; i < n; i++ {
+		if err := global.destroys.Wait(ctx, float64(w)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+func TestWeight(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, int64(1), weight(ctx, 4))
+	ctx = WithWeight(ctx, 3)
+	assert.Equal(t, int64(3), weight(ctx, 4))
+	assert.Equal(t, int64(2), weight(ctx, 2))
+	assert.Equal(t, int64(3), weight(WithInherit(context.Background(), ctx), 4))
+}
+
+func TestAcquireReplication(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	require.NoError(t, Configure(Limits{}))
+	g, err := AcquireReplication(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, g)
+
+	require.NoError(t, Configure(Limits{Replications: 3}))
+	defer Configure(Limits{})
+
+	heavy, err := AcquireReplication(WithWeight(ctx, 2))
+	require.NoError(t, err)
+	light, err := AcquireReplication(ctx)
+	require.NoError(t, err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = AcquireReplication(timeoutCtx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	heavy.Release()
+	light.Release()
+	// a weight greater than the limit consumes the entire limit
+	all, err := AcquireReplication(WithWeight(ctx, 10))
+	require.NoError(t, err)
+	all.Release()
+}
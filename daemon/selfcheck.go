@@ -0,0 +1,471 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// SelfCheckInvariant is an invariant of the zfs abstractions or placeholders that the self-check verifies.
+type SelfCheckInvariant string
+
+const (
+	// the replication cursor of a job is the only one on its filesystem and,
+	// for local jobs, is on the latest received snapshot
+	SelfCheckInvariantReplicationCursor SelfCheckInvariant = "replication_cursor"
+	// the last-received-hold of a job is the only one on its filesystem and is on the latest snapshot
+	SelfCheckInvariantLastReceivedHold SelfCheckInvariant = "last_received_hold"
+	// step holds are released once their replication step is superseded
+	SelfCheckInvariantStepHold SelfCheckInvariant = "step_hold"
+	// all abstractions belong to a configured job
+	SelfCheckInvariantUnknownJob SelfCheckInvariant = "unknown_job"
+	// placeholders have the current property value and no snapshots
+	SelfCheckInvariantPlaceholder SelfCheckInvariant = "placeholder"
+)
+
+var selfCheckInvariants = []SelfCheckInvariant{
+	SelfCheckInvariantReplicationCursor,
+	SelfCheckInvariantLastReceivedHold,
+	SelfCheckInvariantStepHold,
+	SelfCheckInvariantUnknownJob,
+	SelfCheckInvariantPlaceholder,
+}
+
+// SelfCheckStatus is the status of the self-check, see config field `global.self_check`.
+type SelfCheckStatus struct {
+	Interval time.Duration
+	// nil until the first check completed
+	Last *SelfCheckReport `json:",omitempty"`
+}
+
+type SelfCheckReport struct {
+	StartAt, FinishAt time.Time
+	Violations        []SelfCheckViolation
+	// the checks that could not be completed, e.g., because a filesystem could not be listed
+	Errors []string
+}
+
+type SelfCheckViolation struct {
+	Invariant SelfCheckInvariant
+	// the name of the job, or the job ID of the abstraction for SelfCheckInvariantUnknownJob
+	// and for the abstractions of push job targets
+	Job         string
+	Filesystem  string
+	Description string
+}
+
+// A violation is only reported if the second pass of a check confirms it,
+// so that abstractions which replication and pruning are about to update are not reported.
+var selfCheckConfirmDelay = envconst.Duration("ZREPL_SELF_CHECK_CONFIRM_DELAY", 1*time.Minute)
+
+// selfCheckPassFunc is selfCheckPass, replaced in tests.
+type selfCheckPassFunc func(ctx context.Context, conf *config.Config, jobs *jobs) (violations []SelfCheckViolation, errs []string)
+
+type selfCheckJob struct {
+	interval   time.Duration
+	reloader   *reloader
+	eventHooks *hooks.EventHooks
+	pass       selfCheckPassFunc
+
+	promViolations    *prometheus.GaugeVec
+	promErrors        prometheus.Gauge
+	promLastCompleted prometheus.Gauge
+
+	mtx  sync.Mutex
+	last *SelfCheckReport
+}
+
+func newSelfCheckJobFromConfig(in *config.GlobalSelfCheck, reloader *reloader) (*selfCheckJob, error) {
+	eventHooks, err := hooks.EventHooksFromConfig(jobNameSelfCheck, in.EventHooks, hooks.EventSelfCheckCompleted)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `event_hooks`")
+	}
+	j := &selfCheckJob{
+		interval:   in.Interval,
+		reloader:   reloader,
+		eventHooks: eventHooks,
+		pass:       selfCheckPass,
+	}
+	j.promViolations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "self_check",
+		Name:      "violations",
+		Help:      "number of invariant violations found by the latest self-check",
+	}, []string{"invariant"})
+	j.promErrors = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "self_check",
+		Name:      "errors",
+		Help:      "number of checks that the latest self-check could not complete",
+	})
+	j.promLastCompleted = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "self_check",
+		Name:      "last_completed_timestamp_seconds",
+		Help:      "time at which the latest self-check completed",
+	})
+	return j, nil
+}
+
+func (j *selfCheckJob) Name() string { return jobNameSelfCheck }
+
+func (j *selfCheckJob) Status() *job.Status { return &job.Status{Type: job.TypeInternal} }
+
+func (j *selfCheckJob) OwnedDatasetSubtreeRoot() (p *zfs.DatasetPath, ok bool) { return nil, false }
+
+func (j *selfCheckJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func (j *selfCheckJob) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.promViolations, j.promErrors, j.promLastCompleted)
+}
+
+func (j *selfCheckJob) status() *SelfCheckStatus {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return &SelfCheckStatus{Interval: j.interval, Last: j.last}
+}
+
+func (j *selfCheckJob) Run(ctx context.Context) {
+	log := job.GetLogger(ctx)
+	ctx = hooks.WithEventHooks(ctx, j.eventHooks)
+
+	// replication and pruning clean up after themselves, hence the first check only runs after one interval
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-wakeup.Wait(ctx):
+		}
+		log.Info("start self-check")
+		rep, ok := j.check(ctx)
+		if !ok {
+			return // ctx is done
+		}
+		j.mtx.Lock()
+		j.last = rep
+		j.mtx.Unlock()
+		j.updateMetrics(rep)
+		j.notify(ctx, rep)
+
+		l := log.WithField("violations", len(rep.Violations)).WithField("errors", len(rep.Errors))
+		for _, v := range rep.Violations {
+			log.WithField("invariant", v.Invariant).
+				WithField("job", v.Job).
+				WithField("fs", v.Filesystem).
+				Warn(v.Description)
+		}
+		for _, e := range rep.Errors {
+			log.Error(e)
+		}
+		if len(rep.Violations) > 0 {
+			l.Warn("self-check found invariant violations")
+		} else {
+			l.Info("self-check completed")
+		}
+	}
+}
+
+// check runs two passes of selfCheckPass and reports the violations that both found.
+// ok is false if ctx is done before the check completed.
+func (j *selfCheckJob) check(ctx context.Context) (_ *SelfCheckReport, ok bool) {
+	rep := &SelfCheckReport{StartAt: time.Now()}
+	conf := j.reloader.config()
+
+	first, _ := j.pass(ctx, conf, j.reloader.jobs)
+	if len(first) > 0 {
+		job.GetLogger(ctx).WithField("violations", len(first)).WithField("delay", selfCheckConfirmDelay).
+			Debug("wait before confirming the violations")
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(selfCheckConfirmDelay):
+		}
+	}
+	second, errs := j.pass(ctx, conf, j.reloader.jobs)
+	if ctx.Err() != nil {
+		return nil, false
+	}
+
+	found := make(map[SelfCheckViolation]bool, len(first))
+	for _, v := range first {
+		found[v] = true
+	}
+	for _, v := range second {
+		if found[v] {
+			rep.Violations = append(rep.Violations, v)
+		}
+	}
+	sort.Slice(rep.Violations, func(i, k int) bool {
+		a, b := rep.Violations[i], rep.Violations[k]
+		if a.Invariant != b.Invariant {
+			return a.Invariant < b.Invariant
+		}
+		if a.Job != b.Job {
+			return a.Job < b.Job
+		}
+		return a.Filesystem < b.Filesystem
+	})
+	rep.Errors = errs
+	rep.FinishAt = time.Now()
+	return rep, true
+}
+
+func (j *selfCheckJob) updateMetrics(rep *SelfCheckReport) {
+	count := make(map[SelfCheckInvariant]int, len(selfCheckInvariants))
+	for _, v := range rep.Violations {
+		count[v.Invariant]++
+	}
+	for _, i := range selfCheckInvariants {
+		j.promViolations.WithLabelValues(string(i)).Set(float64(count[i]))
+	}
+	j.promErrors.Set(float64(len(rep.Errors)))
+	j.promLastCompleted.Set(float64(rep.FinishAt.Unix()))
+}
+
+func (j *selfCheckJob) notify(ctx context.Context, rep *SelfCheckReport) {
+	details := &hooks.SelfCheckEventDetails{
+		Violations: make([]hooks.SelfCheckViolation, len(rep.Violations)),
+		Errors:     rep.Errors,
+	}
+	for i, v := range rep.Violations {
+		details.Violations[i] = hooks.SelfCheckViolation{
+			Invariant:   string(v.Invariant),
+			Job:         v.Job,
+			Filesystem:  v.Filesystem,
+			Description: v.Description,
+		}
+	}
+	var err error
+	if len(rep.Violations) > 0 {
+		err = fmt.Errorf("self-check found %d invariant violation(s)", len(rep.Violations))
+	}
+	hooks.NotifyEvent(ctx, hooks.EventSelfCheckCompleted, err, details)
+}
+
+type selfCheckFSAndJob struct {
+	fs  string
+	job endpoint.JobID
+}
+
+type selfCheckResult struct {
+	violations []SelfCheckViolation
+	errs       []string
+}
+
+func (r *selfCheckResult) put(i SelfCheckInvariant, job, fs, format string, args ...interface{}) {
+	r.violations = append(r.violations, SelfCheckViolation{
+		Invariant:   i,
+		Job:         job,
+		Filesystem:  fs,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *selfCheckResult) putErr(err error, format string, args ...interface{}) {
+	r.errs = append(r.errs, errors.Wrapf(err, format, args...).Error())
+}
+
+// selfCheckPass checks the abstractions on all filesystems and the filesystems that the jobs of conf receive into.
+// errs are the checks that could not be completed.
+func selfCheckPass(ctx context.Context, conf *config.Config, jobs *jobs) (violations []SelfCheckViolation, errs []string) {
+	var r selfCheckResult
+
+	knownJobs, err := job.JobIDsFromConfig(conf)
+	if err != nil {
+		r.putErr(err, "cannot determine the job IDs of the config")
+		return r.violations, r.errs
+	}
+
+	si, err := endpoint.ListStale(ctx, endpoint.ListZFSHoldsAndBookmarksQuery{
+		FS: endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{
+			Filter: zfs.NoFilter(),
+		},
+		What:         endpoint.AbstractionTypesAll,
+		Concurrency:  envconst.Int64("ZREPL_SELF_CHECK_LIST_CONCURRENCY", 1),
+		AllowPartial: true,
+	})
+	if err != nil {
+		r.putErr(err, "cannot list abstractions")
+		return r.violations, r.errs
+	}
+	for _, e := range si.ListErrors {
+		r.putErr(e, "cannot list abstractions")
+	}
+
+	cursors, lastReceived := r.checkAbstractions(si.Live, si.Stale, knownJobs)
+
+	for _, jc := range conf.Jobs {
+		j, ok := jobs.get(jc.Name())
+		if !ok {
+			continue // not running, e.g. because it is being reconfigured
+		}
+		root, ok := j.OwnedDatasetSubtreeRoot()
+		if !ok {
+			continue
+		}
+		jobID, err := endpoint.MakeJobID(j.Name())
+		if err != nil {
+			r.putErr(err, "job %q: invalid job name", j.Name())
+			continue
+		}
+		// both sides of local jobs are on this host
+		local := j.SenderConfig()
+		var senderFSS map[string]bool
+		if local != nil {
+			l, err := zfs.ZFSListMapping(ctx, local.FSF)
+			if err != nil {
+				r.putErr(err, "job %q: cannot list sender filesystems", j.Name())
+				continue
+			}
+			senderFSS = make(map[string]bool, len(l))
+			for _, fs := range l {
+				senderFSS[fs.ToString()] = true
+			}
+		}
+
+		fsf := filters.NewDatasetMapFilter(1, true)
+		if err := fsf.Add(root.ToString()+"<", "ok"); err != nil {
+			r.putErr(err, "job %q: cannot build filter for root_fs", j.Name())
+			continue
+		}
+		fss, err := zfs.ZFSListMapping(ctx, fsf)
+		if err != nil {
+			r.putErr(err, "job %q: cannot list received filesystems", j.Name())
+			continue
+		}
+		versions, err := zfs.ZFSListFilesystemVersionsBulk(ctx, fss, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+		if err != nil {
+			r.putErr(err, "job %q: cannot list snapshots of received filesystems", j.Name())
+			continue
+		}
+
+		for _, fs := range fss {
+			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fs)
+			if err != nil {
+				r.putErr(err, "job %q: cannot get placeholder state of %q", j.Name(), fs.ToString())
+				continue
+			}
+			latest := r.checkReceivedFS(j.Name(), ph, versions[fs.ToString()], lastReceived[selfCheckFSAndJob{fs.ToString(), jobID}])
+			if latest == nil || local == nil {
+				continue
+			}
+			senderFS := fs.Copy()
+			senderFS.TrimPrefix(root)
+			if !senderFSS[senderFS.ToString()] {
+				continue // e.g. excluded from the job after it was received, the sender does not maintain a cursor for it
+			}
+			r.checkLocalCursor(j.Name(), senderFS.ToString(), fs.ToString(), *latest, cursors[selfCheckFSAndJob{senderFS.ToString(), local.JobID}])
+		}
+	}
+	return r.violations, r.errs
+}
+
+// checkAbstractions checks the abstractions that ListStale found
+// and returns the current cursors and last-received-holds, by filesystem and job.
+func (r *selfCheckResult) checkAbstractions(live, stale []endpoint.Abstraction, knownJobs map[endpoint.JobID]bool) (cursors, lastReceived map[selfCheckFSAndJob]endpoint.Abstraction) {
+	unknown := make(map[string]bool)
+	for _, a := range endpoint.AbstractionsOfUnknownJobs(append(live, stale...), knownJobs) {
+		unknown[a.GetFullPath()] = true
+		r.put(SelfCheckInvariantUnknownJob, a.GetJobID().String(), a.GetFS(),
+			"%s belongs to a job that is not configured, see `zrepl zfs-abstraction doctor`", a)
+	}
+	for _, a := range stale {
+		if unknown[a.GetFullPath()] {
+			continue
+		}
+		var jobID string
+		if id := a.GetJobID(); id != nil {
+			jobID = id.String()
+		}
+		switch a.GetType() {
+		case endpoint.AbstractionStepHold, endpoint.AbstractionProxiedStepHold:
+			r.put(SelfCheckInvariantStepHold, jobID, a.GetFS(),
+				"%s was not released although its replication step is superseded, see `zrepl zfs-abstraction release-stale`", a)
+		case endpoint.AbstractionReplicationCursorBookmarkV2, endpoint.AbstractionTentativeReplicationCursorBookmark:
+			r.put(SelfCheckInvariantReplicationCursor, jobID, a.GetFS(),
+				"%s was not destroyed although it is superseded by a newer replication cursor", a)
+		case endpoint.AbstractionLastReceivedHold:
+			r.put(SelfCheckInvariantLastReceivedHold, jobID, a.GetFS(),
+				"%s was not released although it is superseded by a newer last-received-hold", a)
+		}
+	}
+
+	cursors = make(map[selfCheckFSAndJob]endpoint.Abstraction)
+	lastReceived = make(map[selfCheckFSAndJob]endpoint.Abstraction)
+	for _, a := range live {
+		if a.GetJobID() == nil {
+			continue
+		}
+		k := selfCheckFSAndJob{a.GetFS(), *a.GetJobID()}
+		switch a.GetType() {
+		case endpoint.AbstractionReplicationCursorBookmarkV2:
+			cursors[k] = a
+		case endpoint.AbstractionLastReceivedHold:
+			lastReceived[k] = a
+		}
+	}
+	return cursors, lastReceived
+}
+
+// checkReceivedFS checks a filesystem below the root_fs of job, with snapshots snaps
+// and the job's last-received-hold h (nil if none).
+// Returns the latest snapshot, or nil if the filesystem does not exist, is a placeholder or has no snapshots.
+func (r *selfCheckResult) checkReceivedFS(job string, ph *zfs.FilesystemPlaceholderState, snaps []zfs.FilesystemVersion, h endpoint.Abstraction) *zfs.FilesystemVersion {
+	if !ph.FSExists {
+		return nil // destroyed in the meantime
+	}
+	if ph.IsPlaceholder {
+		if ph.IsLegacyPlaceholder() {
+			r.put(SelfCheckInvariantPlaceholder, job, ph.FS,
+				"placeholder uses the legacy property value of zrepl 0.0.x, run `zrepl migrate 0.0.X:0.1:placeholder`")
+		}
+		if len(snaps) > 0 {
+			r.put(SelfCheckInvariantPlaceholder, job, ph.FS,
+				"placeholder has %d snapshot(s), i.e., a receive did not clear property %s", len(snaps), zfs.PlaceholderPropertyName)
+		}
+		return nil
+	}
+	if len(snaps) == 0 {
+		return nil
+	}
+	latest := snaps[0]
+	for _, s := range snaps {
+		if s.CreateTXG > latest.CreateTXG {
+			latest = s
+		}
+	}
+	if h != nil && h.GetFilesystemVersion().Guid != latest.Guid {
+		r.put(SelfCheckInvariantLastReceivedHold, job, ph.FS,
+			"%s is not on the latest snapshot %s", h, latest.RelName())
+	}
+	return &latest
+}
+
+// checkLocalCursor checks the replication cursor c (nil if none) of a local job on senderFS,
+// whose latest snapshot received into receivedFS is latest.
+func (r *selfCheckResult) checkLocalCursor(job, senderFS, receivedFS string, latest zfs.FilesystemVersion, c endpoint.Abstraction) {
+	if c == nil {
+		r.put(SelfCheckInvariantReplicationCursor, job, senderFS,
+			"there is no replication cursor although %s received snapshot %s", receivedFS, latest.RelName())
+	} else if c.GetFilesystemVersion().Guid != latest.Guid {
+		r.put(SelfCheckInvariantReplicationCursor, job, senderFS,
+			"%s does not match the latest snapshot %s received by %s", c, latest.RelName(), receivedFS)
+	}
+}
@@ -0,0 +1,191 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type fakeAbstraction struct {
+	endpoint.Abstraction // unused methods panic
+	typ                  endpoint.AbstractionType
+	fs                   string
+	jobID                *endpoint.JobID
+	guid                 uint64
+}
+
+func (a *fakeAbstraction) GetType() endpoint.AbstractionType { return a.typ }
+func (a *fakeAbstraction) GetFS() string                     { return a.fs }
+func (a *fakeAbstraction) GetJobID() *endpoint.JobID         { return a.jobID }
+func (a *fakeAbstraction) GetFullPath() string {
+	return fmt.Sprintf("%s#%s-%d-%s", a.fs, a.typ, a.guid, a.jobID)
+}
+func (a *fakeAbstraction) GetFilesystemVersion() zfs.FilesystemVersion {
+	return zfs.FilesystemVersion{Type: zfs.Snapshot, Guid: a.guid}
+}
+func (a *fakeAbstraction) String() string { return a.GetFullPath() }
+
+func mustJobID(t *testing.T, name string) *endpoint.JobID {
+	id, err := endpoint.MakeJobID(name)
+	require.NoError(t, err)
+	return &id
+}
+
+func invariants(vs []SelfCheckViolation) []SelfCheckInvariant {
+	var res []SelfCheckInvariant
+	for _, v := range vs {
+		res = append(res, v.Invariant)
+	}
+	return res
+}
+
+func TestSelfCheckAbstractions(t *testing.T) {
+	push, gone := mustJobID(t, "push"), mustJobID(t, "gone")
+	knownJobs := map[endpoint.JobID]bool{*push: true}
+
+	cursor := &fakeAbstraction{typ: endpoint.AbstractionReplicationCursorBookmarkV2, fs: "pool/a", jobID: push, guid: 2}
+	hold := &fakeAbstraction{typ: endpoint.AbstractionLastReceivedHold, fs: "pool/b", jobID: push, guid: 3}
+	live := []endpoint.Abstraction{
+		cursor,
+		hold,
+		&fakeAbstraction{typ: endpoint.AbstractionStepHold, fs: "pool/a", jobID: gone, guid: 2},
+	}
+	stale := []endpoint.Abstraction{
+		&fakeAbstraction{typ: endpoint.AbstractionStepHold, fs: "pool/a", jobID: push, guid: 1},
+		&fakeAbstraction{typ: endpoint.AbstractionReplicationCursorBookmarkV2, fs: "pool/a", jobID: push, guid: 1},
+		&fakeAbstraction{typ: endpoint.AbstractionLastReceivedHold, fs: "pool/b", jobID: push, guid: 1},
+		// reported once, as unknown job
+		&fakeAbstraction{typ: endpoint.AbstractionStepHold, fs: "pool/a", jobID: gone, guid: 1},
+	}
+
+	var r selfCheckResult
+	cursors, lastReceived := r.checkAbstractions(live, stale, knownJobs)
+	assert.Equal(t, []SelfCheckInvariant{
+		SelfCheckInvariantUnknownJob,
+		SelfCheckInvariantUnknownJob,
+		SelfCheckInvariantStepHold,
+		SelfCheckInvariantReplicationCursor,
+		SelfCheckInvariantLastReceivedHold,
+	}, invariants(r.violations))
+	assert.Equal(t, "gone", r.violations[0].Job)
+	assert.Empty(t, r.errs)
+	assert.Equal(t, map[selfCheckFSAndJob]endpoint.Abstraction{{"pool/a", *push}: cursor}, cursors)
+	assert.Equal(t, map[selfCheckFSAndJob]endpoint.Abstraction{{"pool/b", *push}: hold}, lastReceived)
+}
+
+func TestSelfCheckReceivedFS(t *testing.T) {
+	snaps := []zfs.FilesystemVersion{
+		{Type: zfs.Snapshot, Name: "b", Guid: 20, CreateTXG: 2},
+		{Type: zfs.Snapshot, Name: "a", Guid: 10, CreateTXG: 1},
+	}
+	exists := &zfs.FilesystemPlaceholderState{FS: "pool/sink/a", FSExists: true}
+	holdOn := func(guid uint64) endpoint.Abstraction {
+		return &fakeAbstraction{typ: endpoint.AbstractionLastReceivedHold, fs: "pool/sink/a", jobID: mustJobID(t, "sink"), guid: guid}
+	}
+
+	t.Run("consistent", func(t *testing.T) {
+		var r selfCheckResult
+		latest := r.checkReceivedFS("sink", exists, snaps, holdOn(20))
+		require.NotNil(t, latest)
+		assert.Equal(t, uint64(20), latest.Guid)
+		assert.Empty(t, r.violations)
+		r.checkReceivedFS("sink", exists, snaps, nil)
+		assert.Empty(t, r.violations)
+	})
+
+	t.Run("hold_not_on_latest", func(t *testing.T) {
+		var r selfCheckResult
+		r.checkReceivedFS("sink", exists, snaps, holdOn(10))
+		assert.Equal(t, []SelfCheckInvariant{SelfCheckInvariantLastReceivedHold}, invariants(r.violations))
+		assert.Equal(t, "pool/sink/a", r.violations[0].Filesystem)
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		var r selfCheckResult
+		ph := &zfs.FilesystemPlaceholderState{FS: "pool/sink", FSExists: true, IsPlaceholder: true, RawLocalPropertyValue: "on"}
+		assert.Nil(t, r.checkReceivedFS("sink", ph, nil, nil))
+		assert.Empty(t, r.violations)
+		assert.Nil(t, r.checkReceivedFS("sink", ph, snaps, nil))
+		ph.RawLocalPropertyValue = "a0b1c2"
+		r.checkReceivedFS("sink", ph, nil, nil)
+		assert.Equal(t, []SelfCheckInvariant{SelfCheckInvariantPlaceholder, SelfCheckInvariantPlaceholder}, invariants(r.violations))
+	})
+
+	t.Run("destroyed_or_empty", func(t *testing.T) {
+		var r selfCheckResult
+		assert.Nil(t, r.checkReceivedFS("sink", &zfs.FilesystemPlaceholderState{FS: "pool/sink/a"}, snaps, holdOn(10)))
+		assert.Nil(t, r.checkReceivedFS("sink", exists, nil, holdOn(10)))
+		assert.Empty(t, r.violations)
+	})
+
+	t.Run("local_cursor", func(t *testing.T) {
+		var r selfCheckResult
+		cursorOn := func(guid uint64) endpoint.Abstraction {
+			return &fakeAbstraction{typ: endpoint.AbstractionReplicationCursorBookmarkV2, fs: "pool/a", jobID: mustJobID(t, "local_sender"), guid: guid}
+		}
+		r.checkLocalCursor("local", "pool/a", "pool/sink/a", snaps[0], cursorOn(20))
+		assert.Empty(t, r.violations)
+		r.checkLocalCursor("local", "pool/a", "pool/sink/a", snaps[0], cursorOn(10))
+		r.checkLocalCursor("local", "pool/a", "pool/sink/a", snaps[0], nil)
+		assert.Equal(t, []SelfCheckInvariant{SelfCheckInvariantReplicationCursor, SelfCheckInvariantReplicationCursor}, invariants(r.violations))
+		assert.Equal(t, "pool/a", r.violations[0].Filesystem)
+	})
+}
+
+func TestSelfCheckConfirm(t *testing.T) {
+	defer func(d time.Duration) { selfCheckConfirmDelay = d }(selfCheckConfirmDelay)
+	selfCheckConfirmDelay = 10 * time.Millisecond
+
+	v := func(fs string) SelfCheckViolation {
+		return SelfCheckViolation{Invariant: SelfCheckInvariantStepHold, Job: "push", Filesystem: fs, Description: "stale"}
+	}
+	newJob := func(passes ...[]SelfCheckViolation) (*selfCheckJob, *int) {
+		calls := 0
+		return &selfCheckJob{
+			reloader: &reloader{conf: &config.Config{}},
+			pass: func(ctx context.Context, conf *config.Config, jobs *jobs) ([]SelfCheckViolation, []string) {
+				calls++
+				return passes[calls-1], []string{fmt.Sprintf("error of pass %d", calls)}
+			},
+		}, &calls
+	}
+
+	t.Run("only_persistent_violations", func(t *testing.T) {
+		j, calls := newJob(
+			[]SelfCheckViolation{v("pool/b"), v("pool/a"), v("pool/transient")},
+			[]SelfCheckViolation{v("pool/a"), v("pool/new"), v("pool/b")},
+		)
+		rep, ok := j.check(context.Background())
+		require.True(t, ok)
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, []SelfCheckViolation{v("pool/a"), v("pool/b")}, rep.Violations)
+		assert.Equal(t, []string{"error of pass 2"}, rep.Errors, "errors are those of the second pass")
+		assert.False(t, rep.FinishAt.Before(rep.StartAt))
+	})
+
+	t.Run("no_violations_in_first_pass", func(t *testing.T) {
+		j, calls := newJob(nil, []SelfCheckViolation{v("pool/a")})
+		rep, ok := j.check(context.Background())
+		require.True(t, ok)
+		assert.Equal(t, 2, *calls)
+		assert.Empty(t, rep.Violations)
+	})
+
+	t.Run("canceled_while_waiting", func(t *testing.T) {
+		selfCheckConfirmDelay = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		j, calls := newJob([]SelfCheckViolation{v("pool/a")}, []SelfCheckViolation{v("pool/a")})
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, ok := j.check(ctx)
+		assert.False(t, ok)
+		assert.Equal(t, 1, *calls)
+	})
+}
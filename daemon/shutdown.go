@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/job"
+)
+
+// ShutdownStatus is the status of a daemon that drains its jobs before it exits.
+type ShutdownStatus struct {
+	Since time.Time
+	// the jobs that are still running are cancelled at Deadline
+	Deadline time.Time
+	// the jobs that did not finish their current replication step or pruning yet
+	Draining []string
+}
+
+// drain asks the jobs that replicate or snapshot to stop gracefully (see package stop),
+// e.g., to finish the replication steps that are executing.
+// Passive jobs are asked to stop once the others stopped, so that they keep serving the jobs of this daemon that drain,
+// they finish the steps that they serve for the active side and refuse new ones.
+// Internal jobs are not stopped.
+// The returned channel is closed once the stopped jobs exited or timeout elapsed.
+func (s *jobs) drain(timeout time.Duration) <-chan struct{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	s.shutdown = &ShutdownStatus{Since: now, Deadline: now.Add(timeout)}
+	var active, passive []string
+	for name, j := range s.jobs {
+		if IsInternalJobName(name) {
+			continue
+		}
+		if _, ok := j.(*job.PassiveSide); ok {
+			passive = append(passive, name)
+		} else {
+			active = append(active, name)
+		}
+		s.shutdown.Draining = append(s.shutdown.Draining, name)
+	}
+	sort.Strings(s.shutdown.Draining)
+
+	// stopJobs must be called with s.m held
+	stopJobs := func(names []string) <-chan struct{} {
+		var wg sync.WaitGroup
+		for _, name := range names {
+			s.stops[name]()
+			wg.Add(1)
+			go func(name string, done <-chan struct{}) {
+				defer wg.Done()
+				<-done
+				s.m.Lock()
+				defer s.m.Unlock()
+				for i := range s.shutdown.Draining {
+					if s.shutdown.Draining[i] == name {
+						s.shutdown.Draining = append(s.shutdown.Draining[:i], s.shutdown.Draining[i+1:]...)
+						break
+					}
+				}
+			}(name, s.dones[name])
+		}
+		stopped := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(stopped)
+		}()
+		return stopped
+	}
+
+	activeStopped := stopJobs(active)
+	stopped := make(chan struct{})
+	go func() {
+		<-activeStopped
+		s.m.Lock()
+		passiveStopped := stopJobs(passive)
+		s.m.Unlock()
+		<-passiveStopped
+		close(stopped)
+	}()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+		select {
+		case <-stopped:
+		case <-deadline.C:
+		}
+	}()
+	return drained
+}
+
+// shuttingDown returns true once drain was called.
+func (s *jobs) shuttingDown() bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.shutdown != nil
+}
+
+// shutdownStatus returns nil unless the daemon is shutting down.
+func (s *jobs) shutdownStatus() *ShutdownStatus {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if s.shutdown == nil {
+		return nil
+	}
+	st := *s.shutdown
+	st.Draining = append([]string(nil), s.shutdown.Draining...)
+	return &st
+}
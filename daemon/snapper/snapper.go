@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,7 +15,9 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/daemon/hooks"
+	"github.com/zrepl/zrepl/daemon/job/trigger"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/zfs"
@@ -27,6 +31,7 @@ const (
 	SnapStarted
 	SnapDone
 	SnapError
+	SnapSkipped
 )
 
 // All fields protected by Snapper.mtx
@@ -45,14 +50,42 @@ type snapProgress struct {
 	runResults hooks.PlanReport
 }
 
+// Opt-in because the step holds of snapshots that are never replicated, e.g., because the replication
+// keeps failing, are only released once a later snapshot is replicated, and until then make destroys fail.
+var stepHoldNewSnapshots = envconst.Bool("ZREPL_SNAPPER_STEP_HOLD_NEW_SNAPSHOTS", false)
+
 type args struct {
 	ctx            context.Context
-	prefix         string
+	naming         *naming
 	interval       time.Duration
 	fsf            zfs.DatasetFilter
 	snapshotsTaken chan<- struct{}
 	hooks          *hooks.List
 	dryRun         bool
+	// if JobIDs is not empty, new snapshots are step-held for these jobs right away (see endpoint.SnapshotAndHoldStep)
+	stepHolds endpoint.NewSnapshotStepHolds
+	// don't snapshot filesystems that haven't changed since their most recent snapshot that matches naming
+	skipUnchanged bool
+	// once closed, the snapper stops when it waits for the next snapshot, nil means never
+	stop <-chan struct{}
+	// if not nil, the snapshots are taken at the times of cron in location instead of every interval
+	cron     *trigger.Cron
+	location *time.Location
+	// describes the rule of config.SnapshottingPeriodic.Rules whose filesystems this snapper snapshots,
+	// empty if the snapshotting has no rules
+	rule string
+	// the name of the class of config.SnapshottingPeriodic.Classes that this snapper snapshots,
+	// empty if the snapshotting has no classes
+	class string
+	// see Snapper.SnapshotNow, buffered
+	snapshotNow chan snapshotNowRequest
+	// if true, snapshots are only taken on request, see Snapper.SnapshotNow
+	manual bool
+}
+
+type snapshotNowRequest struct {
+	// nil means all filesystems
+	selection func(fs string) bool
 }
 
 type Snapper struct {
@@ -66,10 +99,18 @@ type Snapper struct {
 
 	// valid for state Snapshotting
 	plan map[*zfs.DatasetPath]*snapProgress
+	// valid for state Snapshotting, true if plan only has the filesystems selected by a SnapshotNow request
+	planSelected bool
 
 	// valid for state SyncUp and Waiting
 	sleepUntil time.Time
 
+	// set when leaving state SyncUp or Waiting for a SnapshotNow request, consumed in state Planning
+	snapshotNowReq *snapshotNowRequest
+	// if not zero, the end of the state Waiting after snapshots of some filesystems were requested,
+	// so that the schedule of the others is not affected
+	resumeAt time.Time
+
 	// valid for state Err
 	err error
 }
@@ -109,9 +150,10 @@ func getLogger(ctx context.Context) Logger {
 	return logging.GetLogger(ctx, logging.SubsysSnapshot)
 }
 
-func PeriodicFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic) (*Snapper, error) {
-	if in.Prefix == "" {
-		return nil, errors.New("prefix must not be empty")
+func PeriodicFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) (*Snapper, error) {
+	naming, err := newNaming(in.Prefix, in.NameTemplate, jobID.String())
+	if err != nil {
+		return nil, err
 	}
 	if in.Interval <= 0 {
 		return nil, errors.New("interval must be positive")
@@ -123,17 +165,102 @@ func PeriodicFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.Snap
 	}
 
 	args := args{
-		prefix:   in.Prefix,
+		naming:   naming,
 		interval: in.Interval,
 		fsf:      fsf,
 		hooks:    hookList,
 		// ctx and log is set in Run()
+		skipUnchanged: in.SkipUnchanged,
+		snapshotNow:   make(chan snapshotNowRequest, 1),
+		stepHolds:     stepHolds,
+	}
+
+	return &Snapper{state: SyncUp, args: args}, nil
+}
+
+func CronFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingCron, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) (*Snapper, error) {
+	naming, err := newNaming(in.Prefix, in.NameTemplate, jobID.String())
+	if err != nil {
+		return nil, err
+	}
+	cron, err := trigger.ParseCron(in.Cron)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cron expression")
+	}
+	location := time.Local
+	if in.TimeZone != "" {
+		if location, err = time.LoadLocation(in.TimeZone); err != nil {
+			return nil, errors.Wrap(err, "invalid time_zone")
+		}
+	}
+
+	hookList, err := hooks.ListFromConfig(&in.Hooks)
+	if err != nil {
+		return nil, errors.Wrap(err, "hook config error")
+	}
+
+	args := args{
+		naming:   naming,
+		cron:     cron,
+		location: location,
+		fsf:      fsf,
+		hooks:    hookList,
+		// ctx and log is set in Run()
+		skipUnchanged: in.SkipUnchanged,
+		snapshotNow:   make(chan snapshotNowRequest, 1),
+		stepHolds:     stepHolds,
 	}
 
 	return &Snapper{state: SyncUp, args: args}, nil
 }
 
+// ManualFromConfig returns the snapper that takes the snapshots of manual snapshotting on request,
+// nil if in does not name snapshots.
+func ManualFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingManual, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) (*Snapper, error) {
+	if in.Prefix == "" && in.NameTemplate == "" {
+		if len(in.Hooks) > 0 || in.SkipUnchanged {
+			return nil, errors.New("fields `hooks` and `skip_unchanged` require field `prefix` or `name_template`")
+		}
+		return nil, nil
+	}
+	naming, err := newNaming(in.Prefix, in.NameTemplate, jobID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	hookList, err := hooks.ListFromConfig(&in.Hooks)
+	if err != nil {
+		return nil, errors.Wrap(err, "hook config error")
+	}
+
+	args := args{
+		naming: naming,
+		fsf:    fsf,
+		hooks:  hookList,
+		// ctx and log is set in Run()
+		skipUnchanged: in.SkipUnchanged,
+		snapshotNow:   make(chan snapshotNowRequest, 1),
+		stepHolds:     stepHolds,
+		manual:        true,
+	}
+
+	return &Snapper{state: SyncUp, args: args}, nil
+}
+
+// nextInvocation returns the time at which the snapshots after those of the invocation at last are due.
+func (a args) nextInvocation(last time.Time) time.Time {
+	if a.cron != nil {
+		return a.cron.Next(last.In(a.location))
+	}
+	return last.Add(a.interval)
+}
+
 func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
+	s.run(ctx, snapshotsTaken, nil)
+}
+
+// run is Run, but also stops once stop is closed and the snapper is not taking snapshots.
+func (s *Snapper) run(ctx context.Context, snapshotsTaken chan<- struct{}, stop <-chan struct{}) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 	getLogger(ctx).Debug("start")
 	defer getLogger(ctx).Debug("stop")
@@ -141,15 +268,9 @@ func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
 	s.args.snapshotsTaken = snapshotsTaken
 	s.args.ctx = ctx
 	s.args.dryRun = false // for future expansion
+	s.args.stop = stop
 
-	u := func(u func(*Snapper)) State {
-		s.mtx.Lock()
-		defer s.mtx.Unlock()
-		if u != nil {
-			u(s)
-		}
-		return s.state
-	}
+	u := s.updater()
 
 	var st state = syncUp
 
@@ -165,6 +286,53 @@ func (s *Snapper) Run(ctx context.Context, snapshotsTaken chan<- struct{}) {
 
 }
 
+// Once takes snapshots of all filesystems right away, regardless of the interval,
+// and returns an error if any snapshot could not be created.
+func (s *Snapper) Once(ctx context.Context) error {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	s.args.ctx = ctx
+	s.args.dryRun = false // for future expansion
+
+	u := s.updater()
+	u(func(s *Snapper) {
+		s.state = Planning
+	})
+	plan(s.args, u)
+	if u(nil) == Snapshotting {
+		snapshot(s.args, u)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// SnapshotNow requests that s takes snapshots of the filesystems that selection matches
+// (all filesystems if nil) right away, including the hooks. It does not wait for the snapshots.
+// If s is taking snapshots, the request is served afterwards.
+// After snapshots of all filesystems, the next ones are due an interval later (or at the next time of the cron schedule),
+// otherwise the schedule is not affected.
+func (s *Snapper) SnapshotNow(selection func(fs string) bool) error {
+	select {
+	case s.args.snapshotNow <- snapshotNowRequest{selection}:
+		return nil
+	default:
+		return errors.New("a snapshot request is already pending")
+	}
+}
+
+func (s *Snapper) updater() updater {
+	return func(u func(*Snapper)) State {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		if u != nil {
+			u(s)
+		}
+		return s.state
+	}
+}
+
 func onErr(err error, u updater) state {
 	return u(func(s *Snapper) {
 		s.err = err
@@ -181,6 +349,17 @@ func onErr(err error, u updater) state {
 	}).sf()
 }
 
+func onSnapshotNow(a args, u updater, req snapshotNowRequest) state {
+	return u(func(s *Snapper) {
+		getLogger(a.ctx).WithField("pre_state", s.state).WithField("all_filesystems", req.selection == nil).Info("snapshot requested")
+		if req.selection != nil {
+			s.resumeAt = s.sleepUntil
+		}
+		s.snapshotNowReq = &req
+		s.state = Planning
+	}).sf()
+}
+
 func onMainCtxDone(ctx context.Context, u updater) state {
 	return u(func(s *Snapper) {
 		s.err = ctx.Err()
@@ -188,17 +367,35 @@ func onMainCtxDone(ctx context.Context, u updater) state {
 	}).sf()
 }
 
+func onStop(u updater) state {
+	return u(func(s *Snapper) {
+		s.state = Stopped
+	}).sf()
+}
+
 func syncUp(a args, u updater) state {
+	now := time.Now()
 	u(func(snapper *Snapper) {
-		snapper.lastInvocation = time.Now()
+		snapper.lastInvocation = now
 	})
-	fss, err := listFSes(a.ctx, a.fsf)
-	if err != nil {
-		return onErr(err, u)
+	if a.manual {
+		return u(func(s *Snapper) {
+			s.state = Waiting
+		}).sf()
 	}
-	syncPoint, err := findSyncPoint(a.ctx, fss, a.prefix, a.interval)
-	if err != nil {
-		return onErr(err, u)
+	var syncPoint time.Time
+	if a.cron != nil {
+		// the schedule is aligned to the wall clock, not to the existing snapshots
+		syncPoint = a.nextInvocation(now)
+	} else {
+		fss, err := listFSes(a.ctx, a.fsf)
+		if err != nil {
+			return onErr(err, u)
+		}
+		syncPoint, err = findSyncPoint(a.ctx, fss, a.naming, a.interval)
+		if err != nil {
+			return onErr(err, u)
+		}
 	}
 	u(func(s *Snapper) {
 		s.sleepUntil = syncPoint
@@ -210,19 +407,37 @@ func syncUp(a args, u updater) state {
 		return u(func(s *Snapper) {
 			s.state = Planning
 		}).sf()
+	case req := <-a.snapshotNow:
+		return onSnapshotNow(a, u, req)
 	case <-a.ctx.Done():
 		return onMainCtxDone(a.ctx, u)
+	case <-a.stop:
+		return onStop(u)
 	}
 }
 
 func plan(a args, u updater) state {
+	var req *snapshotNowRequest
 	u(func(snapper *Snapper) {
 		snapper.lastInvocation = time.Now()
+		req, snapper.snapshotNowReq = snapper.snapshotNowReq, nil
 	})
 	fss, err := listFSes(a.ctx, a.fsf)
 	if err != nil {
 		return onErr(err, u)
 	}
+	if req != nil && req.selection != nil {
+		selected := fss[:0]
+		for _, fs := range fss {
+			if req.selection(fs.ToString()) {
+				selected = append(selected, fs)
+			}
+		}
+		fss = selected
+		if len(fss) == 0 {
+			getLogger(a.ctx).Warn("requested snapshots do not match any filesystem")
+		}
+	}
 
 	plan := make(map[*zfs.DatasetPath]*snapProgress, len(fss))
 	for _, fs := range fss {
@@ -231,6 +446,7 @@ func plan(a args, u updater) state {
 	return u(func(s *Snapper) {
 		s.state = Snapshotting
 		s.plan = plan
+		s.planSelected = req != nil && req.selection != nil
 		s.err = nil
 	}).sf()
 }
@@ -238,8 +454,9 @@ func plan(a args, u updater) state {
 func snapshot(a args, u updater) state {
 
 	var plan map[*zfs.DatasetPath]*snapProgress
+	var planSelected bool
 	u(func(snapper *Snapper) {
-		plan = snapper.plan
+		plan, planSelected = snapper.plan, snapper.planSelected
 	})
 
 	hookMatchCount := make(map[hooks.Hook]int, len(*a.hooks))
@@ -247,13 +464,63 @@ func snapshot(a args, u updater) state {
 		hookMatchCount[h] = 0
 	}
 
+	var unchanged map[string]bool
+	if a.skipUnchanged {
+		fss := make([]*zfs.DatasetPath, 0, len(plan))
+		for fs := range plan {
+			fss = append(fss, fs)
+		}
+		var err error
+		unchanged, err = unchangedSinceLastSnapshot(a.ctx, fss, a.naming)
+		if err != nil {
+			getLogger(a.ctx).WithError(err).Warn("cannot determine whether filesystems changed since last snapshot, creating snapshots")
+		}
+	}
+
+	// in order, with the zvols of a VM that a qemu-guest-agent hook freezes once for all of them one after another
+	fss := make([]*zfs.DatasetPath, 0, len(plan))
+	var runFSS []*zfs.DatasetPath
+	for fs := range plan {
+		fss = append(fss, fs)
+		if !unchanged[fs.ToString()] {
+			runFSS = append(runFSS, fs)
+		}
+	}
+	sort.Slice(fss, func(i, j int) bool { return fss[i].ToString() < fss[j].ToString() })
+	fss = a.hooks.SnapshotRunOrder(fss)
+	run := a.hooks.BeginSnapshotRun(runFSS)
+
 	anyFsHadErr := false
+	var details hooks.SnapshottingEventDetails
 	// TODO channel programs -> allow a little jitter?
-	for fs, progress := range plan {
-		suffix := time.Now().In(time.UTC).Format("20060102_150405_000")
-		snapname := fmt.Sprintf("%s%s", a.prefix, suffix)
-
+	for _, fs := range fss {
+		progress := plan[fs]
 		ctx := logging.WithInjectedField(a.ctx, "fs", fs.ToString())
+
+		snapname, err := a.naming.name(time.Now())
+		if err != nil {
+			getLogger(ctx).WithError(err).Error("cannot create snapshot name")
+			u(func(snapper *Snapper) {
+				progress.state = SnapError
+				progress.doneAt = time.Now()
+			})
+			anyFsHadErr = true
+			if !unchanged[fs.ToString()] {
+				run.EndFilesystem(ctx, fs)
+			}
+			continue
+		}
+
+		if unchanged[fs.ToString()] {
+			getLogger(ctx).Debug("skip snapshot, filesystem has not changed since last snapshot")
+			u(func(snapper *Snapper) {
+				progress.state = SnapSkipped
+				progress.doneAt = time.Now()
+			})
+			details.SkippedFilesystems++
+			continue
+		}
+
 		ctx = logging.WithInjectedField(ctx, "snap", snapname)
 
 		hookEnvExtra := hooks.Env{
@@ -264,7 +531,11 @@ func snapshot(a args, u updater) state {
 		jobCallback := hooks.NewCallbackHookForFilesystem("snapshot", fs, func(ctx context.Context) (err error) {
 			l := getLogger(ctx)
 			l.Debug("create snapshot")
-			err = zfs.ZFSSnapshot(ctx, fs, snapname, false) // TODO propagate context to ZFSSnapshot
+			if len(a.stepHolds.JobIDs) > 0 && stepHoldNewSnapshots {
+				err = endpoint.SnapshotAndHoldStep(ctx, fs, snapname, a.stepHolds)
+			} else {
+				err = zfs.ZFSSnapshot(ctx, fs, snapname, false) // TODO propagate context to ZFSSnapshot
+			}
 			if err != nil {
 				l.WithError(err).Error("cannot create snapshot")
 			}
@@ -301,8 +572,19 @@ func snapshot(a args, u updater) state {
 			progress.state = SnapStarted
 		})
 		{
+			// Lock before the pre-snapshot hooks run, not just around the snapshot: otherwise,
+			// a concurrent receive or destroy that holds the lock keeps the filesystem (or guest)
+			// frozen by a fsfreeze or qemu-guest-agent hook until its watchdog thaws it,
+			// and the snapshot is taken unfrozen.
+			fsGuard, err := endpoint.LockFilesystems(ctx, endpoint.OpSnapshot, fs)
+			if err != nil {
+				getLogger(ctx).WithError(err).Error("cannot lock filesystem for snapshot")
+				fsHadErr = true
+				goto updateFSState
+			}
 			getLogger(ctx).WithField("report", plan.Report().String()).Debug("begin run job plan")
 			plan.Run(ctx, a.dryRun)
+			fsGuard.Release()
 			planReport = plan.Report()
 			fsHadErr = planReport.HadError() // not just fatal errors
 			if fsHadErr {
@@ -313,7 +595,13 @@ func snapshot(a args, u updater) state {
 		}
 
 	updateFSState:
+		run.EndFilesystem(ctx, fs)
 		anyFsHadErr = anyFsHadErr || fsHadErr
+		if fsHadErr {
+			details.FailedFilesystems++
+		} else {
+			details.Snapshots++
+		}
 		u(func(snapper *Snapper) {
 			progress.doneAt = time.Now()
 			progress.state = SnapDone
@@ -324,6 +612,8 @@ func snapshot(a args, u updater) state {
 		})
 	}
 
+	run.End(a.ctx)
+
 	select {
 	case a.snapshotsTaken <- struct{}{}:
 	default:
@@ -333,7 +623,8 @@ func snapshot(a args, u updater) state {
 	}
 
 	for h, mc := range hookMatchCount {
-		if mc == 0 {
+		// with rules, a hook usually only matches the filesystems of some of them
+		if mc == 0 && (a.rule == "" || a.class != "") && !planSelected {
 			hookIdx := -1
 			for idx, ah := range *a.hooks {
 				if ah == h {
@@ -345,10 +636,16 @@ func snapshot(a args, u updater) state {
 		}
 	}
 
+	var err error
+	if anyFsHadErr {
+		err = errors.New("one or more snapshots could not be created, check logs for details")
+	}
+	hooks.NotifyEvent(a.ctx, hooks.EventSnapshottingCompleted, err, &details)
+
 	return u(func(snapper *Snapper) {
 		if anyFsHadErr {
 			snapper.state = ErrorWait
-			snapper.err = errors.New("one or more snapshots could not be created, check logs for details")
+			snapper.err = err
 		} else {
 			snapper.state = Waiting
 			snapper.err = nil
@@ -356,13 +653,97 @@ func snapshot(a args, u updater) state {
 	}).sf()
 }
 
+var skipUnchangedBatchSize = envconst.Int("ZREPL_SNAPPER_SKIP_UNCHANGED_BATCH_SIZE", 256)
+
+// replaced by tests
+var (
+	zfsList             = zfs.ZFSList
+	zfsListWrittenSince = zfs.ZFSListWrittenSince
+	zfsListMapping      = zfs.ZFSListMapping
+)
+
+// unchangedSinceLastSnapshot returns the names of the filesystems of fss whose most recent snapshot that matches naming
+// has a zero written@ property, i.e., that have not changed since that snapshot.
+// The filesystems are examined in batches of skipUnchangedBatchSize: a zfs command lists their snapshots,
+// and another one per distinct name of their most recent snapshots lists the written@ properties.
+// If an error is returned, the result still holds the filesystems of the batches before the failed one.
+func unchangedSinceLastSnapshot(ctx context.Context, fss []*zfs.DatasetPath, naming *naming) (map[string]bool, error) {
+	unchanged := make(map[string]bool, len(fss))
+	batchSize := skipUnchangedBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	for len(fss) > 0 {
+		batch := fss
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		fss = fss[len(batch):]
+
+		byName := make(map[string]*zfs.DatasetPath, len(batch))
+		args := []string{"-t", "snapshot", "-d", "1"}
+		for _, fs := range batch {
+			byName[fs.ToString()] = fs
+			args = append(args, fs.ToString())
+		}
+		snaps, err := zfsList(ctx, []string{"name", "createtxg"}, args...)
+		if err != nil {
+			return unchanged, errors.Wrap(err, "list snapshots")
+		}
+
+		type latestSnap struct {
+			name      string
+			createTXG uint64
+		}
+		latest := make(map[string]latestSnap, len(batch))
+		for _, l := range snaps {
+			comps := strings.SplitN(l[0], "@", 2)
+			if len(comps) != 2 || byName[comps[0]] == nil || !naming.matches(comps[1]) {
+				continue
+			}
+			txg, err := strconv.ParseUint(l[1], 10, 64)
+			if err != nil {
+				return unchanged, errors.Wrapf(err, "%s: cannot parse createtxg", l[0])
+			}
+			if cur, ok := latest[comps[0]]; !ok || txg > cur.createTXG {
+				latest[comps[0]] = latestSnap{comps[1], txg}
+			}
+		}
+
+		// snapshots are usually taken for all filesystems at once, so most filesystems share the name
+		bySnap := make(map[string][]*zfs.DatasetPath)
+		for fs, l := range latest {
+			bySnap[l.name] = append(bySnap[l.name], byName[fs])
+		}
+		for snap, snapFSS := range bySnap {
+			written, err := zfsListWrittenSince(ctx, snapFSS, snap)
+			if err != nil {
+				return unchanged, errors.Wrapf(err, "get written@%s", snap)
+			}
+			for fs, w := range written {
+				if w == 0 {
+					unchanged[fs] = true
+				}
+			}
+		}
+	}
+	return unchanged, nil
+}
+
 func wait(a args, u updater) state {
 	var sleepUntil time.Time
 	u(func(snapper *Snapper) {
 		lastTick := snapper.lastInvocation
-		snapper.sleepUntil = lastTick.Add(a.interval)
+		if a.manual {
+			snapper.sleepUntil, snapper.resumeAt = time.Time{}, time.Time{}
+		} else {
+			snapper.sleepUntil = a.nextInvocation(lastTick)
+			if !snapper.resumeAt.IsZero() {
+				snapper.sleepUntil, snapper.resumeAt = snapper.resumeAt, time.Time{}
+			}
+		}
 		sleepUntil = snapper.sleepUntil
-		log := getLogger(a.ctx).WithField("sleep_until", sleepUntil).WithField("duration", a.interval)
+		log := getLogger(a.ctx).WithField("sleep_until", sleepUntil).WithField("duration", sleepUntil.Sub(lastTick))
 		logFunc := log.Debug
 		if snapper.state == ErrorWait || snapper.state == SyncUpErrWait {
 			logFunc = log.Error
@@ -370,27 +751,35 @@ func wait(a args, u updater) state {
 		logFunc("enter wait-state after error")
 	})
 
-	t := time.NewTimer(time.Until(sleepUntil))
-	defer t.Stop()
+	var timeout <-chan time.Time // manual snapshotting waits for requests only
+	if !a.manual {
+		t := time.NewTimer(time.Until(sleepUntil))
+		defer t.Stop()
+		timeout = t.C
+	}
 
 	select {
-	case <-t.C:
+	case <-timeout:
 		return u(func(snapper *Snapper) {
 			snapper.state = Planning
 		}).sf()
+	case req := <-a.snapshotNow:
+		return onSnapshotNow(a, u, req)
 	case <-a.ctx.Done():
 		return onMainCtxDone(a.ctx, u)
+	case <-a.stop:
+		return onStop(u)
 	}
 }
 
 func listFSes(ctx context.Context, mf zfs.DatasetFilter) (fss []*zfs.DatasetPath, err error) {
-	return zfs.ZFSListMapping(ctx, mf)
+	return zfsListMapping(ctx, mf)
 }
 
 var syncUpWarnNoSnapshotUntilSyncupMinDuration = envconst.Duration("ZREPL_SNAPPER_SYNCUP_WARN_MIN_DURATION", 1*time.Second)
 
 // see docs/snapshotting.rst
-func findSyncPoint(ctx context.Context, fss []*zfs.DatasetPath, prefix string, interval time.Duration) (syncPoint time.Time, err error) {
+func findSyncPoint(ctx context.Context, fss []*zfs.DatasetPath, naming *naming, interval time.Duration) (syncPoint time.Time, err error) {
 
 	const (
 		prioHasVersions int = iota
@@ -415,7 +804,7 @@ func findSyncPoint(ctx context.Context, fss []*zfs.DatasetPath, prefix string, i
 	getLogger(ctx).Debug("examine filesystem state to find sync point")
 	for _, d := range fss {
 		ctx := logging.WithInjectedField(ctx, "fs", d.ToString())
-		syncPoint, err := findSyncPointFSNextOptimalSnapshotTime(ctx, now, interval, prefix, d)
+		syncPoint, err := findSyncPointFSNextOptimalSnapshotTime(ctx, now, interval, naming, d)
 		if err == findSyncPointFSNoFilesystemVersionsErr {
 			snaptimes = append(snaptimes, snapTime{
 				ds:   d,
@@ -469,15 +858,13 @@ func findSyncPoint(ctx context.Context, fss []*zfs.DatasetPath, prefix string, i
 
 var findSyncPointFSNoFilesystemVersionsErr = fmt.Errorf("no filesystem versions")
 
-func findSyncPointFSNextOptimalSnapshotTime(ctx context.Context, now time.Time, interval time.Duration, prefix string, d *zfs.DatasetPath) (time.Time, error) {
+func findSyncPointFSNextOptimalSnapshotTime(ctx context.Context, now time.Time, interval time.Duration, naming *naming, d *zfs.DatasetPath) (time.Time, error) {
 
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, d, zfs.ListFilesystemVersionsOptions{
-		Types:           zfs.Snapshots,
-		ShortnamePrefix: prefix,
-	})
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, d, naming.listOptions())
 	if err != nil {
 		return time.Time{}, errors.Wrap(err, "list filesystem versions")
 	}
+	fsvs = naming.filter(fsvs)
 	if len(fsvs) <= 0 {
 		return time.Time{}, findSyncPointFSNoFilesystemVersionsErr
 	}
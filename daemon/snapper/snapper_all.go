@@ -3,8 +3,13 @@ package snapper
 import (
 	"context"
 	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -13,35 +18,231 @@ import (
 //     - timer-based trigger (periodic)
 //     - call from control socket (manual)
 //     - mixed modes?
-//   - support a `zrepl snapshot JOBNAME` subcommand for config.SnapshottingManual
 type PeriodicOrManual struct {
-	s *Snapper
+	mtx sync.Mutex
+	// the snapper of the filesystems that match no rule followed by those of the rules,
+	// or the snappers of the classes.
+	// If manual, the snapper that takes snapshots on request, or empty if the snapshotting does not name snapshots.
+	s       []*Snapper
+	manual  bool
+	replace chan *PeriodicOrManual // buffered, see Replace
+}
+
+func newPeriodicOrManual(s ...*Snapper) *PeriodicOrManual {
+	return &PeriodicOrManual{s: s, replace: make(chan *PeriodicOrManual, 1)}
+}
+
+func newManual(s *Snapper) *PeriodicOrManual {
+	m := newPeriodicOrManual()
+	if s != nil {
+		m.s = []*Snapper{s}
+	}
+	m.manual = true
+	return m
 }
 
 func (s *PeriodicOrManual) Run(ctx context.Context, wakeUpCommon chan<- struct{}) {
-	if s.s != nil {
-		s.s.Run(ctx, wakeUpCommon)
+	for {
+		s.mtx.Lock()
+		cur := s.s
+		s.mtx.Unlock()
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if len(cur) == 0 {
+				select {
+				case <-ctx.Done():
+				case <-stop:
+				}
+				return
+			}
+			var wg sync.WaitGroup
+			for _, s := range cur {
+				wg.Add(1)
+				go func(s *Snapper) {
+					defer wg.Done()
+					ctx, endTask := trace.WithTask(ctx, "snapper")
+					defer endTask()
+					s.run(ctx, wakeUpCommon, stop)
+				}(s)
+			}
+			wg.Wait()
+		}()
+
+		select {
+		case <-ctx.Done():
+			<-done
+			return
+		case next := <-s.replace:
+			// snapshots that are being taken are completed
+			close(stop)
+			<-done
+			s.mtx.Lock()
+			s.s, s.manual = next.s, next.manual
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// Replace makes s continue with the snapshotting configuration of other, e.g., after a config reload.
+// If s is taking snapshots, it finishes taking them before switching.
+// other must not be used afterwards.
+func (s *PeriodicOrManual) Replace(other *PeriodicOrManual) {
+	for {
+		select {
+		case s.replace <- other:
+			return
+		default:
+		}
+		// Run did not pick up the previous replacement yet, it picks up this one instead
+		select {
+		case <-s.replace:
+		default:
+		}
+	}
+}
+
+// Once takes snapshots once, see Snapper.Once. It does nothing if manual.
+// It must not be used concurrently with Run.
+func (s *PeriodicOrManual) Once(ctx context.Context) error {
+	s.mtx.Lock()
+	cur, manual := s.s, s.manual
+	s.mtx.Unlock()
+	if manual {
+		return nil
+	}
+	var firstErr error
+	for _, snapper := range cur {
+		if err := snapper.Once(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SnapshotNow makes all snappers of s take snapshots right away, see Snapper.SnapshotNow.
+// Returns an error if manual and the snapshotting does not name snapshots,
+// or if selection is not nil and matches none of the filesystems that s snapshots.
+func (s *PeriodicOrManual) SnapshotNow(ctx context.Context, selection func(fs string) bool) error {
+	s.mtx.Lock()
+	cur := s.s
+	s.mtx.Unlock()
+	if len(cur) == 0 {
+		return errors.New("snapshotting is manual and has neither field `prefix` nor `name_template`")
+	}
+	if selection != nil {
+		matches, err := selectionMatchesAny(ctx, cur, selection)
+		if err != nil {
+			return errors.Wrap(err, "cannot list filesystems")
+		}
+		if !matches {
+			return errors.New("the filesystem selection matches none of the filesystems of the job")
+		}
+	}
+	var firstErr error
+	for _, snapper := range cur {
+		if err := snapper.SnapshotNow(selection); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// selectionMatchesAny reports whether selection matches a filesystem of one of the snappers.
+// The snappers check the selection again when they plan, filesystems may be created or destroyed in between.
+func selectionMatchesAny(ctx context.Context, snappers []*Snapper, selection func(fs string) bool) (bool, error) {
+	for _, snapper := range snappers {
+		fss, err := listFSes(ctx, snapper.args.fsf)
+		if err != nil {
+			return false, err
+		}
+		for _, fs := range fss {
+			if selection(fs.ToString()) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// NameRegexes returns regular expressions for the names of the snapshots that s creates,
+// e.g., for the `regex` of the keep rules of the pruning. Returns nil if manual without naming.
+func (s *PeriodicOrManual) NameRegexes() []string {
+	s.mtx.Lock()
+	cur := s.s
+	s.mtx.Unlock()
+	var res []string
+	seen := make(map[string]bool, len(cur))
+	for _, snapper := range cur {
+		re := snapper.args.naming.Regex()
+		if !seen[re] {
+			seen[re] = true
+			res = append(res, re)
+		}
 	}
+	return res
 }
 
-// Returns nil if manual
+// ClassNameRegexes maps the names of the snapshot classes of s to regular expressions
+// for the names of their snapshots, for the keep rules of the pruning that refer to a class.
+// Returns nil if s has no classes.
+func (s *PeriodicOrManual) ClassNameRegexes() map[string]string {
+	s.mtx.Lock()
+	cur := s.s
+	s.mtx.Unlock()
+	var res map[string]string
+	for _, snapper := range cur {
+		if snapper.args.class == "" {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string, len(cur))
+		}
+		res[snapper.args.class] = snapper.args.naming.Regex()
+	}
+	return res
+}
+
+// Returns nil if manual without naming
 func (s *PeriodicOrManual) Report() *Report {
-	if s.s != nil {
-		return s.s.Report()
+	s.mtx.Lock()
+	cur := s.s
+	s.mtx.Unlock()
+	if len(cur) == 0 {
+		return nil
+	}
+	r := cur[0].Report()
+	for _, rule := range cur[1:] {
+		r.Rules = append(r.Rules, rule.Report())
 	}
-	return nil
+	return r
 }
 
-func FromConfig(g *config.Global, fsf zfs.DatasetFilter, in config.SnapshottingEnum) (*PeriodicOrManual, error) {
+// jobID is the job that the snapshots are named for (see NameTemplateData).
+// The snapshots are step-held for the jobs of stepHolds as soon as they are created,
+// i.e., for the jobs that replicate them (which are not jobID for push jobs with `targets`).
+func FromConfig(g *config.Global, fsf zfs.DatasetFilter, in config.SnapshottingEnum, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) (*PeriodicOrManual, error) {
 	switch v := in.Ret.(type) {
 	case *config.SnapshottingPeriodic:
-		snapper, err := PeriodicFromConfig(g, fsf, v)
+		snappers, err := periodicWithRulesFromConfig(g, fsf, v, jobID, stepHolds)
 		if err != nil {
 			return nil, err
 		}
-		return &PeriodicOrManual{snapper}, nil
+		return newPeriodicOrManual(snappers...), nil
+	case *config.SnapshottingCron:
+		snapper, err := CronFromConfig(g, fsf, v, jobID, stepHolds)
+		if err != nil {
+			return nil, err
+		}
+		return newPeriodicOrManual(snapper), nil
 	case *config.SnapshottingManual:
-		return &PeriodicOrManual{}, nil
+		snapper, err := ManualFromConfig(g, fsf, v, jobID, stepHolds)
+		if err != nil {
+			return nil, err
+		}
+		return newManual(snapper), nil
 	default:
 		return nil, fmt.Errorf("unknown snapshotting type %T", v)
 	}
@@ -0,0 +1,59 @@
+package snapper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// periodicWithClassesFromConfig returns a snapper per class of in.Classes, see PeriodicOrManual.
+// Each snapper snapshots all filesystems of fsf, with the prefix and interval of its class.
+func periodicWithClassesFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) ([]*Snapper, error) {
+	if len(in.Rules) != 0 {
+		return nil, errors.New("`rules` and `classes` are mutually exclusive")
+	}
+	if in.Prefix != "" || in.Interval != 0 {
+		return nil, errors.New("`prefix` and `interval` must be set per class if `classes` is set")
+	}
+
+	snappers := make([]*Snapper, 0, len(in.Classes))
+	for i, c := range in.Classes {
+		if c.Name == "" {
+			return nil, fmt.Errorf("class #%d: name must not be empty", i+1)
+		}
+		classIn := *in
+		classIn.Prefix, classIn.Interval = c.Prefix, c.Interval
+		s, err := PeriodicFromConfig(g, fsf, &classIn, jobID, stepHolds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "class %q", c.Name)
+		}
+		s.args.class = c.Name
+		s.args.rule = fmt.Sprintf("class %q (every %s, prefix %q)", c.Name, c.Interval, c.Prefix)
+
+		// the pruning of a class must not consider the snapshots of another class
+		for _, o := range snappers {
+			if o.args.class == c.Name {
+				return nil, fmt.Errorf("duplicate class %q", c.Name)
+			}
+			if s.args.naming.overlaps(o.args.naming) {
+				return nil, fmt.Errorf("the snapshot names of class %q and class %q overlap, use distinct prefixes that are not prefixes of each other", o.args.class, c.Name)
+			}
+		}
+		snappers = append(snappers, s)
+	}
+	return snappers, nil
+}
+
+// overlaps returns true if n and o may create names that the other one matches.
+func (n *naming) overlaps(o *naming) bool {
+	if n.re == nil && o.re == nil {
+		return strings.HasPrefix(n.prefix, o.prefix) || strings.HasPrefix(o.prefix, n.prefix)
+	}
+	// a name_template that does not contain {{.Prefix}} creates the same names for all classes
+	return n.Regex() == o.Regex()
+}
@@ -0,0 +1,248 @@
+package snapper
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// NameTemplateData is the data that a snapshot name template (config field `name_template`) is executed with.
+type NameTemplateData struct {
+	Time   time.Time // UTC, use .Time.Local for the local time of the daemon
+	JobID  string
+	Prefix string
+}
+
+// naming creates the names of the snapshots of a snapper and recognizes them among other snapshots.
+type naming struct {
+	prefix string
+	jobID  string
+	// nil means the default naming: prefix followed by the UTC time
+	tmpl *template.Template
+	// the names that tmpl creates, nil if tmpl is nil
+	re *regexp.Regexp
+	// the literal text that all names start with
+	literalPrefix string
+}
+
+const defaultNamingTimeFormat = "20060102_150405_000"
+
+func newNaming(prefix, nameTemplate, jobID string) (*naming, error) {
+	if nameTemplate == "" {
+		if prefix == "" {
+			return nil, errors.New("prefix must not be empty")
+		}
+		return &naming{prefix: prefix, jobID: jobID, literalPrefix: prefix}, nil
+	}
+
+	tmpl, err := template.New("name_template").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid name_template")
+	}
+	n := &naming{prefix: prefix, jobID: jobID, tmpl: tmpl}
+	expr, literalPrefix, err := n.parseTemplate(tmpl.Tree.Root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "name_template %q", nameTemplate)
+	}
+	n.re = regexp.MustCompile("^" + expr + "$")
+	n.literalPrefix = literalPrefix
+
+	// the names must be valid snapshot names, and the regex must recognize them
+	sample, err := n.name(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+	if err != nil {
+		return nil, errors.Wrapf(err, "name_template %q", nameTemplate)
+	}
+	if err := zfs.ComponentNamecheck(sample); err != nil {
+		return nil, errors.Wrapf(err, "name_template %q creates invalid snapshot name %q", nameTemplate, sample)
+	}
+	if !n.matches(sample) {
+		return nil, fmt.Errorf("implementation error: name_template %q: regex %q does not match %q", nameTemplate, n.re, sample)
+	}
+	return n, nil
+}
+
+// parseTemplate returns a regular expression for the output of the nodes of root,
+// and the literal text at the beginning of the output.
+// Only text and the actions {{.JobID}}, {{.Prefix}} and {{.Time.Format "layout"}}
+// (also .Time.Local.Format and .Time.UTC.Format) are supported, so that the output can be recognized.
+func (n *naming) parseTemplate(root *parse.ListNode) (expr, literalPrefix string, err error) {
+	var b strings.Builder
+	literal := true
+	hasTime := false
+	for _, node := range root.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			b.WriteString(regexp.QuoteMeta(string(node.Text)))
+			if literal {
+				literalPrefix += string(node.Text)
+			}
+			continue
+		case *parse.ActionNode:
+			if len(node.Pipe.Decl) != 0 || len(node.Pipe.Cmds) != 1 {
+				return "", "", fmt.Errorf("unsupported action %s", node)
+			}
+			args := node.Pipe.Cmds[0].Args
+			field, ok := args[0].(*parse.FieldNode)
+			if !ok {
+				return "", "", fmt.Errorf("unsupported action %s", node)
+			}
+			ident := strings.Join(field.Ident, ".")
+			switch {
+			case len(args) == 1 && ident == "JobID":
+				b.WriteString(regexp.QuoteMeta(n.jobID))
+				if literal {
+					literalPrefix += n.jobID
+				}
+				continue
+			case len(args) == 1 && ident == "Prefix":
+				b.WriteString(regexp.QuoteMeta(n.prefix))
+				if literal {
+					literalPrefix += n.prefix
+				}
+				continue
+			case len(args) == 2 && (ident == "Time.Format" || ident == "Time.Local.Format" || ident == "Time.UTC.Format"):
+				layout, ok := args[1].(*parse.StringNode)
+				if !ok {
+					return "", "", fmt.Errorf("unsupported action %s: layout must be a string", node)
+				}
+				b.WriteString(timeLayoutRegex(layout.Text))
+				hasTime = true
+			default:
+				return "", "", fmt.Errorf("unsupported action %s, supported are {{.JobID}}, {{.Prefix}} and {{.Time.Format \"layout\"}}", node)
+			}
+		default:
+			return "", "", fmt.Errorf("unsupported template element %s", node)
+		}
+		literal = false
+	}
+	if !hasTime {
+		return "", "", errors.New("must contain {{.Time.Format \"layout\"}} to create unique snapshot names")
+	}
+	return b.String(), literalPrefix, nil
+}
+
+// timeLayoutRegex returns a regular expression for the times that time.Format formats with layout.
+func timeLayoutRegex(layout string) string {
+	// the elements of layouts (see package time), longer elements before their prefixes
+	elems := []struct{ elem, re string }{
+		{"January", `[A-Za-z]+`},
+		{"Jan", `[A-Za-z]{3}`},
+		{"Monday", `[A-Za-z]+`},
+		{"Mon", `[A-Za-z]{3}`},
+		{"MST", `(?:[A-Z]{3,5}|[-+]\d{2,4})`},
+		{"2006", `\d{4}`},
+		{"002", `\d{3}`},
+		{"01", `\d{2}`},
+		{"02", `\d{2}`},
+		{"03", `\d{2}`},
+		{"04", `\d{2}`},
+		{"05", `\d{2}`},
+		{"06", `\d{2}`},
+		{"15", `\d{2}`},
+		{"__2", `[ \d]{2}\d`},
+		{"_2", `[ \d]\d`},
+		{"1", `\d{1,2}`},
+		{"2", `\d{1,2}`},
+		{"3", `\d{1,2}`},
+		{"4", `\d{1,2}`},
+		{"5", `\d{1,2}`},
+		{"PM", `(?:AM|PM)`},
+		{"pm", `(?:am|pm)`},
+		{"Z07:00:00", `(?:Z|[-+]\d{2}:\d{2}:\d{2})`},
+		{"Z070000", `(?:Z|[-+]\d{6})`},
+		{"Z07:00", `(?:Z|[-+]\d{2}:\d{2})`},
+		{"Z0700", `(?:Z|[-+]\d{4})`},
+		{"Z07", `(?:Z|[-+]\d{2})`},
+		{"-07:00:00", `[-+]\d{2}:\d{2}:\d{2}`},
+		{"-070000", `[-+]\d{6}`},
+		{"-07:00", `[-+]\d{2}:\d{2}`},
+		{"-0700", `[-+]\d{4}`},
+		{"-07", `[-+]\d{2}`},
+	}
+	var b strings.Builder
+outer:
+	for i := 0; i < len(layout); {
+		// fractional seconds: a period or comma followed by zeros (fixed width) or nines (trailing zeros removed)
+		if c := layout[i]; (c == '.' || c == ',') && i+1 < len(layout) && (layout[i+1] == '0' || layout[i+1] == '9') {
+			j := i + 1
+			for j < len(layout) && layout[j] == layout[i+1] {
+				j++
+			}
+			if j == len(layout) || layout[j] < '0' || layout[j] > '9' {
+				digits := j - i - 1
+				if layout[i+1] == '0' {
+					b.WriteString(fmt.Sprintf(`%s\d{%d}`, regexp.QuoteMeta(layout[i:i+1]), digits))
+				} else {
+					b.WriteString(fmt.Sprintf(`(?:%s\d{1,%d})?`, regexp.QuoteMeta(layout[i:i+1]), digits))
+				}
+				i = j
+				continue
+			}
+		}
+		for _, e := range elems {
+			if strings.HasPrefix(layout[i:], e.elem) {
+				b.WriteString(e.re)
+				i += len(e.elem)
+				continue outer
+			}
+		}
+		b.WriteString(regexp.QuoteMeta(layout[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+func (n *naming) name(t time.Time) (string, error) {
+	if n.tmpl == nil {
+		return n.prefix + t.In(time.UTC).Format(defaultNamingTimeFormat), nil
+	}
+	var b bytes.Buffer
+	data := NameTemplateData{Time: t.In(time.UTC), JobID: n.jobID, Prefix: n.prefix}
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// matches returns true if name may have been created by n.
+// For the default naming, this is the case for all names that start with the prefix.
+func (n *naming) matches(name string) bool {
+	if n.re == nil {
+		return strings.HasPrefix(name, n.prefix)
+	}
+	return n.re.MatchString(name)
+}
+
+// Regex returns a regular expression for the names that n creates, e.g., for the keep rules of the pruning.
+func (n *naming) Regex() string {
+	if n.re == nil {
+		return "^" + regexp.QuoteMeta(n.prefix)
+	}
+	return n.re.String()
+}
+
+func (n *naming) listOptions() zfs.ListFilesystemVersionsOptions {
+	return zfs.ListFilesystemVersionsOptions{
+		Types:           zfs.Snapshots,
+		ShortnamePrefix: n.literalPrefix,
+	}
+}
+
+// filter returns the versions whose name matches n.
+func (n *naming) filter(fsvs []zfs.FilesystemVersion) []zfs.FilesystemVersion {
+	res := fsvs[:0]
+	for _, v := range fsvs {
+		if n.matches(v.Name) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
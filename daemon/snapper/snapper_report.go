@@ -10,6 +10,8 @@ import (
 )
 
 type Report struct {
+	// the rule or class of the snapshotting whose filesystems are reported, empty if the snapshotting has neither
+	Rule  string
 	State State
 	// valid in state SyncUp and Waiting
 	SleepUntil time.Time
@@ -17,6 +19,9 @@ type Report struct {
 	Error string
 	// valid in state Snapshotting
 	Progress []*ReportFilesystem
+	// the reports of the other rules of the snapshotting, the top-level report is the one of
+	// the filesystems that match no rule (or the one of the first class, if the snapshotting has classes)
+	Rules []*Report
 }
 
 type ReportFilesystem struct {
@@ -26,13 +31,25 @@ type ReportFilesystem struct {
 	// Valid in SnapStarted and later
 	SnapName      string
 	StartAt       time.Time
-	Hooks         string
+	Hooks         string // rendered HookSteps
 	HooksHadError bool
+	HookSteps     []*ReportHookStep
 
 	// Valid in SnapDone | SnapError
 	DoneAt time.Time
 }
 
+// ReportHookStep is a serializable hooks.Step.
+type ReportHookStep struct {
+	Edge   string
+	Hook   string
+	Status string
+	// zero until the step completed
+	Begin, End time.Time
+	Report     string
+	HadError   bool
+}
+
 func errOrEmptyString(e error) string {
 	if e != nil {
 		return e.Error()
@@ -48,49 +65,26 @@ func (s *Snapper) Report() *Report {
 	for fs, p := range s.plan {
 		var hooksStr string
 		var hooksHadError bool
+		var hookSteps []*ReportHookStep
 		if p.hookPlan != nil {
 			hr := p.hookPlan.Report()
-			// FIXME: technically this belongs into client
-			// but we can't serialize hooks.Step ATM
-			rightPad := func(str string, length int, pad string) string {
-				if len(str) > length {
-					return str[:length]
-				}
-				return str + strings.Repeat(pad, length-len(str))
-			}
 			hooksHadError = hr.HadError()
-			rows := make([][]string, len(hr))
-			const numCols = 4
-			lens := make([]int, numCols)
+			hookSteps = make([]*ReportHookStep, len(hr))
 			for i, e := range hr {
-				rows[i] = make([]string, numCols)
-				rows[i][0] = fmt.Sprintf("%d", i+1)
-				rows[i][1] = e.Status.String()
-				runTime := "..."
+				hookSteps[i] = &ReportHookStep{
+					Edge:     e.Edge.String(),
+					Hook:     e.Hook.String(),
+					Status:   e.Status.String(),
+					HadError: e.Status == hooks.StepErr,
+				}
 				if e.Status != hooks.StepPending {
-					runTime = e.End.Sub(e.Begin).Round(time.Millisecond).String()
+					hookSteps[i].Begin, hookSteps[i].End = e.Begin, e.End
 				}
-				rows[i][2] = runTime
-				rows[i][3] = ""
 				if e.Report != nil {
-					rows[i][3] = e.Report.String()
+					hookSteps[i].Report = e.Report.String()
 				}
-				for j, col := range lens {
-					if len(rows[i][j]) > col {
-						lens[j] = len(rows[i][j])
-					}
-				}
-			}
-			rowsFlat := make([]string, len(hr))
-			for i, r := range rows {
-				colsPadded := make([]string, len(r))
-				for j, c := range r[:len(r)-1] {
-					colsPadded[j] = rightPad(c, lens[j], " ")
-				}
-				colsPadded[len(r)-1] = r[len(r)-1]
-				rowsFlat[i] = strings.Join(colsPadded, " ")
 			}
-			hooksStr = strings.Join(rowsFlat, "\n")
+			hooksStr = renderHookSteps(hookSteps)
 		}
 		pReps = append(pReps, &ReportFilesystem{
 			Path:          fs.ToString(),
@@ -100,6 +94,7 @@ func (s *Snapper) Report() *Report {
 			DoneAt:        p.doneAt,
 			Hooks:         hooksStr,
 			HooksHadError: hooksHadError,
+			HookSteps:     hookSteps,
 		})
 	}
 
@@ -108,6 +103,7 @@ func (s *Snapper) Report() *Report {
 	})
 
 	r := &Report{
+		Rule:       s.args.rule,
 		State:      s.state,
 		SleepUntil: s.sleepUntil,
 		Error:      errOrEmptyString(s.err),
@@ -116,3 +112,38 @@ func (s *Snapper) Report() *Report {
 
 	return r
 }
+
+// FIXME: technically this belongs into client
+func renderHookSteps(steps []*ReportHookStep) string {
+	rightPad := func(str string, length int, pad string) string {
+		if len(str) > length {
+			return str[:length]
+		}
+		return str + strings.Repeat(pad, length-len(str))
+	}
+	rows := make([][]string, len(steps))
+	const numCols = 6
+	lens := make([]int, numCols)
+	for i, e := range steps {
+		runTime := "..."
+		if !e.Begin.IsZero() {
+			runTime = e.End.Sub(e.Begin).Round(time.Millisecond).String()
+		}
+		rows[i] = []string{fmt.Sprintf("%d", i+1), e.Status, runTime, e.Edge, e.Hook, e.Report}
+		for j, col := range lens {
+			if len(rows[i][j]) > col {
+				lens[j] = len(rows[i][j])
+			}
+		}
+	}
+	rowsFlat := make([]string, len(steps))
+	for i, r := range rows {
+		colsPadded := make([]string, len(r))
+		for j, c := range r[:len(r)-1] {
+			colsPadded[j] = rightPad(c, lens[j], " ")
+		}
+		colsPadded[len(r)-1] = r[len(r)-1]
+		rowsFlat[i] = strings.Join(colsPadded, " ")
+	}
+	return strings.Join(rowsFlat, "\n")
+}
@@ -0,0 +1,82 @@
+package snapper
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ruleFilter passes the filesystems of fsf whose first matching rule is rules[idx],
+// or that match no rule if idx is len(rules).
+// The ruleFilters of all idx thus partition the filesystems of fsf.
+type ruleFilter struct {
+	fsf   zfs.DatasetFilter
+	rules []*regexp.Regexp
+	idx   int
+}
+
+var _ zfs.DatasetFilter = (*ruleFilter)(nil)
+
+func (f *ruleFilter) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	if pass, err := f.fsf.Filter(p); err != nil || !pass {
+		return pass, err
+	}
+	for i, re := range f.rules {
+		if re.MatchString(p.ToString()) {
+			return i == f.idx, nil
+		}
+	}
+	return f.idx == len(f.rules), nil
+}
+
+// periodicWithRulesFromConfig returns the snapper of the filesystems that match no rule of in.Rules,
+// followed by a snapper per rule, see PeriodicOrManual.
+func periodicWithRulesFromConfig(g *config.Global, fsf zfs.DatasetFilter, in *config.SnapshottingPeriodic, jobID endpoint.JobID, stepHolds endpoint.NewSnapshotStepHolds) ([]*Snapper, error) {
+	if len(in.Classes) != 0 {
+		return periodicWithClassesFromConfig(g, fsf, in, jobID, stepHolds)
+	}
+	if len(in.Rules) == 0 {
+		s, err := PeriodicFromConfig(g, fsf, in, jobID, stepHolds)
+		if err != nil {
+			return nil, err
+		}
+		return []*Snapper{s}, nil
+	}
+
+	rules := make([]*regexp.Regexp, len(in.Rules))
+	for i, r := range in.Rules {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule #%d: invalid regex %q", i+1, r.Regex)
+		}
+		rules[i] = re
+	}
+
+	snappers := make([]*Snapper, 0, len(in.Rules)+1)
+	def, err := PeriodicFromConfig(g, &ruleFilter{fsf, rules, len(rules)}, in, jobID, stepHolds)
+	if err != nil {
+		return nil, err
+	}
+	def.args.rule = fmt.Sprintf("no rule matches (every %s, prefix %q)", in.Interval, in.Prefix)
+	snappers = append(snappers, def)
+
+	for i, r := range in.Rules {
+		ruleIn := *in
+		ruleIn.Interval = r.Interval
+		if r.Prefix != "" {
+			ruleIn.Prefix = r.Prefix
+		}
+		s, err := PeriodicFromConfig(g, &ruleFilter{fsf, rules, i}, &ruleIn, jobID, stepHolds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule #%d", i+1)
+		}
+		s.args.rule = fmt.Sprintf("regex %q (every %s, prefix %q)", r.Regex, ruleIn.Interval, ruleIn.Prefix)
+		snappers = append(snappers, s)
+	}
+	return snappers, nil
+}
@@ -0,0 +1,95 @@
+package snapper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestUnchangedSinceLastSnapshot(t *testing.T) {
+	// filesystem => snapshot name => createtxg
+	snapshots := map[string]map[string]uint64{
+		"pool/a": {"zrepl_1": 10, "zrepl_2": 20, "manual": 30},
+		"pool/b": {"zrepl_2": 20},
+		"pool/c": {"zrepl_1": 10},
+		"pool/d": {"manual": 5},
+		"pool/e": {"zrepl_2": 20},
+	}
+	// filesystem => written@ of its most recent zrepl_ snapshot
+	written := map[string]uint64{"pool/a": 0, "pool/b": 4096, "pool/c": 0, "pool/e": 0}
+
+	var listCalls [][]string
+	var writtenCalls []string
+	origList, origWrittenSince := zfsList, zfsListWrittenSince
+	defer func() { zfsList, zfsListWrittenSince = origList, origWrittenSince }()
+	zfsList = func(ctx context.Context, properties []string, zfsArgs ...string) (res [][]string, _ error) {
+		require.Equal(t, []string{"name", "createtxg"}, properties)
+		require.Equal(t, []string{"-t", "snapshot", "-d", "1"}, zfsArgs[:4])
+		listCalls = append(listCalls, zfsArgs[4:])
+		for _, fs := range zfsArgs[4:] {
+			for snap, txg := range snapshots[fs] {
+				res = append(res, []string{fs + "@" + snap, fmt.Sprintf("%d", txg)})
+			}
+		}
+		return res, nil
+	}
+	zfsListWrittenSince = func(ctx context.Context, fss []*zfs.DatasetPath, snap string) (map[string]uint64, error) {
+		names := make([]string, len(fss))
+		res := make(map[string]uint64, len(fss))
+		for i, fs := range fss {
+			names[i] = fs.ToString()
+			res[fs.ToString()] = written[fs.ToString()]
+		}
+		sort.Strings(names)
+		writtenCalls = append(writtenCalls, fmt.Sprintf("%s: %s", snap, strings.Join(names, " ")))
+		return res, nil
+	}
+
+	defer func(s int) { skipUnchangedBatchSize = s }(skipUnchangedBatchSize)
+	skipUnchangedBatchSize = 2
+
+	naming, err := newNaming("zrepl_", "", "job")
+	require.NoError(t, err)
+	var fss []*zfs.DatasetPath
+	for _, n := range []string{"pool/a", "pool/b", "pool/c", "pool/d", "pool/e"} {
+		fs, err := zfs.NewDatasetPath(n)
+		require.NoError(t, err)
+		fss = append(fss, fs)
+	}
+
+	unchanged, err := unchangedSinceLastSnapshot(context.Background(), fss, naming)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"pool/a": true, "pool/c": true, "pool/e": true}, unchanged)
+
+	assert.Equal(t, [][]string{{"pool/a", "pool/b"}, {"pool/c", "pool/d"}, {"pool/e"}}, listCalls)
+	// one query per batch and name of the most recent matching snapshot, pool/d has none
+	sort.Strings(writtenCalls)
+	assert.Equal(t, []string{"zrepl_1: pool/c", "zrepl_2: pool/a pool/b", "zrepl_2: pool/e"}, writtenCalls)
+}
+
+func TestSnapshotNowSelection(t *testing.T) {
+	orig := zfsListMapping
+	defer func() { zfsListMapping = orig }()
+	zfsListMapping = func(ctx context.Context, filter zfs.DatasetFilter) ([]*zfs.DatasetPath, error) {
+		fs, err := zfs.NewDatasetPath("pool/a")
+		require.NoError(t, err)
+		return []*zfs.DatasetPath{fs}, nil
+	}
+
+	s := &PeriodicOrManual{s: []*Snapper{{args: args{snapshotNow: make(chan snapshotNowRequest, 1)}}}}
+	err := s.SnapshotNow(context.Background(), func(fs string) bool { return fs == "pool/b" })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "matches none of the filesystems")
+	}
+	assert.Len(t, s.s[0].args.snapshotNow, 0, "no request is queued")
+
+	require.NoError(t, s.SnapshotNow(context.Background(), func(fs string) bool { return fs == "pool/a" }))
+	assert.Len(t, s.s[0].args.snapshotNow, 1)
+}
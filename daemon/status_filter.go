@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/job"
+)
+
+// StatusFilter restricts the status returned by ControlJobEndpointStatus to a job and to filesystems.
+// It is passed as the query parameters of the request, see Query.
+type StatusFilter struct {
+	// empty for all jobs
+	Job string
+	// empty for all filesystems, otherwise patterns of which a filesystem must match at least one:
+	// a `path.Match` pattern, e.g. `tank/db/*` (which does not match tank/db itself or tank/db/a/b),
+	// or a filesystem suffixed with `<` for the filesystem and its descendants, as for `zrepl signal wakeup --fs`
+	Filesystems []string
+}
+
+const (
+	statusFilterQueryJob = "job"
+	statusFilterQueryFS  = "fs"
+)
+
+func (f StatusFilter) Validate() error {
+	for _, p := range f.Filesystems {
+		if strings.TrimSuffix(p, "<") == "" {
+			return errors.Errorf("invalid filesystem pattern %q", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid filesystem pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Query returns the query parameters that StatusFilterFromQuery decodes into f.
+func (f StatusFilter) Query() url.Values {
+	q := url.Values{}
+	if f.Job != "" {
+		q.Set(statusFilterQueryJob, f.Job)
+	}
+	for _, p := range f.Filesystems {
+		q.Add(statusFilterQueryFS, p)
+	}
+	return q
+}
+
+func StatusFilterFromQuery(q url.Values) (StatusFilter, error) {
+	f := StatusFilter{
+		Job:         q.Get(statusFilterQueryJob),
+		Filesystems: q[statusFilterQueryFS],
+	}
+	return f, f.Validate()
+}
+
+// StatusEndpoint returns the endpoint that the status filtered by f is requested from.
+func (f StatusFilter) StatusEndpoint() string {
+	q := f.Query()
+	if len(q) == 0 {
+		return ControlJobEndpointStatus
+	}
+	return ControlJobEndpointStatus + "?" + q.Encode()
+}
+
+func (f StatusFilter) matchesFilesystem(fs string) bool {
+	for _, p := range f.Filesystems {
+		if subtree := strings.TrimSuffix(p, "<"); subtree != p {
+			if fs == subtree || strings.HasPrefix(fs, subtree+"/") {
+				return true
+			}
+		} else if ok, _ := path.Match(p, fs); ok { // patterns are validated
+			return true
+		}
+	}
+	return false
+}
+
+// apply restricts jobs to f, without modifying the statuses in jobs.
+// An unknown f.Job results in no jobs rather than an error, as clients like the TUI poll the status.
+func (f StatusFilter) apply(jobs map[string]*job.Status) map[string]*job.Status {
+	if f.Job != "" {
+		s, ok := jobs[f.Job]
+		jobs = map[string]*job.Status{}
+		if ok {
+			jobs[f.Job] = s
+		}
+	}
+	if len(f.Filesystems) == 0 {
+		return jobs
+	}
+	out := make(map[string]*job.Status, len(jobs))
+	for name, s := range jobs {
+		out[name] = s.FilterFilesystems(f.matchesFilesystem)
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/job"
+)
+
+func TestStatusFilter(t *testing.T) {
+	f := StatusFilter{Job: "prod", Filesystems: []string{"tank/db/*", "tank/vm<"}}
+	assert.Equal(t, ControlJobEndpointStatus+"?fs=tank%2Fdb%2F%2A&fs=tank%2Fvm%3C&job=prod", f.StatusEndpoint())
+	assert.Equal(t, ControlJobEndpointStatus, StatusFilter{}.StatusEndpoint())
+
+	decoded, err := StatusFilterFromQuery(f.Query())
+	require.NoError(t, err)
+	assert.Equal(t, f, decoded)
+
+	for fs, match := range map[string]bool{
+		"tank/db":      false,
+		"tank/db/a":    true,
+		"tank/db/a/b":  false,
+		"tank/vm":      true,
+		"tank/vm/a/b":  true,
+		"tank/vmother": false,
+	} {
+		assert.Equal(t, match, f.matchesFilesystem(fs), fs)
+	}
+
+	for _, p := range []string{"", "<", "tank/[db"} {
+		_, err := StatusFilterFromQuery(url.Values{"fs": {p}})
+		assert.Error(t, err, p)
+	}
+}
+
+func TestStatusFilterApply(t *testing.T) {
+	jobs := map[string]*job.Status{
+		"prod":  {Type: job.TypeVerify, JobSpecific: &job.VerifyJobStatus{}},
+		"other": {Type: job.TypeVerify, JobSpecific: &job.VerifyJobStatus{}},
+	}
+	assert.Len(t, StatusFilter{}.apply(jobs), 2)
+	assert.Len(t, StatusFilter{Job: "prod"}.apply(jobs), 1)
+	assert.Empty(t, StatusFilter{Job: "nonexistent"}.apply(jobs))
+	assert.Len(t, jobs, 2)
+}
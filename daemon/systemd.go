@@ -0,0 +1,202 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/util/sdnotify"
+)
+
+// startedJob is a job started by jobs.start.
+type startedJob struct {
+	name        string
+	ready, done <-chan struct{}
+}
+
+// startup tracks whether the jobs that the daemon started with are ready.
+type startup struct {
+	done chan struct{} // closed once all jobs are ready or exited
+}
+
+func newStartup() *startup {
+	return &startup{done: make(chan struct{})}
+}
+
+// wait waits until all started jobs are ready, or exited because they failed to start up,
+// e.g., because they could not listen, and then closes s.done.
+func (s *startup) wait(ctx context.Context, log Logger, started []startedJob) {
+	for _, j := range started {
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.ready:
+		case <-j.done:
+			log.WithField("job", j.name).Warn("job exited before it was ready, see its log messages")
+		}
+	}
+	close(s.done)
+}
+
+// completed returns true once all jobs are ready or exited.
+func (s *startup) completed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// notifyReady tells the service manager that the daemon is ready once startup completed.
+// It then sends watchdog keepalives while health passes, until ctx is done.
+func notifyReady(ctx context.Context, log Logger, startup *startup, health *healthCheck) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-startup.done:
+	}
+	if sent, err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		log.WithError(err).Error("cannot notify service manager of readiness")
+	} else if sent {
+		log.Info("notified service manager of readiness")
+	}
+
+	interval, err := sdnotify.WatchdogInterval()
+	if err != nil {
+		log.WithError(err).Error("cannot determine service manager watchdog interval, not sending keepalives")
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	// sd_watchdog_enabled(3) recommends sending keepalives at half the interval
+	log.WithField("interval", interval).Info("sending service manager watchdog keepalives")
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		if err := health.check(interval / 4); err != nil {
+			log.WithError(err).Error("health check failed, not sending watchdog keepalive")
+		} else if _, err := sdnotify.Notify(sdnotify.Watchdog); err != nil {
+			log.WithError(err).Error("cannot send watchdog keepalive")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// notifyStopping tells the service manager that the daemon is shutting down.
+func notifyStopping(log Logger) {
+	if _, err := sdnotify.Notify(sdnotify.Stopping); err != nil {
+		log.WithError(err).Error("cannot notify service manager of shutdown")
+	}
+}
+
+// healthCheck determines whether the daemon is alive, e.g., to send watchdog keepalives:
+// the control socket must respond and no job may be deadlocked.
+type healthCheck struct {
+	sockpath string
+	jobs     *jobs
+
+	// mtx serializes checks
+	mtx sync.Mutex
+	// by Job.Name, the Status calls of earlier checks that did not return yet
+	pending map[string]<-chan struct{}
+}
+
+func newHealthCheck(sockpath string, jobs *jobs) *healthCheck {
+	return &healthCheck{sockpath: sockpath, jobs: jobs, pending: make(map[string]<-chan struct{})}
+}
+
+func (h *healthCheck) check(timeout time.Duration) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if err := h.checkControlSocket(timeout); err != nil {
+		return errors.Wrap(err, "control socket is not responsive")
+	}
+	if unresponsive := h.unresponsiveJobs(timeout); len(unresponsive) > 0 {
+		return errors.Errorf("jobs do not report their status, likely deadlocked: %s", strings.Join(unresponsive, ", "))
+	}
+	return nil
+}
+
+func (h *healthCheck) checkControlSocket(timeout time.Duration) error {
+	c := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", h.sockpath)
+			},
+		},
+		Timeout: timeout,
+	}
+	defer c.CloseIdleConnections()
+	resp, err := c.Get("http://unix" + ControlJobEndpointVersion)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// unresponsiveJobs returns the names of the jobs whose Status does not return within timeout.
+// A Status call that does not return is not repeated by later checks, so that a deadlocked job
+// does not accumulate goroutines.
+func (h *healthCheck) unresponsiveJobs(timeout time.Duration) []string {
+	h.jobs.m.RLock()
+	jobs := make(map[string]job.Job, len(h.jobs.jobs))
+	for name, j := range h.jobs.jobs {
+		jobs[name] = j
+	}
+	h.jobs.m.RUnlock()
+
+	for name, j := range jobs {
+		if _, ok := h.pending[name]; ok {
+			continue
+		}
+		returned := make(chan struct{})
+		go func(j job.Job) {
+			defer close(returned)
+			j.Status()
+		}(j)
+		h.pending[name] = returned
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	timedOut := false
+	var unresponsive []string
+	for name, returned := range h.pending {
+		if !timedOut {
+			select {
+			case <-returned:
+			case <-timer.C:
+				timedOut = true // don't wait for the remaining jobs
+			}
+		}
+		select {
+		case <-returned:
+			delete(h.pending, name)
+		default:
+			unresponsive = append(unresponsive, name)
+		}
+	}
+	sort.Strings(unresponsive)
+	return unresponsive
+}
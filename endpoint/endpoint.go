@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"strings"
 
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
@@ -25,6 +26,18 @@ type SenderConfig struct {
 	FSF     zfs.DatasetFilter
 	Encrypt *zfs.NilBool
 	JobID   JobID
+	// If true, all sends are raw sends (send -w), regardless of Encrypt.
+	Raw bool
+	// send -c, -e and -L, respectively
+	Compressed   bool
+	EmbeddedData bool
+	LargeBlocks  bool
+	// send -p and -b, respectively
+	Properties       bool
+	BackupProperties bool
+	// If true, step holds are put on behalf of the client identity found in the request context
+	// (see AbstractionProxiedStepHold).
+	ProxiedStepHolds bool
 }
 
 func (c *SenderConfig) Validate() error {
@@ -35,14 +48,26 @@ func (c *SenderConfig) Validate() error {
 	if _, err := StepHoldTag(c.JobID); err != nil {
 		return fmt.Errorf("JobID cannot be used for hold tag: %s", err)
 	}
+	if c.Properties && c.BackupProperties {
+		return errors.New("`Properties` and `BackupProperties` are mutually exclusive")
+	}
 	return nil
 }
 
 // Sender implements replication.ReplicationEndpoint for a sending side
 type Sender struct {
-	FSFilter zfs.DatasetFilter
-	encrypt  *zfs.NilBool
-	jobId    JobID
+	FSFilter         zfs.DatasetFilter
+	encrypt          *zfs.NilBool
+	raw              bool
+	compressed       bool
+	embeddedData     bool
+	largeBlocks      bool
+	properties       bool
+	backupProperties bool
+	jobId            JobID
+	proxiedStepHolds bool
+
+	versionsPrefetch versionsPrefetch
 }
 
 func NewSender(conf SenderConfig) *Sender {
@@ -50,10 +75,39 @@ func NewSender(conf SenderConfig) *Sender {
 		panic("invalid config" + err.Error())
 	}
 	return &Sender{
-		FSFilter: conf.FSF,
-		encrypt:  conf.Encrypt,
-		jobId:    conf.JobID,
+		FSFilter:         conf.FSF,
+		encrypt:          conf.Encrypt,
+		raw:              conf.Raw,
+		compressed:       conf.Compressed,
+		embeddedData:     conf.EmbeddedData,
+		largeBlocks:      conf.LargeBlocks,
+		properties:       conf.Properties,
+		backupProperties: conf.BackupProperties,
+		jobId:            conf.JobID,
+		proxiedStepHolds: conf.ProxiedStepHolds,
+	}
+}
+
+// returns nil if the sender does not put step holds on behalf of clients
+func (s *Sender) stepHoldClientIdentity(ctx context.Context) *string {
+	if !s.proxiedStepHolds {
+		return nil
+	}
+	clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
+	if !ok {
+		panic(fmt.Sprintf("ClientIdentityKey context value must be set"))
+	}
+	return &clientIdentity
+}
+
+// Returns true if a is specific to a client other than clientIdentity.
+// Such abstractions must not be cleaned up on behalf of clientIdentity.
+func isOtherClientsAbstraction(a Abstraction, clientIdentity *string) bool {
+	aCI := a.GetClientIdentity()
+	if aCI == nil {
+		return false
 	}
+	return clientIdentity == nil || *aCI != *clientIdentity
 }
 
 func (s *Sender) filterCheckFS(fs string) (*zfs.DatasetPath, error) {
@@ -81,6 +135,7 @@ func (s *Sender) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq)
 	if err != nil {
 		return nil, err
 	}
+	s.versionsPrefetch.fill(ctx, fss)
 	rfss := make([]*pdu.Filesystem, len(fss))
 	for i := range fss {
 		encEnabled, err := zfs.ZFSGetEncryptionEnabled(ctx, fss[i].ToString())
@@ -94,7 +149,16 @@ func (s *Sender) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq)
 			IsEncrypted:   encEnabled,
 		}
 	}
-	res := &pdu.ListFilesystemRes{Filesystems: rfss}
+	res := &pdu.ListFilesystemRes{
+		Filesystems: rfss,
+		// the active side of a pull job checks the receiver against them
+		SendFlagsValid:   true,
+		SendEncrypted:    s.encrypt.B,
+		SendRaw:          s.raw,
+		SendCompressed:   s.compressed,
+		SendEmbeddedData: s.embeddedData,
+		SendLargeBlocks:  s.largeBlocks,
+	}
 	return res, nil
 }
 
@@ -105,7 +169,7 @@ func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesyst
 	if err != nil {
 		return nil, err
 	}
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	fsvs, err := s.versionsPrefetch.listFilesystemVersions(ctx, lp, r.GetUserProperties())
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +207,7 @@ func sendArgsFromPDUAndValidateExistsAndGetVersion(ctx context.Context, fs strin
 func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	_, err := s.filterCheckFS(r.Filesystem)
+	fsp, err := s.filterCheckFS(r.Filesystem)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -166,11 +230,18 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	}
 
 	sendArgsUnvalidated := zfs.ZFSSendArgsUnvalidated{
-		FS:          r.Filesystem,
-		From:        uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendDry / zfs.ZFSSend
-		To:          uncheckedSendArgsFromPDU(r.GetTo()),   // validated by zfs.ZFSSendDry / zfs.ZFSSend
-		Encrypted:   s.encrypt,
-		ResumeToken: r.ResumeToken, // nil or not nil, depending on decoding success
+		FS:               r.Filesystem,
+		From:             uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendDry / zfs.ZFSSend
+		To:               uncheckedSendArgsFromPDU(r.GetTo()),   // validated by zfs.ZFSSendDry / zfs.ZFSSend
+		Encrypted:        s.encrypt,
+		Raw:              s.raw,
+		Compressed:       s.compressed,
+		EmbeddedData:     s.embeddedData,
+		LargeBlocks:      s.largeBlocks,
+		Properties:       s.properties,
+		BackupProperties: s.backupProperties,
+		Intermediates:    r.GetIntermediates(),
+		ResumeToken:      r.ResumeToken, // nil or not nil, depending on decoding success
 	}
 
 	sendArgs, err := sendArgsUnvalidated.Validate(ctx)
@@ -188,6 +259,18 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	}
 	defer guard.Release()
 
+	// held until the stream is closed, so that the snapshots are not pruned while they are being sent
+	fsGuard, err := LockFilesystems(ctx, OpSend, fsp)
+	if err != nil {
+		return nil, nil, err
+	}
+	streamOwnsFSGuard := false
+	defer func() {
+		if !streamOwnsFSGuard {
+			fsGuard.Release()
+		}
+	}()
+
 	si, err := zfs.ZFSSendDry(ctx, sendArgs)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "zfs send dry failed")
@@ -203,6 +286,7 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 	res := &pdu.SendRes{
 		ExpectedSize:    expSize,
 		UsedResumeToken: r.ResumeToken != "",
+		Intermediates:   r.GetIntermediates(),
 	}
 
 	if r.DryRun {
@@ -223,7 +307,8 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 		return nil, nil, err
 	}
 	replicationGuaranteeStrategy := replicationGuaranteeOptions.Strategy(sendArgs.From != nil)
-	liveAbs, err := replicationGuaranteeStrategy.SenderPreSend(ctx, s.jobId, &sendArgs)
+	clientIdentity := s.stepHoldClientIdentity(ctx)
+	liveAbs, err := replicationGuaranteeStrategy.SenderPreSend(ctx, s.jobId, clientIdentity, &sendArgs)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -254,7 +339,7 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 		defer endSpan()
 
 		keep := func(a Abstraction) (keep bool) {
-			keep = false
+			keep = isOtherClientsAbstraction(a, clientIdentity) || isFutureStepHold(a, sendArgs.ToVersion)
 			for _, k := range liveAbs {
 				keep = keep || AbstractionEquals(a, k)
 			}
@@ -289,18 +374,25 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.Rea
 		}
 		destroyTypes := AbstractionTypeSet{
 			AbstractionStepHold:                           true,
+			AbstractionProxiedStepHold:                    true,
 			AbstractionTentativeReplicationCursorBookmark: true,
 		}
 		abstractionsCacheSingleton.TryBatchDestroy(ctx, s.jobId, sendArgs.FS, destroyTypes, keep, check)
 	}()
 
+	globalGuard, err := acquireGlobal(ctx, globalSendSemaphore)
+	if err != nil {
+		return nil, nil, err
+	}
 	sendStream, err := zfs.ZFSSend(ctx, sendArgs)
 	if err != nil {
+		globalGuard.Release()
 		// it's ok to not destroy the abstractions we just created here, a new send attempt will take care of it
 		return nil, nil, errors.Wrap(err, "zfs send failed")
 	}
 
-	return res, sendStream, nil
+	streamOwnsFSGuard = true
+	return res, &guardedReadCloser{&guardedReadCloser{sendStream, globalGuard}, fsGuard}, nil
 }
 
 func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
@@ -339,8 +431,9 @@ func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*p
 			abstractionsCacheSingleton.Put(a)
 		}
 	}
+	clientIdentity := p.stepHoldClientIdentity(ctx)
 	keep := func(a Abstraction) (keep bool) {
-		keep = false
+		keep = isOtherClientsAbstraction(a, clientIdentity) || isFutureStepHold(a, to)
 		for _, k := range liveAbs {
 			keep = keep || AbstractionEquals(a, k)
 		}
@@ -348,6 +441,7 @@ func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*p
 	}
 	destroyTypes := AbstractionTypeSet{
 		AbstractionStepHold:                           true,
+		AbstractionProxiedStepHold:                    true,
 		AbstractionTentativeReplicationCursorBookmark: true,
 		AbstractionReplicationCursorBookmarkV2:        true,
 	}
@@ -364,7 +458,22 @@ func (p *Sender) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshots
 	if err != nil {
 		return nil, err
 	}
-	return doDestroySnapshots(ctx, dp, req.Snapshots)
+	return doDestroySnapshots(ctx, dp, req.Snapshots, req.GetDeferSnapshotsWithClones())
+}
+
+// WaitForSpaceReclaim implements pruner.SpaceReclaimWaiter
+func (p *Sender) WaitForSpaceReclaim(ctx context.Context, fss []string) error {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	dps := make([]*zfs.DatasetPath, len(fss))
+	for i, fs := range fss {
+		dp, err := p.filterCheckFS(fs)
+		if err != nil {
+			return err
+		}
+		dps[i] = dp
+	}
+	return doWaitForSpaceReclaim(ctx, dps)
 }
 
 func (p *Sender) Ping(ctx context.Context, req *pdu.PingReq) (*pdu.PingRes, error) {
@@ -427,10 +536,56 @@ type ReceiverConfig struct {
 
 	RootWithoutClientComponent *zfs.DatasetPath // TODO use
 	AppendClientIdentity       bool
+	// Only if AppendClientIdentity is set: the first mapping that matches the client identity applies,
+	// clients without a matching mapping are received below RootWithoutClientComponent/<client identity>.
+	ClientMappings []ReceiverClientMapping
+
+	Zvol ReceiverZvolConfig
+
+	// Jobs on this host that replicate the received filesystems further, may be empty.
+	Downstream []DownstreamJob
+
+	// Whether the sender may request to roll back diverged filesystems (ReceiveReq.RollbackTo).
+	AllowRollback bool
+}
+
+// ReceiverZvolConfig is applied to receives of volume send streams.
+// The empty value leaves the properties as received.
+type ReceiverZvolConfig struct {
+	// volmode property value to set on the received volume, empty to keep
+	Volmode string
+	// refreservation property value to set on the received volume ("none" or "auto"), empty to keep
+	Refreservation string
+}
+
+func (c *ReceiverZvolConfig) Validate() error {
+	switch c.Volmode {
+	case "", "default", "full", "geom", "dev", "none":
+	default:
+		return fmt.Errorf("invalid volmode %q", c.Volmode)
+	}
+	switch c.Refreservation {
+	case "", "none", "auto":
+	default:
+		return fmt.Errorf("invalid refreservation policy %q", c.Refreservation)
+	}
+	return nil
+}
+
+func (c *ReceiverZvolConfig) overrideProperties() map[string]string {
+	props := make(map[string]string)
+	if c.Volmode != "" {
+		props["volmode"] = c.Volmode
+	}
+	if c.Refreservation != "" {
+		props["refreservation"] = c.Refreservation
+	}
+	return props
 }
 
 func (c *ReceiverConfig) copyIn() {
 	c.RootWithoutClientComponent = c.RootWithoutClientComponent.Copy()
+	c.ClientMappings = append([]ReceiverClientMapping(nil), c.ClientMappings...)
 }
 
 func (c *ReceiverConfig) Validate() error {
@@ -438,6 +593,26 @@ func (c *ReceiverConfig) Validate() error {
 	if c.RootWithoutClientComponent.Length() <= 0 {
 		return errors.New("RootWithoutClientComponent must not be an empty dataset path")
 	}
+	if err := c.Zvol.Validate(); err != nil {
+		return errors.Wrap(err, "zvol config")
+	}
+	if len(c.ClientMappings) > 0 && !c.AppendClientIdentity {
+		return errors.New("ClientMappings requires AppendClientIdentity")
+	}
+	for i := range c.ClientMappings {
+		if err := c.ClientMappings[i].Validate(c.RootWithoutClientComponent); err != nil {
+			return errors.Wrapf(err, "client mapping #%d", i+1)
+		}
+	}
+	// the overlaps of the other clients can only be detected once their identity is known
+	for i, m := range c.ClientMappings {
+		if strings.ContainsAny(m.Client, `*?[\`) || c.clientMappingIndex(m.Client) != i {
+			continue
+		}
+		if err := c.checkClientOverlap(m.Client); err != nil {
+			return errors.Wrapf(err, "client mapping #%d", i+1)
+		}
+	}
 	return nil
 }
 
@@ -446,6 +621,9 @@ type Receiver struct {
 	conf ReceiverConfig // validated
 
 	recvParentCreationMtx *chainlock.L
+	clientQuotas          clientQuotas
+
+	versionsPrefetch versionsPrefetch
 }
 
 func NewReceiver(config ReceiverConfig) *Receiver {
@@ -494,30 +672,6 @@ func (s *Receiver) clientRootFromCtx(ctx context.Context) *zfs.DatasetPath {
 	return clientRoot
 }
 
-type subroot struct {
-	localRoot *zfs.DatasetPath
-}
-
-var _ zfs.DatasetFilter = subroot{}
-
-// Filters local p
-func (f subroot) Filter(p *zfs.DatasetPath) (pass bool, err error) {
-	return p.HasPrefix(f.localRoot) && !p.Equal(f.localRoot), nil
-}
-
-func (f subroot) MapToLocal(fs string) (*zfs.DatasetPath, error) {
-	p, err := zfs.NewDatasetPath(fs)
-	if err != nil {
-		return nil, err
-	}
-	if p.Length() == 0 {
-		return nil, errors.Errorf("cannot map empty filesystem")
-	}
-	c := f.localRoot.Copy()
-	c.Extend(p)
-	return c, nil
-}
-
 func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
@@ -528,11 +682,15 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 		return nil, errors.New("root_fs does not exist")
 	}
 
-	root := s.clientRootFromCtx(ctx)
-	filtered, err := zfs.ZFSListMapping(ctx, subroot{root})
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
+	filtered, err := zfs.ZFSListMapping(ctx, clientFSS)
+	if err != nil {
+		return nil, err
+	}
+	s.versionsPrefetch.fill(ctx, filtered) // before a.TrimPrefix below
 	// present filesystem without the root_fs prefix
 	fss := make([]*pdu.Filesystem, 0, len(filtered))
 	for _, a := range filtered {
@@ -559,35 +717,68 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 			return nil, err
 		}
 		l.WithField("receive_resume_token", token).Debug("receive resume token")
+		downstream, err := s.downstreamCursors(ctx, a)
+		if err != nil {
+			l.WithError(err).Error("cannot get downstream replication cursors")
+			return nil, err
+		}
 
-		a.TrimPrefix(root)
+		remote, _ := clientFSS.MapToRemote(a) // filtered above
 
 		fs := &pdu.Filesystem{
-			Path:          a.ToString(),
+			Path:          remote,
 			IsPlaceholder: ph.IsPlaceholder,
 			ResumeToken:   token,
 			IsEncrypted:   encEnabled,
+			Downstream:    downstream,
 		}
 		fss = append(fss, fs)
 	}
+	res := &pdu.ListFilesystemRes{}
 	if len(fss) == 0 {
 		getLogger(ctx).Debug("no filesystems found")
-		return &pdu.ListFilesystemRes{}, nil
+	} else {
+		res.Filesystems = fss
 	}
-	return &pdu.ListFilesystemRes{Filesystems: fss}, nil
+
+	// let the sender check early whether it can send with the flags it is configured for
+	// (not fatal, the sender will just skip the check)
+	if features, err := s.rootFSPoolFeatures(ctx); err != nil {
+		getLogger(ctx).WithError(err).Warn("cannot determine features of root_fs pool")
+	} else {
+		res.RootFSPoolFeatures = features
+		res.RootFSPoolFeaturesValid = true
+	}
+
+	return res, nil
+}
+
+func (s *Receiver) rootFSPoolFeatures(ctx context.Context) ([]string, error) {
+	pool, err := s.conf.RootWithoutClientComponent.Pool()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := zfs.PoolFeatures(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	return caps.Enabled, nil
 }
 
 func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := clientFSS.MapToLocal(req.GetFilesystem())
 	if err != nil {
 		return nil, err
 	}
 	// TODO share following code with sender
 
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	fsvs, err := s.versionsPrefetch.listFilesystemVersions(ctx, lp, req.GetUserProperties())
 	if err != nil {
 		return nil, err
 	}
@@ -624,6 +815,35 @@ func (s *Receiver) ReplicationCursor(ctx context.Context, _ *pdu.ReplicationCurs
 	return nil, fmt.Errorf("ReplicationCursor not implemented for Receiver")
 }
 
+// LastReceived implements pruner.LastReceivedLister:
+// it returns the snapshot of fs that holds the Receiver's last-received-hold, nil if there is none.
+func (s *Receiver) LastReceived(ctx context.Context, fs string) (*pdu.FilesystemVersion, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := clientFSS.MapToLocal(fs)
+	if err != nil {
+		return nil, err
+	}
+	v, err := GetMostRecentLastReceivedHoldOfJob(ctx, lp.ToString(), s.conf.JobID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return pdu.FilesystemVersionFromZFS(v), nil
+}
+
+// LocalFilesystem returns the filesystem on this host that the filesystem fs of the client is received into.
+func (s *Receiver) LocalFilesystem(ctx context.Context, fs string) (*zfs.DatasetPath, error) {
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return clientFSS.MapToLocal(fs)
+}
+
 func (s *Receiver) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 	return nil, nil, fmt.Errorf("receiver does not implement Send()")
@@ -637,8 +857,11 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 	getLogger(ctx).Debug("incoming Receive")
 	defer receive.Close()
 
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := clientFSS.MapToLocal(req.Filesystem)
 	if err != nil {
 		return nil, errors.Wrap(err, "`Filesystem` invalid")
 	}
@@ -695,7 +918,7 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 				}
 				l := getLogger(ctx).WithField("placeholder_fs", v.Path)
 				l.Debug("create placeholder filesystem")
-				err := zfs.ZFSCreatePlaceholderFilesystem(ctx, v.Path, v.Parent.Path)
+				err := zfs.ZFSCreatePlaceholderFilesystem(ctx, v.Path, v.Parent.Path, clientFSS.placeholderProperties())
 				if err != nil {
 					l.WithError(err).Error("cannot create placeholder filesystem")
 					visitErr = err
@@ -706,6 +929,10 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 			getLogger(ctx).WithField("filesystem", v.Path.ToString()).Debug("exists")
 			return true // leave this fs as is
 		})
+		if visitErr == nil {
+			// the client root is a parent of lp, hence it exists now
+			visitErr = s.clientQuotas.ensureQuota(ctx, clientFSS)
+		}
 	}()
 	getLogger(ctx).WithField("visitErr", visitErr).Debug("complete tree-walk")
 	if visitErr != nil {
@@ -714,6 +941,13 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 
 	log := getLogger(ctx).WithField("proto_fs", req.GetFilesystem()).WithField("local_fs", lp.ToString())
 
+	// the rollback below and the receive itself must not race with pruning or snapshotting of lp
+	fsGuard, err := LockFilesystems(ctx, OpReceive, lp)
+	if err != nil {
+		return nil, err
+	}
+	defer fsGuard.Release()
+
 	// determine whether we need to rollback the filesystem / change its placeholder state
 	var clearPlaceholderProperty bool
 	var recvOpts zfs.RecvOptions
@@ -727,6 +961,24 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 		clearPlaceholderProperty = true
 	}
 
+	if rollbackTo := req.GetRollbackTo(); rollbackTo != nil {
+		if !s.conf.AllowRollback {
+			return nil, fmt.Errorf("cannot roll back to %s: receiver does not allow rolling back diverged filesystems (`conflict_resolution.receiver_rollback` is not set on the receiving side)", rollbackTo.RelName())
+		}
+		if !ph.FSExists || ph.IsPlaceholder {
+			return nil, fmt.Errorf("cannot roll back to %s: filesystem does not exist or is a placeholder", rollbackTo.RelName())
+		}
+		var err error
+		func() {
+			// renames and clones manipulate the dataset hierarchy
+			defer s.recvParentCreationMtx.Lock().Unlock()
+			err = setAsideDivergentState(ctx, lp, rollbackTo)
+		}()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot resolve divergence by rolling back to common snapshot")
+		}
+	}
+
 	if clearPlaceholderProperty {
 		log.Info("clearing placeholder property")
 		if err := zfs.ZFSSetPlaceholder(ctx, lp, false); err != nil {
@@ -755,6 +1007,11 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 		return nil, err
 	}
 	defer guard.Release()
+	globalGuard, err := acquireGlobal(ctx, globalRecvSemaphore)
+	if err != nil {
+		return nil, err
+	}
+	defer globalGuard.Release()
 
 	var peek bytes.Buffer
 	var MaxPeek = envconst.Int64("ZREPL_ENDPOINT_RECV_PEEK_SIZE", 1<<20)
@@ -767,6 +1024,22 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 		panic(peek.Len())
 	}
 
+	if streamHeader, err := zfs.ParseSendStreamHeader(peek.Bytes()); err != nil {
+		log.WithError(err).Warn("cannot parse send stream header, not applying zvol receive options")
+	} else {
+		// zvol-specific receive options, filesystems are received as before
+		if streamHeader.ObjsetType == zfs.SendStreamObjsetTypeVolume {
+			recvOpts.OverrideProperties = s.conf.Zvol.overrideProperties()
+			log.WithField("override_properties", recvOpts.OverrideProperties).Debug("receiving volume")
+		}
+		// The stream carries the sender's properties (send -p or -b).
+		// If the sender's dataset is a placeholder, the stream would turn our dataset into one as well.
+		if streamHeader.Compound {
+			recvOpts.ExcludeProperties = []string{zfs.PlaceholderPropertyName}
+			log.WithField("exclude_properties", recvOpts.ExcludeProperties).Debug("send stream carries properties")
+		}
+	}
+
 	log.WithField("opts", fmt.Sprintf("%#v", recvOpts)).Debug("start receive command")
 
 	snapFullPath := to.FullPath(lp.ToString())
@@ -890,12 +1163,49 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive io.
 func (s *Receiver) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return doDestroySnapshots(ctx, lp, req.Snapshots)
+	lp, err := clientFSS.MapToLocal(req.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	destroy, kept, err := s.keepForDownstream(ctx, lp, req.Snapshots)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) > 0 {
+		getLogger(ctx).WithField("fs", lp.ToString()).WithField("kept", len(kept)).
+			Info("not destroying snapshots that downstream jobs have not replicated yet")
+	}
+	res := &pdu.DestroySnapshotsRes{}
+	if len(destroy) > 0 {
+		if res, err = doDestroySnapshots(ctx, lp, destroy, req.GetDeferSnapshotsWithClones()); err != nil {
+			return nil, err
+		}
+	}
+	res.Results = append(res.Results, kept...)
+	return res, nil
+}
+
+// WaitForSpaceReclaim implements pruner.SpaceReclaimWaiter
+func (s *Receiver) WaitForSpaceReclaim(ctx context.Context, fss []string) error {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	lps := make([]*zfs.DatasetPath, len(fss))
+	for i, fs := range fss {
+		lp, err := clientFSS.MapToLocal(fs)
+		if err != nil {
+			return err
+		}
+		lps[i] = lp
+	}
+	return doWaitForSpaceReclaim(ctx, lps)
 }
 
 func (p *Receiver) SendCompleted(ctx context.Context, _ *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
@@ -904,26 +1214,83 @@ func (p *Receiver) SendCompleted(ctx context.Context, _ *pdu.SendCompletedReq) (
 	return &pdu.SendCompletedRes{}, nil
 }
 
-func doDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (*pdu.DestroySnapshotsRes, error) {
-	reqs := make([]*zfs.DestroySnapOp, len(snaps))
-	ress := make([]*pdu.DestroySnapshotRes, len(snaps))
-	errs := make([]error, len(snaps))
-	for i, fsv := range snaps {
-		if fsv.Type != pdu.FilesystemVersion_Snapshot {
-			return nil, fmt.Errorf("version %q is not a snapshot", fsv.Name)
+// waits once per pool
+func doWaitForSpaceReclaim(ctx context.Context, fss []*zfs.DatasetPath) error {
+	waited := make(map[string]bool)
+	for _, fs := range fss {
+		pool, err := fs.Pool()
+		if err != nil {
+			return err
+		}
+		if waited[pool] {
+			continue
+		}
+		waited[pool] = true
+		getLogger(ctx).WithField("pool", pool).Debug("wait for space of destroyed snapshots to be freed")
+		if err := zfs.ZFSWait(ctx, fs, zfs.WaitActivityFree); err != nil {
+			return errors.Wrapf(err, "wait for freeing in pool %q", pool)
+		}
+	}
+	return nil
+}
+
+// Snapshots with clones are not destroyed by the batch operation but kept or, if deferClones, destroyed with `zfs destroy -d`,
+// see pdu.DestroySnapshotsReq.DeferSnapshotsWithClones.
+// snaps may contain bookmarks, except for those of zrepl's abstractions (see IsAbstractionBookmark), which are kept.
+func doDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion, deferClones bool) (*pdu.DestroySnapshotsRes, error) {
+	var bookmarks []*pdu.FilesystemVersion
+	{
+		var onlySnaps []*pdu.FilesystemVersion
+		for _, fsv := range snaps {
+			switch fsv.Type {
+			case pdu.FilesystemVersion_Snapshot:
+				onlySnaps = append(onlySnaps, fsv)
+			case pdu.FilesystemVersion_Bookmark:
+				bookmarks = append(bookmarks, fsv)
+			default:
+				return nil, fmt.Errorf("version %q is neither a snapshot nor a bookmark", fsv.Name)
+			}
 		}
-		ress[i] = &pdu.DestroySnapshotRes{
+		snaps = onlySnaps
+	}
+	// acquired before the pool slot so that waiting for a send of lp does not hold up other filesystems of the pool
+	fsGuard, err := LockFilesystems(ctx, OpDestroySnapshots, lp)
+	if err != nil {
+		return nil, err
+	}
+	defer fsGuard.Release()
+	g, err := zfs.AcquirePoolSlot(ctx, lp)
+	if err != nil {
+		return nil, err
+	}
+	defer g.Release()
+
+	var clones map[string][]string
+	if len(snaps) > 0 {
+		if clones, err = zfs.ZFSListSnapshotClones(ctx, lp); err != nil {
+			return nil, errors.Wrap(err, "cannot list clones of snapshots")
+		}
+	}
+	var names []string
+	var ress, cloned []*pdu.DestroySnapshotRes
+	for _, fsv := range snaps {
+		res := &pdu.DestroySnapshotRes{
 			Snapshot: fsv,
 			// Error set after batch operation
 		}
-		reqs[i] = &zfs.DestroySnapOp{
-			Filesystem: lp.ToString(),
-			Name:       fsv.Name,
-			ErrOut:     &errs[i],
+		if len(clones[fsv.Name]) > 0 {
+			cloned = append(cloned, res)
+			continue
 		}
+		ress = append(ress, res)
+		names = append(names, fsv.Name)
 	}
-	zfs.ZFSDestroyFilesystemVersions(ctx, reqs)
-	for i := range reqs {
+
+	var errs []error
+	if len(names) > 0 {
+		errs = zfs.ZFSDestroySnapshotsBatch(ctx, lp, names)
+	}
+	for i := range errs {
 		if errs[i] != nil {
 			if de, ok := errs[i].(*zfs.DestroySnapshotsError); ok && len(de.Reason) == 1 {
 				ress[i].Error = de.Reason[0]
@@ -932,6 +1299,36 @@ func doDestroySnapshots(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.F
 			}
 		}
 	}
+
+	ress = append(ress, cloned...)
+	for _, res := range cloned {
+		cs := strings.Join(clones[res.Snapshot.Name], ", ")
+		if !deferClones {
+			res.KeptReason = fmt.Sprintf("has dependent clones %s", cs)
+			getLogger(ctx).WithField("snap", res.Snapshot.RelName()).WithField("clones", cs).
+				Warn("not destroying snapshot that has dependent clones")
+			continue
+		}
+		if err := zfs.ZFSDestroyDeferred(ctx, lp, res.Snapshot.Name); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		// the snapshot remains until its clones are destroyed, and the next pruning will destroy it (deferred) again
+		res.KeptReason = fmt.Sprintf("destroy deferred until dependent clones %s are destroyed", cs)
+	}
+
+	for _, fsv := range bookmarks {
+		res := &pdu.DestroySnapshotRes{Snapshot: fsv}
+		ress = append(ress, res)
+		if IsAbstractionBookmark(lp.ToString(), fsv.Name) {
+			res.KeptReason = "bookmark is managed by zrepl"
+			continue
+		}
+		if err := zfs.ZFSDestroyIdempotent(ctx, fmt.Sprintf("%s#%s", lp.ToString(), fsv.Name)); err != nil {
+			res.Error = err.Error()
+		}
+	}
+
 	return &pdu.DestroySnapshotsRes{
 		Results: ress,
 	}, nil
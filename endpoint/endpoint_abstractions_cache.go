@@ -3,6 +3,7 @@ package endpoint
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -117,6 +118,27 @@ func (s *abstractionsCache) GetAndDeleteByJobIDAndFS(ctx context.Context, jobID
 	return ret
 }
 
+// Returns the client identities of the abstractions of jobID on fs (see AbstractionProxiedStepHold),
+// i.e., the clients that replicate fs with jobID on their behalf.
+func (s *abstractionsCache) GetClientIdentitiesByJobIDAndFS(ctx context.Context, jobID JobID, fs string) (ret []string) {
+	defer s.mtx.Lock().Unlock()
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	s.tryLoadOnDiskAbstractions(ctx, fs)
+
+	seen := make(map[string]bool)
+	for _, a := range s.abstractions {
+		ci := a.GetClientIdentity()
+		if ci == nil || *a.GetJobID() != jobID || a.GetFS() != fs || seen[*ci] {
+			continue
+		}
+		seen[*ci] = true
+		ret = append(ret, *ci)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 // caller must hold s.mtx
 func (s *abstractionsCache) tryLoadOnDiskAbstractions(ctx context.Context, fs string) {
 	for s.didLoadFS[fs] != abstractionsCacheDidLoadFSStateDone {
@@ -160,6 +182,7 @@ func (s *abstractionsCache) tryLoadOnDiskAbstractionsImpl(ctx context.Context, f
 		JobID: nil,
 		What: AbstractionTypeSet{
 			AbstractionStepHold:                           true,
+			AbstractionProxiedStepHold:                    true,
 			AbstractionTentativeReplicationCursorBookmark: true,
 			AbstractionReplicationCursorBookmarkV2:        true,
 			AbstractionLastReceivedHold:                   true,
@@ -189,7 +212,7 @@ func (s *abstractionsCache) TryBatchDestroy(ctx context.Context, jobId JobID, fs
 	}
 
 	hadErr := false
-	for res := range BatchDestroy(ctx, obsoleteAbs) {
+	for res := range BatchDestroy(ctx, obsoleteAbs, false) {
 		if res.DestroyErr != nil {
 			hadErr = true
 			getLogger(ctx).
@@ -0,0 +1,85 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// AckReceived moves the replication cursor of r.Filesystem to the snapshot with r.Guid,
+// which the active side of a pull setup reports as the most recent snapshot that it received.
+//
+// Unlike SendCompleted, which moves the cursor at the end of each replication step,
+// the acknowledgement is sent independently of the replication steps,
+// and thus also covers steps whose SendCompleted was lost.
+// It makes keep rule `not_replicated` usable for pruning on the sending side of a pull setup.
+//
+// The cursor is never moved backwards.
+func (s *Sender) AckReceived(ctx context.Context, r *pdu.AckReceivedReq) (*pdu.AckReceivedRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	dp, err := s.filterCheckFS(r.GetFilesystem())
+	if err != nil {
+		return nil, err
+	}
+	fs := dp.ToString()
+
+	versions, err := zfs.ZFSListFilesystemVersions(ctx, dp, zfs.ListFilesystemVersionsOptions{
+		Types: zfs.Snapshots,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list snapshots")
+	}
+	var acked *zfs.FilesystemVersion
+	for i := range versions {
+		if versions[i].Guid == r.GetGuid() {
+			acked = &versions[i]
+			break
+		}
+	}
+	if acked == nil {
+		return nil, fmt.Errorf("filesystem %q has no snapshot with guid %d", fs, r.GetGuid())
+	}
+
+	log := getLogger(ctx).WithField("fs", fs).WithField("acked", acked.RelName())
+
+	cursor, err := GetMostRecentReplicationCursorOfJob(ctx, fs, s.jobId)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil && cursor.CreateTXG >= acked.CreateTXG {
+		log.WithField("cursor", cursor.RelName()).Debug("replication cursor is already at or past acknowledged snapshot")
+		return &pdu.AckReceivedRes{}, nil
+	}
+
+	liveAbs, err := senderPostRecvConfirmedCommon(ctx, s.jobId, fs, *acked)
+	if err != nil {
+		return nil, err
+	}
+	if len(liveAbs) == 0 || liveAbs[0] == nil {
+		// the pool does not support bookmarks, nothing to clean up
+		return &pdu.AckReceivedRes{}, nil
+	}
+	newCursor := liveAbs[0]
+	abstractionsCacheSingleton.Put(newCursor)
+
+	keep := func(a Abstraction) bool {
+		// a concurrent SendCompleted might have moved the cursor further
+		return AbstractionEquals(a, newCursor) || a.GetFilesystemVersion().CreateTXG > acked.CreateTXG
+	}
+	destroyTypes := AbstractionTypeSet{
+		AbstractionReplicationCursorBookmarkV2: true,
+	}
+	abstractionsCacheSingleton.TryBatchDestroy(ctx, s.jobId, fs, destroyTypes, keep, nil)
+
+	return &pdu.AckReceivedRes{}, nil
+}
+
+func (s *Receiver) AckReceived(ctx context.Context, _ *pdu.AckReceivedReq) (*pdu.AckReceivedRes, error) {
+	return nil, fmt.Errorf("receiver does not implement AckReceived()")
+}
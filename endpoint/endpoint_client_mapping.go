@@ -0,0 +1,342 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+const (
+	ClientMappingVarClient     = "${client}"
+	ClientMappingVarSourcePool = "${source_pool}"
+)
+
+// ReceiverClientMapping places the filesystems of the clients whose identity matches Client
+// below RootTemplate instead of below RootWithoutClientComponent/<client identity>.
+type ReceiverClientMapping struct {
+	// pattern for the client identity, see path.Match
+	Client string
+	// Dataset path below RootWithoutClientComponent in which ClientMappingVarClient is replaced by the client identity.
+	// If a component of the path contains ClientMappingVarSourcePool, it is replaced by the pool of a received filesystem,
+	// and only the remainder of the filesystem's path is appended to the path.
+	// Otherwise, the filesystem's entire path is appended.
+	RootTemplate string
+	// Quota property of the client's root, i.e., of the template's components before the one that contains
+	// ClientMappingVarSourcePool. Empty leaves the quota as is.
+	Quota string
+	// Properties of the placeholders that are created on behalf of the client.
+	// They override the defaults, e.g., mountpoint=none.
+	PlaceholderProperties map[string]string
+}
+
+var clientMappingQuotaRegex = regexp.MustCompile(`(?i)^(none|[0-9]+(\.[0-9]+)?[KMGTPEZ]?B?)$`)
+
+func (m *ReceiverClientMapping) Validate(root *zfs.DatasetPath) error {
+	if _, err := path.Match(m.Client, ""); err != nil {
+		return errors.Wrapf(err, "invalid client pattern %q", m.Client)
+	}
+	if strings.ContainsAny(m.Client, `*?[\`) && !strings.Contains(m.RootTemplate, ClientMappingVarClient) {
+		return fmt.Errorf("root_fs template %q must contain %s because client pattern %q can match multiple clients",
+			m.RootTemplate, ClientMappingVarClient, m.Client)
+	}
+	if n := strings.Count(m.RootTemplate, ClientMappingVarSourcePool); n > 1 {
+		return fmt.Errorf("root_fs template %q must contain %s at most once", m.RootTemplate, ClientMappingVarSourcePool)
+	}
+	// any client identity and pool name are single path components
+	example := strings.Replace(m.RootTemplate, ClientMappingVarClient, "client", -1)
+	example = strings.Replace(example, ClientMappingVarSourcePool, "pool", -1)
+	if strings.Contains(example, "${") {
+		return fmt.Errorf("root_fs template %q contains an unknown variable, supported are %s and %s",
+			m.RootTemplate, ClientMappingVarClient, ClientMappingVarSourcePool)
+	}
+	examplePath, err := zfs.NewDatasetPath(example)
+	if err != nil {
+		return errors.Wrapf(err, "invalid root_fs template %q", m.RootTemplate)
+	}
+	if !examplePath.HasPrefix(root) || examplePath.Length() == root.Length() {
+		return fmt.Errorf("root_fs template %q must be below root_fs %q", m.RootTemplate, root.ToString())
+	}
+	if strings.Contains(strings.Join(strings.Split(m.RootTemplate, "/")[:root.Length()], "/"), "${") {
+		return fmt.Errorf("root_fs template %q must not have variables in the components of root_fs %q", m.RootTemplate, root.ToString())
+	}
+	if m.Quota != "" {
+		if !clientMappingQuotaRegex.MatchString(m.Quota) {
+			return fmt.Errorf("invalid quota %q", m.Quota)
+		}
+		clientRoot, _ := splitClientMappingTemplate(m.RootTemplate)
+		if !strings.Contains(strings.Join(clientRoot, "/"), ClientMappingVarClient) {
+			return fmt.Errorf("quota requires that root_fs template %q contains %s before %s",
+				m.RootTemplate, ClientMappingVarClient, ClientMappingVarSourcePool)
+		}
+	}
+	for prop := range m.PlaceholderProperties {
+		if prop == "" {
+			return errors.New("placeholder property name must not be empty")
+		}
+		if prop == zfs.PlaceholderPropertyName {
+			return fmt.Errorf("placeholder property %q cannot be overridden", prop)
+		}
+	}
+	return nil
+}
+
+// splitClientMappingTemplate returns the components of template before and
+// starting at the one that contains ClientMappingVarSourcePool.
+func splitClientMappingTemplate(template string) (clientRoot, poolComps []string) {
+	comps := strings.Split(template, "/")
+	for i, c := range comps {
+		if strings.Contains(c, ClientMappingVarSourcePool) {
+			return comps[:i], comps[i:]
+		}
+	}
+	return comps, nil
+}
+
+// clientFilesystems maps the filesystems of a client between its dataset hierarchy and the receiver's.
+type clientFilesystems struct {
+	// the received filesystems are below root, which does not depend on the received filesystem
+	root *zfs.DatasetPath
+	// the components below root if the template contains ClientMappingVarSourcePool, nil otherwise.
+	// poolComps[0] contains ClientMappingVarSourcePool.
+	poolComps []string
+
+	mapping *ReceiverClientMapping // nil for the default mapping
+}
+
+var _ zfs.DatasetFilter = (*clientFilesystems)(nil)
+
+func newClientFilesystems(root *zfs.DatasetPath) *clientFilesystems {
+	return &clientFilesystems{root: root}
+}
+
+func newClientFilesystemsFromMapping(m *ReceiverClientMapping, clientIdentity string) (*clientFilesystems, error) {
+	clientRoot, poolComps := splitClientMappingTemplate(strings.Replace(m.RootTemplate, ClientMappingVarClient, clientIdentity, -1))
+	root, err := zfs.NewDatasetPath(strings.Join(clientRoot, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid root_fs for client %q", clientIdentity)
+	}
+	return &clientFilesystems{root: root, poolComps: poolComps, mapping: m}, nil
+}
+
+// Filter passes the local filesystems that MapToRemote can map.
+func (c *clientFilesystems) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	_, ok := c.MapToRemote(p)
+	return ok, nil
+}
+
+func (c *clientFilesystems) MapToLocal(fs string) (*zfs.DatasetPath, error) {
+	p, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		return nil, err
+	}
+	if p.Length() == 0 {
+		return nil, errors.Errorf("cannot map empty filesystem")
+	}
+	if c.poolComps == nil {
+		l := c.root.Copy()
+		l.Extend(p)
+		return l, nil
+	}
+	comps := strings.Split(fs, "/")
+	local := make([]string, 0, c.root.Length()+len(c.poolComps)+len(comps)-1)
+	local = append(local, c.root.ToString())
+	local = append(local, strings.Replace(c.poolComps[0], ClientMappingVarSourcePool, comps[0], 1))
+	local = append(local, c.poolComps[1:]...)
+	local = append(local, comps[1:]...)
+	l, err := zfs.NewDatasetPath(strings.Join(local, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot map filesystem %q", fs)
+	}
+	return l, nil
+}
+
+// MapToRemote returns the client's path of local, ok is false if local is not a filesystem of the client.
+func (c *clientFilesystems) MapToRemote(local *zfs.DatasetPath) (_ string, ok bool) {
+	if !local.HasPrefix(c.root) || local.Length() == c.root.Length() {
+		return "", false
+	}
+	rel := local.Copy()
+	rel.TrimPrefix(c.root)
+	if c.poolComps == nil {
+		return rel.ToString(), true
+	}
+	comps := strings.Split(rel.ToString(), "/")
+	if len(comps) < len(c.poolComps) {
+		return "", false // intermediate placeholders of the template
+	}
+	for i := 1; i < len(c.poolComps); i++ {
+		if comps[i] != c.poolComps[i] {
+			return "", false
+		}
+	}
+	tmpl := strings.SplitN(c.poolComps[0], ClientMappingVarSourcePool, 2)
+	before, after := tmpl[0], tmpl[1]
+	pc := comps[0]
+	if len(pc) <= len(before)+len(after) || !strings.HasPrefix(pc, before) || !strings.HasSuffix(pc, after) {
+		return "", false
+	}
+	remote := append([]string{pc[len(before) : len(pc)-len(after)]}, comps[len(c.poolComps):]...)
+	return strings.Join(remote, "/"), true
+}
+
+func (c *clientFilesystems) placeholderProperties() map[string]string {
+	if c.mapping == nil {
+		return nil
+	}
+	return c.mapping.PlaceholderProperties
+}
+
+func (s *Receiver) clientFilesystemsFromCtx(ctx context.Context) (*clientFilesystems, error) {
+	if !s.conf.AppendClientIdentity {
+		return newClientFilesystems(s.conf.RootWithoutClientComponent.Copy()), nil
+	}
+	clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
+	if !ok {
+		panic(fmt.Sprintf("ClientIdentityKey context value must be set"))
+	}
+	if err := s.conf.checkClientOverlap(clientIdentity); err != nil {
+		return nil, err
+	}
+	if i := s.conf.clientMappingIndex(clientIdentity); i < len(s.conf.ClientMappings) {
+		c, err := newClientFilesystemsFromMapping(&s.conf.ClientMappings[i], clientIdentity)
+		if err != nil {
+			panic(fmt.Sprintf("ClientIdentityContextKey must have been validated before invoking Receiver: %s", err))
+		}
+		return c, nil
+	}
+	return newClientFilesystems(s.clientRootFromCtx(ctx)), nil
+}
+
+// clientMappingIndex returns the index of the mapping that applies to the client,
+// len(c.ClientMappings) if the client's filesystems are received below RootWithoutClientComponent/<client identity>.
+func (c *ReceiverConfig) clientMappingIndex(clientIdentity string) int {
+	for i := range c.ClientMappings {
+		if match, _ := path.Match(c.ClientMappings[i].Client, clientIdentity); match { // pattern validated by ReceiverConfig.Validate
+			return i
+		}
+	}
+	return len(c.ClientMappings)
+}
+
+// clientRootTemplate returns the pattern and the leading components of the template of mapping i
+// (len(c.ClientMappings) for RootWithoutClientComponent/<client identity>) that a client owns exclusively,
+// i.e., up to the one that contains ClientMappingVarClient, or up to the one with ClientMappingVarSourcePool
+// if the template does not contain ClientMappingVarClient.
+func (c *ReceiverConfig) clientRootTemplate(i int) (pattern string, comps []string) {
+	if i == len(c.ClientMappings) {
+		comps = strings.Split(c.RootWithoutClientComponent.ToString(), "/")
+		return "*", append(comps, ClientMappingVarClient)
+	}
+	m := &c.ClientMappings[i]
+	comps = strings.Split(m.RootTemplate, "/")
+	for j, comp := range comps {
+		if strings.Contains(comp, ClientMappingVarClient) {
+			return m.Client, comps[:j+1]
+		}
+	}
+	clientRoot, _ := splitClientMappingTemplate(m.RootTemplate)
+	return m.Client, clientRoot
+}
+
+// checkClientOverlap returns an error if the filesystems of the client could overlap with those of another client,
+// e.g., if the client is mapped to root_fs/tenants/bob and another client with identity tenants is not mapped.
+// Clients of the same mapping are told apart by ClientMappingVarClient.
+func (c *ReceiverConfig) checkClientOverlap(clientIdentity string) error {
+	own := c.clientMappingIndex(clientIdentity)
+	_, ownComps := c.clientRootTemplate(own)
+	for i := range ownComps {
+		ownComps[i] = strings.Replace(ownComps[i], ClientMappingVarClient, clientIdentity, -1)
+	}
+	for i := 0; i <= len(c.ClientMappings); i++ {
+		if i == own || c.clientMappingIndex("*") < i { // a catch-all mapping leaves no clients for i
+			continue
+		}
+		pattern, comps := c.clientRootTemplate(i)
+		// the other client if comps determine it, "" if it could be any client that matches pattern
+		other := ""
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			other = pattern
+		}
+		overlap := true
+		for j := 0; j < len(comps) && j < len(ownComps) && overlap; j++ {
+			comp := comps[j]
+			if other != "" {
+				comp = strings.Replace(comp, ClientMappingVarClient, other, -1)
+			} else if comp == ClientMappingVarClient && !strings.Contains(ownComps[j], "${") {
+				other = ownComps[j]
+				comp = other
+			}
+			overlap = clientMappingComponentsOverlap(ownComps[j], comp)
+		}
+		if !overlap {
+			continue
+		}
+		if other == "" {
+			return fmt.Errorf("root_fs of client %q overlaps the root_fs template %q of the clients matching %q",
+				clientIdentity, strings.Join(comps, "/"), pattern)
+		}
+		if match, _ := path.Match(pattern, other); match && other != clientIdentity && c.clientMappingIndex(other) == i {
+			return fmt.Errorf("root_fs of client %q overlaps the root_fs of client %q", clientIdentity, other)
+		}
+	}
+	return nil
+}
+
+// clientMappingComponentsOverlap returns whether the dataset path components a and b can be equal
+// for some values of the variables they contain.
+func clientMappingComponentsOverlap(a, b string) bool {
+	wildcards := strings.NewReplacer(ClientMappingVarClient, "*", ClientMappingVarSourcePool, "*")
+	a, b = wildcards.Replace(a), wildcards.Replace(b)
+	aw, bw := strings.Contains(a, "*"), strings.Contains(b, "*")
+	switch {
+	case !aw && !bw:
+		return a == b
+	case !aw:
+		match, _ := path.Match(b, a) // dataset path components contain no other pattern characters
+		return match
+	case !bw:
+		match, _ := path.Match(a, b)
+		return match
+	}
+	// the wildcards absorb any difference in between
+	aPrefix, bPrefix := a[:strings.Index(a, "*")], b[:strings.Index(b, "*")]
+	aSuffix, bSuffix := a[strings.LastIndex(a, "*")+1:], b[strings.LastIndex(b, "*")+1:]
+	return (strings.HasPrefix(aPrefix, bPrefix) || strings.HasPrefix(bPrefix, aPrefix)) &&
+		(strings.HasSuffix(aSuffix, bSuffix) || strings.HasSuffix(bSuffix, aSuffix))
+}
+
+// clientQuotas remembers the client roots whose quota was set, so that it is only set once per Receiver.
+type clientQuotas struct {
+	mtx sync.Mutex
+	set map[string]string // by client root
+}
+
+// ensureQuota sets the quota of c's root if its mapping has one. c.root must exist.
+func (q *clientQuotas) ensureQuota(ctx context.Context, c *clientFilesystems) error {
+	if c.mapping == nil || c.mapping.Quota == "" {
+		return nil
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.set[c.root.ToString()] == c.mapping.Quota {
+		return nil
+	}
+	getLogger(ctx).WithField("fs", c.root.ToString()).WithField("quota", c.mapping.Quota).Info("set quota of client root")
+	props := zfs.NewZFSProperties()
+	props.Set("quota", c.mapping.Quota)
+	if err := zfs.ZFSSet(ctx, c.root, props); err != nil {
+		return errors.Wrapf(err, "cannot set quota of client root %q", c.root.ToString())
+	}
+	if q.set == nil {
+		q.set = make(map[string]string)
+	}
+	q.set[c.root.ToString()] = c.mapping.Quota
+	return nil
+}
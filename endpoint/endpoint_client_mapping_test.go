@@ -0,0 +1,172 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestReceiverClientMappingValidate(t *testing.T) {
+	root, err := zfs.NewDatasetPath("storage/zrepl/sink")
+	require.NoError(t, err)
+
+	valid := []ReceiverClientMapping{
+		{Client: "prod1", RootTemplate: "storage/zrepl/sink/prod"},
+		{Client: "prod-*", RootTemplate: "storage/zrepl/sink/prod/${client}", Quota: "10T"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${client}/${source_pool}", Quota: "none"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${source_pool}-${client}"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${client}/pools/${source_pool}/data", Quota: "1.5G"},
+		{Client: "db", RootTemplate: "storage/zrepl/sink/db", PlaceholderProperties: map[string]string{"canmount": "off"}},
+	}
+	for _, m := range valid {
+		assert.NoError(t, m.Validate(root), "%#v", m)
+	}
+
+	invalid := []ReceiverClientMapping{
+		{Client: "[", RootTemplate: "storage/zrepl/sink/${client}"},
+		{Client: "prod-*", RootTemplate: "storage/zrepl/sink/prod"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink"},
+		{Client: "*", RootTemplate: "storage/other/${client}"},
+		{Client: "*", RootTemplate: "storage/zrepl/${client}/x"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${client}/${source_pool}/${source_pool}"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${host}"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${source_pool}/${client}", Quota: "10T"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${client}", Quota: "ten terabytes"},
+		{Client: "*", RootTemplate: "storage/zrepl/sink/${client}", PlaceholderProperties: map[string]string{zfs.PlaceholderPropertyName: "off"}},
+	}
+	for _, m := range invalid {
+		assert.Error(t, m.Validate(root), "%#v", m)
+	}
+}
+
+func TestClientFilesystemsMapping(t *testing.T) {
+	type mapping struct {
+		remote, local string
+	}
+	cases := []struct {
+		template string
+		mappings []mapping
+		// local filesystems below the client's root that are not filesystems of the client
+		notRemote []string
+	}{
+		{
+			template: "backups/${client}",
+			mappings: []mapping{
+				{"tank", "backups/host1/tank"},
+				{"tank/data/db", "backups/host1/tank/data/db"},
+			},
+			notRemote: []string{"backups/host1", "backups", "other/host1/tank"},
+		},
+		{
+			template: "backups/${client}/${source_pool}",
+			mappings: []mapping{
+				{"tank", "backups/host1/tank"},
+				{"tank/data", "backups/host1/tank/data"},
+			},
+			notRemote: []string{"backups/host1"},
+		},
+		{
+			template: "backups/${client}/pool-${source_pool}/fs",
+			mappings: []mapping{
+				{"tank", "backups/host1/pool-tank/fs"},
+				{"tank/data", "backups/host1/pool-tank/fs/data"},
+			},
+			notRemote: []string{"backups/host1/pool-tank", "backups/host1/pool-tank/other", "backups/host1/pool-/fs", "backups/host1/tank/fs"},
+		},
+		{
+			template: "backups/${source_pool}/hosts/${client}",
+			mappings: []mapping{
+				{"tank", "backups/tank/hosts/host1"},
+				{"rpool/ROOT", "backups/rpool/hosts/host1/ROOT"},
+			},
+			notRemote: []string{"backups/tank", "backups/tank/hosts", "backups/tank/clients/host1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.template, func(t *testing.T) {
+			fss, err := newClientFilesystemsFromMapping(&ReceiverClientMapping{Client: "*", RootTemplate: c.template}, "host1")
+			require.NoError(t, err)
+			for _, m := range c.mappings {
+				local, err := fss.MapToLocal(m.remote)
+				require.NoError(t, err)
+				assert.Equal(t, m.local, local.ToString())
+				remote, ok := fss.MapToRemote(local)
+				assert.True(t, ok)
+				assert.Equal(t, m.remote, remote)
+			}
+			for _, l := range c.notRemote {
+				p, err := zfs.NewDatasetPath(l)
+				require.NoError(t, err)
+				_, ok := fss.MapToRemote(p)
+				assert.False(t, ok, "%s", l)
+			}
+		})
+	}
+}
+
+func TestReceiverConfigClientOverlap(t *testing.T) {
+	root, err := zfs.NewDatasetPath("storage/sink")
+	require.NoError(t, err)
+	conf := func(mappings ...ReceiverClientMapping) ReceiverConfig {
+		return ReceiverConfig{
+			JobID:                      MustMakeJobID("sink"),
+			RootWithoutClientComponent: root,
+			AppendClientIdentity:       true,
+			ClientMappings:             mappings,
+		}
+	}
+
+	// the example from the docs
+	c := conf(
+		ReceiverClientMapping{Client: "db-*", RootTemplate: "storage/sink/databases/${client}"},
+		ReceiverClientMapping{Client: "*", RootTemplate: "storage/sink/hosts/${client}/${source_pool}"},
+	)
+	require.NoError(t, c.Validate())
+	for _, client := range []string{"db-1", "databases", "hosts", "host1"} {
+		assert.NoError(t, c.checkClientOverlap(client), client)
+	}
+
+	c = conf(
+		ReceiverClientMapping{Client: "*-corp", RootTemplate: "storage/sink/tenants/${client}"},
+		ReceiverClientMapping{Client: "db", RootTemplate: "storage/sink/db/${source_pool}"},
+		ReceiverClientMapping{Client: "*", RootTemplate: "storage/sink/${source_pool}-${client}"},
+	)
+	require.NoError(t, c.Validate())
+	assert.NoError(t, c.checkClientOverlap("a-corp"))
+	assert.NoError(t, c.checkClientOverlap("db"))
+	assert.NoError(t, c.checkClientOverlap("host1"))
+	// pool tank of client web1 would be received to storage/sink/tank-web1, too
+	c = conf(
+		ReceiverClientMapping{Client: "corp", RootTemplate: "storage/sink/tank-web1"},
+		ReceiverClientMapping{Client: "*", RootTemplate: "storage/sink/${source_pool}-${client}"},
+	)
+	assert.Error(t, c.Validate())
+
+	// the root of the unmapped client tenants contains those of the mapped clients
+	c = conf(ReceiverClientMapping{Client: "*-corp", RootTemplate: "storage/sink/tenants/${client}"})
+	require.NoError(t, c.Validate())
+	assert.Error(t, c.checkClientOverlap("a-corp"))
+	assert.Error(t, c.checkClientOverlap("tenants"))
+	assert.NoError(t, c.checkClientOverlap("host1"))
+
+	invalid := [][]ReceiverClientMapping{
+		{{Client: "bob", RootTemplate: "storage/sink/tenants/bob"}},
+		{
+			{Client: "bob", RootTemplate: "storage/sink/alice/bob"},
+			{Client: "alice", RootTemplate: "storage/sink/alice"},
+		},
+		{
+			{Client: "alice", RootTemplate: "storage/sink/shared"},
+			{Client: "bob", RootTemplate: "storage/sink/shared"},
+			{Client: "shared", RootTemplate: "storage/sink/other/shared"},
+		},
+	}
+	for _, mappings := range invalid {
+		c := conf(mappings...)
+		assert.Error(t, c.Validate(), "%#v", mappings)
+	}
+}
@@ -0,0 +1,63 @@
+package endpoint
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+// The daemon-wide limits on concurrently running zfs send and zfs recv processes, nil means unlimited.
+//
+// Sends and receives are limited separately because a local replication
+// (push job to sink job in the same daemon) holds a send slot while it waits for its receive slot.
+// With a shared limit, concurrent local replications could hold all slots with their sends
+// and wait for their receives forever.
+var (
+	globalSendSemaphore *semaphore.S
+	globalRecvSemaphore *semaphore.S
+)
+
+// SetMaxConcurrentSendRecv limits the number of zfs send and zfs recv processes
+// that run concurrently across all Senders and Receivers of this process.
+// 0 means unlimited.
+//
+// Must be called before any other function in this package is used,
+// i.e., during daemon initialization.
+func SetMaxConcurrentSendRecv(send, recv int) error {
+	if send < 0 || recv < 0 {
+		return errors.New("limits must not be negative")
+	}
+	globalSendSemaphore, globalRecvSemaphore = nil, nil
+	if send > 0 {
+		globalSendSemaphore = semaphore.New(int64(send))
+	}
+	if recv > 0 {
+		globalRecvSemaphore = semaphore.New(int64(recv))
+	}
+	return nil
+}
+
+// acquireGlobal returns a nil guard if s is nil.
+// AcquireGuard.Release is a no-op for a nil guard.
+func acquireGlobal(ctx context.Context, s *semaphore.S) (*semaphore.AcquireGuard, error) {
+	if s == nil {
+		return nil, nil
+	}
+	getLogger(ctx).Debug("acquire daemon-wide concurrency semaphore")
+	return s.Acquire(ctx)
+}
+
+// guardedReadCloser releases guard when the stream is closed,
+// so that a send counts towards the limit (or holds its filesystem lock) for as long as its stream is consumed.
+type guardedReadCloser struct {
+	io.ReadCloser
+	guard interface{ Release() }
+}
+
+func (r *guardedReadCloser) Close() error {
+	defer r.guard.Release()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,48 @@
+package endpoint
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+)
+
+func TestSetMaxConcurrentSendRecv(t *testing.T) {
+	defer func() { require.NoError(t, SetMaxConcurrentSendRecv(0, 0)) }()
+
+	assert.Error(t, SetMaxConcurrentSendRecv(-1, 0))
+	require.NoError(t, SetMaxConcurrentSendRecv(0, 0))
+	assert.Nil(t, globalSendSemaphore)
+	assert.Nil(t, globalRecvSemaphore)
+
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+	guard, err := acquireGlobal(ctx, globalSendSemaphore)
+	require.NoError(t, err)
+	guard.Release() // no-op for unlimited
+
+	require.NoError(t, SetMaxConcurrentSendRecv(1, 0))
+	require.NotNil(t, globalSendSemaphore)
+	assert.Nil(t, globalRecvSemaphore)
+
+	guard, err = acquireGlobal(ctx, globalSendSemaphore)
+	require.NoError(t, err)
+	stream := &guardedReadCloser{ioutil.NopCloser(strings.NewReader("data")), guard}
+
+	// the slot is held until the stream is closed
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = acquireGlobal(timeoutCtx, globalSendSemaphore)
+	assert.Error(t, err)
+
+	require.NoError(t, stream.Close())
+	guard, err = acquireGlobal(ctx, globalSendSemaphore)
+	require.NoError(t, err)
+	guard.Release()
+}
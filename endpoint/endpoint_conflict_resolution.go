@@ -0,0 +1,118 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+const divergentSnapshotPrefix = "zrepl_divergent_"
+
+const divergentTimeFormat = "20060102_150405.000"
+
+// DivergentFilesystemName returns the name under which the divergent state of fs is set aside at time t.
+func DivergentFilesystemName(fs string, t time.Time) string {
+	return fmt.Sprintf("%s.zrepl.divergent-%s", fs, t.UTC().Format(divergentTimeFormat))
+}
+
+// setAsideDivergentState resets fs to its snapshot rollbackTo without destroying any data:
+//
+//   1. The current state of fs is snapshotted, including changes that are not in any snapshot yet.
+//   2. fs is renamed to DivergentFilesystemName(fs), taking all of its snapshots along.
+//   3. A clone of the renamed filesystem's snapshot rollbackTo is created as fs and promoted,
+//      which moves rollbackTo and all older snapshots to the new fs.
+//   4. Child filesystems are moved back below the new fs.
+//
+// Afterwards, the set-aside filesystem only holds the snapshots newer than rollbackTo
+// and the divergent state, and fs can receive incremental sends from rollbackTo.
+//
+// The caller must hold recvParentCreationMtx.
+func setAsideDivergentState(ctx context.Context, fs *zfs.DatasetPath, rollbackTo *pdu.FilesystemVersion) error {
+	log := getLogger(ctx).WithField("fs", fs.ToString()).WithField("rollback_to", rollbackTo.RelName())
+
+	if rollbackTo.Type != pdu.FilesystemVersion_Snapshot {
+		return fmt.Errorf("can only roll back to snapshots, got %s", rollbackTo.RelName())
+	}
+	versions, err := zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return errors.Wrap(err, "cannot list snapshots")
+	}
+	var target *zfs.FilesystemVersion
+	for i := range versions {
+		if versions[i].Guid == rollbackTo.Guid {
+			target = &versions[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("snapshot %s (guid %v) does not exist on receiver", rollbackTo.RelName(), rollbackTo.Guid)
+	}
+
+	now := time.Now()
+	asideName := DivergentFilesystemName(fs.ToString(), now)
+	aside, err := zfs.NewDatasetPath(asideName)
+	if err != nil {
+		return errors.Wrap(err, "invalid name for set-aside filesystem")
+	}
+	log = log.WithField("set_aside_fs", asideName)
+
+	// safety check: all divergent data must be in a snapshot before we touch anything
+	safetySnap := divergentSnapshotPrefix + now.UTC().Format(divergentTimeFormat)
+	log.WithField("snapshot", safetySnap).Info("snapshot divergent state")
+	if err := zfs.ZFSSnapshot(ctx, fs, safetySnap, false); err != nil {
+		return errors.Wrap(err, "cannot snapshot divergent state")
+	}
+	if _, err := zfs.ZFSGetGUID(ctx, fs.ToString(), "@"+safetySnap); err != nil {
+		return errors.Wrap(err, "cannot verify snapshot of divergent state")
+	}
+
+	log.Info("set aside divergent filesystem")
+	if err := zfs.ZFSRename(ctx, fs, aside); err != nil {
+		return errors.Wrap(err, "cannot rename divergent filesystem")
+	}
+
+	log.Info("clone common snapshot")
+	if err := zfs.ZFSClone(ctx, aside, *target, fs); err != nil {
+		log.WithError(err).Error("cannot clone common snapshot, renaming set-aside filesystem back")
+		if renameErr := zfs.ZFSRename(ctx, aside, fs); renameErr != nil {
+			log.WithError(renameErr).Error("cannot rename set-aside filesystem back, manual intervention required")
+		}
+		return errors.Wrap(err, "cannot clone common snapshot")
+	}
+
+	log.Info("promote clone")
+	if err := zfs.ZFSPromote(ctx, fs); err != nil {
+		log.WithError(err).Error("cannot promote clone, manual intervention required")
+		return errors.Wrapf(err, "cannot promote clone of %s", target.ToAbsPath(aside))
+	}
+
+	children, err := zfs.ZFSList(ctx, []string{"name"}, "-r", "-d", "1", "-t", "filesystem,volume", asideName)
+	if err != nil {
+		return errors.Wrap(err, "cannot list children of set-aside filesystem, move them back manually")
+	}
+	for _, c := range children {
+		if c[0] == asideName {
+			continue
+		}
+		from, err := zfs.NewDatasetPath(c[0])
+		if err != nil {
+			return err
+		}
+		to, err := zfs.NewDatasetPath(fs.ToString() + "/" + path.Base(c[0]))
+		if err != nil {
+			return err
+		}
+		log.WithField("child", from.ToString()).Info("move child filesystem back")
+		if err := zfs.ZFSRename(ctx, from, to); err != nil {
+			return errors.Wrapf(err, "cannot move child filesystem %s back", from.ToString())
+		}
+	}
+
+	log.Info("divergent state set aside, filesystem reset to common snapshot")
+	return nil
+}
@@ -0,0 +1,79 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// DownstreamJob is a job on the receiving host that replicates the received filesystems further,
+// i.e., the job B→C in a cascading replication setup A→B→C where the Receiver is on B.
+//
+// The Receiver does not destroy snapshots that the downstream job has not replicated yet
+// (see Receiver.DestroySnapshots) and reports the downstream job's replication cursor
+// in ListFilesystems so that the upstream job can show the lag of the entire chain.
+type DownstreamJob struct {
+	JobID JobID
+	// the downstream job's filesystems, in terms of the receiving host's dataset names
+	FSF zfs.DatasetFilter
+}
+
+// downstreamCursors returns the replication cursors of the downstream jobs that replicate local filesystem lp.
+// A nil Cursor means that the downstream job has not replicated lp yet.
+func (s *Receiver) downstreamCursors(ctx context.Context, lp *zfs.DatasetPath) ([]*pdu.DownstreamCursor, error) {
+	var cursors []*pdu.DownstreamCursor
+	for _, d := range s.conf.Downstream {
+		pass, err := d.FSF.Filter(lp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot filter filesystem %q for downstream job %q", lp.ToString(), d.JobID)
+		}
+		if !pass {
+			continue
+		}
+		cursor, err := GetMostRecentReplicationCursorOfJob(ctx, lp.ToString(), d.JobID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get replication cursor of downstream job %q", d.JobID)
+		}
+		c := &pdu.DownstreamCursor{Job: d.JobID.String()}
+		if cursor != nil {
+			c.Cursor = pdu.FilesystemVersionFromZFS(cursor)
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, nil
+}
+
+// keepForDownstream splits snaps into the snapshots that may be destroyed and the ones
+// that must be kept because a downstream job has not replicated them yet.
+func (s *Receiver) keepForDownstream(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (destroy []*pdu.FilesystemVersion, kept []*pdu.DestroySnapshotRes, err error) {
+	if len(s.conf.Downstream) == 0 {
+		return snaps, nil, nil
+	}
+	cursors, err := s.downstreamCursors(ctx, lp)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, snap := range snaps {
+		if snap.Type != pdu.FilesystemVersion_Snapshot {
+			destroy = append(destroy, snap) // downstream jobs replicate snapshots only
+			continue
+		}
+		reason := ""
+		for _, c := range cursors {
+			if c.Cursor == nil || snap.GetCreateTXG() > c.Cursor.GetCreateTXG() {
+				reason = fmt.Sprintf("not yet replicated by downstream job %q", c.Job)
+				break
+			}
+		}
+		if reason == "" {
+			destroy = append(destroy, snap)
+		} else {
+			kept = append(kept, &pdu.DestroySnapshotRes{Snapshot: snap, KeptReason: reason})
+		}
+	}
+	return destroy, kept, nil
+}
@@ -0,0 +1,249 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// FilesystemOp is an operation on a filesystem that is coordinated through the process-wide filesystem locks,
+// see LockFilesystems.
+//
+// Jobs with overlapping filesystems (e.g., a snap job and a push job, or a sink job that
+// receives into a filesystem that a push job sends) run their operations independently of each other.
+// The locks serialize those operations that must not run concurrently on the same filesystem:
+//
+//   - OpDestroySnapshots conflicts with every operation, so that a prune never destroys snapshots
+//     while they are being sent, received or created.
+//   - OpSnapshot and OpReceive conflict with themselves and each other.
+//   - OpSend does not conflict with OpSend, OpSnapshot or OpReceive.
+//
+// Deadlock freedom: LockFilesystems acquires the locks of multiple filesystems in the order of their names.
+// The only lock that is held while another one is acquired is OpSend,
+// whose stream is consumed by a receive (of a local replication) that acquires OpReceive.
+// OpSend only conflicts with OpDestroySnapshots, whose holders never wait for other locks.
+type FilesystemOp int
+
+const (
+	OpSnapshot FilesystemOp = 1 + iota
+	OpSend
+	OpReceive
+	OpDestroySnapshots
+)
+
+func (o FilesystemOp) String() string {
+	switch o {
+	case OpSnapshot:
+		return "snapshot"
+	case OpSend:
+		return "send"
+	case OpReceive:
+		return "receive"
+	case OpDestroySnapshots:
+		return "destroy_snapshots"
+	default:
+		return fmt.Sprintf("FilesystemOp(%d)", int(o))
+	}
+}
+
+func (o FilesystemOp) conflictsWith(other FilesystemOp) bool {
+	if o == OpDestroySnapshots || other == OpDestroySnapshots {
+		return true
+	}
+	if o == OpSend || other == OpSend {
+		return false
+	}
+	return true // OpSnapshot and OpReceive
+}
+
+type fsLockHolder struct {
+	op    FilesystemOp
+	since time.Time
+}
+
+type fsLockState struct {
+	holders []*fsLockHolder
+	// closed and replaced whenever a holder releases the lock
+	released chan struct{}
+}
+
+func (s *fsLockState) conflicting(op FilesystemOp) *fsLockHolder {
+	for _, h := range s.holders {
+		if h.op.conflictsWith(op) {
+			return h
+		}
+	}
+	return nil
+}
+
+// FilesystemLocks is a set of per-filesystem locks, see FilesystemOp for the semantics.
+// The zero value is not usable, use NewFilesystemLocks.
+type FilesystemLocks struct {
+	mtx sync.Mutex
+	fss map[string]*fsLockState
+	// per filesystem, the number of released locks of operations that change its versions, see modifiedSince
+	modifications map[string]uint64
+}
+
+func NewFilesystemLocks() *FilesystemLocks {
+	return &FilesystemLocks{
+		fss:           make(map[string]*fsLockState),
+		modifications: make(map[string]uint64),
+	}
+}
+
+// all operations but OpSend create or destroy snapshots
+func (o FilesystemOp) modifiesVersions() bool { return o != OpSend }
+
+// modificationCount returns the value to pass to modifiedSince.
+func (l *FilesystemLocks) modificationCount(fs string) uint64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.modifications[fs]
+}
+
+// modifiedSince returns true if an operation that changes the versions of fs
+// is running or has completed since count was obtained from modificationCount.
+func (l *FilesystemLocks) modifiedSince(fs string, count uint64) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.modifications[fs] != count {
+		return true
+	}
+	if s, ok := l.fss[fs]; ok {
+		for _, h := range s.holders {
+			if h.op.modifiesVersions() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilesystemLockGuard holds the locks acquired by a call to FilesystemLocks.Lock.
+// Release is idempotent and a no-op for a nil guard.
+type FilesystemLockGuard struct {
+	l       *FilesystemLocks
+	fss     []string
+	holders []*fsLockHolder
+	once    sync.Once
+}
+
+var fsLockWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "zrepl",
+	Subsystem: "endpoint",
+	Name:      "filesystem_lock_wait_seconds",
+	Help:      "Seconds that operations waited for conflicting operations on the same filesystem",
+}, []string{"op"})
+
+// Lock blocks until op may run on all fss or ctx is done.
+// The locks are acquired in the order of the filesystem names, duplicates in fss are ignored.
+func (l *FilesystemLocks) Lock(ctx context.Context, op FilesystemOp, fss ...*zfs.DatasetPath) (*FilesystemLockGuard, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	names := make([]string, 0, len(fss))
+	seen := make(map[string]bool, len(fss))
+	for _, fs := range fss {
+		n := fs.ToString()
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	g := &FilesystemLockGuard{l: l}
+	for _, fs := range names {
+		h, err := l.lockOne(ctx, op, fs)
+		if err != nil {
+			g.Release()
+			return nil, err
+		}
+		g.fss = append(g.fss, fs)
+		g.holders = append(g.holders, h)
+	}
+	return g, nil
+}
+
+func (l *FilesystemLocks) lockOne(ctx context.Context, op FilesystemOp, fs string) (*fsLockHolder, error) {
+	var waitStart time.Time
+	for {
+		l.mtx.Lock()
+		s, ok := l.fss[fs]
+		if !ok {
+			s = &fsLockState{released: make(chan struct{})}
+			l.fss[fs] = s
+		}
+		c := s.conflicting(op)
+		if c == nil {
+			h := &fsLockHolder{op: op, since: time.Now()}
+			s.holders = append(s.holders, h)
+			l.mtx.Unlock()
+			if !waitStart.IsZero() {
+				fsLockWaitDuration.WithLabelValues(op.String()).Observe(time.Since(waitStart).Seconds())
+				getLogger(ctx).WithField("fs", fs).WithField("op", op.String()).
+					WithField("waited", time.Since(waitStart).String()).
+					Info("acquired filesystem lock")
+			}
+			return h, nil
+		}
+		released := s.released
+		l.mtx.Unlock()
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+		getLogger(ctx).WithField("fs", fs).WithField("op", op.String()).
+			WithField("conflicting_op", c.op.String()).
+			WithField("conflicting_since", c.since).
+			Info("waiting for conflicting operation on filesystem to complete")
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (g *FilesystemLockGuard) Release() {
+	if g == nil {
+		return
+	}
+	g.once.Do(func() {
+		g.l.mtx.Lock()
+		defer g.l.mtx.Unlock()
+		for i, fs := range g.fss {
+			s := g.l.fss[fs]
+			for j, h := range s.holders {
+				if h == g.holders[i] {
+					s.holders = append(s.holders[:j], s.holders[j+1:]...)
+					break
+				}
+			}
+			if g.holders[i].op.modifiesVersions() {
+				g.l.modifications[fs]++
+			}
+			close(s.released)
+			if len(s.holders) == 0 {
+				delete(g.l.fss, fs)
+			} else {
+				s.released = make(chan struct{})
+			}
+		}
+	})
+}
+
+var filesystemLocks = NewFilesystemLocks()
+
+// LockFilesystems acquires the process-wide locks of fss for op, see FilesystemLocks.Lock.
+// The caller must release the returned guard when the operation is complete.
+func LockFilesystems(ctx context.Context, op FilesystemOp, fss ...*zfs.DatasetPath) (*FilesystemLockGuard, error) {
+	return filesystemLocks.Lock(ctx, op, fss...)
+}
@@ -0,0 +1,118 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestFilesystemOpConflicts(t *testing.T) {
+	ops := []FilesystemOp{OpSnapshot, OpSend, OpReceive, OpDestroySnapshots}
+	conflicts := map[FilesystemOp][]FilesystemOp{
+		OpSnapshot:         {OpSnapshot, OpReceive, OpDestroySnapshots},
+		OpSend:             {OpDestroySnapshots},
+		OpReceive:          {OpSnapshot, OpReceive, OpDestroySnapshots},
+		OpDestroySnapshots: ops,
+	}
+	for _, a := range ops {
+		for _, b := range ops {
+			exp := false
+			for _, c := range conflicts[a] {
+				exp = exp || c == b
+			}
+			assert.Equal(t, exp, a.conflictsWith(b), "%s %s", a, b)
+			assert.Equal(t, a.conflictsWith(b), b.conflictsWith(a), "symmetric %s %s", a, b)
+		}
+	}
+}
+
+func TestFilesystemLocks(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	mustPath := func(s string) *zfs.DatasetPath {
+		p, err := zfs.NewDatasetPath(s)
+		require.NoError(t, err)
+		return p
+	}
+	a, b := mustPath("pool/a"), mustPath("pool/b")
+
+	l := NewFilesystemLocks()
+
+	tryLock := func(op FilesystemOp, fss ...*zfs.DatasetPath) (*FilesystemLockGuard, error) {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		return l.Lock(ctx, op, fss...)
+	}
+
+	// sends share the lock
+	send1, err := l.Lock(ctx, OpSend, a)
+	require.NoError(t, err)
+	send2, err := tryLock(OpSend, a)
+	require.NoError(t, err)
+
+	// a prune waits for both sends
+	_, err = tryLock(OpDestroySnapshots, a, b)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// ... and did not keep the lock of b that it acquired before it waited for a
+	recv, err := tryLock(OpReceive, b)
+	require.NoError(t, err)
+	recv.Release()
+
+	destroyed := make(chan *FilesystemLockGuard)
+	go func() {
+		g, err := l.Lock(ctx, OpDestroySnapshots, b, a, a) // sorted and deduplicated
+		assert.NoError(t, err)
+		destroyed <- g
+	}()
+	send1.Release()
+	send1.Release() // idempotent
+	select {
+	case <-destroyed:
+		t.Fatal("destroy must wait for the second send")
+	case <-time.After(20 * time.Millisecond):
+	}
+	send2.Release()
+	destroy := <-destroyed
+
+	_, err = tryLock(OpSend, a)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	destroy.Release()
+
+	snap, err := tryLock(OpSnapshot, a)
+	require.NoError(t, err)
+	snap.Release()
+
+	assert.Empty(t, l.fss)
+}
+
+func TestFilesystemLocksModifiedSince(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+	a, err := zfs.NewDatasetPath("pool/a")
+	require.NoError(t, err)
+
+	l := NewFilesystemLocks()
+	count := l.modificationCount("pool/a")
+	assert.False(t, l.modifiedSince("pool/a", count))
+
+	// sends do not change the versions
+	g, err := l.Lock(ctx, OpSend, a)
+	require.NoError(t, err)
+	g.Release()
+	assert.False(t, l.modifiedSince("pool/a", count))
+
+	g, err = l.Lock(ctx, OpSnapshot, a)
+	require.NoError(t, err)
+	assert.True(t, l.modifiedSince("pool/a", count), "while running")
+	g.Release()
+	assert.True(t, l.modifiedSince("pool/a", count), "after completion")
+	assert.False(t, l.modifiedSince("pool/a", l.modificationCount("pool/a")))
+	assert.False(t, l.modifiedSince("pool/b", l.modificationCount("pool/b")))
+}
@@ -68,8 +68,9 @@ const (
 )
 
 type ReplicationGuaranteeStrategy interface {
+	// clientIdentity is not nil if step holds shall be put on behalf of a client
 	Kind() ReplicationGuaranteeKind
-	SenderPreSend(ctx context.Context, jid JobID, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error)
+	SenderPreSend(ctx context.Context, jid JobID, clientIdentity *string, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error)
 	ReceiverPostRecv(ctx context.Context, jid JobID, fs string, toRecvd zfs.FilesystemVersion) (keep []Abstraction, err error)
 	SenderPostRecvConfirmed(ctx context.Context, jid JobID, fs string, to zfs.FilesystemVersion) (keep []Abstraction, err error)
 }
@@ -93,7 +94,7 @@ func (g ReplicationGuaranteeNone) Kind() ReplicationGuaranteeKind {
 	return ReplicationGuaranteeKindNone
 }
 
-func (g ReplicationGuaranteeNone) SenderPreSend(ctx context.Context, jid JobID, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
+func (g ReplicationGuaranteeNone) SenderPreSend(ctx context.Context, jid JobID, clientIdentity *string, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
 	return nil, nil
 }
 
@@ -111,7 +112,10 @@ func (g ReplicationGuaranteeIncremental) Kind() ReplicationGuaranteeKind {
 	return ReplicationGuaranteeKindIncremental
 }
 
-func (g ReplicationGuaranteeIncremental) SenderPreSend(ctx context.Context, jid JobID, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
+func (g ReplicationGuaranteeIncremental) SenderPreSend(ctx context.Context, jid JobID, clientIdentity *string, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
+	if err := checkPoolSupportsBookmarks(ctx, sendArgs.FS, g.Kind()); err != nil {
+		return nil, err
+	}
 	if sendArgs.FromVersion != nil {
 		from, err := CreateTentativeReplicationCursor(ctx, sendArgs.FS, *sendArgs.FromVersion, jid)
 		if err != nil {
@@ -148,14 +152,18 @@ func (g ReplicationGuaranteeResumability) Kind() ReplicationGuaranteeKind {
 	return ReplicationGuaranteeKindResumability
 }
 
-func (g ReplicationGuaranteeResumability) SenderPreSend(ctx context.Context, jid JobID, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
+func (g ReplicationGuaranteeResumability) SenderPreSend(ctx context.Context, jid JobID, clientIdentity *string, sendArgs *zfs.ZFSSendArgsValidated) (keep []Abstraction, err error) {
+	// fail before the step instead of after it, when the replication cursor is moved
+	if err := checkPoolSupportsBookmarks(ctx, sendArgs.FS, g.Kind()); err != nil {
+		return nil, err
+	}
 	// try to hold the FromVersion
 	if sendArgs.FromVersion != nil {
 		if sendArgs.FromVersion.Type == zfs.Bookmark {
 			getLogger(ctx).WithField("replication_guarantee", g).WithField("fromVersion", sendArgs.FromVersion.FullPath(sendArgs.FS)).
 				Debug("cannot hold a bookmark, speculating that `from` will not be destroyed until step is done")
 		} else {
-			from, err := HoldStep(ctx, sendArgs.FS, *sendArgs.FromVersion, jid)
+			from, err := holdStepMaybeProxied(ctx, sendArgs.FS, *sendArgs.FromVersion, jid, clientIdentity)
 			if err != nil {
 				return nil, err
 			}
@@ -164,7 +172,7 @@ func (g ReplicationGuaranteeResumability) SenderPreSend(ctx context.Context, jid
 		// fallthrough
 	}
 
-	to, err := HoldStep(ctx, sendArgs.FS, sendArgs.ToVersion, jid)
+	to, err := holdStepMaybeProxied(ctx, sendArgs.FS, sendArgs.ToVersion, jid, clientIdentity)
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +189,13 @@ func (g ReplicationGuaranteeResumability) SenderPostRecvConfirmed(ctx context.Co
 	return senderPostRecvConfirmedCommon(ctx, jid, fs, to)
 }
 
+func holdStepMaybeProxied(ctx context.Context, fs string, v zfs.FilesystemVersion, jid JobID, clientIdentity *string) (Abstraction, error) {
+	if clientIdentity != nil {
+		return HoldProxiedStep(ctx, fs, v, jid, *clientIdentity)
+	}
+	return HoldStep(ctx, fs, v, jid)
+}
+
 // helper function used by multiple strategies
 func senderPostRecvConfirmedCommon(ctx context.Context, jid JobID, fs string, to zfs.FilesystemVersion) (keep []Abstraction, err error) {
 
@@ -212,3 +227,27 @@ func receiverPostRecvCommon(ctx context.Context, jid JobID, fs string, toRecvd z
 	}
 	return []Abstraction{lrh}, nil
 }
+
+// Returns an error if the pool of fs is known to not support bookmarks,
+// which the replication cursors of guarantee kind require.
+// If the pool's features cannot be determined, we assume support and let
+// the bookmark operations report the error.
+func checkPoolSupportsBookmarks(ctx context.Context, fs string, kind ReplicationGuaranteeKind) error {
+	dp, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		return err
+	}
+	pool, err := dp.Pool()
+	if err != nil {
+		return err
+	}
+	caps, err := zfs.PoolFeatures(ctx, pool)
+	if err != nil {
+		getLogger(ctx).WithError(err).WithField("pool", pool).Warn("cannot determine pool features, assuming support for bookmarks")
+		return nil
+	}
+	if !caps.Bookmarks {
+		return fmt.Errorf("pool %q does not support bookmarks (feature@bookmarks), which replication protection `guarantee_%s` requires for the replication cursor: enable the feature or use `guarantee_nothing`", pool, kind)
+	}
+	return nil
+}
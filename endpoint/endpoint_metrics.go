@@ -1,7 +1,111 @@
 package endpoint
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
 
 func RegisterMetrics(r prometheus.Registerer) {
 	r.MustRegister(abstractionsCacheMetrics.count)
+	r.MustRegister(abstractionsInventoryMetrics.count)
+	r.MustRegister(abstractionsInventoryMetrics.staleCount)
+	r.MustRegister(fsLockWaitDuration)
+}
+
+var abstractionsInventoryMetrics struct {
+	count      *prometheus.GaugeVec
+	staleCount *prometheus.GaugeVec
+}
+
+func init() {
+	abstractionsInventoryMetrics.count = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "abstractions_count",
+		Help:      "number of zrepl abstractions (holds and bookmarks) found on disk during the last inventory run",
+	}, []string{"type", "job"})
+	abstractionsInventoryMetrics.staleCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "abstractions_stale_count",
+		Help:      "number of stale zrepl abstractions (holds and bookmarks) found on disk during the last inventory run",
+	}, []string{"type", "job"})
+}
+
+const abstractionsInventoryMetricsNoJobID = "_nojobid"
+
+// RunAbstractionsInventoryMetrics periodically lists the abstractions on all filesystems
+// using ListStale and exposes the result as Prometheus gauges.
+// It returns when ctx is done.
+func RunAbstractionsInventoryMetrics(ctx context.Context) {
+	interval := envconst.Duration("ZREPL_ENDPOINT_ABSTRACTIONS_METRICS_INTERVAL", 10*time.Minute)
+	if interval <= 0 {
+		getLogger(ctx).Info("abstractions inventory metrics disabled")
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		updateAbstractionsInventoryMetrics(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func updateAbstractionsInventoryMetrics(ctx context.Context) {
+	q := ListZFSHoldsAndBookmarksQuery{
+		FS: ListZFSHoldsAndBookmarksQueryFilesystemFilter{
+			Filter: zfs.NoFilter(),
+		},
+		What:         AbstractionTypesAll,
+		JobID:        nil,
+		Concurrency:  envconst.Int64("ZREPL_ENDPOINT_ABSTRACTIONS_METRICS_CONCURRENCY", 1),
+		AllowPartial: true,
+	}
+	si, err := ListStale(ctx, q)
+	if err != nil {
+		getLogger(ctx).WithError(err).Error("cannot list abstractions for inventory metrics")
+		return
+	}
+	if len(si.ListErrors) > 0 {
+		getLogger(ctx).WithError(ListAbstractionsErrors(si.ListErrors)).Warn("inventory metrics exclude filesystems that could not be listed")
+	}
+
+	type key struct {
+		t   AbstractionType
+		job string
+	}
+	labelsOf := func(a Abstraction) key {
+		k := key{a.GetType(), abstractionsInventoryMetricsNoJobID}
+		if jobID := a.GetJobID(); jobID != nil {
+			k.job = jobID.String()
+		}
+		return k
+	}
+	count := make(map[key]int)
+	stale := make(map[key]int)
+	for _, a := range si.Live {
+		count[labelsOf(a)]++
+	}
+	for _, a := range si.Stale {
+		k := labelsOf(a)
+		count[k]++
+		stale[k]++
+	}
+
+	// reset so that label combinations which no longer exist disappear
+	abstractionsInventoryMetrics.count.Reset()
+	abstractionsInventoryMetrics.staleCount.Reset()
+	for k, n := range count {
+		abstractionsInventoryMetrics.count.WithLabelValues(string(k.t), k.job).Set(float64(n))
+		abstractionsInventoryMetrics.staleCount.WithLabelValues(string(k.t), k.job).Set(float64(stale[k]))
+	}
 }
@@ -0,0 +1,83 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// SendStreamDigest computes the digest of the stream of a plain zfs send (zfs send -w if r.Raw)
+// from r.From (full send if nil) to r.To of r.Filesystem.
+//
+// Unlike Send, it does not create or clean up any replication abstractions (step holds, cursors),
+// so it can be used while replication of the filesystem is in progress.
+func (s *Sender) SendStreamDigest(ctx context.Context, r *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	fsp, err := s.filterCheckFS(r.GetFilesystem())
+	if err != nil {
+		return nil, err
+	}
+	return sendStreamDigest(ctx, fsp, r)
+}
+
+// SendStreamDigest is the receiving side's equivalent of Sender.SendStreamDigest.
+// r.Filesystem is relative to the client's root_fs, like for Receive.
+func (s *Receiver) SendStreamDigest(ctx context.Context, r *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error) {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+
+	clientFSS, err := s.clientFilesystemsFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := clientFSS.MapToLocal(r.GetFilesystem())
+	if err != nil {
+		return nil, err
+	}
+	return sendStreamDigest(ctx, lp, r)
+}
+
+func sendStreamDigest(ctx context.Context, fs *zfs.DatasetPath, r *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error) {
+	sendArgsUnvalidated := zfs.ZFSSendArgsUnvalidated{
+		FS:        fs.ToString(),
+		From:      uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendArgsUnvalidated.Validate
+		To:        uncheckedSendArgsFromPDU(r.GetTo()),
+		Encrypted: &zfs.NilBool{B: false},
+		Raw:       r.GetRaw(),
+	}
+	sendArgs, err := sendArgsUnvalidated.Validate(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "validate send arguments")
+	}
+
+	guard, err := maxConcurrentZFSSendSemaphore.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
+	globalGuard, err := acquireGlobal(ctx, globalSendSemaphore)
+	if err != nil {
+		return nil, err
+	}
+	defer globalGuard.Release()
+	fsGuard, err := LockFilesystems(ctx, OpSend, fs)
+	if err != nil {
+		return nil, err
+	}
+	defer fsGuard.Release()
+
+	stream, err := zfs.ZFSSend(ctx, sendArgs)
+	if err != nil {
+		return nil, errors.Wrap(err, "zfs send failed")
+	}
+	defer stream.Close()
+	digest, n, err := zfs.SendStreamDigest(stream)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compute send stream digest")
+	}
+	return &pdu.SendStreamDigestRes{Digest: digest, StreamSize: n}, nil
+}
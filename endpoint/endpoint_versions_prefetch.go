@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var versionsPrefetchTTL = envconst.Duration("ZREPL_ENDPOINT_LIST_FILESYSTEM_VERSIONS_PREFETCH_TTL", 1*time.Minute)
+
+// The replication planner calls ListFilesystems once and then ListFilesystemVersions
+// for each of the listed filesystems.
+// versionsPrefetch lists the versions of all filesystems in bulk during ListFilesystems
+// (one `zfs list` per pool, see zfs.ZFSListFilesystemVersionsBulk) and hands them out
+// to the subsequent ListFilesystemVersions calls.
+//
+// Each prefetched result is handed out at most once, only within versionsPrefetchTTL,
+// and only if no local snapshot, receive or destroy of the filesystem has run since it was listed
+// (see FilesystemLocks.modifiedSince). All other calls to ListFilesystemVersions list the filesystem as before.
+type versionsPrefetch struct {
+	mtx      sync.Mutex
+	versions map[string]prefetchedVersions
+}
+
+type prefetchedVersions struct {
+	deadline time.Time
+	// see FilesystemLocks.modificationCount
+	modifications uint64
+	versions      []zfs.FilesystemVersion
+}
+
+func (p *versionsPrefetch) fill(ctx context.Context, fss []*zfs.DatasetPath) {
+	if versionsPrefetchTTL <= 0 || len(fss) == 0 {
+		return
+	}
+	// before listing, so that the modifications during the listing invalidate its result
+	modifications := make(map[string]uint64, len(fss))
+	for _, fs := range fss {
+		modifications[fs.ToString()] = filesystemLocks.modificationCount(fs.ToString())
+	}
+	versions, err := zfs.ZFSListFilesystemVersionsBulk(ctx, fss, zfs.ListFilesystemVersionsOptions{})
+	if err != nil {
+		getLogger(ctx).WithError(err).Debug("cannot prefetch filesystem versions")
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	// drop what hasn't been consumed in time, e.g., because the planner failed
+	for fs, v := range p.versions {
+		if now.After(v.deadline) {
+			delete(p.versions, fs)
+		}
+	}
+	if p.versions == nil {
+		p.versions = make(map[string]prefetchedVersions, len(versions))
+	}
+	for fs, v := range versions {
+		m, ok := modifications[fs]
+		if !ok {
+			continue
+		}
+		p.versions[fs] = prefetchedVersions{deadline: now.Add(versionsPrefetchTTL), modifications: m, versions: v}
+	}
+}
+
+func (p *versionsPrefetch) take(fs string) (versions []zfs.FilesystemVersion, ok bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	v, ok := p.versions[fs]
+	if !ok {
+		return nil, false
+	}
+	delete(p.versions, fs)
+	if time.Now().After(v.deadline) || filesystemLocks.modifiedSince(fs, v.modifications) {
+		return nil, false
+	}
+	return v.versions, true
+}
+
+// uses prefetched versions if available, unless userProperties are requested (see pdu.ListFilesystemVersionsReq.UserProperties)
+func (p *versionsPrefetch) listFilesystemVersions(ctx context.Context, fs *zfs.DatasetPath, userProperties []string) ([]zfs.FilesystemVersion, error) {
+	if len(userProperties) > 0 {
+		for _, prop := range userProperties {
+			if err := zfs.ValidateUserPropertyName(prop); err != nil {
+				return nil, err
+			}
+		}
+		return zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{UserProperties: userProperties})
+	}
+	if versions, ok := p.take(fs.ToString()); ok {
+		return versions, nil
+	}
+	return zfs.ZFSListFilesystemVersions(ctx, fs, zfs.ListFilesystemVersionsOptions{})
+}
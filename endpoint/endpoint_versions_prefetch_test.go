@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestVersionsPrefetchTake(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+	fs, err := zfs.NewDatasetPath("pool/prefetch")
+	require.NoError(t, err)
+
+	versions := []zfs.FilesystemVersion{{Type: zfs.Snapshot, Name: "a"}}
+	var p versionsPrefetch
+	put := func(deadline time.Time) {
+		p.versions = map[string]prefetchedVersions{
+			fs.ToString(): {
+				deadline:      deadline,
+				modifications: filesystemLocks.modificationCount(fs.ToString()),
+				versions:      versions,
+			},
+		}
+	}
+
+	put(time.Now().Add(time.Minute))
+	v, ok := p.take(fs.ToString())
+	assert.True(t, ok)
+	assert.Equal(t, versions, v)
+	_, ok = p.take(fs.ToString())
+	assert.False(t, ok, "handed out at most once")
+
+	put(time.Now().Add(-time.Second))
+	_, ok = p.take(fs.ToString())
+	assert.False(t, ok, "expired")
+
+	// a local snapshot invalidates the prefetched versions
+	put(time.Now().Add(time.Minute))
+	g, err := LockFilesystems(ctx, OpSnapshot, fs)
+	require.NoError(t, err)
+	g.Release()
+	_, ok = p.take(fs.ToString())
+	assert.False(t, ok, "modified")
+}
@@ -13,7 +13,6 @@ import (
 
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 	"github.com/zrepl/zrepl/util/envconst"
-	"github.com/zrepl/zrepl/util/semaphore"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -24,6 +23,7 @@ type AbstractionType string
 // When adding a new abstraction type, make sure to search and update them!
 const (
 	AbstractionStepHold                           AbstractionType = "step-hold"
+	AbstractionProxiedStepHold                    AbstractionType = "proxied-step-hold"
 	AbstractionLastReceivedHold                   AbstractionType = "last-received-hold"
 	AbstractionTentativeReplicationCursorBookmark AbstractionType = "tentative-replication-cursor-bookmark-v2"
 	AbstractionReplicationCursorBookmarkV1        AbstractionType = "replication-cursor-bookmark-v1"
@@ -32,6 +32,7 @@ const (
 
 var AbstractionTypesAll = map[AbstractionType]bool{
 	AbstractionStepHold:                           true,
+	AbstractionProxiedStepHold:                    true,
 	AbstractionLastReceivedHold:                   true,
 	AbstractionTentativeReplicationCursorBookmark: true,
 	AbstractionReplicationCursorBookmarkV1:        true,
@@ -46,6 +47,8 @@ type Abstraction interface {
 	GetName() string
 	GetFullPath() string
 	GetJobID() *JobID // may return nil if the abstraction does not have a JobID
+	// may return nil if the abstraction was not created on behalf of a specific client
+	GetClientIdentity() *string
 	GetCreateTXG() uint64
 	GetFilesystemVersion() zfs.FilesystemVersion
 	String() string
@@ -68,11 +71,14 @@ func AbstractionEquals(a, b Abstraction) bool {
 	if bJid := b.GetJobID(); bJid != nil {
 		bJobId = *bJid
 	}
+	aCI, bCI := a.GetClientIdentity(), b.GetClientIdentity()
+	clientIdentityEqual := (aCI == nil && bCI == nil) || (aCI != nil && bCI != nil && *aCI == *bCI)
 	return a.GetType() == b.GetType() &&
 		a.GetFS() == b.GetFS() &&
 		a.GetName() == b.GetName() &&
 		a.GetFullPath() == b.GetFullPath() &&
 		aJobId == bJobId &&
+		clientIdentityEqual &&
 		a.GetCreateTXG() == b.GetCreateTXG() &&
 		zfs.FilesystemVersionEqualIdentity(a.GetFilesystemVersion(), b.GetFilesystemVersion()) &&
 		a.String() == b.String()
@@ -82,6 +88,8 @@ func (t AbstractionType) Validate() error {
 	switch t {
 	case AbstractionStepHold:
 		return nil
+	case AbstractionProxiedStepHold:
+		return nil
 	case AbstractionLastReceivedHold:
 		return nil
 	case AbstractionTentativeReplicationCursorBookmark:
@@ -112,7 +120,8 @@ func (a AbstractionJSON) MarshalJSON() ([]byte, error) {
 		FS                string
 		Name              string
 		FullPath          string
-		JobID             *JobID // may return nil if the abstraction does not have a JobID
+		JobID             *JobID  // may return nil if the abstraction does not have a JobID
+		ClientIdentity    *string // may return nil if the abstraction is not client-specific
 		CreateTXG         uint64
 		FilesystemVersion zfs.FilesystemVersion
 		String            string
@@ -123,6 +132,7 @@ func (a AbstractionJSON) MarshalJSON() ([]byte, error) {
 		Name:              a.Abstraction.GetName(),
 		FullPath:          a.Abstraction.GetFullPath(),
 		JobID:             a.Abstraction.GetJobID(),
+		ClientIdentity:    a.Abstraction.GetClientIdentity(),
 		CreateTXG:         a.Abstraction.GetCreateTXG(),
 		FilesystemVersion: a.Abstraction.GetFilesystemVersion(),
 		String:            a.Abstraction.String(),
@@ -193,6 +203,8 @@ func (t AbstractionType) BookmarkExtractor() BookmarkExtractor {
 		return ReplicationCursorV2Extractor
 	case AbstractionStepHold:
 		return nil
+	case AbstractionProxiedStepHold:
+		return nil
 	case AbstractionLastReceivedHold:
 		return nil
 	default:
@@ -200,6 +212,18 @@ func (t AbstractionType) BookmarkExtractor() BookmarkExtractor {
 	}
 }
 
+// IsAbstractionBookmark returns true if bookmark name of fs is named like one of the bookmark-based abstractions
+// (see BookmarkExtractor) of any job, e.g., a replication cursor.
+// Unlike the extractors, it does not check that the bookmark's guid matches its name.
+func IsAbstractionBookmark(fs, name string) bool {
+	fullname := fmt.Sprintf("%s#%s", fs, name)
+	if _, _, err := ParseReplicationCursorBookmarkName(fullname); err == nil || err == ErrV1ReplicationCursor {
+		return true
+	}
+	_, _, err := ParseTentativeReplicationCursorBookmarkName(fullname)
+	return err == nil
+}
+
 type HoldExtractor = func(fs *zfs.DatasetPath, v zfs.FilesystemVersion, tag string) Abstraction
 
 // returns nil if the abstraction type is not hold-based
@@ -213,6 +237,8 @@ func (t AbstractionType) HoldExtractor() HoldExtractor {
 		return nil
 	case AbstractionStepHold:
 		return StepHoldExtractor
+	case AbstractionProxiedStepHold:
+		return ProxiedStepHoldExtractor
 	case AbstractionLastReceivedHold:
 		return LastReceivedHoldExtractor
 	default:
@@ -230,6 +256,8 @@ func (t AbstractionType) BookmarkNamer() func(fs string, guid uint64, jobId JobI
 		return ReplicationCursorBookmarkName
 	case AbstractionStepHold:
 		return nil
+	case AbstractionProxiedStepHold:
+		return nil
 	case AbstractionLastReceivedHold:
 		return nil
 	default:
@@ -248,11 +276,68 @@ type ListZFSHoldsAndBookmarksQuery struct {
 	// else: JobID of the hold or bookmark can be any value
 	JobID *JobID
 
+	// if not nil: the hold or bookmark must have been created on behalf of the client with this identity
+	// else: the hold or bookmark may or may not be client-specific
+	ClientIdentity *string
+
 	// zero-value means any CreateTXG is acceptable
 	CreateTXG CreateTXGRange
 
-	// Number of concurrently queried filesystems. Must be >= 1
+	// Number of concurrently queried filesystems per pool. Must be >= 1
 	Concurrency int64
+
+	// zero-value means no particular order
+	OrderBy ListZFSHoldsAndBookmarksQueryOrderBy
+
+	// if > 0: at most Limit abstractions are returned (the first ones according to OrderBy)
+	// else: no limit
+	Limit int64
+
+	// Only relevant for ListStale.
+	// If true, filesystems for which the listing failed are excluded from the staleness computation
+	// instead of failing ListStale entirely. The errors are returned in StalenessInfo.ListErrors.
+	AllowPartial bool
+}
+
+type ListZFSHoldsAndBookmarksQueryOrderBy string
+
+const (
+	OrderByNone          ListZFSHoldsAndBookmarksQueryOrderBy = ""
+	OrderByCreateTXGAsc  ListZFSHoldsAndBookmarksQueryOrderBy = "createtxg-asc"
+	OrderByCreateTXGDesc ListZFSHoldsAndBookmarksQueryOrderBy = "createtxg-desc"
+)
+
+func (o ListZFSHoldsAndBookmarksQueryOrderBy) Validate() error {
+	switch o {
+	case OrderByNone:
+		return nil
+	case OrderByCreateTXGAsc:
+		return nil
+	case OrderByCreateTXGDesc:
+		return nil
+	default:
+		return errors.Errorf("unknown order %q", string(o))
+	}
+}
+
+// Sorts abs according to o (stable, ties are broken by full path) and truncates it to limit (if limit > 0).
+func (o ListZFSHoldsAndBookmarksQueryOrderBy) sortAndLimit(abs []Abstraction, limit int64) []Abstraction {
+	if o != OrderByNone {
+		sort.SliceStable(abs, func(i, j int) bool {
+			ti, tj := abs[i].GetCreateTXG(), abs[j].GetCreateTXG()
+			if ti == tj {
+				return abs[i].GetFullPath() < abs[j].GetFullPath()
+			}
+			if o == OrderByCreateTXGDesc {
+				return ti > tj
+			}
+			return ti < tj
+		})
+	}
+	if limit > 0 && int64(len(abs)) > limit {
+		abs = abs[:limit]
+	}
+	return abs
 }
 
 type CreateTXGRangeBound struct {
@@ -285,6 +370,9 @@ func (q *ListZFSHoldsAndBookmarksQuery) Validate() error {
 	if q.JobID != nil {
 		q.JobID.MustValidate() // FIXME
 	}
+	if q.ClientIdentity != nil && *q.ClientIdentity == "" {
+		return errors.New("ClientIdentity must not be empty if set")
+	}
 	if err := q.CreateTXG.Validate(); err != nil {
 		return errors.Wrap(err, "CreateTXGRange")
 	}
@@ -294,9 +382,31 @@ func (q *ListZFSHoldsAndBookmarksQuery) Validate() error {
 	if q.Concurrency < 1 {
 		return errors.New("Concurrency must be >= 1")
 	}
+	if err := q.OrderBy.Validate(); err != nil {
+		return errors.Wrap(err, "OrderBy")
+	}
+	if q.Limit < 0 {
+		return errors.New("Limit must be >= 0")
+	}
 	return nil
 }
 
+func (q *ListZFSHoldsAndBookmarksQuery) matches(a Abstraction) bool {
+	jobIdMatches := q.JobID == nil || a.GetJobID() == nil || *a.GetJobID() == *q.JobID
+
+	clientIdentityMatches := q.ClientIdentity == nil ||
+		(a.GetClientIdentity() != nil && *a.GetClientIdentity() == *q.ClientIdentity)
+
+	createTXGMatches := q.CreateTXG.Contains(a.GetCreateTXG())
+
+	return jobIdMatches && clientIdentityMatches && createTXGMatches
+}
+
+// if true, the results must be buffered per filesystem and merged
+func (q *ListZFSHoldsAndBookmarksQuery) orderedOrLimited() bool {
+	return q.OrderBy != OrderByNone || q.Limit > 0
+}
+
 var createTXGRangeBoundAllowCreateTXG0 = envconst.Bool("ZREPL_ENDPOINT_LIST_ABSTRACTIONS_QUERY_CREATETXG_RANGE_BOUND_ALLOW_0", false)
 
 func (i *CreateTXGRangeBound) Validate() error {
@@ -554,41 +664,73 @@ func ListAbstractionsStreamed(ctx context.Context, query ListZFSHoldsAndBookmark
 		return nil, nil, errors.Wrap(err, "list filesystems")
 	}
 
+	dps := datasetPaths(fss)
+
 	outErrs := make(chan ListAbstractionsError)
 	out := make(chan Abstraction)
 
 	errCb := func(err error, fs string, what string) {
 		outErrs <- ListAbstractionsError{Err: err, FS: fs, What: what}
 	}
+	// merge stage: if the query is ordered or limited, listAbstractionsImplFS
+	// emits the (sorted and limited) results per filesystem, which we merge here
+	var merged struct {
+		mtx sync.Mutex
+		abs []Abstraction
+	}
 	emitAbstraction := func(a Abstraction) {
-		jobIdMatches := query.JobID == nil || a.GetJobID() == nil || *a.GetJobID() == *query.JobID
-
-		createTXGMatches := query.CreateTXG.Contains(a.GetCreateTXG())
-
-		if jobIdMatches && createTXGMatches {
-			out <- a
+		if !query.matches(a) {
+			return
 		}
+		if query.orderedOrLimited() {
+			merged.mtx.Lock()
+			defer merged.mtx.Unlock()
+			merged.abs = append(merged.abs, a)
+			return
+		}
+		out <- a
 	}
 
-	sem := semaphore.New(int64(query.Concurrency))
+	sched := zfs.NewPoolScheduler(query.Concurrency)
 	ctx, endTask := trace.WithTask(ctx, "list-abstractions-streamed-producer")
 	go func() {
 		defer endTask()
 		defer close(out)
 		defer close(outErrs)
 
+		// one `zfs list` per pool instead of one per filesystem
+		// (falls back to per-filesystem listing, which reports errors per filesystem)
+		var bulkVersions map[string][]zfs.FilesystemVersion
+		if len(fss) > 1 && len(query.What) > 0 {
+			bv, err := zfs.ZFSListFilesystemVersionsBulk(ctx, dps, zfs.ListFilesystemVersionsOptions{
+				Types: query.versionTypes(),
+			})
+			if err != nil {
+				getLogger(ctx).WithError(err).Debug("bulk listing of filesystem versions failed, falling back to per-filesystem listing")
+			} else {
+				bulkVersions = bv
+			}
+		}
+
 		_, add, wait := trace.WithTaskGroup(ctx, "list-abstractions-impl-fs")
-		defer wait()
+		defer func() {
+			wait()
+			if query.orderedOrLimited() {
+				for _, a := range query.OrderBy.sortAndLimit(merged.abs, query.Limit) {
+					out <- a
+				}
+			}
+		}()
 		for i := range fss {
 			add(func(ctx context.Context) {
-				g, err := sem.Acquire(ctx)
+				g, err := sched.Acquire(ctx, dps[i])
 				if err != nil {
 					errCb(err, fss[i], err.Error())
 					return
 				}
 				func() {
 					defer g.Release()
-					listAbstractionsImplFS(ctx, fss[i], &query, emitAbstraction, errCb)
+					listAbstractionsImplFS(ctx, fss[i], bulkVersions[fss[i]], &query, emitAbstraction, errCb)
 				}()
 			})
 		}
@@ -597,18 +739,22 @@ func ListAbstractionsStreamed(ctx context.Context, query ListZFSHoldsAndBookmark
 	return out, outErrs, nil
 }
 
-func listAbstractionsImplFS(ctx context.Context, fs string, query *ListZFSHoldsAndBookmarksQuery, emitCandidate putListAbstraction, errCb putListAbstractionErr) {
-	fsp, err := zfs.NewDatasetPath(fs)
-	if err != nil {
-		panic(err)
-	}
-
-	if len(query.What) == 0 {
-		return
+func datasetPaths(fss []string) []*zfs.DatasetPath {
+	dps := make([]*zfs.DatasetPath, len(fss))
+	for i := range fss {
+		dp, err := zfs.NewDatasetPath(fss[i])
+		if err != nil {
+			panic(err)
+		}
+		dps[i] = dp
 	}
+	return dps
+}
 
+// the version types that need to be listed to find the abstractions of q.What
+func (q *ListZFSHoldsAndBookmarksQuery) versionTypes() zfs.VersionTypeSet {
 	whatTypes := zfs.VersionTypeSet{}
-	for what := range query.What {
+	for what := range q.What {
 		if e := what.BookmarkExtractor(); e != nil {
 			whatTypes[zfs.Bookmark] = true
 		}
@@ -616,14 +762,75 @@ func listAbstractionsImplFS(ctx context.Context, fs string, query *ListZFSHoldsA
 			whatTypes[zfs.Snapshot] = true
 		}
 	}
-	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, fsp, zfs.ListFilesystemVersionsOptions{
-		Types: whatTypes,
-	})
+	return whatTypes
+}
+
+// fsvs are the versions of fs of query.versionTypes(), or nil if they shall be listed by this function
+func listAbstractionsImplFS(ctx context.Context, fs string, fsvs []zfs.FilesystemVersion, query *ListZFSHoldsAndBookmarksQuery, emitCandidate putListAbstraction, errCb putListAbstractionErr) {
+	fsp, err := zfs.NewDatasetPath(fs)
 	if err != nil {
-		errCb(err, fs, "list filesystem versions")
+		panic(err)
+	}
+
+	if len(query.What) == 0 {
 		return
 	}
 
+	if query.orderedOrLimited() {
+		// Buffer this filesystem's matches so that only the first query.Limit
+		// of them according to query.OrderBy are passed on to the merge stage.
+		var buf []Abstraction
+		emitSorted := emitCandidate
+		emitCandidate = func(a Abstraction) {
+			if query.matches(a) {
+				buf = append(buf, a)
+			}
+		}
+		defer func() {
+			for _, a := range query.OrderBy.sortAndLimit(buf, query.Limit) {
+				emitSorted(a)
+			}
+		}()
+	}
+
+	if fsvs == nil {
+		fsvs, err = zfs.ZFSListFilesystemVersions(ctx, fsp, zfs.ListFilesystemVersionsOptions{
+			Types: query.versionTypes(),
+		})
+		if err != nil {
+			errCb(err, fs, "list filesystem versions")
+			return
+		}
+	}
+
+	// list the holds of all candidate snapshots in one go
+	holdCandidate := func(v zfs.FilesystemVersion) bool {
+		return v.Type == zfs.Snapshot && query.CreateTXG.Contains(v.GetCreateTXG()) && (!v.UserRefs.Valid || v.UserRefs.Value > 0) // FIXME review v.UserRefsValid
+	}
+	var batchHolds map[string][]string
+	if query.versionTypes()[zfs.Snapshot] {
+		var snaps []string
+		for _, v := range fsvs {
+			if holdCandidate(v) {
+				snaps = append(snaps, v.ToAbsPath(fsp))
+			}
+		}
+		if len(snaps) > 0 {
+			batchHolds, err = zfs.ZFSHoldsBatch(ctx, snaps)
+			if err != nil {
+				// fall back to per-snapshot listing below, which reports errors per snapshot
+				getLogger(ctx).WithError(err).WithField("fs", fs).Debug("batched listing of holds failed")
+				batchHolds = nil
+			}
+		}
+	}
+	holdsOf := func(v zfs.FilesystemVersion) ([]string, error) {
+		if h, ok := batchHolds[v.ToAbsPath(fsp)]; ok {
+			return h, nil
+		}
+		return zfs.ZFSHolds(ctx, fsp.ToString(), v.Name)
+	}
+
 	for at := range query.What {
 		bmE := at.BookmarkExtractor()
 		holdE := at.HoldExtractor()
@@ -636,8 +843,8 @@ func listAbstractionsImplFS(ctx context.Context, fs string, query *ListZFSHoldsA
 					emitCandidate(a)
 				}
 			}
-			if v.Type == zfs.Snapshot && holdE != nil && query.CreateTXG.Contains(v.GetCreateTXG()) && (!v.UserRefs.Valid || v.UserRefs.Value > 0) { // FIXME review v.UserRefsValid
-				holds, err := zfs.ZFSHolds(ctx, fsp.ToString(), v.Name)
+			if holdE != nil && holdCandidate(v) {
+				holds, err := holdsOf(v)
 				if err != nil {
 					errCb(err, v.ToAbsPath(fsp), "get hold on snap")
 					continue
@@ -654,6 +861,8 @@ func listAbstractionsImplFS(ctx context.Context, fs string, query *ListZFSHoldsA
 
 type BatchDestroyResult struct {
 	Abstraction
+	// true if the abstraction was not actually destroyed because BatchDestroy was invoked in dry-run mode
+	DryRun     bool
 	DestroyErr error
 }
 
@@ -666,15 +875,19 @@ func (r BatchDestroyResult) MarshalJSON() ([]byte, error) {
 	}
 	s := struct {
 		Abstraction AbstractionJSON
+		DryRun      bool
 		DestroyErr  string
 	}{
 		AbstractionJSON{r.Abstraction},
+		r.DryRun,
 		err,
 	}
 	return json.Marshal(s)
 }
 
-func BatchDestroy(ctx context.Context, abs []Abstraction) <-chan BatchDestroyResult {
+// If dryRun is true, the returned channel yields the same results as a real run
+// but no abstraction is destroyed (DestroyErr is always nil).
+func BatchDestroy(ctx context.Context, abs []Abstraction, dryRun bool) <-chan BatchDestroyResult {
 	// hold-based batching: per snapshot
 	// bookmark-based batching: none possible via CLI
 	// => not worth the trouble for now, will be worth it once we start using channel programs
@@ -682,10 +895,14 @@ func BatchDestroy(ctx context.Context, abs []Abstraction) <-chan BatchDestroyRes
 	res := make(chan BatchDestroyResult, len(abs))
 	go func() {
 		for _, a := range abs {
-			res <- BatchDestroyResult{
-				a,
-				a.Destroy(ctx),
+			r := BatchDestroyResult{
+				Abstraction: a,
+				DryRun:      dryRun,
 			}
+			if !dryRun {
+				r.DestroyErr = a.Destroy(ctx)
+			}
+			res <- r
 		}
 		close(res)
 	}()
@@ -696,6 +913,9 @@ type StalenessInfo struct {
 	ConstructedWithQuery ListZFSHoldsAndBookmarksQuery
 	Live                 []Abstraction
 	Stale                []Abstraction
+	// The listing errors of the filesystems that were excluded from the staleness computation.
+	// Always empty unless ConstructedWithQuery.AllowPartial is set.
+	ListErrors []ListAbstractionsError
 }
 
 type fsAndJobId struct {
@@ -730,18 +950,64 @@ func ListStale(ctx context.Context, q ListZFSHoldsAndBookmarksQuery) (*Staleness
 		return nil, err
 	}
 	if len(absErr) > 0 {
-		// can't go on here because we can't determine the most recent step
-		return nil, ListAbstractionsErrors(absErr)
+		if !q.AllowPartial {
+			// can't go on here because we can't determine the most recent step
+			return nil, ListAbstractionsErrors(absErr)
+		}
+		qAbs, err = excludeErroredFilesystems(qAbs, absErr)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	si := listStaleFiltering(qAbs, q.CreateTXG.Since)
 	si.ConstructedWithQuery = q
+	si.ListErrors = absErr
 	return si, nil
 }
 
+// Returns the abstractions whose JobID is not in knownJobs.
+// Abstractions without a JobID are never returned because their owner cannot be determined.
+func AbstractionsOfUnknownJobs(abs []Abstraction, knownJobs map[JobID]bool) []Abstraction {
+	var ret []Abstraction
+	for _, a := range abs {
+		if jobID := a.GetJobID(); jobID != nil && !knownJobs[*jobID] {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// Drops all abstractions on filesystems for which absErr contains an error.
+// The most recent step on those filesystems cannot be determined, so any
+// staleness info computed for their abstractions would be unreliable.
+func excludeErroredFilesystems(abs []Abstraction, absErr []ListAbstractionsError) ([]Abstraction, error) {
+	errored := make(map[string]bool, len(absErr))
+	for _, e := range absErr {
+		if e.FS == "" {
+			// not attributable to a filesystem => affects all of them
+			return nil, ListAbstractionsErrors(absErr)
+		}
+		// errors for individual snapshots are reported with the snapshot's full path
+		fs := e.FS
+		if i := strings.IndexAny(fs, "@#"); i != -1 {
+			fs = fs[:i]
+		}
+		errored[fs] = true
+	}
+	ret := make([]Abstraction, 0, len(abs))
+	for _, a := range abs {
+		if !errored[a.GetFS()] {
+			ret = append(ret, a)
+		}
+	}
+	return ret, nil
+}
+
 type fsAjobAtype struct {
 	fsAndJobId
-	Type AbstractionType
+	Type           AbstractionType
+	ClientIdentity string // empty if the abstraction is not client-specific
 }
 
 // For step holds and bookmarks, only those older than the most recent replication cursor
@@ -760,7 +1026,10 @@ func listStaleFiltering(abs []Abstraction, sinceBound *CreateTXGRangeBound) *Sta
 			noJobId = append(noJobId, a)
 			continue
 		}
-		faj := fsAjobAtype{fsAndJobId{a.GetFS(), *a.GetJobID()}, a.GetType()}
+		faj := fsAjobAtype{fsAndJobId: fsAndJobId{a.GetFS(), *a.GetJobID()}, Type: a.GetType()}
+		if ci := a.GetClientIdentity(); ci != nil {
+			faj.ClientIdentity = *ci
+		}
 		l := by[faj]
 		l = append(l, a)
 		by[faj] = l
@@ -855,6 +1124,30 @@ func listStaleFiltering(abs []Abstraction, sinceBound *CreateTXGRangeBound) *Sta
 				}
 			}
 
+		} else if k.Type == AbstractionProxiedStepHold {
+			// The replication cursor is shared by all clients of the job and thus cannot serve
+			// as a cutoff between live and stale.
+			// Instead, the holds on `from` and `to` of the client's most recent step are live,
+			// all older ones are stale.
+
+			// sort descending (highest createtxg first)
+			sort.Slice(l, func(i, j int) bool {
+				return l[i].GetCreateTXG() > l[j].GetCreateTXG()
+			})
+			var liveCreateTXGs []uint64
+			for _, a := range l {
+				txg := a.GetCreateTXG()
+				if len(liveCreateTXGs) == 0 || (len(liveCreateTXGs) < 2 && liveCreateTXGs[len(liveCreateTXGs)-1] != txg) {
+					liveCreateTXGs = append(liveCreateTXGs, txg)
+				}
+				sinceRange := CreateTXGRange{Since: sinceBound}
+				if txg >= liveCreateTXGs[len(liveCreateTXGs)-1] || !sinceRange.Contains(txg) {
+					ret.Live = append(ret.Live, a)
+				} else {
+					ret.Stale = append(ret.Stale, a)
+				}
+			}
+
 		} else if k.Type == AbstractionReplicationCursorBookmarkV2 || k.Type == AbstractionLastReceivedHold {
 			// all but the most recent are stale by definition (we always _move_ them)
 			// NOTE: must not use firstNotStale in this branch, not computed for these types
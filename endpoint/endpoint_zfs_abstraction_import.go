@@ -0,0 +1,133 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+var _ json.Unmarshaler = (*AbstractionJSON)(nil)
+
+// UnmarshalJSON is the inverse of AbstractionJSON.MarshalJSON.
+//
+// The resulting Abstraction reflects the serialized state and need not exist on disk.
+// Use ImportAbstraction to re-create it.
+func (a *AbstractionJSON) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Type              AbstractionType
+		FS                string
+		JobID             *JobID
+		ClientIdentity    *string
+		FilesystemVersion zfs.FilesystemVersion
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if err := v.Type.Validate(); err != nil {
+		return err
+	}
+	if err := zfs.EntityNamecheck(v.FS, zfs.EntityTypeFilesystem); err != nil {
+		return errors.Wrap(err, "invalid FS")
+	}
+	var jobID JobID
+	if v.Type != AbstractionReplicationCursorBookmarkV1 {
+		if v.JobID == nil {
+			return errors.Errorf("abstraction type %s requires a JobID", v.Type)
+		}
+		var err error
+		jobID, err = MakeJobID(v.JobID.jid)
+		if err != nil {
+			return errors.Wrap(err, "invalid JobID")
+		}
+	}
+
+	switch v.Type {
+	case AbstractionStepHold:
+		tag, err := StepHoldTag(jobID)
+		if err != nil {
+			return err
+		}
+		a.Abstraction = &holdBasedAbstraction{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion, Tag: tag, JobID: jobID}
+	case AbstractionProxiedStepHold:
+		if v.ClientIdentity == nil {
+			return errors.Errorf("abstraction type %s requires a ClientIdentity", v.Type)
+		}
+		tag, err := ProxiedStepHoldTag(jobID, *v.ClientIdentity)
+		if err != nil {
+			return err
+		}
+		a.Abstraction = &holdBasedAbstraction{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion, Tag: tag, JobID: jobID, ClientIdentity: v.ClientIdentity}
+	case AbstractionLastReceivedHold:
+		tag, err := LastReceivedHoldTag(jobID)
+		if err != nil {
+			return err
+		}
+		a.Abstraction = &holdBasedAbstraction{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion, Tag: tag, JobID: jobID}
+	case AbstractionTentativeReplicationCursorBookmark:
+		a.Abstraction = &bookmarkBasedAbstraction{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion, JobID: jobID}
+	case AbstractionReplicationCursorBookmarkV2:
+		a.Abstraction = &bookmarkBasedAbstraction{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion, JobID: jobID}
+	case AbstractionReplicationCursorBookmarkV1:
+		a.Abstraction = &ReplicationCursorV1{Type: v.Type, FS: v.FS, FilesystemVersion: v.FilesystemVersion}
+	default:
+		panic(v.Type)
+	}
+	return nil
+}
+
+var ErrImportAbstractionNotSupported = errors.New("abstraction type cannot be imported")
+
+// ImportAbstraction idempotently re-creates the given abstraction on disk.
+//
+// Snapshots and bookmarks are identified by their GUID, not by their name.
+// Hold-based abstractions require the held snapshot to exist.
+// Bookmark-based abstractions are re-created from a snapshot with the bookmark's GUID.
+//
+// Returns ErrImportAbstractionNotSupported for abstraction types that zrepl no longer creates.
+func ImportAbstraction(ctx context.Context, a Abstraction) (Abstraction, error) {
+	fsp, err := zfs.NewDatasetPath(a.GetFS())
+	if err != nil {
+		return nil, err
+	}
+
+	if a.GetType() == AbstractionReplicationCursorBookmarkV1 {
+		return nil, ErrImportAbstractionNotSupported
+	}
+
+	// bookmarks are re-created from the snapshot instead of a bookmark because
+	// bookmark cloning is not supported by all ZFS versions
+	guid := a.GetFilesystemVersion().Guid
+	fsvs, err := zfs.ZFSListFilesystemVersions(ctx, fsp, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+	if err != nil {
+		return nil, errors.Wrap(err, "list filesystem versions")
+	}
+	var target *zfs.FilesystemVersion
+	for i := range fsvs {
+		if fsvs[i].Guid == guid {
+			target = &fsvs[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, errors.Errorf("no snapshot with guid %d on filesystem %q", guid, a.GetFS())
+	}
+
+	jobID := *a.GetJobID()
+	switch a.GetType() {
+	case AbstractionStepHold:
+		return HoldStep(ctx, a.GetFS(), *target, jobID)
+	case AbstractionProxiedStepHold:
+		return HoldProxiedStep(ctx, a.GetFS(), *target, jobID, *a.GetClientIdentity())
+	case AbstractionLastReceivedHold:
+		return CreateLastReceivedHold(ctx, a.GetFS(), *target, jobID)
+	case AbstractionTentativeReplicationCursorBookmark:
+		return CreateTentativeReplicationCursor(ctx, a.GetFS(), *target, jobID)
+	case AbstractionReplicationCursorBookmarkV2:
+		return CreateReplicationCursor(ctx, a.GetFS(), *target, jobID)
+	default:
+		panic(a.GetType())
+	}
+}
@@ -3,19 +3,12 @@ package endpoint
 import (
 	"context"
 	"fmt"
-	"regexp"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/zfs"
 )
 
-const (
-	LastReceivedHoldTagNamePrefix = "zrepl_last_received_J_"
-)
-
-var lastReceivedHoldTagRE = regexp.MustCompile("^zrepl_last_received_J_(.+)$")
-
 var _ HoldExtractor = LastReceivedHoldExtractor
 
 func LastReceivedHoldExtractor(fs *zfs.DatasetPath, v zfs.FilesystemVersion, holdTag string) Abstraction {
@@ -40,9 +33,10 @@ func LastReceivedHoldExtractor(fs *zfs.DatasetPath, v zfs.FilesystemVersion, hol
 
 // err != nil always means that the bookmark is not a step bookmark
 func ParseLastReceivedHoldTag(tag string) (JobID, error) {
-	match := lastReceivedHoldTagRE.FindStringSubmatch(tag)
+	re := abstractionsNamespace.lastReceivedHoldTagRE
+	match := re.FindStringSubmatch(tag)
 	if match == nil {
-		return JobID{}, errors.Errorf("parse last-received-hold tag: does not match regex %s", lastReceivedHoldTagRE.String())
+		return JobID{}, errors.Errorf("parse last-received-hold tag: does not match regex %s", re.String())
 	}
 	jobId, err := MakeJobID(match[1])
 	if err != nil {
@@ -56,7 +50,7 @@ func LastReceivedHoldTag(jobID JobID) (string, error) {
 }
 
 func lastReceivedHoldImpl(jobid string) (string, error) {
-	tag := fmt.Sprintf("%s%s", LastReceivedHoldTagNamePrefix, jobid)
+	tag := fmt.Sprintf("%s%s", abstractionsNamespace.lastReceivedHoldTagPrefix, jobid)
 	if err := zfs.ValidHoldTag(tag); err != nil {
 		return "", err
 	}
@@ -90,3 +84,30 @@ func CreateLastReceivedHold(ctx context.Context, fs string, to zfs.FilesystemVer
 		Tag:               tag,
 	}, nil
 }
+
+// GetMostRecentLastReceivedHoldOfJob returns the snapshot of fs that the most recent last-received-hold of jobID holds.
+// It returns nil for both values if fs has no last-received-hold of jobID.
+func GetMostRecentLastReceivedHoldOfJob(ctx context.Context, fs string, jobID JobID) (*zfs.FilesystemVersion, error) {
+	q := ListZFSHoldsAndBookmarksQuery{
+		FS: ListZFSHoldsAndBookmarksQueryFilesystemFilter{FS: &fs},
+		What: AbstractionTypeSet{
+			AbstractionLastReceivedHold: true,
+		},
+		JobID:       &jobID,
+		Concurrency: 1,
+		OrderBy:     OrderByCreateTXGDesc,
+		Limit:       1,
+	}
+	abs, absErr, err := ListAbstractions(ctx, q)
+	if err != nil {
+		return nil, errors.Wrap(err, "get last-received-hold: list bookmarks and holds")
+	}
+	if len(absErr) > 0 {
+		return nil, ListAbstractionsErrors(absErr)
+	}
+	if len(abs) == 0 {
+		return nil, nil
+	}
+	v := abs[0].GetFilesystemVersion()
+	return &v, nil
+}
@@ -0,0 +1,74 @@
+package endpoint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// The namespace is the common prefix of all hold tags and bookmark names managed by zrepl.
+// Daemons that manage overlapping sets of datasets must use distinct namespaces.
+const AbstractionsNamespaceDefault = "zrepl"
+
+type abstractionsNamespaceT struct {
+	ns                                  string
+	stepHoldTagPrefix                   string
+	stepHoldTagRE                       *regexp.Regexp
+	proxiedStepHoldTagPrefix            string
+	proxiedStepHoldTagRE                *regexp.Regexp
+	lastReceivedHoldTagPrefix           string
+	lastReceivedHoldTagRE               *regexp.Regexp
+	replicationCursorBookmarkNamePrefix string
+	tentativeReplicationCursorPrefix    string
+}
+
+var abstractionsNamespace = makeAbstractionsNamespace(AbstractionsNamespaceDefault)
+
+func makeAbstractionsNamespace(ns string) abstractionsNamespaceT {
+	q := regexp.QuoteMeta(ns)
+	return abstractionsNamespaceT{
+		ns:                                  ns,
+		stepHoldTagPrefix:                   ns + "_STEP_J_",
+		stepHoldTagRE:                       regexp.MustCompile("^" + q + "_STEP_J_(.+)"),
+		proxiedStepHoldTagPrefix:            ns + "_PSTEP_J_",
+		proxiedStepHoldTagRE:                regexp.MustCompile("^" + q + "_PSTEP_J_(.+)_C_(.+)$"),
+		lastReceivedHoldTagPrefix:           ns + "_last_received_J_",
+		lastReceivedHoldTagRE:               regexp.MustCompile("^" + q + "_last_received_J_(.+)$"),
+		replicationCursorBookmarkNamePrefix: ns + "_CURSOR",
+		tentativeReplicationCursorPrefix:    ns + "_CURSORTENTATIVE_",
+	}
+}
+
+func validateAbstractionsNamespace(ns string) error {
+	if ns == "" {
+		return errors.New("must not be empty")
+	}
+	if err := zfs.ComponentNamecheck(ns); err != nil {
+		return errors.Wrap(err, "must be usable as a dataset path component")
+	}
+	if strings.Contains(ns, " ") {
+		return fmt.Errorf("must not contain spaces")
+	}
+	return nil
+}
+
+// SetAbstractionsNamespace changes the namespace of the hold tags and bookmark names
+// created and recognized by this package.
+//
+// Must be called before any other function in this package is used,
+// i.e., during daemon or CLI initialization.
+func SetAbstractionsNamespace(ns string) error {
+	if err := validateAbstractionsNamespace(ns); err != nil {
+		return errors.Wrapf(err, "invalid zfs abstractions namespace %q", ns)
+	}
+	abstractionsNamespace = makeAbstractionsNamespace(ns)
+	return nil
+}
+
+func GetAbstractionsNamespace() string {
+	return abstractionsNamespace.ns
+}
@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// A proxied step hold is a step hold that a sending job (in practice: a source job)
+// puts on behalf of a specific client (in practice: a pull job).
+// In addition to the JobID, the client identity is encoded in the hold tag.
+// Thereby, step holds of different pull clients that replicate from the same
+// source job can be told apart.
+
+func ProxiedStepHoldTag(jobid JobID, clientIdentity string) (string, error) {
+	return proxiedStepHoldTagImpl(jobid.String(), clientIdentity)
+}
+
+func proxiedStepHoldTagImpl(jobid string, clientIdentity string) (string, error) {
+	if clientIdentity == "" {
+		return "", errors.New("client identity must not be empty")
+	}
+	t := fmt.Sprintf("%s%s_C_%s", abstractionsNamespace.proxiedStepHoldTagPrefix, jobid, clientIdentity)
+	if err := zfs.ValidHoldTag(t); err != nil {
+		return "", err
+	}
+	// the tag is only useful if it can be decomposed unambiguously
+	pj, pc, err := parseProxiedStepHoldTagImpl(t)
+	if err != nil {
+		return "", err
+	}
+	if pj != jobid || pc != clientIdentity {
+		return "", errors.Errorf("job id %q and client identity %q cannot be encoded unambiguously in a hold tag", jobid, clientIdentity)
+	}
+	return t, nil
+}
+
+// err != nil always means that the hold is not a proxied step hold
+func ParseProxiedStepHoldTag(tag string) (JobID, string, error) {
+	jobid, clientIdentity, err := parseProxiedStepHoldTagImpl(tag)
+	if err != nil {
+		return JobID{}, "", err
+	}
+	jobID, err := MakeJobID(jobid)
+	if err != nil {
+		return JobID{}, "", errors.Wrap(err, "parse proxied step hold tag: invalid job id field")
+	}
+	return jobID, clientIdentity, nil
+}
+
+func parseProxiedStepHoldTagImpl(tag string) (jobid, clientIdentity string, _ error) {
+	re := abstractionsNamespace.proxiedStepHoldTagRE
+	match := re.FindStringSubmatch(tag)
+	if match == nil {
+		return "", "", fmt.Errorf("parse proxied step hold tag: match regex %q", re)
+	}
+	return match[1], match[2], nil
+}
+
+// idempotently hold `version` on behalf of clientIdentity
+func HoldProxiedStep(ctx context.Context, fs string, v zfs.FilesystemVersion, jobID JobID, clientIdentity string) (Abstraction, error) {
+	if !v.IsSnapshot() {
+		panic(fmt.Sprintf("version must be a snapshot got %#v", v))
+	}
+
+	tag, err := ProxiedStepHoldTag(jobID, clientIdentity)
+	if err != nil {
+		return nil, errors.Wrap(err, "proxied step hold tag")
+	}
+
+	if err := zfs.ZFSHold(ctx, fs, v, tag); err != nil {
+		return nil, errors.Wrap(err, "proxied step hold: zfs")
+	}
+
+	return &holdBasedAbstraction{
+		Type:              AbstractionProxiedStepHold,
+		FS:                fs,
+		Tag:               tag,
+		JobID:             jobID,
+		ClientIdentity:    &clientIdentity,
+		FilesystemVersion: v,
+	}, nil
+}
+
+var _ HoldExtractor = ProxiedStepHoldExtractor
+
+func ProxiedStepHoldExtractor(fs *zfs.DatasetPath, v zfs.FilesystemVersion, holdTag string) Abstraction {
+	if v.Type != zfs.Snapshot {
+		panic("impl error")
+	}
+
+	jobID, clientIdentity, err := ParseProxiedStepHoldTag(holdTag)
+	if err == nil {
+		return &holdBasedAbstraction{
+			Type:              AbstractionProxiedStepHold,
+			FS:                fs.ToString(),
+			Tag:               holdTag,
+			FilesystemVersion: v,
+			JobID:             jobID,
+			ClientIdentity:    &clientIdentity,
+		}
+	}
+	return nil
+}
@@ -11,14 +11,12 @@ import (
 	"github.com/zrepl/zrepl/zfs"
 )
 
-const replicationCursorBookmarkNamePrefix = "zrepl_CURSOR"
-
 func ReplicationCursorBookmarkName(fs string, guid uint64, id JobID) (string, error) {
 	return replicationCursorBookmarkNameImpl(fs, guid, id.String())
 }
 
 func replicationCursorBookmarkNameImpl(fs string, guid uint64, jobid string) (string, error) {
-	return makeJobAndGuidBookmarkName(replicationCursorBookmarkNamePrefix, fs, guid, jobid)
+	return makeJobAndGuidBookmarkName(abstractionsNamespace.replicationCursorBookmarkNamePrefix, fs, guid, jobid)
 }
 
 var ErrV1ReplicationCursor = fmt.Errorf("bookmark name is a v1-replication cursor")
@@ -44,29 +42,27 @@ func ParseReplicationCursorBookmarkName(fullname string) (uint64, JobID, error)
 		// fallthrough to main parser
 	}
 
-	guid, jobID, err := parseJobAndGuidBookmarkName(fullname, replicationCursorBookmarkNamePrefix)
+	guid, jobID, err := parseJobAndGuidBookmarkName(fullname, abstractionsNamespace.replicationCursorBookmarkNamePrefix)
 	if err != nil {
 		err = errors.Wrap(err, "parse replication cursor bookmark name") // no shadow
 	}
 	return guid, jobID, err
 }
 
-const tentativeReplicationCursorBookmarkNamePrefix = "zrepl_CURSORTENTATIVE_"
-
 // v must be validated by caller
 func TentativeReplicationCursorBookmarkName(fs string, guid uint64, id JobID) (string, error) {
 	return tentativeReplicationCursorBookmarkNameImpl(fs, guid, id.String())
 }
 
 func tentativeReplicationCursorBookmarkNameImpl(fs string, guid uint64, jobid string) (string, error) {
-	return makeJobAndGuidBookmarkName(tentativeReplicationCursorBookmarkNamePrefix, fs, guid, jobid)
+	return makeJobAndGuidBookmarkName(abstractionsNamespace.tentativeReplicationCursorPrefix, fs, guid, jobid)
 }
 
 // name is the full bookmark name, including dataset path
 //
 // err != nil always means that the bookmark is not a step bookmark
 func ParseTentativeReplicationCursorBookmarkName(fullname string) (guid uint64, jobID JobID, err error) {
-	guid, jobID, err = parseJobAndGuidBookmarkName(fullname, tentativeReplicationCursorBookmarkNamePrefix)
+	guid, jobID, err = parseJobAndGuidBookmarkName(fullname, abstractionsNamespace.tentativeReplicationCursorPrefix)
 	if err != nil {
 		err = errors.Wrap(err, "parse step bookmark name") // no shadow!
 	}
@@ -140,7 +136,7 @@ func GetReplicationCursors(ctx context.Context, dp *zfs.DatasetPath, jobID JobID
 
 // idempotently create a replication cursor targeting `target`
 //
-// returns ErrBookmarkCloningNotSupported if version is a bookmark and bookmarking bookmarks is not supported by ZFS
+// returns ErrBookmarkCloningNotSupported if version is a bookmark and bookmarking bookmarks is not supported by ZFS or the pool (see zfs.BookmarkCloningSupported)
 func CreateReplicationCursor(ctx context.Context, fs string, target zfs.FilesystemVersion, jobID JobID) (a Abstraction, err error) {
 	return createBookmarkAbstraction(ctx, AbstractionReplicationCursorBookmarkV2, fs, target, jobID)
 }
@@ -252,6 +248,7 @@ func (c ReplicationCursorV1) GetType() AbstractionType                    { retu
 func (c ReplicationCursorV1) GetFS() string                               { return c.FS }
 func (c ReplicationCursorV1) GetFullPath() string                         { return fmt.Sprintf("%s#%s", c.FS, c.GetName()) }
 func (c ReplicationCursorV1) GetJobID() *JobID                            { return nil }
+func (c ReplicationCursorV1) GetClientIdentity() *string                  { return nil }
 func (c ReplicationCursorV1) GetFilesystemVersion() zfs.FilesystemVersion { return c.FilesystemVersion }
 func (c ReplicationCursorV1) MarshalJSON() ([]byte, error) {
 	return json.Marshal(AbstractionJSON{c})
@@ -3,21 +3,18 @@ package endpoint
 import (
 	"context"
 	"fmt"
-	"regexp"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/zfs"
 )
 
-var stepHoldTagRE = regexp.MustCompile("^zrepl_STEP_J_(.+)")
-
 func StepHoldTag(jobid JobID) (string, error) {
 	return stepHoldTagImpl(jobid.String())
 }
 
 func stepHoldTagImpl(jobid string) (string, error) {
-	t := fmt.Sprintf("zrepl_STEP_J_%s", jobid)
+	t := fmt.Sprintf("%s%s", abstractionsNamespace.stepHoldTagPrefix, jobid)
 	if err := zfs.ValidHoldTag(t); err != nil {
 		return "", err
 	}
@@ -26,9 +23,10 @@ func stepHoldTagImpl(jobid string) (string, error) {
 
 // err != nil always means that the bookmark is not a step bookmark
 func ParseStepHoldTag(tag string) (JobID, error) {
-	match := stepHoldTagRE.FindStringSubmatch(tag)
+	re := abstractionsNamespace.stepHoldTagRE
+	match := re.FindStringSubmatch(tag)
 	if match == nil {
-		return JobID{}, fmt.Errorf("parse hold tag: match regex %q", stepHoldTagRE)
+		return JobID{}, fmt.Errorf("parse hold tag: match regex %q", re)
 	}
 	jobID, err := MakeJobID(match[1])
 	if err != nil {
@@ -62,6 +60,89 @@ func HoldStep(ctx context.Context, fs string, v zfs.FilesystemVersion, jobID Job
 
 }
 
+// NewSnapshotStepHolds are the step holds that SnapshotAndHoldStep puts on a new snapshot.
+type NewSnapshotStepHolds struct {
+	// the jobs that replicate the snapshot, must not be empty
+	JobIDs []JobID
+	// If true, the jobs put step holds on behalf of their clients (see SenderConfig.ProxiedStepHolds).
+	// The snapshot is then held for each client that a job replicated fs to before,
+	// as each client releases only its own holds.
+	Proxied bool
+}
+
+// returns the hold tags that SnapshotAndHoldStep puts on a new snapshot of fs
+func (h NewSnapshotStepHolds) tags(ctx context.Context, fs string) (tags []string, _ error) {
+	for _, jobID := range h.JobIDs {
+		var clients []string
+		if h.Proxied {
+			clients = abstractionsCacheSingleton.GetClientIdentitiesByJobIDAndFS(ctx, jobID, fs)
+		}
+		if len(clients) == 0 {
+			// no client replicated fs yet, its first step holds `to` on its own
+			tag, err := StepHoldTag(jobID)
+			if err != nil {
+				return nil, errors.Wrap(err, "step hold tag")
+			}
+			tags = append(tags, tag)
+			continue
+		}
+		for _, ci := range clients {
+			tag, err := ProxiedStepHoldTag(jobID, ci)
+			if err != nil {
+				return nil, errors.Wrap(err, "proxied step hold tag")
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// Creates snapshot fs@name and puts the step holds of holds on it right away
+// (see zfs.ZFSSnapshotAndHold), such that the snapshot is protected from
+// concurrent destroys until it has been replicated by each of holds.JobIDs.
+//
+// A hold is released by the stale-abstraction cleanup in Sender.Send and
+// Sender.SendCompleted once a replication step of its job (and client) has moved past the snapshot.
+func SnapshotAndHoldStep(ctx context.Context, fs *zfs.DatasetPath, name string, holds NewSnapshotStepHolds) error {
+	tags, err := holds.tags(ctx, fs.ToString())
+	if err != nil {
+		return err
+	}
+	if err := zfs.ZFSSnapshotAndHold(ctx, fs, name, tags[0]); err != nil {
+		return err
+	}
+	// the snapshot is already protected by the first hold
+	v, err := zfs.ZFSGetFilesystemVersion(ctx, fs.ToString()+"@"+name)
+	if err != nil {
+		return errors.Wrapf(err, "snapshot %q created but cannot get its version", fs.ToString()+"@"+name)
+	}
+	for _, tag := range tags[1:] {
+		if err := zfs.ZFSHold(ctx, fs.ToString(), v, tag); err != nil {
+			return errors.Wrapf(err, "snapshot %q created but cannot hold it", v.FullPath(fs.ToString()))
+		}
+	}
+	// the cleanup only releases the holds that it knows of
+	for _, tag := range tags {
+		if a := StepHoldExtractor(fs, v, tag); a != nil {
+			abstractionsCacheSingleton.Put(a)
+		} else if a := ProxiedStepHoldExtractor(fs, v, tag); a != nil {
+			abstractionsCacheSingleton.Put(a)
+		}
+	}
+	return nil
+}
+
+// Step holds of snapshots newer than `to` have been put by SnapshotAndHoldStep
+// for future replication steps and must not be released by the cleanup for `to`.
+func isFutureStepHold(a Abstraction, to zfs.FilesystemVersion) bool {
+	switch a.GetType() {
+	case AbstractionStepHold, AbstractionProxiedStepHold:
+		return a.GetCreateTXG() > to.GetCreateTXG()
+	default:
+		return false
+	}
+}
+
 var _ HoldExtractor = StepHoldExtractor
 
 func StepHoldExtractor(fs *zfs.DatasetPath, v zfs.FilesystemVersion, holdTag string) Abstraction {
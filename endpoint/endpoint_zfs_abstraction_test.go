@@ -1,6 +1,9 @@
 package endpoint
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"runtime/debug"
@@ -9,6 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/zrepl/zrepl/daemon/logging/trace"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -232,3 +236,148 @@ func TestCreateTXGRange(t *testing.T) {
 	}
 
 }
+
+func TestAbstractionJSONRoundtrip(t *testing.T) {
+	jobID := MustMakeJobID("foo")
+	stepTag, err := StepHoldTag(jobID)
+	require.NoError(t, err)
+	snap := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "a", Guid: 23, CreateTXG: 42}
+	bm := zfs.FilesystemVersion{Type: zfs.Bookmark, Name: "b", Guid: 23, CreateTXG: 42}
+
+	abs := []Abstraction{
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/ds", FilesystemVersion: snap, Tag: stepTag, JobID: jobID},
+		&bookmarkBasedAbstraction{Type: AbstractionReplicationCursorBookmarkV2, FS: "pool/ds", FilesystemVersion: bm, JobID: jobID},
+		&ReplicationCursorV1{Type: AbstractionReplicationCursorBookmarkV1, FS: "pool/ds", FilesystemVersion: bm},
+	}
+	for _, a := range abs {
+		t.Run(a.String(), func(t *testing.T) {
+			enc, err := json.Marshal(AbstractionJSON{a})
+			require.NoError(t, err)
+			var dec AbstractionJSON
+			require.NoError(t, json.Unmarshal(enc, &dec))
+			assert.True(t, AbstractionEquals(a, dec.Abstraction), "%s != %s", a, dec.Abstraction)
+		})
+	}
+}
+
+func TestExcludeErroredFilesystems(t *testing.T) {
+	jobID := MustMakeJobID("foo")
+	snap := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "a", Guid: 23, CreateTXG: 42}
+	abs := []Abstraction{
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/ok", FilesystemVersion: snap, JobID: jobID},
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/broken", FilesystemVersion: snap, JobID: jobID},
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/brokensnap", FilesystemVersion: snap, JobID: jobID},
+	}
+
+	remaining, err := excludeErroredFilesystems(abs, []ListAbstractionsError{
+		{FS: "pool/broken", What: "list filesystem versions", Err: errors.New("fail")},
+		{FS: "pool/brokensnap@a", What: "get hold on snap", Err: errors.New("fail")},
+	})
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "pool/ok", remaining[0].GetFS())
+
+	_, err = excludeErroredFilesystems(abs, []ListAbstractionsError{{What: "global", Err: errors.New("fail")}})
+	assert.Error(t, err, "errors that cannot be attributed to a filesystem must not be tolerated")
+}
+
+func TestAbstractionsOfUnknownJobs(t *testing.T) {
+	snap := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "a", Guid: 23, CreateTXG: 42}
+	bm := zfs.FilesystemVersion{Type: zfs.Bookmark, Name: "b", Guid: 23, CreateTXG: 42}
+	abs := []Abstraction{
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/ds", FilesystemVersion: snap, JobID: MustMakeJobID("known")},
+		&holdBasedAbstraction{Type: AbstractionStepHold, FS: "pool/ds", FilesystemVersion: snap, JobID: MustMakeJobID("gone")},
+		&ReplicationCursorV1{Type: AbstractionReplicationCursorBookmarkV1, FS: "pool/ds", FilesystemVersion: bm},
+	}
+	unknown := AbstractionsOfUnknownJobs(abs, map[JobID]bool{MustMakeJobID("known"): true})
+	require.Len(t, unknown, 1)
+	assert.Equal(t, MustMakeJobID("gone"), *unknown[0].GetJobID())
+}
+
+func TestQueryOrderByAndLimit(t *testing.T) {
+	mk := func(fs string, createtxg uint64) Abstraction {
+		v := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: fmt.Sprintf("s%d", createtxg), Guid: createtxg, CreateTXG: createtxg}
+		return &holdBasedAbstraction{Type: AbstractionStepHold, FS: fs, FilesystemVersion: v, JobID: MustMakeJobID("foo")}
+	}
+	txgs := func(abs []Abstraction) (ret []uint64) {
+		for _, a := range abs {
+			ret = append(ret, a.GetCreateTXG())
+		}
+		return ret
+	}
+	abs := func() []Abstraction {
+		return []Abstraction{mk("pool/a", 3), mk("pool/b", 1), mk("pool/a", 2), mk("pool/b", 4)}
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3, 4}, txgs(OrderByCreateTXGAsc.sortAndLimit(abs(), 0)))
+	assert.Equal(t, []uint64{4, 3}, txgs(OrderByCreateTXGDesc.sortAndLimit(abs(), 2)))
+	assert.Equal(t, []uint64{3, 1}, txgs(OrderByNone.sortAndLimit(abs(), 2)))
+
+	assert.Error(t, ListZFSHoldsAndBookmarksQueryOrderBy("foo").Validate())
+}
+
+func TestIsAbstractionBookmark(t *testing.T) {
+	jobID := MustMakeJobID("job")
+	cursor, err := ReplicationCursorBookmarkName("pool/fs", 0x1234, jobID)
+	require.NoError(t, err)
+	tentative, err := TentativeReplicationCursorBookmarkName("pool/fs", 0x1234, jobID)
+	require.NoError(t, err)
+
+	assert.True(t, IsAbstractionBookmark("pool/fs", cursor))
+	assert.True(t, IsAbstractionBookmark("pool/fs", tentative))
+	assert.True(t, IsAbstractionBookmark("pool/fs", "zrepl_replication_cursor"))
+	assert.False(t, IsAbstractionBookmark("pool/fs", "zrepl_20200101_000000_000"))
+	assert.False(t, IsAbstractionBookmark("pool/fs", "manual"))
+}
+
+func TestNewSnapshotStepHoldsTags(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+	jobID, otherJobID := MustMakeJobID("foo"), MustMakeJobID("other")
+	client1, client2 := "client1", "client2"
+	v := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "s1", CreateTXG: 10}
+
+	defer func(c *abstractionsCache) { abstractionsCacheSingleton = c }(abstractionsCacheSingleton)
+	abstractionsCacheSingleton = newAbstractionsCache()
+	abstractionsCacheSingleton.didLoadFS["pool/fs"] = abstractionsCacheDidLoadFSStateDone
+	for _, a := range []*holdBasedAbstraction{
+		{Type: AbstractionProxiedStepHold, FS: "pool/fs", JobID: jobID, ClientIdentity: &client2, FilesystemVersion: v},
+		{Type: AbstractionProxiedStepHold, FS: "pool/fs", JobID: jobID, ClientIdentity: &client1, FilesystemVersion: v},
+		{Type: AbstractionProxiedStepHold, FS: "pool/fs", JobID: jobID, ClientIdentity: &client1, FilesystemVersion: v},
+		{Type: AbstractionProxiedStepHold, FS: "pool/fs", JobID: otherJobID, ClientIdentity: &client1, FilesystemVersion: v},
+	} {
+		abstractionsCacheSingleton.Put(a)
+	}
+
+	tags, err := NewSnapshotStepHolds{JobIDs: []JobID{jobID}, Proxied: true}.tags(ctx, "pool/fs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zrepl_PSTEP_J_foo_C_client1", "zrepl_PSTEP_J_foo_C_client2"}, tags)
+
+	// held for the job itself if no client replicated the filesystem yet
+	abstractionsCacheSingleton.didLoadFS["pool/new"] = abstractionsCacheDidLoadFSStateDone
+	tags, err = NewSnapshotStepHolds{JobIDs: []JobID{jobID}, Proxied: true}.tags(ctx, "pool/new")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zrepl_STEP_J_foo"}, tags)
+
+	tags, err = NewSnapshotStepHolds{JobIDs: []JobID{jobID, otherJobID}}.tags(ctx, "pool/fs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zrepl_STEP_J_foo", "zrepl_STEP_J_other"}, tags)
+}
+
+func TestIsFutureStepHold(t *testing.T) {
+	client := "client1"
+	to := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "to", CreateTXG: 10}
+	newer := zfs.FilesystemVersion{Type: zfs.Snapshot, Name: "newer", CreateTXG: 11}
+	hold := func(typ AbstractionType, v zfs.FilesystemVersion) Abstraction {
+		a := &holdBasedAbstraction{Type: typ, FS: "pool/fs", JobID: MustMakeJobID("foo"), FilesystemVersion: v}
+		if typ == AbstractionProxiedStepHold {
+			a.ClientIdentity = &client
+		}
+		return a
+	}
+	assert.True(t, isFutureStepHold(hold(AbstractionStepHold, newer), to))
+	assert.True(t, isFutureStepHold(hold(AbstractionProxiedStepHold, newer), to))
+	assert.False(t, isFutureStepHold(hold(AbstractionStepHold, to), to))
+	assert.False(t, isFutureStepHold(hold(AbstractionProxiedStepHold, to), to))
+	assert.False(t, isFutureStepHold(hold(AbstractionLastReceivedHold, newer), to))
+}
@@ -37,7 +37,7 @@ func TestParseJobAndGuidBookmarkName(t *testing.T) {
 
 	for i := range cases {
 		t.Run(cases[i].input, func(t *testing.T) {
-			guid, jobid, err := parseJobAndGuidBookmarkName(cases[i].input, replicationCursorBookmarkNamePrefix)
+			guid, jobid, err := parseJobAndGuidBookmarkName(cases[i].input, abstractionsNamespace.replicationCursorBookmarkNamePrefix)
 			if cases[i].expectErr {
 				assert.Error(t, err)
 			} else {
@@ -49,3 +49,59 @@ func TestParseJobAndGuidBookmarkName(t *testing.T) {
 	}
 
 }
+
+func TestAbstractionsNamespace(t *testing.T) {
+	defer func() {
+		if err := SetAbstractionsNamespace(AbstractionsNamespaceDefault); err != nil {
+			panic(err)
+		}
+	}()
+
+	jobID := MustMakeJobID("foo")
+	defaultTag, err := StepHoldTag(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, "zrepl_STEP_J_foo", defaultTag)
+
+	assert.Error(t, SetAbstractionsNamespace(""))
+	assert.Error(t, SetAbstractionsNamespace("with space"))
+	assert.NoError(t, SetAbstractionsNamespace("zreplB"))
+
+	tag, err := StepHoldTag(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, "zreplB_STEP_J_foo", tag)
+	parsed, err := ParseStepHoldTag(tag)
+	assert.NoError(t, err)
+	assert.Equal(t, jobID, parsed)
+
+	// abstractions of other instances must not be recognized
+	_, err = ParseStepHoldTag(defaultTag)
+	assert.Error(t, err)
+	_, _, err = ParseReplicationCursorBookmarkName("p1/sync#zrepl_CURSOR_G_932f3a7089080ce2_J_foo")
+	assert.Error(t, err)
+	_, _, err = ParseReplicationCursorBookmarkName("p1/sync#zreplB_CURSOR_G_932f3a7089080ce2_J_foo")
+	assert.NoError(t, err)
+}
+
+func TestProxiedStepHoldTag(t *testing.T) {
+	jobID := MustMakeJobID("foo")
+
+	tag, err := ProxiedStepHoldTag(jobID, "client1")
+	assert.NoError(t, err)
+	assert.Equal(t, "zrepl_PSTEP_J_foo_C_client1", tag)
+
+	parsedJobID, parsedClient, err := ParseProxiedStepHoldTag(tag)
+	assert.NoError(t, err)
+	assert.Equal(t, jobID, parsedJobID)
+	assert.Equal(t, "client1", parsedClient)
+
+	// must not be mistaken for a regular step hold and vice versa
+	_, err = ParseStepHoldTag(tag)
+	assert.Error(t, err)
+	_, _, err = ParseProxiedStepHoldTag("zrepl_STEP_J_foo")
+	assert.Error(t, err)
+
+	_, err = ProxiedStepHoldTag(jobID, "")
+	assert.Error(t, err)
+	_, err = ProxiedStepHoldTag(jobID, "bar_C_baz")
+	assert.Error(t, err, "ambiguous encoding must be rejected")
+}
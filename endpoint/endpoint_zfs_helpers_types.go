@@ -17,9 +17,10 @@ type bookmarkBasedAbstraction struct {
 	JobID JobID
 }
 
-func (b bookmarkBasedAbstraction) GetType() AbstractionType { return b.Type }
-func (b bookmarkBasedAbstraction) GetFS() string            { return b.FS }
-func (b bookmarkBasedAbstraction) GetJobID() *JobID         { return &b.JobID }
+func (b bookmarkBasedAbstraction) GetType() AbstractionType   { return b.Type }
+func (b bookmarkBasedAbstraction) GetFS() string              { return b.FS }
+func (b bookmarkBasedAbstraction) GetJobID() *JobID           { return &b.JobID }
+func (b bookmarkBasedAbstraction) GetClientIdentity() *string { return nil }
 func (b bookmarkBasedAbstraction) GetFullPath() string {
 	return fmt.Sprintf("%s#%s", b.FS, b.Name) // TODO use zfs.FilesystemVersion.ToAbsPath
 }
@@ -47,11 +48,14 @@ type holdBasedAbstraction struct {
 	zfs.FilesystemVersion
 	Tag   string
 	JobID JobID
+	// nil unless the hold was put on behalf of a client
+	ClientIdentity *string
 }
 
-func (h holdBasedAbstraction) GetType() AbstractionType { return h.Type }
-func (h holdBasedAbstraction) GetFS() string            { return h.FS }
-func (h holdBasedAbstraction) GetJobID() *JobID         { return &h.JobID }
+func (h holdBasedAbstraction) GetType() AbstractionType   { return h.Type }
+func (h holdBasedAbstraction) GetFS() string              { return h.FS }
+func (h holdBasedAbstraction) GetJobID() *JobID           { return &h.JobID }
+func (h holdBasedAbstraction) GetClientIdentity() *string { return h.ClientIdentity }
 func (h holdBasedAbstraction) GetFullPath() string {
 	return fmt.Sprintf("%s@%s", h.FS, h.GetName()) // TODO use zfs.FilesystemVersion.ToAbsPath
 }
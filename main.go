@@ -8,9 +8,18 @@ import (
 )
 
 func init() {
+	// the client implements the subcommands that talk to the daemon's control socket
+	daemon.DaemonCmd.SetupSubcommands = func() []*cli.Subcommand {
+		return []*cli.Subcommand{client.DaemonReloadCmd}
+	}
 	cli.AddSubcommand(daemon.DaemonCmd)
+	cli.AddSubcommand(daemon.OneshotCmd)
 	cli.AddSubcommand(client.StatusCmd)
 	cli.AddSubcommand(client.SignalCmd)
+	cli.AddSubcommand(client.SnapshotCmd)
+	cli.AddSubcommand(client.PruneCmd)
+	cli.AddSubcommand(client.BandwidthLimitCmd)
+	cli.AddSubcommand(client.JobsCmd)
 	cli.AddSubcommand(client.StdinserverCmd)
 	cli.AddSubcommand(client.ConfigcheckCmd)
 	cli.AddSubcommand(client.VersionCmd)
@@ -18,6 +27,8 @@ func init() {
 	cli.AddSubcommand(client.TestCmd)
 	cli.AddSubcommand(client.MigrateCmd)
 	cli.AddSubcommand(client.ZFSAbstractionsCmd)
+	cli.AddSubcommand(client.ZFSCmd)
+	cli.AddSubcommand(client.TransportCmd)
 }
 
 func main() {
@@ -27,11 +27,13 @@ var Cases = []Case{BatchDestroy,
 	ReplicationReceiverErrorWhileStillSending,
 	ReplicationStepCompletedLostBehavior__GuaranteeIncrementalReplication,
 	ReplicationStepCompletedLostBehavior__GuaranteeResumability,
+	ReplicationToTargetsReleasesStepHoldsOfNewSnapshots,
 	ResumableRecvAndTokenHandling,
 	ResumeTokenParsing,
 	SendArgsValidationEncryptedSendOfUnencryptedDatasetForbidden__EncryptionSupported_false,
 	SendArgsValidationEncryptedSendOfUnencryptedDatasetForbidden__EncryptionSupported_true,
 	SendArgsValidationResumeTokenDifferentFilesystemForbidden,
 	SendArgsValidationResumeTokenEncryptionMismatchForbidden,
+	SnapshotClonesListedAndDestroyDeferred,
 	UndestroyableSnapshotParsing,
 }
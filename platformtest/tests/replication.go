@@ -15,6 +15,7 @@ import (
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/platformtest"
 	"github.com/zrepl/zrepl/replication"
+	"github.com/zrepl/zrepl/replication/driver"
 	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/replication/report"
@@ -70,10 +71,12 @@ func (i replicationInvocation) Do(ctx *platformtest.Context) *report.Report {
 		ReplicationConfig: pdu.ReplicationConfig{
 			Protection: &i.guarantee,
 		},
+		SizeEstimates: true,
 	}
 
 	report, wait := replication.Do(
 		ctx,
+		driver.Config{StepQueueConcurrency: 1, Retry: driver.DefaultRetryPolicies()},
 		logic.NewPlanner(nil, nil, sender, receiver, plannerPolicy),
 	)
 	wait(true)
@@ -915,3 +918,54 @@ func ReplicationFailingInitialParentProhibitsChildReplication(ctx *platformtest.
 	checkFS(fsAChild, "parent(s) failed during initial replication")
 	checkFS(fsAA, mockRecvErr.Error()) // fsAA is not treated as a child of fsA
 }
+
+// push jobs with `targets` step-hold new snapshots for the job ID of each target,
+// as each target's replication only releases the step holds of its own job ID
+func ReplicationToTargetsReleasesStepHoldsOfNewSnapshots(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		CREATEROOT
+		+  "sender"
+		+  "receiver-a"
+		R  zfs create -p "${ROOTDS}/receiver-a/${ROOTDS}"
+		+  "receiver-b"
+		R  zfs create -p "${ROOTDS}/receiver-b/${ROOTDS}"
+	`)
+
+	targetIDs := []endpoint.JobID{endpoint.MustMakeJobID("push_a"), endpoint.MustMakeJobID("push_b")}
+	sfs := ctx.RootDataset + "/sender"
+
+	stepHolds := func() []endpoint.Abstraction {
+		abs, absErrs, err := endpoint.ListAbstractions(ctx, endpoint.ListZFSHoldsAndBookmarksQuery{
+			FS: endpoint.ListZFSHoldsAndBookmarksQueryFilesystemFilter{
+				FS: &sfs,
+			},
+			Concurrency: 1,
+			What:        endpoint.AbstractionTypeSet{endpoint.AbstractionStepHold: true},
+		})
+		require.NoError(ctx, err)
+		require.Empty(ctx, absErrs)
+		return abs
+	}
+
+	// what the snapper does for a push job with targets a and b
+	err := endpoint.SnapshotAndHoldStep(ctx, mustDatasetPath(sfs), "1", endpoint.NewSnapshotStepHolds{JobIDs: targetIDs})
+	require.NoError(ctx, err)
+	require.Len(ctx, stepHolds(), 2)
+
+	for i, target := range []string{"receiver-a", "receiver-b"} {
+		rep := replicationInvocation{
+			sjid:      targetIDs[i],
+			rjid:      endpoint.MustMakeJobID("receiver-job"),
+			sfs:       sfs,
+			rfsRoot:   ctx.RootDataset + "/" + target,
+			guarantee: *pdu.ReplicationConfigProtectionWithKind(pdu.ReplicationGuaranteeKind_GuaranteeResumability),
+		}
+		report := rep.Do(ctx)
+		ctx.Logf("\n%s", pretty.Sprint(report))
+		_ = fsversion(ctx, rep.ReceiveSideFilesystem(), "@1")
+	}
+
+	// assert no step hold is left that would keep @1 from being pruned
+	require.Empty(ctx, stepHolds())
+}
@@ -55,8 +55,17 @@ func CreateReplicationCursor(ctx *platformtest.Context) {
 	cursorOfBook, err := endpoint.CreateReplicationCursor(ctx, fs, book, jobid)
 	checkCreateCursor(err, cursorOfBook, snap)
 	// ... for target = non-cursor bookmark
-	_, err = endpoint.CreateReplicationCursor(ctx, fs, book3, jobid)
-	assert.Equal(ctx, zfs.ErrBookmarkCloningNotSupported, err)
+	cloningSupported, err := zfs.BookmarkCloningSupported(ctx, fs)
+	require.NoError(ctx, err)
+	cursorOfBook3, err := endpoint.CreateReplicationCursor(ctx, fs, book3, jobid)
+	if cloningSupported {
+		checkCreateCursor(err, cursorOfBook3, book3)
+		// the checks below expect the cursor of snap to be the most recent one
+		err := zfs.ZFSDestroy(ctx, cursorOfBook3.GetFilesystemVersion().FullPath(fs))
+		require.NoError(ctx, err)
+	} else {
+		assert.Equal(ctx, zfs.ErrBookmarkCloningNotSupported, err)
+	}
 	// ... for target = replication cursor bookmark to be created
 	cursorOfCursor, err := endpoint.CreateReplicationCursor(ctx, fs, cursorOfSnapIdemp.GetFilesystemVersion(), jobid)
 	checkCreateCursor(err, cursorOfCursor, cursorOfSnap.GetFilesystemVersion())
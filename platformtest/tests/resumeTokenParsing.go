@@ -54,6 +54,9 @@ func ResumeTokenParsing(ctx *platformtest.Context) {
 				HasToGUID: true,
 				ToGUID:    0x94a20a5f25877859,
 				ToName:    "zreplplatformtest/src@a",
+				HasObject: true, Object: 0x2,
+				HasOffset: true, Offset: 0x2c0000,
+				HasBytes: true, Bytes: 0x2e2878,
 			},
 		},
 		{
@@ -65,6 +68,9 @@ func ResumeTokenParsing(ctx *platformtest.Context) {
 				ToName:        "zreplplatformtest/src@a",
 				HasCompressOK: true, CompressOK: true,
 				HasRawOk: true, RawOK: true,
+				HasObject: true, Object: 0x2,
+				HasOffset: true, Offset: 0x2c0000,
+				HasBytes: true, Bytes: 0x2e2e44,
 			},
 		},
 
@@ -74,7 +80,10 @@ func ResumeTokenParsing(ctx *platformtest.Context) {
 			ExpectToken: &zfs.ResumeToken{
 				HasFromGUID: true, FromGUID: 0x94a20a5f25877859,
 				HasToGUID: true, ToGUID: 0xf784e1004f460f7a,
-				ToName: "zreplplatformtest/src@b",
+				ToName:    "zreplplatformtest/src@b",
+				HasObject: true, Object: 0x2,
+				HasOffset: true, Offset: 0x2c0000,
+				HasBytes: true, Bytes: 0x2e2540,
 			},
 		},
 		{
@@ -86,6 +95,9 @@ func ResumeTokenParsing(ctx *platformtest.Context) {
 				ToName:        "zreplplatformtest/src@b",
 				HasCompressOK: true, CompressOK: true,
 				HasRawOk: true, RawOK: true,
+				HasObject: true, Object: 0x2,
+				HasOffset: true, Offset: 0x2c0000,
+				HasBytes: true, Bytes: 0x2e2b0c,
 			},
 		},
 
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"fmt"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/platformtest"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func SnapshotClonesListedAndDestroyDeferred(ctx *platformtest.Context) {
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+		DESTROYROOT
+		CREATEROOT
+		+  "foo bar"
+		+  "foo bar@1"
+		+  "foo bar@2"
+		R  zfs clone "${ROOTDS}/foo bar@2" "${ROOTDS}/a clone"
+	`)
+
+	fs := mustDatasetPath(fmt.Sprintf("%s/foo bar", ctx.RootDataset))
+	clones, err := zfs.ZFSListSnapshotClones(ctx, fs)
+	require.NoError(ctx, err)
+	require.Equal(ctx, map[string][]string{"2": {fmt.Sprintf("%s/a clone", ctx.RootDataset)}}, clones)
+
+	err = zfs.ZFSDestroyDeferred(ctx, fs, "2")
+	require.NoError(ctx, err)
+
+	platformtest.Run(ctx, platformtest.PanicErr, ctx.RootDataset, `
+	!E "foo bar@2"
+	-  "a clone"
+	!N "foo bar@2"
+	-  "foo bar@1"
+	-  "foo bar"
+	`)
+}
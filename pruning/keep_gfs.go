@@ -0,0 +1,162 @@
+package pruning
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// KeepGFS implements grandfather-father-son retention:
+// among the snapshots that match a regex, it keeps the first snapshot of each of the most recent
+// `daily` days, `weekly` weeks, `monthly` months and `yearly` years that contain matching snapshots.
+//
+// Weeks start on weekday, months on dayOfMonth, and years on dayOfMonth of January, all at midnight in loc.
+// Keeping the first snapshot of a period means that the kept snapshot does not change as newer snapshots are added to the period.
+type KeepGFS struct {
+	re                             *regexp.Regexp
+	daily, weekly, monthly, yearly int
+	weekday                        time.Weekday
+	dayOfMonth                     int
+	loc                            *time.Location
+}
+
+func NewKeepGFS(in *config.PruneGFS) (*KeepGFS, error) {
+	for _, c := range []struct {
+		name  string
+		count int
+	}{{"daily", in.Daily}, {"weekly", in.Weekly}, {"monthly", in.Monthly}, {"yearly", in.Yearly}} {
+		if c.count < 0 {
+			return nil, fmt.Errorf("`%s` must not be negative, got %d", c.name, c.count)
+		}
+	}
+	if in.Daily+in.Weekly+in.Monthly+in.Yearly == 0 {
+		return nil, errors.New("at least one of `daily`, `weekly`, `monthly` and `yearly` must be positive")
+	}
+	weekday, err := parseWeekday(in.Weekday)
+	if err != nil {
+		return nil, errors.Wrap(err, "`weekday`")
+	}
+	// every month has these days
+	if in.DayOfMonth < 1 || in.DayOfMonth > 28 {
+		return nil, fmt.Errorf("`day_of_month` must be between 1 and 28, got %d", in.DayOfMonth)
+	}
+	loc := time.Local
+	if in.TimeZone != "" {
+		if loc, err = time.LoadLocation(in.TimeZone); err != nil {
+			return nil, errors.Wrap(err, "invalid `time_zone`")
+		}
+	}
+	re, err := regexp.Compile(in.Regex)
+	if err != nil {
+		return nil, errors.Wrap(err, "`regex` is invalid")
+	}
+	return &KeepGFS{
+		re:         re,
+		daily:      in.Daily,
+		weekly:     in.Weekly,
+		monthly:    in.Monthly,
+		yearly:     in.Yearly,
+		weekday:    weekday,
+		dayOfMonth: in.DayOfMonth,
+		loc:        loc,
+	}, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q, must be one of sunday, monday, ..., saturday", s)
+}
+
+// gfsPeriod is the kind of period, e.g., day, of which the first snapshot of each of the most recent count periods is kept.
+type gfsPeriod struct {
+	count int
+	// maps a time to the start of its period
+	start func(t time.Time) time.Time
+}
+
+func (k *KeepGFS) periods() []gfsPeriod {
+	day := func(t time.Time) time.Time {
+		y, m, d := t.In(k.loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, k.loc)
+	}
+	return []gfsPeriod{
+		{k.daily, day},
+		{k.weekly, func(t time.Time) time.Time {
+			d := day(t)
+			return d.AddDate(0, 0, -((int(d.Weekday()) - int(k.weekday) + 7) % 7))
+		}},
+		{k.monthly, func(t time.Time) time.Time {
+			y, m, d := t.In(k.loc).Date()
+			if d < k.dayOfMonth {
+				m--
+			}
+			return time.Date(y, m, k.dayOfMonth, 0, 0, 0, 0, k.loc) // normalizes month 0
+		}},
+		{k.yearly, func(t time.Time) time.Time {
+			y := t.In(k.loc).Year()
+			start := time.Date(y, time.January, k.dayOfMonth, 0, 0, 0, 0, k.loc)
+			if t.Before(start) {
+				start = start.AddDate(-1, 0, 0)
+			}
+			return start
+		}},
+	}
+}
+
+func (k *KeepGFS) KeepRule(snaps []Snapshot) (destroyList []Snapshot) {
+
+	matching, notMatching := partitionSnapList(snaps, func(snapshot Snapshot) bool {
+		return k.re.MatchString(snapshot.Name())
+	})
+	// snaps that don't match the regex are not kept by this rule
+	destroyList = append(destroyList, notMatching...)
+
+	sort.Slice(matching, func(i, j int) bool {
+		// by date (oldest first)
+		id, jd := matching[i].Date(), matching[j].Date()
+		if !id.Equal(jd) {
+			return id.Before(jd)
+		}
+		// then lexicographically ascending (e.g. a, b)
+		return strings.Compare(matching[i].Name(), matching[j].Name()) == -1
+	})
+
+	keep := make(map[Snapshot]bool, len(matching))
+	for _, p := range k.periods() {
+		if p.count == 0 {
+			continue
+		}
+		// the first snapshot of each period, oldest period first
+		var firsts []Snapshot
+		var last time.Time
+		for _, s := range matching {
+			if start := p.start(s.Date()); len(firsts) == 0 || !start.Equal(last) {
+				firsts = append(firsts, s)
+				last = start
+			}
+		}
+		if len(firsts) > p.count {
+			firsts = firsts[len(firsts)-p.count:]
+		}
+		for _, s := range firsts {
+			keep[s] = true
+		}
+	}
+
+	for _, s := range matching {
+		if !keep[s] {
+			destroyList = append(destroyList, s)
+		}
+	}
+	return destroyList
+}
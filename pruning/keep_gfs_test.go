@@ -0,0 +1,186 @@
+package pruning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func mustKeepGFS(in config.PruneGFS) *KeepGFS {
+	if in.Weekday == "" {
+		in.Weekday = "monday"
+	}
+	if in.DayOfMonth == 0 {
+		in.DayOfMonth = 1
+	}
+	if in.TimeZone == "" {
+		in.TimeZone = "UTC"
+	}
+	k, err := NewKeepGFS(&in)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func TestKeepGFS(t *testing.T) {
+
+	d := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tcs := map[string]testCase{
+		"daily": {
+			inputs: []Snapshot{
+				stubSnap{name: "a", date: d("2020-03-01 10:00")},
+				stubSnap{name: "b", date: d("2020-03-01 12:00")},
+				stubSnap{name: "c", date: d("2020-03-02 10:00")},
+				stubSnap{name: "d", date: d("2020-03-03 09:00")},
+				stubSnap{name: "e", date: d("2020-03-03 23:59")},
+				stubSnap{name: "manual", date: d("2020-03-03 23:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Daily: 2, Regex: "^[a-e]$"}),
+			},
+			expDestroy: map[string]bool{"a": true, "b": true, "e": true, "manual": true},
+		},
+		"weekly_sunday": {
+			inputs: []Snapshot{
+				stubSnap{name: "fri", date: d("2020-02-28 10:00")},
+				stubSnap{name: "sun", date: d("2020-03-01 10:00")},
+				stubSnap{name: "wed", date: d("2020-03-04 10:00")},
+				stubSnap{name: "sun2", date: d("2020-03-08 00:00")},
+				stubSnap{name: "tue", date: d("2020-03-10 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Weekly: 2, Weekday: "Sunday"}),
+			},
+			expDestroy: map[string]bool{"fri": true, "wed": true, "tue": true},
+		},
+		"weekly_wednesday": {
+			inputs: []Snapshot{
+				stubSnap{name: "fri", date: d("2020-02-28 10:00")},
+				stubSnap{name: "sun", date: d("2020-03-01 10:00")},
+				stubSnap{name: "wed", date: d("2020-03-04 10:00")},
+				stubSnap{name: "sun2", date: d("2020-03-08 00:00")},
+				stubSnap{name: "tue", date: d("2020-03-10 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Weekly: 2, Weekday: "wednesday"}),
+			},
+			expDestroy: map[string]bool{"sun": true, "sun2": true, "tue": true},
+		},
+		"monthly_15th": {
+			inputs: []Snapshot{
+				stubSnap{name: "m1", date: d("2020-01-20 10:00")},
+				stubSnap{name: "m2", date: d("2020-02-10 10:00")},
+				stubSnap{name: "m3", date: d("2020-02-15 00:00")},
+				stubSnap{name: "m4", date: d("2020-03-14 23:00")},
+				stubSnap{name: "m5", date: d("2020-03-16 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Monthly: 2, DayOfMonth: 15}),
+			},
+			expDestroy: map[string]bool{"m1": true, "m2": true, "m4": true},
+		},
+		"monthly_across_years": {
+			inputs: []Snapshot{
+				stubSnap{name: "dec", date: d("2019-12-20 10:00")},
+				stubSnap{name: "jan", date: d("2020-01-10 10:00")},
+				stubSnap{name: "jan2", date: d("2020-01-15 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Monthly: 5, DayOfMonth: 15}),
+			},
+			expDestroy: map[string]bool{"jan": true},
+		},
+		"yearly": {
+			inputs: []Snapshot{
+				stubSnap{name: "y1", date: d("2018-05-01 10:00")},
+				stubSnap{name: "y2", date: d("2019-01-01 00:00")},
+				stubSnap{name: "y3", date: d("2019-12-31 10:00")},
+				stubSnap{name: "y4", date: d("2020-02-01 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Yearly: 2}),
+			},
+			expDestroy: map[string]bool{"y1": true, "y3": true},
+		},
+		"yearly_15th": {
+			inputs: []Snapshot{
+				stubSnap{name: "y1", date: d("2018-05-01 10:00")},
+				stubSnap{name: "y2", date: d("2019-01-01 00:00")},
+				stubSnap{name: "y3", date: d("2019-12-31 10:00")},
+				stubSnap{name: "y4", date: d("2020-02-01 10:00")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Yearly: 2, DayOfMonth: 15}),
+			},
+			expDestroy: map[string]bool{"y1": true, "y2": true},
+		},
+		"combined": {
+			// daily at 10:00 from Thursday, 2020-01-30 to Monday, 2020-02-10
+			inputs: func() []Snapshot {
+				var snaps []Snapshot
+				for t := d("2020-01-30 10:00"); !t.After(d("2020-02-10 10:00")); t = t.AddDate(0, 0, 1) {
+					snaps = append(snaps, stubSnap{name: t.Format("01-02"), date: t})
+				}
+				return snaps
+			}(),
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Daily: 2, Weekly: 2, Monthly: 2, Weekday: "sunday"}),
+			},
+			// dailies 02-09 and 02-10, weeklies 02-02 and 02-09, monthlies 01-30 and 02-01
+			expDestroy: map[string]bool{
+				"01-31": true, "02-03": true, "02-04": true, "02-05": true,
+				"02-06": true, "02-07": true, "02-08": true,
+			},
+		},
+		"time_zone": {
+			// 2020-03-01 23:30 UTC is 2020-03-02 00:30 in Berlin
+			inputs: []Snapshot{
+				stubSnap{name: "a", date: d("2020-03-01 22:00")},
+				stubSnap{name: "b", date: d("2020-03-01 23:30")},
+			},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Daily: 2, TimeZone: "Europe/Berlin"}),
+			},
+			expDestroy: map[string]bool{},
+		},
+		"empty_input": {
+			inputs: []Snapshot{},
+			rules: []KeepRule{
+				mustKeepGFS(config.PruneGFS{Daily: 7}),
+			},
+			expDestroy: map[string]bool{},
+		},
+	}
+
+	testTable(tcs, t)
+}
+
+func TestNewKeepGFS(t *testing.T) {
+	for _, c := range []struct {
+		in  config.PruneGFS
+		err string
+	}{
+		{config.PruneGFS{Weekday: "monday", DayOfMonth: 1}, "at least one of"},
+		{config.PruneGFS{Daily: -1, Weekly: 2, Weekday: "monday", DayOfMonth: 1}, "`daily` must not be negative"},
+		{config.PruneGFS{Weekly: 2, Weekday: "mon", DayOfMonth: 1}, "invalid weekday"},
+		{config.PruneGFS{Monthly: 2, Weekday: "monday", DayOfMonth: 31}, "`day_of_month` must be between 1 and 28"},
+		{config.PruneGFS{Monthly: 2, Weekday: "monday", DayOfMonth: 1, TimeZone: "Nowhere/Nothing"}, "invalid `time_zone`"},
+		{config.PruneGFS{Monthly: 2, Weekday: "monday", DayOfMonth: 1, Regex: "("}, "`regex` is invalid"},
+	} {
+		_, err := NewKeepGFS(&c.in)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
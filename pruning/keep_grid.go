@@ -14,6 +14,7 @@ import (
 // KeepGrid fits snapshots that match a given regex into a retentiongrid.Grid,
 // uses the most recent snapshot among those that match the regex as 'now',
 // and deletes all snapshots that do not fit the grid specification.
+// If the grid is aligned (field `align`), its buckets are aligned to calendar periods, see calendarAlignment.
 type KeepGrid struct {
 	retentionGrid *retentiongrid.Grid
 	re            *regexp.Regexp
@@ -28,8 +29,12 @@ func NewKeepGrid(in *config.PruneGrid) (p *KeepGrid, err error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Regex is invalid")
 	}
+	align, err := calendarAlignmentFromConfig(in)
+	if err != nil {
+		return nil, err
+	}
 
-	return newKeepGrid(re, in.Grid)
+	return newKeepGrid(re, in.Grid, align)
 }
 
 func MustNewKeepGrid(regex, gridspec string) *KeepGrid {
@@ -41,14 +46,15 @@ func MustNewKeepGrid(regex, gridspec string) *KeepGrid {
 
 	re := regexp.MustCompile(regex)
 
-	grid, err := newKeepGrid(re, ris)
+	grid, err := newKeepGrid(re, ris, nil)
 	if err != nil {
 		panic(err)
 	}
 	return grid
 }
 
-func newKeepGrid(re *regexp.Regexp, configIntervals []config.RetentionInterval) (*KeepGrid, error) {
+// align is nil if the grid is not aligned
+func newKeepGrid(re *regexp.Regexp, configIntervals []config.RetentionInterval, align retentiongrid.Alignment) (*KeepGrid, error) {
 	if re == nil {
 		panic("re must not be nil")
 	}
@@ -81,12 +87,82 @@ func newKeepGrid(re *regexp.Regexp, configIntervals []config.RetentionInterval)
 		lastDuration = intervals[i].Length()
 	}
 
+	grid := retentiongrid.NewGrid(intervals)
+	if align != nil {
+		grid = retentiongrid.NewAlignedGrid(intervals, align)
+	}
 	return &KeepGrid{
-		retentionGrid: retentiongrid.NewGrid(intervals),
+		retentionGrid: grid,
 		re:            re,
 	}, nil
 }
 
+// calendarAlignment aligns the buckets of a grid to the hours, days, weeks or months in loc.
+// Weeks start on weekday, months on their first day, all at midnight.
+type calendarAlignment struct {
+	period  string
+	weekday time.Weekday
+	loc     *time.Location
+}
+
+var _ retentiongrid.Alignment = calendarAlignment{}
+
+// returns nil if field `align` is empty
+func calendarAlignmentFromConfig(in *config.PruneGrid) (retentiongrid.Alignment, error) {
+	switch in.Align {
+	case "":
+		return nil, nil
+	case "hour", "day", "week", "month":
+	default:
+		return nil, fmt.Errorf("invalid `align` %q, must be one of hour, day, week, month", in.Align)
+	}
+	weekday, err := parseWeekday(in.Weekday)
+	if err != nil {
+		return nil, errors.Wrap(err, "`weekday`")
+	}
+	loc := time.Local
+	if in.TimeZone != "" {
+		if loc, err = time.LoadLocation(in.TimeZone); err != nil {
+			return nil, errors.Wrap(err, "invalid `time_zone`")
+		}
+	}
+	return calendarAlignment{period: in.Align, weekday: weekday, loc: loc}, nil
+}
+
+func (a calendarAlignment) Length() time.Duration {
+	switch a.period {
+	case "hour":
+		return time.Hour
+	case "day":
+		return 24 * time.Hour
+	case "week":
+		return 7 * 24 * time.Hour
+	case "month":
+		return 30 * 24 * time.Hour
+	default:
+		panic(fmt.Sprintf("implementation error: unknown period %q", a.period))
+	}
+}
+
+func (a calendarAlignment) PeriodStartBefore(t time.Time) time.Time {
+	t = t.Add(-time.Nanosecond).In(a.loc) // the start of the period that contains t is not before t
+	y, m, d := t.Date()
+	switch a.period {
+	case "hour":
+		// not time.Date, which is ambiguous for the hour that repeats when daylight saving time ends
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, a.loc)
+	case "week":
+		day := time.Date(y, m, d, 0, 0, 0, 0, a.loc)
+		return day.AddDate(0, 0, -((int(day.Weekday()) - int(a.weekday) + 7) % 7))
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, a.loc)
+	default:
+		panic(fmt.Sprintf("implementation error: unknown period %q", a.period))
+	}
+}
+
 // Prune filters snapshots with the retention grid.
 func (p *KeepGrid) KeepRule(snaps []Snapshot) (destroyList []Snapshot) {
 
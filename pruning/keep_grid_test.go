@@ -0,0 +1,125 @@
+package pruning
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func mustKeepAlignedGrid(gridspec string, align, timeZone string) *KeepGrid {
+	ris, err := config.ParseRetentionIntervalSpec(gridspec)
+	if err != nil {
+		panic(err)
+	}
+	k, err := NewKeepGrid(&config.PruneGrid{Grid: ris, Regex: ".*", Align: align, Weekday: "monday", TimeZone: timeZone})
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func TestKeepGridAligned(t *testing.T) {
+
+	d := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tcs := map[string]testCase{
+		"midnight_dailies": {
+			// in UTC, Europe/Berlin is UTC+1 in January
+			inputs: []Snapshot{
+				stubSnap{name: "a", date: d("2020-01-01 22:00")},
+				stubSnap{name: "b", date: d("2020-01-01 23:00")}, // midnight in Berlin
+				stubSnap{name: "c", date: d("2020-01-02 06:00")},
+				stubSnap{name: "d", date: d("2020-01-02 23:00")}, // midnight in Berlin
+				stubSnap{name: "e", date: d("2020-01-03 10:00")},
+				stubSnap{name: "f", date: d("2020-01-03 12:30")},
+			},
+			rules: []KeepRule{
+				mustKeepAlignedGrid(`1x1h(keep=all) | 2x1d`, "day", "Europe/Berlin"),
+			},
+			expDestroy: map[string]bool{"a": true, "c": true, "e": true},
+		},
+		"unaligned": {
+			inputs: []Snapshot{
+				stubSnap{name: "a", date: d("2020-01-01 22:00")},
+				stubSnap{name: "b", date: d("2020-01-01 23:00")},
+				stubSnap{name: "c", date: d("2020-01-02 06:00")},
+				stubSnap{name: "d", date: d("2020-01-02 23:00")},
+				stubSnap{name: "e", date: d("2020-01-03 10:00")},
+				stubSnap{name: "f", date: d("2020-01-03 12:30")},
+			},
+			rules: []KeepRule{
+				mustKeepAlignedGrid(`1x1h(keep=all) | 2x1d`, "", ""),
+			},
+			// keeps the oldest snapshot of each 24h before f, not the one at midnight
+			expDestroy: map[string]bool{"b": true, "c": true, "e": true},
+		},
+	}
+
+	testTable(tcs, t)
+}
+
+func TestCalendarAlignment(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	d := func(s string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	for _, c := range []struct {
+		period  string
+		weekday time.Weekday
+		t, exp  time.Time
+	}{
+		{"hour", 0, d("2020-03-04 10:30"), d("2020-03-04 10:00")},
+		{"hour", 0, d("2020-03-04 10:00"), d("2020-03-04 09:00")},
+		// 02:00 CET follows 02:59 CEST when daylight saving time ends
+		{"hour", 0, time.Date(2020, 10, 25, 1, 30, 0, 0, time.UTC), time.Date(2020, 10, 25, 1, 0, 0, 0, time.UTC)},
+		{"hour", 0, time.Date(2020, 10, 25, 0, 30, 0, 0, time.UTC), time.Date(2020, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"day", 0, d("2020-03-04 10:30"), d("2020-03-04 00:00")},
+		{"day", 0, d("2020-03-04 00:00"), d("2020-03-03 00:00")},
+		{"day", 0, d("2020-03-30 10:00"), d("2020-03-30 00:00")}, // the day after the start of daylight saving time
+		{"week", time.Monday, d("2020-03-04 10:30"), d("2020-03-02 00:00")},
+		{"week", time.Monday, d("2020-03-02 00:00"), d("2020-02-24 00:00")},
+		{"week", time.Sunday, d("2020-03-04 10:30"), d("2020-03-01 00:00")},
+		{"week", time.Wednesday, d("2020-03-04 10:30"), d("2020-03-04 00:00")},
+		{"month", 0, d("2020-03-04 10:30"), d("2020-03-01 00:00")},
+		{"month", 0, d("2020-03-01 00:00"), d("2020-02-01 00:00")},
+	} {
+		a := calendarAlignment{period: c.period, weekday: c.weekday, loc: berlin}
+		assert.True(t, c.exp.Equal(a.PeriodStartBefore(c.t)), "%s before %s: expected %s, got %s", c.period, c.t, c.exp, a.PeriodStartBefore(c.t))
+	}
+}
+
+func TestNewKeepGrid(t *testing.T) {
+	ris, err := config.ParseRetentionIntervalSpec(`1x1h | 2x1d`)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		in  config.PruneGrid
+		err string
+	}{
+		{config.PruneGrid{Grid: ris, Regex: ".*", Align: "year", Weekday: "monday"}, "invalid `align`"},
+		{config.PruneGrid{Grid: ris, Regex: ".*", Align: "week", Weekday: "mon"}, "invalid weekday"},
+		{config.PruneGrid{Grid: ris, Regex: ".*", Align: "day", Weekday: "monday", TimeZone: "Nowhere/Nothing"}, "invalid `time_zone`"},
+	} {
+		_, err := NewKeepGrid(&c.in)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+}
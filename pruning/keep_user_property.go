@@ -0,0 +1,56 @@
+package pruning
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// KeepUserProperty keeps the snapshots on which a ZFS user property is set,
+// so that admins and scripts can pin snapshots with `zfs set com.example:keep=true pool/fs@snap`.
+type KeepUserProperty struct {
+	property string
+	value    string // empty matches any value
+}
+
+var _ KeepRule = &KeepUserProperty{}
+
+func NewKeepUserProperty(property, value string) (*KeepUserProperty, error) {
+	if err := zfs.ValidateUserPropertyName(property); err != nil {
+		return nil, errors.Wrap(err, "invalid `property`")
+	}
+	return &KeepUserProperty{property, value}, nil
+}
+
+func MustKeepUserProperty(property, value string) *KeepUserProperty {
+	k, err := NewKeepUserProperty(property, value)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func (k *KeepUserProperty) KeepRule(snaps []Snapshot) []Snapshot {
+	return filterSnapList(snaps, func(s Snapshot) bool {
+		v := s.UserProperty(k.property)
+		if k.value == "" {
+			return v == ""
+		}
+		return v != k.value
+	})
+}
+
+// UserPropertiesOfRules returns the user properties that the keep rules in refer to,
+// which the Snapshot.UserProperty of the snapshots passed to the rules must report.
+func UserPropertiesOfRules(in []config.PruningEnum) []string {
+	var props []string
+	seen := make(map[string]bool)
+	for _, r := range in {
+		if k, ok := r.Ret.(*config.PruneKeepUserProperty); ok && !seen[k.Property] {
+			seen[k.Property] = true
+			props = append(props, k.Property)
+		}
+	}
+	return props
+}
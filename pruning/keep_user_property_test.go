@@ -0,0 +1,35 @@
+package pruning
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type propSnap struct {
+	stubSnap
+	props map[string]string
+}
+
+func (s propSnap) UserProperty(name string) string { return s.props[name] }
+
+func TestKeepUserProperty(t *testing.T) {
+
+	snaps := []Snapshot{
+		propSnap{stubSnap{name: "pinned"}, map[string]string{"com.example:keep": "true"}},
+		propSnap{stubSnap{name: "unpinned"}, map[string]string{"com.example:keep": "false"}},
+		propSnap{stubSnap{name: "other"}, map[string]string{"com.example:other": "true"}},
+		stubSnap{name: "none"},
+	}
+
+	anyValue := snapshotList(MustKeepUserProperty("com.example:keep", "").KeepRule(snaps))
+	assert.Equal(t, []string{"other", "none"}, anyValue.NameList())
+
+	value := snapshotList(MustKeepUserProperty("com.example:keep", "true").KeepRule(snaps))
+	assert.Equal(t, []string{"unpinned", "other", "none"}, value.NameList())
+
+	_, err := NewKeepUserProperty("nocolon", "")
+	assert.Error(t, err)
+	_, err = NewKeepUserProperty("com.example:UPPER", "")
+	assert.Error(t, err)
+}
@@ -17,6 +17,8 @@ type Snapshot interface {
 	Name() string
 	Replicated() bool
 	Date() time.Time
+	// the value of ZFS user property name, the empty string if it is not set, see UserPropertiesOfRules
+	UserProperty(name string) string
 }
 
 // The returned snapshot list is guaranteed to only contains elements of input parameter snaps
@@ -44,10 +46,41 @@ func PruneSnapshots(snaps []Snapshot, keepRules []KeepRule) []Snapshot {
 	return remove
 }
 
-func RulesFromConfig(in []config.PruningEnum) (rules []KeepRule, err error) {
+// KeptBy returns, for each snapshot of snaps that PruneSnapshots(snaps, keepRules) does not destroy,
+// the indices of the keepRules that keep it.
+// Without keep rules, no snapshot is destroyed, and all snapshots map to an empty list.
+func KeptBy(snaps []Snapshot, keepRules []KeepRule) map[Snapshot][]int {
+
+	keptBy := make(map[Snapshot][]int, len(snaps))
+	if len(keepRules) == 0 {
+		for _, s := range snaps {
+			keptBy[s] = nil
+		}
+		return keptBy
+	}
+
+	for i, r := range keepRules {
+		ruleRems := make(map[Snapshot]bool)
+		for _, ruleRem := range r.KeepRule(snaps) {
+			ruleRems[ruleRem] = true
+		}
+		for _, s := range snaps {
+			if !ruleRems[s] {
+				keptBy[s] = append(keptBy[s], i)
+			}
+		}
+	}
+
+	return keptBy
+}
+
+// RulesFromConfig builds the keep rules of in.
+// classes maps the names of the snapshot classes of the job to the regexes of their snapshot names
+// (see snapper.PeriodicOrManual.ClassNameRegexes), for the keep rules that refer to a class instead of a regex.
+func RulesFromConfig(in []config.PruningEnum, classes map[string]string) (rules []KeepRule, err error) {
 	rules = make([]KeepRule, len(in))
 	for i := range in {
-		rules[i], err = RuleFromConfig(in[i])
+		rules[i], err = RuleFromConfig(in[i], classes)
 		if err != nil {
 			return nil, errors.Wrapf(err, "cannot build rule #%d", i)
 		}
@@ -55,17 +88,58 @@ func RulesFromConfig(in []config.PruningEnum) (rules []KeepRule, err error) {
 	return rules, nil
 }
 
-func RuleFromConfig(in config.PruningEnum) (KeepRule, error) {
+func RuleFromConfig(in config.PruningEnum, classes map[string]string) (KeepRule, error) {
 	switch v := in.Ret.(type) {
 	case *config.PruneKeepNotReplicated:
 		return NewKeepNotReplicated(), nil
 	case *config.PruneKeepLastN:
-		return NewKeepLastN(v.Count, v.Regex)
+		regex, err := classRegex(v.Regex, v.Class, classes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeepLastN(v.Count, regex)
 	case *config.PruneKeepRegex:
 		return NewKeepRegex(v.Regex, v.Negate)
 	case *config.PruneGrid:
-		return NewKeepGrid(v)
+		grid := *v
+		var err error
+		if grid.Regex, err = requiredClassRegex(v.Regex, v.Class, classes); err != nil {
+			return nil, err
+		}
+		return NewKeepGrid(&grid)
+	case *config.PruneGFS:
+		gfs := *v
+		var err error
+		if gfs.Regex, err = requiredClassRegex(v.Regex, v.Class, classes); err != nil {
+			return nil, err
+		}
+		return NewKeepGFS(&gfs)
+	case *config.PruneKeepUserProperty:
+		return NewKeepUserProperty(v.Property, v.Value)
 	default:
 		return nil, fmt.Errorf("unknown keep rule type %T", v)
 	}
 }
+
+// requiredClassRegex is classRegex for the keep rules that require exactly one of regex and class.
+func requiredClassRegex(regex, class string, classes map[string]string) (string, error) {
+	if regex == "" && class == "" {
+		return "", errors.New("one of `regex` and `class` is required")
+	}
+	return classRegex(regex, class, classes)
+}
+
+// classRegex returns regex, or the regex of the snapshot names of class if class is set.
+func classRegex(regex, class string, classes map[string]string) (string, error) {
+	if class == "" {
+		return regex, nil
+	}
+	if regex != "" {
+		return "", errors.New("`regex` and `class` are mutually exclusive")
+	}
+	re, ok := classes[class]
+	if !ok {
+		return "", fmt.Errorf("`class`: the job has no snapshot class %q", class)
+	}
+	return re, nil
+}
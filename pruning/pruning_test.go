@@ -20,6 +20,8 @@ func (s stubSnap) Replicated() bool { return s.replicated }
 
 func (s stubSnap) Date() time.Time { return s.date }
 
+func (s stubSnap) UserProperty(name string) string { return "" }
+
 type testCase struct {
 	inputs     []Snapshot
 	rules      []KeepRule
@@ -61,6 +63,13 @@ func testTable(tcs map[string]testCase, t *testing.T) {
 			for name := range destroySet {
 				assert.True(t, tc.expDestroy[name], "%q", name)
 			}
+
+			// KeptBy covers exactly the snapshots that are not destroyed
+			keptBy := KeptBy(tc.inputs, tc.rules)
+			for _, s := range tc.inputs {
+				_, kept := keptBy[s]
+				assert.NotEqual(t, destroySet[s.Name()], kept, "%q", s.Name())
+			}
 		})
 	}
 }
@@ -147,3 +156,17 @@ func TestPruneSnapshots(t *testing.T) {
 
 	testTable(tcs, t)
 }
+
+func TestKeptBy(t *testing.T) {
+	foo, bar, baz := stubSnap{name: "foo_1"}, stubSnap{name: "bar_1"}, stubSnap{name: "baz_1"}
+	snaps := []Snapshot{foo, bar, baz}
+
+	keptBy := KeptBy(snaps, []KeepRule{
+		MustKeepRegex("^(foo|bar)_", false),
+		MustKeepRegex("^foo_", false),
+	})
+	assert.Equal(t, map[Snapshot][]int{foo: {0, 1}, bar: {0}}, keptBy)
+
+	keptBy = KeptBy(snaps, nil)
+	assert.Equal(t, map[Snapshot][]int{foo: nil, bar: nil, baz: nil}, keptBy)
+}
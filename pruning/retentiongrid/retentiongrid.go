@@ -12,8 +12,17 @@ type Interval interface {
 
 const RetentionGridKeepCountAll int = -1
 
+// Alignment aligns the edges of the buckets of a Grid to the starts of calendar periods, e.g., midnight, see NewAlignedGrid.
+type Alignment interface {
+	// Length is the approximate length of a period, e.g., 30 days for months.
+	Length() time.Duration
+	// PeriodStartBefore returns the start of the latest period that starts before t.
+	PeriodStartBefore(t time.Time) time.Time
+}
+
 type Grid struct {
 	intervals []Interval
+	align     Alignment // nil if the buckets are not aligned
 }
 
 type Entry interface {
@@ -26,7 +35,28 @@ func NewGrid(l []Interval) *Grid {
 	}
 	// TODO Maybe check for ascending interval lengths here, although the algorithm
 	// 		itself doesn't care about that.
-	return &Grid{l}
+	return &Grid{intervals: l}
+}
+
+// NewAlignedGrid is NewGrid, but the buckets whose interval spans n >= 1 periods of align
+// (interval length divided by align.Length(), rounded down) span n whole periods instead.
+// The first of these buckets includes the current, partial period, i.e., the one that contains 'now'.
+// The other buckets are placed like with NewGrid.
+//
+// The start of a period belongs to the bucket that begins with it,
+// e.g., a snapshot taken at midnight belongs to the bucket of the day that starts at midnight.
+func NewAlignedGrid(l []Interval, align Alignment) *Grid {
+	g := NewGrid(l)
+	g.align = align
+	return g
+}
+
+// alignedPeriods returns the number of periods that i spans, 0 if the buckets are not aligned.
+func (g Grid) alignedPeriods(i Interval) int {
+	if g.align == nil {
+		return 0
+	}
+	return int(i.Length() / g.align.Length())
 }
 
 func (g Grid) FitEntries(entries []Entry) (keep, remove []Entry) {
@@ -49,7 +79,9 @@ type bucket struct {
 	keepCount     int
 	youngerThan   time.Time
 	olderThanOrEq time.Time
-	entries       []Entry
+	// for edges that are the start of a period, see NewAlignedGrid
+	youngerThanIsInclusive, olderThanOrEqIsExclusive bool
+	entries                                          []Entry
 }
 
 func makeBucketFromInterval(olderThanOrEq time.Time, i Interval) bucket {
@@ -69,6 +101,12 @@ func makeBucketFromInterval(olderThanOrEq time.Time, i Interval) bucket {
 
 func (b *bucket) Contains(e Entry) bool {
 	d := e.Date()
+	if d.Equal(b.youngerThan) && b.youngerThanIsInclusive {
+		return true
+	}
+	if d.Equal(b.olderThanOrEq) && b.olderThanOrEqIsExclusive {
+		return false
+	}
 	olderThan := d.Before(b.olderThanOrEq)
 	eq := d.Equal(b.olderThanOrEq)
 	youngerThan := d.After(b.youngerThan)
@@ -106,9 +144,19 @@ func (g Grid) fitEntriesWithNow(now time.Time, entries []Entry) (keep, remove []
 
 	buckets := make([]bucket, len(g.intervals))
 
-	buckets[0] = makeBucketFromInterval(now, g.intervals[0])
-	for i := 1; i < len(g.intervals); i++ {
-		buckets[i] = makeBucketFromInterval(buckets[i-1].youngerThan, g.intervals[i])
+	edge, edgeIsPeriodStart := now, false
+	for i := range g.intervals {
+		buckets[i] = makeBucketFromInterval(edge, g.intervals[i])
+		buckets[i].olderThanOrEqIsExclusive = edgeIsPeriodStart
+		if n := g.alignedPeriods(g.intervals[i]); n > 0 {
+			start := edge
+			for p := 0; p < n; p++ {
+				start = g.align.PeriodStartBefore(start)
+			}
+			buckets[i].youngerThan = start
+			buckets[i].youngerThanIsInclusive = true
+		}
+		edge, edgeIsPeriodStart = buckets[i].youngerThan, buckets[i].youngerThanIsInclusive
 	}
 
 	keep = make([]Entry, 0)
@@ -183,3 +183,40 @@ func TestComplex(t *testing.T) {
 	validateRetentionGridFitEntries(t, now, snaps, keep, remove)
 
 }
+
+type hourAlignment struct{}
+
+func (hourAlignment) Length() time.Duration { return time.Hour }
+func (hourAlignment) PeriodStartBefore(t time.Time) time.Time {
+	return t.Add(-time.Nanosecond).Truncate(time.Hour)
+}
+
+func TestAlignedGrid(t *testing.T) {
+	g := gridFromString("1h|1h|1h,2|30m")
+	g = NewAlignedGrid(g.intervals, hourAlignment{})
+
+	hour := func(h, m int) time.Time { return time.Date(2020, 1, 1, h, m, 0, 0, time.UTC) }
+	now := hour(10, 30)
+
+	snaps := []Entry{
+		// 1st interval is the current, partial hour [10:00, 10:30]
+		testSnap{"10:00", true, hour(10, 0)}, // the start of an hour belongs to the hour it starts
+		testSnap{"10:15", false, hour(10, 15)},
+		testSnap{"10:30", false, hour(10, 30)},
+		// 2nd interval is the hour [09:00, 10:00)
+		testSnap{"09:00", true, hour(9, 0)},
+		testSnap{"09:45", false, hour(9, 45)},
+		// 3rd interval is the hour [08:00, 09:00)
+		testSnap{"08:10", true, hour(8, 10)},
+		testSnap{"08:20", true, hour(8, 20)},
+		testSnap{"08:30", false, hour(8, 30)},
+		// 4th interval is shorter than an hour and thus not aligned: [07:30, 08:00)
+		testSnap{"07:30", false, hour(7, 30)},
+		testSnap{"07:40", true, hour(7, 40)},
+		testSnap{"07:50", false, hour(7, 50)},
+		// older than the last interval
+		testSnap{"07:00", false, hour(7, 0)},
+	}
+	keep, remove := g.fitEntriesWithNow(now, snaps)
+	validateRetentionGridFitEntries(t, now, snaps, keep, remove)
+}
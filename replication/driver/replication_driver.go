@@ -3,6 +3,7 @@ package driver
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"sort"
 	"strings"
@@ -18,7 +19,7 @@ import (
 
 	"github.com/zrepl/zrepl/replication/report"
 	"github.com/zrepl/zrepl/util/chainlock"
-	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/util/semaphore"
 )
 
 type interval struct {
@@ -83,6 +84,7 @@ type Planner interface {
 // an attempt represents a single planning & execution of fs replications
 type attempt struct {
 	planner Planner
+	config  Config
 
 	l *chainlock.L
 
@@ -92,6 +94,9 @@ type attempt struct {
 	// if both are nil, it must be assumed that Planner.Plan is active
 	planErr *timedError
 	fss     []*fs
+
+	// the filesystem whose error made the attempt skip all other filesystems, see OnErrorFailJob
+	failedFS *fs
 }
 
 type timedError struct {
@@ -144,8 +149,22 @@ type Step interface {
 	ReportInfo() *report.StepInfo
 }
 
+// DeferredStep may be implemented by a Step.
+// If Deferred returns true, the step is executed in a separate queue that executes
+// one step at a time and does not count towards Config.StepQueueConcurrency,
+// so that large steps do not block the steps of other filesystems.
+type DeferredStep interface {
+	Step
+	Deferred() bool
+}
+
 type fs struct {
-	fs FS
+	fs       FS
+	attempt  *attempt
+	stepGate StepGate        // may be nil
+	stop     <-chan struct{} // see Config.Stop, may be nil
+	// the highest priority of the filesystem and its descendants, does not change after planning
+	priority int
 
 	l *chainlock.L
 
@@ -170,6 +189,10 @@ type fs struct {
 		// if step >= len(steps), no more work needs to be done
 		step int
 	}
+
+	// non-nil if the filesystem was skipped because of the attempt's OnError policy,
+	// takes precedence over planning and planned
+	skipped *timedError
 }
 
 type step struct {
@@ -180,10 +203,58 @@ type step struct {
 type ReportFunc func() *report.Report
 type WaitFunc func(block bool) (done bool)
 
-var maxAttempts = envconst.Int64("ZREPL_REPLICATION_MAX_ATTEMPTS", 3)
-var reconnectHardFailTimeout = envconst.Duration("ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT", 10*time.Minute)
+type Config struct {
+	// maximum number of steps (sends) that are executed concurrently,
+	// interleaved fairly between filesystems
+	StepQueueConcurrency int
+	// maximum number of filesystems that are replicated concurrently, 0 means no limit
+	FilesystemConcurrency int
+	// consulted before planning a filesystem and before each step, may be nil
+	StepGate StepGate
+	// determine whether another attempt is started after an attempt failed
+	Retry RetryPolicies
+	// filesystems with higher priority are planned and replicated first, may be nil
+	Priorities FilesystemPriorities
+	// what happens to the other filesystems if a filesystem fails
+	OnError OnError
+	// restricts the run to a subset of the planned filesystems, nil means all filesystems
+	Filesystems FilesystemSelection
+	// once closed, no further filesystems are planned and no further steps are started,
+	// the run ends after the current attempt without retrying, may be nil
+	Stop <-chan struct{}
+}
+
+// StepGate allows pausing replication at step boundaries.
+// Steps that are already executing are not interrupted.
+type StepGate interface {
+	// WaitOpen blocks until the next step may start or ctx is done.
+	WaitOpen(ctx context.Context) error
+}
 
-func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
+func (c Config) Validate() error {
+	if c.StepQueueConcurrency < 1 {
+		return fmt.Errorf("step queue concurrency must be >= 1, got %v", c.StepQueueConcurrency)
+	}
+	if c.FilesystemConcurrency < 0 {
+		return fmt.Errorf("filesystem concurrency must be >= 0, got %v", c.FilesystemConcurrency)
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := c.OnError.Validate(); err != nil {
+		return err
+	}
+	if err := c.Filesystems.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// config must be valid (use its Validate function).
+func Do(ctx context.Context, config Config, planner Planner) (ReportFunc, WaitFunc) {
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
 	log := getLog(ctx)
 	l := chainlock.New()
 	run := &run{
@@ -200,7 +271,8 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 		defer log.Debug("run ended")
 		var prev *attempt
 		mainLog := log
-		for ano := 0; ano < int(maxAttempts) || maxAttempts == 0; ano++ {
+		retryStates := make(map[errorClass]*retryState)
+		for ano := 0; ; ano++ {
 			log := mainLog.WithField("attempt_number", ano)
 			log.Debug("start attempt")
 
@@ -212,6 +284,7 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 				l:         l,
 				startedAt: time.Now(),
 				planner:   planner,
+				config:    config,
 			}
 			run.attempts = append(run.attempts, cur)
 			run.l.DropWhile(func() {
@@ -232,19 +305,63 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 				log.Debug("attempt completed successfully")
 				break
 			}
+			if config.stopped() {
+				log.Info("replication stopped, not retrying")
+				return
+			}
 
 			mostRecentErr, mostRecentErrClass := errRep.MostRecent()
-			log.WithField("most_recent_err", mostRecentErr).WithField("most_recent_err_class", mostRecentErrClass).Debug("most recent error used for re-connect decision")
+			log.WithField("most_recent_err", mostRecentErr).WithField("most_recent_err_class", mostRecentErrClass).Debug("most recent error used for retry decision")
 			if mostRecentErr == nil {
 				// inconsistent reporting, let's bail out
 				log.Warn("attempt does not report done but error report does not report errors, aborting run")
 				break
 			}
 			log.WithError(mostRecentErr.Err).Error("most recent error in this attempt")
-			shouldReconnect := mostRecentErrClass == errorClassTemporaryConnectivityRelated
-			log.WithField("reconnect_decision", shouldReconnect).Debug("reconnect decision made")
-			if shouldReconnect {
-				run.waitReconnect.Set(time.Now(), reconnectHardFailTimeout)
+
+			policy, retryable := config.Retry.forClass(mostRecentErrClass)
+			if !retryable {
+				log.Error("most recent error cannot be solved by retrying, aborting run")
+				return
+			}
+			state, ok := retryStates[mostRecentErrClass]
+			if !ok {
+				state = &retryState{}
+				retryStates[mostRecentErrClass] = state
+			}
+			decision := state.failed(policy, time.Now(), rand.Float64())
+			log = log.WithField("err_class", mostRecentErrClass).WithField("failures", state.failures)
+			if decision.giveUp {
+				log.WithField("reason", decision.reason).Error("giving up retrying, aborting run")
+				return
+			}
+
+			if decision.wait > 0 {
+				log.WithField("retry_interval", decision.wait).Error("temporary error identified, retrying after interval")
+				t := time.NewTimer(decision.wait)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					log.WithError(ctx.Err()).Info("context error")
+					return
+				case <-config.Stop:
+					t.Stop()
+					log.Info("replication stopped while waiting for retry")
+					return
+				}
+			}
+
+			if mostRecentErrClass == errorClassTemporaryConnectivityRelated {
+				var timeout time.Duration // indefinite
+				if !decision.deadline.IsZero() {
+					timeout = time.Until(decision.deadline)
+					if timeout <= 0 {
+						log.Error("give-up timeout expired while waiting for retry, aborting run")
+						return
+					}
+				}
+				run.waitReconnect.Set(time.Now(), timeout)
 				log.WithField("deadline", run.waitReconnect.End()).Error("temporary connectivity-related error identified, start waiting for reconnect")
 				var connectErr error
 				var connectErrTime time.Time
@@ -254,19 +371,13 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 					connectErr = planner.WaitForConnectivity(ctx)
 					connectErrTime = time.Now()
 				})
-				if connectErr == nil {
-					log.Error("reconnect successful") // same level as 'begin with reconnect' message above
-					continue
-				} else {
+				if connectErr != nil {
 					run.waitReconnectError = newTimedError(connectErr, connectErrTime)
 					log.WithError(connectErr).Error("reconnecting failed, aborting run")
 					break
 				}
-			} else {
-				log.Error("most recent error cannot be solved by reconnecting, aborting run")
-				return
+				log.Error("reconnect successful") // same level as 'begin with reconnect' message above
 			}
-
 		}
 
 	}()
@@ -312,9 +423,17 @@ func (a *attempt) doGlobalPlanning(ctx context.Context, prev *attempt) map[*fs]*
 	}
 
 	for _, pfs := range pfss {
+		if !a.config.Filesystems.Matches(pfs.ReportInfo().Name) {
+			debug("filesystem %q not selected", pfs.ReportInfo().Name)
+			continue
+		}
 		fs := &fs{
-			fs: pfs,
-			l:  a.l,
+			fs:       pfs,
+			attempt:  a,
+			l:        a.l,
+			stepGate: a.config.StepGate,
+			stop:     a.config.Stop,
+			priority: a.config.Priorities.Of(pfs.ReportInfo().Name),
 		}
 		fs.initialRepOrd.parentDidUpdate = make(chan struct{}, 1)
 		a.fss = append(a.fss, fs)
@@ -400,6 +519,10 @@ func (a *attempt) doGlobalPlanning(ctx context.Context, prev *attempt) map[*fs]*
 			if fs1.HasPrefix(fs2) && !fs1.Equal(fs2) {
 				f1.initialRepOrd.parents = append(f1.initialRepOrd.parents, f2)
 				f2.initialRepOrd.children = append(f2.initialRepOrd.children, f1)
+				// f1 might wait for f2's initial replication
+				if f1.priority > f2.priority {
+					f2.priority = f1.priority
+				}
 			}
 		}
 	}
@@ -414,24 +537,89 @@ func (a *attempt) doFilesystems(ctx context.Context, prevs map[*fs]*fs) {
 	defer a.l.Lock().Unlock()
 
 	stepQueue := newStepQueue()
-	defer stepQueue.Start(envconst.Int("ZREPL_REPLICATION_EXPERIMENTAL_REPLICATION_CONCURRENCY", 1))() // TODO parallel replication
-	var fssesDone sync.WaitGroup
-	for _, f := range a.fss {
-		fssesDone.Add(1)
-		go func(f *fs) {
-			defer fssesDone.Done()
-			// avoid explosion of tasks with name f.report().Info.Name
-			ctx, endTask := trace.WithTaskAndSpan(ctx, "repl-fs", f.report().Info.Name)
-			defer endTask()
-			f.do(ctx, stepQueue, prevs[f])
-		}(f)
+	defer stepQueue.Start(a.config.StepQueueConcurrency)()
+	deferredStepQueue := newStepQueue()
+	defer deferredStepQueue.Start(1)()
+
+	// Filesystems acquire their slot in order of descending priority, then in
+	// lexicographical order, so that parents always hold a slot before their children.
+	// Children wait for the initial replication of their parents, so any other order
+	// could deadlock. (A parent's priority is at least that of its children.)
+	fss := make([]*fs, len(a.fss))
+	copy(fss, a.fss)
+	sort.SliceStable(fss, func(i, j int) bool {
+		if fss[i].priority != fss[j].priority {
+			return fss[i].priority > fss[j].priority
+		}
+		return fss[i].fs.ReportInfo().Name < fss[j].fs.ReportInfo().Name
+	})
+	var fsSem *semaphore.S
+	if a.config.FilesystemConcurrency > 0 {
+		fsSem = semaphore.New(int64(a.config.FilesystemConcurrency))
 	}
+
+	var fssesDone sync.WaitGroup
 	a.l.DropWhile(func() {
+		for _, f := range fss {
+			var guard *semaphore.AcquireGuard
+			if fsSem != nil {
+				var err error
+				guard, err = fsSem.Acquire(ctx)
+				if err != nil {
+					// ctx is done, f won't be replicated in this attempt
+					a.l.HoldWhile(func() {
+						f.planning.err = newTimedError(err, time.Now())
+					})
+					continue
+				}
+			}
+			fssesDone.Add(1)
+			go func(f *fs) {
+				defer fssesDone.Done()
+				if guard != nil {
+					defer guard.Release()
+				}
+				// avoid explosion of tasks with name f.report().Info.Name
+				ctx, endTask := trace.WithTaskAndSpan(ctx, "repl-fs", f.report().Info.Name)
+				defer endTask()
+				f.do(ctx, stepQueue, deferredStepQueue, prevs[f])
+			}(f)
+		}
 		fssesDone.Wait()
 	})
 	a.finishedAt = time.Now()
 }
 
+// caller must not hold f.l
+func (f *fs) waitStepGate(ctx context.Context) error {
+	if err := f.checkStop(); err != nil {
+		return err
+	}
+	if f.stepGate == nil {
+		return nil
+	}
+	if f.stop == nil {
+		return f.stepGate.WaitOpen(ctx)
+	}
+	// a stop must not wait for the gate to open
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := f.stepGate.WaitOpen(ctx); err != nil {
+		if stopErr := f.checkStop(); stopErr != nil {
+			return stopErr
+		}
+		return err
+	}
+	return nil
+}
+
 func (f *fs) debug(format string, args ...interface{}) {
 	debugPrefix("fs=%s", f.fs.ReportInfo().Name)(format, args...)
 }
@@ -453,23 +641,45 @@ func (f *fs) initialRepOrdWakeupChildren() {
 	}
 }
 
-func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
+// steps that implement DeferredStep and are deferred are executed in deferredPQ, all others in pq
+func (f *fs) do(ctx context.Context, pq, deferredPQ *stepQueue, prev *fs) {
 
 	defer f.l.Lock().Unlock()
 	defer f.initialRepOrdWakeupChildren()
+	defer f.failed()
+
+	if f.skip() {
+		return
+	}
 
 	// get planned steps from replication logic
 	var psteps []Step
 	var errTime time.Time
 	var err error
 	f.l.DropWhile(func() {
+		if err = f.waitStepGate(ctx); err != nil { // no shadow
+			errTime = time.Now() // no shadow
+			return
+		}
 		// TODO hacky
 		// choose target time that is earlier than any snapshot, so fs planning is always prioritized
 		targetDate := time.Unix(0, 0)
-		defer pq.WaitReady(ctx, f, targetDate)()
+		defer pq.WaitReady(ctx, f, f.priority, targetDate)()
+		if err = f.checkStop(); err != nil { // no shadow
+			errTime = time.Now() // no shadow
+			return
+		}
+		var skip bool
+		f.l.HoldWhile(func() { skip = f.skip() })
+		if skip {
+			return
+		}
 		psteps, err = f.fs.PlanFS(ctx) // no shadow
 		errTime = time.Now()           // no shadow
 	})
+	if f.skipped != nil {
+		return
+	}
 	if err != nil {
 		f.planning.err = newTimedError(err, errTime)
 		return
@@ -547,6 +757,9 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 	}
 	f.debug("wait for parents %s", parents)
 	for {
+		if f.skip() {
+			return
+		}
 		var initialReplicatingParentsWithErrors []string
 		allParentsPresentOnReceiver := true
 		f.l.DropWhile(func() {
@@ -625,15 +838,35 @@ func (f *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 	for i, s := range f.planned.steps {
 		// lock must not be held while executing step in order for reporting to work
 		f.l.DropWhile(func() {
+			if err = f.waitStepGate(ctx); err != nil { // no shadow
+				errTime = time.Now() // no shadow
+				return
+			}
 			// wait for parallel replication
+			queue := pq
+			if d, ok := s.step.(DeferredStep); ok && d.Deferred() {
+				queue = deferredPQ
+			}
 			targetDate := s.step.TargetDate()
-			defer pq.WaitReady(ctx, f, targetDate)()
+			defer queue.WaitReady(ctx, f, f.priority, targetDate)()
+			if err = f.checkStop(); err != nil { // no shadow
+				errTime = time.Now() // no shadow
+				return
+			}
+			var skip bool
+			f.l.HoldWhile(func() { skip = f.skip() })
+			if skip {
+				return
+			}
 			// do the step
 			ctx, endSpan := trace.WithSpan(ctx, fmt.Sprintf("%#v", s.step.ReportInfo()))
 			defer endSpan()
 			err, errTime = s.step.Step(ctx), time.Now() // no shadow
 		})
 
+		if f.skipped != nil {
+			break
+		}
 		if err != nil {
 			f.planned.stepErr = newTimedError(err, errTime)
 			break
@@ -670,10 +903,17 @@ func (a *attempt) report() *report.AttemptReport {
 		StartAt:     a.startedAt,
 		FinishAt:    a.finishedAt,
 		PlanError:   a.planErr.IntoReportError(),
+		OnError:     string(a.config.OnError),
+
+		SelectedFilesystems: a.config.Filesystems,
 	}
 
 	for i := range r.Filesystems {
 		r.Filesystems[i] = a.fss[i].report()
+		r.BytesPerSecond += r.Filesystems[i].BytesPerSecond()
+	}
+	if expected, replicated, _ := r.BytesSum(); r.BytesPerSecond > 0 && expected > replicated {
+		r.ETA = time.Duration(float64(expected-replicated) / float64(r.BytesPerSecond) * float64(time.Second))
 	}
 
 	state := report.AttemptPlanning
@@ -701,7 +941,9 @@ func (a *attempt) report() *report.AttemptReport {
 // caller must hold lock l
 func (f *fs) report() *report.FilesystemReport {
 	state := report.FilesystemPlanningErrored
-	if f.planning.err == nil {
+	if f.skipped != nil {
+		state = report.FilesystemSkipped
+	} else if f.planning.err == nil {
 		if f.planning.done {
 			if f.planned.stepErr != nil {
 				state = report.FilesystemSteppingErrored
@@ -719,6 +961,7 @@ func (f *fs) report() *report.FilesystemReport {
 		State:       state,
 		PlanError:   f.planning.err.IntoReportError(),
 		StepError:   f.planned.stepErr.IntoReportError(),
+		SkipError:   f.skipped.IntoReportError(),
 		Steps:       make([]*report.StepReport, len(f.planned.steps)),
 		CurrentStep: f.planned.step,
 	}
@@ -742,8 +985,24 @@ type errorClass int
 const (
 	errorClassPermanent errorClass = iota
 	errorClassTemporaryConnectivityRelated
+	errorClassTemporaryZFS
+	errorClassPlanning // errors during planning that do not fall into any of the other classes
 )
 
+// forClass returns the policy for errors of class c, or false if they must not be retried.
+func (p RetryPolicies) forClass(c errorClass) (RetryPolicy, bool) {
+	switch c {
+	case errorClassTemporaryConnectivityRelated:
+		return p.Network, true
+	case errorClassTemporaryZFS:
+		return p.ZFS, true
+	case errorClassPlanning:
+		return p.Planning, true
+	default:
+		return RetryPolicy{}, false
+	}
+}
+
 type errorReport struct {
 	flattened []*timedError
 	// sorted DESCending by err time
@@ -753,12 +1012,15 @@ type errorReport struct {
 // caller must hold lock l
 func (a *attempt) errorReport() *errorReport {
 	r := &errorReport{}
+	planningErrs := make(map[*timedError]bool)
 	if a.planErr != nil {
 		r.flattened = append(r.flattened, a.planErr)
+		planningErrs[a.planErr] = true
 	}
 	for _, fs := range a.fss {
 		if fs.planning.done && fs.planning.err != nil {
 			r.flattened = append(r.flattened, fs.planning.err)
+			planningErrs[fs.planning.err] = true
 		} else if fs.planning.done && fs.planned.stepErr != nil {
 			r.flattened = append(r.flattened, fs.planned.stepErr)
 		}
@@ -784,6 +1046,14 @@ func (a *attempt) errorReport() *errorReport {
 				putClass(err, errorClassTemporaryConnectivityRelated)
 				continue
 			}
+			if zfs.ZFSErrorClassOf(err.Err).Temporary() {
+				putClass(err, errorClassTemporaryZFS)
+				continue
+			}
+			if planningErrs[err] {
+				putClass(err, errorClassPlanning)
+				continue
+			}
 			putClass(err, errorClassPermanent)
 		}
 		for _, errs := range r.byClass {
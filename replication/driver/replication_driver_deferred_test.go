@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/chainlock"
+)
+
+type deferredTestFS struct {
+	name         string
+	planDuration time.Duration
+	step         *deferredTestStep
+}
+
+func (f *deferredTestFS) EqualToPreviousAttempt(other FS) bool {
+	return f.name == other.(*deferredTestFS).name
+}
+
+func (f *deferredTestFS) PlanFS(ctx context.Context) ([]Step, error) {
+	time.Sleep(f.planDuration)
+	return []Step{f.step}, nil
+}
+
+func (f *deferredTestFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: f.name}
+}
+
+type deferredTestStep struct {
+	deferred bool
+	block    chan struct{} // Step blocks until block is closed, may be nil
+	done     chan struct{}
+}
+
+var _ DeferredStep = (*deferredTestStep)(nil)
+
+func (s *deferredTestStep) Deferred() bool { return s.deferred }
+
+func (s *deferredTestStep) TargetEquals(other Step) bool { return s == other }
+
+func (s *deferredTestStep) TargetDate() time.Time { return time.Unix(1, 0) }
+
+func (s *deferredTestStep) Step(ctx context.Context) error {
+	if s.block != nil {
+		<-s.block
+	}
+	close(s.done)
+	return nil
+}
+
+func (s *deferredTestStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "from", To: "to", Deferred: s.deferred}
+}
+
+func TestDeferredStepsDoNotBlockStepQueue(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	large := &deferredTestStep{deferred: true, block: make(chan struct{}), done: make(chan struct{})}
+	small := &deferredTestStep{done: make(chan struct{})}
+	a := &attempt{
+		l: chainlock.New(),
+		planner: staticPlanner{
+			&deferredTestFS{name: "pool/a", step: large},
+			// give pool/a the time to queue its step while pool/b is planning
+			&deferredTestFS{name: "pool/b", planDuration: 100 * time.Millisecond, step: small},
+		},
+		// without the deferred queue, the large step would occupy the only slot of the step queue first
+		config: Config{
+			StepQueueConcurrency: 1,
+			Priorities:           FilesystemPriorities{{Regex: regexp.MustCompile(`^pool/a$`), Priority: 10}},
+		},
+	}
+	attemptDone := make(chan struct{})
+	go func() {
+		defer close(attemptDone)
+		a.do(ctx, nil)
+	}()
+
+	select {
+	case <-small.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("small step blocked by deferred step")
+	}
+	close(large.block)
+	<-attemptDone
+
+	var rep *report.AttemptReport
+	a.l.HoldWhile(func() { rep = a.report() })
+	assert.Equal(t, report.AttemptDone, rep.State)
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// DryRun plans the replication of all filesystems without executing any steps.
+//
+// The returned report uses only the states AttemptPlanningError and AttemptDone.
+// Its filesystems use only the states FilesystemPlanningErrored and FilesystemDone,
+// where the latter lists the steps that replication would execute.
+// Conflicts between sender and receiver are reported as planning errors of the filesystem.
+func DryRun(ctx context.Context, planner Planner) *report.AttemptReport {
+	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
+	log := getLog(ctx)
+
+	r := &report.AttemptReport{
+		StartAt: time.Now(),
+	}
+	defer func() { r.FinishAt = time.Now() }()
+
+	pfss, err := planner.Plan(ctx)
+	if err != nil {
+		log.WithError(err).Error("dry run: planning failed")
+		r.State = report.AttemptPlanningError
+		r.PlanError = report.NewTimedError(err.Error(), time.Now())
+		return r
+	}
+
+	sort.Slice(pfss, func(i, j int) bool {
+		return pfss[i].ReportInfo().Name < pfss[j].ReportInfo().Name
+	})
+	for _, pfs := range pfss {
+		fsr := &report.FilesystemReport{
+			Info:  pfs.ReportInfo(),
+			State: report.FilesystemDone,
+		}
+		r.Filesystems = append(r.Filesystems, fsr)
+
+		psteps, err := pfs.PlanFS(ctx)
+		if err != nil {
+			log.WithError(err).WithField("filesystem", fsr.Info.Name).Info("dry run: filesystem planning failed")
+			fsr.State = report.FilesystemPlanningErrored
+			fsr.PlanError = report.NewTimedError(err.Error(), time.Now())
+			continue
+		}
+		for _, pstep := range psteps {
+			fsr.Steps = append(fsr.Steps, &report.StepReport{Info: pstep.ReportInfo()})
+		}
+	}
+	r.State = report.AttemptDone
+	return r
+}
@@ -0,0 +1,113 @@
+package driver
+
+import (
+	"fmt"
+	"time"
+)
+
+// OnError determines what happens to the other filesystems of an attempt
+// after a filesystem failed to plan or to replicate a step.
+//
+// Filesystems that are not replicated because of the policy are reported as
+// report.FilesystemSkipped. Steps that are already executing are not interrupted.
+// Skipped filesystems do not influence the retry decision, which is based on the
+// errors of the filesystems that actually failed.
+type OnError string
+
+const (
+	// the other filesystems are replicated as usual,
+	// only the initial replication of children of the failed filesystem is skipped.
+	// The zero value of OnError is equivalent to OnErrorContinue.
+	OnErrorContinue OnError = "continue"
+	// all filesystems of the attempt that have not completed yet are skipped
+	OnErrorFailJob OnError = "fail_job"
+	// all descendants of the failed filesystem that have not completed yet are skipped
+	OnErrorFailFSSubtree OnError = "fail_fs_subtree"
+)
+
+func OnErrorFromConfig(in string) (OnError, error) {
+	switch o := OnError(in); o {
+	case OnErrorContinue, OnErrorFailJob, OnErrorFailFSSubtree:
+		return o, nil
+	default:
+		return "", fmt.Errorf("invalid on_error policy %q, must be one of %q, %q or %q", in, OnErrorContinue, OnErrorFailJob, OnErrorFailFSSubtree)
+	}
+}
+
+func (o OnError) Validate() error {
+	if o == "" {
+		return nil
+	}
+	_, err := OnErrorFromConfig(string(o))
+	return err
+}
+
+type skippedError struct {
+	failedFS string
+	policy   OnError
+}
+
+func (e *skippedError) Error() string {
+	return fmt.Sprintf("skipped because filesystem %s failed (on_error: %s)", e.failedFS, e.policy)
+}
+
+// caller must hold f.l
+func (f *fs) err() *timedError {
+	if f.planning.err != nil {
+		return f.planning.err
+	}
+	return f.planned.stepErr
+}
+
+// skip marks f as skipped if f must not continue replication because of the attempt's OnError policy.
+//
+// caller must hold f.l (which is the lock of all filesystems of the attempt)
+func (f *fs) skip() bool {
+	if f.skipped != nil {
+		return true
+	}
+	var failedFS string
+	switch f.attempt.config.OnError {
+	case OnErrorFailJob:
+		if failed := f.attempt.failedFS; failed != nil && failed != f {
+			failedFS = failed.fs.ReportInfo().Name
+		}
+	case OnErrorFailFSSubtree:
+		// initialRepOrd.parents contains all ancestors
+		for _, p := range f.initialRepOrd.parents {
+			if p.err() != nil {
+				failedFS = p.fs.ReportInfo().Name
+				break
+			}
+			if p.skipped != nil {
+				failedFS = p.skipped.Err.(*skippedError).failedFS
+				break
+			}
+		}
+	}
+	if failedFS == "" {
+		return false
+	}
+	f.debug("skipped because of failed filesystem %s", failedFS)
+	f.skipped = newTimedError(&skippedError{failedFS, f.attempt.config.OnError}, time.Now())
+	return true
+}
+
+// failed must be called after f's error was set.
+// Under OnErrorFailJob, it wakes up all other filesystems of the attempt
+// that wait for their parents so that they notice that they are skipped.
+//
+// caller must hold f.l
+func (f *fs) failed() {
+	if f.err() == nil || f.attempt.config.OnError != OnErrorFailJob || f.attempt.failedFS != nil {
+		return
+	}
+	f.debug("fail job")
+	f.attempt.failedFS = f
+	for _, other := range f.attempt.fss {
+		select {
+		case other.initialRepOrd.parentDidUpdate <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/chainlock"
+)
+
+// onErrorFS has two incremental steps, the second one fails if fail is set
+type onErrorFS struct {
+	name string
+	fail bool
+}
+
+func (f *onErrorFS) EqualToPreviousAttempt(other FS) bool {
+	return f.name == other.(*onErrorFS).name
+}
+
+func (f *onErrorFS) PlanFS(ctx context.Context) ([]Step, error) {
+	return []Step{
+		&onErrorStep{ident: "a", targetDate: time.Unix(1, 0)},
+		&onErrorStep{ident: "b", targetDate: time.Unix(2, 0), fail: f.fail},
+	}, nil
+}
+
+func (f *onErrorFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: f.name}
+}
+
+type onErrorStep struct {
+	ident      string
+	targetDate time.Time
+	fail       bool
+}
+
+func (s *onErrorStep) TargetEquals(other Step) bool { return s.ident == other.(*onErrorStep).ident }
+
+func (s *onErrorStep) TargetDate() time.Time { return s.targetDate }
+
+func (s *onErrorStep) Step(ctx context.Context) error {
+	if s.fail {
+		return fmt.Errorf("step %s failed", s.ident)
+	}
+	return nil
+}
+
+func (s *onErrorStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "from", To: s.ident} // incremental
+}
+
+func TestOnError(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	tcs := []struct {
+		onError OnError
+		expect  map[string]report.FilesystemState
+	}{
+		{
+			onError: OnErrorContinue,
+			expect: map[string]report.FilesystemState{
+				"pool":         report.FilesystemDone,
+				"pool/a":       report.FilesystemSteppingErrored,
+				"pool/a/child": report.FilesystemDone,
+				"pool/b":       report.FilesystemDone,
+			},
+		},
+		{
+			onError: OnErrorFailFSSubtree,
+			expect: map[string]report.FilesystemState{
+				"pool":         report.FilesystemDone,
+				"pool/a":       report.FilesystemSteppingErrored,
+				"pool/a/child": report.FilesystemSkipped,
+				"pool/b":       report.FilesystemDone,
+			},
+		},
+		{
+			onError: OnErrorFailJob,
+			expect: map[string]report.FilesystemState{
+				"pool":         report.FilesystemDone,
+				"pool/a":       report.FilesystemSteppingErrored,
+				"pool/a/child": report.FilesystemSkipped,
+				"pool/b":       report.FilesystemSkipped,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(string(tc.onError), func(t *testing.T) {
+			planner := staticPlanner{
+				&onErrorFS{name: "pool"},
+				&onErrorFS{name: "pool/a", fail: true},
+				&onErrorFS{name: "pool/a/child"},
+				&onErrorFS{name: "pool/b"},
+			}
+			a := &attempt{
+				l:       chainlock.New(),
+				planner: planner,
+				// one filesystem at a time, in lexicographical order
+				config: Config{StepQueueConcurrency: 1, FilesystemConcurrency: 1, OnError: tc.onError},
+			}
+			a.do(ctx, nil)
+
+			var rep *report.AttemptReport
+			var errRep *errorReport
+			a.l.HoldWhile(func() {
+				rep = a.report()
+				errRep = a.errorReport()
+			})
+			assert.Equal(t, report.AttemptFanOutError, rep.State)
+			assert.Equal(t, string(tc.onError), rep.OnError)
+			actual := make(map[string]report.FilesystemState)
+			for _, fs := range rep.Filesystems {
+				actual[fs.Info.Name] = fs.State
+				if fs.State == report.FilesystemSkipped {
+					require.NotNil(t, fs.Error())
+					assert.Contains(t, fs.Error().Err, "filesystem pool/a failed")
+				}
+			}
+			assert.Equal(t, tc.expect, actual)
+
+			// skipped filesystems are not considered for the retry decision
+			mostRecent, _ := errRep.MostRecent()
+			require.NotNil(t, mostRecent)
+			assert.Equal(t, "step b failed", mostRecent.Err.Error())
+		})
+	}
+}
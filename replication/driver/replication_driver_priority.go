@@ -0,0 +1,27 @@
+package driver
+
+import "regexp"
+
+// FilesystemPriority assigns Priority to the filesystems whose name matches Regex.
+type FilesystemPriority struct {
+	Regex    *regexp.Regexp
+	Priority int
+}
+
+// FilesystemPriorities determine the order in which the driver plans and replicates filesystems:
+// a filesystem's steps are only started if no filesystem with higher priority has a step waiting.
+// The first entry whose Regex matches a filesystem's name determines its priority,
+// filesystems that match no entry have priority 0.
+//
+// A filesystem inherits the highest priority of its descendants because the initial
+// replication of a child filesystem waits for the initial replication of its parent.
+type FilesystemPriorities []FilesystemPriority
+
+func (p FilesystemPriorities) Of(fs string) int {
+	for _, e := range p {
+		if e.Regex.MatchString(fs) {
+			return e.Priority
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package driver
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/util/chainlock"
+)
+
+type staticPlanner []FS
+
+func (p staticPlanner) Plan(ctx context.Context) ([]FS, error) { return p, nil }
+
+func (p staticPlanner) WaitForConnectivity(context.Context) error { return nil }
+
+func TestFilesystemPriorities(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	priorities := FilesystemPriorities{
+		{Regex: regexp.MustCompile(`^pool/vm/`), Priority: 10},
+		{Regex: regexp.MustCompile(`^pool/vm/scratch`), Priority: 20}, // shadowed by the first entry
+		{Regex: regexp.MustCompile(`^pool/media`), Priority: -1},
+	}
+	assert.Equal(t, 10, priorities.Of("pool/vm/scratch"))
+	assert.Equal(t, -1, priorities.Of("pool/media"))
+	assert.Equal(t, 0, priorities.Of("pool/home"))
+
+	var planner staticPlanner
+	for _, name := range []string{"pool", "pool/home", "pool/media", "pool/vm", "pool/vm/disk0"} {
+		planner = append(planner, &mockFS{name: name})
+	}
+	a := &attempt{
+		l:       chainlock.New(),
+		planner: planner,
+		config:  Config{StepQueueConcurrency: 1, Priorities: priorities},
+	}
+	require.NotNil(t, a.doGlobalPlanning(ctx, nil))
+
+	actual := make(map[string]int)
+	for _, f := range a.fss {
+		actual[f.fs.ReportInfo().Name] = f.priority
+	}
+	assert.Equal(t, map[string]int{
+		"pool":          10, // inherited from pool/vm/disk0
+		"pool/home":     0,
+		"pool/media":    -1,
+		"pool/vm":       10, // inherited from pool/vm/disk0
+		"pool/vm/disk0": 10,
+	}, actual)
+}
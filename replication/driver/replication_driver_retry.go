@@ -0,0 +1,123 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RetryPolicy determines whether and when the driver starts another attempt
+// after an attempt failed with a certain class of error.
+type RetryPolicy struct {
+	// maximum number of attempts of a run that may fail with this class of error,
+	// the run is aborted after the MaxAttempts-th failure. 0 means no limit.
+	MaxAttempts int
+	// wait time before the attempt that follows the first failure
+	InitialInterval time.Duration
+	// factor by which the wait time grows with every further failure, must be >= 1
+	Multiplier float64
+	// fraction in [0, 1] by which the wait time is randomly increased or decreased
+	Jitter float64
+	// the run is aborted if errors of this class persist for longer than GiveUpTimeout
+	// since their first occurrence in the run. 0 means no limit.
+	GiveUpTimeout time.Duration
+}
+
+// RetryPolicies are applied separately to the different classes of errors that an attempt can fail with.
+type RetryPolicies struct {
+	// errors that occurred while planning and that are neither network nor temporary zfs errors
+	Planning RetryPolicy
+	// connectivity-related errors, the driver additionally waits for the planner's connectivity
+	Network RetryPolicy
+	// temporary zfs errors, e.g., busy datasets
+	ZFS RetryPolicy
+}
+
+// DefaultRetryPolicies do not retry planning errors, retry network errors once connectivity
+// is restored within 10 minutes, and retry temporary zfs errors after 10 seconds.
+// At most 3 attempts of a run may fail with each class of error.
+func DefaultRetryPolicies() RetryPolicies {
+	return RetryPolicies{
+		Planning: RetryPolicy{MaxAttempts: 1, InitialInterval: 10 * time.Second, Multiplier: 1},
+		Network:  RetryPolicy{MaxAttempts: 3, Multiplier: 1, GiveUpTimeout: 10 * time.Minute},
+		ZFS:      RetryPolicy{MaxAttempts: 3, InitialInterval: 10 * time.Second, Multiplier: 1},
+	}
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts must be >= 0, got %v", p.MaxAttempts)
+	}
+	if p.InitialInterval < 0 {
+		return fmt.Errorf("initial interval must be >= 0, got %v", p.InitialInterval)
+	}
+	if p.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be >= 1, got %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter must be in [0, 1], got %v", p.Jitter)
+	}
+	if p.GiveUpTimeout < 0 {
+		return fmt.Errorf("give-up timeout must be >= 0, got %v", p.GiveUpTimeout)
+	}
+	return nil
+}
+
+func (p RetryPolicies) Validate() error {
+	if err := p.Planning.Validate(); err != nil {
+		return fmt.Errorf("planning retry policy: %s", err)
+	}
+	if err := p.Network.Validate(); err != nil {
+		return fmt.Errorf("network retry policy: %s", err)
+	}
+	if err := p.ZFS.Validate(); err != nil {
+		return fmt.Errorf("zfs retry policy: %s", err)
+	}
+	return nil
+}
+
+// backoff returns the wait time after the failures-th failure (1-based).
+// rnd must be in [0, 1) and determines the jitter.
+func (p RetryPolicy) backoff(failures int, rnd float64) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(failures-1))
+	d *= 1 + p.Jitter*(2*rnd-1)
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+// retryState tracks the failures of a run that were caused by a single class of errors.
+type retryState struct {
+	failures     int
+	firstFailure time.Time
+}
+
+type retryDecision struct {
+	giveUp bool
+	reason string        // if giveUp
+	wait   time.Duration // if !giveUp
+	// if !giveUp, the time until which errors of this class are retried, zero if no limit
+	deadline time.Time
+}
+
+func (s *retryState) failed(p RetryPolicy, now time.Time, rnd float64) retryDecision {
+	if s.failures == 0 {
+		s.firstFailure = now
+	}
+	s.failures++
+	if p.MaxAttempts != 0 && s.failures >= p.MaxAttempts {
+		return retryDecision{giveUp: true, reason: fmt.Sprintf("%d of max %d attempts failed", s.failures, p.MaxAttempts)}
+	}
+	var deadline time.Time
+	if p.GiveUpTimeout != 0 {
+		deadline = s.firstFailure.Add(p.GiveUpTimeout)
+		if !now.Before(deadline) {
+			return retryDecision{giveUp: true, reason: fmt.Sprintf("errors persisted for longer than %s", p.GiveUpTimeout)}
+		}
+	}
+	return retryDecision{wait: p.backoff(s.failures, rnd), deadline: deadline}
+}
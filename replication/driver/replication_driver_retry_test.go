@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialInterval: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+	require.NoError(t, p.Validate())
+
+	// rnd = 0.5 means no jitter
+	assert.Equal(t, 10*time.Second, p.backoff(1, 0.5))
+	assert.Equal(t, 20*time.Second, p.backoff(2, 0.5))
+	assert.Equal(t, 80*time.Second, p.backoff(4, 0.5))
+
+	// jitter bounds
+	assert.Equal(t, 5*time.Second, p.backoff(1, 0))
+	assert.Equal(t, 15*time.Second, p.backoff(1, 1))
+
+	// no overflow
+	assert.Equal(t, time.Duration(1<<63-1), p.backoff(100, 0.5))
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	require.NoError(t, DefaultRetryPolicies().Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: -1, Multiplier: 1}.Validate())
+	assert.Error(t, RetryPolicy{Multiplier: 0.5}.Validate())
+	assert.Error(t, RetryPolicy{Multiplier: 1, Jitter: 1.5}.Validate())
+	assert.Error(t, RetryPolicy{Multiplier: 1, InitialInterval: -1}.Validate())
+}
+
+func TestRetryStateMaxAttempts(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Second, Multiplier: 3}
+	var s retryState
+	now := time.Now()
+
+	d := s.failed(p, now, 0.5)
+	assert.False(t, d.giveUp)
+	assert.Equal(t, time.Second, d.wait)
+	assert.True(t, d.deadline.IsZero())
+
+	d = s.failed(p, now, 0.5)
+	assert.False(t, d.giveUp)
+	assert.Equal(t, 3*time.Second, d.wait)
+
+	d = s.failed(p, now, 0.5)
+	assert.True(t, d.giveUp)
+}
+
+func TestRetryStateGiveUpTimeout(t *testing.T) {
+	p := RetryPolicy{InitialInterval: time.Second, Multiplier: 1, GiveUpTimeout: time.Minute}
+	var s retryState
+	begin := time.Now()
+
+	d := s.failed(p, begin, 0.5)
+	assert.False(t, d.giveUp)
+	assert.Equal(t, begin.Add(time.Minute), d.deadline)
+
+	d = s.failed(p, begin.Add(59*time.Second), 0.5)
+	assert.False(t, d.giveUp)
+	assert.Equal(t, begin.Add(time.Minute), d.deadline, "deadline is relative to the first failure")
+
+	d = s.failed(p, begin.Add(time.Minute), 0.5)
+	assert.True(t, d.giveUp)
+}
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilesystemSelection restricts a replication run to the planned filesystems it matches,
+// e.g. to re-replicate a single filesystem after fixing it. A nil selection matches all filesystems.
+//
+// An entry matches the filesystem of that name, or with suffix "<",
+// the filesystem and all its descendants (same syntax as the `filesystems` filter).
+// The names are those of the sending side, i.e., for pull jobs, the names on the source job's host.
+type FilesystemSelection []string
+
+func (s FilesystemSelection) Validate() error {
+	for _, e := range s {
+		if strings.TrimSuffix(e, "<") == "" {
+			return fmt.Errorf("invalid filesystem selection entry %q", e)
+		}
+	}
+	return nil
+}
+
+func (s FilesystemSelection) Matches(name string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, e := range s {
+		if subtree := strings.TrimSuffix(e, "<"); subtree != e {
+			if name == subtree || strings.HasPrefix(name, subtree+"/") {
+				return true
+			}
+		} else if name == e {
+			return true
+		}
+	}
+	return false
+}
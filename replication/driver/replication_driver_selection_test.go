@@ -0,0 +1,56 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/chainlock"
+)
+
+func TestFilesystemSelection(t *testing.T) {
+	assert.NoError(t, FilesystemSelection(nil).Validate())
+	assert.NoError(t, FilesystemSelection{"pool/a", "pool/b<"}.Validate())
+	assert.Error(t, FilesystemSelection{""}.Validate())
+	assert.Error(t, FilesystemSelection{"<"}.Validate())
+
+	assert.True(t, FilesystemSelection(nil).Matches("pool/a"))
+
+	s := FilesystemSelection{"pool/a", "pool/b<"}
+	assert.True(t, s.Matches("pool/a"))
+	assert.False(t, s.Matches("pool/a/child"))
+	assert.False(t, s.Matches("pool"))
+	assert.True(t, s.Matches("pool/b"))
+	assert.True(t, s.Matches("pool/b/child"))
+	assert.False(t, s.Matches("pool/bb"))
+}
+
+func TestFilesystemSelectionAppliedDuringPlanning(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	a := &attempt{
+		l: chainlock.New(),
+		planner: staticPlanner{
+			&onErrorFS{name: "pool"},
+			&onErrorFS{name: "pool/a"},
+			&onErrorFS{name: "pool/a/child"},
+			&onErrorFS{name: "pool/b"},
+		},
+		config: Config{StepQueueConcurrency: 1, Filesystems: FilesystemSelection{"pool/a<"}},
+	}
+	a.do(ctx, nil)
+
+	var rep *report.AttemptReport
+	a.l.HoldWhile(func() { rep = a.report() })
+	assert.Equal(t, report.AttemptDone, rep.State)
+	assert.Equal(t, []string{"pool/a<"}, rep.SelectedFilesystems)
+	var names []string
+	for _, fs := range rep.Filesystems {
+		names = append(names, fs.Info.Name)
+	}
+	assert.ElementsMatch(t, []string{"pool/a", "pool/a/child"}, names)
+}
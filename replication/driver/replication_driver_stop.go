@@ -0,0 +1,27 @@
+package driver
+
+import "errors"
+
+// ErrStopped is the error of the filesystems whose planning or next step
+// was not started because Config.Stop was closed.
+var ErrStopped = errors.New("replication stopped")
+
+func (c Config) stopped() bool {
+	select {
+	case <-c.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkStop returns ErrStopped if Config.Stop was closed.
+// Steps that are already executing are not interrupted.
+func (f *fs) checkStop() error {
+	select {
+	case <-f.stop:
+		return ErrStopped
+	default:
+		return nil
+	}
+}
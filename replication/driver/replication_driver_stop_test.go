@@ -0,0 +1,95 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// stopFS has two incremental steps, the first one closes stop
+type stopFS struct {
+	name     string
+	stop     chan struct{} // nil if the fs does not stop the run
+	executed []string
+}
+
+func (f *stopFS) EqualToPreviousAttempt(other FS) bool {
+	return f.name == other.(*stopFS).name
+}
+
+func (f *stopFS) PlanFS(ctx context.Context) ([]Step, error) {
+	return []Step{
+		&stopStep{fs: f, ident: "a", targetDate: time.Unix(1, 0)},
+		&stopStep{fs: f, ident: "b", targetDate: time.Unix(2, 0)},
+	}, nil
+}
+
+func (f *stopFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: f.name}
+}
+
+type stopStep struct {
+	fs         *stopFS
+	ident      string
+	targetDate time.Time
+}
+
+func (s *stopStep) TargetEquals(other Step) bool { return s.ident == other.(*stopStep).ident }
+
+func (s *stopStep) TargetDate() time.Time { return s.targetDate }
+
+func (s *stopStep) Step(ctx context.Context) error {
+	s.fs.executed = append(s.fs.executed, s.ident)
+	if s.fs.stop != nil && s.ident == "a" {
+		close(s.fs.stop)
+	}
+	return nil
+}
+
+func (s *stopStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "from", To: s.ident} // incremental
+}
+
+func TestStop(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	stop := make(chan struct{})
+	pool := &stopFS{name: "pool", stop: stop}
+	poolB := &stopFS{name: "pool/b"}
+	retryImmediately := RetryPolicy{Multiplier: 1}
+	config := Config{
+		// one filesystem at a time, in lexicographical order
+		StepQueueConcurrency:  1,
+		FilesystemConcurrency: 1,
+		// would retry the stopped filesystems forever
+		Retry:   RetryPolicies{Planning: retryImmediately, Network: retryImmediately, ZFS: retryImmediately},
+		OnError: OnErrorContinue,
+		Stop:    stop,
+	}
+	getReport, wait := Do(ctx, config, staticPlanner{pool, poolB})
+	wait(true)
+
+	// the step that was executing when the stop was requested completed
+	assert.Equal(t, []string{"a"}, pool.executed)
+	assert.Empty(t, poolB.executed)
+
+	rep := getReport()
+	require.Len(t, rep.Attempts, 1, "must not retry after a stop")
+	states := make(map[string]report.FilesystemState)
+	for _, fs := range rep.Attempts[0].Filesystems {
+		states[fs.Info.Name] = fs.State
+		require.NotNil(t, fs.Error())
+		assert.Equal(t, ErrStopped.Error(), fs.Error().Err)
+	}
+	assert.Equal(t, map[string]report.FilesystemState{
+		"pool":   report.FilesystemSteppingErrored,
+		"pool/b": report.FilesystemPlanningErrored,
+	}, states)
+}
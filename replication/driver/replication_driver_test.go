@@ -154,7 +154,11 @@ func TestReplication(t *testing.T) {
 	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
 
 	mp := &mockPlanner{}
-	getReport, wait := Do(ctx, mp)
+	driverConfig := Config{
+		StepQueueConcurrency: 1,
+		Retry:                DefaultRetryPolicies(),
+	}
+	getReport, wait := Do(ctx, driverConfig, mp)
 	begin := time.Now()
 	fireAt := []time.Duration{
 		// the following values are relative to the start
@@ -217,3 +221,25 @@ func TestReplication(t *testing.T) {
 	}
 
 }
+
+func TestDryRun(t *testing.T) {
+
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	mp := &mockPlanner{}
+	rep := DryRun(ctx, mp)
+
+	require.Equal(t, report.AttemptDone, rep.State)
+	require.Len(t, rep.Filesystems, 2)
+	assert.Equal(t, "zroot/one", rep.Filesystems[0].Info.Name)
+	assert.Equal(t, "zroot/two", rep.Filesystems[1].Info.Name)
+	for _, fs := range rep.Filesystems {
+		assert.Equal(t, report.FilesystemDone, fs.State)
+	}
+	assert.Len(t, rep.Filesystems[0].Steps, 3)
+	assert.Len(t, rep.Filesystems[1].Steps, 2)
+
+	// no step must have been executed
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&mp.stepCounter))
+}
@@ -11,6 +11,7 @@ import (
 
 type stepQueueRec struct {
 	ident      interface{}
+	priority   int
 	targetDate time.Time
 	wakeup     chan StepCompletedFunc
 }
@@ -23,10 +24,22 @@ type stepQueue struct {
 type stepQueueHeapItem struct {
 	idx int
 	req stepQueueRec
+	// number of times req.ident was woken up before req was queued
+	wakeups int
 }
 type stepQueueHeap []*stepQueueHeapItem
 
+// Idents with higher priority are always preferred.
+// Among those, idents that were woken up fewer times are preferred so that an ident
+// with many steps (e.g. a huge dataset) does not starve the others.
+// Among those, the oldest target date wins.
 func (h stepQueueHeap) Less(i, j int) bool {
+	if h[i].req.priority != h[j].req.priority {
+		return h[i].req.priority > h[j].req.priority
+	}
+	if h[i].wakeups != h[j].wakeups {
+		return h[i].wakeups < h[j].wakeups
+	}
 	return h[i].req.targetDate.Before(h[j].req.targetDate)
 }
 
@@ -78,6 +91,8 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 	pending := &stepQueueHeap{}
 	// ident => queueItem
 	queueItems := make(map[interface{}]*stepQueueHeapItem)
+	// ident => number of wakeups, for fair scheduling
+	wakeups := make(map[interface{}]int)
 	// stopped is used for cancellation of "wake" goroutine
 	stopped := false
 	active := 0
@@ -104,7 +119,8 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 						panic("WaitReady must not be called twice for the same ident")
 					}
 					qitem := &stepQueueHeapItem{
-						req: req,
+						req:     req,
+						wakeups: wakeups[req.ident],
 					}
 					queueItems[req.ident] = qitem
 					heap.Push(pending, qitem)
@@ -129,6 +145,7 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 			active++
 			next := heap.Pop(pending).(*stepQueueHeapItem).req
 			delete(queueItems, next.ident)
+			wakeups[next.ident]++
 
 			next.wakeup <- func() {
 				defer l.Lock().Unlock()
@@ -146,9 +163,10 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 
 type StepCompletedFunc func()
 
-func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, targetDate time.Time) StepCompletedFunc {
+func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, priority int, targetDate time.Time) StepCompletedFunc {
 	req := stepQueueRec{
 		ident,
+		priority,
 		targetDate,
 		make(chan StepCompletedFunc),
 	}
@@ -156,11 +174,11 @@ func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, targetDate time.Time
 	return <-req.wakeup
 }
 
-// Wait for the ident with targetDate to be selected to run.
-func (q *stepQueue) WaitReady(ctx context.Context, ident interface{}, targetDate time.Time) StepCompletedFunc {
+// Wait for the ident with priority and targetDate to be selected to run.
+func (q *stepQueue) WaitReady(ctx context.Context, ident interface{}, priority int, targetDate time.Time) StepCompletedFunc {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
 	if targetDate.IsZero() {
 		panic("targetDate of zero is reserved for marking Done")
 	}
-	return q.sendAndWaitForWakeup(ident, targetDate)
+	return q.sendAndWaitForWakeup(ident, priority, targetDate)
 }
@@ -29,7 +29,7 @@ func TestPqNotconcurrent(t *testing.T) {
 		ctx, end := trace.WithTaskFromStack(ctx)
 		defer end()
 		defer wg.Done()
-		defer q.WaitReady(ctx, "1", time.Unix(9999, 0))()
+		defer q.WaitReady(ctx, "1", 0, time.Unix(9999, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(1), ret)
 		time.Sleep(1 * time.Second)
@@ -44,7 +44,7 @@ func TestPqNotconcurrent(t *testing.T) {
 		ctx, end := trace.WithTaskFromStack(ctx)
 		defer end()
 		defer wg.Done()
-		defer q.WaitReady(ctx, "2", time.Unix(2, 0))()
+		defer q.WaitReady(ctx, "2", 0, time.Unix(2, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(2), ret)
 	}()
@@ -52,7 +52,7 @@ func TestPqNotconcurrent(t *testing.T) {
 		ctx, end := trace.WithTaskFromStack(ctx)
 		defer end()
 		defer wg.Done()
-		defer q.WaitReady(ctx, "3", time.Unix(3, 0))()
+		defer q.WaitReady(ctx, "3", 0, time.Unix(3, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(3), ret)
 	}()
@@ -60,7 +60,7 @@ func TestPqNotconcurrent(t *testing.T) {
 		ctx, end := trace.WithTaskFromStack(ctx)
 		defer end()
 		defer wg.Done()
-		defer q.WaitReady(ctx, "4", time.Unix(4, 0))()
+		defer q.WaitReady(ctx, "4", 0, time.Unix(4, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(4), ret)
 	}()
@@ -112,7 +112,7 @@ func TestPqConcurrent(t *testing.T) {
 			for step := 0; step < stepsPerFS; step++ {
 				pos := atomic.AddUint32(&globalCtr, 1)
 				t := time.Unix(int64(step), 0)
-				done := q.WaitReady(ctx, fs, t)
+				done := q.WaitReady(ctx, fs, 0, t)
 				wakeAt := time.Since(begin)
 				time.Sleep(sleepTimePerStep)
 				done()
@@ -192,3 +192,76 @@ func TestPqConcurrent(t *testing.T) {
 	}
 
 }
+
+func TestPqFairness(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+
+	q := newStepQueue()
+	var ctr uint32
+	var smallPos uint32
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		// the huge filesystem's steps all have older target dates than the small one's
+		for step := 0; step < 5; step++ {
+			done := q.WaitReady(ctx, "huge", 0, time.Unix(int64(step+1), 0))
+			atomic.AddUint32(&ctr, 1)
+			time.Sleep(10 * time.Millisecond)
+			done()
+		}
+	}()
+	go func() {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		defer q.WaitReady(ctx, "small", 0, time.Unix(100, 0))()
+		atomic.StoreUint32(&smallPos, atomic.AddUint32(&ctr, 1))
+	}()
+
+	// give both goroutines time to enqueue
+	time.Sleep(100 * time.Millisecond)
+	defer q.Start(1)()
+	wg.Wait()
+
+	assert.Equal(t, uint32(2), atomic.LoadUint32(&smallPos), "small must run after the first step of huge")
+}
+
+func TestPqPriority(t *testing.T) {
+	ctx, end := trace.WithTaskFromStack(context.Background())
+	defer end()
+	q := newStepQueue()
+	var ctr uint32
+	var criticalPos uint32
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		// the bulk filesystem's steps all have older target dates than the critical one's
+		for step := 0; step < 3; step++ {
+			done := q.WaitReady(ctx, "bulk", 0, time.Unix(int64(step+1), 0))
+			atomic.AddUint32(&ctr, 1)
+			time.Sleep(10 * time.Millisecond)
+			done()
+		}
+	}()
+	go func() {
+		ctx, end := trace.WithTaskFromStack(ctx)
+		defer end()
+		defer wg.Done()
+		defer q.WaitReady(ctx, "critical", 10, time.Unix(100, 0))()
+		atomic.StoreUint32(&criticalPos, atomic.AddUint32(&ctr, 1))
+	}()
+
+	// give both goroutines time to enqueue
+	time.Sleep(100 * time.Millisecond)
+	defer q.Start(1)()
+	wg.Wait()
+
+	assert.Equal(t, uint32(1), atomic.LoadUint32(&criticalPos), "critical must run before bulk")
+}
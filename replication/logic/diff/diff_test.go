@@ -127,4 +127,10 @@ func TestIncrementalPath_BookmarkSupport(t *testing.T) {
 		assert.Equal(t, l("@a,1", "@b,2"), path)
 	})
 
+	// the sender pruned the common snapshot, but the replication cursor bookmark (different name, same guid) remains
+	doTest(l("@a,1", "@b,2"), l("#zrepl_CURSOR_G_2_J_job,2", "@c,3", "@d,4"), func(path []*FilesystemVersion, conflict error) {
+		assert.Nil(t, conflict)
+		assert.Equal(t, l("#zrepl_CURSOR_G_2_J_job,2", "@c,3", "@d,4"), path)
+	})
+
 }
@@ -132,10 +132,22 @@ func (m *ListFilesystemReq) XXX_DiscardUnknown() {
 var xxx_messageInfo_ListFilesystemReq proto.InternalMessageInfo
 
 type ListFilesystemRes struct {
-	Filesystems          []*Filesystem `protobuf:"bytes,1,rep,name=Filesystems,proto3" json:"Filesystems,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
-	XXX_unrecognized     []byte        `json:"-"`
-	XXX_sizecache        int32         `json:"-"`
+	Filesystems []*Filesystem `protobuf:"bytes,1,rep,name=Filesystems,proto3" json:"Filesystems,omitempty"`
+	// Receiver only: the features (enabled or active) of the pool that
+	// contains the receiver's root_fs. Older receivers don't report them.
+	RootFSPoolFeatures      []string `protobuf:"bytes,2,rep,name=RootFSPoolFeatures,proto3" json:"RootFSPoolFeatures,omitempty"`
+	RootFSPoolFeaturesValid bool     `protobuf:"varint,3,opt,name=RootFSPoolFeaturesValid,proto3" json:"RootFSPoolFeaturesValid,omitempty"`
+	// Sender only: the flags of the sender's sends, the active side of
+	// a pull job does not know them. Older senders don't report them.
+	SendFlagsValid       bool     `protobuf:"varint,4,opt,name=SendFlagsValid,proto3" json:"SendFlagsValid,omitempty"`
+	SendEncrypted        bool     `protobuf:"varint,5,opt,name=SendEncrypted,proto3" json:"SendEncrypted,omitempty"`
+	SendRaw              bool     `protobuf:"varint,6,opt,name=SendRaw,proto3" json:"SendRaw,omitempty"`
+	SendCompressed       bool     `protobuf:"varint,7,opt,name=SendCompressed,proto3" json:"SendCompressed,omitempty"`
+	SendEmbeddedData     bool     `protobuf:"varint,8,opt,name=SendEmbeddedData,proto3" json:"SendEmbeddedData,omitempty"`
+	SendLargeBlocks      bool     `protobuf:"varint,9,opt,name=SendLargeBlocks,proto3" json:"SendLargeBlocks,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ListFilesystemRes) Reset()         { *m = ListFilesystemRes{} }
@@ -169,14 +181,73 @@ func (m *ListFilesystemRes) GetFilesystems() []*Filesystem {
 	return nil
 }
 
+func (m *ListFilesystemRes) GetRootFSPoolFeatures() []string {
+	if m != nil {
+		return m.RootFSPoolFeatures
+	}
+	return nil
+}
+
+func (m *ListFilesystemRes) GetRootFSPoolFeaturesValid() bool {
+	if m != nil {
+		return m.RootFSPoolFeaturesValid
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendFlagsValid() bool {
+	if m != nil {
+		return m.SendFlagsValid
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendEncrypted() bool {
+	if m != nil {
+		return m.SendEncrypted
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendRaw() bool {
+	if m != nil {
+		return m.SendRaw
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendCompressed() bool {
+	if m != nil {
+		return m.SendCompressed
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendEmbeddedData() bool {
+	if m != nil {
+		return m.SendEmbeddedData
+	}
+	return false
+}
+
+func (m *ListFilesystemRes) GetSendLargeBlocks() bool {
+	if m != nil {
+		return m.SendLargeBlocks
+	}
+	return false
+}
+
 type Filesystem struct {
-	Path                 string   `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
-	ResumeToken          string   `protobuf:"bytes,2,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	IsPlaceholder        bool     `protobuf:"varint,3,opt,name=IsPlaceholder,proto3" json:"IsPlaceholder,omitempty"`
-	IsEncrypted          bool     `protobuf:"varint,4,opt,name=IsEncrypted,proto3" json:"IsEncrypted,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Path          string `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
+	ResumeToken   string `protobuf:"bytes,2,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	IsPlaceholder bool   `protobuf:"varint,3,opt,name=IsPlaceholder,proto3" json:"IsPlaceholder,omitempty"`
+	IsEncrypted   bool   `protobuf:"varint,4,opt,name=IsEncrypted,proto3" json:"IsEncrypted,omitempty"`
+	// Replication cursors of the local jobs that replicate the filesystem further
+	// (cascading replication), only set by receivers
+	Downstream           []*DownstreamCursor `protobuf:"bytes,5,rep,name=Downstream,proto3" json:"Downstream,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
 }
 
 func (m *Filesystem) Reset()         { *m = Filesystem{} }
@@ -231,8 +302,18 @@ func (m *Filesystem) GetIsEncrypted() bool {
 	return false
 }
 
+func (m *Filesystem) GetDownstream() []*DownstreamCursor {
+	if m != nil {
+		return m.Downstream
+	}
+	return nil
+}
+
 type ListFilesystemVersionsReq struct {
-	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// ZFS user properties to list along with the versions,
+	// see FilesystemVersion.UserProperties
+	UserProperties       []string `protobuf:"bytes,2,rep,name=UserProperties,proto3" json:"UserProperties,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -269,6 +350,13 @@ func (m *ListFilesystemVersionsReq) GetFilesystem() string {
 	return ""
 }
 
+func (m *ListFilesystemVersionsReq) GetUserProperties() []string {
+	if m != nil {
+		return m.UserProperties
+	}
+	return nil
+}
+
 type ListFilesystemVersionsRes struct {
 	Versions             []*FilesystemVersion `protobuf:"bytes,1,rep,name=Versions,proto3" json:"Versions,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
@@ -308,14 +396,17 @@ func (m *ListFilesystemVersionsRes) GetVersions() []*FilesystemVersion {
 }
 
 type FilesystemVersion struct {
-	Type                 FilesystemVersion_VersionType `protobuf:"varint,1,opt,name=Type,proto3,enum=FilesystemVersion_VersionType" json:"Type,omitempty"`
-	Name                 string                        `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
-	Guid                 uint64                        `protobuf:"varint,3,opt,name=Guid,proto3" json:"Guid,omitempty"`
-	CreateTXG            uint64                        `protobuf:"varint,4,opt,name=CreateTXG,proto3" json:"CreateTXG,omitempty"`
-	Creation             string                        `protobuf:"bytes,5,opt,name=Creation,proto3" json:"Creation,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}                      `json:"-"`
-	XXX_unrecognized     []byte                        `json:"-"`
-	XXX_sizecache        int32                         `json:"-"`
+	Type      FilesystemVersion_VersionType `protobuf:"varint,1,opt,name=Type,proto3,enum=FilesystemVersion_VersionType" json:"Type,omitempty"`
+	Name      string                        `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
+	Guid      uint64                        `protobuf:"varint,3,opt,name=Guid,proto3" json:"Guid,omitempty"`
+	CreateTXG uint64                        `protobuf:"varint,4,opt,name=CreateTXG,proto3" json:"CreateTXG,omitempty"`
+	Creation  string                        `protobuf:"bytes,5,opt,name=Creation,proto3" json:"Creation,omitempty"`
+	// the ListFilesystemVersionsReq.UserProperties of the version,
+	// the empty string if a property is not set
+	UserProperties       map[string]string `protobuf:"bytes,6,rep,name=UserProperties,proto3" json:"UserProperties,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *FilesystemVersion) Reset()         { *m = FilesystemVersion{} }
@@ -377,6 +468,13 @@ func (m *FilesystemVersion) GetCreation() string {
 	return ""
 }
 
+func (m *FilesystemVersion) GetUserProperties() map[string]string {
+	if m != nil {
+		return m.UserProperties
+	}
+	return nil
+}
+
 type SendReq struct {
 	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	// May be empty / null to request a full transfer of To
@@ -388,13 +486,21 @@ type SendReq struct {
 	// SHOULD clear the resume token on their side and use From and To instead If
 	// ResumeToken is not empty, the GUIDs of From and To MUST correspond to those
 	// encoded in the ResumeToken. Otherwise, the Sender MUST return an error.
-	ResumeToken          string             `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	Encrypted            Tri                `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
-	DryRun               bool               `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
-	ReplicationConfig    *ReplicationConfig `protobuf:"bytes,7,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
-	XXX_unrecognized     []byte             `json:"-"`
-	XXX_sizecache        int32              `json:"-"`
+	ResumeToken       string             `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	Encrypted         Tri                `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
+	DryRun            bool               `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	ReplicationConfig *ReplicationConfig `protobuf:"bytes,7,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
+	// If true, the stream includes all snapshots between From and To (zfs send -I).
+	// From must be a snapshot.
+	Intermediates bool `protobuf:"varint,8,opt,name=Intermediates,proto3" json:"Intermediates,omitempty"`
+	// If not empty, the receiver asks the sender to compress the stream on the
+	// wire with the given algorithm and level.
+	// The sender MAY ignore the request, see SendRes.StreamCompression.
+	StreamCompression      string   `protobuf:"bytes,9,opt,name=StreamCompression,proto3" json:"StreamCompression,omitempty"`
+	StreamCompressionLevel int32    `protobuf:"varint,10,opt,name=StreamCompressionLevel,proto3" json:"StreamCompressionLevel,omitempty"`
+	XXX_NoUnkeyedLiteral   struct{} `json:"-"`
+	XXX_unrecognized       []byte   `json:"-"`
+	XXX_sizecache          int32    `json:"-"`
 }
 
 func (m *SendReq) Reset()         { *m = SendReq{} }
@@ -470,6 +576,27 @@ func (m *SendReq) GetReplicationConfig() *ReplicationConfig {
 	return nil
 }
 
+func (m *SendReq) GetIntermediates() bool {
+	if m != nil {
+		return m.Intermediates
+	}
+	return false
+}
+
+func (m *SendReq) GetStreamCompression() string {
+	if m != nil {
+		return m.StreamCompression
+	}
+	return ""
+}
+
+func (m *SendReq) GetStreamCompressionLevel() int32 {
+	if m != nil {
+		return m.StreamCompressionLevel
+	}
+	return 0
+}
+
 type ReplicationConfig struct {
 	Protection           *ReplicationConfigProtection `protobuf:"bytes,1,opt,name=protection,proto3" json:"protection,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
@@ -606,11 +733,17 @@ type SendRes struct {
 	UsedResumeToken bool `protobuf:"varint,2,opt,name=UsedResumeToken,proto3" json:"UsedResumeToken,omitempty"`
 	// Expected stream size determined by dry run, not exact.
 	// 0 indicates that for the given SendReq, no size estimate could be made.
-	ExpectedSize         int64       `protobuf:"varint,3,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
-	Properties           []*Property `protobuf:"bytes,4,rep,name=Properties,proto3" json:"Properties,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	ExpectedSize int64       `protobuf:"varint,3,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
+	Properties   []*Property `protobuf:"bytes,4,rep,name=Properties,proto3" json:"Properties,omitempty"`
+	// The algorithm with which the stream is compressed on the wire,
+	// empty if the stream is not compressed.
+	StreamCompression string `protobuf:"bytes,5,opt,name=StreamCompression,proto3" json:"StreamCompression,omitempty"`
+	// Whether the stream includes all snapshots between From and To,
+	// i.e., whether the sender honored SendReq.Intermediates.
+	Intermediates        bool     `protobuf:"varint,6,opt,name=Intermediates,proto3" json:"Intermediates,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *SendRes) Reset()         { *m = SendRes{} }
@@ -658,6 +791,20 @@ func (m *SendRes) GetProperties() []*Property {
 	return nil
 }
 
+func (m *SendRes) GetStreamCompression() string {
+	if m != nil {
+		return m.StreamCompression
+	}
+	return ""
+}
+
+func (m *SendRes) GetIntermediates() bool {
+	if m != nil {
+		return m.Intermediates
+	}
+	return false
+}
+
 type SendCompletedReq struct {
 	OriginalReq          *SendReq `protobuf:"bytes,2,opt,name=OriginalReq,proto3" json:"OriginalReq,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -731,8 +878,20 @@ type ReceiveReq struct {
 	To         *FilesystemVersion `protobuf:"bytes,2,opt,name=To,proto3" json:"To,omitempty"`
 	// If true, the receiver should clear the resume token before performing the
 	// zfs recv of the stream in the request
-	ClearResumeToken     bool               `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
-	ReplicationConfig    *ReplicationConfig `protobuf:"bytes,4,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
+	ClearResumeToken  bool               `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
+	ReplicationConfig *ReplicationConfig `protobuf:"bytes,4,opt,name=ReplicationConfig,proto3" json:"ReplicationConfig,omitempty"`
+	// If set, the receiver's Filesystem has diverged from the sender.
+	// The receiver should set the divergent state aside and reset Filesystem
+	// to its snapshot RollbackTo, the most recent common snapshot,
+	// before performing the zfs recv of the stream in the request.
+	RollbackTo *FilesystemVersion `protobuf:"bytes,5,opt,name=RollbackTo,proto3" json:"RollbackTo,omitempty"`
+	// The algorithm with which the stream is compressed on the wire,
+	// empty if the stream is not compressed.
+	// Must be one of PingRes.StreamCompressions.
+	StreamCompression string `protobuf:"bytes,6,opt,name=StreamCompression,proto3" json:"StreamCompression,omitempty"`
+	// The incremental source of the stream, nil for full sends.
+	// Informational only, e.g., for the hooks of the receiver.
+	From                 *FilesystemVersion `protobuf:"bytes,7,opt,name=From,proto3" json:"From,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
 	XXX_unrecognized     []byte             `json:"-"`
 	XXX_sizecache        int32              `json:"-"`
@@ -790,6 +949,27 @@ func (m *ReceiveReq) GetReplicationConfig() *ReplicationConfig {
 	return nil
 }
 
+func (m *ReceiveReq) GetRollbackTo() *FilesystemVersion {
+	if m != nil {
+		return m.RollbackTo
+	}
+	return nil
+}
+
+func (m *ReceiveReq) GetStreamCompression() string {
+	if m != nil {
+		return m.StreamCompression
+	}
+	return ""
+}
+
+func (m *ReceiveReq) GetFrom() *FilesystemVersion {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
 type ReceiveRes struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -823,10 +1003,14 @@ var xxx_messageInfo_ReceiveRes proto.InternalMessageInfo
 type DestroySnapshotsReq struct {
 	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	// Path to filesystem, snapshot or bookmark to be destroyed
-	Snapshots            []*FilesystemVersion `protobuf:"bytes,2,rep,name=Snapshots,proto3" json:"Snapshots,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	Snapshots []*FilesystemVersion `protobuf:"bytes,2,rep,name=Snapshots,proto3" json:"Snapshots,omitempty"`
+	// Snapshots that have clones cannot be destroyed. If set, they are destroyed
+	// with `zfs destroy -d`, i.e., once their clones are destroyed.
+	// Otherwise, they are kept (see DestroySnapshotRes.KeptReason).
+	DeferSnapshotsWithClones bool     `protobuf:"varint,3,opt,name=DeferSnapshotsWithClones,proto3" json:"DeferSnapshotsWithClones,omitempty"`
+	XXX_NoUnkeyedLiteral     struct{} `json:"-"`
+	XXX_unrecognized         []byte   `json:"-"`
+	XXX_sizecache            int32    `json:"-"`
 }
 
 func (m *DestroySnapshotsReq) Reset()         { *m = DestroySnapshotsReq{} }
@@ -867,12 +1051,22 @@ func (m *DestroySnapshotsReq) GetSnapshots() []*FilesystemVersion {
 	return nil
 }
 
+func (m *DestroySnapshotsReq) GetDeferSnapshotsWithClones() bool {
+	if m != nil {
+		return m.DeferSnapshotsWithClones
+	}
+	return false
+}
+
 type DestroySnapshotRes struct {
-	Snapshot             *FilesystemVersion `protobuf:"bytes,1,opt,name=Snapshot,proto3" json:"Snapshot,omitempty"`
-	Error                string             `protobuf:"bytes,2,opt,name=Error,proto3" json:"Error,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
-	XXX_unrecognized     []byte             `json:"-"`
-	XXX_sizecache        int32              `json:"-"`
+	Snapshot *FilesystemVersion `protobuf:"bytes,1,opt,name=Snapshot,proto3" json:"Snapshot,omitempty"`
+	Error    string             `protobuf:"bytes,2,opt,name=Error,proto3" json:"Error,omitempty"`
+	// If not empty, the snapshot was not destroyed on purpose, e.g. because
+	// a downstream job has not replicated it yet. This is not an error.
+	KeptReason           string   `protobuf:"bytes,3,opt,name=KeptReason,proto3" json:"KeptReason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *DestroySnapshotRes) Reset()         { *m = DestroySnapshotRes{} }
@@ -913,6 +1107,13 @@ func (m *DestroySnapshotRes) GetError() string {
 	return ""
 }
 
+func (m *DestroySnapshotRes) GetKeptReason() string {
+	if m != nil {
+		return m.KeptReason
+	}
+	return ""
+}
+
 type DestroySnapshotsRes struct {
 	Results              []*DestroySnapshotRes `protobuf:"bytes,1,rep,name=Results,proto3" json:"Results,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
@@ -1168,7 +1369,9 @@ func (m *PingReq) GetMessage() string {
 
 type PingRes struct {
 	// Echo must be PingReq.Message
-	Echo                 string   `protobuf:"bytes,1,opt,name=Echo,proto3" json:"Echo,omitempty"`
+	Echo string `protobuf:"bytes,1,opt,name=Echo,proto3" json:"Echo,omitempty"`
+	// The stream compression algorithms supported by the data connection.
+	StreamCompressions   []string `protobuf:"bytes,2,rep,name=StreamCompressions,proto3" json:"StreamCompressions,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -1205,6 +1408,248 @@ func (m *PingRes) GetEcho() string {
 	return ""
 }
 
+func (m *PingRes) GetStreamCompressions() []string {
+	if m != nil {
+		return m.StreamCompressions
+	}
+	return nil
+}
+
+type SendStreamDigestReq struct {
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// May be empty / null to request a full send
+	From *FilesystemVersion `protobuf:"bytes,2,opt,name=From,proto3" json:"From,omitempty"`
+	To   *FilesystemVersion `protobuf:"bytes,3,opt,name=To,proto3" json:"To,omitempty"`
+	// send -w, also for unencrypted filesystems
+	Raw                  bool     `protobuf:"varint,4,opt,name=Raw,proto3" json:"Raw,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SendStreamDigestReq) Reset()         { *m = SendStreamDigestReq{} }
+func (m *SendStreamDigestReq) String() string { return proto.CompactTextString(m) }
+func (*SendStreamDigestReq) ProtoMessage()    {}
+func (*SendStreamDigestReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_616c27178643eca4, []int{22}
+}
+func (m *SendStreamDigestReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendStreamDigestReq.Unmarshal(m, b)
+}
+func (m *SendStreamDigestReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendStreamDigestReq.Marshal(b, m, deterministic)
+}
+func (dst *SendStreamDigestReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendStreamDigestReq.Merge(dst, src)
+}
+func (m *SendStreamDigestReq) XXX_Size() int {
+	return xxx_messageInfo_SendStreamDigestReq.Size(m)
+}
+func (m *SendStreamDigestReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendStreamDigestReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendStreamDigestReq proto.InternalMessageInfo
+
+func (m *SendStreamDigestReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *SendStreamDigestReq) GetFrom() *FilesystemVersion {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *SendStreamDigestReq) GetTo() *FilesystemVersion {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+func (m *SendStreamDigestReq) GetRaw() bool {
+	if m != nil {
+		return m.Raw
+	}
+	return false
+}
+
+type SendStreamDigestRes struct {
+	// hex-encoded digest of the stream's records, see zfs.SendStreamDigest
+	Digest               string   `protobuf:"bytes,1,opt,name=Digest,proto3" json:"Digest,omitempty"`
+	StreamSize           int64    `protobuf:"varint,2,opt,name=StreamSize,proto3" json:"StreamSize,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SendStreamDigestRes) Reset()         { *m = SendStreamDigestRes{} }
+func (m *SendStreamDigestRes) String() string { return proto.CompactTextString(m) }
+func (*SendStreamDigestRes) ProtoMessage()    {}
+func (*SendStreamDigestRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_616c27178643eca4, []int{23}
+}
+func (m *SendStreamDigestRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendStreamDigestRes.Unmarshal(m, b)
+}
+func (m *SendStreamDigestRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendStreamDigestRes.Marshal(b, m, deterministic)
+}
+func (dst *SendStreamDigestRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendStreamDigestRes.Merge(dst, src)
+}
+func (m *SendStreamDigestRes) XXX_Size() int {
+	return xxx_messageInfo_SendStreamDigestRes.Size(m)
+}
+func (m *SendStreamDigestRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendStreamDigestRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendStreamDigestRes proto.InternalMessageInfo
+
+func (m *SendStreamDigestRes) GetDigest() string {
+	if m != nil {
+		return m.Digest
+	}
+	return ""
+}
+
+func (m *SendStreamDigestRes) GetStreamSize() int64 {
+	if m != nil {
+		return m.StreamSize
+	}
+	return 0
+}
+
+type DownstreamCursor struct {
+	Job string `protobuf:"bytes,1,opt,name=Job,proto3" json:"Job,omitempty"`
+	// null if the downstream job has not replicated the filesystem yet
+	Cursor               *FilesystemVersion `protobuf:"bytes,2,opt,name=Cursor,proto3" json:"Cursor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *DownstreamCursor) Reset()         { *m = DownstreamCursor{} }
+func (m *DownstreamCursor) String() string { return proto.CompactTextString(m) }
+func (*DownstreamCursor) ProtoMessage()    {}
+func (*DownstreamCursor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_616c27178643eca4, []int{24}
+}
+func (m *DownstreamCursor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DownstreamCursor.Unmarshal(m, b)
+}
+func (m *DownstreamCursor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DownstreamCursor.Marshal(b, m, deterministic)
+}
+func (dst *DownstreamCursor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DownstreamCursor.Merge(dst, src)
+}
+func (m *DownstreamCursor) XXX_Size() int {
+	return xxx_messageInfo_DownstreamCursor.Size(m)
+}
+func (m *DownstreamCursor) XXX_DiscardUnknown() {
+	xxx_messageInfo_DownstreamCursor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DownstreamCursor proto.InternalMessageInfo
+
+func (m *DownstreamCursor) GetJob() string {
+	if m != nil {
+		return m.Job
+	}
+	return ""
+}
+
+func (m *DownstreamCursor) GetCursor() *FilesystemVersion {
+	if m != nil {
+		return m.Cursor
+	}
+	return nil
+}
+
+type AckReceivedReq struct {
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// the guid of the snapshot, which must exist on the sender
+	Guid                 uint64   `protobuf:"varint,2,opt,name=Guid,proto3" json:"Guid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AckReceivedReq) Reset()         { *m = AckReceivedReq{} }
+func (m *AckReceivedReq) String() string { return proto.CompactTextString(m) }
+func (*AckReceivedReq) ProtoMessage()    {}
+func (*AckReceivedReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_616c27178643eca4, []int{25}
+}
+func (m *AckReceivedReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AckReceivedReq.Unmarshal(m, b)
+}
+func (m *AckReceivedReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AckReceivedReq.Marshal(b, m, deterministic)
+}
+func (dst *AckReceivedReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AckReceivedReq.Merge(dst, src)
+}
+func (m *AckReceivedReq) XXX_Size() int {
+	return xxx_messageInfo_AckReceivedReq.Size(m)
+}
+func (m *AckReceivedReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_AckReceivedReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AckReceivedReq proto.InternalMessageInfo
+
+func (m *AckReceivedReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *AckReceivedReq) GetGuid() uint64 {
+	if m != nil {
+		return m.Guid
+	}
+	return 0
+}
+
+type AckReceivedRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AckReceivedRes) Reset()         { *m = AckReceivedRes{} }
+func (m *AckReceivedRes) String() string { return proto.CompactTextString(m) }
+func (*AckReceivedRes) ProtoMessage()    {}
+func (*AckReceivedRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_616c27178643eca4, []int{26}
+}
+func (m *AckReceivedRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AckReceivedRes.Unmarshal(m, b)
+}
+func (m *AckReceivedRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AckReceivedRes.Marshal(b, m, deterministic)
+}
+func (dst *AckReceivedRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AckReceivedRes.Merge(dst, src)
+}
+func (m *AckReceivedRes) XXX_Size() int {
+	return xxx_messageInfo_AckReceivedRes.Size(m)
+}
+func (m *AckReceivedRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_AckReceivedRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AckReceivedRes proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterType((*ListFilesystemReq)(nil), "ListFilesystemReq")
 	proto.RegisterType((*ListFilesystemRes)(nil), "ListFilesystemRes")
@@ -1212,6 +1657,7 @@ func init() {
 	proto.RegisterType((*ListFilesystemVersionsReq)(nil), "ListFilesystemVersionsReq")
 	proto.RegisterType((*ListFilesystemVersionsRes)(nil), "ListFilesystemVersionsRes")
 	proto.RegisterType((*FilesystemVersion)(nil), "FilesystemVersion")
+	proto.RegisterMapType((map[string]string)(nil), "FilesystemVersion.UserPropertiesEntry")
 	proto.RegisterType((*SendReq)(nil), "SendReq")
 	proto.RegisterType((*ReplicationConfig)(nil), "ReplicationConfig")
 	proto.RegisterType((*ReplicationConfigProtection)(nil), "ReplicationConfigProtection")
@@ -1228,6 +1674,11 @@ func init() {
 	proto.RegisterType((*ReplicationCursorRes)(nil), "ReplicationCursorRes")
 	proto.RegisterType((*PingReq)(nil), "PingReq")
 	proto.RegisterType((*PingRes)(nil), "PingRes")
+	proto.RegisterType((*SendStreamDigestReq)(nil), "SendStreamDigestReq")
+	proto.RegisterType((*SendStreamDigestRes)(nil), "SendStreamDigestRes")
+	proto.RegisterType((*DownstreamCursor)(nil), "DownstreamCursor")
+	proto.RegisterType((*AckReceivedReq)(nil), "AckReceivedReq")
+	proto.RegisterType((*AckReceivedRes)(nil), "AckReceivedRes")
 	proto.RegisterEnum("Tri", Tri_name, Tri_value)
 	proto.RegisterEnum("ReplicationGuaranteeKind", ReplicationGuaranteeKind_name, ReplicationGuaranteeKind_value)
 	proto.RegisterEnum("FilesystemVersion_VersionType", FilesystemVersion_VersionType_name, FilesystemVersion_VersionType_value)
@@ -1251,6 +1702,8 @@ type ReplicationClient interface {
 	DestroySnapshots(ctx context.Context, in *DestroySnapshotsReq, opts ...grpc.CallOption) (*DestroySnapshotsRes, error)
 	ReplicationCursor(ctx context.Context, in *ReplicationCursorReq, opts ...grpc.CallOption) (*ReplicationCursorRes, error)
 	SendCompleted(ctx context.Context, in *SendCompletedReq, opts ...grpc.CallOption) (*SendCompletedRes, error)
+	SendStreamDigest(ctx context.Context, in *SendStreamDigestReq, opts ...grpc.CallOption) (*SendStreamDigestRes, error)
+	AckReceived(ctx context.Context, in *AckReceivedReq, opts ...grpc.CallOption) (*AckReceivedRes, error)
 }
 
 type replicationClient struct {
@@ -1315,6 +1768,24 @@ func (c *replicationClient) SendCompleted(ctx context.Context, in *SendCompleted
 	return out, nil
 }
 
+func (c *replicationClient) SendStreamDigest(ctx context.Context, in *SendStreamDigestReq, opts ...grpc.CallOption) (*SendStreamDigestRes, error) {
+	out := new(SendStreamDigestRes)
+	err := c.cc.Invoke(ctx, "/Replication/SendStreamDigest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) AckReceived(ctx context.Context, in *AckReceivedReq, opts ...grpc.CallOption) (*AckReceivedRes, error) {
+	out := new(AckReceivedRes)
+	err := c.cc.Invoke(ctx, "/Replication/AckReceived", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ReplicationServer is the server API for Replication service.
 type ReplicationServer interface {
 	Ping(context.Context, *PingReq) (*PingRes, error)
@@ -1323,6 +1794,8 @@ type ReplicationServer interface {
 	DestroySnapshots(context.Context, *DestroySnapshotsReq) (*DestroySnapshotsRes, error)
 	ReplicationCursor(context.Context, *ReplicationCursorReq) (*ReplicationCursorRes, error)
 	SendCompleted(context.Context, *SendCompletedReq) (*SendCompletedRes, error)
+	SendStreamDigest(context.Context, *SendStreamDigestReq) (*SendStreamDigestRes, error)
+	AckReceived(context.Context, *AckReceivedReq) (*AckReceivedRes, error)
 }
 
 func RegisterReplicationServer(s *grpc.Server, srv ReplicationServer) {
@@ -1437,6 +1910,42 @@ func _Replication_SendCompleted_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Replication_SendStreamDigest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendStreamDigestReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).SendStreamDigest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/SendStreamDigest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).SendStreamDigest(ctx, req.(*SendStreamDigestReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_AckReceived_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckReceivedReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).AckReceived(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/AckReceived",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).AckReceived(ctx, req.(*AckReceivedReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Replication_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Replication",
 	HandlerType: (*ReplicationServer)(nil),
@@ -1465,6 +1974,14 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SendCompleted",
 			Handler:    _Replication_SendCompleted_Handler,
 		},
+		{
+			MethodName: "SendStreamDigest",
+			Handler:    _Replication_SendStreamDigest_Handler,
+		},
+		{
+			MethodName: "AckReceived",
+			Handler:    _Replication_AckReceived_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pdu.proto",
@@ -1473,68 +1990,96 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_616c27178643eca4) }
 
 var fileDescriptor_pdu_616c27178643eca4 = []byte{
-	// 995 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xcf, 0x6e, 0xdb, 0xc6,
-	0x13, 0x36, 0x25, 0xda, 0xa2, 0x46, 0xce, 0x2f, 0xf4, 0xd8, 0x09, 0x68, 0xfd, 0xd2, 0xd4, 0xd8,
-	0x14, 0x85, 0x63, 0xa0, 0x44, 0xe1, 0xb4, 0x05, 0x8a, 0x14, 0x41, 0xeb, 0xbf, 0x31, 0xd2, 0xba,
-	0xea, 0x5a, 0x0d, 0x8a, 0xdc, 0x18, 0x69, 0x2a, 0x2f, 0x4c, 0x71, 0xe9, 0x5d, 0x2a, 0x88, 0x7a,
-	0xec, 0xa1, 0x87, 0x5e, 0x7a, 0xea, 0xeb, 0xf4, 0x29, 0xfa, 0x20, 0x7d, 0x84, 0x82, 0x6b, 0x92,
-	0xa2, 0x44, 0xca, 0x70, 0x4f, 0xda, 0xf9, 0xe6, 0xdb, 0xd9, 0xd9, 0xd1, 0x37, 0xb3, 0x84, 0x76,
-	0x3c, 0x9c, 0xf8, 0xb1, 0x92, 0x89, 0x64, 0x9b, 0xb0, 0xf1, 0xad, 0xd0, 0xc9, 0x89, 0x08, 0x49,
-	0x4f, 0x75, 0x42, 0x63, 0x4e, 0xd7, 0xec, 0xa0, 0x0a, 0x6a, 0xfc, 0x04, 0x3a, 0x33, 0x40, 0x7b,
-	0xd6, 0x4e, 0x73, 0xb7, 0xb3, 0xdf, 0xf1, 0x4b, 0xa4, 0xb2, 0x9f, 0xfd, 0x6e, 0x01, 0xcc, 0x6c,
-	0x44, 0xb0, 0x7b, 0x41, 0x72, 0xe9, 0x59, 0x3b, 0xd6, 0x6e, 0x9b, 0x9b, 0x35, 0xee, 0x40, 0x87,
-	0x93, 0x9e, 0x8c, 0xa9, 0x2f, 0xaf, 0x28, 0xf2, 0x1a, 0xc6, 0x55, 0x86, 0xf0, 0x23, 0xb8, 0x77,
-	0xa6, 0x7b, 0x61, 0x30, 0xa0, 0x4b, 0x19, 0x0e, 0x49, 0x79, 0xcd, 0x1d, 0x6b, 0xd7, 0xe1, 0xf3,
-	0x60, 0x1a, 0xe7, 0x4c, 0x1f, 0x47, 0x03, 0x35, 0x8d, 0x13, 0x1a, 0x7a, 0xb6, 0xe1, 0x94, 0x21,
-	0xf6, 0x1c, 0xb6, 0xe7, 0x2f, 0xf4, 0x9a, 0x94, 0x16, 0x32, 0xd2, 0x9c, 0xae, 0xf1, 0x71, 0x39,
-	0xd1, 0x2c, 0xc1, 0x12, 0xc2, 0x5e, 0x2d, 0xdf, 0xac, 0xd1, 0x07, 0x27, 0x37, 0xb3, 0x92, 0xa0,
-	0x5f, 0x61, 0xf2, 0x82, 0xc3, 0xfe, 0xb6, 0x60, 0xa3, 0xe2, 0xc7, 0x7d, 0xb0, 0xfb, 0xd3, 0x98,
-	0xcc, 0xe1, 0xff, 0xdb, 0x7f, 0x5c, 0x8d, 0xe0, 0x67, 0xbf, 0x29, 0x8b, 0x1b, 0x6e, 0x5a, 0xd1,
-	0xf3, 0x60, 0x4c, 0x59, 0xd9, 0xcc, 0x3a, 0xc5, 0x4e, 0x27, 0x62, 0x68, 0xca, 0x64, 0x73, 0xb3,
-	0xc6, 0x47, 0xd0, 0x3e, 0x54, 0x14, 0x24, 0xd4, 0xff, 0xe9, 0xd4, 0xd4, 0xc6, 0xe6, 0x33, 0x00,
-	0xbb, 0xe0, 0x18, 0x43, 0xc8, 0xc8, 0x5b, 0x35, 0x91, 0x0a, 0x9b, 0x3d, 0x85, 0x4e, 0xe9, 0x58,
-	0x5c, 0x07, 0xe7, 0x22, 0x0a, 0x62, 0x7d, 0x29, 0x13, 0x77, 0x25, 0xb5, 0x0e, 0xa4, 0xbc, 0x1a,
-	0x07, 0xea, 0xca, 0xb5, 0xd8, 0x9f, 0x0d, 0x68, 0x5d, 0x50, 0x34, 0xbc, 0x43, 0x3d, 0xf1, 0x63,
-	0xb0, 0x4f, 0x94, 0x1c, 0x9b, 0xc4, 0xeb, 0xcb, 0x65, 0xfc, 0xc8, 0xa0, 0xd1, 0x97, 0xe6, 0x2a,
-	0xf5, 0xac, 0x46, 0x5f, 0x2e, 0x4a, 0xc8, 0xae, 0x4a, 0x88, 0x41, 0x7b, 0x26, 0x8d, 0x55, 0x53,
-	0x5f, 0xdb, 0xef, 0x2b, 0xc1, 0x67, 0x30, 0x3e, 0x84, 0xb5, 0x23, 0x35, 0xe5, 0x93, 0xc8, 0x5b,
-	0x33, 0xda, 0xc9, 0x2c, 0xfc, 0x1a, 0x36, 0x38, 0xc5, 0xa1, 0x18, 0x98, 0x7a, 0x1c, 0xca, 0xe8,
-	0x67, 0x31, 0xf2, 0x5a, 0x59, 0x42, 0x15, 0x0f, 0xaf, 0x92, 0xd9, 0x0f, 0x35, 0x11, 0xf0, 0x2b,
-	0x80, 0xb4, 0xf9, 0x68, 0x60, 0xaa, 0x6e, 0x99, 0x78, 0x8f, 0xaa, 0xf1, 0x7a, 0x05, 0x87, 0x97,
-	0xf8, 0xec, 0x0f, 0x0b, 0xfe, 0x7f, 0x0b, 0x17, 0x9f, 0x41, 0xeb, 0x2c, 0x12, 0x89, 0x08, 0xc2,
-	0x4c, 0x4e, 0xdb, 0xe5, 0xd0, 0xa7, 0x93, 0x40, 0x05, 0x51, 0x42, 0xf4, 0x4a, 0x44, 0x43, 0x9e,
-	0x33, 0xf1, 0x39, 0x74, 0xce, 0xa2, 0x81, 0xa2, 0x31, 0x45, 0x49, 0x10, 0x9a, 0xbf, 0xe6, 0xd6,
-	0x8d, 0x65, 0x36, 0xfb, 0x0c, 0x9c, 0x9e, 0x92, 0x31, 0xa9, 0x64, 0x5a, 0xa8, 0xd2, 0x2a, 0xa9,
-	0x72, 0x0b, 0x56, 0x5f, 0x07, 0xe1, 0x24, 0x97, 0xea, 0x8d, 0xc1, 0x7e, 0xb5, 0x72, 0xc9, 0x68,
-	0xdc, 0x85, 0xfb, 0x3f, 0x6a, 0x1a, 0x2e, 0x4e, 0x03, 0x87, 0x2f, 0xc2, 0xc8, 0x60, 0xfd, 0xf8,
-	0x7d, 0x4c, 0x83, 0x84, 0x86, 0x17, 0xe2, 0x17, 0x32, 0xf2, 0x68, 0xf2, 0x39, 0x0c, 0x9f, 0x02,
-	0x64, 0xf9, 0x08, 0xd2, 0x9e, 0x6d, 0xba, 0xb2, 0xed, 0xe7, 0x29, 0xf2, 0x92, 0x93, 0xbd, 0x00,
-	0x37, 0xcd, 0xe1, 0x50, 0x8e, 0xe3, 0x90, 0x12, 0x32, 0xfa, 0xdd, 0x83, 0xce, 0xf7, 0x4a, 0x8c,
-	0x44, 0x14, 0x84, 0x9c, 0xae, 0x33, 0x99, 0x3a, 0x7e, 0x26, 0x6f, 0x5e, 0x76, 0x32, 0xac, 0xec,
-	0xd7, 0xec, 0x2f, 0x0b, 0x80, 0xd3, 0x80, 0xc4, 0x3b, 0xba, 0x4b, 0x3b, 0xdc, 0xc8, 0xbc, 0x71,
-	0xab, 0xcc, 0xf7, 0xc0, 0x3d, 0x0c, 0x29, 0x50, 0xe5, 0x02, 0xdd, 0x8c, 0xc2, 0x0a, 0x5e, 0x2f,
-	0x5a, 0xfb, 0xbf, 0x88, 0x76, 0xbd, 0x94, 0xbf, 0x66, 0x23, 0xd8, 0x3c, 0x22, 0x9d, 0x28, 0x39,
-	0xcd, 0xbb, 0xff, 0x2e, 0x53, 0x13, 0x3f, 0x85, 0x76, 0xc1, 0xf7, 0x1a, 0x4b, 0x27, 0xe3, 0x8c,
-	0xc4, 0xde, 0x00, 0x2e, 0x1c, 0x94, 0x0d, 0xd8, 0xdc, 0xcc, 0x5a, 0xa5, 0x76, 0xc0, 0xe6, 0x9c,
-	0x54, 0x6c, 0xc7, 0x4a, 0x49, 0x95, 0x8b, 0xcd, 0x18, 0xec, 0xa8, 0xee, 0x12, 0xe9, 0x9b, 0xd6,
-	0x4a, 0x4b, 0x17, 0x26, 0xf9, 0xf0, 0xde, 0xf4, 0xab, 0x29, 0xf0, 0x9c, 0xc3, 0xbe, 0x80, 0xad,
-	0x72, 0xb5, 0x26, 0x4a, 0x4b, 0x75, 0x97, 0x17, 0xa4, 0x5f, 0xbb, 0x4f, 0xe3, 0x56, 0x36, 0xae,
-	0xd3, 0x1d, 0xf6, 0xcb, 0x95, 0x62, 0x60, 0x3b, 0xe7, 0x32, 0xa1, 0xf7, 0x42, 0x27, 0x37, 0x5d,
-	0xf0, 0x72, 0x85, 0x17, 0xc8, 0x81, 0x03, 0x6b, 0x37, 0xe9, 0xb0, 0x27, 0xd0, 0xea, 0x89, 0x68,
-	0x94, 0x26, 0xe0, 0x41, 0xeb, 0x3b, 0xd2, 0x3a, 0x18, 0xe5, 0x8d, 0x97, 0x9b, 0xec, 0x83, 0x9c,
-	0xa4, 0xd3, 0xd6, 0x3c, 0x1e, 0x5c, 0xca, 0xbc, 0x35, 0xd3, 0xf5, 0xde, 0x2e, 0x34, 0xfb, 0x4a,
-	0xa4, 0xc3, 0xfc, 0x48, 0x46, 0xc9, 0x61, 0xa0, 0xc8, 0x5d, 0xc1, 0x36, 0xac, 0x9e, 0x04, 0xa1,
-	0x26, 0xd7, 0x42, 0x07, 0xec, 0xbe, 0x9a, 0x90, 0xdb, 0xd8, 0xfb, 0xcd, 0x02, 0x6f, 0xd9, 0x38,
-	0xc0, 0x2d, 0x70, 0x0b, 0xe0, 0x2c, 0x7a, 0x17, 0x84, 0x62, 0xe8, 0xae, 0xe0, 0x36, 0x3c, 0x28,
-	0x50, 0xa3, 0xd0, 0xe0, 0xad, 0x08, 0x45, 0x32, 0x75, 0x2d, 0x7c, 0x02, 0x1f, 0x96, 0x36, 0x14,
-	0xa3, 0xa4, 0x74, 0x80, 0xdb, 0x98, 0x8b, 0x7a, 0x2e, 0x93, 0x4b, 0x11, 0x8d, 0xdc, 0xe6, 0xfe,
-	0x3f, 0x8d, 0x74, 0xe6, 0x17, 0x3c, 0xec, 0x82, 0x9d, 0xde, 0x10, 0x1d, 0x3f, 0xab, 0x46, 0x37,
-	0x5f, 0x69, 0xfc, 0x12, 0xee, 0xcf, 0x3f, 0xdd, 0x1a, 0xd1, 0xaf, 0x7c, 0xef, 0x74, 0xab, 0x98,
-	0xc6, 0x1e, 0x3c, 0xac, 0x7f, 0xf5, 0xb1, 0xeb, 0x2f, 0xfd, 0x96, 0xe8, 0x2e, 0xf7, 0x69, 0x7c,
-	0x01, 0xee, 0xa2, 0x06, 0x71, 0xcb, 0xaf, 0xe9, 0xad, 0x6e, 0x1d, 0xaa, 0xf1, 0x9b, 0xf9, 0xc6,
-	0x36, 0x2a, 0xc2, 0x07, 0x7e, 0x9d, 0x22, 0xbb, 0xb5, 0xb0, 0xc6, 0xcf, 0xe1, 0xde, 0xdc, 0xb8,
-	0xc2, 0x0d, 0x7f, 0x71, 0xfc, 0x75, 0x2b, 0x90, 0x3e, 0x58, 0x7d, 0xd3, 0x8c, 0x87, 0x93, 0xb7,
-	0x6b, 0xe6, 0x93, 0xf1, 0xd9, 0xbf, 0x01, 0x00, 0x00, 0xff, 0xff, 0x7e, 0xa4, 0xfb, 0xca, 0x3f,
-	0x0a, 0x00, 0x00,
+	// 1454 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xcd, 0x72, 0xdb, 0xb6,
+	0x16, 0x36, 0xf5, 0xaf, 0xa3, 0x5c, 0x87, 0x86, 0x9d, 0x5c, 0x46, 0x37, 0x93, 0xeb, 0x41, 0xee,
+	0x64, 0x1c, 0xcf, 0x2d, 0xdb, 0x3a, 0x6d, 0x26, 0x4d, 0x3b, 0x99, 0xc6, 0x96, 0x9d, 0x38, 0x3f,
+	0xae, 0x0a, 0x2b, 0x69, 0xa7, 0x3b, 0x5a, 0x3a, 0x91, 0x39, 0xa2, 0x08, 0x05, 0x80, 0x9c, 0x28,
+	0x0f, 0xd0, 0x6d, 0x67, 0xda, 0x27, 0xe8, 0xf4, 0x39, 0xba, 0xef, 0x13, 0x74, 0xdf, 0x55, 0x5f,
+	0xa3, 0x03, 0x90, 0x94, 0x28, 0x91, 0x72, 0xdc, 0x4d, 0x57, 0x06, 0xbe, 0xf3, 0x81, 0x00, 0x0e,
+	0xbe, 0xf3, 0x23, 0x43, 0x7d, 0xd4, 0x1b, 0xbb, 0x23, 0xc1, 0x15, 0xa7, 0xeb, 0xb0, 0xf6, 0xcc,
+	0x97, 0xea, 0xc0, 0x0f, 0x50, 0x4e, 0xa4, 0xc2, 0x21, 0xc3, 0xd7, 0xf4, 0xc7, 0x62, 0x16, 0x95,
+	0xe4, 0x03, 0x68, 0xcc, 0x00, 0xe9, 0x58, 0x9b, 0xc5, 0xad, 0xc6, 0x4e, 0xc3, 0x4d, 0x91, 0xd2,
+	0x76, 0xe2, 0x02, 0x61, 0x9c, 0xab, 0x83, 0xe3, 0x36, 0xe7, 0xc1, 0x01, 0x7a, 0x6a, 0x2c, 0x50,
+	0x3a, 0x85, 0xcd, 0xe2, 0x56, 0x9d, 0xe5, 0x58, 0xc8, 0x3d, 0xf8, 0x77, 0x16, 0x7d, 0xe9, 0x05,
+	0x7e, 0xcf, 0x29, 0x6e, 0x5a, 0x5b, 0x35, 0xb6, 0xcc, 0x4c, 0x6e, 0xc1, 0xea, 0x31, 0x86, 0xbd,
+	0x83, 0xc0, 0xeb, 0xc7, 0x0b, 0x4a, 0x66, 0xc1, 0x02, 0x4a, 0xfe, 0x07, 0xff, 0xd2, 0xc8, 0x7e,
+	0xd8, 0x15, 0x93, 0x91, 0xc2, 0x9e, 0x53, 0x36, 0xb4, 0x79, 0x90, 0x38, 0x50, 0xd5, 0x00, 0xf3,
+	0xde, 0x38, 0x15, 0x63, 0x4f, 0xa6, 0xc9, 0x3e, 0x7b, 0x7c, 0x38, 0x12, 0x28, 0x25, 0xf6, 0x9c,
+	0xea, 0x6c, 0x9f, 0x19, 0x4a, 0xb6, 0xc1, 0x36, 0x9f, 0x1c, 0x9e, 0x60, 0xaf, 0x87, 0xbd, 0x96,
+	0xa7, 0x3c, 0xa7, 0x66, 0x98, 0x19, 0x9c, 0x6c, 0xc1, 0x65, 0x8d, 0x3d, 0xf3, 0x44, 0x1f, 0x77,
+	0x03, 0xde, 0x1d, 0x48, 0xa7, 0x6e, 0xa8, 0x8b, 0x30, 0xfd, 0xd5, 0x02, 0x98, 0xf9, 0x97, 0x10,
+	0x28, 0xb5, 0x3d, 0x75, 0xea, 0x58, 0x9b, 0xd6, 0x56, 0x9d, 0x99, 0x31, 0xd9, 0x84, 0x06, 0x43,
+	0x39, 0x1e, 0x62, 0x87, 0x0f, 0x30, 0x74, 0x0a, 0xc6, 0x94, 0x86, 0xb4, 0x0b, 0x0e, 0x65, 0x3b,
+	0xf0, 0xba, 0x78, 0xca, 0x83, 0x1e, 0x8a, 0xd8, 0xb5, 0xf3, 0xa0, 0xfe, 0xce, 0xa1, 0x9c, 0xb9,
+	0x29, 0xf2, 0x66, 0x1a, 0x22, 0x1f, 0x03, 0xb4, 0xf8, 0x9b, 0x50, 0x2a, 0x81, 0xde, 0xd0, 0x29,
+	0x1b, 0x29, 0xac, 0xb9, 0x33, 0x68, 0x6f, 0x2c, 0x24, 0x17, 0x2c, 0x45, 0xa2, 0x5d, 0xb8, 0x36,
+	0xaf, 0xa9, 0x97, 0x28, 0xa4, 0xcf, 0x43, 0xc9, 0xf0, 0x35, 0xb9, 0x91, 0xbe, 0x5b, 0x7c, 0xa7,
+	0xf4, 0x6d, 0x6f, 0xc1, 0xea, 0x0b, 0x89, 0xa2, 0x2d, 0xf8, 0x08, 0x85, 0xf2, 0xa7, 0x42, 0x5a,
+	0x40, 0xe9, 0xd3, 0xe5, 0x9b, 0x68, 0x45, 0xd6, 0x92, 0x69, 0xac, 0x5e, 0xe2, 0x66, 0x98, 0x6c,
+	0xca, 0xa1, 0x7f, 0x16, 0x60, 0x2d, 0x63, 0x27, 0x3b, 0x50, 0xea, 0x4c, 0x46, 0x68, 0x0e, 0xb9,
+	0xba, 0x73, 0x23, 0xfb, 0x05, 0x37, 0xfe, 0xab, 0x59, 0xcc, 0x70, 0xf5, 0x63, 0x1d, 0x79, 0x43,
+	0x8c, 0x5f, 0xc4, 0x8c, 0x35, 0xf6, 0x68, 0x1c, 0x8b, 0xbb, 0xc4, 0xcc, 0x98, 0x5c, 0x87, 0xfa,
+	0x9e, 0x40, 0x4f, 0x61, 0xe7, 0xdb, 0x47, 0xc6, 0xed, 0x25, 0x36, 0x03, 0x48, 0x13, 0x6a, 0x66,
+	0xe2, 0xf3, 0xd0, 0x48, 0xb7, 0xce, 0xa6, 0x73, 0x72, 0x94, 0x71, 0x50, 0xc5, 0xdc, 0xf0, 0x56,
+	0xce, 0xf9, 0xe6, 0x89, 0xfb, 0xa1, 0x12, 0x93, 0x45, 0x47, 0x36, 0x1f, 0xc2, 0x7a, 0x0e, 0x8d,
+	0xd8, 0x50, 0x1c, 0xe0, 0x24, 0x7e, 0x20, 0x3d, 0x24, 0x1b, 0x50, 0x3e, 0xf3, 0x82, 0x71, 0x72,
+	0xb7, 0x68, 0x72, 0xbf, 0x70, 0xcf, 0xa2, 0xb7, 0xa1, 0x91, 0xf2, 0x04, 0xb9, 0x04, 0xb5, 0xe3,
+	0xd0, 0x1b, 0xc9, 0x53, 0xae, 0xec, 0x15, 0x3d, 0xdb, 0xe5, 0x7c, 0x30, 0xf4, 0xc4, 0xc0, 0xb6,
+	0xe8, 0xcf, 0xc5, 0x38, 0xe8, 0x2e, 0x24, 0x85, 0xd2, 0x81, 0xe0, 0x43, 0xb3, 0x5f, 0xfe, 0x0b,
+	0x1a, 0x3b, 0xa1, 0x50, 0xe8, 0x70, 0xa7, 0xb8, 0x94, 0x55, 0xe8, 0xf0, 0xc5, 0x80, 0x29, 0x65,
+	0x03, 0x86, 0x42, 0x7d, 0x3e, 0x5f, 0xac, 0xee, 0x94, 0xdc, 0x8e, 0xf0, 0xd9, 0x0c, 0x26, 0x57,
+	0xa1, 0xd2, 0x12, 0x13, 0x36, 0x0e, 0xe3, 0x84, 0x11, 0xcf, 0xc8, 0x97, 0xb0, 0xc6, 0x70, 0x14,
+	0xf8, 0x5d, 0xf3, 0x44, 0x7b, 0x3c, 0x7c, 0xe5, 0xf7, 0x9d, 0x6a, 0x7c, 0xa0, 0x8c, 0x85, 0x65,
+	0xc9, 0x26, 0x5c, 0x43, 0x85, 0x62, 0x88, 0x3d, 0xdf, 0x53, 0x28, 0xe3, 0x34, 0x32, 0x0f, 0x92,
+	0xff, 0xc3, 0xda, 0x71, 0x14, 0x75, 0x71, 0x0e, 0xd2, 0x02, 0xa9, 0x9b, 0xbb, 0x64, 0x0d, 0xe4,
+	0x2e, 0x5c, 0xcd, 0x80, 0xcf, 0xf0, 0x0c, 0x03, 0x07, 0x36, 0xad, 0xad, 0x32, 0x5b, 0x62, 0xa5,
+	0x5f, 0xe7, 0xdc, 0x86, 0x7c, 0x01, 0xa0, 0xeb, 0x08, 0x76, 0x8d, 0x28, 0x2d, 0x73, 0xb7, 0xeb,
+	0xd9, 0xbb, 0xb5, 0xa7, 0x1c, 0x96, 0xe2, 0xd3, 0x1f, 0x2c, 0xf8, 0xcf, 0x39, 0x5c, 0x72, 0x07,
+	0xaa, 0x87, 0xa1, 0xaf, 0x7c, 0x2f, 0x88, 0xa3, 0xed, 0x5a, 0xfa, 0xd3, 0x8f, 0xc6, 0x9e, 0xf0,
+	0x42, 0x85, 0xf8, 0xd4, 0x0f, 0x7b, 0x2c, 0x61, 0x92, 0xcf, 0xa1, 0x71, 0x18, 0x76, 0x05, 0x0e,
+	0x31, 0x54, 0x5e, 0xe0, 0x14, 0xde, 0xb7, 0x30, 0xcd, 0xa6, 0x9f, 0x40, 0x2d, 0x96, 0xfc, 0x64,
+	0x1a, 0xb4, 0x56, 0x2a, 0x68, 0x37, 0xa0, 0xfc, 0x32, 0xad, 0x76, 0x33, 0xa1, 0xbf, 0x5b, 0x89,
+	0x7c, 0xa5, 0x4e, 0xe8, 0x2f, 0x24, 0xf6, 0x16, 0xf3, 0x70, 0x8d, 0x2d, 0xc2, 0x84, 0xc2, 0xa5,
+	0xfd, 0xb7, 0x23, 0xec, 0x2a, 0xec, 0x1d, 0xfb, 0xef, 0xd0, 0x48, 0xb5, 0xc8, 0xe6, 0x30, 0x72,
+	0x1b, 0x20, 0x15, 0xd2, 0x25, 0x13, 0xd2, 0x75, 0x37, 0x39, 0x22, 0x4b, 0x19, 0xf3, 0x55, 0x50,
+	0x5e, 0xa6, 0x82, 0x8c, 0xb2, 0x2a, 0x39, 0xca, 0xa2, 0x0f, 0xa2, 0x4a, 0xa6, 0x17, 0x06, 0xa8,
+	0xd0, 0xc4, 0xe7, 0x36, 0x34, 0xbe, 0x12, 0x7e, 0xdf, 0x0f, 0xbd, 0x80, 0xe1, 0xeb, 0x38, 0x0c,
+	0x6b, 0x6e, 0x1c, 0xbe, 0x2c, 0x6d, 0xa4, 0x24, 0xb3, 0x5e, 0xd2, 0xdf, 0x0a, 0x00, 0x0c, 0xbb,
+	0xe8, 0x9f, 0xe1, 0x45, 0xc2, 0x3d, 0x0a, 0xe3, 0xc2, 0xb9, 0x61, 0xbc, 0x0d, 0xf6, 0x5e, 0x80,
+	0x9e, 0x48, 0x3b, 0x3d, 0x2a, 0x6c, 0x19, 0x3c, 0x3f, 0x28, 0x4b, 0x7f, 0x27, 0x28, 0x77, 0x00,
+	0x18, 0x0f, 0x82, 0x13, 0xaf, 0x3b, 0xe8, 0x70, 0xa7, 0x1c, 0x2f, 0xcd, 0x9e, 0x2c, 0xc5, 0xca,
+	0x7f, 0x9c, 0xca, 0xb2, 0xc7, 0x49, 0x52, 0x5c, 0xf5, 0xfc, 0x14, 0x47, 0x2f, 0xa5, 0x3c, 0x29,
+	0xe9, 0x2f, 0x16, 0xac, 0xb7, 0x50, 0x2a, 0xc1, 0x27, 0x49, 0xa2, 0xbd, 0x50, 0x6d, 0xfd, 0x08,
+	0xea, 0x53, 0xbe, 0x29, 0xab, 0xf9, 0x5b, 0xce, 0x48, 0xe4, 0x3e, 0x38, 0x2d, 0x7c, 0x85, 0x62,
+	0x8a, 0x7c, 0xe3, 0xab, 0xd3, 0xbd, 0x80, 0x87, 0x28, 0x63, 0xbf, 0x2f, 0xb5, 0xd3, 0x77, 0x40,
+	0x16, 0x0e, 0x19, 0x97, 0xe6, 0x64, 0x1a, 0x67, 0x91, 0xdc, 0xd2, 0x9c, 0x70, 0x74, 0x1c, 0xee,
+	0x0b, 0xc1, 0x45, 0x12, 0x87, 0x66, 0xa2, 0x6f, 0xfa, 0x14, 0x47, 0x8a, 0xa1, 0x27, 0x79, 0xa4,
+	0x80, 0x3a, 0x4b, 0x21, 0xb4, 0x95, 0xe7, 0x20, 0xdd, 0xd8, 0x56, 0xb5, 0x42, 0x02, 0x95, 0xb4,
+	0x05, 0xeb, 0x6e, 0xf6, 0x88, 0x2c, 0xe1, 0xd0, 0xbb, 0xb0, 0x91, 0x16, 0x45, 0xd4, 0xe9, 0xbc,
+	0xdf, 0xcf, 0xb4, 0x93, 0xbb, 0x4e, 0x92, 0x8d, 0xb8, 0x11, 0xd0, 0x2b, 0x4a, 0x8f, 0x57, 0xa6,
+	0xad, 0x40, 0xed, 0x88, 0x2b, 0x7c, 0xeb, 0x4b, 0x15, 0x25, 0x90, 0xc7, 0x2b, 0x6c, 0x8a, 0xec,
+	0xd6, 0xa0, 0x12, 0x1d, 0x87, 0xde, 0x84, 0x6a, 0xdb, 0x0f, 0xfb, 0xfa, 0x00, 0x0e, 0x54, 0x9f,
+	0xa3, 0x94, 0x5e, 0x3f, 0xc9, 0x59, 0xc9, 0x94, 0x3e, 0x4f, 0x48, 0x52, 0x67, 0xb5, 0xfd, 0xee,
+	0x29, 0x4f, 0xb2, 0x9a, 0x1e, 0xeb, 0x56, 0x3d, 0x23, 0xc2, 0x69, 0xab, 0x9e, 0xb5, 0xd0, 0x9f,
+	0x2c, 0x58, 0xd7, 0x71, 0x1d, 0x99, 0x5a, 0x7e, 0x1f, 0xa5, 0xfa, 0xa7, 0x4b, 0xb7, 0x0d, 0x45,
+	0xdd, 0xa2, 0x47, 0xbd, 0xa9, 0x1e, 0xd2, 0xe7, 0x79, 0x87, 0x92, 0xa6, 0x3a, 0x9b, 0x49, 0x7c,
+	0xa0, 0x78, 0xa6, 0x0f, 0x1b, 0x51, 0x4d, 0xf2, 0x2d, 0x98, 0xe4, 0x9b, 0x42, 0x68, 0x1b, 0xec,
+	0xc5, 0x7e, 0x56, 0x6f, 0xfa, 0x84, 0x9f, 0x24, 0xed, 0xcf, 0x13, 0x7e, 0x42, 0xb6, 0xa1, 0x12,
+	0xd9, 0xce, 0xb9, 0x54, 0xcc, 0xa0, 0x2d, 0x58, 0x7d, 0xd8, 0x1d, 0xc4, 0x11, 0x7b, 0xa1, 0x5e,
+	0x27, 0xe9, 0x11, 0x0b, 0xb3, 0x1e, 0x91, 0xda, 0x0b, 0x5f, 0x91, 0xdb, 0x5b, 0x50, 0xec, 0x08,
+	0x5f, 0xb7, 0x54, 0x2d, 0x1e, 0xaa, 0x3d, 0x4f, 0xa0, 0xbd, 0x42, 0xea, 0x50, 0x3e, 0xf0, 0x02,
+	0x89, 0xb6, 0x45, 0x6a, 0x50, 0xea, 0x88, 0x31, 0xda, 0x85, 0xed, 0xef, 0x2d, 0x70, 0x96, 0x15,
+	0x42, 0xb2, 0x01, 0xf6, 0x14, 0x38, 0x0c, 0xcf, 0xf4, 0x4f, 0x26, 0x7b, 0x85, 0x5c, 0x83, 0x2b,
+	0x53, 0xd4, 0xe4, 0x51, 0xef, 0xc4, 0x0f, 0x7c, 0x35, 0xb1, 0x2d, 0x72, 0x13, 0xfe, 0x9b, 0x5a,
+	0x30, 0x2d, 0xa2, 0xa9, 0x0d, 0xec, 0xc2, 0xdc, 0x57, 0x8f, 0xb8, 0x3a, 0xf5, 0xc3, 0xbe, 0x5d,
+	0xdc, 0xf9, 0xa3, 0x08, 0x8d, 0x14, 0x8f, 0x34, 0xa1, 0xa4, 0x05, 0x4a, 0x6a, 0x6e, 0x2c, 0xe6,
+	0x66, 0x32, 0x92, 0xe4, 0x33, 0xb8, 0x3c, 0xdf, 0xd3, 0x4b, 0x42, 0xdc, 0xcc, 0x8f, 0xd6, 0x66,
+	0x16, 0x93, 0xa4, 0x0d, 0x57, 0xf3, 0x7f, 0x0e, 0x90, 0xa6, 0xbb, 0xf4, 0xc7, 0x48, 0x73, 0xb9,
+	0x4d, 0x92, 0x07, 0x60, 0x2f, 0xa6, 0x10, 0xb2, 0xe1, 0xe6, 0xa4, 0xdd, 0x66, 0x1e, 0x2a, 0xc9,
+	0xc3, 0xf9, 0xf2, 0x13, 0xc9, 0xea, 0x8a, 0x9b, 0x97, 0x50, 0x9a, 0xb9, 0xb0, 0x24, 0x9f, 0x46,
+	0x3f, 0x63, 0xa7, 0x45, 0x95, 0xac, 0xb9, 0x8b, 0x45, 0xba, 0x99, 0x81, 0xcc, 0xc9, 0x17, 0xc3,
+	0x83, 0x6c, 0xb8, 0x39, 0x61, 0xdc, 0xcc, 0x43, 0x25, 0xf9, 0x10, 0x1a, 0x29, 0xdd, 0x91, 0xcb,
+	0xee, 0xbc, 0x96, 0x9b, 0x0b, 0x80, 0xdc, 0x2d, 0x7f, 0x57, 0x1c, 0xf5, 0xc6, 0x27, 0x15, 0xf3,
+	0x8f, 0x86, 0x3b, 0x7f, 0x0d, 0x00, 0x94, 0x9a, 0xdf, 0x8e, 0x75, 0x10, 0x00, 0x00,
 }
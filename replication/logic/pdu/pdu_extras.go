@@ -45,11 +45,12 @@ func FilesystemVersionFromZFS(fsv *zfs.FilesystemVersion) *FilesystemVersion {
 		panic("unknown fsv.Type: " + fsv.Type)
 	}
 	return &FilesystemVersion{
-		Type:      t,
-		Name:      fsv.Name,
-		Guid:      fsv.Guid,
-		CreateTXG: fsv.CreateTXG,
-		Creation:  fsv.Creation.Format(time.RFC3339),
+		Type:           t,
+		Name:           fsv.Name,
+		Guid:           fsv.Guid,
+		CreateTXG:      fsv.CreateTXG,
+		Creation:       fsv.Creation.Format(time.RFC3339),
+		UserProperties: fsv.UserProperties,
 	}
 }
 
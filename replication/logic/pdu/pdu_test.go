@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFilesystemVersion_RelName(t *testing.T) {
@@ -67,3 +69,17 @@ func TestFilesystemVersion_ZFSFilesystemVersion(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+func TestFilesystemVersion_UserPropertiesUnsetRoundtrip(t *testing.T) {
+	// the pruner tells unset properties (empty value) from properties that the peer did not list (no key)
+	in := &FilesystemVersion{
+		Type:           FilesystemVersion_Snapshot,
+		Name:           "foo",
+		UserProperties: map[string]string{"com.example:keep": "", "com.example:owner": "alice"},
+	}
+	buf, err := proto.Marshal(in)
+	require.NoError(t, err)
+	var out FilesystemVersion
+	require.NoError(t, proto.Unmarshal(buf, &out))
+	assert.Equal(t, in.UserProperties, out.UserProperties)
+}
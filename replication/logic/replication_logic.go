@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	. "github.com/zrepl/zrepl/replication/logic/diff"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
 	"github.com/zrepl/zrepl/util/bytecounter"
 	"github.com/zrepl/zrepl/util/chainlock"
 	"github.com/zrepl/zrepl/util/envconst"
@@ -138,8 +140,10 @@ func (f *Filesystem) EqualToPreviousAttempt(other driver.FS) bool {
 func (f *Filesystem) PlanFS(ctx context.Context) ([]driver.Step, error) {
 	steps, err := f.doPlanning(ctx)
 	if err != nil {
+		f.policy.StepStateFile.forget(ctx, f.Path)
 		return nil, err
 	}
+	steps = f.skipLargeSteps(ctx, steps)
 	dsteps := make([]driver.Step, len(steps))
 	for i := range dsteps {
 		dsteps[i] = steps[i]
@@ -147,17 +151,28 @@ func (f *Filesystem) PlanFS(ctx context.Context) ([]driver.Step, error) {
 	return dsteps, nil
 }
 func (f *Filesystem) ReportInfo() *report.FilesystemInfo {
-	return &report.FilesystemInfo{Name: f.Path} // FIXME compat name
+	info := &report.FilesystemInfo{Name: f.Path} // FIXME compat name
+	for _, d := range f.receiverFS.GetDownstream() {
+		di := &report.DownstreamInfo{Job: d.GetJob()}
+		if c := d.GetCursor(); c != nil {
+			di.Cursor = c.RelName()
+			di.CursorCreation, _ = c.CreationAsTime()
+		}
+		info.Downstream = append(info.Downstream, di)
+	}
+	return info
 }
 
 type Step struct {
 	sender   Sender
 	receiver Receiver
 
-	parent      *Filesystem
-	from, to    *pdu.FilesystemVersion // from may be nil, indicating full send
-	encrypt     tri
-	resumeToken string // empty means no resume token shall be used
+	parent        *Filesystem
+	from, to      *pdu.FilesystemVersion // from may be nil, indicating full send
+	intermediates bool                   // include all snapshots between from and to (zfs send -I)
+	encrypt       tri
+	resumeToken   string                 // empty means no resume token shall be used
+	rollbackTo    *pdu.FilesystemVersion // receiver version to roll back to before the receive, may be nil
 
 	expectedSize int64 // 0 means no size estimate present / possible
 
@@ -165,8 +180,15 @@ type Step struct {
 	// => concurrent read of that pointer from Step.ReportInfo must be protected
 	byteCounter    bytecounter.ReadCloser
 	byteCounterMtx chainlock.L
+	// the following fields are protected by byteCounterMtx, too
+	byteCounterDone bool                    // the stream of byteCounter was consumed
+	throughput      *bytecounter.Throughput // created on first report while byteCounter is active
+	resumedBytes    int64                   // bytes of the streams before the step was resumed, see doReplicationResumable
 }
 
+// window over which Step.ReportInfo computes the throughput of the step
+const stepThroughputWindow = 10 * time.Second
+
 func (s *Step) TargetEquals(other driver.Step) bool {
 	t, ok := other.(*Step)
 	if !ok {
@@ -184,17 +206,39 @@ func (s *Step) TargetDate() time.Time {
 }
 
 func (s *Step) Step(ctx context.Context) error {
-	return s.doReplication(ctx)
+	err := s.doReplicationWithHooks(ctx)
+	stepState := s.parent.policy.StepStateFile
+	if err != nil {
+		stepState.stepInterrupted(ctx, s, s.bytesReplicated())
+		return err
+	}
+	stepState.stepDone(ctx, s)
+	return nil
+}
+
+func (s *Step) bytesReplicated() int64 {
+	defer s.byteCounterMtx.Lock().Unlock()
+	if s.byteCounter == nil {
+		return s.resumedBytes
+	}
+	return s.resumedBytes + s.byteCounter.Count()
 }
 
 func (s *Step) ReportInfo() *report.StepInfo {
 
-	// get current byteCounter value
-	var byteCounter int64
+	// get current byteCounter value and throughput
+	var byteCounter, bytesPerSecond int64
 	s.byteCounterMtx.Lock()
 	if s.byteCounter != nil {
 		byteCounter = s.byteCounter.Count()
+		if !s.byteCounterDone {
+			if s.throughput == nil {
+				s.throughput = bytecounter.NewThroughput(stepThroughputWindow)
+			}
+			bytesPerSecond = s.throughput.Sample(time.Now(), byteCounter)
+		}
 	}
+	byteCounter += s.resumedBytes
 	s.byteCounterMtx.Unlock()
 
 	from := ""
@@ -219,6 +263,8 @@ func (s *Step) ReportInfo() *report.StepInfo {
 		Encrypted:       encrypted,
 		BytesExpected:   s.expectedSize,
 		BytesReplicated: byteCounter,
+		BytesPerSecond:  bytesPerSecond,
+		Deferred:        s.Deferred(),
 	}
 }
 
@@ -231,7 +277,67 @@ func NewPlanner(secsPerState *prometheus.HistogramVec, bytesReplicated *promethe
 		promBytesReplicated: bytesReplicated,
 	}
 }
-func resolveConflict(conflict error) (path []*pdu.FilesystemVersion, msg string) {
+
+// newIncrementalSteps returns the steps that replicate path[len(path)-1] incrementally from path[0],
+// split according to the policy's IncrementalSteps.
+// path must contain at least two versions, all but path[0] must be snapshots.
+func (fs *Filesystem) newIncrementalSteps(path []*pdu.FilesystemVersion) []*Step {
+	newStep := func(from, to *pdu.FilesystemVersion, intermediates bool) *Step {
+		return &Step{
+			parent:   fs,
+			sender:   fs.sender,
+			receiver: fs.receiver,
+
+			from:          from,
+			to:            to,
+			intermediates: intermediates,
+			encrypt:       fs.policy.EncryptedSend,
+		}
+	}
+	last := path[len(path)-1]
+	switch fs.policy.IncrementalSteps {
+	case IncrementalStepsIntermediates:
+		if len(path) == 2 {
+			return []*Step{newStep(path[0], last, false)}
+		}
+		if path[0].Type != pdu.FilesystemVersion_Snapshot {
+			// zfs send -I requires a snapshot as the incremental source
+			return []*Step{newStep(path[0], path[1], false), newStep(path[1], last, true)}
+		}
+		return []*Step{newStep(path[0], last, true)}
+	case IncrementalStepsDirect:
+		return []*Step{newStep(path[0], last, false)}
+	default:
+		steps := make([]*Step, 0, len(path)-1)
+		for i := 0; i < len(path)-1; i++ {
+			steps = append(steps, newStep(path[i], path[i+1], false))
+		}
+		return steps
+	}
+}
+
+// If resolveConflict returns a non-nil rollbackTo, the receiver must roll back to that
+// snapshot (see pdu.ReceiveReq.RollbackTo) before receiving the first step of path.
+func resolveConflict(conflict error, policy PlannerPolicy) (path []*pdu.FilesystemVersion, rollbackTo *pdu.FilesystemVersion, msg string) {
+	if diverged, ok := conflict.(*ConflictDiverged); ok {
+		if !policy.ReceiverRollback {
+			return nil, nil, "receiver rollback is disabled by policy"
+		}
+		common := diverged.SortedReceiverVersions[:len(diverged.SortedReceiverVersions)-len(diverged.ReceiverOnly)]
+		rollbackTo := common[len(common)-1]
+		if rollbackTo.Type != pdu.FilesystemVersion_Snapshot {
+			return nil, nil, fmt.Sprintf("cannot roll back receiver to common version %s, it is not a snapshot on the receiver", rollbackTo.RelName())
+		}
+		path, conflict := IncrementalPath(common, diverged.SortedSenderVersions)
+		if conflict != nil {
+			return nil, nil, fmt.Sprintf("no incremental path after rollback to common snapshot: %s", conflict)
+		}
+		if len(path) < 2 {
+			return nil, nil, fmt.Sprintf("sender has no snapshots newer than common snapshot %s", rollbackTo.RelName())
+		}
+		return path, rollbackTo, fmt.Sprintf("roll back receiver to common snapshot %s, setting divergent state aside", rollbackTo.RelName())
+	}
+
 	if noCommonAncestor, ok := conflict.(*ConflictNoCommonAncestor); ok {
 		if len(noCommonAncestor.SortedReceiverVersions) == 0 {
 			// TODO this is hard-coded replication policy: most recent snapshot as source
@@ -244,12 +350,35 @@ func resolveConflict(conflict error) (path []*pdu.FilesystemVersion, msg string)
 				}
 			}
 			if mostRecentSnap == nil {
-				return nil, "no snapshots available on sender side"
+				return nil, nil, "no snapshots available on sender side"
 			}
-			return []*pdu.FilesystemVersion{mostRecentSnap}, fmt.Sprintf("start replication at most recent snapshot %s", mostRecentSnap.RelName())
+			return []*pdu.FilesystemVersion{mostRecentSnap}, nil, fmt.Sprintf("start replication at most recent snapshot %s", mostRecentSnap.RelName())
 		}
 	}
-	return nil, "no automated way to handle conflict type"
+	return nil, nil, "no automated way to handle conflict type"
+}
+
+// Fails early if the receiver reports the features of its pool and
+// any feature required by the policy's send flags is missing.
+// Otherwise, the receive would only fail mid-stream.
+func checkReceiverPoolFeatures(policy PlannerPolicy, rlfssres *pdu.ListFilesystemRes) error {
+	if !rlfssres.GetRootFSPoolFeaturesValid() {
+		return nil // older receiver, can't check
+	}
+	have := make(map[string]bool, len(rlfssres.GetRootFSPoolFeatures()))
+	for _, f := range rlfssres.GetRootFSPoolFeatures() {
+		have[f] = true
+	}
+	var missing []string
+	for _, f := range policy.requiredReceiverPoolFeatures() {
+		if !have[f] {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("receiver's pool lacks features required by the send options: %s", strings.Join(missing, ", "))
+	}
+	return nil
 }
 
 func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
@@ -272,6 +401,12 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 	}
 	rfss := rlfssres.GetFilesystems()
 
+	policy := p.policy.withSenderSendFlags(slfssres)
+	if err := checkReceiverPoolFeatures(policy, rlfssres); err != nil {
+		log.WithError(err).Error("receiver cannot receive the streams mandated by the send options")
+		return nil, err
+	}
+
 	sizeEstimateRequestSem := semaphore.New(envconst.Int64("ZREPL_REPLICATION_MAX_CONCURRENT_SIZE_ESTIMATE", 4))
 
 	q := make([]*Filesystem, 0, len(sfss))
@@ -292,7 +427,7 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 		q = append(q, &Filesystem{
 			sender:                 p.sender,
 			receiver:               p.receiver,
-			policy:                 p.policy,
+			policy:                 policy,
 			Path:                   fs.Path,
 			senderFS:               fs,
 			receiverFS:             receiverFS,
@@ -316,6 +451,15 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		return nil, fmt.Errorf("sender filesystem is not encrypted but policy mandates encrypted send")
 	}
 
+	// A raw send of an encrypted filesystem produces an encrypted filesystem on the receiver.
+	// If the receiver's filesystem exists but is not encrypted, it was received through non-raw sends,
+	// and ZFS refuses to receive raw incrementals on top of it.
+	// Detect this here instead of failing mid-stream.
+	if fs.policy.RawSend && fs.senderFS.GetIsEncrypted() &&
+		fs.receiverFS != nil && !fs.receiverFS.GetIsPlaceholder() && !fs.receiverFS.GetIsEncrypted() {
+		return nil, fmt.Errorf("policy mandates raw sends but receiver filesystem is not encrypted: it was replicated with non-raw sends, which cannot be mixed with raw sends")
+	}
+
 	sfsvsres, err := fs.sender.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: fs.Path})
 	if err != nil {
 		log(ctx).WithError(err).Error("cannot get remote filesystem versions")
@@ -341,6 +485,10 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		rfsvs = []*pdu.FilesystemVersion{}
 	}
 
+	if steps := fs.restoreSteps(ctx, rfsvs); steps != nil {
+		return steps, nil
+	}
+
 	var resumeToken *zfs.ResumeToken
 	var resumeTokenRaw string
 	if fs.receiverFS != nil && fs.receiverFS.ResumeToken != "" {
@@ -390,22 +538,35 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		}
 
 		encryptionMatches := false
-		switch fs.policy.EncryptedSend {
-		case True:
+		switch {
+		case fs.policy.RawSend:
+			// raw sends always produce resume tokens with `rawok` and `compressok`
+			encryptionMatches = resumeToken.RawOK && resumeToken.CompressOK
+		case fs.policy.EncryptedSend == True:
 			encryptionMatches = resumeToken.RawOK && resumeToken.CompressOK
-		case False:
-			encryptionMatches = !resumeToken.RawOK && !resumeToken.CompressOK
-		case DontCare:
+		case fs.policy.EncryptedSend == False:
+			// compressed sends produce resume tokens with `compressok`
+			encryptionMatches = !resumeToken.RawOK && resumeToken.CompressOK == fs.policy.CompressedSend
+		case fs.policy.EncryptedSend == DontCare:
 			encryptionMatches = true
 		}
 
+		// send -e and -L produce resume tokens with `embedok` and `largeblockok`
+		flagsMatch := true
+		if !fs.policy.RawSend && fs.policy.EncryptedSend == False {
+			flagsMatch = resumeToken.EmbedOK == fs.policy.EmbeddedDataSend && resumeToken.LargeBlockOK == fs.policy.LargeBlocksSend
+		}
+
 		log(ctx).WithField("fromVersion", fromVersion).
 			WithField("toVersion", toVersion).
 			WithField("encryptionMatches", encryptionMatches).
+			WithField("flagsMatch", flagsMatch).
 			Debug("result of resume-token-matching to sender's versions")
 
 		if !encryptionMatches {
 			return nil, fmt.Errorf("resume token `rawok`=%v and `compressok`=%v are incompatible with encryption policy=%v", resumeToken.RawOK, resumeToken.CompressOK, fs.policy.EncryptedSend)
+		} else if !flagsMatch {
+			return nil, fmt.Errorf("resume token `embedok`=%v and `largeblockok`=%v are incompatible with the send options (embedded_data=%v, large_blocks=%v)", resumeToken.EmbedOK, resumeToken.LargeBlockOK, fs.policy.EmbeddedDataSend, fs.policy.LargeBlocksSend)
 		} else if toVersion == nil {
 			return nil, fmt.Errorf("resume token `toguid` = %v not found on sender (`toname` = %q)", resumeToken.ToGUID, resumeToken.ToName)
 		} else if fromVersion == toVersion {
@@ -439,21 +600,15 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 
 		steps = make([]*Step, 0, len(remainingSFSVs)) // shadow
 		steps = append(steps, resumeStep)
-		for i := 0; i < len(remainingSFSVs)-1; i++ {
-			steps = append(steps, &Step{
-				parent:   fs,
-				sender:   fs.sender,
-				receiver: fs.receiver,
-				from:     remainingSFSVs[i],
-				to:       remainingSFSVs[i+1],
-				encrypt:  fs.policy.EncryptedSend,
-			})
+		if len(remainingSFSVs) >= 2 {
+			steps = append(steps, fs.newIncrementalSteps(remainingSFSVs)...)
 		}
 	} else { // resumeToken == nil
 		path, conflict := IncrementalPath(rfsvs, sfsvs)
+		var rollbackTo *pdu.FilesystemVersion
 		if conflict != nil {
 			var msg string
-			path, msg = resolveConflict(conflict) // no shadowing allowed!
+			path, rollbackTo, msg = resolveConflict(conflict, fs.policy) // no shadowing allowed!
 			if path != nil {
 				log(ctx).WithField("conflict", conflict).Info("conflict")
 				log(ctx).WithField("resolution", msg).Info("automatically resolved")
@@ -465,6 +620,10 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		if len(path) == 0 {
 			return nil, conflict
 		}
+		if len(path) > 1 && path[0].Type == pdu.FilesystemVersion_Bookmark {
+			log(ctx).WithField("bookmark", path[0].RelName()).
+				Info("most recent common snapshot does not exist on sender anymore, using its bookmark as incremental source")
+		}
 
 		steps = make([]*Step, 0, len(path)) // shadow
 		if len(path) == 1 {
@@ -478,17 +637,8 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 				encrypt: fs.policy.EncryptedSend,
 			})
 		} else {
-			for i := 0; i < len(path)-1; i++ {
-				steps = append(steps, &Step{
-					parent:   fs,
-					sender:   fs.sender,
-					receiver: fs.receiver,
-
-					from:    path[i],
-					to:      path[i+1],
-					encrypt: fs.policy.EncryptedSend,
-				})
-			}
+			steps = append(steps, fs.newIncrementalSteps(path)...)
+			steps[0].rollbackTo = rollbackTo
 		}
 	}
 
@@ -496,6 +646,12 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		log(ctx).Info("planning determined that no replication steps are required")
 	}
 
+	if !fs.policy.SizeEstimates {
+		log(ctx).Debug("filesystem planning finished, size estimates are disabled by policy")
+		fs.policy.StepStateFile.planned(ctx, fs.Path, steps)
+		return steps, nil
+	}
+
 	log(ctx).Debug("compute send size estimate")
 	errs := make(chan error, len(steps))
 	fanOutCtx, fanOutCancel := context.WithCancel(ctx)
@@ -536,6 +692,7 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 	}
 
 	log(ctx).Debug("filesystem planning finished")
+	fs.policy.StepStateFile.planned(ctx, fs.Path, steps)
 	return steps, nil
 }
 
@@ -545,6 +702,13 @@ func (s *Step) updateSizeEstimate(ctx context.Context) error {
 
 	sr := s.buildSendRequest(true)
 
+	cache := s.parent.policy.SizeEstimateCache
+	if size, ok := cache.get(sr, s.encrypt); ok {
+		log.WithField("size", size).Debug("use cached size estimate")
+		s.expectedSize = size
+		return nil
+	}
+
 	log.Debug("initiate dry run send request")
 	sres, _, err := s.sender.Send(ctx, sr)
 	if err != nil {
@@ -557,6 +721,7 @@ func (s *Step) updateSizeEstimate(ctx context.Context) error {
 		return err
 	}
 	s.expectedSize = sres.GetExpectedSize()
+	cache.put(sr, s.encrypt, s.expectedSize)
 	return nil
 }
 
@@ -570,6 +735,7 @@ func (s *Step) buildSendRequest(dryRun bool) (sr *pdu.SendReq) {
 		ResumeToken:       s.resumeToken,
 		DryRun:            dryRun,
 		ReplicationConfig: &s.parent.policy.ReplicationConfig,
+		Intermediates:     s.intermediates,
 	}
 	return sr
 }
@@ -598,6 +764,18 @@ func (s *Step) doReplication(ctx context.Context) error {
 	}
 	defer stream.Close()
 
+	if s.intermediates && !sres.GetIntermediates() {
+		// senders that predate SendReq.Intermediates ignore it and send the step with zfs send -i,
+		// which would skip the intermediate snapshots for good
+		err := errors.New("sender does not support `incremental_steps: intermediates`, it must run the same zrepl version as the receiver or newer")
+		log.Error(err.Error())
+		return err
+	}
+
+	if l := s.parent.policy.BandwidthLimiter; l != nil {
+		stream = bandwidthlimit.WrapReadCloser(ctx, stream, l)
+	}
+
 	// Install a byte counter to track progress + for status report
 	byteCountingStream := bytecounter.NewReadCloser(stream)
 	s.byteCounterMtx.Lock()
@@ -605,6 +783,7 @@ func (s *Step) doReplication(ctx context.Context) error {
 	s.byteCounterMtx.Unlock()
 	defer func() {
 		defer s.byteCounterMtx.Lock().Unlock()
+		s.byteCounterDone = true
 		if s.parent.promBytesReplicated != nil {
 			s.parent.promBytesReplicated.Add(float64(s.byteCounter.Count()))
 		}
@@ -615,6 +794,8 @@ func (s *Step) doReplication(ctx context.Context) error {
 		To:                sr.GetTo(),
 		ClearResumeToken:  !sres.UsedResumeToken,
 		ReplicationConfig: &s.parent.policy.ReplicationConfig,
+		RollbackTo:        s.rollbackTo,
+		From:              s.from,
 	}
 	log.Debug("initiate receive request")
 	_, err = s.receiver.Receive(ctx, rr, byteCountingStream)
@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func testFilesystemVersion(t pdu.FilesystemVersion_VersionType, name string, id uint64) *pdu.FilesystemVersion {
+	return &pdu.FilesystemVersion{
+		Type:      t,
+		Name:      name,
+		Guid:      id,
+		CreateTXG: id,
+		Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(id), 0)),
+	}
+}
+
+func TestResolveConflictReceiverRollback(t *testing.T) {
+	snap := pdu.FilesystemVersion_Snapshot
+	book := pdu.FilesystemVersion_Bookmark
+
+	sender := []*pdu.FilesystemVersion{
+		testFilesystemVersion(snap, "a", 1),
+		testFilesystemVersion(snap, "b", 2),
+		testFilesystemVersion(snap, "d", 4),
+		testFilesystemVersion(snap, "e", 5),
+	}
+	receiver := []*pdu.FilesystemVersion{
+		testFilesystemVersion(snap, "a", 1),
+		testFilesystemVersion(snap, "b", 2),
+		testFilesystemVersion(snap, "c", 3), // receiver-only
+	}
+	_, conflict := IncrementalPath(receiver, sender)
+	require.IsType(t, &ConflictDiverged{}, conflict)
+
+	path, rollbackTo, _ := resolveConflict(conflict, PlannerPolicy{})
+	assert.Nil(t, path, "rollback must be opt-in")
+	assert.Nil(t, rollbackTo)
+
+	path, rollbackTo, _ = resolveConflict(conflict, PlannerPolicy{ReceiverRollback: true})
+	require.NotNil(t, rollbackTo)
+	assert.Equal(t, "b", rollbackTo.Name)
+	require.Len(t, path, 3)
+	assert.Equal(t, []string{"b", "d", "e"}, []string{path[0].Name, path[1].Name, path[2].Name})
+
+	t.Run("common version is a bookmark on receiver", func(t *testing.T) {
+		receiver := []*pdu.FilesystemVersion{
+			testFilesystemVersion(book, "b", 2),
+			testFilesystemVersion(snap, "c", 3),
+		}
+		_, conflict := IncrementalPath(receiver, sender)
+		require.IsType(t, &ConflictDiverged{}, conflict)
+		path, rollbackTo, _ := resolveConflict(conflict, PlannerPolicy{ReceiverRollback: true})
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+	})
+
+	t.Run("no newer snapshots on sender", func(t *testing.T) {
+		_, conflict := IncrementalPath(receiver, sender[:2])
+		require.IsType(t, &ConflictDiverged{}, conflict)
+		path, rollbackTo, _ := resolveConflict(conflict, PlannerPolicy{ReceiverRollback: true})
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+	})
+}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"context"
+)
+
+// StepHooks runs hooks around replication steps, e.g., the hooks of the daemon's job.
+type StepHooks interface {
+	// RunStep runs step surrounded by the hooks that apply to the step described by info.
+	// step returns the number of bytes that it replicated.
+	// RunStep returns step's error, or an error without running step if a hook prevents the step.
+	RunStep(ctx context.Context, info StepHookInfo, step func(ctx context.Context) (bytesReplicated int64, err error)) error
+}
+
+// StepHookInfo describes a replication step to StepHooks.
+type StepHookInfo struct {
+	Filesystem string
+	From       string // relative name of the incremental source (@snap or #bookmark), empty for full sends
+	To         string // relative name of the target snapshot
+}
+
+// doReplicationWithHooks runs doReplicationResumable surrounded by the policy's StepHooks.
+func (s *Step) doReplicationWithHooks(ctx context.Context) error {
+	if s.parent.policy.StepHooks == nil {
+		return s.doReplicationResumable(ctx)
+	}
+	info := StepHookInfo{
+		Filesystem: s.parent.Path,
+		To:         s.to.RelName(),
+	}
+	if s.from != nil {
+		info.From = s.from.RelName()
+	}
+	return s.parent.policy.StepHooks.RunStep(ctx, info, func(ctx context.Context) (int64, error) {
+		err := s.doReplicationResumable(ctx)
+		return s.bytesReplicated(), err
+	})
+}
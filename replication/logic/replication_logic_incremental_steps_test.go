@@ -0,0 +1,70 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestNewIncrementalSteps(t *testing.T) {
+	snap := pdu.FilesystemVersion_Snapshot
+	book := pdu.FilesystemVersion_Bookmark
+
+	type step struct {
+		from, to      string
+		intermediates bool
+	}
+	stepsOf := func(policy IncrementalSteps, path []*pdu.FilesystemVersion) (r []step) {
+		fs := &Filesystem{policy: PlannerPolicy{IncrementalSteps: policy}}
+		for _, s := range fs.newIncrementalSteps(path) {
+			r = append(r, step{s.from.Name, s.to.Name, s.intermediates})
+		}
+		return r
+	}
+
+	path := []*pdu.FilesystemVersion{
+		testFilesystemVersion(snap, "a", 1),
+		testFilesystemVersion(snap, "b", 2),
+		testFilesystemVersion(snap, "c", 3),
+	}
+	assert.Equal(t, []step{{"a", "b", false}, {"b", "c", false}}, stepsOf(IncrementalStepsPerSnapshot, path))
+	assert.Equal(t, []step{{"a", "c", true}}, stepsOf(IncrementalStepsIntermediates, path))
+	assert.Equal(t, []step{{"a", "c", false}}, stepsOf(IncrementalStepsDirect, path))
+
+	// nothing in between
+	assert.Equal(t, []step{{"a", "b", false}}, stepsOf(IncrementalStepsIntermediates, path[:2]))
+
+	// zfs send -I requires a snapshot as incremental source
+	fromBookmark := append([]*pdu.FilesystemVersion{testFilesystemVersion(book, "a", 1)}, path[1:]...)
+	assert.Equal(t, []step{{"a", "b", false}, {"b", "c", true}}, stepsOf(IncrementalStepsIntermediates, fromBookmark))
+	assert.Equal(t, []step{{"a", "c", false}}, stepsOf(IncrementalStepsDirect, fromBookmark))
+}
+
+func TestIntermediatesStepRequiresSupportingSender(t *testing.T) {
+	snap := pdu.FilesystemVersion_Snapshot
+	from, to := testFilesystemVersion(snap, "a", 1), testFilesystemVersion(snap, "c", 3)
+	step := func(sender Sender, receiver Receiver) *Step {
+		return &Step{
+			sender:        sender,
+			receiver:      receiver,
+			parent:        &Filesystem{Path: "pool/fs"},
+			from:          from,
+			to:            to,
+			encrypt:       DontCare,
+			intermediates: true,
+		}
+	}
+
+	receiver := &resumeTestReceiver{}
+	require.NoError(t, step(&resumeTestSender{}, receiver).doReplication(context.Background()))
+	assert.Len(t, receiver.receiveReqs, 1)
+
+	receiver = &resumeTestReceiver{}
+	err := step(&resumeTestSender{ignoreIntermediates: true}, receiver).doReplication(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, receiver.receiveReqs, "the stream lacks the intermediate snapshots")
+}
@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+)
+
+// LargeSteps determines how steps are handled whose size estimate exceeds Threshold,
+// so that a single huge step does not delay the replication of all other filesystems.
+// Steps without size estimate are never considered large.
+type LargeSteps struct {
+	Threshold int64 // in bytes, 0 disables the policy
+	Action    LargeStepsAction
+}
+
+type LargeStepsAction int
+
+const (
+	// large steps are executed in the driver's queue for deferred steps (see driver.DeferredStep)
+	LargeStepsDefer LargeStepsAction = iota
+	// the first large step of a filesystem and all later steps are not planned
+	LargeStepsSkip
+)
+
+func LargeStepsFromConfig(in *config.ReplicationOptionsLargeSteps) (LargeSteps, error) {
+	var p LargeSteps
+	switch in.Action {
+	case "defer":
+		p.Action = LargeStepsDefer
+	case "skip":
+		p.Action = LargeStepsSkip
+	default:
+		return p, errors.Errorf("field `action`: %q is not in {defer,skip}", in.Action)
+	}
+	if in.Threshold == "unlimited" {
+		return p, nil
+	}
+	threshold, err := bandwidthlimit.ParseSize(in.Threshold)
+	if err != nil {
+		return p, errors.Wrap(err, "field `threshold`")
+	}
+	if threshold == 0 {
+		return p, errors.New("field `threshold` must be positive or `unlimited`")
+	}
+	p.Threshold = threshold
+	return p, nil
+}
+
+func (p LargeSteps) isLarge(s *Step) bool {
+	return p.Threshold > 0 && s.expectedSize > p.Threshold
+}
+
+// Deferred implements driver.DeferredStep.
+func (s *Step) Deferred() bool {
+	p := s.parent.policy.LargeSteps
+	return p.Action == LargeStepsDefer && p.isLarge(s)
+}
+
+// skipLargeSteps applies LargeStepsSkip to the planned steps of fs.
+func (fs *Filesystem) skipLargeSteps(ctx context.Context, steps []*Step) []*Step {
+	p := fs.policy.LargeSteps
+	if p.Action != LargeStepsSkip {
+		return steps
+	}
+	for i, step := range steps {
+		if p.isLarge(step) {
+			getLogger(ctx).WithField("filesystem", fs.Path).
+				WithField("step", step.String()).
+				WithField("expected_size", step.expectedSize).
+				WithField("threshold", p.Threshold).
+				WithField("skipped_steps", len(steps)-i).
+				Warn("skipping step that exceeds the size threshold, and all later steps of the filesystem")
+			return steps[:i]
+		}
+	}
+	return steps
+}
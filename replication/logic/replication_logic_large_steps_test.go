@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestLargeSteps(t *testing.T) {
+	p, err := LargeStepsFromConfig(&config.ReplicationOptionsLargeSteps{Threshold: "unlimited", Action: "defer"})
+	require.NoError(t, err)
+	assert.Equal(t, LargeSteps{}, p)
+	p, err = LargeStepsFromConfig(&config.ReplicationOptionsLargeSteps{Threshold: "1KiB", Action: "skip"})
+	require.NoError(t, err)
+	assert.Equal(t, LargeSteps{Threshold: 1024, Action: LargeStepsSkip}, p)
+	_, err = LargeStepsFromConfig(&config.ReplicationOptionsLargeSteps{Threshold: "0B", Action: "skip"})
+	assert.Error(t, err)
+	_, err = LargeStepsFromConfig(&config.ReplicationOptionsLargeSteps{Threshold: "1KiB", Action: "drop"})
+	assert.Error(t, err)
+
+	snap := pdu.FilesystemVersion_Snapshot
+	stepsOf := func(p LargeSteps, sizes ...int64) (*Filesystem, []*Step) {
+		fs := &Filesystem{Path: "pool/fs", policy: PlannerPolicy{LargeSteps: p}}
+		var steps []*Step
+		for i, size := range sizes {
+			steps = append(steps, &Step{
+				parent:       fs,
+				from:         testFilesystemVersion(snap, "from", uint64(2*i+1)),
+				to:           testFilesystemVersion(snap, "to", uint64(2*i+2)),
+				expectedSize: size,
+			})
+		}
+		return fs, steps
+	}
+	ctx := context.Background()
+
+	fs, steps := stepsOf(LargeSteps{Threshold: 100, Action: LargeStepsSkip}, 10, 0, 101, 10)
+	assert.Len(t, fs.skipLargeSteps(ctx, steps), 2, "the large step and all later steps are skipped, steps without estimate are not large")
+	for _, s := range steps {
+		assert.False(t, s.Deferred())
+	}
+
+	fs, steps = stepsOf(LargeSteps{Threshold: 100, Action: LargeStepsDefer}, 10, 101)
+	assert.Len(t, fs.skipLargeSteps(ctx, steps), 2)
+	assert.False(t, steps[0].Deferred())
+	assert.True(t, steps[1].Deferred())
+
+	fs, steps = stepsOf(LargeSteps{}, 1<<40)
+	assert.False(t, steps[0].Deferred(), "policy disabled")
+}
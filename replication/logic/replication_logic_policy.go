@@ -5,11 +5,87 @@ import (
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
 )
 
 type PlannerPolicy struct {
-	EncryptedSend     tri // all sends must be encrypted (send -w, and encryption!=off)
+	EncryptedSend     tri  // all sends must be encrypted (send -w, and encryption!=off)
+	RawSend           bool // all sends are raw (send -w), regardless of EncryptedSend. Only known if the sender is local or reports it (see withSenderSendFlags).
+	CompressedSend    bool // all sends use send -c. Only known if the sender is local or reports it.
+	EmbeddedDataSend  bool // all sends use send -e. Only known if the sender is local or reports it.
+	LargeBlocksSend   bool // all sends use send -L. Only known if the sender is local or reports it.
 	ReplicationConfig pdu.ReplicationConfig
+	SizeEstimates     bool                    // compute size estimates of planned steps (zfs send -nP) for the progress report
+	SizeEstimateCache *SizeEstimateCache      // may be nil, shared across planning runs of the job
+	BandwidthLimiter  *bandwidthlimit.Limiter // may be nil, limits the rate at which send streams are read
+	StepStateFile     *StepStateFile          // may be nil, persists planned steps across daemon restarts
+	ReceiverRollback  bool                    // resolve diverged receivers by rolling back to the most recent common snapshot
+	IncrementalSteps  IncrementalSteps        // how incremental replication is split into steps
+	StepHooks         StepHooks               // may be nil, run around each step
+	LargeSteps        LargeSteps              // how steps with a size estimate above a threshold are handled
+	StepResume        StepResume              // whether steps are resumed from the receiver's partial state after a failure
+}
+
+// IncrementalSteps determines how the incremental replication from the most recent
+// common version to the sender's most recent snapshot is split into steps.
+type IncrementalSteps int
+
+const (
+	// one step per snapshot (zfs send -i), the receiver gets every snapshot
+	IncrementalStepsPerSnapshot IncrementalSteps = iota
+	// a single step that includes all intermediate snapshots (zfs send -I)
+	IncrementalStepsIntermediates
+	// a single step that skips intermediate snapshots (zfs send -i)
+	IncrementalStepsDirect
+)
+
+func IncrementalStepsFromConfig(in string) (IncrementalSteps, error) {
+	switch in {
+	case "per_snapshot":
+		return IncrementalStepsPerSnapshot, nil
+	case "intermediates":
+		return IncrementalStepsIntermediates, nil
+	case "direct":
+		return IncrementalStepsDirect, nil
+	default:
+		return 0, errors.Errorf("%q is not in {per_snapshot,intermediates,direct}", in)
+	}
+}
+
+// withSenderSendFlags returns p with the send flags that the sender reported in res,
+// for pull jobs, whose policy does not know them (see PlannerPolicy).
+// Returns p unchanged if the sender did not report them, e.g., if it runs an older version.
+func (p PlannerPolicy) withSenderSendFlags(res *pdu.ListFilesystemRes) PlannerPolicy {
+	if !res.GetSendFlagsValid() {
+		return p
+	}
+	if p.EncryptedSend == DontCare {
+		p.EncryptedSend = TriFromBool(res.GetSendEncrypted())
+	}
+	p.RawSend = res.GetSendRaw()
+	p.CompressedSend = res.GetSendCompressed()
+	p.EmbeddedDataSend = res.GetSendEmbeddedData()
+	p.LargeBlocksSend = res.GetSendLargeBlocks()
+	return p
+}
+
+// The pool features that the receiver's pool must have (enabled or active)
+// in order to receive the streams produced by the sends mandated by p.
+func (p PlannerPolicy) requiredReceiverPoolFeatures() []string {
+	var features []string
+	if p.EncryptedSend == True {
+		features = append(features, "encryption")
+	}
+	if p.CompressedSend {
+		features = append(features, "lz4_compress")
+	}
+	if p.EmbeddedDataSend {
+		features = append(features, "embedded_data")
+	}
+	if p.LargeBlocksSend {
+		features = append(features, "large_blocks")
+	}
+	return features
 }
 
 func ReplicationConfigFromConfig(in *config.Replication) (*pdu.ReplicationConfig, error) {
@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestCheckReceiverPoolFeaturesPull(t *testing.T) {
+	// the active side of a pull job does not know the sender's send flags
+	pull := PlannerPolicy{EncryptedSend: DontCare}
+	receiver := &pdu.ListFilesystemRes{
+		RootFSPoolFeatures:      []string{"lz4_compress", "embedded_data"},
+		RootFSPoolFeaturesValid: true,
+	}
+
+	olderSender := &pdu.ListFilesystemRes{}
+	assert.Equal(t, pull, pull.withSenderSendFlags(olderSender))
+	assert.NoError(t, checkReceiverPoolFeatures(pull.withSenderSendFlags(olderSender), receiver))
+
+	sender := &pdu.ListFilesystemRes{
+		SendFlagsValid:   true,
+		SendCompressed:   true,
+		SendEmbeddedData: true,
+	}
+	policy := pull.withSenderSendFlags(sender)
+	assert.True(t, policy.EncryptedSend == False)
+	assert.NoError(t, checkReceiverPoolFeatures(policy, receiver))
+
+	sender.SendLargeBlocks = true
+	err := checkReceiverPoolFeatures(pull.withSenderSendFlags(sender), receiver)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "large_blocks")
+	}
+
+	sender.SendLargeBlocks, sender.SendEncrypted = false, true
+	err = checkReceiverPoolFeatures(pull.withSenderSendFlags(sender), receiver)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "encryption")
+	}
+
+	// the policy of push jobs mandates encryption
+	push := PlannerPolicy{EncryptedSend: True}
+	assert.True(t, push.withSenderSendFlags(&pdu.ListFilesystemRes{SendFlagsValid: true}).EncryptedSend == True)
+}
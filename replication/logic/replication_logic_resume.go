@@ -0,0 +1,140 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// StepResume determines whether and how often a step whose send or receive failed
+// after some data was transferred (e.g. because the data connection dropped)
+// is resumed from the receiver's partial state (zfs send -t) within the same attempt,
+// instead of failing the step and starting over in the driver's next attempt.
+type StepResume struct {
+	MaxAttempts int // 0 disables resumption within a step
+	// how long to wait for the receiver to report a resume token after a failure,
+	// i.e., for the receiver's zfs recv to notice the failure and exit
+	TokenTimeout time.Duration
+}
+
+// interval at which the receiver is polled for a resume token
+const stepResumeTokenPollInterval = 5 * time.Second
+
+func StepResumeFromConfig(in *config.ReplicationOptionsStepResume) (StepResume, error) {
+	if in.MaxAttempts < 0 {
+		return StepResume{}, errors.New("field `max_attempts` must not be negative")
+	}
+	if in.TokenTimeout <= 0 {
+		return StepResume{}, errors.New("field `token_timeout` must be positive")
+	}
+	return StepResume{MaxAttempts: in.MaxAttempts, TokenTimeout: in.TokenTimeout}, nil
+}
+
+// doReplicationResumable runs doReplication and, if it fails after some data was transferred,
+// resumes it from the receiver's resume token up to policy.StepResume.MaxAttempts times.
+func (s *Step) doReplicationResumable(ctx context.Context) error {
+	err := s.doReplication(ctx)
+	p := s.parent.policy.StepResume
+	for attempt := 1; err != nil && attempt <= p.MaxAttempts; attempt++ {
+		log := getLogger(ctx).WithField("filesystem", s.parent.Path).WithField("step", s.String()).WithField("resume_attempt", attempt)
+		if ctx.Err() != nil {
+			return err
+		}
+		if s.lastStreamBytes() == 0 {
+			log.WithError(err).Debug("step failed before any data was transferred, not resuming")
+			return err
+		}
+		log.WithError(err).Info("step failed, waiting for receiver's resume token")
+		token, tokenErr := s.waitForResumeToken(ctx, p.TokenTimeout)
+		if tokenErr != nil {
+			log.WithError(tokenErr).Warn("cannot resume step")
+			return err
+		}
+		log.WithField("token", token).Info("resuming step from receiver's partial state")
+		s.startResume(token)
+		err = s.doReplication(ctx)
+	}
+	return err
+}
+
+// lastStreamBytes returns the number of bytes of the most recent send stream of s.
+func (s *Step) lastStreamBytes() int64 {
+	defer s.byteCounterMtx.Lock().Unlock()
+	if s.byteCounter == nil {
+		return 0
+	}
+	return s.byteCounter.Count()
+}
+
+// startResume makes the next doReplication resume from token.
+// The bytes that were replicated so far remain accounted for in the step's report.
+//
+// The receiver already rolled back before the interrupted receive: rolling back again would
+// set aside the partially received state that token refers to, so the resumed receive does not.
+func (s *Step) startResume(token string) {
+	defer s.byteCounterMtx.Lock().Unlock()
+	if s.byteCounter != nil {
+		s.resumedBytes += s.byteCounter.Count()
+	}
+	s.byteCounter = nil
+	s.byteCounterDone = false
+	s.throughput = nil
+	s.resumeToken = token
+	s.rollbackTo = nil
+}
+
+// waitForResumeToken polls the receiver until it reports a resume token for s's filesystem
+// that belongs to s, or until timeout expires.
+func (s *Step) waitForResumeToken(ctx context.Context, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var lastErr error = errors.New("receiver did not report a resume token")
+	for {
+		token, err := s.receiverResumeToken(ctx)
+		if err == nil && token != "" {
+			parsed, err := zfs.ParseResumeToken(ctx, token)
+			if err != nil {
+				return "", errors.Wrap(err, "cannot decode resume token")
+			}
+			if !resumeTokenMatchesStep(parsed, s) {
+				return "", errors.Errorf("resume token (toname=%q) does not belong to step %s", parsed.ToName, s)
+			}
+			return token, nil
+		} else if err != nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrapf(lastErr, "no resume token after %s", timeout)
+		case <-time.After(stepResumeTokenPollInterval):
+		}
+	}
+}
+
+func (s *Step) receiverResumeToken(ctx context.Context) (string, error) {
+	res, err := s.receiver.ListFilesystems(ctx, &pdu.ListFilesystemReq{})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot list receiver filesystems")
+	}
+	for _, fs := range res.GetFilesystems() {
+		if fs.GetPath() == s.parent.Path {
+			return fs.GetResumeToken(), nil
+		}
+	}
+	return "", nil
+}
+
+func resumeTokenMatchesStep(t *zfs.ResumeToken, s *Step) bool {
+	if !t.HasToGUID || t.ToGUID != s.to.GetGuid() {
+		return false
+	}
+	if s.from == nil {
+		return !t.HasFromGUID
+	}
+	return t.HasFromGUID && t.FromGUID == s.from.GetGuid()
+}
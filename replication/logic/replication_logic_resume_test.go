@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/bytecounter"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestStepResume(t *testing.T) {
+	p, err := StepResumeFromConfig(&config.ReplicationOptionsStepResume{MaxAttempts: 3, TokenTimeout: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, StepResume{MaxAttempts: 3, TokenTimeout: time.Minute}, p)
+	_, err = StepResumeFromConfig(&config.ReplicationOptionsStepResume{MaxAttempts: -1, TokenTimeout: time.Minute})
+	assert.Error(t, err)
+	_, err = StepResumeFromConfig(&config.ReplicationOptionsStepResume{MaxAttempts: 3})
+	assert.Error(t, err)
+
+	snap := pdu.FilesystemVersion_Snapshot
+	from, to := testFilesystemVersion(snap, "a", 1), testFilesystemVersion(snap, "b", 2)
+	incremental := &Step{from: from, to: to}
+	full := &Step{to: to}
+
+	assert.True(t, resumeTokenMatchesStep(&zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 2}, incremental))
+	assert.False(t, resumeTokenMatchesStep(&zfs.ResumeToken{HasToGUID: true, ToGUID: 2}, incremental))
+	assert.False(t, resumeTokenMatchesStep(&zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 3}, incremental))
+	assert.True(t, resumeTokenMatchesStep(&zfs.ResumeToken{HasToGUID: true, ToGUID: 2}, full))
+	assert.False(t, resumeTokenMatchesStep(&zfs.ResumeToken{HasFromGUID: true, FromGUID: 1, HasToGUID: true, ToGUID: 2}, full))
+
+	// bytes of the interrupted stream remain accounted for
+	s := &Step{parent: &Filesystem{Path: "pool/fs"}, from: from, to: to, encrypt: DontCare}
+	s.byteCounter = bytecounter.NewReadCloser(ioutil.NopCloser(strings.NewReader("12345")))
+	_, err = ioutil.ReadAll(s.byteCounter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), s.lastStreamBytes())
+	s.startResume("token")
+	assert.Equal(t, int64(0), s.lastStreamBytes())
+	assert.Equal(t, int64(5), s.bytesReplicated())
+	info := s.ReportInfo()
+	assert.True(t, info.Resumed)
+	assert.Equal(t, int64(5), info.BytesReplicated)
+}
+
+type resumeTestSender struct {
+	Sender   // unused methods
+	sendReqs []*pdu.SendReq
+	// like senders that predate SendReq.Intermediates
+	ignoreIntermediates bool
+}
+
+func (s *resumeTestSender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	s.sendReqs = append(s.sendReqs, r)
+	res := &pdu.SendRes{
+		UsedResumeToken: r.GetResumeToken() != "",
+		Intermediates:   r.GetIntermediates() && !s.ignoreIntermediates,
+	}
+	return res, ioutil.NopCloser(strings.NewReader("stream")), nil
+}
+
+func (s *resumeTestSender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
+	return &pdu.SendCompletedRes{}, nil
+}
+
+type resumeTestReceiver struct {
+	Receiver    // unused methods
+	receiveReqs []*pdu.ReceiveReq
+}
+
+func (r *resumeTestReceiver) Receive(ctx context.Context, req *pdu.ReceiveReq, stream io.ReadCloser) (*pdu.ReceiveRes, error) {
+	r.receiveReqs = append(r.receiveReqs, req)
+	_, err := ioutil.ReadAll(stream)
+	return &pdu.ReceiveRes{}, err
+}
+
+func TestStepResumeAfterRollback(t *testing.T) {
+	snap := pdu.FilesystemVersion_Snapshot
+	common, to := testFilesystemVersion(snap, "a", 1), testFilesystemVersion(snap, "b", 2)
+	sender, receiver := &resumeTestSender{}, &resumeTestReceiver{}
+	s := &Step{
+		sender:     sender,
+		receiver:   receiver,
+		parent:     &Filesystem{Path: "pool/fs"},
+		from:       common,
+		to:         to,
+		encrypt:    DontCare,
+		rollbackTo: common,
+	}
+
+	require.NoError(t, s.doReplication(context.Background()))
+	require.Len(t, receiver.receiveReqs, 1)
+	assert.Equal(t, common, receiver.receiveReqs[0].GetRollbackTo())
+
+	// as if the receive had failed after the rollback
+	s.startResume("token")
+	require.NoError(t, s.doReplication(context.Background()))
+	require.Len(t, sender.sendReqs, 2)
+	assert.Equal(t, "token", sender.sendReqs[1].GetResumeToken())
+	require.Len(t, receiver.receiveReqs, 2)
+	assert.Nil(t, receiver.receiveReqs[1].GetRollbackTo(), "must not set aside the partially received state")
+	assert.False(t, receiver.receiveReqs[1].GetClearResumeToken())
+}
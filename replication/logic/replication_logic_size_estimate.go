@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"sync"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// SizeEstimateCache caches the results of dry-run sends (zfs send -nP) across planning runs of a job.
+//
+// The size of a send from snapshot A to snapshot B never changes, hence entries never expire.
+// Steps that resume a partial receive are not cached because their size depends on the resume token.
+// A SizeEstimateCache must be shared by the PlannerPolicy instances of a single job only because
+// the job's send flags affect the size of the send stream.
+type SizeEstimateCache struct {
+	maxEntries int
+	mtx        sync.Mutex
+	entries    map[sizeEstimateCacheKey]int64
+}
+
+type sizeEstimateCacheKey struct {
+	fs            string
+	fromGuid      uint64 // 0 for full sends
+	toGuid        uint64
+	encrypt       tri
+	intermediates bool // zfs send -I, the size includes the intermediate snapshots
+}
+
+func NewSizeEstimateCache() *SizeEstimateCache {
+	return &SizeEstimateCache{
+		maxEntries: envconst.Int("ZREPL_REPLICATION_SIZE_ESTIMATE_CACHE_MAX_ENTRIES", 1<<14),
+		entries:    make(map[sizeEstimateCacheKey]int64),
+	}
+}
+
+func makeSizeEstimateCacheKey(sr *pdu.SendReq, encrypt tri) (k sizeEstimateCacheKey, ok bool) {
+	if sr.GetResumeToken() != "" || sr.GetTo() == nil {
+		return k, false
+	}
+	return sizeEstimateCacheKey{
+		fs:            sr.GetFilesystem(),
+		fromGuid:      sr.GetFrom().GetGuid(),
+		toGuid:        sr.GetTo().GetGuid(),
+		encrypt:       encrypt,
+		intermediates: sr.GetIntermediates(),
+	}, true
+}
+
+// c may be nil, in which case no estimate is ever found
+func (c *SizeEstimateCache) get(sr *pdu.SendReq, encrypt tri) (size int64, ok bool) {
+	if c == nil {
+		return 0, false
+	}
+	k, ok := makeSizeEstimateCacheKey(sr, encrypt)
+	if !ok {
+		return 0, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	size, ok = c.entries[k]
+	return size, ok
+}
+
+// c may be nil, in which case put is a no-op
+func (c *SizeEstimateCache) put(sr *pdu.SendReq, encrypt tri, size int64) {
+	if c == nil {
+		return
+	}
+	k, ok := makeSizeEstimateCacheKey(sr, encrypt)
+	if !ok {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, exists := c.entries[k]; !exists && len(c.entries) >= c.maxEntries {
+		// the entries of steps that have been replicated are never used again, start over
+		c.entries = make(map[sizeEstimateCacheKey]int64)
+	}
+	c.entries[k] = size
+}
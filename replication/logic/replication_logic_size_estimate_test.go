@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestSizeEstimateCache(t *testing.T) {
+	c := NewSizeEstimateCache()
+	c.maxEntries = 2
+
+	v := func(guid uint64) *pdu.FilesystemVersion { return &pdu.FilesystemVersion{Guid: guid} }
+	incremental := &pdu.SendReq{Filesystem: "pool/foo", From: v(1), To: v(2), DryRun: true}
+	full := &pdu.SendReq{Filesystem: "pool/foo", To: v(2), DryRun: true}
+	resume := &pdu.SendReq{Filesystem: "pool/foo", From: v(1), To: v(2), ResumeToken: "1-abc", DryRun: true}
+
+	_, ok := c.get(incremental, False)
+	assert.False(t, ok)
+
+	c.put(incremental, False, 23)
+	size, ok := c.get(incremental, False)
+	assert.True(t, ok)
+	assert.Equal(t, int64(23), size)
+
+	_, ok = c.get(incremental, True)
+	assert.False(t, ok, "encrypted sends have different size")
+	_, ok = c.get(full, False)
+	assert.False(t, ok, "full send must not hit cache entry of incremental send")
+
+	c.put(resume, False, 42)
+	size, _ = c.get(incremental, False)
+	assert.Equal(t, int64(23), size, "resumed steps must not be cached")
+	_, ok = c.get(resume, False)
+	assert.False(t, ok)
+
+	// exceeding maxEntries starts over
+	c.put(full, False, 100)
+	c.put(&pdu.SendReq{Filesystem: "pool/bar", To: v(3)}, False, 1)
+	_, ok = c.get(incremental, False)
+	assert.False(t, ok)
+
+	// nil cache is a no-op
+	var nilCache *SizeEstimateCache
+	nilCache.put(incremental, False, 1)
+	_, ok = nilCache.get(incremental, False)
+	assert.False(t, ok)
+}
@@ -0,0 +1,263 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// StepStateFile persists the remaining planned steps of each filesystem to a file
+// so that the first replication after a daemon restart can continue where the
+// previous daemon left off, without computing the incremental path or
+// size estimates again.
+//
+// The persisted steps of a filesystem are used at most once per daemon lifetime,
+// and only if they are consistent with the receiver's current state (resume token, most recent snapshot).
+// Later planning (e.g. the retry after a failed restored step) always starts from scratch.
+type StepStateFile struct {
+	path string
+
+	mtx        sync.Mutex
+	state      stepState
+	restorable map[string]bool // filesystems whose state was loaded from disk and not yet used
+}
+
+const stepStateVersion = 1
+
+type stepState struct {
+	Version     int
+	Filesystems map[string]*stepStateFilesystem
+}
+
+type stepStateFilesystem struct {
+	PlannedAt time.Time
+	Steps     []*stepStateStep // remaining steps, the first one is the next one to be executed
+}
+
+type stepStateStep struct {
+	From            *pdu.FilesystemVersion `json:",omitempty"` // nil for full sends
+	To              *pdu.FilesystemVersion
+	Intermediates   bool  `json:",omitempty"` // zfs send -I
+	BytesExpected   int64 // size estimate of the step's stream when it was planned
+	BytesReplicated int64 // bytes of that stream that were transferred before the step was interrupted
+}
+
+// LoadStepStateFile loads the state file at path.
+// A missing file is not an error, it is created on first use.
+func LoadStepStateFile(path string) (*StepStateFile, error) {
+	f := &StepStateFile{
+		path: path,
+		state: stepState{
+			Version:     stepStateVersion,
+			Filesystems: make(map[string]*stepStateFilesystem),
+		},
+		restorable: make(map[string]bool),
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state stepState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("cannot parse step state file %q: %s", path, err)
+	}
+	if state.Version != stepStateVersion {
+		// the file is rewritten on next use
+		return f, nil
+	}
+	if state.Filesystems != nil {
+		f.state = state
+	}
+	for fs := range f.state.Filesystems {
+		f.restorable[fs] = true
+	}
+	return f, nil
+}
+
+// caller must hold f.mtx
+func (f *StepStateFile) write() error {
+	content, err := json.MarshalIndent(&f.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// f may be nil, in which case update is a no-op
+func (f *StepStateFile) update(ctx context.Context, fs string, u func(s *stepStateFilesystem) (remove bool)) {
+	if f == nil {
+		return
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	s, ok := f.state.Filesystems[fs]
+	if !ok {
+		s = &stepStateFilesystem{}
+	}
+	if u(s) {
+		delete(f.state.Filesystems, fs)
+	} else {
+		f.state.Filesystems[fs] = s
+	}
+	if err := f.write(); err != nil {
+		// the state file is an optimization, replication must not fail because of it
+		getLogger(ctx).WithError(err).WithField("filesystem", fs).WithField("path", f.path).
+			Error("cannot write step state file")
+	}
+}
+
+func (f *StepStateFile) planned(ctx context.Context, fs string, steps []*Step) {
+	f.update(ctx, fs, func(s *stepStateFilesystem) bool {
+		s.PlannedAt = time.Now()
+		s.Steps = make([]*stepStateStep, len(steps))
+		for i, step := range steps {
+			s.Steps[i] = &stepStateStep{
+				From:          step.from,
+				To:            step.to,
+				Intermediates: step.intermediates,
+				BytesExpected: step.expectedSize,
+			}
+		}
+		return len(s.Steps) == 0
+	})
+}
+
+func (f *StepStateFile) forget(ctx context.Context, fs string) {
+	f.update(ctx, fs, func(s *stepStateFilesystem) bool { return true })
+}
+
+func (f *StepStateFile) stepDone(ctx context.Context, step *Step) {
+	f.update(ctx, step.parent.Path, func(s *stepStateFilesystem) bool {
+		if len(s.Steps) > 0 && s.Steps[0].To.GetGuid() == step.to.GetGuid() {
+			s.Steps = s.Steps[1:]
+		}
+		return len(s.Steps) == 0
+	})
+}
+
+func (f *StepStateFile) stepInterrupted(ctx context.Context, step *Step, bytesReplicated int64) {
+	f.update(ctx, step.parent.Path, func(s *stepStateFilesystem) bool {
+		if len(s.Steps) > 0 && s.Steps[0].To.GetGuid() == step.to.GetGuid() {
+			s.Steps[0].BytesReplicated = bytesReplicated
+		}
+		return len(s.Steps) == 0
+	})
+}
+
+// take returns the persisted steps of fs if they were loaded from disk and not taken before.
+// f may be nil.
+func (f *StepStateFile) take(fs string) ([]*stepStateStep, bool) {
+	if f == nil {
+		return nil, false
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if !f.restorable[fs] {
+		return nil, false
+	}
+	delete(f.restorable, fs)
+	s, ok := f.state.Filesystems[fs]
+	if !ok || len(s.Steps) == 0 {
+		return nil, false
+	}
+	return s.Steps, true
+}
+
+// restoreSteps returns the steps persisted by a previous daemon if they are consistent with the
+// receiver's state, or nil if fs must be planned from scratch.
+// rfsvs are the receiver's versions of fs, the first step must be incremental from the most recent snapshot among them.
+func (fs *Filesystem) restoreSteps(ctx context.Context, rfsvs []*pdu.FilesystemVersion) []*Step {
+	log := getLogger(ctx).WithField("filesystem", fs.Path)
+
+	persisted, ok := fs.policy.StepStateFile.take(fs.Path)
+	if !ok {
+		return nil
+	}
+	first := persisted[0]
+	receiverHasFS := fs.receiverFS != nil && !fs.receiverFS.GetIsPlaceholder()
+
+	var resumeTokenRaw string
+	if fs.receiverFS != nil && fs.receiverFS.ResumeToken != "" {
+		resumeTokenRaw = fs.receiverFS.ResumeToken
+		resumeToken, err := zfs.ParseResumeToken(ctx, resumeTokenRaw)
+		if err != nil {
+			log.WithError(err).Info("cannot decode resume token, planning from scratch")
+			return nil
+		}
+		if !resumeToken.HasToGUID || resumeToken.ToGUID != first.To.GetGuid() ||
+			resumeToken.HasFromGUID != (first.From != nil) ||
+			(resumeToken.HasFromGUID && resumeToken.FromGUID != first.From.GetGuid()) {
+			log.Info("receiver's resume token does not match persisted step, planning from scratch")
+			return nil
+		}
+	} else if first.From != nil && !receiverHasFS {
+		log.Info("persisted incremental step but receiver filesystem does not exist, planning from scratch")
+		return nil
+	} else if first.From == nil && receiverHasFS {
+		log.Info("persisted full send but receiver filesystem exists, planning from scratch")
+		return nil
+	}
+	if first.From != nil {
+		// e.g., the receiver was rolled back or received from elsewhere in the meantime
+		var latest *pdu.FilesystemVersion
+		for _, v := range rfsvs {
+			if v.Type == pdu.FilesystemVersion_Snapshot && (latest == nil || v.CreateTXG > latest.CreateTXG) {
+				latest = v
+			}
+		}
+		if latest == nil || latest.GetGuid() != first.From.GetGuid() {
+			log.Info("receiver's most recent snapshot does not match persisted step, planning from scratch")
+			return nil
+		}
+	}
+
+	steps := make([]*Step, len(persisted))
+	for i, p := range persisted {
+		steps[i] = &Step{
+			parent:        fs,
+			sender:        fs.sender,
+			receiver:      fs.receiver,
+			from:          p.From,
+			to:            p.To,
+			intermediates: p.Intermediates,
+			encrypt:       fs.policy.EncryptedSend,
+			expectedSize:  p.BytesExpected,
+		}
+	}
+	if resumeTokenRaw != "" {
+		steps[0].resumeToken = resumeTokenRaw
+		if remaining := first.BytesExpected - first.BytesReplicated; remaining > 0 {
+			steps[0].expectedSize = remaining
+		} else {
+			steps[0].expectedSize = 0
+		}
+	}
+	log.WithField("steps", len(steps)).Info("restored planned steps persisted by previous daemon")
+	return steps
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestStepStateFile(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	dir, err := ioutil.TempDir("", "zrepl-step-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "job.json")
+
+	v := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Guid: guid, CreateTXG: guid}
+	}
+
+	// first daemon: plan two steps, complete the first, interrupt the second
+	f, err := LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs := &Filesystem{
+		Path:       "pool/foo",
+		receiverFS: &pdu.Filesystem{Path: "pool/foo"},
+		policy:     PlannerPolicy{EncryptedSend: False, StepStateFile: f},
+	}
+	steps := []*Step{
+		{parent: fs, from: v("a", 1), to: v("b", 2), expectedSize: 100},
+		{parent: fs, from: v("b", 2), to: v("c", 3), expectedSize: 200},
+	}
+	f.planned(ctx, fs.Path, steps)
+	assert.Nil(t, fs.restoreSteps(ctx, []*pdu.FilesystemVersion{v("a", 1)}), "steps planned by this daemon must not be restored")
+	f.stepDone(ctx, steps[0])
+	f.stepInterrupted(ctx, steps[1], 50)
+
+	rfsvs := []*pdu.FilesystemVersion{v("a", 1), v("b", 2)}
+
+	// second daemon: restores the remaining step exactly once
+	f, err = LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs.policy.StepStateFile = f
+	restored := fs.restoreSteps(ctx, rfsvs)
+	require.Len(t, restored, 1)
+	assert.Equal(t, uint64(2), restored[0].from.GetGuid())
+	assert.Equal(t, uint64(3), restored[0].to.GetGuid())
+	assert.Equal(t, int64(200), restored[0].expectedSize)
+	assert.Equal(t, "", restored[0].resumeToken)
+	assert.Nil(t, fs.restoreSteps(ctx, rfsvs))
+
+	// receiver was rolled back to an earlier snapshot in the meantime
+	f, err = LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs.policy.StepStateFile = f
+	assert.Nil(t, fs.restoreSteps(ctx, rfsvs[:1]))
+
+	// receiver has a more recent snapshot that was received from elsewhere
+	f, err = LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs.policy.StepStateFile = f
+	assert.Nil(t, fs.restoreSteps(ctx, append(rfsvs, v("x", 4))))
+
+	// persisted incremental step, but receiver filesystem is gone
+	f, err = LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs.policy.StepStateFile = f
+	fs.receiverFS = nil
+	assert.Nil(t, fs.restoreSteps(ctx, nil))
+
+	// planning errors discard the persisted steps
+	f.forget(ctx, fs.Path)
+	f, err = LoadStepStateFile(path)
+	require.NoError(t, err)
+	fs.policy.StepStateFile = f
+	fs.receiverFS = &pdu.Filesystem{Path: "pool/foo"}
+	assert.Nil(t, fs.restoreSteps(ctx, rfsvs))
+}
@@ -0,0 +1,229 @@
+// Package opwindow implements operating windows for replication:
+// time-of-day windows that pause replication or change its bandwidth limit.
+package opwindow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+)
+
+func getLogger(ctx context.Context) logger.Logger {
+	return logging.GetLogger(ctx, logging.SubsysReplication)
+}
+
+// Window is a daily time-of-day interval [From, To) in local time.
+// If To <= From, the window spans midnight and ends on the following day.
+type Window struct {
+	Days     [7]bool       // indexed by time.Weekday, the day on which the window begins
+	From, To time.Duration // offsets since midnight
+	Pause    bool
+	Rate     int64 // bytes per second, 0 means no limit, ignored if Pause is true
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
+
+func (w Window) Contains(t time.Time) bool {
+	off := sinceMidnight(t)
+	if w.From < w.To {
+		return w.Days[t.Weekday()] && w.From <= off && off < w.To
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.Days[t.Weekday()] && off >= w.From) || (w.Days[yesterday] && off < w.To)
+}
+
+type State struct {
+	Pause bool
+	Rate  int64 // bytes per second, 0 means no limit
+}
+
+func (s State) String() string {
+	if s.Pause {
+		return "paused"
+	}
+	if s.Rate == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d B/s", s.Rate)
+}
+
+// Schedule determines the State of replication at a given time.
+// The first window that contains the time wins.
+// Outside of all windows, replication runs with the default rate.
+type Schedule struct {
+	windows     []Window
+	defaultRate int64
+}
+
+func NewSchedule(windows []Window, defaultRate int64) *Schedule {
+	return &Schedule{windows, defaultRate}
+}
+
+func (s *Schedule) StateAt(t time.Time) State {
+	for _, w := range s.windows {
+		if w.Contains(t) {
+			return State{Pause: w.Pause, Rate: w.Rate}
+		}
+	}
+	return State{Rate: s.defaultRate}
+}
+
+// windows have minute granularity, re-evaluate at the beginning of every minute
+func untilNextEvaluation(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+// WaitOpen blocks until the schedule does not pause replication or ctx is done.
+// s may be nil, in which case WaitOpen returns immediately.
+//
+// Implements driver.StepGate.
+func (s *Schedule) WaitOpen(ctx context.Context) error {
+	if s == nil {
+		return ctx.Err()
+	}
+	logged := false
+	for {
+		now := time.Now()
+		if !s.StateAt(now).Pause {
+			if logged {
+				getLogger(ctx).Info("operating window opened, resume replication")
+			}
+			return nil
+		}
+		if !logged {
+			getLogger(ctx).Info("replication paused by operating window")
+			logged = true
+		}
+		t := time.NewTimer(untilNextEvaluation(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Run applies the rate of the current window to l whenever the schedule's state changes,
+// until ctx is done. Changes made to l in the meantime (e.g. through the control socket)
+// persist until the next state change.
+func (s *Schedule) Run(ctx context.Context, l *bandwidthlimit.Limiter) {
+	log := getLogger(ctx)
+	var prev *State
+	for {
+		now := time.Now()
+		cur := s.StateAt(now)
+		if prev == nil || *prev != cur {
+			log.WithField("state", cur.String()).Info("operating window state changed")
+			if !cur.Pause {
+				l.SetRate(cur.Rate)
+			}
+			prev = &cur
+		}
+		t := time.NewTimer(untilNextEvaluation(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+var timeOfDayRegex = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	m := timeOfDayRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid time of day %q, expecting HH:MM", s)
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	if min > 59 || h > 24 || (h == 24 && min != 0) {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func windowFromConfig(in *config.ReplicationWindow) (w Window, err error) {
+	if w.From, err = parseTimeOfDay(in.From); err != nil {
+		return w, errors.Wrap(err, "field `from`")
+	}
+	if w.To, err = parseTimeOfDay(in.To); err != nil {
+		return w, errors.Wrap(err, "field `to`")
+	}
+	if w.From == w.To || w.From == 24*time.Hour {
+		return w, fmt.Errorf("window %s-%s is empty", in.From, in.To)
+	}
+	if w.To == 24*time.Hour {
+		w.To = 0 // spans until midnight
+	}
+
+	if len(in.Days) == 0 {
+		for d := range w.Days {
+			w.Days[d] = true
+		}
+	}
+	for _, d := range in.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return w, fmt.Errorf("field `days`: invalid day %q, expecting one of mon, tue, wed, thu, fri, sat, sun", d)
+		}
+		w.Days[wd] = true
+	}
+
+	w.Pause = in.Pause
+	if in.Pause && in.BandwidthLimit != "" {
+		return w, fmt.Errorf("fields `pause` and `bandwidth_limit` are mutually exclusive")
+	}
+	if !in.Pause {
+		if in.BandwidthLimit == "" {
+			return w, fmt.Errorf("either `pause` or `bandwidth_limit` must be specified")
+		}
+		if w.Rate, err = bandwidthlimit.ParseRate(in.BandwidthLimit); err != nil {
+			return w, errors.Wrap(err, "field `bandwidth_limit`")
+		}
+	}
+	return w, nil
+}
+
+// ScheduleFromConfig returns nil if in does not specify any windows.
+func ScheduleFromConfig(in *config.Replication) (*Schedule, error) {
+	if len(in.Windows) == 0 {
+		return nil, nil
+	}
+	defaultRate, err := bandwidthlimit.ParseRate(in.BandwidthLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "field `bandwidth_limit`")
+	}
+	windows := make([]Window, len(in.Windows))
+	for i, w := range in.Windows {
+		if windows[i], err = windowFromConfig(w); err != nil {
+			return nil, errors.Wrapf(err, "window #%d", i)
+		}
+	}
+	return NewSchedule(windows, defaultRate), nil
+}
@@ -0,0 +1,76 @@
+package opwindow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func at(weekday time.Weekday, hour, min int) time.Time {
+	// 2020-06-07 is a Sunday
+	return time.Date(2020, 6, 7+int(weekday), hour, min, 0, 0, time.Local)
+}
+
+func TestScheduleStateAt(t *testing.T) {
+	s, err := ScheduleFromConfig(&config.Replication{
+		BandwidthLimit: "10MiB/s",
+		Windows: []*config.ReplicationWindow{
+			{Days: []string{"sat"}, From: "01:00", To: "03:00", Pause: true},
+			{From: "22:00", To: "06:00", BandwidthLimit: "unlimited"},
+			{Days: []string{"mon", "Tue"}, From: "12:00", To: "24:00", BandwidthLimit: "1MiB/s"},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	tcs := []struct {
+		t      time.Time
+		expect State
+	}{
+		{at(time.Wednesday, 12, 0), State{Rate: 10 << 20}},
+		{at(time.Wednesday, 22, 0), State{Rate: 0}},
+		{at(time.Thursday, 5, 59), State{Rate: 0}},
+		{at(time.Thursday, 6, 0), State{Rate: 10 << 20}},
+		// first matching window wins
+		{at(time.Saturday, 2, 0), State{Pause: true}},
+		{at(time.Saturday, 3, 0), State{Rate: 0}},
+		{at(time.Sunday, 2, 0), State{Rate: 0}},
+		// window until midnight
+		{at(time.Monday, 11, 59), State{Rate: 10 << 20}},
+		{at(time.Monday, 12, 0), State{Rate: 1 << 20}},
+		{at(time.Tuesday, 21, 59), State{Rate: 1 << 20}},
+		{at(time.Wednesday, 11, 0), State{Rate: 10 << 20}},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expect, s.StateAt(tc.t), "%s", tc.t)
+	}
+}
+
+func TestScheduleFromConfig(t *testing.T) {
+	s, err := ScheduleFromConfig(&config.Replication{BandwidthLimit: "unlimited"})
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	invalid := []*config.ReplicationWindow{
+		{From: "22:00", To: "06:00"},
+		{From: "22:00", To: "06:00", Pause: true, BandwidthLimit: "1MiB/s"},
+		{From: "22:00", To: "22:00", Pause: true},
+		{From: "24:00", To: "06:00", Pause: true},
+		{From: "25:00", To: "06:00", Pause: true},
+		{From: "22:60", To: "06:00", Pause: true},
+		{From: "22", To: "06:00", Pause: true},
+		{From: "22:00", To: "06:00", Pause: true, Days: []string{"monday"}},
+		{From: "22:00", To: "06:00", BandwidthLimit: "fast"},
+	}
+	for _, w := range invalid {
+		_, err := ScheduleFromConfig(&config.Replication{
+			BandwidthLimit: "unlimited",
+			Windows:        []*config.ReplicationWindow{w},
+		})
+		assert.Error(t, err, "%#v", w)
+	}
+}
@@ -6,8 +6,13 @@ import (
 	"context"
 
 	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/report"
 )
 
-func Do(ctx context.Context, planner driver.Planner) (driver.ReportFunc, driver.WaitFunc) {
-	return driver.Do(ctx, planner)
+func Do(ctx context.Context, driverConfig driver.Config, planner driver.Planner) (driver.ReportFunc, driver.WaitFunc) {
+	return driver.Do(ctx, driverConfig, planner)
+}
+
+func DryRun(ctx context.Context, planner driver.Planner) *report.AttemptReport {
+	return driver.DryRun(ctx, planner)
 }
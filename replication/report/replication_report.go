@@ -40,6 +40,15 @@ type AttemptReport struct {
 	StartAt, FinishAt time.Time
 	PlanError         *TimedError
 	Filesystems       []*FilesystemReport
+	// the driver's OnError policy, empty for dry runs
+	OnError string `json:",omitempty"`
+	// sum of the throughput of all executing steps, see StepInfo.BytesPerSecond
+	BytesPerSecond int64 `json:",omitempty"`
+	// estimated time until all planned steps are done, based on BytesPerSecond and the steps' size estimates.
+	// 0 if there is no throughput or no remaining bytes.
+	ETA time.Duration `json:",omitempty"`
+	// the filesystems to which the run was restricted (see driver.FilesystemSelection), empty if not restricted
+	SelectedFilesystems []string `json:",omitempty"`
 }
 
 type AttemptState string
@@ -60,6 +69,7 @@ const (
 	FilesystemStepping        FilesystemState = "stepping"
 	FilesystemSteppingErrored FilesystemState = "step-error"
 	FilesystemDone            FilesystemState = "done"
+	FilesystemSkipped         FilesystemState = "skipped"
 )
 
 type FilesystemReport struct {
@@ -71,6 +81,8 @@ type FilesystemReport struct {
 	PlanError *TimedError
 	// Valid in State = FilesystemSteppingErrored
 	StepError *TimedError
+	// Valid in State = FilesystemSkipped
+	SkipError *TimedError `json:",omitempty"`
 
 	// Valid in State = FilesystemStepping
 	CurrentStep int
@@ -79,6 +91,15 @@ type FilesystemReport struct {
 
 type FilesystemInfo struct {
 	Name string
+	// the replication progress of the receiving side's downstream jobs (cascading replication), if any
+	Downstream []*DownstreamInfo `json:",omitempty"`
+}
+
+type DownstreamInfo struct {
+	Job string
+	// relative name of the last snapshot that the downstream job replicated, empty if none
+	Cursor         string
+	CursorCreation time.Time
 }
 
 type StepReport struct {
@@ -99,6 +120,10 @@ type StepInfo struct {
 	Encrypted       EncryptedEnum
 	BytesExpected   int64
 	BytesReplicated int64
+	// throughput over the last few seconds, 0 if the step is not executing
+	BytesPerSecond int64 `json:",omitempty"`
+	// the step is executed in the queue for large steps
+	Deferred bool `json:",omitempty"`
 }
 
 func (a *AttemptReport) BytesSum() (expected, replicated int64, containsInvalidSizeEstimates bool) {
@@ -111,6 +136,14 @@ func (a *AttemptReport) BytesSum() (expected, replicated int64, containsInvalidS
 	return expected, replicated, containsInvalidSizeEstimates
 }
 
+// BytesPerSecond returns the throughput of the filesystem's executing step, 0 if no step is executing.
+func (f *FilesystemReport) BytesPerSecond() (bytesPerSecond int64) {
+	for _, step := range f.Steps {
+		bytesPerSecond += step.Info.BytesPerSecond
+	}
+	return bytesPerSecond
+}
+
 func (f *FilesystemReport) BytesSum() (expected, replicated int64, containsInvalidSizeEstimates bool) {
 	for _, step := range f.Steps {
 		expected += step.Info.BytesExpected
@@ -136,6 +169,8 @@ func (f *FilesystemReport) Error() *TimedError {
 		return f.PlanError
 	case FilesystemSteppingErrored:
 		return f.StepError
+	case FilesystemSkipped:
+		return f.SkipError
 	}
 	return nil
 }
@@ -149,6 +184,8 @@ func (f *FilesystemReport) NextStep() *StepReport {
 		return nil
 	case FilesystemSteppingErrored:
 		return nil
+	case FilesystemSkipped:
+		return nil
 	case FilesystemPlanning:
 		return nil
 	case FilesystemStepping:
@@ -166,7 +203,7 @@ func (f *StepReport) IsIncremental() bool {
 // Returns, for the latest replication attempt,
 // 0  if there have not been any replication attempts,
 // -1 if the replication failed while enumerating file systems
-// N  if N filesystems could not not be replicated successfully
+// N  if N filesystems could not not be replicated successfully (including skipped filesystems)
 func (r *Report) GetFailedFilesystemsCountInLatestAttempt() int {
 
 	if len(r.Attempts) == 0 {
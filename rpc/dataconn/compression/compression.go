@@ -0,0 +1,383 @@
+// Package compression implements the on-the-wire stream compression of package dataconn.
+//
+// A compressed stream is a sequence of chunks, each compressed independently:
+//
+//	uint32 uncompressed length | uint32 compressed length | compressed bytes
+//
+// (lengths in big endian).
+// Compressing chunks independently keeps the time spent in the compression
+// algorithm separate from the time spent waiting for the network or zfs send / recv,
+// which allows us to meter the CPU usage of compression.
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+type Algorithm string
+
+const (
+	None Algorithm = ""
+	Zstd Algorithm = "zstd"
+	LZ4  Algorithm = "lz4"
+)
+
+// Supported returns the algorithms that can be used on the wire, in order of preference.
+func Supported() []string {
+	return []string{string(Zstd), string(LZ4)}
+}
+
+type levelRange struct{ min, max int }
+
+var levels = map[Algorithm]levelRange{
+	// zstd levels as in the zstd CLI, mapped to the levels of the pure-Go implementation
+	Zstd: {1, 22},
+	// 0 is the fast compressor, higher levels use the high compression compressor
+	// with increasing search depth
+	LZ4: {0, 9},
+}
+
+// Config is the compression that the active side of a job requests for its streams.
+// The zero value disables compression.
+type Config struct {
+	Algorithm Algorithm
+	// 0 selects the algorithm's default level
+	Level int
+}
+
+func (c Config) Enabled() bool { return c.Algorithm != None }
+
+func (c Config) Validate() error {
+	if c.Algorithm == None {
+		return nil
+	}
+	r, ok := levels[c.Algorithm]
+	if !ok {
+		return errors.Errorf("unsupported compression algorithm %q", c.Algorithm)
+	}
+	if c.Level != 0 && (c.Level < r.min || c.Level > r.max) {
+		return errors.Errorf("%s compression level must be in [%d, %d] or 0 for the default, got %d", c.Algorithm, r.min, r.max, c.Level)
+	}
+	return nil
+}
+
+func FromConfig(in *config.ReplicationOptionsCompression) (Config, error) {
+	var c Config
+	switch in.Algorithm {
+	case "none":
+		return c, nil
+	case "zstd":
+		c.Algorithm = Zstd
+	case "lz4":
+		c.Algorithm = LZ4
+	default:
+		return c, errors.Errorf("invalid algorithm %q, must be one of none, zstd, lz4", in.Algorithm)
+	}
+	c.Level = in.Level
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// chunkSize is the maximum number of uncompressed bytes per chunk.
+// Changing it breaks interop with older versions if it is increased.
+const chunkSize = 1 << 20
+
+const chunkHeaderLen = 8
+
+// maxCompressedChunkLen bounds the compressed size of a chunk for all algorithms,
+// including incompressible data.
+const maxCompressedChunkLen = chunkSize + chunkSize/128
+
+type codec interface {
+	// compress appends the compressed form of src to dst
+	compress(dst, src []byte) ([]byte, error)
+	// decompress decompresses src into dst, which has the uncompressed length of src
+	decompress(dst, src []byte) error
+	close()
+}
+
+type zstdCodec struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func newZstdCodec(level int, compress bool) (*zstdCodec, error) {
+	var c zstdCodec
+	var err error
+	if compress {
+		if level == 0 {
+			level = 3 // zstd CLI default
+		}
+		c.enc, err = zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+			zstd.WithEncoderConcurrency(1),
+		)
+	} else {
+		c.dec, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(2*chunkSize))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *zstdCodec) compress(dst, src []byte) ([]byte, error) {
+	return c.enc.EncodeAll(src, dst), nil
+}
+
+func (c *zstdCodec) decompress(dst, src []byte) error {
+	out, err := c.dec.DecodeAll(src, dst[:0])
+	if err != nil {
+		return err
+	}
+	if len(out) != len(dst) {
+		return fmt.Errorf("decompressed chunk has unexpected length %d, expected %d", len(out), len(dst))
+	}
+	return nil
+}
+
+func (c *zstdCodec) close() {
+	if c.enc != nil {
+		c.enc.Close()
+	}
+	if c.dec != nil {
+		c.dec.Close()
+	}
+}
+
+type lz4Codec struct {
+	level     int
+	hashTable []int
+}
+
+func (c *lz4Codec) compress(dst, src []byte) ([]byte, error) {
+	start := len(dst)
+	bound := lz4.CompressBlockBound(len(src))
+	if cap(dst)-start < bound {
+		grown := make([]byte, start, start+bound)
+		copy(grown, dst)
+		dst = grown
+	}
+	out := dst[start : start+bound]
+	var n int
+	var err error
+	if c.level == 0 {
+		if c.hashTable == nil {
+			c.hashTable = make([]int, 1<<16)
+		}
+		n, err = lz4.CompressBlock(src, out, c.hashTable)
+	} else {
+		n, err = lz4.CompressBlockHC(src, out, 1<<uint(c.level+3))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dst[:start+n], nil
+}
+
+func (c *lz4Codec) decompress(dst, src []byte) error {
+	n, err := lz4.UncompressBlock(src, dst)
+	if err != nil {
+		return err
+	}
+	if n != len(dst) {
+		return fmt.Errorf("decompressed chunk has unexpected length %d, expected %d", n, len(dst))
+	}
+	return nil
+}
+
+func (c *lz4Codec) close() {}
+
+func newCodec(a Algorithm, level int, compress bool) (codec, error) {
+	switch a {
+	case Zstd:
+		return newZstdCodec(level, compress)
+	case LZ4:
+		return &lz4Codec{level: level}, nil
+	default:
+		return nil, errors.Errorf("unsupported compression algorithm %q", a)
+	}
+}
+
+type compressor struct {
+	src       io.ReadCloser
+	algorithm Algorithm
+	codec     codec
+	in        []byte
+	out       []byte // the current chunk, including header
+	outPos    int
+	err       error // sticky
+}
+
+// NewCompressor returns a stream that yields the compressed form of src.
+// Closing the returned stream closes src.
+func NewCompressor(src io.ReadCloser, c Config) (io.ReadCloser, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.Enabled() {
+		return nil, errors.New("compression is not enabled")
+	}
+	cd, err := newCodec(c.Algorithm, c.Level, true)
+	if err != nil {
+		return nil, err
+	}
+	return &compressor{
+		src:       src,
+		algorithm: c.Algorithm,
+		codec:     cd,
+		in:        make([]byte, chunkSize),
+	}, nil
+}
+
+func (c *compressor) Read(p []byte) (int, error) {
+	if c.outPos == len(c.out) && c.err == nil {
+		c.err = c.nextChunk()
+	}
+	if c.outPos < len(c.out) {
+		n := copy(p, c.out[c.outPos:])
+		c.outPos += n
+		return n, nil
+	}
+	return 0, c.err
+}
+
+func (c *compressor) nextChunk() error {
+	n, err := io.ReadFull(c.src, c.in)
+	if err == io.ErrUnexpectedEOF {
+		err = nil // short last chunk, next read returns io.EOF
+	}
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	begin := time.Now()
+	var hdr [chunkHeaderLen]byte
+	out, cerr := c.codec.compress(append(c.out[:0], hdr[:]...), c.in[:n])
+	prom.Seconds.WithLabelValues(string(c.algorithm), "compress").Add(time.Since(begin).Seconds())
+	if cerr != nil {
+		return errors.Wrap(cerr, "cannot compress stream")
+	}
+	binary.BigEndian.PutUint32(out[0:4], uint32(n))
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(out)-chunkHeaderLen))
+	prom.UncompressedBytes.WithLabelValues(string(c.algorithm), "compress").Add(float64(n))
+	prom.CompressedBytes.WithLabelValues(string(c.algorithm), "compress").Add(float64(len(out)))
+
+	c.out = out
+	c.outPos = 0
+	return nil
+}
+
+func (c *compressor) Close() error {
+	c.codec.close()
+	return c.src.Close()
+}
+
+type decompressor struct {
+	src       io.ReadCloser
+	algorithm Algorithm
+	codec     codec
+	hdr       [chunkHeaderLen]byte
+	in        []byte
+	out       []byte // the current uncompressed chunk
+	outPos    int
+	err       error // sticky
+}
+
+// NewDecompressor returns a stream that yields the decompressed form of src,
+// which must have been produced by NewCompressor with algorithm a.
+// Closing the returned stream closes src.
+func NewDecompressor(src io.ReadCloser, a Algorithm) (io.ReadCloser, error) {
+	cd, err := newCodec(a, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressor{
+		src:       src,
+		algorithm: a,
+		codec:     cd,
+	}, nil
+}
+
+func (d *decompressor) Read(p []byte) (int, error) {
+	if d.outPos == len(d.out) && d.err == nil {
+		d.err = d.nextChunk()
+	}
+	if d.outPos < len(d.out) {
+		n := copy(p, d.out[d.outPos:])
+		d.outPos += n
+		return n, nil
+	}
+	return 0, d.err
+}
+
+func (d *decompressor) nextChunk() error {
+	n, err := io.ReadFull(d.src, d.hdr[:])
+	if err != nil {
+		if err == io.EOF && n == 0 {
+			return io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return errors.New("compressed stream: truncated chunk header")
+		}
+		return err
+	}
+	uncompressedLen := binary.BigEndian.Uint32(d.hdr[0:4])
+	compressedLen := binary.BigEndian.Uint32(d.hdr[4:8])
+	if uncompressedLen == 0 || uncompressedLen > chunkSize {
+		return errors.Errorf("compressed stream: invalid chunk length %d", uncompressedLen)
+	}
+	if compressedLen > maxCompressedChunkLen {
+		return errors.Errorf("compressed stream: invalid compressed chunk length %d", compressedLen)
+	}
+
+	if cap(d.in) < int(compressedLen) {
+		d.in = make([]byte, compressedLen)
+	}
+	d.in = d.in[:compressedLen]
+	if _, err := io.ReadFull(d.src, d.in); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("compressed stream: truncated chunk")
+		}
+		return err
+	}
+	if cap(d.out) < int(uncompressedLen) {
+		d.out = make([]byte, chunkSize)
+	}
+	d.out = d.out[:uncompressedLen]
+
+	begin := time.Now()
+	derr := d.codec.decompress(d.out, d.in)
+	prom.Seconds.WithLabelValues(string(d.algorithm), "decompress").Add(time.Since(begin).Seconds())
+	if derr != nil {
+		d.out = d.out[:0]
+		return errors.Wrap(derr, "cannot decompress stream")
+	}
+	prom.UncompressedBytes.WithLabelValues(string(d.algorithm), "decompress").Add(float64(uncompressedLen))
+	prom.CompressedBytes.WithLabelValues(string(d.algorithm), "decompress").Add(float64(chunkHeaderLen + compressedLen))
+
+	d.outPos = 0
+	return nil
+}
+
+func (d *decompressor) Close() error {
+	d.codec.close()
+	return d.src.Close()
+}
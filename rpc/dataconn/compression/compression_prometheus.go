@@ -0,0 +1,36 @@
+package compression
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var prom struct {
+	Seconds           *prometheus.CounterVec
+	UncompressedBytes *prometheus.CounterVec
+	CompressedBytes   *prometheus.CounterVec
+}
+
+func init() {
+	prom.Seconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "dataconn",
+		Name:      "compression_seconds",
+		Help:      "Seconds spent compressing or decompressing streams, excluding time spent waiting for IO (approximates CPU usage)",
+	}, []string{"algorithm", "operation"})
+	prom.UncompressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "dataconn",
+		Name:      "compression_uncompressed_bytes",
+		Help:      "Number of uncompressed stream bytes that were compressed or decompressed",
+	}, []string{"algorithm", "operation"})
+	prom.CompressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "dataconn",
+		Name:      "compression_compressed_bytes",
+		Help:      "Number of compressed stream bytes that were produced or consumed on the wire",
+	}, []string{"algorithm", "operation"})
+}
+
+func RegisterMetrics(r prometheus.Registerer) {
+	r.MustRegister(prom.Seconds)
+	r.MustRegister(prom.UncompressedBytes)
+	r.MustRegister(prom.CompressedBytes)
+}
@@ -0,0 +1,101 @@
+package compression
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func testData(size int, compressible bool) []byte {
+	buf := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(buf)
+	if compressible {
+		// repetitions of a random block
+		for i := 512; i < size; i++ {
+			buf[i] = buf[i%512]
+		}
+	}
+	return buf
+}
+
+func roundtrip(t *testing.T, c Config, data []byte) (compressedLen int) {
+	comp, err := NewCompressor(ioutil.NopCloser(bytes.NewReader(data)), c)
+	require.NoError(t, err)
+	compressed, err := ioutil.ReadAll(comp)
+	require.NoError(t, err)
+	require.NoError(t, comp.Close())
+
+	dec, err := NewDecompressor(ioutil.NopCloser(bytes.NewReader(compressed)), c.Algorithm)
+	require.NoError(t, err)
+	out, err := ioutil.ReadAll(dec)
+	require.NoError(t, err)
+	require.NoError(t, dec.Close())
+	require.True(t, bytes.Equal(data, out), "roundtrip must not change data")
+	return len(compressed)
+}
+
+func TestRoundtrip(t *testing.T) {
+	for _, c := range []Config{
+		{Zstd, 0}, {Zstd, 1}, {Zstd, 19},
+		{LZ4, 0}, {LZ4, 9},
+	} {
+		for _, size := range []int{0, 1, 4711, chunkSize, 3*chunkSize + 23} {
+			roundtrip(t, c, testData(size, false))
+			n := roundtrip(t, c, testData(size, true))
+			if size > 4096 {
+				assert.True(t, n < size/2, "%v: compressible data of size %d compressed to %d", c, size, n)
+			}
+		}
+	}
+}
+
+func TestDecompressorRejectsCorruptStreams(t *testing.T) {
+	data := testData(2*chunkSize, true)
+	comp, err := NewCompressor(ioutil.NopCloser(bytes.NewReader(data)), Config{Algorithm: LZ4})
+	require.NoError(t, err)
+	compressed, err := ioutil.ReadAll(comp)
+	require.NoError(t, err)
+
+	decompress := func(a Algorithm, b []byte) error {
+		dec, err := NewDecompressor(ioutil.NopCloser(bytes.NewReader(b)), a)
+		require.NoError(t, err)
+		defer dec.Close()
+		_, err = ioutil.ReadAll(dec)
+		return err
+	}
+
+	assert.Error(t, decompress(LZ4, compressed[:len(compressed)-1]), "truncated chunk")
+	assert.Error(t, decompress(LZ4, compressed[:3]), "truncated header")
+	assert.Error(t, decompress(Zstd, compressed), "wrong algorithm")
+	oversized := append([]byte{0xff, 0xff, 0xff, 0xff}, compressed[4:]...)
+	assert.Error(t, decompress(LZ4, oversized))
+
+	_, err = NewDecompressor(ioutil.NopCloser(bytes.NewReader(nil)), "gzip")
+	assert.Error(t, err)
+}
+
+func TestFromConfig(t *testing.T) {
+	c, err := FromConfig(&config.ReplicationOptionsCompression{Algorithm: "none"})
+	require.NoError(t, err)
+	assert.False(t, c.Enabled())
+
+	c, err = FromConfig(&config.ReplicationOptionsCompression{Algorithm: "zstd", Level: 9})
+	require.NoError(t, err)
+	assert.Equal(t, Config{Zstd, 9}, c)
+
+	for _, in := range []config.ReplicationOptionsCompression{
+		{Algorithm: "gzip"},
+		{Algorithm: "zstd", Level: 23},
+		{Algorithm: "lz4", Level: -1},
+		{Algorithm: "lz4", Level: 10},
+	} {
+		_, err := FromConfig(&in)
+		assert.Error(t, err, "%v", in)
+	}
+}
@@ -5,24 +5,37 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 
 	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/transport"
 )
 
 type Client struct {
-	log Logger
-	cn  transport.Connecter
+	log         Logger
+	cn          transport.Connecter
+	compression compression.Config
+	heartbeat   Heartbeat
+
+	// the stream compressions supported by the server, nil until the first successful ReqPing
+	serverCompressionsMtx sync.Mutex
+	serverCompressions    []string
 }
 
-func NewClient(connecter transport.Connecter, log Logger) *Client {
+// compression is requested for streams sent by the server (ReqSend) and
+// applied to streams sent to the server (ReqRecv) if the server supports it.
+func NewClient(connecter transport.Connecter, compression compression.Config, heartbeat Heartbeat, log Logger) *Client {
 	return &Client{
-		log: log,
-		cn:  connecter,
+		log:         log,
+		cn:          connecter,
+		compression: compression,
+		heartbeat:   heartbeat,
 	}
 }
 
@@ -99,7 +112,7 @@ func (c *Client) getWire(ctx context.Context) (*stream.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	conn := stream.Wrap(nc, HeartbeatInterval, HeartbeatPeerTimeout)
+	conn := stream.Wrap(nc, c.heartbeat.Interval, c.heartbeat.PeerTimeout)
 	return conn, nil
 }
 
@@ -121,6 +134,13 @@ func (c *Client) ReqSend(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, i
 		}
 	}()
 
+	if c.compression.Enabled() {
+		withCompression := *req
+		withCompression.StreamCompression = string(c.compression.Algorithm)
+		withCompression.StreamCompressionLevel = int32(c.compression.Level)
+		req = &withCompression
+	}
+
 	if err := c.send(ctx, conn, EndpointSend, req, nil); err != nil {
 		return nil, nil, err
 	}
@@ -137,13 +157,66 @@ func (c *Client) ReqSend(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, i
 		if err != nil {
 			return nil, nil, err
 		}
+		if res.StreamCompression != "" {
+			decompressed, err := compression.NewDecompressor(stream, compression.Algorithm(res.StreamCompression))
+			if err != nil {
+				stream.Close()
+				return nil, nil, &ProtocolError{err}
+			}
+			stream = decompressed
+		}
 	}
 
 	return &res, stream, nil
 }
 
+// serverSupportsCompression pings the server to learn its supported stream compressions
+// unless a previous ping did so.
+func (c *Client) serverSupportsCompression(ctx context.Context, a compression.Algorithm) (bool, error) {
+	c.serverCompressionsMtx.Lock()
+	known := c.serverCompressions
+	c.serverCompressionsMtx.Unlock()
+	if known == nil {
+		if _, err := c.ReqPing(ctx, &pdu.PingReq{Message: "stream compression probe"}); err != nil {
+			return false, err
+		}
+		c.serverCompressionsMtx.Lock()
+		known = c.serverCompressions
+		c.serverCompressionsMtx.Unlock()
+	}
+	for _, s := range known {
+		if s == string(a) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c *Client) ReqRecv(ctx context.Context, req *pdu.ReceiveReq, stream io.ReadCloser) (*pdu.ReceiveRes, error) {
 	defer c.log.Debug("ReqRecv returns")
+
+	if c.compression.Enabled() {
+		supported, err := c.serverSupportsCompression(ctx, c.compression.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if supported {
+			// the caller remains responsible for closing stream
+			compressed, err := compression.NewCompressor(ioutil.NopCloser(stream), c.compression)
+			if err != nil {
+				return nil, err
+			}
+			defer compressed.Close()
+			withCompression := *req
+			withCompression.StreamCompression = string(c.compression.Algorithm)
+			req = &withCompression
+			stream = compressed
+		} else {
+			c.log.WithField("algorithm", c.compression.Algorithm).
+				Warn("server does not support the configured stream compression, sending uncompressed stream")
+		}
+	}
+
 	conn, err := c.getWire(ctx)
 	if err != nil {
 		return nil, err
@@ -233,5 +306,9 @@ func (c *Client) ReqPing(ctx context.Context, req *pdu.PingReq) (*pdu.PingRes, e
 		return nil, err
 	}
 
+	c.serverCompressionsMtx.Lock()
+	c.serverCompressions = append([]string{}, res.StreamCompressions...) // non-nil: servers without compression support send none
+	c.serverCompressionsMtx.Unlock()
+
 	return &res, nil
 }
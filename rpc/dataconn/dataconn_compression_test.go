@@ -0,0 +1,117 @@
+package dataconn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type tcpTestListener struct{ *net.TCPListener }
+
+func (l tcpTestListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	conn, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	return transport.NewAuthConn(conn, "client"), nil
+}
+
+type tcpTestConnecter struct{ addr string }
+
+func (c tcpTestConnecter) Connect(ctx context.Context) (transport.Wire, error) {
+	conn, err := net.Dial("tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+type testHandler struct {
+	sendData []byte
+	received chan []byte
+}
+
+func (h *testHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, io.ReadCloser, error) {
+	return &pdu.SendRes{}, ioutil.NopCloser(bytes.NewReader(h.sendData)), nil
+}
+
+func (h *testHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive io.ReadCloser) (*pdu.ReceiveRes, error) {
+	defer receive.Close()
+	data, err := ioutil.ReadAll(receive)
+	if err != nil {
+		return nil, err
+	}
+	h.received <- data
+	return &pdu.ReceiveRes{}, nil
+}
+
+func (h *testHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	return &pdu.PingRes{Echo: r.GetMessage()}, nil
+}
+
+func testServer(t *testing.T, h Handler) (addr string, stop func()) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewServer(nil, nil, logger.NewNullLogger(), h).Serve(ctx, tcpTestListener{l})
+	}()
+	return l.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestStreamCompression(t *testing.T) {
+	data := bytes.Repeat([]byte("zrepl stream compression "), 100000)
+
+	for _, c := range []compression.Config{{}, {Algorithm: compression.Zstd}, {Algorithm: compression.LZ4, Level: 3}} {
+		t.Run(string(c.Algorithm), func(t *testing.T) {
+			h := &testHandler{sendData: data, received: make(chan []byte, 1)}
+			addr, stop := testServer(t, h)
+			defer stop()
+			client := NewClient(tcpTestConnecter{addr}, c, DefaultHeartbeat, logger.NewNullLogger())
+			ctx := context.Background()
+
+			res, stream, err := client.ReqSend(ctx, &pdu.SendReq{})
+			require.NoError(t, err)
+			assert.Equal(t, string(c.Algorithm), res.GetStreamCompression())
+			received, err := ioutil.ReadAll(stream)
+			require.NoError(t, err)
+			require.NoError(t, stream.Close())
+			assert.True(t, bytes.Equal(data, received))
+
+			_, err = client.ReqRecv(ctx, &pdu.ReceiveReq{}, ioutil.NopCloser(bytes.NewReader(data)))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, <-h.received))
+		})
+	}
+}
+
+func TestStreamCompressionUnsupportedByServer(t *testing.T) {
+	data := bytes.Repeat([]byte("zrepl"), 1000)
+	h := &testHandler{received: make(chan []byte, 1)}
+	addr, stop := testServer(t, h)
+	defer stop()
+
+	// pretend the server does not know about compression
+	client := NewClient(tcpTestConnecter{addr}, compression.Config{Algorithm: compression.Zstd}, DefaultHeartbeat, logger.NewNullLogger())
+	client.serverCompressions = []string{}
+
+	_, err := client.ReqRecv(context.Background(), &pdu.ReceiveReq{}, ioutil.NopCloser(bytes.NewReader(data)))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, <-h.received))
+}
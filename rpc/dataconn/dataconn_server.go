@@ -11,6 +11,7 @@ import (
 
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
 	"github.com/zrepl/zrepl/transport"
 )
@@ -171,7 +172,12 @@ func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *strea
 			s.log.WithError(err).Error("cannot unmarshal send request")
 			return
 		}
-		res, sendStream, handlerErr = s.h.Send(ctx, &req) // SHADOWING
+		var sendRes *pdu.SendRes
+		sendRes, sendStream, handlerErr = s.h.Send(ctx, &req) // SHADOWING
+		if handlerErr == nil && sendRes != nil && sendStream != nil {
+			sendStream = s.compressSendStream(&req, sendRes, sendStream)
+		}
+		res = sendRes
 	case EndpointRecv:
 		var req pdu.ReceiveReq
 		if err := proto.Unmarshal(reqStructured, &req); err != nil {
@@ -183,14 +189,25 @@ func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *strea
 			s.log.WithError(err).Error("cannot open stream in receive request")
 			return
 		}
-		res, handlerErr = s.h.Receive(ctx, &req, stream) // SHADOWING
+		var recvStream io.ReadCloser = stream
+		if req.StreamCompression != "" {
+			recvStream, handlerErr = compression.NewDecompressor(stream, compression.Algorithm(req.StreamCompression)) // SHADOWING
+		}
+		if handlerErr == nil {
+			res, handlerErr = s.h.Receive(ctx, &req, recvStream) // SHADOWING
+		}
 	case EndpointPing:
 		var req pdu.PingReq
 		if err := proto.Unmarshal(reqStructured, &req); err != nil {
 			s.log.WithError(err).Error("cannot unmarshal ping request")
 			return
 		}
-		res, handlerErr = s.h.PingDataconn(ctx, &req) // SHADOWING
+		var pingRes *pdu.PingRes
+		pingRes, handlerErr = s.h.PingDataconn(ctx, &req) // SHADOWING
+		if pingRes != nil {
+			pingRes.StreamCompressions = compression.Supported()
+		}
+		res = pingRes
 	default:
 		s.log.WithField("endpoint", endpoint).Error("unknown endpoint")
 		handlerErr = fmt.Errorf("requested endpoint does not exist")
@@ -248,3 +265,22 @@ func (s *Server) serveConnRequest(ctx context.Context, endpoint string, c *strea
 		}
 	}
 }
+
+// compressSendStream compresses the stream if the client requested a supported compression.
+// Otherwise, the stream is sent uncompressed.
+func (s *Server) compressSendStream(req *pdu.SendReq, res *pdu.SendRes, sendStream io.ReadCloser) io.ReadCloser {
+	if req.StreamCompression == "" {
+		return sendStream
+	}
+	c := compression.Config{
+		Algorithm: compression.Algorithm(req.StreamCompression),
+		Level:     int(req.StreamCompressionLevel),
+	}
+	compressed, err := compression.NewCompressor(sendStream, c)
+	if err != nil {
+		s.log.WithError(err).Warn("cannot apply stream compression requested by client, sending uncompressed stream")
+		return sendStream
+	}
+	res.StreamCompression = string(c.Algorithm)
+	return compressed
+}
@@ -29,6 +29,17 @@ const (
 	ResponseStructuredMaxSize = 1 << 23
 )
 
+// Heartbeat configures the heartbeats of a client's connections.
+// The server always uses HeartbeatInterval and HeartbeatPeerTimeout.
+type Heartbeat struct {
+	// interval at which heartbeats are sent if no other frames are sent
+	Interval time.Duration
+	// the connection is considered dead if the peer does not send a frame within this duration
+	PeerTimeout time.Duration
+}
+
+var DefaultHeartbeat = Heartbeat{Interval: HeartbeatInterval, PeerTimeout: HeartbeatPeerTimeout}
+
 // the following are protocol constants
 const (
 	responseHeaderHandlerOk          = "HANDLER OK\n"
@@ -26,6 +26,7 @@ import (
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/util/devnoop"
@@ -150,7 +151,7 @@ func client() {
 	ctx := context.Background()
 
 	connecter := tcpConnecter{args.addr}
-	client := dataconn.NewClient(connecter, logger)
+	client := dataconn.NewClient(connecter, compression.Config{}, dataconn.DefaultHeartbeat, logger)
 
 	switch args.direction {
 	case "send":
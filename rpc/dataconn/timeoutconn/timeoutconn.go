@@ -121,7 +121,7 @@ restart:
 
 // Writes the given buffers to Conn, following the semantics of io.Copy,
 // but is guaranteed to use the writev system call if the wrapped Wire
-// support it.
+// support it (directly or through BuffersWriter).
 // Note the Conn does not support writev through io.Copy(aConn, aNetBuffers).
 func (c Conn) WritevFull(bufs net.Buffers) (n int64, err error) {
 	n = 0
@@ -130,7 +130,11 @@ restart:
 		return n, err
 	}
 	var nCurWrite int64
-	nCurWrite, err = io.Copy(c.Wire, &bufs)
+	if bw, ok := c.Wire.(BuffersWriter); ok {
+		nCurWrite, err = bw.WriteBuffers(&bufs)
+	} else {
+		nCurWrite, err = io.Copy(c.Wire, &bufs)
+	}
 	n += nCurWrite
 	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && nCurWrite > 0 {
 		err = nil
@@ -154,6 +158,22 @@ type SyscallConner interface {
 
 var _ SyscallConner = (*net.TCPConn)(nil)
 
+// ReadvObserver can be implemented by a SyscallConner Wire that counts
+// the bytes read from it: the readv system call bypasses the Wire's Read method,
+// hence the bytes read that way are reported through ObserveReadv.
+type ReadvObserver interface {
+	ObserveReadv(n int64)
+}
+
+// BuffersWriter must be implemented by a Wire that wraps another Wire
+// to preserve vectored I/O support for writes:
+// net.Buffers only uses the writev system call if it is written to a *net.TCPConn
+// (or similar) directly, so the wrapper must write bufs to the wrapped Wire, e.g., through bufs.WriteTo.
+// Like bufs.WriteTo, WriteBuffers consumes the written bytes from bufs.
+type BuffersWriter interface {
+	WriteBuffers(bufs *net.Buffers) (n int64, err error)
+}
+
 // Reads the given buffers full:
 // Think of io.ReadvFull, but for net.Buffers + using the readv syscall.
 //
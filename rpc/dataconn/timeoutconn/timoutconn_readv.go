@@ -44,6 +44,7 @@ func (c Conn) readv(buffers net.Buffers) (n int64, err error) {
 	}
 
 	_, iovecs := buildIovecs(buffers)
+	observer, _ := c.Wire.(ReadvObserver)
 
 	for len(iovecs) > 0 {
 		if err := c.renewReadDeadline(); err != nil {
@@ -51,6 +52,9 @@ func (c Conn) readv(buffers net.Buffers) (n int64, err error) {
 		}
 		oneN, oneErr := c.doOneReadv(rawConn, &iovecs)
 		n += oneN
+		if observer != nil && oneN > 0 {
+			observer.ObserveReadv(oneN)
+		}
 		if netErr, ok := oneErr.(net.Error); ok && netErr.Timeout() && oneN > 0 { // TODO likely not working
 			continue
 		} else if oneErr == nil && oneN > 0 {
@@ -54,7 +54,7 @@ func client() {
 		onErr(err, "build connecter error")
 	}
 
-	clientConn := grpchelper.ClientConn(cn, log)
+	clientConn := grpchelper.ClientConn(cn, grpchelper.StartKeepalivesAfterInactivityDuration, grpchelper.KeepalivePeerTimeout, log)
 	defer clientConn.Close()
 
 	// normal usage from here on
@@ -75,7 +75,7 @@ func server() {
 		ServeCommon: config.ServeCommon{
 			Type: "tcp",
 		},
-		Listen: "127.0.0.1:8080",
+		Listen: config.ListenAddresses{"127.0.0.1:8080"},
 		Clients: map[string]string{
 			"127.0.0.1": "localclient",
 			"::1":       "localclient",
@@ -18,20 +18,25 @@ import (
 // The following constants are relevant for interoperability.
 // We use the same values for client & server, because zrepl is more
 // symmetrical ("one source, one sink") instead of the typical
-// gRPC scenario ("many clients, single server")
+// gRPC scenario ("many clients, single server").
+// Clients may use different keepalive parameters, see ClientConn.
 const (
 	StartKeepalivesAfterInactivityDuration = 5 * time.Second
 	KeepalivePeerTimeout                   = 10 * time.Second
+	// the server closes connections of clients that send keepalives more frequently
+	KeepaliveEnforcementMinTime = StartKeepalivesAfterInactivityDuration / 2 // avoid skew
 )
 
 type Logger = logger.Logger
 
 // ClientConn is an easy-to-use wrapper around the Dialer and TransportCredentials interface
 // to produce a grpc.ClientConn
-func ClientConn(cn transport.Connecter, log Logger) *grpc.ClientConn {
+//
+// keepaliveTime must not be less than KeepaliveEnforcementMinTime.
+func ClientConn(cn transport.Connecter, keepaliveTime, keepalivePeerTimeout time.Duration, log Logger) *grpc.ClientConn {
 	ka := grpc.WithKeepaliveParams(keepalive.ClientParameters{
-		Time:                StartKeepalivesAfterInactivityDuration,
-		Timeout:             KeepalivePeerTimeout,
+		Time:                keepaliveTime,
+		Timeout:             keepalivePeerTimeout,
 		PermitWithoutStream: true,
 	})
 	dialerOption := grpc.WithDialer(grpcclientidentity.NewDialer(log, cn))
@@ -56,7 +61,7 @@ func NewServer(authListener transport.AuthenticatedListener, clientIdentityKey i
 		Timeout: KeepalivePeerTimeout,
 	})
 	ep := grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-		MinTime:             StartKeepalivesAfterInactivityDuration / 2, // avoid skew
+		MinTime:             KeepaliveEnforcementMinTime,
 		PermitWithoutStream: true,
 	})
 	tcs := grpcclientidentity.NewTransportCredentials(logger)
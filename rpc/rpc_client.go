@@ -19,6 +19,7 @@ import (
 	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/grpcclientidentity/grpchelper"
 	"github.com/zrepl/zrepl/rpc/versionhandshake"
 	"github.com/zrepl/zrepl/transport"
@@ -42,17 +43,17 @@ var _ logic.Receiver = &Client{}
 type DialContextFunc = func(ctx context.Context, network string, addr string) (net.Conn, error)
 
 // config must be validated, NewClient will panic if it is not valid
-func NewClient(cn transport.Connecter, loggers Loggers) *Client {
+func NewClient(cn transport.Connecter, streamCompression compression.Config, timeouts ClientTimeouts, loggers Loggers) *Client {
 
-	cn = versionhandshake.Connecter(cn, envconst.Duration("ZREPL_RPC_CLIENT_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second))
+	cn = versionhandshake.Connecter(cn, timeouts.Handshake)
 
-	muxedConnecter := mux(cn)
+	muxedConnecter := mux(cn, timeouts.Mux)
 
 	c := &Client{
 		loggers: loggers,
 		closed:  make(chan struct{}),
 	}
-	grpcConn := grpchelper.ClientConn(muxedConnecter.control, loggers.Control)
+	grpcConn := grpchelper.ClientConn(muxedConnecter.control, timeouts.SendKeepalive, timeouts.Idle, loggers.Control)
 
 	go func() {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -70,7 +71,10 @@ func NewClient(cn transport.Connecter, loggers Loggers) *Client {
 	c.controlClient = pdu.NewReplicationClient(grpcConn)
 	c.controlConn = grpcConn
 
-	c.dataClient = dataconn.NewClient(muxedConnecter.data, loggers.Data)
+	c.dataClient = dataconn.NewClient(muxedConnecter.data, streamCompression, dataconn.Heartbeat{
+		Interval:    timeouts.SendKeepalive,
+		PeerTimeout: timeouts.Idle,
+	}, loggers.Data)
 	return c
 }
 
@@ -143,6 +147,20 @@ func (c *Client) SendCompleted(ctx context.Context, in *pdu.SendCompletedReq) (*
 	return c.controlClient.SendCompleted(ctx, in)
 }
 
+func (c *Client) SendStreamDigest(ctx context.Context, in *pdu.SendStreamDigestReq) (*pdu.SendStreamDigestRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.SendStreamDigest")
+	defer endSpan()
+
+	return c.controlClient.SendStreamDigest(ctx, in)
+}
+
+func (c *Client) AckReceived(ctx context.Context, in *pdu.AckReceivedReq) (*pdu.AckReceivedRes, error) {
+	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.AckReceived")
+	defer endSpan()
+
+	return c.controlClient.AckReceived(ctx, in)
+}
+
 func (c *Client) WaitForConnectivity(ctx context.Context) error {
 	ctx, endSpan := trace.WithSpan(ctx, "rpc.client.WaitForConnectivity")
 	defer endSpan()
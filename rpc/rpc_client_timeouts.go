@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/rpc/grpcclientidentity/grpchelper"
+	"github.com/zrepl/zrepl/util/envconst"
+)
+
+// ClientTimeouts are the timeouts of the connections established by a Client.
+type ClientTimeouts struct {
+	// for the version handshake of each new connection
+	Handshake time.Duration
+	// for the transportmux header of each new connection
+	Mux time.Duration
+	// a connection is considered dead if the server has not sent anything for this duration
+	Idle time.Duration
+	// keepalives are sent if the client has not sent anything for this duration
+	SendKeepalive time.Duration
+}
+
+// ClientTimeoutsFromConfig validates in, which uses the default values if nil.
+func ClientTimeoutsFromConfig(in *config.ConnectTimeouts) (ClientTimeouts, error) {
+	if in == nil {
+		in = &config.ConnectTimeouts{}
+		config.Default(in)
+	}
+	t := ClientTimeouts{
+		Handshake:     in.Handshake,
+		Mux:           in.Handshake,
+		Idle:          in.Idle,
+		SendKeepalive: in.SendKeepalive,
+	}
+	if in.Handshake == 0 {
+		// deprecated: the environment variables predate field `handshake`
+		t.Handshake = envconst.Duration("ZREPL_RPC_CLIENT_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second)
+		t.Mux = envconst.Duration("ZREPL_TRANSPORT_MUX_TIMEOUT", 10*time.Second)
+	}
+	if t.Handshake <= 0 || t.Mux <= 0 || t.Idle <= 0 || t.SendKeepalive <= 0 {
+		return ClientTimeouts{}, errors.New("timeouts must be positive")
+	}
+	if t.SendKeepalive < grpchelper.KeepaliveEnforcementMinTime {
+		return ClientTimeouts{}, errors.Errorf("`send_keepalive` must be at least %s, the server rejects more frequent keepalives", grpchelper.KeepaliveEnforcementMinTime)
+	}
+	if t.SendKeepalive >= dataconn.HeartbeatPeerTimeout {
+		return ClientTimeouts{}, errors.Errorf("`send_keepalive` must be less than %s, the server considers connections without keepalives dead after that duration", dataconn.HeartbeatPeerTimeout)
+	}
+	if t.Idle <= t.SendKeepalive {
+		return ClientTimeouts{}, errors.New("`idle` must be greater than `send_keepalive`")
+	}
+	// the server does not know the client's timeouts and uses its defaults
+	serverKeepalive := dataconn.HeartbeatInterval
+	if grpchelper.StartKeepalivesAfterInactivityDuration > serverKeepalive {
+		serverKeepalive = grpchelper.StartKeepalivesAfterInactivityDuration
+	}
+	if t.Idle <= serverKeepalive {
+		return ClientTimeouts{}, errors.Errorf("`idle` must be greater than %s, the interval at which the server sends keepalives", serverKeepalive)
+	}
+	return t, nil
+}
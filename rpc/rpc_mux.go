@@ -39,11 +39,11 @@ type muxedConnecter struct {
 	control, data transport.Connecter
 }
 
-func mux(rawConnecter transport.Connecter) muxedConnecter {
+func mux(rawConnecter transport.Connecter, timeout time.Duration) muxedConnecter {
 	muxedConnecters, err := transportmux.MuxConnecter(
 		rawConnecter,
 		[]string{transportmuxLabelControl, transportmuxLabelData},
-		envconst.Duration("ZREPL_TRANSPORT_MUX_TIMEOUT", 10*time.Second),
+		timeout,
 	)
 	if err != nil {
 		// transportmux API guarantees that the returned error can only be due
@@ -0,0 +1,20 @@
+package versionhandshake
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var prom struct {
+	failures *prometheus.CounterVec
+}
+
+func init() {
+	prom.failures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "rpc",
+		Name:      "versionhandshake_failures",
+		Help:      "number of failed protocol version handshakes by side (connect, accept), e.g., due to incompatible peers or timeouts",
+	}, []string{"side"})
+}
+
+func RegisterMetrics(r prometheus.Registerer) {
+	r.MustRegister(prom.failures)
+}
@@ -23,6 +23,7 @@ func (c HandshakeConnecter) Connect(ctx context.Context) (transport.Wire, error)
 		dl = time.Now().Add(c.timeout)
 	}
 	if err := DoHandshakeCurrentVersion(conn, dl); err != nil {
+		prom.failures.WithLabelValues("connect").Inc()
 		conn.Close()
 		return nil, err
 	}
@@ -56,6 +57,7 @@ func (l HandshakeListener) Accept(ctx context.Context) (*transport.AuthConn, err
 		dl = time.Now().Add(l.timeout) // shadowing
 	}
 	if err := DoHandshakeCurrentVersion(conn, dl); err != nil {
+		prom.failures.WithLabelValues("accept").Inc()
 		err.isAcceptError = true
 		conn.Close()
 		return nil, err
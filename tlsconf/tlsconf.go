@@ -9,7 +9,10 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sync"
 	"time"
+
+	"github.com/zrepl/zrepl/util/tcpsock"
 )
 
 func ParseCAFile(certfile string) (*x509.CertPool, error) {
@@ -25,13 +28,38 @@ func ParseCAFile(certfile string) (*x509.CertPool, error) {
 }
 
 type ClientAuthListener struct {
-	l                *net.TCPListener
+	l                tcpsock.Listener
 	c                *tls.Config
+	verifyAddr       func(net.Addr) error // may be nil
 	handshakeTimeout time.Duration
+
+	// the handshakes run concurrently, see Accept
+	startAccepting sync.Once
+	accepted       chan acceptResult
+	closeOnce      sync.Once
+	closed         chan struct{}
+}
+
+type acceptResult struct {
+	tcpConn  *net.TCPConn
+	tlsConn  *tls.Conn
+	clientCN string
+	err      error
+}
+
+func newClientAuthListener(l tcpsock.Listener, c *tls.Config, verifyAddr func(net.Addr) error, handshakeTimeout time.Duration) *ClientAuthListener {
+	return &ClientAuthListener{
+		l:                l,
+		c:                c,
+		verifyAddr:       verifyAddr,
+		handshakeTimeout: handshakeTimeout,
+		accepted:         make(chan acceptResult),
+		closed:           make(chan struct{}),
+	}
 }
 
 func NewClientAuthListener(
-	l *net.TCPListener, ca *x509.CertPool, serverCert tls.Certificate,
+	l tcpsock.Listener, ca *x509.CertPool, serverCert tls.Certificate,
 	handshakeTimeout time.Duration) *ClientAuthListener {
 
 	if ca == nil {
@@ -40,39 +68,142 @@ func NewClientAuthListener(
 	if serverCert.Certificate == nil || serverCert.PrivateKey == nil {
 		panic(serverCert)
 	}
+	certs := func() (*x509.CertPool, tls.Certificate) { return ca, serverCert }
+	return NewReloadingClientAuthListener(l, certs, ClientVerifier{}, handshakeTimeout)
+}
+
+// CertificatesFunc returns the CA for client certificates and the server certificate.
+type CertificatesFunc func() (ca *x509.CertPool, serverCert tls.Certificate)
+
+// ClientVerifier hooks into the connection setup of a ClientAuthListener.
+// Both fields may be nil.
+type ClientVerifier struct {
+	// Addr is called before the handshake.
+	Addr func(remote net.Addr) error
+	// Certificate is called during the handshake after the client certificate
+	// has been verified against the CA. issuer is the certificate that signed leaf.
+	Certificate func(remote net.Addr, leaf, issuer *x509.Certificate) error
+}
+
+// NewReloadingClientAuthListener is like NewClientAuthListener, but calls certs
+// for every handshake, so that changes to the certificates only affect new connections.
+func NewReloadingClientAuthListener(l tcpsock.Listener, certs CertificatesFunc, verify ClientVerifier, handshakeTimeout time.Duration) *ClientAuthListener {
+	keyLog := keylogFromEnv()
+	tlsConf := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			return clientAuthConfig(hello, certs, verify, keyLog), nil
+		},
+	}
+	return newClientAuthListener(l, tlsConf, verify.Addr, handshakeTimeout)
+}
+
+// ServerNameRouter returns the certificates and the verifier for the server name
+// that a client requested via SNI, or an error that aborts the handshake.
+// The verifier's Addr field is ignored.
+type ServerNameRouter func(serverName string) (CertificatesFunc, ClientVerifier, error)
 
+// NewSNIClientAuthListener is like NewReloadingClientAuthListener, but selects the certificates
+// and the verifier per connection with route. verifyAddr may be nil.
+// Accept's caller can find the requested server name in tlsConn.ConnectionState().ServerName.
+func NewSNIClientAuthListener(l tcpsock.Listener, route ServerNameRouter, verifyAddr func(remote net.Addr) error, handshakeTimeout time.Duration) *ClientAuthListener {
+	keyLog := keylogFromEnv()
 	tlsConf := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			certs, verify, err := route(hello.ServerName)
+			if err != nil {
+				return nil, err
+			}
+			return clientAuthConfig(hello, certs, verify, keyLog), nil
+		},
+	}
+	return newClientAuthListener(l, tlsConf, verifyAddr, handshakeTimeout)
+}
+
+func clientAuthConfig(hello *tls.ClientHelloInfo, certs CertificatesFunc, verify ClientVerifier, keyLog io.Writer) *tls.Config {
+	ca, serverCert := certs()
+	c := &tls.Config{
 		Certificates:             []tls.Certificate{serverCert},
 		ClientCAs:                ca,
 		ClientAuth:               tls.RequireAndVerifyClientCert,
 		PreferServerCipherSuites: true,
-		KeyLogWriter:             keylogFromEnv(),
+		KeyLogWriter:             keyLog,
 	}
-	return &ClientAuthListener{
-		l,
-		tlsConf,
-		handshakeTimeout,
+	if verify.Certificate != nil {
+		remote := hello.Conn.RemoteAddr()
+		c.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) < 1 || len(verifiedChains[0]) < 1 {
+				return errors.New("no verified client certificate chain")
+			}
+			chain := verifiedChains[0]
+			issuer := chain[0] // self-signed
+			if len(chain) > 1 {
+				issuer = chain[1]
+			}
+			return verify.Certificate(remote, chain[0], issuer)
+		}
 	}
+	return c
 }
 
-// Accept() accepts a connection from the *net.TCPListener passed to the constructor
+// Accept() accepts a connection from the listener passed to the constructor
 // and sets up the TLS connection, including handshake and peer CommonName validation
 // within the specified handshakeTimeout.
 //
+// The handshakes run in a goroutine per connection, so that a slow client or a slow
+// verification of its certificate (e.g. a revocation check) does not delay other connections.
+// Accept returns the connections in the order in which their handshakes completed.
+//
 // It returns both the raw TCP connection (tcpConn) and the TLS connection (tlsConn) on top of it.
 // Access to the raw tcpConn might be necessary if CloseWrite semantics are desired:
 // tlsConn.CloseWrite does NOT call tcpConn.CloseWrite, hence we provide access to tcpConn to
 // allow the caller to do this by themselves.
 func (l *ClientAuthListener) Accept() (tcpConn *net.TCPConn, tlsConn *tls.Conn, clientCN string, err error) {
-	tcpConn, err = l.l.AcceptTCP()
-	if err != nil {
-		return nil, nil, "", err
+	l.startAccepting.Do(func() { go l.acceptLoop() })
+	select {
+	case r := <-l.accepted:
+		return r.tcpConn, r.tlsConn, r.clientCN, r.err
+	case <-l.closed:
+		return nil, nil, "", errors.New("listener closed")
+	}
+}
+
+func (l *ClientAuthListener) acceptLoop() {
+	for {
+		tcpConn, err := l.l.AcceptTCP()
+		if err != nil {
+			select {
+			case l.accepted <- acceptResult{err: err}:
+			case <-l.closed:
+				return
+			}
+			continue
+		}
+		go func() {
+			r := l.handshake(tcpConn)
+			select {
+			case l.accepted <- r:
+			case <-l.closed:
+				if r.tlsConn != nil {
+					r.tlsConn.Close()
+				}
+			}
+		}()
+	}
+}
+
+func (l *ClientAuthListener) handshake(tcpConn *net.TCPConn) acceptResult {
+	if l.verifyAddr != nil {
+		if err := l.verifyAddr(tcpConn.RemoteAddr()); err != nil {
+			tcpConn.Close()
+			return acceptResult{err: err}
+		}
 	}
 
-	tlsConn = tls.Server(tcpConn, l.c)
+	tlsConn := tls.Server(tcpConn, l.c)
 	var (
 		cn        string
 		peerCerts []*x509.Certificate
+		err       error
 	)
 	if err = tlsConn.SetDeadline(time.Now().Add(l.handshakeTimeout)); err != nil {
 		goto CloseAndErr
@@ -90,11 +221,11 @@ func (l *ClientAuthListener) Accept() (tcpConn *net.TCPConn, tlsConn *tls.Conn,
 		goto CloseAndErr
 	}
 	cn = peerCerts[0].Subject.CommonName
-	return tcpConn, tlsConn, cn, nil
+	return acceptResult{tcpConn, tlsConn, cn, nil}
 CloseAndErr:
 	// unlike CloseWrite, Close on *tls.Conn actually closes the underlying connection
 	tlsConn.Close() // TODO log error
-	return nil, nil, "", err
+	return acceptResult{err: err}
 }
 
 func (l *ClientAuthListener) Addr() net.Addr {
@@ -102,6 +233,7 @@ func (l *ClientAuthListener) Addr() net.Addr {
 }
 
 func (l *ClientAuthListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
 	return l.l.Close()
 }
 
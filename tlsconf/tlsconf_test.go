@@ -0,0 +1,83 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+// a self-signed certificate that serves as CA, server and client certificate
+func selfSignedCert(t *testing.T, cn string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+func TestClientAuthListenerConcurrentHandshakes(t *testing.T) {
+	cert, pool := selfSignedCert(t, "host")
+	tcpListener, err := tcpsock.ListenAll([]string{"127.0.0.1:0"}, false, tcpsock.SocketOptions{})
+	require.NoError(t, err)
+	l := NewClientAuthListener(tcpListener, pool, cert, 10*time.Second)
+	defer l.Close()
+
+	// a client that never completes its handshake
+	stalled, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer stalled.Close()
+
+	clientConf, err := ClientAuthClient("host", pool, cert)
+	require.NoError(t, err)
+	clientErr := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", l.Addr().String(), clientConf)
+		if err == nil {
+			conn.Close()
+		}
+		clientErr <- err
+	}()
+
+	accepted := make(chan string, 1)
+	go func() {
+		_, tlsConn, cn, err := l.Accept()
+		if assert.NoError(t, err) {
+			tlsConn.Close()
+		}
+		accepted <- cn
+	}()
+	select {
+	case cn := <-accepted:
+		assert.Equal(t, "host", cn)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled handshake must not delay other connections")
+	}
+	require.NoError(t, <-clientErr)
+}
@@ -4,13 +4,17 @@ package fromconfig
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/local"
+	"github.com/zrepl/zrepl/transport/noise"
 	"github.com/zrepl/zrepl/transport/ssh"
+	"github.com/zrepl/zrepl/transport/sshnative"
 	"github.com/zrepl/zrepl/transport/tcp"
 	"github.com/zrepl/zrepl/transport/tls"
 )
@@ -28,6 +32,10 @@ func ListenerFactoryFromConfig(g *config.Global, in config.ServeEnum) (transport
 		l, err = tls.TLSListenerFactoryFromConfig(g, v)
 	case *config.StdinserverServer:
 		l, err = ssh.MultiStdinserverListenerFactoryFromConfig(g, v)
+	case *config.SSHServe:
+		l, err = sshnative.SSHListenerFactoryFromConfig(g, v)
+	case *config.NoiseServe:
+		l, err = noise.NoiseListenerFactoryFromConfig(g, v)
 	case *config.LocalServe:
 		l, err = local.LocalListenerFactoryFromConfig(g, v)
 	default:
@@ -45,10 +53,14 @@ func ConnecterFromConfig(g *config.Global, in config.ConnectEnum) (transport.Con
 	switch v := in.Ret.(type) {
 	case *config.SSHStdinserverConnect:
 		connecter, err = ssh.SSHStdinserverConnecterFromConfig(v)
+	case *config.SSHConnect:
+		connecter, err = sshnative.SSHConnecterFromConfig(v)
 	case *config.TCPConnect:
 		connecter, err = tcp.TCPConnecterFromConfig(v)
 	case *config.TLSConnect:
 		connecter, err = tls.TLSConnecterFromConfig(v)
+	case *config.NoiseConnect:
+		connecter, err = noise.NoiseConnecterFromConfig(v)
 	case *config.LocalConnect:
 		connecter, err = local.LocalConnecterFromConfig(v)
 	default:
@@ -57,3 +69,23 @@ func ConnecterFromConfig(g *config.Global, in config.ConnectEnum) (transport.Con
 
 	return connecter, err
 }
+
+// PeerFromConfig returns the peer that in connects to, for use in metrics labels.
+func PeerFromConfig(in config.ConnectEnum) string {
+	switch v := in.Ret.(type) {
+	case *config.SSHStdinserverConnect:
+		return net.JoinHostPort(v.Host, strconv.Itoa(int(v.Port)))
+	case *config.SSHConnect:
+		return net.JoinHostPort(v.Host, strconv.Itoa(int(v.Port)))
+	case *config.TCPConnect:
+		return v.Address
+	case *config.TLSConnect:
+		return v.Address
+	case *config.NoiseConnect:
+		return v.Address
+	case *config.LocalConnect:
+		return v.ListenerName
+	default:
+		panic(fmt.Sprintf("implementation error: unknown connecter type %T", v))
+	}
+}
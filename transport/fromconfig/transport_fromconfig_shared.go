@@ -0,0 +1,219 @@
+package fromconfig
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/tls"
+)
+
+// SharedListenerFactoriesFromConfig finds the tcp and tls serve sections in in, e.g. of all passive jobs,
+// that have the same listen addresses, and returns listener factories that share a single listener for them.
+// The returned slice is indexed like in and has nil entries for serve sections that do not share a listener.
+//
+// Connections to a shared listener are demultiplexed by client identity, which must thus be unique among the sections.
+// All other fields that apply to the listener as a whole must be equal.
+// If the tls serve sections specify 'server_names', connections are demultiplexed by SNI instead,
+// see tls.SNIListenerFactoriesFromConfig.
+func SharedListenerFactoriesFromConfig(g *config.Global, in []config.ServeEnum) ([]transport.AuthenticatedListenerFactory, error) {
+	groups := make(map[string][]int)
+	var order []string
+	for i, s := range in {
+		addr, ok := SharedListenAddress(s)
+		if !ok {
+			continue
+		}
+		if _, ok := groups[addr]; !ok {
+			order = append(order, addr)
+		}
+		groups[addr] = append(groups[addr], i)
+	}
+
+	lfs := make([]transport.AuthenticatedListenerFactory, len(in))
+	for _, addr := range order {
+		idxs := groups[addr]
+		if len(idxs) < 2 {
+			continue
+		}
+		serves := make([]config.ServeEnum, len(idxs))
+		for i, idx := range idxs {
+			serves[i] = in[idx]
+		}
+		shared, err := sharedListenerFactories(g, serves)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot share listener on %q", addr)
+		}
+		for i, idx := range idxs {
+			lfs[idx] = shared[i]
+		}
+	}
+	return lfs, nil
+}
+
+// SharedListenAddress returns the key by which SharedListenerFactoriesFromConfig groups serve sections,
+// ok is false for serve sections that never share a listener.
+// The listen addresses are compared as a set, i.e., their order does not matter.
+func SharedListenAddress(in config.ServeEnum) (addr string, ok bool) {
+	switch in.Ret.(type) {
+	case *config.TCPServe, *config.TLSServe:
+		listen, _ := ListenAddresses(in)
+		sorted := make([]string, len(listen))
+		copy(sorted, listen)
+		sort.Strings(sorted)
+		return strings.Join(sorted, ","), true
+	default:
+		return "", false
+	}
+}
+
+// ListenAddresses returns the tcp addresses that in listens on,
+// ok is false for serve sections that do not listen on tcp.
+func ListenAddresses(in config.ServeEnum) (listen []string, ok bool) {
+	switch v := in.Ret.(type) {
+	case *config.TCPServe:
+		return v.Listen, true
+	case *config.TLSServe:
+		return v.Listen, true
+	case *config.NoiseServe:
+		return v.Listen, true
+	case *config.SSHServe:
+		return v.Listen, true
+	default:
+		return nil, false
+	}
+}
+
+// ListenAddressesOverlap returns whether listening on a and b conflicts,
+// i.e., whether they have the same port and the same host or one of them listens on all addresses.
+// Addresses that cannot be parsed are compared literally.
+func ListenAddressesOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB {
+		return false
+	}
+	return hostA == hostB || listensOnAllAddresses(hostA, hostB) || listensOnAllAddresses(hostB, hostA)
+}
+
+// listensOnAllAddresses returns whether host is a wildcard address that includes other
+func listensOnAllAddresses(host, other string) bool {
+	switch host {
+	case "", "::":
+		return true
+	case "0.0.0.0":
+		ip := net.ParseIP(other)
+		return ip == nil || ip.To4() != nil
+	default:
+		return false
+	}
+}
+
+// sharedListenerFactories merges serves into a single serve section,
+// creates its listener and demultiplexes it by the client identities of each of serves.
+func sharedListenerFactories(g *config.Global, serves []config.ServeEnum) ([]transport.AuthenticatedListenerFactory, error) {
+	if sni, err := sniServes(serves); err != nil {
+		return nil, err
+	} else if sni != nil {
+		return tls.SNIListenerFactoriesFromConfig(g, sni)
+	}
+
+	identities := make([][]string, len(serves))
+	var merged interface{}
+	switch first := serves[0].Ret.(type) {
+	case *config.TCPServe:
+		m := *first
+		m.Clients = make(map[string]string)
+		m.ClientNetworks = make(map[string][]string)
+		for i, s := range serves {
+			v, ok := s.Ret.(*config.TCPServe)
+			if !ok {
+				return nil, errors.New("serve sections on the same listen address must have the same type")
+			}
+			if v.ListenFreeBind != first.ListenFreeBind || !reflect.DeepEqual(v.Socket, first.Socket) {
+				return nil, errors.New("fields 'listen_freebind' and 'socket' must be equal")
+			}
+			for ip, ident := range v.Clients {
+				if _, ok := m.Clients[ip]; ok {
+					return nil, errors.Errorf("client %q is specified more than once", ip)
+				}
+				m.Clients[ip] = ident
+				identities[i] = append(identities[i], ident)
+			}
+			if _, err := transport.ClientNetworksFromConfig(v.ClientNetworks, identities[i]); err != nil {
+				return nil, errors.Wrap(err, "invalid field 'client_networks'")
+			}
+			for ident, networks := range v.ClientNetworks {
+				m.ClientNetworks[ident] = networks
+			}
+		}
+		merged = &m
+	case *config.TLSServe:
+		m := *first
+		m.ClientCNs = nil
+		m.ClientNetworks = make(map[string][]string)
+		for i, s := range serves {
+			v, ok := s.Ret.(*config.TLSServe)
+			if !ok {
+				return nil, errors.New("serve sections on the same listen address must have the same type")
+			}
+			if v.ListenFreeBind != first.ListenFreeBind ||
+				v.Ca != first.Ca || v.Cert != first.Cert || v.Key != first.Key ||
+				v.HandshakeTimeout != first.HandshakeTimeout || !reflect.DeepEqual(v.Socket, first.Socket) ||
+				!reflect.DeepEqual(v.CRL, first.CRL) || !reflect.DeepEqual(v.OCSP, first.OCSP) {
+				return nil, errors.New("fields 'listen_freebind', 'ca', 'cert', 'key', 'handshake_timeout', 'socket', 'crl' and 'ocsp' must be equal")
+			}
+			m.ClientCNs = append(m.ClientCNs, v.ClientCNs...)
+			identities[i] = append(identities[i], v.ClientCNs...)
+			if _, err := transport.ClientNetworksFromConfig(v.ClientNetworks, identities[i]); err != nil {
+				return nil, errors.Wrap(err, "invalid field 'client_networks'")
+			}
+			for ident, networks := range v.ClientNetworks {
+				m.ClientNetworks[ident] = networks
+			}
+		}
+		merged = &m
+	default:
+		panic("implementation error: sharedListenAddress and sharedListenerFactories are inconsistent")
+	}
+
+	lf, err := ListenerFactoryFromConfig(g, config.ServeEnum{Ret: merged})
+	if err != nil {
+		return nil, err
+	}
+	demux := transport.NewIdentityDemux(lf)
+	lfs := make([]transport.AuthenticatedListenerFactory, len(serves))
+	for i := range serves {
+		if lfs[i], err = demux.ListenerFactory(identities[i]); err != nil {
+			return nil, err
+		}
+	}
+	return lfs, nil
+}
+
+// sniServes returns the tls serve sections in serves if any of them specifies 'server_names', and nil otherwise.
+func sniServes(serves []config.ServeEnum) ([]*config.TLSServe, error) {
+	sni := false
+	tlsServes := make([]*config.TLSServe, 0, len(serves))
+	for _, s := range serves {
+		if v, ok := s.Ret.(*config.TLSServe); ok {
+			sni = sni || len(v.ServerNames) > 0
+			tlsServes = append(tlsServes, v)
+		}
+	}
+	if !sni {
+		return nil, nil
+	}
+	if len(tlsServes) != len(serves) {
+		return nil, errors.New("serve sections on the same listen address must have the same type")
+	}
+	return tlsServes, nil
+}
@@ -0,0 +1,91 @@
+package noise
+
+import (
+	"context"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+type NoiseConnecter struct {
+	Address         string
+	dialer          *tcpsock.Dialer
+	static          noise.DHKey
+	serverPublicKey []byte
+}
+
+func NoiseConnecterFromConfig(in *config.NoiseConnect) (*NoiseConnecter, error) {
+	static, err := ParsePrivateKey(in.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field `private_key`")
+	}
+	serverPublicKey, err := ParsePublicKey(in.ServerPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field `server_public_key`")
+	}
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field `socket`")
+	}
+	dialer, err := tcpsock.NewDialer(in.DialTimeout, in.Proxy, socketOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot configure field `proxy`")
+	}
+	return &NoiseConnecter{in.Address, dialer, static, serverPublicKey}, nil
+}
+
+func (c *NoiseConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
+	tcpConn, err := c.dialer.DialContext(dialCtx, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	if dl, ok := dialCtx.Deadline(); ok {
+		if err := tcpConn.SetDeadline(dl); err != nil {
+			tcpConn.Close()
+			return nil, errors.Wrap(err, "cannot set handshake deadline")
+		}
+	}
+	hs, err := noise.NewHandshakeState(handshakeConfig(true, c.static, c.serverPublicKey))
+	if err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+
+	msg, _, _, err := hs.WriteMessage(nil, nil)
+	if err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	if err := writeMessage(tcpConn, msg); err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrap(err, "noise handshake")
+	}
+	msg, err = readMessage(tcpConn)
+	if err != nil {
+		tcpConn.Close()
+		// the server closes the connection if it does not know our public key
+		return nil, errors.Wrap(err, "noise handshake (is the client's public key configured on the server?)")
+	}
+	_, send, recv, err := hs.ReadMessage(nil, msg)
+	if err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrap(err, "noise handshake (does `server_public_key` match the server's private key?)")
+	}
+
+	conn := newConn(tcpConn, send, recv)
+	// confirms the handshake to the server, see package comment
+	if err := conn.writeTransportMessage(nil); err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrap(err, "noise handshake")
+	}
+	if err := tcpConn.SetDeadline(time.Time{}); err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrap(err, "cannot clear handshake deadline")
+	}
+	return conn, nil
+}
@@ -0,0 +1,270 @@
+// Package noise implements a transport that authenticates and encrypts TCP connections
+// with the Noise protocol framework (https://noiseprotocol.org), using static Curve25519 keys like WireGuard.
+//
+// The handshake is Noise_IK_25519_ChaChaPoly_BLAKE2s: the client knows the server's public key in advance,
+// and the server identifies the client by the client's static public key, which it learns in the first message.
+// The client then sends an empty transport message so that the server knows that the client
+// completed the handshake before Accept returns, i.e., a replayed first message is not accepted.
+//
+// All messages are prefixed with their length as a big-endian uint16.
+// An empty transport message after the handshake signals CloseWrite,
+// hence the end of the stream is authenticated and truncation is detected.
+package noise
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+var cipherSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, noise.HashBLAKE2s)
+
+// mixed into the handshake hash, must be equal on both sides
+var prologue = []byte("zrepl noise transport v1")
+
+const keyLen = 32
+
+func handshakeConfig(initiator bool, static noise.DHKey, peerStatic []byte) noise.Config {
+	return noise.Config{
+		CipherSuite:   cipherSuite,
+		Random:        rand.Reader,
+		Pattern:       noise.HandshakeIK,
+		Initiator:     initiator,
+		Prologue:      prologue,
+		StaticKeypair: static,
+		PeerStatic:    peerStatic,
+	}
+}
+
+// GenerateKeypair returns a new base64-encoded private and public key.
+func GenerateKeypair() (private, public string, err error) {
+	kp, err := cipherSuite.GenerateKeypair(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(kp.Private), base64.StdEncoding.EncodeToString(kp.Public), nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "key must be base64-encoded")
+	}
+	if len(k) != keyLen {
+		return nil, errors.Errorf("key must be %d bytes long, got %d", keyLen, len(k))
+	}
+	return k, nil
+}
+
+// ParsePublicKey parses a base64-encoded public key.
+func ParsePublicKey(s string) ([]byte, error) {
+	return decodeKey(s)
+}
+
+// ParsePrivateKey parses a base64-encoded private key and derives its public key.
+func ParsePrivateKey(s string) (noise.DHKey, error) {
+	priv, err := decodeKey(s)
+	if err != nil {
+		return noise.DHKey{}, err
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return noise.DHKey{}, err
+	}
+	return noise.DHKey{Private: priv, Public: pub}, nil
+}
+
+// PublicKey returns the base64-encoded public key of the base64-encoded private key.
+func PublicKey(private string) (string, error) {
+	kp, err := ParsePrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(kp.Public), nil
+}
+
+const (
+	lengthPrefixLen = 2
+	tagLen          = 16
+	// the largest payload of a transport message
+	maxPayloadLen = noise.MaxMsgLen - tagLen
+)
+
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, lengthPrefixLen+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[lengthPrefixLen:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readMessage is for the handshake only, see conn.Read for transport messages.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [lengthPrefixLen]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+var errTruncated = errors.New("noise: connection closed without end-of-stream message, stream may be truncated")
+
+// conn implements transport.Wire on top of a TCP connection after the handshake.
+//
+// It deliberately does not implement timeoutconn.SyscallConner
+// because vectored I/O on the raw socket would bypass encryption.
+type conn struct {
+	tcpConn tcpConn
+
+	rmtx sync.Mutex
+	recv *noise.CipherState
+	// the transport message that is being read, incl. its length prefix,
+	// kept across Read calls so that a Read that times out can be resumed
+	rmsg  []byte
+	rn    int
+	rbuf  []byte // decrypted, not yet returned payload
+	rerr  error  // sticky, e.g. io.EOF or authentication failure
+	rdata [lengthPrefixLen + noise.MaxMsgLen]byte
+	rout  [noise.MaxMsgLen]byte
+
+	wmtx sync.Mutex
+	send *noise.CipherState
+	werr error // sticky, a Write that fails may have written a partial message
+	wbuf [lengthPrefixLen + noise.MaxMsgLen]byte
+}
+
+// tcpConn is a *net.TCPConn, or a *tcpsock.Conn on the client side
+type tcpConn interface {
+	net.Conn
+	CloseWrite() error
+}
+
+func newConn(tcpConn tcpConn, send, recv *noise.CipherState) *conn {
+	return &conn{tcpConn: tcpConn, send: send, recv: recv}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.rmtx.Lock()
+	defer c.rmtx.Unlock()
+	for len(c.rbuf) == 0 {
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		payload, err := c.readTransportMessage()
+		if err != nil {
+			return 0, err
+		}
+		if len(payload) == 0 {
+			c.rerr = io.EOF
+			return 0, c.rerr
+		}
+		c.rbuf = payload
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// readTransportMessage reads and decrypts the next transport message.
+// The payload is valid until the next call.
+// Errors of the underlying connection are not sticky, i.e. the read can be resumed after timeouts.
+func (c *conn) readTransportMessage() ([]byte, error) {
+	if c.rmsg == nil {
+		c.rmsg = c.rdata[:lengthPrefixLen]
+		c.rn = 0
+	}
+	for c.rn < len(c.rmsg) {
+		n, err := c.tcpConn.Read(c.rmsg[c.rn:])
+		c.rn += n
+		if err == io.EOF {
+			c.rerr = errTruncated
+			return nil, c.rerr
+		} else if err != nil {
+			return nil, err
+		}
+		if c.rn == lengthPrefixLen && len(c.rmsg) == lengthPrefixLen {
+			msgLen := int(binary.BigEndian.Uint16(c.rmsg))
+			if msgLen < tagLen {
+				c.rerr = errors.Errorf("noise: invalid transport message length %d", msgLen)
+				return nil, c.rerr
+			}
+			c.rmsg = c.rdata[:lengthPrefixLen+msgLen]
+		}
+	}
+	payload, err := c.recv.Decrypt(c.rout[:0], nil, c.rmsg[lengthPrefixLen:])
+	c.rmsg = nil
+	if err != nil {
+		c.rerr = errors.Wrap(err, "noise: cannot decrypt transport message")
+		return nil, c.rerr
+	}
+	return payload, nil
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxPayloadLen {
+			chunk = chunk[:maxPayloadLen]
+		}
+		if err := c.writeTransportMessage(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *conn) writeTransportMessage(payload []byte) error {
+	if c.werr != nil {
+		return c.werr
+	}
+	msg, err := c.send.Encrypt(c.wbuf[:lengthPrefixLen], nil, payload)
+	if err != nil {
+		c.werr = err
+		return err
+	}
+	binary.BigEndian.PutUint16(msg, uint16(len(msg)-lengthPrefixLen))
+	if _, err := c.tcpConn.Write(msg); err != nil {
+		c.werr = err
+		return err
+	}
+	return nil
+}
+
+var errWriteClosed = errors.New("noise: write on closed connection")
+
+// CloseWrite sends the end-of-stream message and shuts down the write side of the TCP connection.
+func (c *conn) CloseWrite() error {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	if err := c.writeTransportMessage(nil); err != nil {
+		return err
+	}
+	c.werr = errWriteClosed
+	return c.tcpConn.CloseWrite()
+}
+
+func (c *conn) Close() error { return c.tcpConn.Close() }
+
+func (c *conn) LocalAddr() net.Addr  { return c.tcpConn.LocalAddr() }
+func (c *conn) RemoteAddr() net.Addr { return c.tcpConn.RemoteAddr() }
+
+func (c *conn) SetDeadline(t time.Time) error      { return c.tcpConn.SetDeadline(t) }
+func (c *conn) SetReadDeadline(t time.Time) error  { return c.tcpConn.SetReadDeadline(t) }
+func (c *conn) SetWriteDeadline(t time.Time) error { return c.tcpConn.SetWriteDeadline(t) }
@@ -0,0 +1,225 @@
+package noise
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type testKeypair struct{ private, public string }
+
+func genKeypair(t *testing.T) testKeypair {
+	private, public, err := GenerateKeypair()
+	require.NoError(t, err)
+	return testKeypair{private, public}
+}
+
+func listen(t *testing.T, server testKeypair, clients map[string]string) transport.AuthenticatedListener {
+	lf, err := NoiseListenerFactoryFromConfig(nil, &config.NoiseServe{
+		Listen:           config.ListenAddresses{"127.0.0.1:0"},
+		PrivateKey:       server.private,
+		Clients:          clients,
+		HandshakeTimeout: 10 * time.Second,
+	})
+	require.NoError(t, err)
+	l, err := lf()
+	require.NoError(t, err)
+	return l
+}
+
+func connecter(t *testing.T, l transport.AuthenticatedListener, client testKeypair, serverPublicKey string) *NoiseConnecter {
+	c, err := NoiseConnecterFromConfig(&config.NoiseConnect{
+		Address:         l.Addr().String(),
+		PrivateKey:      client.private,
+		ServerPublicKey: serverPublicKey,
+		DialTimeout:     10 * time.Second,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+type acceptRes struct {
+	conn *transport.AuthConn
+	err  error
+}
+
+func accept(l transport.AuthenticatedListener) <-chan acceptRes {
+	accepted := make(chan acceptRes, 1)
+	go func() {
+		conn, err := l.Accept(context.Background())
+		accepted <- acceptRes{conn, err}
+	}()
+	return accepted
+}
+
+func TestKeys(t *testing.T) {
+	kp := genKeypair(t)
+	public, err := PublicKey(kp.private)
+	require.NoError(t, err)
+	assert.Equal(t, kp.public, public)
+
+	_, err = ParsePublicKey("not base64")
+	assert.Error(t, err)
+	_, err = ParsePublicKey("AAAA")
+	assert.Error(t, err, "too short")
+}
+
+func TestNoiseConnectAndServe(t *testing.T) {
+	server, client := genKeypair(t), genKeypair(t)
+	l := listen(t, server, map[string]string{"client1": client.public})
+	defer l.Close()
+
+	accepted := accept(l)
+	clientConn, err := connecter(t, l, client, server.public).Connect(context.Background())
+	require.NoError(t, err)
+	defer clientConn.Close()
+	res := <-accepted
+	require.NoError(t, res.err)
+	serverConn := res.conn
+	defer serverConn.Close()
+	assert.Equal(t, "client1", serverConn.ClientIdentity())
+
+	// larger than a single transport message
+	data := bytes.Repeat([]byte("0123456789abcdef"), 3*noise.MaxMsgLen/16+1)
+	go func() {
+		_, err := clientConn.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, clientConn.CloseWrite())
+	}()
+	buf, err := ioutil.ReadAll(serverConn)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf)
+
+	_, err = clientConn.Write([]byte("x"))
+	assert.Error(t, err, "write after CloseWrite")
+
+	// server => client still works after the client's half-close
+	go func() {
+		_, err := serverConn.Write([]byte("pong"))
+		assert.NoError(t, err)
+		assert.NoError(t, serverConn.CloseWrite())
+	}()
+	buf, err = ioutil.ReadAll(clientConn)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
+
+func TestNoiseReadDeadlineCanBeResumed(t *testing.T) {
+	server, client := genKeypair(t), genKeypair(t)
+	l := listen(t, server, map[string]string{"client1": client.public})
+	defer l.Close()
+
+	accepted := accept(l)
+	clientConn, err := connecter(t, l, client, server.public).Connect(context.Background())
+	require.NoError(t, err)
+	defer clientConn.Close()
+	res := <-accepted
+	require.NoError(t, res.err)
+	defer res.conn.Close()
+
+	require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = clientConn.Read(make([]byte, 1))
+	require.Error(t, err)
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "%T", err)
+	assert.True(t, netErr.Timeout())
+
+	require.NoError(t, clientConn.SetReadDeadline(time.Time{}))
+	_, err = res.conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(clientConn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestNoiseTruncationIsDetected(t *testing.T) {
+	server, client := genKeypair(t), genKeypair(t)
+	l := listen(t, server, map[string]string{"client1": client.public})
+	defer l.Close()
+
+	accepted := accept(l)
+	clientConn, err := connecter(t, l, client, server.public).Connect(context.Background())
+	require.NoError(t, err)
+	defer clientConn.Close()
+	res := <-accepted
+	require.NoError(t, res.err)
+	defer res.conn.Close()
+
+	_, err = clientConn.Write([]byte("data"))
+	require.NoError(t, err)
+	// a TCP FIN without the end-of-stream message, e.g. injected by an attacker
+	require.NoError(t, clientConn.(*conn).tcpConn.CloseWrite())
+	_, err = ioutil.ReadAll(res.conn)
+	assert.Equal(t, errTruncated, err)
+}
+
+func TestNoiseRejectsUnknownKeys(t *testing.T) {
+	server, client, other := genKeypair(t), genKeypair(t), genKeypair(t)
+	l := listen(t, server, map[string]string{"client1": client.public})
+	defer l.Close()
+
+	t.Run("unknown client key", func(t *testing.T) {
+		accepted := accept(l)
+		_, err := connecter(t, l, other, server.public).Connect(context.Background())
+		assert.Error(t, err)
+		assert.Error(t, (<-accepted).err)
+	})
+
+	t.Run("wrong server key", func(t *testing.T) {
+		accepted := accept(l)
+		_, err := connecter(t, l, client, other.public).Connect(context.Background())
+		assert.Error(t, err)
+		assert.Error(t, (<-accepted).err)
+	})
+
+	t.Run("handshake not confirmed", func(t *testing.T) {
+		accepted := accept(l)
+		static, err := ParsePrivateKey(client.private)
+		require.NoError(t, err)
+		serverPublicKey, err := ParsePublicKey(server.public)
+		require.NoError(t, err)
+		hs, err := noise.NewHandshakeState(handshakeConfig(true, static, serverPublicKey))
+		require.NoError(t, err)
+		msg, _, _, err := hs.WriteMessage(nil, nil)
+		require.NoError(t, err)
+
+		// e.g. a replayed first message
+		raw, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, writeMessage(raw, msg))
+		_, err = readMessage(raw)
+		require.NoError(t, err)
+		raw.Close()
+		assert.Error(t, (<-accepted).err)
+	})
+}
+
+func TestNoiseServeConfigValidation(t *testing.T) {
+	server, client := genKeypair(t), genKeypair(t)
+	for name, clients := range map[string]map[string]string{
+		"invalid identity":   {"invalid/identity": client.public},
+		"invalid public key": {"client1": "not a key"},
+		"duplicate key":      {"client1": client.public, "client2": client.public},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NoiseListenerFactoryFromConfig(nil, &config.NoiseServe{
+				Listen:     config.ListenAddresses{"127.0.0.1:0"},
+				PrivateKey: server.private,
+				Clients:    clients,
+			})
+			assert.Error(t, err)
+		})
+	}
+}
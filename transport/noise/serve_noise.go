@@ -0,0 +1,122 @@
+package noise
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+func NoiseListenerFactoryFromConfig(c *config.Global, in *config.NoiseServe) (transport.AuthenticatedListenerFactory, error) {
+	static, err := ParsePrivateKey(in.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'private_key'")
+	}
+
+	// key: public key
+	clients := make(map[string]string, len(in.Clients))
+	identities := make([]string, 0, len(in.Clients))
+	for identity, publicKey := range in.Clients {
+		if err := transport.ValidateClientIdentity(identity); err != nil {
+			return nil, errors.Wrapf(err, "unsuitable client identity %q", identity)
+		}
+		pk, err := ParsePublicKey(publicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse public key of client %q", identity)
+		}
+		if other, ok := clients[string(pk)]; ok {
+			return nil, errors.Errorf("clients %q and %q use the same public key", other, identity)
+		}
+		clients[string(pk)] = identity
+		identities = append(identities, identity)
+	}
+	clientNetworks, err := transport.ClientNetworksFromConfig(in.ClientNetworks, identities)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'client_networks'")
+	}
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'socket'")
+	}
+
+	lf := func() (transport.AuthenticatedListener, error) {
+		l, err := tcpsock.ListenAll(in.Listen, in.ListenFreeBind, socketOptions)
+		if err != nil {
+			return nil, err
+		}
+		return &noiseAuthListener{l, static, clients, clientNetworks, in.HandshakeTimeout}, nil
+	}
+	return lf, nil
+}
+
+type noiseAuthListener struct {
+	tcpsock.Listener
+	static           noise.DHKey
+	clients          map[string]string
+	clientNetworks   *transport.ClientNetworks
+	handshakeTimeout time.Duration
+}
+
+func (l *noiseAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	tcpConn, err := l.Listener.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	conn, identity, err := l.handshake(tcpConn)
+	if err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrapf(err, "noise handshake with %s", tcpConn.RemoteAddr())
+	}
+	return transport.NewAuthConn(conn, identity), nil
+}
+
+// handshake authenticates the client, which must complete the handshake within handshakeTimeout.
+func (l *noiseAuthListener) handshake(tcpConn *net.TCPConn) (_ *conn, identity string, _ error) {
+	if err := tcpConn.SetDeadline(time.Now().Add(l.handshakeTimeout)); err != nil {
+		return nil, "", errors.Wrap(err, "cannot set handshake deadline")
+	}
+	hs, err := noise.NewHandshakeState(handshakeConfig(false, l.static, nil))
+	if err != nil {
+		return nil, "", err
+	}
+	msg, err := readMessage(tcpConn)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, _, _, err := hs.ReadMessage(nil, msg); err != nil {
+		return nil, "", errors.Wrap(err, "client does not use the server's public key")
+	}
+	identity, ok := l.clients[string(hs.PeerStatic())]
+	if !ok {
+		return nil, "", errors.Errorf("unknown client public key %s", base64.StdEncoding.EncodeToString(hs.PeerStatic()))
+	}
+	if err := l.clientNetworks.Check(identity, tcpConn.RemoteAddr()); err != nil {
+		return nil, "", err
+	}
+
+	msg, recv, send, err := hs.WriteMessage(nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := writeMessage(tcpConn, msg); err != nil {
+		return nil, "", err
+	}
+	conn := newConn(tcpConn, send, recv)
+	if payload, err := conn.readTransportMessage(); err != nil {
+		return nil, "", errors.Wrap(err, "client did not confirm handshake")
+	} else if len(payload) != 0 {
+		return nil, "", errors.New("client did not confirm handshake")
+	}
+
+	if err := tcpConn.SetDeadline(time.Time{}); err != nil {
+		return nil, "", errors.Wrap(err, "cannot clear handshake deadline")
+	}
+	return conn, identity, nil
+}
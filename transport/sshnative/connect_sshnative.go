@@ -0,0 +1,108 @@
+package sshnative
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+type SSHConnecter struct {
+	Address      string
+	dialer       *tcpsock.Dialer
+	clientConfig *ssh.ClientConfig
+}
+
+func SSHConnecterFromConfig(in *config.SSHConnect) (*SSHConnecter, error) {
+	if in.Host == "" || in.User == "" || in.IdentityFile == "" || in.KnownHosts == "" {
+		return nil, errors.New("fields 'host', 'user', 'identity_file' and 'known_hosts' must be specified")
+	}
+
+	keyPEM, err := ioutil.ReadFile(in.IdentityFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read identity file")
+	}
+	signer, err := ssh.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse identity file")
+	}
+	if in.Certificate != "" {
+		if signer, err = certSignerFromFile(in.Certificate, ssh.UserCert, signer); err != nil {
+			return nil, errors.Wrap(err, "invalid field `certificate`")
+		}
+	}
+
+	hostKeyCallback, err := knownhosts.New(in.KnownHosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse known_hosts file")
+	}
+	hasCA, err := knownHostsHasCertAuthority(in.KnownHosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read known_hosts file")
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:            in.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         in.DialTimeout,
+	}
+	if !hasCA {
+		clientConfig.HostKeyAlgorithms = plainHostKeyAlgos
+	}
+	dialer, err := tcpsock.NewDialer(in.DialTimeout, in.Proxy, tcpsock.SocketOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot configure field `proxy`")
+	}
+	address := net.JoinHostPort(in.Host, strconv.Itoa(int(in.Port)))
+	return &SSHConnecter{address, dialer, clientConfig}, nil
+}
+
+func (c *SSHConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
+	conn, err := c.dialer.DialContext(dialCtx, c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// ssh.NewClientConn does not take a context
+	if dl, ok := dialCtx.Deadline(); ok {
+		if err := conn.SetDeadline(dl); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "cannot set handshake deadline")
+		}
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.Address, c.clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "ssh handshake")
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		// the server must not open channels
+		for ch := range chans {
+			_ = ch.Reject(ssh.Prohibited, "no channels accepted by client")
+		}
+	}()
+
+	channel, chReqs, err := sshConn.OpenChannel(channelType, nil)
+	if err != nil {
+		sshConn.Close()
+		return nil, errors.Wrap(err, "cannot open channel")
+	}
+	go ssh.DiscardRequests(chReqs)
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		sshConn.Close()
+		return nil, errors.Wrap(err, "cannot clear handshake deadline")
+	}
+	return newChannelWire(sshConn, channel), nil
+}
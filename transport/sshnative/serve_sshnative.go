@@ -0,0 +1,156 @@
+package sshnative
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+// the key in ssh.Permissions.Extensions under which the client identity is stored
+const permissionsExtensionIdentity = "zrepl-client-identity"
+
+func SSHListenerFactoryFromConfig(c *config.Global, in *config.SSHServe) (transport.AuthenticatedListenerFactory, error) {
+	if in.HostKey == "" {
+		return nil, errors.New("field 'host_key' must be specified")
+	}
+
+	hostKeyPEM, err := ioutil.ReadFile(in.HostKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read host key file")
+	}
+	hostKey, err := ssh.ParsePrivateKey(hostKeyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse host key file")
+	}
+	var hostCert ssh.Signer
+	if in.HostCertificate != "" {
+		if hostCert, err = certSignerFromFile(in.HostCertificate, ssh.HostCert, hostKey); err != nil {
+			return nil, errors.Wrap(err, "invalid field 'host_certificate'")
+		}
+	}
+
+	if len(in.Clients) == 0 && in.UserCA == nil {
+		return nil, errors.New("at least one of fields 'clients' and 'user_ca' must be specified")
+	}
+	var ca *userCA
+	if in.UserCA != nil {
+		if ca, err = userCAFromConfig(in.UserCA); err != nil {
+			return nil, errors.Wrap(err, "invalid field 'user_ca'")
+		}
+	}
+
+	// key: ssh.PublicKey.Marshal()
+	clients := make(map[string]string, len(in.Clients))
+	for i, client := range in.Clients {
+		if err := transport.ValidateClientIdentity(client.Identity); err != nil {
+			return nil, errors.Wrapf(err, "unsuitable identity of client #%d %q", i, client.Identity)
+		}
+		pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(client.PublicKey))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse public key of client %q", client.Identity)
+		}
+		if other, ok := clients[string(pk.Marshal())]; ok {
+			return nil, errors.Errorf("clients %q and %q use the same public key", other, client.Identity)
+		}
+		clients[string(pk.Marshal())] = client.Identity
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			identity, ok := clients[string(key.Marshal())]
+			if cert, isCert := key.(*ssh.Certificate); isCert && ca != nil {
+				var err error
+				if identity, err = ca.authenticate(conn, cert); err != nil {
+					return nil, err
+				}
+			} else if !ok {
+				return nil, fmt.Errorf("unknown public key %s", ssh.FingerprintSHA256(key))
+			}
+			return &ssh.Permissions{
+				Extensions: map[string]string{permissionsExtensionIdentity: identity},
+			}, nil
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+	if hostCert != nil {
+		serverConfig.AddHostKey(hostCert)
+	}
+
+	lf := func() (transport.AuthenticatedListener, error) {
+		l, err := tcpsock.ListenAll(in.Listen, in.ListenFreeBind, tcpsock.SocketOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &sshAuthListener{l, serverConfig, in.HandshakeTimeout}, nil
+	}
+	return lf, nil
+}
+
+type sshAuthListener struct {
+	tcpsock.Listener
+	serverConfig     *ssh.ServerConfig
+	handshakeTimeout time.Duration
+}
+
+func (l *sshAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	nc, err := l.Listener.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	wire, identity, err := l.handshake(nc)
+	if err != nil {
+		nc.Close()
+		return nil, errors.Wrapf(err, "ssh handshake with %s", nc.RemoteAddr())
+	}
+	return transport.NewAuthConn(wire, identity), nil
+}
+
+// handshake authenticates the client and waits for it to open the transport channel.
+// Both must happen within handshakeTimeout.
+func (l *sshAuthListener) handshake(nc net.Conn) (_ *channelWire, identity string, _ error) {
+	if err := nc.SetDeadline(time.Now().Add(l.handshakeTimeout)); err != nil {
+		return nil, "", errors.Wrap(err, "cannot set handshake deadline")
+	}
+	sshConn, chans, reqs, err := ssh.NewServerConn(nc, l.serverConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	go ssh.DiscardRequests(reqs)
+
+	newChan, ok := <-chans
+	if !ok {
+		return nil, "", errors.New("connection closed before channel was opened")
+	}
+	if newChan.ChannelType() != channelType {
+		_ = newChan.Reject(ssh.UnknownChannelType, "only zrepl transport channels are supported")
+		sshConn.Close()
+		return nil, "", errors.Errorf("client opened unsupported channel type %q", newChan.ChannelType())
+	}
+	channel, chReqs, err := newChan.Accept()
+	if err != nil {
+		sshConn.Close()
+		return nil, "", errors.Wrap(err, "cannot accept channel")
+	}
+	go ssh.DiscardRequests(chReqs)
+	go func() {
+		// one channel per connection
+		for ch := range chans {
+			_ = ch.Reject(ssh.Prohibited, "only one channel per connection")
+		}
+	}()
+
+	if err := nc.SetDeadline(time.Time{}); err != nil {
+		sshConn.Close()
+		return nil, "", errors.Wrap(err, "cannot clear handshake deadline")
+	}
+	return newChannelWire(sshConn, channel), sshConn.Permissions.Extensions[permissionsExtensionIdentity], nil
+}
@@ -0,0 +1,151 @@
+package sshnative
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+// certSignerFromFile returns a signer that presents the OpenSSH certificate in path for signer's key.
+func certSignerFromFile(path string, certType uint32, signer ssh.Signer) (ssh.Signer, error) {
+	certData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read certificate file")
+	}
+	pk, _, _, _, err := ssh.ParseAuthorizedKey(certData)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse certificate file")
+	}
+	cert, ok := pk.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("certificate file contains a plain %s public key", pk.Type())
+	}
+	if cert.CertType != certType {
+		return nil, errors.Errorf("certificate file contains a %s certificate", certTypeString(cert.CertType))
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "certificate does not match private key")
+	}
+	return certSigner, nil
+}
+
+func certTypeString(certType uint32) string {
+	switch certType {
+	case ssh.UserCert:
+		return "user"
+	case ssh.HostCert:
+		return "host"
+	default:
+		return fmt.Sprintf("unknown (%d)", certType)
+	}
+}
+
+// plainHostKeyAlgos are the host key algorithms supported by x/crypto/ssh, without the certificate algorithms.
+// The SHA-2 signature algorithms for RSA host keys (RFC 8332) precede ssh-rsa because OpenSSH 8.8 and newer disable the latter by default.
+var plainHostKeyAlgos = []string{
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.SigAlgoRSASHA2512, ssh.SigAlgoRSASHA2256,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// knownHostsHasCertAuthority reports whether the known_hosts file in path contains @cert-authority lines.
+//
+// Like OpenSSH, the client only asks for host certificates if it can verify them.
+// Otherwise a server that presents both a host certificate and the plain host key
+// would fail host key verification for clients that only know the plain host key.
+func knownHostsHasCertAuthority(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if bytes.HasPrefix(bytes.TrimSpace(s.Bytes()), []byte("@cert-authority")) {
+			return true, nil
+		}
+	}
+	return false, s.Err()
+}
+
+// userCA authenticates clients with OpenSSH user certificates.
+type userCA struct {
+	checker    *ssh.CertChecker
+	identities []string
+}
+
+func userCAFromConfig(in *config.SSHServeUserCA) (*userCA, error) {
+	if len(in.PublicKeys) == 0 {
+		return nil, errors.New("field 'public_keys' must not be empty")
+	}
+	if len(in.Identities) == 0 {
+		return nil, errors.New("field 'identities' must not be empty")
+	}
+
+	// key: ssh.PublicKey.Marshal()
+	cas := make(map[string]bool, len(in.PublicKeys))
+	for i, s := range in.PublicKeys {
+		pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse public key #%d", i)
+		}
+		cas[string(pk.Marshal())] = true
+	}
+
+	revoked := make(map[string]bool)
+	if in.RevokedKeys != "" {
+		data, err := ioutil.ReadFile(in.RevokedKeys)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read revoked keys file")
+		}
+		for len(bytes.TrimSpace(data)) > 0 {
+			var pk ssh.PublicKey
+			pk, _, _, data, err = ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot parse revoked keys file")
+			}
+			revoked[string(pk.Marshal())] = true
+		}
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return cas[string(auth.Marshal())] && !revoked[string(auth.Marshal())]
+		},
+		IsRevoked: func(cert *ssh.Certificate) bool {
+			return revoked[string(cert.Key.Marshal())]
+		},
+	}
+	return &userCA{checker, in.Identities}, nil
+}
+
+// authenticate checks cert and returns the client identity, which is the user name of conn.
+func (ca *userCA) authenticate(conn ssh.ConnMetadata, cert *ssh.Certificate) (identity string, _ error) {
+	// x/crypto/ssh considers certificates without principals valid for all users
+	if len(cert.ValidPrincipals) == 0 {
+		return "", errors.Errorf("certificate %q has no principals", cert.KeyId)
+	}
+	if _, err := ca.checker.Authenticate(conn, cert); err != nil {
+		return "", errors.Wrapf(err, "certificate %q", cert.KeyId)
+	}
+	identity = conn.User()
+	if err := transport.ValidateClientIdentity(identity); err != nil {
+		return "", errors.Wrapf(err, "unsuitable identity %q", identity)
+	}
+	for _, pattern := range ca.identities {
+		if transport.IdentityMatches(pattern, identity) {
+			return identity, nil
+		}
+	}
+	return "", errors.Errorf("identity %q is not in field 'identities' of 'user_ca'", identity)
+}
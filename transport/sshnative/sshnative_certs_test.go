@@ -0,0 +1,274 @@
+package sshnative
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type testCA struct {
+	signer ssh.Signer
+}
+
+func genCA(t *testing.T) testCA {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return testCA{signer}
+}
+
+func (ca testCA) authorizedKey() string {
+	return string(ssh.MarshalAuthorizedKey(ca.signer.PublicKey()))
+}
+
+// sign writes a certificate for key to path
+func (ca testCA) sign(t *testing.T, path string, key testKey, certType uint32, principals ...string) {
+	cert := &ssh.Certificate{
+		Key:             key.public,
+		CertType:        certType,
+		KeyId:           filepath.Base(path),
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca.signer))
+	require.NoError(t, ioutil.WriteFile(path, ssh.MarshalAuthorizedKey(cert), 0600))
+}
+
+func listenCA(t *testing.T, in *config.SSHServe) transport.AuthenticatedListener {
+	in.Listen = config.ListenAddresses{"127.0.0.1:0"}
+	in.HandshakeTimeout = 10 * time.Second
+	lf, err := SSHListenerFactoryFromConfig(nil, in)
+	require.NoError(t, err)
+	l, err := lf()
+	require.NoError(t, err)
+	return l
+}
+
+// connectAndAccept returns the client identity of the accepted connection or the error of either side
+func connectAndAccept(t *testing.T, l transport.AuthenticatedListener, in *config.SSHConnect) (string, error) {
+	addr := l.Addr().(*net.TCPAddr)
+	in.Host, in.Port, in.DialTimeout = addr.IP.String(), uint16(addr.Port), 10*time.Second
+	c, err := SSHConnecterFromConfig(in)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	type acceptRes struct {
+		conn *transport.AuthConn
+		err  error
+	}
+	accepted := make(chan acceptRes, 1)
+	go func() {
+		conn, err := l.Accept(ctx)
+		accepted <- acceptRes{conn, err}
+	}()
+	client, err := c.Connect(ctx)
+	res := <-accepted
+	if res.err != nil {
+		return "", res.err
+	}
+	defer res.conn.Close()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	return res.conn.ClientIdentity(), nil
+}
+
+func TestSSHNativeUserCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-sshnative-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := genCA(t)
+	hostKey := genKey(t, dir, "host_key")
+	clientKey := genKey(t, dir, "client_key")
+	revokedKey := genKey(t, dir, "revoked_key")
+	ca.sign(t, clientKey.path+"-cert.pub", clientKey, ssh.UserCert, "office-a", "office-b", "other")
+	ca.sign(t, revokedKey.path+"-cert.pub", revokedKey, ssh.UserCert, "office-a")
+	ca.sign(t, filepath.Join(dir, "no_principals-cert.pub"), clientKey, ssh.UserCert)
+	ca.sign(t, filepath.Join(dir, "host-cert.pub"), clientKey, ssh.HostCert, "office-a")
+	otherCA := genCA(t)
+	otherCA.sign(t, filepath.Join(dir, "other_ca-cert.pub"), clientKey, ssh.UserCert, "office-a")
+	revokedKeys := filepath.Join(dir, "revoked_keys")
+	require.NoError(t, ioutil.WriteFile(revokedKeys, ssh.MarshalAuthorizedKey(revokedKey.public), 0600))
+
+	l := listenCA(t, &config.SSHServe{
+		HostKey: hostKey.path,
+		UserCA: &config.SSHServeUserCA{
+			PublicKeys:  []string{ca.authorizedKey()},
+			Identities:  []string{"office-*"},
+			RevokedKeys: revokedKeys,
+		},
+	})
+	defer l.Close()
+	addr := l.Addr().(*net.TCPAddr)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, hostKey.public)
+	require.NoError(t, ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	tcs := []struct {
+		name      string
+		user      string
+		key, cert string
+		identity  string // empty if the connection must be rejected
+	}{
+		{"principal", "office-a", clientKey.path, clientKey.path + "-cert.pub", "office-a"},
+		{"other principal", "office-b", clientKey.path, clientKey.path + "-cert.pub", "office-b"},
+		{"user not a principal", "office-c", clientKey.path, clientKey.path + "-cert.pub", ""},
+		{"principal not in identities", "other", clientKey.path, clientKey.path + "-cert.pub", ""},
+		{"no certificate", "office-a", clientKey.path, "", ""},
+		{"revoked key", "office-a", revokedKey.path, revokedKey.path + "-cert.pub", ""},
+		{"no principals", "office-a", clientKey.path, filepath.Join(dir, "no_principals-cert.pub"), ""},
+		{"host certificate", "office-a", clientKey.path, filepath.Join(dir, "host-cert.pub"), ""},
+		{"unknown CA", "office-a", clientKey.path, filepath.Join(dir, "other_ca-cert.pub"), ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &config.SSHConnect{
+				User:         tc.user,
+				IdentityFile: tc.key,
+				KnownHosts:   knownHosts,
+			}
+			if tc.name == "host certificate" {
+				// rejected by the client already
+				in.Host, in.DialTimeout = "127.0.0.1", time.Second
+				in.Certificate = tc.cert
+				_, err := SSHConnecterFromConfig(in)
+				assert.Error(t, err)
+				return
+			}
+			in.Certificate = tc.cert
+			identity, err := connectAndAccept(t, l, in)
+			if tc.identity == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.identity, identity)
+		})
+	}
+
+	t.Run("certificate for other key", func(t *testing.T) {
+		_, err := SSHConnecterFromConfig(&config.SSHConnect{
+			Host:         "127.0.0.1",
+			User:         "office-a",
+			IdentityFile: revokedKey.path,
+			Certificate:  clientKey.path + "-cert.pub",
+			KnownHosts:   knownHosts,
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestSSHNativeUserCertificatesAndClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-sshnative-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := genCA(t)
+	hostKey := genKey(t, dir, "host_key")
+	clientKey := genKey(t, dir, "client_key")
+	certKey := genKey(t, dir, "cert_key")
+	ca.sign(t, certKey.path+"-cert.pub", certKey, ssh.UserCert, "fleet-1")
+
+	l := listenCA(t, &config.SSHServe{
+		HostKey: hostKey.path,
+		Clients: []*config.SSHServeClient{
+			{Identity: "client1", PublicKey: string(ssh.MarshalAuthorizedKey(clientKey.public))},
+		},
+		UserCA: &config.SSHServeUserCA{
+			PublicKeys: []string{ca.authorizedKey()},
+			Identities: []string{"fleet-*"},
+		},
+	})
+	defer l.Close()
+	addr := l.Addr().(*net.TCPAddr)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, hostKey.public)
+	require.NoError(t, ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	identity, err := connectAndAccept(t, l, &config.SSHConnect{User: "zrepl", IdentityFile: clientKey.path, KnownHosts: knownHosts})
+	require.NoError(t, err)
+	assert.Equal(t, "client1", identity)
+
+	identity, err = connectAndAccept(t, l, &config.SSHConnect{User: "fleet-1", IdentityFile: certKey.path, Certificate: certKey.path + "-cert.pub", KnownHosts: knownHosts})
+	require.NoError(t, err)
+	assert.Equal(t, "fleet-1", identity)
+}
+
+func TestSSHNativeHostCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-sshnative-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := genCA(t)
+	hostKey := genKey(t, dir, "host_key")
+	clientKey := genKey(t, dir, "client_key")
+	ca.sign(t, hostKey.path+"-cert.pub", hostKey, ssh.HostCert, "127.0.0.1")
+	ca.sign(t, filepath.Join(dir, "wrong_principal-cert.pub"), hostKey, ssh.HostCert, "prod.example.com")
+
+	listen := func(hostCert string) transport.AuthenticatedListener {
+		return listenCA(t, &config.SSHServe{
+			HostKey:         hostKey.path,
+			HostCertificate: hostCert,
+			Clients: []*config.SSHServeClient{
+				{Identity: "client1", PublicKey: string(ssh.MarshalAuthorizedKey(clientKey.public))},
+			},
+		})
+	}
+	caKnownHosts := filepath.Join(dir, "known_hosts_ca")
+	writeCAKnownHosts := func(l transport.AuthenticatedListener) {
+		// non-default ports must be part of the pattern, but wildcards are allowed
+		port := l.Addr().(*net.TCPAddr).Port
+		line := fmt.Sprintf("@cert-authority [127.0.0.*]:%d %s", port, ca.authorizedKey())
+		require.NoError(t, ioutil.WriteFile(caKnownHosts, []byte(line), 0600))
+	}
+
+	l := listen(hostKey.path + "-cert.pub")
+	writeCAKnownHosts(l)
+	identity, err := connectAndAccept(t, l, &config.SSHConnect{User: "zrepl", IdentityFile: clientKey.path, KnownHosts: caKnownHosts})
+	require.NoError(t, err)
+	assert.Equal(t, "client1", identity)
+
+	// clients that only know the plain host key can still connect
+	addr := l.Addr().(*net.TCPAddr)
+	plainKnownHosts := filepath.Join(dir, "known_hosts_plain")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, hostKey.public)
+	require.NoError(t, ioutil.WriteFile(plainKnownHosts, []byte(line+"\n"), 0600))
+	_, err = connectAndAccept(t, l, &config.SSHConnect{User: "zrepl", IdentityFile: clientKey.path, KnownHosts: plainKnownHosts})
+	assert.NoError(t, err)
+	l.Close()
+
+	// the certificate's principals must contain the host
+	l = listen(filepath.Join(dir, "wrong_principal-cert.pub"))
+	defer l.Close()
+	writeCAKnownHosts(l)
+	_, err = connectAndAccept(t, l, &config.SSHConnect{User: "zrepl", IdentityFile: clientKey.path, KnownHosts: caKnownHosts})
+	assert.Error(t, err)
+
+	// the host certificate must be for the host key
+	ca.sign(t, clientKey.path+"-cert.pub", clientKey, ssh.HostCert, "127.0.0.1")
+	_, err = SSHListenerFactoryFromConfig(nil, &config.SSHServe{
+		Listen:          config.ListenAddresses{"127.0.0.1:0"},
+		HostKey:         hostKey.path,
+		HostCertificate: clientKey.path + "-cert.pub",
+		Clients:         []*config.SSHServeClient{{Identity: "client1", PublicKey: ca.authorizedKey()}},
+	})
+	assert.Error(t, err)
+}
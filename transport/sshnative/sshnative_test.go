@@ -0,0 +1,226 @@
+package sshnative
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type testKey struct {
+	path   string // private key in OpenSSH format
+	public ssh.PublicKey
+}
+
+func genKey(t *testing.T, dir, name string) testKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	block := &pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: marshalED25519PrivateKey(priv, pub)}
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return testKey{path, sshPub}
+}
+
+// marshalED25519PrivateKey encodes an unencrypted openssh-key-v1 private key,
+// which x/crypto/ssh can parse but not produce.
+func marshalED25519PrivateKey(priv ed25519.PrivateKey, pub ed25519.PublicKey) []byte {
+	pubKey := struct {
+		KeyType string
+		Pub     []byte
+	}{ssh.KeyAlgoED25519, pub}
+	privKeys := struct {
+		Check1, Check2 uint32
+		KeyType        string
+		Pub, Priv      []byte
+		Comment        string
+		Pad            []byte `ssh:"rest"`
+	}{0x1234, 0x1234, ssh.KeyAlgoED25519, pub, priv, "", nil}
+	for i := 0; (len(ssh.Marshal(privKeys)))%8 != 0; i++ {
+		privKeys.Pad = append(privKeys.Pad, byte(i+1))
+	}
+	w := struct {
+		CipherName, KdfName, KdfOpts string
+		NumKeys                      uint32
+		PubKey, PrivKeyBlock         []byte
+	}{"none", "none", "", 1, ssh.Marshal(pubKey), ssh.Marshal(privKeys)}
+	return append([]byte("openssh-key-v1\x00"), ssh.Marshal(w)...)
+}
+
+type testSetup struct {
+	listener  transport.AuthenticatedListener
+	dir       string
+	hostKey   testKey
+	clientKey testKey
+}
+
+func setup(t *testing.T) *testSetup {
+	dir, err := ioutil.TempDir("", "zrepl-sshnative-test")
+	require.NoError(t, err)
+	s := &testSetup{
+		dir:       dir,
+		hostKey:   genKey(t, dir, "host_key"),
+		clientKey: genKey(t, dir, "client_key"),
+	}
+	lf, err := SSHListenerFactoryFromConfig(nil, &config.SSHServe{
+		Listen:  config.ListenAddresses{"127.0.0.1:0"},
+		HostKey: s.hostKey.path,
+		Clients: []*config.SSHServeClient{
+			{Identity: "client1", PublicKey: string(ssh.MarshalAuthorizedKey(s.clientKey.public))},
+		},
+		HandshakeTimeout: 10 * time.Second,
+	})
+	require.NoError(t, err)
+	s.listener, err = lf()
+	require.NoError(t, err)
+	return s
+}
+
+func (s *testSetup) Close() {
+	s.listener.Close()
+	os.RemoveAll(s.dir)
+}
+
+func (s *testSetup) connecter(t *testing.T, identityFile string) *SSHConnecter {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	knownHosts := filepath.Join(s.dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, s.hostKey.public)
+	require.NoError(t, ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+	c, err := SSHConnecterFromConfig(&config.SSHConnect{
+		Host:         addr.IP.String(),
+		Port:         uint16(addr.Port),
+		User:         "zrepl",
+		IdentityFile: identityFile,
+		KnownHosts:   knownHosts,
+		DialTimeout:  10 * time.Second,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestSSHNativeConnectAndServe(t *testing.T) {
+	s := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	type acceptRes struct {
+		conn *transport.AuthConn
+		err  error
+	}
+	accepted := make(chan acceptRes)
+	go func() {
+		conn, err := s.listener.Accept(ctx)
+		accepted <- acceptRes{conn, err}
+	}()
+
+	client, err := s.connecter(t, s.clientKey.path).Connect(ctx)
+	require.NoError(t, err)
+	defer client.Close()
+	res := <-accepted
+	require.NoError(t, res.err)
+	server := res.conn
+	defer server.Close()
+	assert.Equal(t, "client1", server.ClientIdentity())
+
+	// client => server, then half-close
+	go func() {
+		_, err := client.Write([]byte("ping"))
+		assert.NoError(t, err)
+		assert.NoError(t, client.CloseWrite())
+	}()
+	buf, err := ioutil.ReadAll(server)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	// server => client still works after the client's half-close
+	go func() {
+		_, err := server.Write([]byte("pong"))
+		assert.NoError(t, err)
+		assert.NoError(t, server.CloseWrite())
+	}()
+	buf, err = ioutil.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+}
+
+func TestSSHNativeReadDeadline(t *testing.T) {
+	s := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	go func() {
+		conn, err := s.listener.Accept(ctx)
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(1 * time.Second)
+		}
+	}()
+	client, err := s.connecter(t, s.clientKey.path).Connect(ctx)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = client.Read(make([]byte, 1))
+	require.Error(t, err)
+	netErr, ok := err.(net.Error)
+	require.True(t, ok, "%T", err)
+	assert.True(t, netErr.Timeout())
+}
+
+func TestSSHNativeUnknownClientKey(t *testing.T) {
+	s := setup(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	acceptErr := make(chan error)
+	go func() {
+		_, err := s.listener.Accept(ctx)
+		acceptErr <- err
+	}()
+
+	unknown := genKey(t, s.dir, "unknown_key")
+	_, err := s.connecter(t, unknown.path).Connect(ctx)
+	assert.Error(t, err)
+	assert.Error(t, <-acceptErr)
+}
+
+func TestSSHNativeServeConfigValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-sshnative-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	hostKey := genKey(t, dir, "host_key")
+	clientKey := genKey(t, dir, "client_key")
+	authorizedKey := string(ssh.MarshalAuthorizedKey(clientKey.public))
+
+	for i, clients := range [][]*config.SSHServeClient{
+		nil, // neither clients nor user_ca
+		{{Identity: "invalid/identity", PublicKey: authorizedKey}},
+		{{Identity: "client1", PublicKey: "not a key"}},
+		{{Identity: "client1", PublicKey: authorizedKey}, {Identity: "client2", PublicKey: authorizedKey}},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := SSHListenerFactoryFromConfig(nil, &config.SSHServe{
+				Listen:  config.ListenAddresses{"127.0.0.1:0"},
+				HostKey: hostKey.path,
+				Clients: clients,
+			})
+			assert.Error(t, err)
+		})
+	}
+}
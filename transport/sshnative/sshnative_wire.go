@@ -0,0 +1,83 @@
+// Package sshnative implements a transport that runs the replication protocol
+// over an SSH channel, with a built-in SSH client and server (golang.org/x/crypto/ssh).
+// Unlike the ssh+stdinserver transport, it requires neither the ssh binary nor
+// `zrepl stdinserver` forced commands in authorized_keys.
+package sshnative
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// the type of the SSH channel that carries the protocol,
+// one channel per SSH connection
+const channelType = "zrepl-transport@zrepl.github.io"
+
+// channelWire adapts an SSH channel to transport.Wire.
+//
+// SSH channels support neither deadlines nor net.Conn's addresses.
+// The user therefore reads from and writes to one end of a net.Pipe per direction,
+// which support deadlines, and goroutines copy between the other ends and the channel.
+// Closing the write pipe is CloseWrite: once the copying goroutine drained it,
+// it sends EOF on the channel.
+type channelWire struct {
+	conn    ssh.Conn // closed together with the wire
+	channel ssh.Channel
+
+	r, rPeer net.Conn // channel => rPeer => r => Read
+	w, wPeer net.Conn // Write => w => wPeer => channel
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newChannelWire(conn ssh.Conn, channel ssh.Channel) *channelWire {
+	c := &channelWire{conn: conn, channel: channel}
+	c.r, c.rPeer = net.Pipe()
+	c.w, c.wPeer = net.Pipe()
+	go func() {
+		// EOF or error on the channel => EOF for Read
+		_, _ = io.Copy(c.rPeer, c.channel)
+		c.rPeer.Close()
+	}()
+	go func() {
+		_, err := io.Copy(c.channel, c.wPeer)
+		if err == nil { // CloseWrite
+			_ = c.channel.CloseWrite()
+		}
+		c.wPeer.Close()
+	}()
+	return c
+}
+
+func (c *channelWire) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *channelWire) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c *channelWire) CloseWrite() error { return c.w.Close() }
+
+func (c *channelWire) Close() error {
+	c.closeOnce.Do(func() {
+		c.r.Close()
+		c.w.Close()
+		c.channel.Close()
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
+
+func (c *channelWire) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *channelWire) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *channelWire) SetDeadline(t time.Time) error {
+	if err := c.r.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.w.SetWriteDeadline(t)
+}
+
+func (c *channelWire) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *channelWire) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
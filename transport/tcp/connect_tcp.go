@@ -2,29 +2,31 @@ package tcp
 
 import (
 	"context"
-	"net"
+
+	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
 )
 
 type TCPConnecter struct {
 	Address string
-	dialer  net.Dialer
+	dialer  *tcpsock.Dialer
 }
 
 func TCPConnecterFromConfig(in *config.TCPConnect) (*TCPConnecter, error) {
-	dialer := net.Dialer{
-		Timeout: in.DialTimeout,
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field `socket`")
+	}
+	dialer, err := tcpsock.NewDialer(in.DialTimeout, in.Proxy, socketOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot configure field `proxy`")
 	}
-
 	return &TCPConnecter{in.Address, dialer}, nil
 }
 
 func (c *TCPConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
-	conn, err := c.dialer.DialContext(dialCtx, "tcp", c.Address)
-	if err != nil {
-		return nil, err
-	}
-	return conn.(*net.TCPConn), nil
+	return c.dialer.DialContext(dialCtx, c.Address)
 }
@@ -16,19 +16,32 @@ func TCPListenerFactoryFromConfig(c *config.Global, in *config.TCPServe) (transp
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot parse client IP map")
 	}
+	identities := make([]string, 0, len(in.Clients))
+	for _, ident := range in.Clients {
+		identities = append(identities, ident)
+	}
+	clientNetworks, err := transport.ClientNetworksFromConfig(in.ClientNetworks, identities)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'client_networks'")
+	}
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'socket'")
+	}
 	lf := func() (transport.AuthenticatedListener, error) {
-		l, err := tcpsock.Listen(in.Listen, in.ListenFreeBind)
+		l, err := tcpsock.ListenAll(in.Listen, in.ListenFreeBind, socketOptions)
 		if err != nil {
 			return nil, err
 		}
-		return &TCPAuthListener{l, clientMap}, nil
+		return &TCPAuthListener{l, clientMap, clientNetworks}, nil
 	}
 	return lf, nil
 }
 
 type TCPAuthListener struct {
-	*net.TCPListener
-	clientMap *ipMap
+	tcpsock.Listener
+	clientMap      *ipMap
+	clientNetworks *transport.ClientNetworks // keyed by identity as configured, i.e. before '*' expansion
 }
 
 func (f *TCPAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
@@ -38,7 +51,7 @@ func (f *TCPAuthListener) Accept(ctx context.Context) (*transport.AuthConn, erro
 		<-ctx.Done()
 		cancel()
 	}()
-	nc, err := f.TCPListener.AcceptTCP()
+	nc, err := f.Listener.AcceptTCP()
 	if err != nil {
 		return nil, err
 	}
@@ -46,11 +59,17 @@ func (f *TCPAuthListener) Accept(ctx context.Context) (*transport.AuthConn, erro
 		IP:   nc.RemoteAddr().(*net.TCPAddr).IP,
 		Zone: nc.RemoteAddr().(*net.TCPAddr).Zone,
 	}
-	clientIdent, err := f.clientMap.Get(clientAddr)
+	entry, err := f.clientMap.lookup(clientAddr)
 	if err != nil {
 		transport.GetLogger(ctx).WithField("ipaddr", clientAddr).Error("client IP not in client map")
 		nc.Close()
 		return nil, err
 	}
+	if err := f.clientNetworks.Check(entry.ident, nc.RemoteAddr()); err != nil {
+		transport.GetLogger(ctx).WithField("ipaddr", clientAddr).WithError(err).Error("client not in allowed networks")
+		nc.Close()
+		return nil, err
+	}
+	clientIdent := zfsDatasetPathComponentCompatibleRepresentation(entry.ident, clientAddr)
 	return transport.NewAuthConn(nc, clientIdent), nil
 }
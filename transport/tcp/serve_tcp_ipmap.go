@@ -43,15 +43,24 @@ func ipMapFromConfig(clients map[string]string) (*ipMap, error) {
 }
 
 func (m *ipMap) Get(ipAddr *net.IPAddr) (string, error) {
+	e, err := m.lookup(ipAddr)
+	if err != nil {
+		return "", err
+	}
+	return zfsDatasetPathComponentCompatibleRepresentation(e.ident, ipAddr), nil
+}
+
+// lookup returns the most specific entry that matches ipAddr
+func (m *ipMap) lookup(ipAddr *net.IPAddr) (*ipMapEntry, error) {
 	for _, e := range m.entries {
 		if e.zone != ipAddr.Zone {
 			continue
 		}
 		if e.subnet.Contains(ipAddr.IP) {
-			return zfsDatasetPathComponentCompatibleRepresentation(e.ident, ipAddr), nil
+			return e, nil
 		}
 	}
-	return "", errors.Errorf("no identity mapping for client IP: %s%%%s", ipAddr.IP, ipAddr.Zone)
+	return nil, errors.Errorf("no identity mapping for client IP: %s%%%s", ipAddr.IP, ipAddr.Zone)
 }
 
 var ipv6FullySpecifiedMask = bytes.Repeat([]byte{0xff}, net.IPv6len)
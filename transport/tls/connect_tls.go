@@ -3,54 +3,76 @@ package tls
 import (
 	"context"
 	"crypto/tls"
-	"net"
+	"sync"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
 	"github.com/zrepl/zrepl/tlsconf"
 	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
 )
 
 type TLSConnecter struct {
-	Address   string
-	dialer    net.Dialer
-	tlsConfig *tls.Config
+	Address  string
+	dialer   *tcpsock.Dialer
+	serverCN string
+	certs    *reloadableCertificates
+
+	tlsConfigMtx   sync.Mutex
+	tlsConfigCerts *certificates // the certificates tlsConfig was built from
+	tlsConfig      *tls.Config
 }
 
 func TLSConnecterFromConfig(in *config.TLSConnect) (*TLSConnecter, error) {
-	dialer := net.Dialer{
-		Timeout: in.DialTimeout,
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field `socket`")
+	}
+	dialer, err := tcpsock.NewDialer(in.DialTimeout, in.Proxy, socketOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot configure field `proxy`")
 	}
 
 	if fakeCertificateLoading {
-		return &TLSConnecter{in.Address, dialer, nil}, nil
+		return &TLSConnecter{Address: in.Address, dialer: dialer}, nil
 	}
 
-	ca, err := tlsconf.ParseCAFile(in.Ca)
+	certs, err := newReloadableCertificates(certificateFiles{CA: in.Ca, Cert: in.Cert, Key: in.Key}, 0)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse ca file")
+		return nil, err
 	}
-
-	cert, err := tls.LoadX509KeyPair(in.Cert, in.Key)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse cert/key pair")
+	c := &TLSConnecter{Address: in.Address, dialer: dialer, serverCN: in.ServerCN, certs: certs}
+	if _, err := c.getTLSConfig(); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	tlsConfig, err := tlsconf.ClientAuthClient(in.ServerCN, ca, cert)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot build tls config")
+// getTLSConfig returns a tls.Config for the current certificates.
+func (c *TLSConnecter) getTLSConfig() (*tls.Config, error) {
+	c.tlsConfigMtx.Lock()
+	defer c.tlsConfigMtx.Unlock()
+	certs := c.certs.get()
+	if certs != c.tlsConfigCerts {
+		tlsConfig, err := tlsconf.ClientAuthClient(c.serverCN, certs.ca, certs.cert)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build tls config")
+		}
+		c.tlsConfig, c.tlsConfigCerts = tlsConfig, certs
 	}
-
-	return &TLSConnecter{in.Address, dialer, tlsConfig}, nil
+	return c.tlsConfig, nil
 }
 
 func (c *TLSConnecter) Connect(dialCtx context.Context) (transport.Wire, error) {
-	conn, err := c.dialer.DialContext(dialCtx, "tcp", c.Address)
+	tlsConfig, err := c.getTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, err := c.dialer.DialContext(dialCtx, c.Address)
 	if err != nil {
 		return nil, err
 	}
-	tcpConn := conn.(*net.TCPConn)
-	tlsConn := tls.Client(conn, c.tlsConfig)
-	return newWireAdaptor(tlsConn, tcpConn), nil
+	tlsConn := tls.Client(tcpConn, tlsConfig)
+	return newWireAdaptor(tlsConn, tcpConn.TCPConn), nil
 }
@@ -3,7 +3,9 @@ package tls
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,6 +23,14 @@ func TLSListenerFactoryFromConfig(c *config.Global, in *config.TLSServe) (transp
 	address := in.Listen
 	handshakeTimeout := in.HandshakeTimeout
 
+	if len(in.ServerNames) > 0 {
+		lfs, err := SNIListenerFactoriesFromConfig(c, []*config.TLSServe{in})
+		if err != nil {
+			return nil, err
+		}
+		return lfs[0], nil
+	}
+
 	if in.Ca == "" || in.Cert == "" || in.Key == "" {
 		return nil, errors.New("fields 'ca', 'cert' and 'key'must be specified")
 	}
@@ -29,16 +39,49 @@ func TLSListenerFactoryFromConfig(c *config.Global, in *config.TLSServe) (transp
 		return func() (transport.AuthenticatedListener, error) { return nil, nil }, nil
 	}
 
-	clientCA, err := tlsconf.ParseCAFile(in.Ca)
+	d, err := serveDomainFromConfig(in)
+	if err != nil {
+		return nil, err
+	}
+	socketOptions, err := transport.SocketOptionsFromConfig(in.Socket)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse ca file")
+		return nil, errors.Wrap(err, "invalid field 'socket'")
 	}
 
-	serverCert, err := tls.LoadX509KeyPair(in.Cert, in.Key)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse cert/key pair")
+	lf := func() (transport.AuthenticatedListener, error) {
+		l, err := tcpsock.ListenAll(address, in.ListenFreeBind, socketOptions)
+		if err != nil {
+			return nil, err
+		}
+		tl := tlsconf.NewReloadingClientAuthListener(l, d.getCerts, d.verify, handshakeTimeout)
+		return &tlsAuthListener{tl, d.clientCNs}, nil
 	}
 
+	return lf, nil
+}
+
+// serveDomain holds the certificates and the client verification of a serve section.
+// With SNI, a listener serves several domains, see SNIListenerFactoriesFromConfig.
+type serveDomain struct {
+	certs     *reloadableCertificates
+	clientCNs map[string]struct{}
+	verify    tlsconf.ClientVerifier
+}
+
+func serveDomainFromConfig(in *config.TLSServe) (*serveDomain, error) {
+	files := certificateFiles{CA: in.Ca, Cert: in.Cert, Key: in.Key}
+	var refreshInterval time.Duration
+	if in.CRL != nil {
+		if in.CRL.File == "" {
+			return nil, errors.New("field 'crl.file' must be specified")
+		}
+		files.CRL = in.CRL.File
+		refreshInterval = in.CRL.RefreshInterval
+	}
+	certs, err := newReloadableCertificates(files, refreshInterval)
+	if err != nil {
+		return nil, err
+	}
 	clientCNs := make(map[string]struct{}, len(in.ClientCNs))
 	for i, cn := range in.ClientCNs {
 		if err := transport.ValidateClientIdentity(cn); err != nil {
@@ -48,16 +91,33 @@ func TLSListenerFactoryFromConfig(c *config.Global, in *config.TLSServe) (transp
 		clientCNs[cn] = struct{}{}
 	}
 
-	lf := func() (transport.AuthenticatedListener, error) {
-		l, err := tcpsock.Listen(address, in.ListenFreeBind)
-		if err != nil {
-			return nil, err
-		}
-		tl := tlsconf.NewClientAuthListener(l, clientCA, serverCert, handshakeTimeout)
-		return &tlsAuthListener{tl, clientCNs}, nil
+	clientNetworks, err := transport.ClientNetworksFromConfig(in.ClientNetworks, in.ClientCNs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'client_networks'")
+	}
+	var revocation *revocationChecker
+	if in.CRL != nil || in.OCSP != nil {
+		revocation = newRevocationChecker(certs, in.OCSP)
 	}
+	verify := tlsconf.ClientVerifier{
+		Addr: clientNetworks.CheckAddr,
+		Certificate: func(remote net.Addr, leaf, issuer *x509.Certificate) error {
+			// the common name is checked against client_cns after the handshake
+			if err := clientNetworks.Check(leaf.Subject.CommonName, remote); err != nil {
+				return err
+			}
+			if revocation != nil {
+				return revocation.verify(leaf, issuer)
+			}
+			return nil
+		},
+	}
+	return &serveDomain{certs, clientCNs, verify}, nil
+}
 
-	return lf, nil
+func (d *serveDomain) getCerts() (*x509.CertPool, tls.Certificate) {
+	c := d.certs.get()
+	return c.ca, c.cert
 }
 
 type tlsAuthListener struct {
@@ -70,25 +130,33 @@ func (l tlsAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error
 	if err != nil {
 		return nil, err
 	}
-	if _, ok := l.clientCNs[cn]; !ok {
-		log := transport.GetLogger(ctx)
-		if dl, ok := ctx.Deadline(); ok {
-			defer func() {
-				err := tlsConn.SetDeadline(time.Time{})
-				if err != nil {
-					log.WithError(err).Error("cannot clear connection deadline")
-				}
-			}()
-			err := tlsConn.SetDeadline(dl)
+	if err := checkClientCN(ctx, tlsConn, l.clientCNs, cn); err != nil {
+		return nil, err
+	}
+	adaptor := newWireAdaptor(tlsConn, tcpConn)
+	return transport.NewAuthConn(adaptor, cn), nil
+}
+
+// checkClientCN closes tlsConn if cn is not one of clientCNs.
+func checkClientCN(ctx context.Context, tlsConn *tls.Conn, clientCNs map[string]struct{}, cn string) error {
+	if _, ok := clientCNs[cn]; ok {
+		return nil
+	}
+	log := transport.GetLogger(ctx)
+	if dl, ok := ctx.Deadline(); ok {
+		defer func() {
+			err := tlsConn.SetDeadline(time.Time{})
 			if err != nil {
-				log.WithError(err).WithField("deadline", dl).Error("cannot set connection deadline inherited from context")
+				log.WithError(err).Error("cannot clear connection deadline")
 			}
+		}()
+		err := tlsConn.SetDeadline(dl)
+		if err != nil {
+			log.WithError(err).WithField("deadline", dl).Error("cannot set connection deadline inherited from context")
 		}
-		if err := tlsConn.Close(); err != nil {
-			log.WithError(err).Error("error closing connection with unauthorized common name")
-		}
-		return nil, fmt.Errorf("unauthorized client common name %q from %s", cn, tlsConn.RemoteAddr())
 	}
-	adaptor := newWireAdaptor(tlsConn, tcpConn)
-	return transport.NewAuthConn(adaptor, cn), nil
+	if err := tlsConn.Close(); err != nil {
+		log.WithError(err).Error("error closing connection with unauthorized common name")
+	}
+	return fmt.Errorf("unauthorized client common name %q from %s", cn, tlsConn.RemoteAddr())
 }
@@ -0,0 +1,178 @@
+package tls
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/tlsconf"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+// SNIListenerFactoriesFromConfig returns listener factories for serves that share a single listener.
+// Each connection is handed to the serve section whose 'server_names' match the server name
+// that the client requested via SNI, i.e., the client's 'server_cn'.
+// The serve section's certificates, client_cns and client_networks apply to the connection.
+// Unlike with transport.IdentityDemux, client identities need not be unique among serves.
+//
+// The returned slice is indexed like serves.
+func SNIListenerFactoriesFromConfig(g *config.Global, serves []*config.TLSServe) ([]transport.AuthenticatedListenerFactory, error) {
+	if len(serves) == 0 {
+		return nil, errors.New("no serve sections")
+	}
+	first := serves[0]
+	serverNames := make([][]string, len(serves))
+	seen := make(map[string]bool)
+	for i, in := range serves {
+		if in.Ca == "" || in.Cert == "" || in.Key == "" {
+			return nil, errors.New("fields 'ca', 'cert' and 'key'must be specified")
+		}
+		if len(in.ServerNames) == 0 {
+			return nil, errors.New("field 'server_names' must be specified for all serve sections on the same listen address, or for none")
+		}
+		if !sameListenAddresses(in.Listen, first.Listen) || in.ListenFreeBind != first.ListenFreeBind ||
+			in.HandshakeTimeout != first.HandshakeTimeout || !reflect.DeepEqual(in.Socket, first.Socket) {
+			return nil, errors.New("fields 'listen', 'listen_freebind', 'handshake_timeout' and 'socket' must be equal")
+		}
+		for _, name := range in.ServerNames {
+			name = strings.ToLower(name)
+			if name == "" || strings.Count(name, "*") > 1 {
+				return nil, errors.Errorf("invalid server name %q: must not be empty and contain at most one '*'", name)
+			}
+			if seen[name] {
+				return nil, errors.Errorf("server name %q is specified more than once", name)
+			}
+			seen[name] = true
+			serverNames[i] = append(serverNames[i], name)
+		}
+	}
+
+	if fakeCertificateLoading {
+		lfs := make([]transport.AuthenticatedListenerFactory, len(serves))
+		for i := range lfs {
+			lfs[i] = func() (transport.AuthenticatedListener, error) { return nil, nil }
+		}
+		return lfs, nil
+	}
+
+	domains := &sniDomains{serverNames: serverNames, domains: make([]*serveDomain, len(serves))}
+	for i, in := range serves {
+		d, err := serveDomainFromConfig(in)
+		if err != nil {
+			return nil, errors.Wrapf(err, "serve section for server names %q", in.ServerNames)
+		}
+		domains.domains[i] = d
+	}
+	socketOptions, err := transport.SocketOptionsFromConfig(first.Socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field 'socket'")
+	}
+
+	lf := func() (transport.AuthenticatedListener, error) {
+		l, err := tcpsock.ListenAll(first.Listen, first.ListenFreeBind, socketOptions)
+		if err != nil {
+			return nil, err
+		}
+		tl := tlsconf.NewSNIClientAuthListener(l, domains.route, domains.verifyAddr, first.HandshakeTimeout)
+		return &sniAuthListener{tl, domains}, nil
+	}
+	demux := transport.NewDemux(lf, "server name", func(conn *transport.AuthConn) string {
+		return strings.ToLower(conn.Wire.(transportWireAdaptor).ConnectionState().ServerName)
+	})
+	lfs := make([]transport.AuthenticatedListenerFactory, len(serves))
+	for i := range serves {
+		if lfs[i], err = demux.ListenerFactory(serverNames[i]); err != nil {
+			return nil, err
+		}
+	}
+	return lfs, nil
+}
+
+type sniDomains struct {
+	serverNames [][]string // lower case, indexed like domains
+	domains     []*serveDomain
+}
+
+// lookup matches serverName like transport.IdentityDemux does.
+func (s *sniDomains) lookup(serverName string) (*serveDomain, error) {
+	serverName = strings.ToLower(serverName)
+	if serverName == "" {
+		return nil, errors.New("client did not request a server name via SNI")
+	}
+	var match *serveDomain
+	for i, patterns := range s.serverNames {
+		for _, pattern := range patterns {
+			if !transport.IdentityMatches(pattern, serverName) {
+				continue
+			}
+			if match != nil && match != s.domains[i] {
+				return nil, errors.Errorf("server name %q is ambiguous", serverName)
+			}
+			match = s.domains[i]
+		}
+	}
+	if match == nil {
+		return nil, errors.Errorf("unknown server name %q", serverName)
+	}
+	return match, nil
+}
+
+func (s *sniDomains) route(serverName string) (tlsconf.CertificatesFunc, tlsconf.ClientVerifier, error) {
+	d, err := s.lookup(serverName)
+	if err != nil {
+		return nil, tlsconf.ClientVerifier{}, err
+	}
+	return d.getCerts, d.verify, nil
+}
+
+// verifyAddr rejects addresses from which no client identity of any domain may connect.
+func (s *sniDomains) verifyAddr(remote net.Addr) (err error) {
+	for _, d := range s.domains {
+		if err = d.verify.Addr(remote); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type sniAuthListener struct {
+	*tlsconf.ClientAuthListener
+	domains *sniDomains
+}
+
+func (l *sniAuthListener) Accept(ctx context.Context) (*transport.AuthConn, error) {
+	tcpConn, tlsConn, cn, err := l.ClientAuthListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	// the handshake succeeded, hence the domain exists
+	d, err := l.domains.lookup(tlsConn.ConnectionState().ServerName)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	if err := checkClientCN(ctx, tlsConn, d.clientCNs, cn); err != nil {
+		return nil, err
+	}
+	adaptor := newWireAdaptor(tlsConn, tcpConn)
+	return transport.NewAuthConn(adaptor, cn), nil
+}
+
+// sameListenAddresses compares a and b as sets, like the grouping of serve sections into shared listeners
+func sameListenAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA, sortedB := make([]string, len(a)), make([]string, len(b))
+	copy(sortedA, a)
+	copy(sortedB, b)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	return reflect.DeepEqual(sortedA, sortedB)
+}
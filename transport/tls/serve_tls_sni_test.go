@@ -0,0 +1,176 @@
+package tls
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/transport"
+)
+
+func TestSNIListenerFactories(t *testing.T) {
+	defer resetReloadables()
+	dir, err := ioutil.TempDir("", "zrepl-tls-sni-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// self-signed certificates are their own CA, so each domain's certificate
+	// serves as server certificate and as client certificate of that domain
+	files := make(map[string]certificateFiles)
+	for _, cn := range []string{"domain-a", "domain-b"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, cn), 0700))
+		files[cn] = writeSelfSignedCert(t, filepath.Join(dir, cn), cn)
+	}
+	serve := func(cn string, serverNames ...string) *config.TLSServe {
+		return &config.TLSServe{
+			Listen:           config.ListenAddresses{"127.0.0.1:0"},
+			Ca:               files[cn].CA,
+			Cert:             files[cn].Cert,
+			Key:              files[cn].Key,
+			ClientCNs:        []string{cn},
+			ServerNames:      serverNames,
+			HandshakeTimeout: 10 * time.Second,
+		}
+	}
+
+	lfs, err := SNIListenerFactoriesFromConfig(nil, []*config.TLSServe{serve("domain-a", "domain-a", "*.a.example.com"), serve("domain-b", "domain-b")})
+	require.NoError(t, err)
+	la, err := lfs[0]()
+	require.NoError(t, err)
+	defer la.Close()
+	lb, err := lfs[1]()
+	require.NoError(t, err)
+	defer lb.Close()
+
+	connect := func(cn, serverCN string) (transport.Wire, error) {
+		c, err := TLSConnecterFromConfig(&config.TLSConnect{
+			Address:     la.Addr().String(),
+			Ca:          files[cn].CA,
+			Cert:        files[cn].Cert,
+			Key:         files[cn].Key,
+			ServerCN:    serverCN,
+			DialTimeout: 10 * time.Second,
+		})
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		w, err := c.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		require.NoError(t, w.SetDeadline(time.Now().Add(10*time.Second)))
+		// the handshake happens on the first write
+		_, err = w.Write([]byte("x"))
+		return w, err
+	}
+	accept := func(l transport.AuthenticatedListener) <-chan *transport.AuthConn {
+		accepted := make(chan *transport.AuthConn, 1)
+		go func() {
+			conn, err := l.Accept(context.Background())
+			if err == nil {
+				accepted <- conn
+			}
+			close(accepted)
+		}()
+		return accepted
+	}
+	// handshake errors are delivered to any of the consumers
+	acceptErr := func() <-chan error {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := la.Accept(context.Background())
+			errs <- err
+		}()
+		return errs
+	}
+
+	for _, cn := range []string{"domain-a", "domain-b"} {
+		t.Run(cn, func(t *testing.T) {
+			l, other := la, lb
+			if cn == "domain-b" {
+				l, other = lb, la
+			}
+			accepted := accept(l)
+			client, err := connect(cn, cn)
+			require.NoError(t, err)
+			defer client.Close()
+			conn := <-accepted
+			require.NotNil(t, conn)
+			defer conn.Close()
+			assert.Equal(t, cn, conn.ClientIdentity())
+
+			// the other job must not receive the connection
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err = other.Accept(ctx)
+			assert.Equal(t, context.DeadlineExceeded, err)
+		})
+	}
+
+	t.Run("unknown server name", func(t *testing.T) {
+		errs := acceptErr()
+		_, err := connect("domain-a", "domain-c")
+		assert.Error(t, err)
+		assert.Error(t, <-errs)
+	})
+
+	t.Run("server name of other domain", func(t *testing.T) {
+		// domain-b's certificate is not signed by domain-a's CA
+		errs := acceptErr()
+		_, err := connect("domain-a", "domain-b")
+		assert.Error(t, err)
+		assert.Error(t, <-errs)
+	})
+}
+
+func TestSNIListenerFactoriesValidation(t *testing.T) {
+	serve := func(serverNames ...string) *config.TLSServe {
+		return &config.TLSServe{
+			Listen:      config.ListenAddresses{"127.0.0.1:0"},
+			Ca:          "ca.pem",
+			Cert:        "cert.pem",
+			Key:         "key.pem",
+			ServerNames: serverNames,
+		}
+	}
+	differentTimeout := serve("b.example.com")
+	differentTimeout.HandshakeTimeout = time.Second
+	for name, serves := range map[string][]*config.TLSServe{
+		"duplicate server name":    {serve("a.example.com"), serve("A.example.com")},
+		"missing server names":     {serve("a.example.com"), serve()},
+		"two placeholders":         {serve("*.*.example.com")},
+		"different listener":       {serve("a.example.com"), differentTimeout},
+		"empty server name":        {serve("")},
+		"no serve sections at all": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := SNIListenerFactoriesFromConfig(nil, serves)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSNIListenerFactoriesListenAddressOrder(t *testing.T) {
+	defer func(fake bool) { fakeCertificateLoading = fake }(fakeCertificateLoading)
+	fakeCertificateLoading = true
+	serve := func(serverName string, listen ...string) *config.TLSServe {
+		return &config.TLSServe{Listen: listen, Ca: "ca.pem", Cert: "cert.pem", Key: "key.pem", ServerNames: []string{serverName}}
+	}
+	_, err := SNIListenerFactoriesFromConfig(nil, []*config.TLSServe{
+		serve("a.example.com", "127.0.0.1:8888", "[::1]:8888"),
+		serve("b.example.com", "[::1]:8888", "127.0.0.1:8888"),
+	})
+	assert.NoError(t, err)
+	_, err = SNIListenerFactoriesFromConfig(nil, []*config.TLSServe{
+		serve("a.example.com", "127.0.0.1:8888", "[::1]:8888"),
+		serve("b.example.com", "127.0.0.1:8888"),
+	})
+	assert.Error(t, err)
+}
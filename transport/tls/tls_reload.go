@@ -0,0 +1,355 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/tlsconf"
+	"github.com/zrepl/zrepl/transport"
+)
+
+type certificateFiles struct {
+	CA, Cert, Key string
+	CRL           string // optional
+}
+
+type certificates struct {
+	ca   *x509.CertPool
+	cert tls.Certificate
+	crl  *pkix.CertificateList // nil if certificateFiles.CRL is not set
+}
+
+func loadCertificates(files certificateFiles) (*certificates, error) {
+	ca, err := tlsconf.ParseCAFile(files.CA)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse ca file")
+	}
+	cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse cert/key pair")
+	}
+	var crl *pkix.CertificateList
+	if files.CRL != "" {
+		crl, err = loadCRL(files.CRL, files.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot load crl")
+		}
+	}
+	return &certificates{ca, cert, crl}, nil
+}
+
+// reloadableCertificates holds the most recently loaded certificates of a tls serve or connect.
+// New connections use the current certificates, established connections are not affected by a reload.
+//
+// ReloadCertificates and WatchCertificates only reach the instances that are registered,
+// i.e., those of the running jobs, see Certificates.
+type reloadableCertificates struct {
+	files certificateFiles
+	// if non-zero, reload periodically, e.g. to pick up a CRL that is updated in place by a cron job
+	refreshInterval time.Duration
+
+	mtx     sync.Mutex
+	current *certificates
+}
+
+var reloadables struct {
+	mtx sync.Mutex
+	// registered instances by the number of registrations
+	registered map[*reloadableCertificates]int
+	// signalled when registered changes, buffered
+	changed chan struct{}
+	// the Certificates that newReloadableCertificates adds to, nil outside of CollectCertificates
+	collecting *Certificates
+}
+
+func init() {
+	reloadables.registered = make(map[*reloadableCertificates]int)
+	reloadables.changed = make(chan struct{}, 1)
+}
+
+// serializes CollectCertificates
+var collectMtx sync.Mutex
+
+func newReloadableCertificates(files certificateFiles, refreshInterval time.Duration) (*reloadableCertificates, error) {
+	certs, err := loadCertificates(files)
+	if err != nil {
+		return nil, err
+	}
+	r := &reloadableCertificates{files: files, refreshInterval: refreshInterval, current: certs}
+	reloadables.mtx.Lock()
+	defer reloadables.mtx.Unlock()
+	if reloadables.collecting != nil {
+		reloadables.collecting.all = append(reloadables.collecting.all, r)
+	}
+	return r, nil
+}
+
+// Certificates are the certificates loaded by the tls transports of a job, see CollectCertificates.
+// The nil value is an empty set.
+type Certificates struct {
+	all []*reloadableCertificates
+}
+
+// CollectCertificates returns the certificates loaded by the tls transports that build creates.
+func CollectCertificates(build func()) *Certificates {
+	collectMtx.Lock()
+	defer collectMtx.Unlock()
+	c := &Certificates{}
+	reloadables.mtx.Lock()
+	reloadables.collecting = c
+	reloadables.mtx.Unlock()
+	defer func() {
+		reloadables.mtx.Lock()
+		reloadables.collecting = nil
+		reloadables.mtx.Unlock()
+	}()
+	build()
+	return c
+}
+
+// Add returns the union of c and o.
+func (c *Certificates) Add(o *Certificates) *Certificates {
+	if c == nil {
+		return o
+	}
+	if o == nil {
+		return c
+	}
+	return &Certificates{all: append(append([]*reloadableCertificates{}, c.all...), o.all...)}
+}
+
+// Register makes the certificates subject to ReloadCertificates and WatchCertificates until unregister is called,
+// e.g., for the lifetime of the job that uses them.
+// Registrations are counted, the certificates of a listener shared by several jobs stay registered until all of them unregistered.
+func (c *Certificates) Register() (unregister func()) {
+	if c == nil || len(c.all) == 0 {
+		return func() {}
+	}
+	reloadables.mtx.Lock()
+	defer reloadables.mtx.Unlock()
+	for _, r := range c.all {
+		reloadables.registered[r]++
+	}
+	signalReloadablesChanged()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			reloadables.mtx.Lock()
+			defer reloadables.mtx.Unlock()
+			for _, r := range c.all {
+				if reloadables.registered[r]--; reloadables.registered[r] <= 0 {
+					delete(reloadables.registered, r)
+				}
+			}
+			signalReloadablesChanged()
+		})
+	}
+}
+
+// reloadables.mtx must be held
+func signalReloadablesChanged() {
+	select {
+	case reloadables.changed <- struct{}{}:
+	default:
+	}
+}
+
+func registeredReloadables() []*reloadableCertificates {
+	reloadables.mtx.Lock()
+	defer reloadables.mtx.Unlock()
+	all := make([]*reloadableCertificates, 0, len(reloadables.registered))
+	for r := range reloadables.registered {
+		all = append(all, r)
+	}
+	return all
+}
+
+func (r *reloadableCertificates) get() *certificates {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.current
+}
+
+// reload keeps the current certificates if the files cannot be loaded,
+// e.g. because only some of them have been replaced so far.
+func (r *reloadableCertificates) reload() error {
+	certs, err := loadCertificates(r.files)
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.current = certs
+	return nil
+}
+
+func (r *reloadableCertificates) paths() []string {
+	paths := []string{r.files.CA, r.files.Cert, r.files.Key}
+	if r.files.CRL != "" {
+		paths = append(paths, r.files.CRL)
+	}
+	return paths
+}
+
+func (r *reloadableCertificates) uses(path string) bool {
+	for _, f := range r.paths() {
+		if filepath.Clean(f) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func reloadAndLog(ctx context.Context, r *reloadableCertificates) {
+	log := transport.GetLogger(ctx).
+		WithField("ca", r.files.CA).WithField("cert", r.files.Cert).WithField("key", r.files.Key)
+	if r.files.CRL != "" {
+		log = log.WithField("crl", r.files.CRL)
+	}
+	if err := r.reload(); err != nil {
+		log.WithError(err).Error("cannot reload tls certificates, continuing to use the previous ones")
+		return
+	}
+	log.Info("reloaded tls certificates")
+}
+
+// ReloadCertificates reloads the certificate files of all registered tls transports.
+// Errors are logged, the affected transport continues to use its previous certificates.
+func ReloadCertificates(ctx context.Context) {
+	for _, r := range registeredReloadables() {
+		reloadAndLog(ctx, r)
+	}
+}
+
+// Tools that rotate certificates usually write several files, possibly through renames.
+// Reloads wait until no more changes have happened for this duration.
+const watchCertificatesSettleTime = 2 * time.Second
+
+// WatchCertificates reloads the certificates of a registered tls transport whenever one of its files changes,
+// and periodically if the transport has a refresh interval.
+// Certificates that are registered later are watched from then on.
+// It blocks until ctx is done.
+func WatchCertificates(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "cannot create file watcher")
+	}
+	defer watcher.Close()
+
+	log := transport.GetLogger(ctx)
+	var all []*reloadableCertificates
+	dirs := make(map[string]bool)
+	refreshing := make(map[*reloadableCertificates]context.CancelFunc)
+	defer func() {
+		for _, cancel := range refreshing {
+			cancel()
+		}
+	}()
+	// Watch the directories instead of the files because files replaced through a rename
+	// (or updated symlinks, e.g. certbot's live directory) would not be watched anymore.
+	update := func() {
+		all = registeredReloadables()
+		nextDirs := make(map[string]bool)
+		nextRefreshing := make(map[*reloadableCertificates]context.CancelFunc)
+		for _, r := range all {
+			for _, f := range r.paths() {
+				nextDirs[filepath.Dir(filepath.Clean(f))] = true
+			}
+			if r.refreshInterval > 0 {
+				if cancel, ok := refreshing[r]; ok {
+					nextRefreshing[r] = cancel
+					delete(refreshing, r)
+				} else {
+					refreshCtx, cancel := context.WithCancel(ctx)
+					go refreshPeriodically(refreshCtx, r)
+					nextRefreshing[r] = cancel
+				}
+			}
+		}
+		for _, cancel := range refreshing {
+			cancel()
+		}
+		refreshing = nextRefreshing
+		for dir := range dirs {
+			if !nextDirs[dir] {
+				_ = watcher.Remove(dir) // fails if the directory is gone
+				delete(dirs, dir)
+			}
+		}
+		for dir := range nextDirs {
+			if dirs[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				log.WithError(err).WithField("dir", dir).Error("cannot watch directory of tls certificate files, send SIGHUP to reload them")
+				continue
+			}
+			dirs[dir] = true
+		}
+	}
+	update()
+
+	pending := make(map[*reloadableCertificates]bool)
+	settle := time.NewTimer(0)
+	<-settle.C
+	for {
+		select {
+		case <-ctx.Done():
+			settle.Stop()
+			return nil
+		case <-reloadables.changed:
+			update()
+			registered := make(map[*reloadableCertificates]bool, len(all))
+			for _, r := range all {
+				registered[r] = true
+			}
+			for r := range pending {
+				if !registered[r] {
+					delete(pending, r)
+				}
+			}
+		case err := <-watcher.Errors:
+			log.WithError(err).Error("error watching tls certificate files")
+		case ev := <-watcher.Events:
+			for _, r := range all {
+				if r.uses(filepath.Clean(ev.Name)) {
+					pending[r] = true
+				}
+			}
+			if len(pending) > 0 {
+				settle.Stop()
+				select {
+				case <-settle.C:
+				default:
+				}
+				settle.Reset(watchCertificatesSettleTime)
+			}
+		case <-settle.C:
+			for r := range pending {
+				reloadAndLog(ctx, r)
+			}
+			pending = make(map[*reloadableCertificates]bool)
+		}
+	}
+}
+
+func refreshPeriodically(ctx context.Context, r *reloadableCertificates) {
+	t := time.NewTicker(r.refreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reloadAndLog(ctx, r)
+		}
+	}
+}
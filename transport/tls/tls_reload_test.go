@@ -0,0 +1,161 @@
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for cn to dir/{ca,cert,key}.pem
+// (the certificate is its own CA).
+func writeSelfSignedCert(t *testing.T, dir, cn string) certificateFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := certificateFiles{
+		CA:   filepath.Join(dir, "ca.pem"),
+		Cert: filepath.Join(dir, "cert.pem"),
+		Key:  filepath.Join(dir, "key.pem"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(files.CA, certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(files.Cert, certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(files.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return files
+}
+
+// resetReloadables forgets the certificates registered by previous tests, whose files are gone.
+func resetReloadables() {
+	reloadables.mtx.Lock()
+	defer reloadables.mtx.Unlock()
+	reloadables.registered = make(map[*reloadableCertificates]int)
+}
+
+func leafCN(t *testing.T, c *certificates) string {
+	leaf, err := x509.ParseCertificate(c.cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloadableCertificates(t *testing.T) {
+	resetReloadables()
+	dir, err := ioutil.TempDir("", "zrepl-tls-reload-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := writeSelfSignedCert(t, dir, "before")
+	r, err := newReloadableCertificates(files, 0)
+	require.NoError(t, err)
+	before := r.get()
+	assert.Equal(t, "before", leafCN(t, before))
+
+	writeSelfSignedCert(t, dir, "after")
+	require.NoError(t, r.reload())
+	assert.Equal(t, "after", leafCN(t, r.get()))
+	assert.Equal(t, "before", leafCN(t, before), "certificates handed out before the reload must not change")
+
+	// a partially written rotation keeps the previous certificates
+	require.NoError(t, ioutil.WriteFile(files.Key, []byte("garbage"), 0600))
+	assert.Error(t, r.reload())
+	assert.Equal(t, "after", leafCN(t, r.get()))
+}
+
+func TestWatchCertificates(t *testing.T) {
+	resetReloadables()
+	dir, err := ioutil.TempDir("", "zrepl-tls-reload-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := writeSelfSignedCert(t, dir, "before")
+	var r *reloadableCertificates
+	certs := CollectCertificates(func() {
+		r, err = newReloadableCertificates(files, 0)
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchDone := make(chan error)
+	go func() { watchDone <- WatchCertificates(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-watchDone)
+	}()
+	// e.g., a job started by a reload
+	defer certs.Register()()
+	time.Sleep(100 * time.Millisecond) // wait for the watch to be established
+
+	// replace the files through renames, as rotation tools do
+	staging, err := ioutil.TempDir(dir, "staging")
+	require.NoError(t, err)
+	staged := writeSelfSignedCert(t, staging, "after")
+	require.NoError(t, os.Rename(staged.CA, files.CA))
+	require.NoError(t, os.Rename(staged.Cert, files.Cert))
+	require.NoError(t, os.Rename(staged.Key, files.Key))
+
+	deadline := time.Now().Add(watchCertificatesSettleTime + 5*time.Second)
+	for leafCN(t, r.get()) != "after" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificates were not reloaded")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestCertificatesRegister(t *testing.T) {
+	resetReloadables()
+	dir, err := ioutil.TempDir("", "zrepl-tls-reload-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := writeSelfSignedCert(t, dir, "before")
+	var r *reloadableCertificates
+	certs := CollectCertificates(func() {
+		r, err = newReloadableCertificates(files, 0)
+	})
+	require.NoError(t, err)
+	// e.g., built for a reload that was rejected
+	_, err = newReloadableCertificates(files, 0)
+	require.NoError(t, err)
+	assert.Empty(t, registeredReloadables())
+
+	// a listener shared by two jobs
+	unregister1 := certs.Register()
+	unregister2 := certs.Register()
+	assert.Equal(t, []*reloadableCertificates{r}, registeredReloadables())
+	unregister1()
+	unregister1()
+	assert.Equal(t, []*reloadableCertificates{r}, registeredReloadables())
+	unregister2()
+	assert.Empty(t, registeredReloadables())
+
+	writeSelfSignedCert(t, dir, "after")
+	ReloadCertificates(context.Background())
+	assert.Equal(t, "before", leafCN(t, r.get()), "certificates of stopped jobs are not reloaded")
+}
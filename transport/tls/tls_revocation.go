@@ -0,0 +1,234 @@
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+var revocationMetrics struct {
+	checks *prometheus.CounterVec
+}
+
+func init() {
+	revocationMetrics.checks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "transport_tls",
+		Name:      "revocation_checks",
+		Help:      "number of client certificate revocation checks by method (crl, ocsp) and result (good, revoked, error, error_fail_open)",
+	}, []string{"method", "result"})
+}
+
+func RegisterMetrics(r prometheus.Registerer) {
+	r.MustRegister(revocationMetrics.checks)
+}
+
+// loadCRL parses a PEM or DER encoded CRL and checks that it is signed by a certificate in caFile.
+func loadCRL(crlFile, caFile string) (*pkix.CertificateList, error) {
+	crlBytes, err := ioutil.ReadFile(crlFile)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseCRL(crlBytes)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse ca file")
+		}
+		if ca.CheckCRLSignature(crl) == nil {
+			return crl, nil
+		}
+	}
+	return nil, errors.New("crl is not signed by a certificate in the ca file")
+}
+
+// revocationChecker rejects client certificates that are revoked according to
+// the CRL of certs (reloaded together with the certificates) and / or an OCSP responder.
+type revocationChecker struct {
+	certs *reloadableCertificates
+	ocsp  *ocspChecker // nil if OCSP is not configured
+}
+
+func newRevocationChecker(certs *reloadableCertificates, in *config.TLSServeOCSP) *revocationChecker {
+	c := &revocationChecker{certs: certs}
+	if in != nil {
+		c.ocsp = &ocspChecker{
+			responder: in.Responder,
+			client:    &http.Client{Timeout: in.Timeout},
+			cacheTime: in.CacheTime,
+			failOpen:  in.FailOpen,
+			cache:     make(map[string]ocspCacheEntry),
+		}
+	}
+	return c
+}
+
+func (c *revocationChecker) verify(leaf, issuer *x509.Certificate) error {
+	if crl := c.certs.get().crl; crl != nil {
+		if err := checkCRL(crl, leaf, time.Now()); err != nil {
+			return err
+		}
+	}
+	if c.ocsp != nil {
+		return c.ocsp.check(leaf, issuer)
+	}
+	return nil
+}
+
+func checkCRL(crl *pkix.CertificateList, leaf *x509.Certificate, now time.Time) error {
+	var leafIssuer pkix.RDNSequence
+	if _, err := asn1.Unmarshal(leaf.RawIssuer, &leafIssuer); err != nil {
+		revocationMetrics.checks.WithLabelValues("crl", "error").Inc()
+		return errors.Wrap(err, "cannot parse client certificate issuer")
+	}
+	if leafIssuer.String() != crl.TBSCertList.Issuer.String() {
+		// issued by another CA in the ca file, the CRL does not apply
+		return nil
+	}
+	if crl.HasExpired(now) {
+		revocationMetrics.checks.WithLabelValues("crl", "error").Inc()
+		return fmt.Errorf("crl expired at %s, cannot check revocation of client certificate", crl.TBSCertList.NextUpdate)
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			revocationMetrics.checks.WithLabelValues("crl", "revoked").Inc()
+			return fmt.Errorf("client certificate (serial %s) was revoked at %s according to crl", leaf.SerialNumber, revoked.RevocationTime)
+		}
+	}
+	revocationMetrics.checks.WithLabelValues("crl", "good").Inc()
+	return nil
+}
+
+type ocspChecker struct {
+	responder string // if empty, use the certificate's OCSP server
+	client    *http.Client
+	cacheTime time.Duration
+	failOpen  bool
+
+	mtx   sync.Mutex
+	cache map[string]ocspCacheEntry // key: see ocspCacheKey
+}
+
+type ocspCacheEntry struct {
+	res        *ocsp.Response
+	validUntil time.Time
+}
+
+func ocspCacheKey(leaf, issuer *x509.Certificate) string {
+	return string(issuer.RawSubjectPublicKeyInfo) + "\x00" + leaf.SerialNumber.String()
+}
+
+func (c *ocspChecker) check(leaf, issuer *x509.Certificate) error {
+	res, err := c.status(leaf, issuer)
+	if err != nil {
+		if c.failOpen {
+			revocationMetrics.checks.WithLabelValues("ocsp", "error_fail_open").Inc()
+			return nil
+		}
+		revocationMetrics.checks.WithLabelValues("ocsp", "error").Inc()
+		return errors.Wrap(err, "ocsp")
+	}
+	switch res.Status {
+	case ocsp.Good:
+		revocationMetrics.checks.WithLabelValues("ocsp", "good").Inc()
+		return nil
+	case ocsp.Revoked:
+		revocationMetrics.checks.WithLabelValues("ocsp", "revoked").Inc()
+		return fmt.Errorf("client certificate (serial %s) was revoked at %s according to ocsp responder", leaf.SerialNumber, res.RevokedAt)
+	default:
+		// ocsp.Unknown, not cached
+		if c.failOpen {
+			revocationMetrics.checks.WithLabelValues("ocsp", "error_fail_open").Inc()
+			return nil
+		}
+		revocationMetrics.checks.WithLabelValues("ocsp", "error").Inc()
+		return fmt.Errorf("ocsp responder does not know client certificate (serial %s)", leaf.SerialNumber)
+	}
+}
+
+// status returns the cached or freshly queried OCSP response for leaf.
+func (c *ocspChecker) status(leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	key := ocspCacheKey(leaf, issuer)
+	now := time.Now()
+	c.mtx.Lock()
+	entry, ok := c.cache[key]
+	c.mtx.Unlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.res, nil
+	}
+
+	res, err := c.query(leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if !res.NextUpdate.IsZero() && !now.Before(res.NextUpdate) {
+		// e.g. a responder that serves outdated pre-signed responses
+		return nil, errors.Errorf("stale response, its next update was due at %s", res.NextUpdate)
+	}
+	if res.Status == ocsp.Good || res.Status == ocsp.Revoked {
+		validUntil := now.Add(c.cacheTime)
+		if !res.NextUpdate.IsZero() && res.NextUpdate.Before(validUntil) {
+			validUntil = res.NextUpdate
+		}
+		c.mtx.Lock()
+		c.cache[key] = ocspCacheEntry{res, validUntil}
+		c.mtx.Unlock()
+	}
+	return res, nil
+}
+
+func (c *ocspChecker) query(leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	responder := c.responder
+	if responder == "" {
+		if len(leaf.OCSPServer) == 0 {
+			return nil, errors.New("client certificate does not specify an ocsp responder and none is configured")
+		}
+		responder = leaf.OCSPServer[0]
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create request")
+	}
+	httpRes, err := c.client.Post(responder, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot query responder")
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("responder returned HTTP status %q", httpRes.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(httpRes.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read response")
+	}
+	res, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid response")
+	}
+	return res, nil
+}
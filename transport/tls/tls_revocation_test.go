@@ -0,0 +1,155 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert, key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) crl(t *testing.T, nextUpdate time.Time, revokedSerials ...int64) []byte {
+	var revoked []pkix.RevokedCertificate
+	for _, s := range revokedSerials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, revoked, time.Now().Add(-time.Hour), nextUpdate)
+	require.NoError(t, err)
+	return der
+}
+
+func TestLoadAndCheckCRL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrepl-tls-revocation-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+	crlFile := filepath.Join(dir, "crl.pem")
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: ca.crl(t, time.Now().Add(time.Hour), 2)})
+	require.NoError(t, ioutil.WriteFile(crlFile, crlPEM, 0600))
+
+	crl, err := loadCRL(crlFile, caFile)
+	require.NoError(t, err)
+	assert.NoError(t, checkCRL(crl, ca.issue(t, 1), time.Now()))
+	assert.Error(t, checkCRL(crl, ca.issue(t, 2), time.Now()))
+	assert.Error(t, checkCRL(crl, ca.issue(t, 1), time.Now().Add(2*time.Hour)), "expired crl must fail the check")
+
+	// certificates of other CAs are not affected
+	other := newTestCA(t, "other")
+	assert.NoError(t, checkCRL(crl, other.issue(t, 2), time.Now()))
+
+	// a CRL that is not signed by a CA in the ca file is rejected
+	require.NoError(t, ioutil.WriteFile(crlFile, other.crl(t, time.Now().Add(time.Hour)), 0600))
+	_, err = loadCRL(crlFile, caFile)
+	assert.Error(t, err)
+}
+
+func TestOCSPChecker(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	good, revoked, stale := ca.issue(t, 1), ca.issue(t, 2), ca.issue(t, 4)
+
+	var queries int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if req.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+			tmpl.Status = ocsp.Revoked
+			tmpl.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		if req.SerialNumber.Cmp(stale.SerialNumber) == 0 {
+			tmpl.ThisUpdate = time.Now().Add(-2 * time.Hour)
+			tmpl.NextUpdate = time.Now().Add(-time.Hour)
+		}
+		res, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(res)
+	}))
+	defer responder.Close()
+
+	c := newRevocationChecker(nil, &config.TLSServeOCSP{Responder: responder.URL, Timeout: 5 * time.Second, CacheTime: time.Hour}).ocsp
+	assert.NoError(t, c.check(good, ca.cert))
+	assert.Error(t, c.check(revoked, ca.cert))
+	assert.NoError(t, c.check(good, ca.cert))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries), "responses must be cached")
+	assert.Error(t, c.check(stale, ca.cert), "responses past their next update must not be accepted")
+
+	// a response signed by another CA is an error
+	other := newTestCA(t, "other")
+	assert.Error(t, c.check(other.issue(t, 3), other.cert))
+
+	// unreachable responder
+	responder.Close()
+	c = newRevocationChecker(nil, &config.TLSServeOCSP{Responder: responder.URL, Timeout: 5 * time.Second, CacheTime: time.Hour}).ocsp
+	assert.Error(t, c.check(good, ca.cert))
+	c.failOpen = true
+	assert.NoError(t, c.check(good, ca.cert))
+}
@@ -30,6 +30,23 @@ func (a AuthConn) SyscallConn() (rawConn syscall.RawConn, err error) {
 	return scc.SyscallConn()
 }
 
+var _ timeoutconn.ReadvObserver = AuthConn{}
+
+func (a AuthConn) ObserveReadv(n int64) {
+	if o, ok := a.Wire.(timeoutconn.ReadvObserver); ok {
+		o.ObserveReadv(n)
+	}
+}
+
+var _ timeoutconn.BuffersWriter = AuthConn{}
+
+func (a AuthConn) WriteBuffers(bufs *net.Buffers) (int64, error) {
+	if bw, ok := a.Wire.(timeoutconn.BuffersWriter); ok {
+		return bw.WriteBuffers(bufs)
+	}
+	return bufs.WriteTo(a.Wire)
+}
+
 func NewAuthConn(conn Wire, clientIdentity string) *AuthConn {
 	return &AuthConn{conn, clientIdentity}
 }
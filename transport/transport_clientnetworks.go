@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ClientNetworks restricts the source networks from which a client identity may connect.
+// Identities without restriction may connect from anywhere.
+// A nil *ClientNetworks does not restrict any identity.
+type ClientNetworks struct {
+	byIdentity map[string][]*net.IPNet
+	// false if some identity is unrestricted
+	allRestricted bool
+	union         []*net.IPNet
+}
+
+// ClientNetworksFromConfig parses the `client_networks` field of a serve section:
+// a map from client identity to a list of CIDRs or IP addresses.
+// identities are the identities the serve section knows, every key of in must be one of them.
+// Returns nil if in is empty.
+func ClientNetworksFromConfig(in map[string][]string, identities []string) (*ClientNetworks, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(identities))
+	for _, id := range identities {
+		known[id] = true
+	}
+	n := &ClientNetworks{byIdentity: make(map[string][]*net.IPNet, len(in))}
+	for id, networks := range in {
+		if !known[id] {
+			return nil, errors.Errorf("unknown client identity %q", id)
+		}
+		if len(networks) == 0 {
+			return nil, errors.Errorf("client identity %q: list of networks must not be empty", id)
+		}
+		for _, s := range networks {
+			ipnet, err := parseNetwork(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "client identity %q", id)
+			}
+			n.byIdentity[id] = append(n.byIdentity[id], ipnet)
+			n.union = append(n.union, ipnet)
+		}
+	}
+	n.allRestricted = true
+	for id := range known {
+		if _, ok := n.byIdentity[id]; !ok {
+			n.allRestricted = false
+		}
+	}
+	return n, nil
+}
+
+// parseNetwork accepts a CIDR or a single IP address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if _, ipnet, err := net.ParseCIDR(s); err == nil {
+		return ipnet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid network %q: must be a CIDR or an IP address", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAddr can be used before the client identity is known, e.g. before a handshake:
+// it rejects addresses from which no identity may connect.
+func (n *ClientNetworks) CheckAddr(addr net.Addr) error {
+	if n == nil || !n.allRestricted {
+		return nil
+	}
+	ip := addrIP(addr)
+	if ip == nil || !containsIP(n.union, ip) {
+		return errors.Errorf("no client identity may connect from %s", addr)
+	}
+	return nil
+}
+
+// Check returns an error if identity must not connect from addr.
+func (n *ClientNetworks) Check(identity string, addr net.Addr) error {
+	if n == nil {
+		return nil
+	}
+	networks, ok := n.byIdentity[identity]
+	if !ok {
+		return nil
+	}
+	ip := addrIP(addr)
+	if ip == nil || !containsIP(networks, ip) {
+		return errors.Errorf("client identity %q must not connect from %s", identity, addr)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 4242}
+}
+
+func TestClientNetworks(t *testing.T) {
+	n, err := ClientNetworksFromConfig(map[string][]string{
+		"laptop": {"192.168.0.0/24", "2001:db8::/32"},
+		"server": {"10.0.0.1"},
+	}, []string{"laptop", "server", "unrestricted"})
+	require.NoError(t, err)
+
+	assert.NoError(t, n.Check("laptop", tcpAddr("192.168.0.23")))
+	assert.NoError(t, n.Check("laptop", tcpAddr("2001:db8::1")))
+	assert.Error(t, n.Check("laptop", tcpAddr("10.0.0.1")))
+	assert.NoError(t, n.Check("server", tcpAddr("10.0.0.1")))
+	assert.Error(t, n.Check("server", tcpAddr("10.0.0.2")))
+	assert.NoError(t, n.Check("unrestricted", tcpAddr("10.0.0.2")))
+
+	// "unrestricted" may connect from anywhere
+	assert.NoError(t, n.CheckAddr(tcpAddr("172.16.0.1")))
+}
+
+func TestClientNetworksCheckAddr(t *testing.T) {
+	n, err := ClientNetworksFromConfig(map[string][]string{
+		"laptop": {"192.168.0.0/24"},
+		"server": {"10.0.0.1"},
+	}, []string{"laptop", "server"})
+	require.NoError(t, err)
+
+	assert.NoError(t, n.CheckAddr(tcpAddr("192.168.0.23")))
+	assert.NoError(t, n.CheckAddr(tcpAddr("10.0.0.1")))
+	assert.Error(t, n.CheckAddr(tcpAddr("172.16.0.1")))
+}
+
+func TestClientNetworksFromConfig(t *testing.T) {
+	n, err := ClientNetworksFromConfig(nil, []string{"laptop"})
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	assert.NoError(t, n.CheckAddr(tcpAddr("172.16.0.1")))
+	assert.NoError(t, n.Check("laptop", tcpAddr("172.16.0.1")))
+
+	for _, in := range []map[string][]string{
+		{"typo": {"10.0.0.0/8"}},
+		{"laptop": {}},
+		{"laptop": {"10.0.0.0/33"}},
+		{"laptop": {"not-an-address"}},
+	} {
+		_, err := ClientNetworksFromConfig(in, []string{"laptop"})
+		assert.Error(t, err, "%v", in)
+	}
+}
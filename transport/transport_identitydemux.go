@@ -0,0 +1,244 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdentityDemux shares one AuthenticatedListener between several consumers,
+// e.g. jobs, that serve disjoint sets of client identities.
+// Accepted connections are handed to the consumer that serves the connection's client identity.
+//
+// The shared listener is created by the first consumer that starts listening
+// and closed when the last consumer closes its listener.
+type IdentityDemux struct {
+	lf AuthenticatedListenerFactory
+	// what is routed by, for error messages
+	what string
+	key  func(*AuthConn) string
+
+	mtx       sync.Mutex
+	consumers []*identityDemuxListener
+	listener  AuthenticatedListener // nil if no consumer is listening
+	stop      context.CancelFunc    // nil until the first Accept of a consumer starts the accept loop
+	// accept errors of the shared listener, returned by the Accept of any consumer
+	errs chan error
+}
+
+func NewIdentityDemux(lf AuthenticatedListenerFactory) *IdentityDemux {
+	return NewDemux(lf, "client identity", (*AuthConn).ClientIdentity)
+}
+
+// NewDemux is like NewIdentityDemux, but routes connections by key(conn) instead of their client identity.
+// what describes the key in error messages.
+func NewDemux(lf AuthenticatedListenerFactory, what string, key func(*AuthConn) string) *IdentityDemux {
+	return &IdentityDemux{lf: lf, what: what, key: key, errs: make(chan error)}
+}
+
+// IdentityMatches reports whether identity matches pattern, e.g. of a consumer of an IdentityDemux.
+// Patterns may contain one '*' placeholder, see the tcp transport's clients field.
+func IdentityMatches(pattern, identity string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i == -1 {
+		return pattern == identity
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return len(identity) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(identity, prefix) && strings.HasSuffix(identity, suffix)
+}
+
+// ListenerFactory registers a consumer for the given client identities (or keys, see NewDemux).
+// Identities must not be registered by another consumer.
+func (d *IdentityDemux) ListenerFactory(identities []string) (AuthenticatedListenerFactory, error) {
+	if len(identities) == 0 {
+		return nil, errors.Errorf("consumer must serve at least one %s", d.what)
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, c := range d.consumers {
+		for _, theirs := range c.identities {
+			for _, ours := range identities {
+				if theirs == ours {
+					return nil, errors.Errorf("%s %q is already served by another consumer", d.what, ours)
+				}
+			}
+		}
+	}
+	c := &identityDemuxListener{
+		d:          d,
+		identities: identities,
+		conns:      make(chan *AuthConn),
+	}
+	d.consumers = append(d.consumers, c)
+	return c.listen, nil
+}
+
+// route returns the listening consumer that serves identity and its closed channel, or an error.
+func (d *IdentityDemux) route(identity string) (*identityDemuxListener, <-chan struct{}, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var match *identityDemuxListener
+	for _, c := range d.consumers {
+		for _, pattern := range c.identities {
+			if !IdentityMatches(pattern, identity) {
+				continue
+			}
+			if match != nil && match != c {
+				return nil, nil, errors.Errorf("%s %q is ambiguous, it is served by more than one consumer", d.what, identity)
+			}
+			match = c
+		}
+	}
+	if match == nil {
+		return nil, nil, errors.Errorf("no consumer serves %s %q", d.what, identity)
+	}
+	if match.closed == nil {
+		return nil, nil, errors.Errorf("consumer for %s %q is not listening", d.what, identity)
+	}
+	return match, match.closed, nil
+}
+
+func (d *IdentityDemux) acceptLoop(ctx context.Context, l AuthenticatedListener) {
+	deliverErr := func(err error) bool {
+		select {
+		case d.errs <- err:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		conn, err := l.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !deliverErr(err) {
+				return
+			}
+			continue
+		}
+		c, closed, err := d.route(d.key(conn))
+		if err != nil {
+			conn.Close()
+			if !deliverErr(errors.Wrapf(err, "connection from %s", conn.RemoteAddr())) {
+				return
+			}
+			continue
+		}
+		// don't block the other consumers if c is slow to accept
+		go func(c *identityDemuxListener, closed <-chan struct{}) {
+			select {
+			case c.conns <- conn:
+			case <-closed:
+				conn.Close()
+			}
+		}(c, closed)
+	}
+}
+
+type identityDemuxListener struct {
+	d          *IdentityDemux
+	identities []string
+	conns      chan *AuthConn
+	closed     chan struct{} // protected by d.mtx, nil if not listening
+}
+
+func (c *identityDemuxListener) listen() (AuthenticatedListener, error) {
+	d := c.d
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if c.closed != nil {
+		return nil, errors.New("already listening")
+	}
+	if d.listener == nil {
+		l, err := d.lf()
+		if err != nil {
+			return nil, err
+		}
+		d.listener = l
+	}
+	c.closed = make(chan struct{})
+	return &identityDemuxAcceptor{c, c.closed, d.listener.Addr()}, nil
+}
+
+// identityDemuxAcceptor is the AuthenticatedListener returned by a consumer's listener factory.
+type identityDemuxAcceptor struct {
+	c      *identityDemuxListener
+	closed chan struct{}
+	addr   net.Addr
+}
+
+var errIdentityDemuxListenerClosed = errors.New("listener closed")
+
+func (a *identityDemuxAcceptor) Accept(ctx context.Context) (*AuthConn, error) {
+	a.startAcceptLoop(ctx)
+	select {
+	case conn := <-a.c.conns:
+		return conn, nil
+	case err := <-a.c.d.errs:
+		return nil, err
+	case <-a.closed:
+		return nil, errIdentityDemuxListenerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startAcceptLoop starts accepting on the shared listener unless another consumer already did.
+// The accept loop outlives ctx, it only keeps its values, e.g. the logger of the job that accepts first.
+func (a *identityDemuxAcceptor) startAcceptLoop(ctx context.Context) {
+	d := a.c.d
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if a.c.closed != a.closed || d.listener == nil || d.stop != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(contextValues{ctx})
+	d.stop = cancel
+	go d.acceptLoop(ctx, d.listener)
+}
+
+// contextValues has the values of the wrapped context, but is never done
+type contextValues struct{ context.Context }
+
+func (contextValues) Deadline() (deadline time.Time, ok bool) { return time.Time{}, false }
+func (contextValues) Done() <-chan struct{}                   { return nil }
+func (contextValues) Err() error                              { return nil }
+
+func (a *identityDemuxAcceptor) Addr() net.Addr { return a.addr }
+
+func (a *identityDemuxAcceptor) Close() error {
+	d := a.c.d
+	d.mtx.Lock()
+	if a.c.closed != a.closed {
+		d.mtx.Unlock()
+		return errIdentityDemuxListenerClosed
+	}
+	close(a.closed)
+	a.c.closed = nil
+
+	var l AuthenticatedListener
+	listening := false
+	for _, c := range d.consumers {
+		listening = listening || c.closed != nil
+	}
+	if !listening {
+		l = d.listener
+		if d.stop != nil {
+			d.stop()
+		}
+		d.listener, d.stop = nil, nil
+	}
+	d.mtx.Unlock()
+
+	if l != nil {
+		return l.Close()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testWire struct{ net.Conn }
+
+func (w testWire) CloseWrite() error { return nil }
+
+// a listener that accepts the connections sent to its conns channel
+type testChanListener struct {
+	conns  chan *AuthConn
+	closed chan struct{}
+}
+
+func (l *testChanListener) Accept(ctx context.Context) (*AuthConn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errIdentityDemuxListenerClosed
+	}
+}
+
+func (l *testChanListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func (l *testChanListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func testConn(identity string) *AuthConn {
+	a, _ := net.Pipe()
+	return NewAuthConn(testWire{a}, identity)
+}
+
+func TestIdentityDemux(t *testing.T) {
+	var listens int32
+	var current *testChanListener
+	demux := NewIdentityDemux(func() (AuthenticatedListener, error) {
+		atomic.AddInt32(&listens, 1)
+		current = &testChanListener{make(chan *AuthConn), make(chan struct{})}
+		return current, nil
+	})
+
+	lfA, err := demux.ListenerFactory([]string{"alice", "office-*"})
+	require.NoError(t, err)
+	lfB, err := demux.ListenerFactory([]string{"bob"})
+	require.NoError(t, err)
+	_, err = demux.ListenerFactory([]string{"bob"})
+	assert.Error(t, err, "identities must be unique")
+
+	a, err := lfA()
+	require.NoError(t, err)
+	b, err := lfB()
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&listens), "consumers must share the listener")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	accept := func(l AuthenticatedListener) (string, error) {
+		conn, err := l.Accept(ctx)
+		if err != nil {
+			return "", err
+		}
+		return conn.ClientIdentity(), nil
+	}
+
+	// the shared listener is accepted from once a consumer accepts
+	go func(l *testChanListener) {
+		l.conns <- testConn("bob")
+		l.conns <- testConn("office-10.0.0.1")
+	}(current)
+	id, err := accept(b)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", id)
+	id, err = accept(a)
+	require.NoError(t, err)
+	assert.Equal(t, "office-10.0.0.1", id)
+
+	// unknown identities are rejected with an error returned to any consumer
+	go func(l *testChanListener) { l.conns <- testConn("mallory") }(current)
+	_, err = accept(a)
+	assert.Error(t, err)
+
+	// the shared listener is closed after the last consumer closed its listener
+	first := current
+	require.NoError(t, a.Close())
+	select {
+	case <-first.closed:
+		t.Fatal("listener must not be closed while b is listening")
+	default:
+	}
+	require.NoError(t, b.Close())
+	<-first.closed
+	assert.Error(t, b.Close())
+
+	// and listening again creates a new one
+	b, err = lfB()
+	require.NoError(t, err)
+	defer b.Close()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&listens))
+	go func(l *testChanListener) { l.conns <- testConn("alice") }(current)
+	_, err = accept(b)
+	assert.Error(t, err, "a is not listening")
+}
+
+func TestIdentityMatches(t *testing.T) {
+	assert.True(t, IdentityMatches("alice", "alice"))
+	assert.False(t, IdentityMatches("alice", "alice2"))
+	assert.True(t, IdentityMatches("office-*", "office-10.0.0.1"))
+	assert.True(t, IdentityMatches("*-server", "10.0.0.1-server"))
+	assert.False(t, IdentityMatches("office-*", "office-"))
+	assert.False(t, IdentityMatches("office-*", "home-10.0.0.1"))
+}
+
+type testCtxKey struct{}
+
+// a listener that reports the context of its Accept
+type testCtxListener struct {
+	testChanListener
+	ctxs chan context.Context
+}
+
+func (l *testCtxListener) Accept(ctx context.Context) (*AuthConn, error) {
+	l.ctxs <- ctx
+	return l.testChanListener.Accept(ctx)
+}
+
+func TestIdentityDemuxAcceptContext(t *testing.T) {
+	l := &testCtxListener{testChanListener{make(chan *AuthConn), make(chan struct{})}, make(chan context.Context, 1)}
+	demux := NewIdentityDemux(func() (AuthenticatedListener, error) { return l, nil })
+	lf, err := demux.ListenerFactory([]string{"alice"})
+	require.NoError(t, err)
+	consumer, err := lf()
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), testCtxKey{}, "job"), 100*time.Millisecond)
+	defer cancel()
+	_, err = consumer.Accept(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	acceptCtx := <-l.ctxs
+	assert.Equal(t, "job", acceptCtx.Value(testCtxKey{}), "the shared listener must accept with the values of the consumer's context")
+	assert.NoError(t, acceptCtx.Err(), "the shared listener must outlive the consumer's Accept")
+}
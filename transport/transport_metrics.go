@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
+)
+
+// Metrics instruments the Connecters or the AuthenticatedListener of a job.
+// The metrics are labeled by peer, which is the address that was connected to on the active side
+// and the client identity on the passive side.
+//
+// Note that the RPC layer establishes a new connection per data request, and that the control connection
+// is re-established after errors, hence the number of connections includes reconnects.
+type Metrics struct {
+	bytesSent      *prometheus.CounterVec
+	bytesReceived  *prometheus.CounterVec
+	connections    *prometheus.CounterVec
+	connectErrors  *prometheus.CounterVec
+	connectSeconds *prometheus.HistogramVec
+	acceptErrors   prometheus.Counter
+}
+
+func NewMetrics(jobName string) *Metrics {
+	labels := prometheus.Labels{"zrepl_job": jobName}
+	return &Metrics{
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "bytes_sent",
+			Help:        "number of bytes sent to the peer",
+			ConstLabels: labels,
+		}, []string{"peer"}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "bytes_received",
+			Help:        "number of bytes received from the peer",
+			ConstLabels: labels,
+		}, []string{"peer"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "connections",
+			Help:        "number of connections established to (active side) or accepted from (passive side) the peer",
+			ConstLabels: labels,
+		}, []string{"peer"}),
+		connectErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "connect_errors",
+			Help:        "number of failed attempts to connect to the peer, including failed TLS or SSH handshakes",
+			ConstLabels: labels,
+		}, []string{"peer"}),
+		connectSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "connect_seconds",
+			Help:        "time it took to establish a connection to the peer, including the TLS or SSH handshake",
+			ConstLabels: labels,
+		}, []string{"peer"}),
+		acceptErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "zrepl",
+			Subsystem:   "transport",
+			Name:        "accept_errors",
+			Help:        "number of connections that were not accepted, e.g., due to failed TLS handshakes or client networks",
+			ConstLabels: labels,
+		}),
+	}
+}
+
+func (m *Metrics) Register(registerer prometheus.Registerer) {
+	registerer.MustRegister(m.bytesSent)
+	registerer.MustRegister(m.bytesReceived)
+	registerer.MustRegister(m.connections)
+	registerer.MustRegister(m.connectErrors)
+	registerer.MustRegister(m.connectSeconds)
+	registerer.MustRegister(m.acceptErrors)
+}
+
+type meteredWire struct {
+	Wire
+	sent, received prometheus.Counter
+}
+
+func (m *Metrics) meteredWire(w Wire, peer string) *meteredWire {
+	return &meteredWire{
+		Wire:     w,
+		sent:     m.bytesSent.WithLabelValues(peer),
+		received: m.bytesReceived.WithLabelValues(peer),
+	}
+}
+
+func (w *meteredWire) Read(p []byte) (int, error) {
+	n, err := w.Wire.Read(p)
+	w.received.Add(float64(n))
+	return n, err
+}
+
+func (w *meteredWire) Write(p []byte) (int, error) {
+	n, err := w.Wire.Write(p)
+	w.sent.Add(float64(n))
+	return n, err
+}
+
+var _ timeoutconn.BuffersWriter = (*meteredWire)(nil)
+
+// WriteBuffers preserves the writev support of the wrapped Wire.
+func (w *meteredWire) WriteBuffers(bufs *net.Buffers) (n int64, err error) {
+	if bw, ok := w.Wire.(timeoutconn.BuffersWriter); ok {
+		n, err = bw.WriteBuffers(bufs)
+	} else {
+		n, err = bufs.WriteTo(w.Wire)
+	}
+	w.sent.Add(float64(n))
+	return n, err
+}
+
+var _ timeoutconn.SyscallConner = (*meteredWire)(nil)
+var _ timeoutconn.ReadvObserver = (*meteredWire)(nil)
+
+// SyscallConn preserves vectored I/O support of the wrapped Wire, see ObserveReadv.
+func (w *meteredWire) SyscallConn() (syscall.RawConn, error) {
+	scc, ok := w.Wire.(timeoutconn.SyscallConner)
+	if !ok {
+		return nil, timeoutconn.SyscallConnNotSupported
+	}
+	return scc.SyscallConn()
+}
+
+func (w *meteredWire) ObserveReadv(n int64) {
+	w.received.Add(float64(n))
+}
+
+type meteredConnecter struct {
+	m    *Metrics
+	cn   Connecter
+	peer string
+}
+
+// Connecter instruments the connections established by cn to peer.
+func (m *Metrics) Connecter(cn Connecter, peer string) Connecter {
+	return meteredConnecter{m, cn, peer}
+}
+
+func (c meteredConnecter) Connect(ctx context.Context) (Wire, error) {
+	begin := time.Now()
+	wire, err := c.cn.Connect(ctx)
+	if err != nil {
+		c.m.connectErrors.WithLabelValues(c.peer).Inc()
+		return nil, err
+	}
+	c.m.connectSeconds.WithLabelValues(c.peer).Observe(time.Since(begin).Seconds())
+	c.m.connections.WithLabelValues(c.peer).Inc()
+	return c.m.meteredWire(wire, c.peer), nil
+}
+
+type meteredListener struct {
+	m *Metrics
+	AuthenticatedListener
+}
+
+// ListenerFactory instruments the connections accepted by the listeners created by lf.
+func (m *Metrics) ListenerFactory(lf AuthenticatedListenerFactory) AuthenticatedListenerFactory {
+	return func() (AuthenticatedListener, error) {
+		l, err := lf()
+		if err != nil {
+			return nil, err
+		}
+		return meteredListener{m, l}, nil
+	}
+}
+
+func (l meteredListener) Accept(ctx context.Context) (*AuthConn, error) {
+	conn, err := l.AuthenticatedListener.Accept(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			l.m.acceptErrors.Inc()
+		}
+		return nil, err
+	}
+	identity := conn.ClientIdentity()
+	l.m.connections.WithLabelValues(identity).Inc()
+	return NewAuthConn(l.m.meteredWire(conn.Wire, identity), identity), nil
+}
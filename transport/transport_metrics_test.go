@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConnecter struct {
+	wire Wire
+	err  error
+}
+
+func (c testConnecter) Connect(ctx context.Context) (Wire, error) { return c.wire, c.err }
+
+func TestMetricsConnecter(t *testing.T) {
+	m := NewMetrics("job")
+	a, b := net.Pipe()
+	defer b.Close()
+	go func() {
+		buf := make([]byte, 5)
+		io.ReadFull(b, buf)
+		b.Write([]byte("bar"))
+	}()
+
+	cn := m.Connecter(testConnecter{wire: testWire{a}}, "peer1:8888")
+	w, err := cn.Connect(context.Background())
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(w, buf)
+	require.NoError(t, err)
+	w.(*meteredWire).ObserveReadv(2)
+	require.NoError(t, w.Close())
+
+	_, err = m.Connecter(testConnecter{err: errors.New("refused")}, "peer1:8888").Connect(context.Background())
+	require.Error(t, err)
+
+	assert.Equal(t, float64(5), testutil.ToFloat64(m.bytesSent.WithLabelValues("peer1:8888")))
+	assert.Equal(t, float64(3+2), testutil.ToFloat64(m.bytesReceived.WithLabelValues("peer1:8888")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.connections.WithLabelValues("peer1:8888")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.connectErrors.WithLabelValues("peer1:8888")))
+}
+
+func TestMetricsListener(t *testing.T) {
+	m := NewMetrics("job")
+	inner := &testChanListener{make(chan *AuthConn, 1), make(chan struct{})}
+	lf := m.ListenerFactory(func() (AuthenticatedListener, error) { return inner, nil })
+	l, err := lf()
+	require.NoError(t, err)
+
+	a, b := net.Pipe()
+	defer b.Close()
+	go b.Write([]byte("hi"))
+	inner.conns <- NewAuthConn(testWire{a}, "client1")
+	conn, err := l.Accept(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "client1", conn.ClientIdentity())
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	conn.ObserveReadv(40) // AuthConn forwards to the metered wire
+
+	require.NoError(t, l.Close())
+	_, err = l.Accept(context.Background())
+	require.Error(t, err)
+
+	assert.Equal(t, float64(2+40), testutil.ToFloat64(m.bytesReceived.WithLabelValues("client1")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.connections.WithLabelValues("client1")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.acceptErrors))
+}
+
+// buffersWire records the calls of WriteBuffers
+type buffersWire struct {
+	testWire
+	calls int
+}
+
+func (w *buffersWire) WriteBuffers(bufs *net.Buffers) (int64, error) {
+	w.calls++
+	return bufs.WriteTo(w.testWire)
+}
+
+func TestMeteredWireWriteBuffers(t *testing.T) {
+	m := NewMetrics("job")
+	a, b := net.Pipe()
+	defer b.Close()
+	go io.Copy(ioutil.Discard, b)
+
+	inner := &buffersWire{testWire: testWire{a}}
+	conn := NewAuthConn(m.meteredWire(inner, "client1"), "client1")
+	// timeoutconn.Conn.WritevFull hands the buffers to the outermost Wire
+	bufs := net.Buffers{[]byte("head"), []byte("payload")}
+	n, err := conn.WriteBuffers(&bufs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	assert.Empty(t, bufs)
+	assert.Equal(t, 1, inner.calls, "the buffers must reach the wrapped Wire in one call")
+	assert.Equal(t, float64(11), testutil.ToFloat64(m.bytesSent.WithLabelValues("client1")))
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+// SocketOptionsFromConfig validates the socket options of a tcp or tls transport.
+func SocketOptionsFromConfig(in *config.TCPSocketOptions) (tcpsock.SocketOptions, error) {
+	if in == nil {
+		return tcpsock.SocketOptions{}, nil
+	}
+	bufferSize := func(field, s string) (int, error) {
+		if s == "" {
+			return 0, nil
+		}
+		n, err := bandwidthlimit.ParseSize(s)
+		if err != nil {
+			return 0, errors.Wrapf(err, "field `%s`", field)
+		}
+		if n <= 0 || n > math.MaxInt32 {
+			return 0, errors.Errorf("field `%s` must be positive and less than 2GiB, got %q", field, s)
+		}
+		return int(n), nil
+	}
+	var o tcpsock.SocketOptions
+	var err error
+	if o.SendBuffer, err = bufferSize("send_buffer", in.SendBuffer); err != nil {
+		return o, err
+	}
+	if o.ReceiveBuffer, err = bufferSize("receive_buffer", in.ReceiveBuffer); err != nil {
+		return o, err
+	}
+	o.Nagle = !in.NoDelay
+	if in.CongestionControl != "" && !tcpsock.CongestionControlSupported {
+		return o, errors.New("field `congestion_control` is not supported on this platform")
+	}
+	o.CongestionControl = in.CongestionControl
+	return o, nil
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/util/tcpsock"
+)
+
+func TestSocketOptionsFromConfig(t *testing.T) {
+	o, err := SocketOptionsFromConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tcpsock.SocketOptions{}, o)
+
+	defaults := &config.TCPSocketOptions{}
+	config.Default(defaults)
+	o, err = SocketOptionsFromConfig(defaults)
+	require.NoError(t, err)
+	assert.Equal(t, tcpsock.SocketOptions{}, o, "defaults must not change the socket")
+
+	o, err = SocketOptionsFromConfig(&config.TCPSocketOptions{SendBuffer: "4MiB", ReceiveBuffer: "16MiB", NoDelay: false})
+	require.NoError(t, err)
+	assert.Equal(t, tcpsock.SocketOptions{SendBuffer: 4 << 20, ReceiveBuffer: 16 << 20, Nagle: true}, o)
+
+	for _, in := range []config.TCPSocketOptions{
+		{NoDelay: true, SendBuffer: "4 potatoes"},
+		{NoDelay: true, ReceiveBuffer: "0B"},
+		{NoDelay: true, ReceiveBuffer: "2GiB"},
+	} {
+		_, err := SocketOptionsFromConfig(&in)
+		assert.Error(t, err, "%#v", in)
+	}
+
+	_, err = SocketOptionsFromConfig(&config.TCPSocketOptions{NoDelay: true, CongestionControl: "bbr"})
+	if tcpsock.CongestionControlSupported {
+		assert.NoError(t, err)
+	} else {
+		assert.Error(t, err)
+	}
+}
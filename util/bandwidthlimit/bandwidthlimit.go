@@ -0,0 +1,195 @@
+// Package bandwidthlimit implements a token-bucket rate limiter for byte streams
+// whose rate can be changed while streams are being limited.
+package bandwidthlimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that refills at a rate of Rate() bytes per second.
+// The bucket holds at most one second worth of tokens.
+// A rate of 0 means no limit.
+//
+// A Limiter is safe for concurrent use. Streams that share a Limiter share its rate.
+type Limiter struct {
+	mtx     sync.Mutex
+	rate    int64
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // closed and replaced by SetRate
+}
+
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	l := &Limiter{changed: make(chan struct{})}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// Rate returns the current rate in bytes per second, 0 means no limit.
+func (l *Limiter) Rate() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.rate
+}
+
+// SetRate changes the rate in bytes per second, 0 or less means no limit.
+// Streams that are currently waiting for tokens re-evaluate their wait time.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.rate = bytesPerSecond
+	l.tokens = 0
+	l.last = time.Now()
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// maximum number of bytes that a single WaitN call may request
+func (l *Limiter) burst() int64 {
+	if l.rate == 0 {
+		return 1 << 20
+	}
+	return l.rate
+}
+
+// WaitN blocks until n bytes may be transferred or ctx is done.
+// Readers use chunkSize to keep n within the bucket size, but the rate may have been lowered since,
+// so WaitN takes the tokens in pieces of at most the bucket size.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	remaining := int64(n)
+	for remaining > 0 {
+		l.mtx.Lock()
+		if l.rate == 0 {
+			l.mtx.Unlock()
+			return nil
+		}
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if max := float64(l.burst()); l.tokens > max {
+			l.tokens = max
+		}
+		l.last = now
+		piece := remaining
+		if b := l.burst(); piece > b {
+			piece = b
+		}
+		if l.tokens >= float64(piece) {
+			l.tokens -= float64(piece)
+			remaining -= piece
+			l.mtx.Unlock()
+			continue
+		}
+		wait := time.Duration((float64(piece) - l.tokens) / float64(l.rate) * float64(time.Second))
+		changed := l.changed
+		l.mtx.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-changed:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) chunkSize(max int) int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if b := l.burst(); int64(max) > b {
+		return int(b)
+	}
+	return max
+}
+
+type readCloser struct {
+	ctx context.Context
+	rc  io.ReadCloser
+	l   *Limiter
+}
+
+// WrapReadCloser limits the rate at which rc can be read to the rate of l.
+// ctx bounds the time that Read blocks for rate limiting.
+func WrapReadCloser(ctx context.Context, rc io.ReadCloser, l *Limiter) io.ReadCloser {
+	return &readCloser{ctx, rc, l}
+}
+
+func (r *readCloser) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.rc.Read(p)
+	}
+	n, err := r.rc.Read(p[:r.l.chunkSize(len(p))])
+	if n > 0 {
+		if werr := r.l.WaitN(r.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (r *readCloser) Close() error {
+	return r.rc.Close()
+}
+
+var sizeRegex = regexp.MustCompile(`^(\d+)\s*([KMGT]i?B|B)$`)
+
+var sizeUnits = map[string]int64{
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// ParseRate parses a rate such as `50MiB/s` or `unlimited` into bytes per second.
+// `unlimited` and `0B/s` are returned as 0.
+func ParseRate(s string) (bytesPerSecond int64, err error) {
+	s = strings.TrimSpace(s)
+	if s == "unlimited" {
+		return 0, nil
+	}
+	size := strings.TrimSuffix(s, "/s")
+	if size == s {
+		return 0, fmt.Errorf("invalid rate %q, expecting `unlimited` or a number followed by B/s, KiB/s, MiB/s, GiB/s, TiB/s, KB/s, MB/s, GB/s or TB/s", s)
+	}
+	bytesPerSecond, err = ParseSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, expecting `unlimited` or a number followed by B/s, KiB/s, MiB/s, GiB/s, TiB/s, KB/s, MB/s, GB/s or TB/s", s)
+	}
+	return bytesPerSecond, nil
+}
+
+// ParseSize parses a size such as `500GiB` into bytes.
+func ParseSize(s string) (bytes int64, err error) {
+	s = strings.TrimSpace(s)
+	m := sizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q, expecting a number followed by B, KiB, MiB, GiB, TiB, KB, MB, GB or TB", s)
+	}
+	num, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %s", s, err)
+	}
+	unit := sizeUnits[m[2]]
+	if num > (1<<63-1)/unit {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return num * unit, nil
+}
@@ -0,0 +1,129 @@
+package bandwidthlimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	tcs := []struct {
+		in     string
+		expect int64
+		err    bool
+	}{
+		{"unlimited", 0, false},
+		{"0B/s", 0, false},
+		{"100B/s", 100, false},
+		{"50MiB/s", 50 << 20, false},
+		{"50 MiB/s", 50 << 20, false},
+		{"2GiB/s", 2 << 30, false},
+		{"10MB/s", 10 * 1000 * 1000, false},
+		{"1KiB/s", 1024, false},
+		{"50MiB", 0, true},
+		{"50mib/s", 0, true},
+		{"-1MiB/s", 0, true},
+		{"", 0, true},
+		{"99999999999TiB/s", 0, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.in, func(t *testing.T) {
+			r, err := ParseRate(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, r)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	r, err := ParseSize("500GiB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(500<<30), r)
+	r, err = ParseSize("1 TB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000*1000*1000*1000), r)
+	for _, in := range []string{"", "500", "500GiB/s", "-1B", "unlimited", "99999999999TiB"} {
+		_, err := ParseSize(in)
+		assert.Error(t, err, "%q", in)
+	}
+}
+
+func TestLimiterReadCloser(t *testing.T) {
+	const rate = 1 << 20
+	l := NewLimiter(rate)
+	data := make([]byte, rate/2)
+	rc := WrapReadCloser(context.Background(), ioutil.NopCloser(bytes.NewReader(data)), l)
+
+	begin := time.Now()
+	n, err := io.Copy(ioutil.Discard, rc)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	took := time.Since(begin)
+	assert.True(t, took > 400*time.Millisecond, "%v", took)
+	assert.True(t, took < 2*time.Second, "%v", took)
+}
+
+func TestLimiterSetRateWakesWaiters(t *testing.T) {
+	l := NewLimiter(1) // the first byte is available after 1s
+	done := make(chan error)
+	go func() {
+		done <- l.WaitN(context.Background(), 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	l.SetRate(0)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("SetRate did not wake up waiter")
+	}
+}
+
+func TestLimiterWaitNContextCancel(t *testing.T) {
+	l := NewLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := l.WaitN(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// setRateReader lowers the rate of l while the limited reader is reading
+type setRateReader struct {
+	io.Reader
+	l    *Limiter
+	rate int64
+}
+
+func (r *setRateReader) Read(p []byte) (int, error) {
+	r.l.SetRate(r.rate)
+	return r.Reader.Read(p)
+}
+
+func TestLimiterSetRateDuringRead(t *testing.T) {
+	l := NewLimiter(1 << 20)
+	data := make([]byte, 150)
+	// the chunk is sized for the old rate but exceeds the bucket size of the new one
+	rc := WrapReadCloser(context.Background(), ioutil.NopCloser(&setRateReader{bytes.NewReader(data), l, 100}), l)
+	done := make(chan error)
+	go func() {
+		n, err := rc.Read(make([]byte, len(data)))
+		assert.Equal(t, len(data), n)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read hangs after lowering the rate")
+	}
+}
@@ -0,0 +1,56 @@
+package bytecounter
+
+import (
+	"sync"
+	"time"
+)
+
+// Throughput computes the throughput of a monotonically increasing byte count
+// over a sliding window from samples of the count.
+//
+// Samples are taken by the caller, e.g. whenever a status report is generated,
+// so there is no background activity if nobody is interested in the throughput.
+type Throughput struct {
+	window time.Duration
+
+	mtx     sync.Mutex
+	samples []throughputSample // ascending by time
+}
+
+type throughputSample struct {
+	time  time.Time
+	count int64
+}
+
+// samples closer to each other than this are coalesced
+const throughputSampleInterval = time.Second
+
+func NewThroughput(window time.Duration) *Throughput {
+	return &Throughput{window: window}
+}
+
+// Sample records count at time now and returns the throughput in bytes per second
+// over the window that ends at now. Returns 0 until two samples are available.
+func (t *Throughput) Sample(now time.Time, count int64) int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if n := len(t.samples); n == 0 || now.Sub(t.samples[n-1].time) >= throughputSampleInterval {
+		t.samples = append(t.samples, throughputSample{now, count})
+	}
+	// drop samples that are outside of the window, but keep the oldest one
+	// if there is no other sample to compute the throughput from
+	windowStart := now.Add(-t.window)
+	drop := 0
+	for drop < len(t.samples)-1 && t.samples[drop].time.Before(windowStart) {
+		drop++
+	}
+	t.samples = t.samples[drop:]
+
+	oldest := t.samples[0]
+	deltaT := now.Sub(oldest.time).Seconds()
+	if deltaT <= 0 {
+		return 0
+	}
+	return int64(float64(count-oldest.count) / deltaT)
+}
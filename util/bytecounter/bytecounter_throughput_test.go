@@ -0,0 +1,24 @@
+package bytecounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughput(t *testing.T) {
+	tp := NewThroughput(10 * time.Second)
+	begin := time.Unix(1000, 0)
+	at := func(secs float64) time.Time { return begin.Add(time.Duration(secs * float64(time.Second))) }
+
+	assert.Equal(t, int64(0), tp.Sample(at(0), 0), "a single sample has no throughput")
+	assert.Equal(t, int64(100), tp.Sample(at(1), 100))
+	assert.Equal(t, int64(100), tp.Sample(at(1.5), 150), "samples within the sample interval are coalesced")
+	assert.Len(t, tp.samples, 2)
+	assert.Equal(t, int64(100), tp.Sample(at(10), 1000))
+
+	// the window slides: only the last 10 seconds are considered
+	assert.Equal(t, int64(1000), tp.Sample(at(20), 11000))
+	assert.Equal(t, int64(0), tp.Sample(at(31), 11000), "stalled stream")
+}
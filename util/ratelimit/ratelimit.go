@@ -0,0 +1,56 @@
+// Package ratelimit implements a token bucket rate limiter.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that holds at most the tokens of one period.
+type Limiter struct {
+	mtx    sync.Mutex
+	rate   float64 // tokens per second
+	max    float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter that allows perPeriod tokens per period, and starts full.
+func New(perPeriod int, period time.Duration) *Limiter {
+	return &Limiter{
+		rate:   float64(perPeriod) / period.Seconds(),
+		max:    float64(perPeriod),
+		tokens: float64(perPeriod),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until n tokens are available and takes them, or returns ctx.Err() if ctx is done before.
+// n must not exceed the tokens of one period.
+func (l *Limiter) Wait(ctx context.Context, n float64) error {
+	for {
+		l.mtx.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.max {
+			l.tokens = l.max
+		}
+		l.last = now
+		if l.tokens >= n {
+			l.tokens -= n
+			l.mtx.Unlock()
+			return nil
+		}
+		wait := time.Duration((n - l.tokens) / l.rate * float64(time.Second))
+		l.mtx.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
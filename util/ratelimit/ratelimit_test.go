@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := New(10, 100*time.Millisecond)
+
+	begin := time.Now()
+	require.NoError(t, l.Wait(ctx, 10))
+	assert.True(t, time.Since(begin) < 50*time.Millisecond, "the bucket starts full")
+
+	require.NoError(t, l.Wait(ctx, 5))
+	assert.True(t, time.Since(begin) >= 50*time.Millisecond)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(timeoutCtx, 10))
+}
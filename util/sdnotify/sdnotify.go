@@ -0,0 +1,63 @@
+// Package sdnotify implements the parts of the systemd service notification protocol (sd_notify(3))
+// and the service watchdog (sd_watchdog_enabled(3)) that the daemon uses.
+// Without the environment variables that systemd sets for Type=notify services, everything is a no-op.
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state to the service manager, see sd_notify(3).
+// It returns false and no error if the process is not supervised, i.e., NOTIFY_SOCKET is unset.
+func Notify(state string) (sent bool, err error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+	// leading @ denotes a Linux abstract socket, which package net expects to start with the @, too
+	addr := &net.UnixAddr{Name: path, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval within which the service manager expects
+// a Watchdog notification, see sd_watchdog_enabled(3).
+// It returns 0 and no error if the watchdog is not enabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return 0, nil
+	}
+	usec, err := strconv.ParseUint(usecStr, 10, 63)
+	if err != nil || usec == 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usecStr)
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID %q", pidStr)
+		}
+		if pid != os.Getpid() {
+			// the watchdog is meant for another process, e.g., our parent
+			return 0, nil
+		}
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
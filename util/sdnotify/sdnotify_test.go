@@ -0,0 +1,80 @@
+package sdnotify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	os.Unsetenv("NOTIFY_SOCKET")
+	sent, err := Notify(Ready)
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	dir, err := ioutil.TempDir("", "zrepl-sdnotify-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	for _, state := range []string{Ready, Watchdog, Stopping} {
+		sent, err := Notify(state)
+		require.NoError(t, err)
+		assert.True(t, sent)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, state, string(buf[:n]))
+	}
+
+	os.Setenv("NOTIFY_SOCKET", filepath.Join(dir, "nonexistent.sock"))
+	_, err = Notify(Ready)
+	assert.Error(t, err)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	type tc struct {
+		usec, pid string
+		interval  time.Duration
+		err       bool
+	}
+	self := strconv.Itoa(os.Getpid())
+	tcs := []tc{
+		{usec: "", pid: "", interval: 0},
+		{usec: "30000000", pid: "", interval: 30 * time.Second},
+		{usec: "30000000", pid: self, interval: 30 * time.Second},
+		{usec: "30000000", pid: strconv.Itoa(os.Getpid() + 1), interval: 0},
+		{usec: "0", pid: "", err: true},
+		{usec: "-1", pid: "", err: true},
+		{usec: "30s", pid: "", err: true},
+		{usec: "30000000", pid: "self", err: true},
+	}
+	for _, c := range tcs {
+		os.Setenv("WATCHDOG_USEC", c.usec)
+		os.Setenv("WATCHDOG_PID", c.pid)
+		interval, err := WatchdogInterval()
+		if c.err {
+			assert.Error(t, err, "%#v", c)
+			continue
+		}
+		assert.NoError(t, err, "%#v", c)
+		assert.Equal(t, c.interval, interval, "%#v", c)
+	}
+}
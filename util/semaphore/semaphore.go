@@ -18,18 +18,34 @@ func New(max int64) *S {
 
 type AcquireGuard struct {
 	s        *S
+	n        int64
 	released bool
 }
 
 // The returned AcquireGuard is not goroutine-safe.
 func (s *S) Acquire(ctx context.Context) (*AcquireGuard, error) {
+	return s.AcquireN(ctx, 1)
+}
+
+// AcquireN is Acquire for n units of s.
+// n must not exceed the max passed to New, otherwise AcquireN blocks until ctx is done.
+func (s *S) AcquireN(ctx context.Context, n int64) (*AcquireGuard, error) {
 	defer trace.WithSpanFromStackUpdateCtx(&ctx)()
-	if err := s.ws.Acquire(ctx, 1); err != nil {
+	if err := s.ws.Acquire(ctx, n); err != nil {
 		return nil, err
 	} else if err := ctx.Err(); err != nil {
+		s.ws.Release(n)
 		return nil, err
 	}
-	return &AcquireGuard{s, false}, nil
+	return &AcquireGuard{s, n, false}, nil
+}
+
+// TryAcquireN acquires n units of s without blocking, it returns nil if they are not available.
+func (s *S) TryAcquireN(n int64) *AcquireGuard {
+	if !s.ws.TryAcquire(n) {
+		return nil
+	}
+	return &AcquireGuard{s, n, false}
 }
 
 func (g *AcquireGuard) Release() {
@@ -37,5 +53,5 @@ func (g *AcquireGuard) Release() {
 		return
 	}
 	g.released = true
-	g.s.ws.Release(1)
+	g.s.ws.Release(g.n)
 }
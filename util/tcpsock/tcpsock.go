@@ -2,18 +2,24 @@ package tcpsock
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync"
 	"syscall"
 )
 
 func Listen(address string, tryFreeBind bool) (*net.TCPListener, error) {
+	return listen(address, tryFreeBind, SocketOptions{})
+}
+
+func listen(address string, tryFreeBind bool, opts SocketOptions) (*net.TCPListener, error) {
 	control := func(network, address string, c syscall.RawConn) error {
 		if tryFreeBind {
 			if err := freeBind(network, address, c); err != nil {
 				return err
 			}
 		}
-		return nil
+		return opts.control(network, address, c)
 	}
 	var listenConfig = net.ListenConfig{
 		Control: control,
@@ -25,3 +31,115 @@ func Listen(address string, tryFreeBind bool) (*net.TCPListener, error) {
 	}
 	return l.(*net.TCPListener), nil
 }
+
+// Listener is implemented by *net.TCPListener and by the listener returned by ListenAll.
+type Listener interface {
+	AcceptTCP() (*net.TCPConn, error)
+	Addr() net.Addr
+	Close() error
+}
+
+var _ Listener = (*net.TCPListener)(nil)
+
+// ListenAll listens on all addresses and accepts the connections of all of them.
+// The returned listener's Addr is the address of the first listener.
+func ListenAll(addresses []string, tryFreeBind bool, opts SocketOptions) (Listener, error) {
+	l, err := listenAll(addresses, tryFreeBind, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Nagle {
+		return socketOptionsListener{l, opts}, nil
+	}
+	return l, nil
+}
+
+func listenAll(addresses []string, tryFreeBind bool, opts SocketOptions) (Listener, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no listen addresses")
+	}
+	if len(addresses) == 1 {
+		l, err := listen(addresses[0], tryFreeBind, opts)
+		if err != nil {
+			return nil, err // avoid non-nil interface with nil value
+		}
+		return l, nil
+	}
+	m := &multiListener{
+		accepted: make(chan acceptResult),
+		closed:   make(chan struct{}),
+	}
+	for _, address := range addresses {
+		l, err := listen(address, tryFreeBind, opts)
+		if err != nil {
+			for _, l := range m.ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		m.ls = append(m.ls, l)
+	}
+	for _, l := range m.ls {
+		go m.acceptLoop(l)
+	}
+	return m, nil
+}
+
+type acceptResult struct {
+	conn *net.TCPConn
+	err  error
+}
+
+type multiListener struct {
+	ls        []*net.TCPListener
+	accepted  chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+func (m *multiListener) acceptLoop(l *net.TCPListener) {
+	for {
+		conn, err := l.AcceptTCP()
+		select {
+		case m.accepted <- acceptResult{conn, err}:
+		case <-m.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return
+		}
+	}
+}
+
+func (m *multiListener) AcceptTCP() (*net.TCPConn, error) {
+	select {
+	case r := <-m.accepted:
+		return r.conn, r.err
+	case <-m.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (m *multiListener) Addr() net.Addr { return m.ls[0].Addr() }
+
+func (m *multiListener) Close() error {
+	err := errListenerClosed
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		err = nil
+		for _, l := range m.ls {
+			if closeErr := l.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
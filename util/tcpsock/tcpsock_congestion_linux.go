@@ -0,0 +1,14 @@
+// +build linux
+
+package tcpsock
+
+import (
+	"syscall"
+)
+
+// CongestionControlSupported is false if SocketOptions.CongestionControl cannot be used on this platform.
+const CongestionControlSupported = true
+
+func setCongestionControl(fd uintptr, algorithm string) error {
+	return syscall.SetsockoptString(int(fd), syscall.IPPROTO_TCP, syscall.TCP_CONGESTION, algorithm)
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package tcpsock
+
+import (
+	"fmt"
+)
+
+// CongestionControlSupported is false if SocketOptions.CongestionControl cannot be used on this platform.
+const CongestionControlSupported = false
+
+func setCongestionControl(fd uintptr, algorithm string) error {
+	return fmt.Errorf("TCP_CONGESTION not supported on this platform")
+}
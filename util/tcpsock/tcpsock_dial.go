@@ -0,0 +1,218 @@
+package tcpsock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+
+	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
+)
+
+// Dialer dials TCP connections, either directly or through a SOCKS5 or HTTP (CONNECT) proxy.
+//
+// Unlike proxy.Dialer, it always returns the *net.TCPConn to the proxy or destination
+// (as part of a Conn) so that callers can rely on CloseWrite.
+type Dialer struct {
+	dialer net.Dialer
+	opts   SocketOptions
+	proxy  *url.URL // nil for direct connections
+	// the SOCKS5 handshake on an established connection to the proxy, nil if proxy is not socks5
+	socks5 socks5Handshaker
+}
+
+// Conn is a connection dialed by Dialer.
+// Reads return the data that an HTTP proxy sent along with its CONNECT response first,
+// e.g., the banner of an SSH server, which speaks first.
+type Conn struct {
+	*net.TCPConn
+	buffered io.Reader // nil if the proxy did not send such data
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.buffered != nil {
+		n, err := c.buffered.Read(p)
+		if err == io.EOF {
+			c.buffered, err = nil, nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return c.TCPConn.Read(p)
+}
+
+// SyscallConn lets timeoutconn fall back to Read while buffered data remains,
+// vectored I/O on the raw socket would skip it.
+func (c *Conn) SyscallConn() (syscall.RawConn, error) {
+	if c.buffered != nil {
+		return nil, timeoutconn.SyscallConnNotSupported
+	}
+	return c.TCPConn.SyscallConn()
+}
+
+type socks5Handshaker interface {
+	DialWithConn(ctx context.Context, c net.Conn, network, address string) (net.Addr, error)
+}
+
+// NewDialer returns a Dialer whose DialContext takes at most timeout (0 for no timeout),
+// including the proxy handshake.
+//
+// proxyURL is empty for direct connections, or socks5://[user:password@]host:port
+// or http://[user:password@]host:port.
+// If a proxy is used, opts apply to the connection to the proxy.
+func NewDialer(timeout time.Duration, proxyURL string, opts SocketOptions) (*Dialer, error) {
+	d := &Dialer{dialer: net.Dialer{Timeout: timeout, Control: opts.control}, opts: opts}
+	if proxyURL == "" {
+		return d, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse proxy URL")
+	}
+	if u.Host == "" || u.Port() == "" {
+		return nil, errors.Errorf("proxy URL must specify host and port, got %q", proxyURL)
+	}
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" {
+		return nil, errors.Errorf("proxy URL must not have a path or query, got %q", proxyURL)
+	}
+	switch u.Scheme {
+	case "socks5":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: password}
+		}
+		pd, err := proxy.SOCKS5("tcp", u.Host, auth, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create SOCKS5 dialer")
+		}
+		hs, ok := pd.(socks5Handshaker)
+		if !ok {
+			panic(fmt.Sprintf("implementation error: SOCKS5 dialer %T does not support DialWithConn", pd))
+		}
+		d.socks5 = hs
+	case "http":
+	default:
+		return nil, errors.Errorf("unsupported proxy URL scheme %q, must be one of socks5, http", u.Scheme)
+	}
+	d.proxy = u
+	return d, nil
+}
+
+func (d *Dialer) DialContext(ctx context.Context, address string) (*Conn, error) {
+	if d.dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.dialer.Timeout)
+		defer cancel()
+	}
+
+	if d.proxy == nil {
+		conn, err := d.dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		tcpConn := conn.(*net.TCPConn)
+		if err := d.opts.applyConn(tcpConn); err != nil {
+			tcpConn.Close()
+			return nil, err
+		}
+		return &Conn{TCPConn: tcpConn}, nil
+	}
+
+	conn, err := d.dialer.DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to proxy %s", d.proxy.Host)
+	}
+	tcpConn := conn.(*net.TCPConn)
+	if err := d.opts.applyConn(tcpConn); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	var buffered io.Reader
+	if d.socks5 != nil {
+		_, err = d.socks5.DialWithConn(ctx, tcpConn, "tcp", address)
+	} else {
+		buffered, err = d.httpConnect(ctx, tcpConn, address)
+	}
+	if err != nil {
+		tcpConn.Close()
+		return nil, errors.Wrapf(err, "cannot connect to %s through proxy %s", address, d.proxy.Host)
+	}
+	return &Conn{TCPConn: tcpConn, buffered: buffered}, nil
+}
+
+// httpConnect returns the data from the destination that the proxy sent along with its response, nil if none.
+func (d *Dialer) httpConnect(ctx context.Context, conn *net.TCPConn, address string) (io.Reader, error) {
+	if dl, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(dl); err != nil {
+			return nil, err
+		}
+	}
+	// interrupt the handshake if ctx is cancelled before its deadline
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+		conn.SetDeadline(time.Time{})
+	}()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(d.proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, errors.Wrap(err, "cannot send CONNECT request")
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Wrap(err, "cannot read CONNECT response")
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, errors.Errorf("proxy refused CONNECT: %s", res.Status)
+	}
+	// servers that speak first, e.g. SSH servers with their banner, may already have sent data
+	if n := br.Buffered(); n > 0 {
+		data, err := br.Peek(n)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read data after CONNECT response") // cannot happen
+		}
+		return bytes.NewReader(data), nil
+	}
+	return nil, nil
+}
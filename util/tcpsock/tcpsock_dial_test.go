@@ -0,0 +1,237 @@
+package tcpsock
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes the data of each connection until the client closes its write side.
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+// splice forwards data between a and b, including half-closes.
+func splice(a, b *net.TCPConn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src *net.TCPConn) {
+		_, _ = io.Copy(dst, src)
+		_ = dst.CloseWrite()
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	<-done
+	a.Close()
+	b.Close()
+}
+
+func proxyServer(t *testing.T, handshake func(conn *net.TCPConn) (target string, ok bool)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client := conn.(*net.TCPConn)
+				target, ok := handshake(client)
+				if !ok {
+					client.Close()
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					client.Close()
+					return
+				}
+				splice(client, upstream.(*net.TCPConn))
+			}()
+		}
+	}()
+	return l
+}
+
+// a SOCKS5 proxy that requires username "user" and password "secret"
+func socks5Handshake(conn *net.TCPConn) (string, bool) {
+	r := bufio.NewReader(conn)
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(r, buf); err != nil || buf[0] != 5 {
+		return "", false
+	}
+	methods := make([]byte, buf[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", false
+	}
+	if _, err := conn.Write([]byte{5, 2}); err != nil { // username / password
+		return "", false
+	}
+	readString := func() string {
+		l, _ := r.ReadByte()
+		s := make([]byte, l)
+		_, _ = io.ReadFull(r, s)
+		return string(s)
+	}
+	if v, _ := r.ReadByte(); v != 1 {
+		return "", false
+	}
+	if readString() != "user" || readString() != "secret" {
+		_, _ = conn.Write([]byte{1, 1})
+		return "", false
+	}
+	if _, err := conn.Write([]byte{1, 0}); err != nil {
+		return "", false
+	}
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(r, hdr); err != nil || hdr[1] != 1 || hdr[3] != 1 { // CONNECT to IPv4 address
+		return "", false
+	}
+	addr := make([]byte, 6)
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return "", false
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return "", false
+	}
+	return net.JoinHostPort(net.IP(addr[:4]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(addr[4:])))), true
+}
+
+// an HTTP proxy that requires username "user" and password "secret"
+func httpConnectHandshake(conn *net.TCPConn) (string, bool) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return "", false
+	}
+	if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+		_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		return "", false
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return "", false
+	}
+	return req.Host, true
+}
+
+func testEcho(t *testing.T, conn *Conn) {
+	defer conn.Close()
+	_, err := conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseWrite())
+	buf, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestDialer(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+	socks5 := proxyServer(t, socks5Handshake)
+	defer socks5.Close()
+	httpProxy := proxyServer(t, httpConnectHandshake)
+	defer httpProxy.Close()
+
+	tcs := []struct {
+		name      string
+		proxy     string
+		expectErr bool
+	}{
+		{"direct", "", false},
+		{"socks5", "socks5://user:secret@" + socks5.Addr().String(), false},
+		{"socks5_wrong_password", "socks5://user:wrong@" + socks5.Addr().String(), true},
+		{"http", "http://user:secret@" + httpProxy.Addr().String(), false},
+		{"http_no_credentials", "http://" + httpProxy.Addr().String(), true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewDialer(5*time.Second, tc.proxy, SocketOptions{})
+			require.NoError(t, err)
+			conn, err := d.DialContext(context.Background(), echo.Addr().String())
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			testEcho(t, conn)
+		})
+	}
+}
+
+func TestNewDialerInvalidProxy(t *testing.T) {
+	for _, p := range []string{
+		"https://proxy:3128",
+		"socks5://proxy",
+		"http://proxy:3128/path",
+		"proxy:3128",
+	} {
+		_, err := NewDialer(0, p, SocketOptions{})
+		assert.Error(t, err, p)
+	}
+}
+
+func TestDialerHTTPConnectDataAfterResponse(t *testing.T) {
+	echo := echoServer(t)
+	defer echo.Close()
+	// sends data on behalf of the target in the same write as the CONNECT response
+	httpProxy := proxyServer(t, func(conn *net.TCPConn) (string, bool) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			return "", false
+		}
+		if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nbanner")); err != nil {
+			return "", false
+		}
+		return req.Host, true
+	})
+	defer httpProxy.Close()
+
+	d, err := NewDialer(5*time.Second, "http://"+httpProxy.Addr().String(), SocketOptions{})
+	require.NoError(t, err)
+	conn, err := d.DialContext(context.Background(), echo.Addr().String())
+	require.NoError(t, err)
+	buf := make([]byte, len("banner"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "banner", string(buf))
+	testEcho(t, conn)
+}
+
+func TestDialerHTTPConnectTimeout(t *testing.T) {
+	// accepts but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	d, err := NewDialer(100*time.Millisecond, "http://"+l.Addr().String(), SocketOptions{})
+	require.NoError(t, err)
+	begin := time.Now()
+	_, err = d.DialContext(context.Background(), "127.0.0.1:1")
+	assert.Error(t, err)
+	assert.True(t, time.Since(begin) < 5*time.Second)
+}
@@ -0,0 +1,70 @@
+package tcpsock
+
+import (
+	"net"
+	"syscall"
+)
+
+// SocketOptions are applied to the sockets of a Dialer or of the listeners returned by ListenAll.
+// The zero value does not change the defaults of the operating system and Go.
+type SocketOptions struct {
+	// SO_SNDBUF and SO_RCVBUF in bytes, 0 for the operating system's default (and auto-tuning on Linux)
+	SendBuffer, ReceiveBuffer int
+	// enables Nagle's algorithm, i.e., disables TCP_NODELAY, which Go enables by default
+	Nagle bool
+	// TCP_CONGESTION, e.g. bbr, empty for the operating system's default
+	CongestionControl string
+}
+
+// control applies the options that must be set before connect(2) or listen(2),
+// the latter because accepted sockets inherit them.
+func (o SocketOptions) control(network, address string, c syscall.RawConn) error {
+	if o.SendBuffer == 0 && o.ReceiveBuffer == 0 && o.CongestionControl == "" {
+		return nil
+	}
+	var sockerr error
+	err := c.Control(func(fd uintptr) {
+		if o.SendBuffer > 0 {
+			if sockerr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer); sockerr != nil {
+				return
+			}
+		}
+		if o.ReceiveBuffer > 0 {
+			if sockerr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer); sockerr != nil {
+				return
+			}
+		}
+		if o.CongestionControl != "" {
+			sockerr = setCongestionControl(fd, o.CongestionControl)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockerr
+}
+
+// applyConn applies the options that Go overrides for every new connection.
+func (o SocketOptions) applyConn(conn *net.TCPConn) error {
+	if o.Nagle {
+		return conn.SetNoDelay(false)
+	}
+	return nil
+}
+
+type socketOptionsListener struct {
+	Listener
+	opts SocketOptions
+}
+
+func (l socketOptionsListener) AcceptTCP() (*net.TCPConn, error) {
+	conn, err := l.Listener.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.opts.applyConn(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,71 @@
+package tcpsock
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getsockopt(t *testing.T, conn *net.TCPConn, level, opt int) int {
+	rc, err := conn.SyscallConn()
+	require.NoError(t, err)
+	var v int
+	var sockerr error
+	require.NoError(t, rc.Control(func(fd uintptr) {
+		v, sockerr = syscall.GetsockoptInt(int(fd), level, opt)
+	}))
+	require.NoError(t, sockerr)
+	return v
+}
+
+func TestSocketOptions(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test relies on Linux getsockopt semantics")
+	}
+	opts := SocketOptions{SendBuffer: 1 << 20, ReceiveBuffer: 1 << 19, Nagle: true}
+
+	l, err := ListenAll([]string{"127.0.0.1:0"}, false, opts)
+	require.NoError(t, err)
+	defer l.Close()
+	d, err := NewDialer(0, "", opts)
+	require.NoError(t, err)
+
+	client, err := d.DialContext(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := l.AcceptTCP()
+	require.NoError(t, err)
+	defer server.Close()
+
+	for _, conn := range []*net.TCPConn{client.TCPConn, server} {
+		// Linux doubles the requested values for bookkeeping overhead
+		assert.True(t, getsockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF) >= opts.SendBuffer)
+		assert.True(t, getsockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF) >= opts.ReceiveBuffer)
+		assert.Equal(t, 0, getsockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+	}
+}
+
+func TestSocketOptionsDefaults(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test relies on Linux getsockopt semantics")
+	}
+	l, err := ListenAll([]string{"127.0.0.1:0"}, false, SocketOptions{})
+	require.NoError(t, err)
+	defer l.Close()
+	d, err := NewDialer(0, "", SocketOptions{})
+	require.NoError(t, err)
+	client, err := d.DialContext(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, 1, getsockopt(t, client.TCPConn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+}
+
+func TestSocketOptionsInvalidCongestionControl(t *testing.T) {
+	_, err := ListenAll([]string{"127.0.0.1:0"}, false, SocketOptions{CongestionControl: "doesnotexist"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package tcpsock
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenAll(t *testing.T) {
+	l, err := ListenAll([]string{"127.0.0.1:0", "127.0.0.1:0"}, false, SocketOptions{})
+	require.NoError(t, err)
+	m := l.(*multiListener)
+	require.Len(t, m.ls, 2)
+	assert.Equal(t, m.ls[0].Addr(), l.Addr())
+
+	for _, sub := range m.ls {
+		c, err := net.Dial("tcp", sub.Addr().String())
+		require.NoError(t, err)
+		conn, err := l.AcceptTCP()
+		require.NoError(t, err)
+		assert.Equal(t, c.LocalAddr().String(), conn.RemoteAddr().String())
+		assert.Equal(t, sub.Addr().String(), conn.LocalAddr().String())
+		c.Close()
+		conn.Close()
+	}
+
+	require.NoError(t, l.Close())
+	_, err = l.AcceptTCP()
+	assert.Error(t, err)
+	assert.Error(t, l.Close())
+	for _, sub := range m.ls {
+		_, err := net.Dial("tcp", sub.Addr().String())
+		assert.Error(t, err, "all listeners must be closed")
+	}
+}
+
+func TestListenAllSingleAddress(t *testing.T) {
+	l, err := ListenAll([]string{"127.0.0.1:0"}, false, SocketOptions{})
+	require.NoError(t, err)
+	defer l.Close()
+	_, ok := l.(*net.TCPListener)
+	assert.True(t, ok)
+}
+
+func TestListenAllClosesListenersOnError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	l, err := ListenAll([]string{"127.0.0.1:0", busy.Addr().String()}, false, SocketOptions{})
+	assert.Error(t, err)
+	assert.Nil(t, l)
+}
@@ -0,0 +1,358 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs/lzc"
+)
+
+// Backend determines how the functions in this package interact with ZFS.
+//
+// The lzc backend covers the operations that are performed for individual
+// snapshots, holds and bookmarks (snapshot, hold, release, bookmark, destroy of snapshots and bookmarks),
+// as well as send (including size estimates) and receive, unless they need functionality that
+// libzfs_core does not provide, see lzcSendFlags and lzcRecvSupported.
+// All other operations, most notably listing, always use the zfs CLI.
+type Backend string
+
+const (
+	BackendCLI Backend = "cli"
+	BackendLZC Backend = "lzc"
+)
+
+var backend = BackendCLI
+
+// Must be called before any other function in this package is used.
+func SetBackend(b Backend) error {
+	switch b {
+	case BackendCLI:
+	case BackendLZC:
+		if !lzc.Supported {
+			return errors.Wrapf(lzc.ErrNotSupported, "zfs backend %q", b)
+		}
+	default:
+		return errors.Errorf("unknown zfs backend %q", b)
+	}
+	backend = b
+	return nil
+}
+
+func GetBackend() Backend { return backend }
+
+func useLZC() bool { return backend == BackendLZC }
+
+// Returns the errno that libzfs_core reported for dataset, or 0 if err is not an *lzc.Error.
+func lzcErrno(err error, dataset string) syscall.Errno {
+	if lerr, ok := err.(*lzc.Error); ok {
+		return lerr.DatasetErrno(dataset)
+	}
+	return 0
+}
+
+func zfsHoldLZC(ctx context.Context, fullPath, tag string) error {
+	err := lzc.Hold(ctx, map[string]string{fullPath: tag})
+	if err == nil || lzcErrno(err, fullPath) == syscall.EEXIST {
+		return nil
+	}
+	return errors.Wrapf(err, "cannot hold %q", fullPath)
+}
+
+func zfsReleaseLZC(ctx context.Context, tag string, snaps ...string) error {
+	holds := make(map[string][]string, len(snaps))
+	for _, s := range snaps {
+		holds[s] = []string{tag}
+	}
+	err := lzc.Release(ctx, holds)
+	if err == nil {
+		return nil
+	}
+	lerr, ok := err.(*lzc.Error)
+	if !ok {
+		return err
+	}
+	// ESRCH means that the hold does not exist on that snapshot
+	var otherErrs []string
+	for ds, errno := range lerr.Errors {
+		if errno != syscall.ESRCH {
+			otherErrs = append(otherErrs, fmt.Sprintf("%s: %s", ds, errno))
+		}
+	}
+	if len(lerr.Errors) == 0 && lerr.Errno != syscall.ESRCH {
+		otherErrs = append(otherErrs, lerr.Error())
+	}
+	if len(otherErrs) > 0 {
+		return fmt.Errorf("unknown zfs error while releasing hold with tag %q:\n%s", tag, strings.Join(otherErrs, "\n"))
+	}
+	return nil
+}
+
+func zfsSnapshotLZC(ctx context.Context, snapname string) error {
+	if err := lzc.Snapshot(ctx, []string{snapname}); err != nil {
+		return errors.Wrapf(err, "cannot snapshot %q", snapname)
+	}
+	return nil
+}
+
+// exists is true if the bookmark could not be created because a bookmark with the same name already exists
+func zfsBookmarkLZC(ctx context.Context, snapname, bookmarkname string) (exists bool, err error) {
+	err = lzc.Bookmark(ctx, map[string]string{bookmarkname: snapname})
+	switch lzcErrno(err, bookmarkname) {
+	case 0:
+		return false, err
+	case syscall.ENOENT:
+		return false, &DatasetDoesNotExist{snapname}
+	case syscall.EEXIST:
+		return true, err
+	default:
+		return false, errors.Wrapf(err, "cannot create bookmark %q", bookmarkname)
+	}
+}
+
+// arg is a snapshot or bookmark argument as for `zfs destroy`,
+// i.e., snapshots can be given as `fs@snap1,snap2,...`.
+func zfsDestroyLZC(ctx context.Context, arg string) error {
+	idx := strings.IndexAny(arg, "@#")
+	if idx == -1 {
+		panic("lzc destroy is only implemented for snapshots and bookmarks")
+	}
+	filesystem := arg[:idx]
+
+	if arg[idx] == '#' {
+		if err := lzc.DestroyBookmarks(ctx, []string{arg}); err != nil {
+			return errors.Wrapf(err, "cannot destroy bookmark %q", arg)
+		}
+		return nil
+	}
+
+	var snaps []string
+	for _, name := range strings.Split(arg[idx+1:], ",") {
+		snaps = append(snaps, fmt.Sprintf("%s@%s", filesystem, name))
+	}
+	err := lzc.DestroySnapshots(ctx, snaps)
+	if err == nil {
+		return nil
+	}
+	lerr, ok := err.(*lzc.Error)
+	if !ok || len(lerr.Errors) == 0 {
+		return errors.Wrapf(err, "cannot destroy %q", arg)
+	}
+	// same error type as the CLI backend so that batched destroys can eliminate undestroyable snapshots
+	derr := &DestroySnapshotsError{Filesystem: filesystem}
+	for _, s := range snaps {
+		if errno, ok := lerr.Errors[s]; ok {
+			reason := errno.Error()
+			derr.Undestroyable = append(derr.Undestroyable, s[len(filesystem)+1:])
+			derr.Reason = append(derr.Reason, reason)
+			derr.RawLines = append(derr.RawLines, fmt.Sprintf("cannot destroy snapshot %s: %s", s, reason))
+		}
+	}
+	if len(derr.Undestroyable) == 0 {
+		return errors.Wrapf(err, "cannot destroy %q", arg)
+	}
+	return derr
+}
+
+// lzcSendFlags returns the libzfs_core flags for a, ok is false if lzc_send cannot produce the stream that a describes:
+// it does not send properties (send -p and -b) or intermediate snapshots (send -I).
+func lzcSendFlags(a ZFSSendArgsUnvalidated) (flags lzc.SendFlags, ok bool) {
+	if a.Properties || a.BackupProperties || a.Intermediates {
+		return 0, false
+	}
+	if (a.Encrypted != nil && a.Encrypted.B) || a.Raw {
+		return lzc.SendFlagRaw, true
+	}
+	if a.Compressed {
+		flags |= lzc.SendFlagCompress
+	}
+	if a.EmbeddedData {
+		flags |= lzc.SendFlagEmbedData
+	}
+	if a.LargeBlocks {
+		flags |= lzc.SendFlagLargeBlock
+	}
+	return flags, true
+}
+
+// lzcSendArgs returns the arguments of lzc_send for a, ok is false if the CLI must be used.
+func lzcSendArgs(ctx context.Context, a ZFSSendArgsValidated) (snap, from string, flags lzc.SendFlags, resumeObj, resumeOff uint64, ok bool, err error) {
+	if !useLZC() {
+		return "", "", 0, 0, 0, false, nil
+	}
+	if flags, ok = lzcSendFlags(a.ZFSSendArgsUnvalidated); !ok {
+		return "", "", 0, 0, 0, false, nil
+	}
+	if snap, err = absVersion(a.FS, a.To); err != nil {
+		return "", "", 0, 0, 0, false, err
+	}
+	if a.From != nil {
+		if from, err = absVersion(a.FS, a.From); err != nil {
+			return "", "", 0, 0, 0, false, err
+		}
+	}
+	if a.ResumeToken != "" {
+		// Validate checked that the token corresponds to From and To
+		t, err := ParseResumeToken(ctx, a.ResumeToken)
+		if err != nil {
+			return "", "", 0, 0, 0, false, err
+		}
+		if !t.HasObject || !t.HasOffset {
+			return "", "", 0, 0, 0, false, nil
+		}
+		// the resumed stream must use the flags of the interrupted one
+		flags = 0
+		if t.RawOK {
+			flags |= lzc.SendFlagRaw
+		}
+		if t.CompressOK {
+			flags |= lzc.SendFlagCompress
+		}
+		if t.EmbedOK {
+			flags |= lzc.SendFlagEmbedData
+		}
+		if t.LargeBlockOK {
+			flags |= lzc.SendFlagLargeBlock
+		}
+		resumeObj, resumeOff = t.Object, t.Offset
+	}
+	return snap, from, flags, resumeObj, resumeOff, true, nil
+}
+
+// lzcSendStream is the part of a SendStream that lzc_send writes to, see zfsSendLZC.
+type lzcSendStream struct {
+	done       chan error    // result of lzc_send
+	sent       chan struct{} // closed once lzc_send returned
+	waited     bool
+	sendErr    error
+	readerOnce sync.Once
+}
+
+func zfsSendLZC(ctx context.Context, snap, from string, flags lzc.SendFlags, resumeObj, resumeOff uint64) (*SendStream, error) {
+	stdoutReader, stdoutWriter, err := pipeWithCapacityHint(ZFSSendPipeCapacityHint)
+	if err != nil {
+		return nil, err
+	}
+	s := &SendStream{
+		stdoutReader: stdoutReader,
+		lzc:          &lzcSendStream{done: make(chan error, 1), sent: make(chan struct{})},
+	}
+	go func() {
+		err := lzc.SendResume(ctx, snap, from, stdoutWriter, flags, resumeObj, resumeOff)
+		stdoutWriter.Close()
+		s.lzc.done <- err
+		close(s.lzc.sent)
+	}()
+	// like the CLI backend, which kills zfs send, abort the stream if ctx is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.lzc.readerOnce.Do(func() { s.stdoutReader.Close() })
+		case <-s.lzc.sent:
+		}
+	}()
+	return s, nil
+}
+
+// lzc_send cannot be interrupted, but closing the reading end of the pipe makes it fail with EPIPE.
+func (s *SendStream) killAndWaitLZC(precedingReadErr error) error {
+	s.lzc.readerOnce.Do(func() {
+		if precedingReadErr != io.EOF {
+			s.stdoutReader.Close()
+		}
+	})
+
+	s.closeMtx.Lock()
+	defer s.closeMtx.Unlock()
+	if s.opErr != nil {
+		return s.opErr
+	}
+	if !s.lzc.waited {
+		s.lzc.sendErr = <-s.lzc.done
+		s.lzc.waited = true
+		if precedingReadErr == io.EOF {
+			s.stdoutReader.Close()
+		}
+	}
+	if s.lzc.sendErr != nil {
+		s.opErr = errors.Wrap(s.lzc.sendErr, "zfs send")
+	} else {
+		s.opErr = precedingReadErr
+	}
+	if s.lzc.sendErr == nil && precedingReadErr == io.EOF {
+		return precedingReadErr
+	}
+	return s.opErr
+}
+
+func zfsSendDryLZC(ctx context.Context, a ZFSSendArgsValidated, snap, from string, flags lzc.SendFlags) (*DrySendInfo, error) {
+	space, err := lzc.SendSpace(ctx, snap, from, flags)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot estimate send size")
+	}
+	info := &DrySendInfo{Type: DrySendTypeFull, Filesystem: a.FS, To: snap, SizeEstimate: int64(space)}
+	if from != "" {
+		info.Type, info.From = DrySendTypeIncremental, from
+	}
+	return info, nil
+}
+
+// lzcRecvSupported returns false if lzc_receive cannot apply opts,
+// it does not support overriding or excluding properties (recv -o and -x).
+func lzcRecvSupported(opts RecvOptions) bool {
+	return useLZC() && len(opts.OverrideProperties) == 0 && len(opts.ExcludeProperties) == 0
+}
+
+// zfsRecvLZC receives stream into snap (full path) via lzc_receive, which reads from a pipe that stream is copied to.
+// The rollback for RollbackAndForceRecv and the check for SavePartialRecvState must already have been done.
+func zfsRecvLZC(ctx context.Context, fs *DatasetPath, snap string, stream io.ReadCloser, opts RecvOptions) error {
+	begin, err := lzc.ReadBeginRecord(stream)
+	if err != nil {
+		return err
+	}
+	stdin, stdinWriter, err := pipeWithCapacityHint(ZFSRecvPipeCapacityHint)
+	if err != nil {
+		return err
+	}
+
+	copierErrChan := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdinWriter, stream)
+		stdinWriter.Close()
+		copierErrChan <- err
+	}()
+	// lzc_receive cannot be interrupted, but the end of its input makes it fail
+	recvDone := make(chan struct{})
+	defer close(recvDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stdinWriter.Close()
+		case <-recvDone:
+		}
+	}()
+
+	recvErr := lzc.Receive(ctx, snap, begin, stdin, opts.RollbackAndForceRecv, opts.SavePartialRecvState)
+	stdin.Close() // unblocks the copier if lzc_receive failed before the end of the stream
+	copierErr := <-copierErrChan
+	if recvErr == nil && copierErr == nil {
+		return nil
+	}
+	if recvErr != nil && opts.SavePartialRecvState {
+		token, err := ZFSGetReceiveResumeTokenOrEmptyStringIfNotSupported(ctx, fs)
+		if err == nil && token != "" {
+			if parsed, err := ParseResumeToken(ctx, token); err == nil {
+				return &RecvFailedWithResumeTokenErr{Msg: recvErr.Error(), ResumeTokenRaw: token, ResumeTokenParsed: parsed}
+			}
+		}
+	}
+	if copierErr != nil {
+		return copierErr // likely network error reading from stream
+	}
+	return errors.Wrapf(recvErr, "cannot receive %q", snap)
+}
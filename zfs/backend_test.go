@@ -0,0 +1,67 @@
+package zfs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs/lzc"
+)
+
+func TestSetBackend(t *testing.T) {
+	defer func() { backend = BackendCLI }()
+
+	assert.Error(t, SetBackend("foo"))
+	assert.NoError(t, SetBackend(BackendCLI))
+	if lzc.Supported {
+		assert.NoError(t, SetBackend(BackendLZC))
+	} else {
+		assert.Error(t, SetBackend(BackendLZC))
+		assert.Equal(t, BackendCLI, GetBackend())
+	}
+}
+
+func TestLZCErrorDatasetErrno(t *testing.T) {
+	err := &lzc.Error{Op: "hold", Errno: syscall.EINVAL, Errors: map[string]syscall.Errno{
+		"pool/fs@a": syscall.EEXIST,
+	}}
+	assert.Equal(t, syscall.EEXIST, lzcErrno(err, "pool/fs@a"))
+	assert.Equal(t, syscall.EINVAL, lzcErrno(err, "pool/fs@b"))
+	require.Equal(t, syscall.Errno(0), lzcErrno(nil, "pool/fs@a"))
+}
+
+func TestLZCSendFlags(t *testing.T) {
+	tcs := []struct {
+		name  string
+		args  ZFSSendArgsUnvalidated
+		flags lzc.SendFlags
+		ok    bool
+	}{
+		{"plain", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}}, 0, true},
+		{"compressed", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}, Compressed: true, EmbeddedData: true, LargeBlocks: true},
+			lzc.SendFlagCompress | lzc.SendFlagEmbedData | lzc.SendFlagLargeBlock, true},
+		{"encrypted", ZFSSendArgsUnvalidated{Encrypted: &NilBool{true}, Compressed: true}, lzc.SendFlagRaw, true},
+		{"raw", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}, Raw: true}, lzc.SendFlagRaw, true},
+		{"properties", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}, Properties: true}, 0, false},
+		{"backup_properties", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}, BackupProperties: true}, 0, false},
+		{"intermediates", ZFSSendArgsUnvalidated{Encrypted: &NilBool{false}, Intermediates: true}, 0, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			flags, ok := lzcSendFlags(tc.args)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.flags, flags)
+		})
+	}
+}
+
+func TestLZCRecvSupported(t *testing.T) {
+	defer func() { backend = BackendCLI }()
+	assert.False(t, lzcRecvSupported(RecvOptions{}), "cli backend")
+	backend = BackendLZC
+	assert.True(t, lzcRecvSupported(RecvOptions{RollbackAndForceRecv: true, SavePartialRecvState: true}))
+	assert.False(t, lzcRecvSupported(RecvOptions{OverrideProperties: map[string]string{"canmount": "off"}}))
+	assert.False(t, lzcRecvSupported(RecvOptions{ExcludeProperties: []string{"mountpoint"}}))
+}
@@ -0,0 +1,134 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+var bookmarkCloningCLICheck struct {
+	once      sync.Once
+	supported bool
+	err       error
+}
+
+func bookmarkCloningCLISupported(ctx context.Context) (bool, error) {
+	bookmarkCloningCLICheck.once.Do(func() {
+		// "feature discovery": OpenZFS 2.0 accepts bookmarks as the source of `zfs bookmark`
+		cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "bookmark")
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); !ok {
+			debug("bookmark cloning feature check failed: %T %s", err, err)
+			bookmarkCloningCLICheck.err = err
+		}
+		def := bytes.Contains(output, []byte("<snapshot|bookmark>"))
+		bookmarkCloningCLICheck.supported = envconst.Bool("ZREPL_ZFS_BOOKMARK_CLONING_SUPPORTED", def)
+		debug("bookmark cloning feature check complete %#v", &bookmarkCloningCLICheck)
+	})
+	return bookmarkCloningCLICheck.supported, bookmarkCloningCLICheck.err
+}
+
+// BookmarkCloningSupported returns true if bookmarks of bookmarks can be created in the pool of fs,
+// i.e., if ZFS supports it and the pool has the bookmark_v2 or bookmark_written feature.
+func BookmarkCloningSupported(ctx context.Context, fs string) (bool, error) {
+	supported, err := bookmarkCloningCLISupported(ctx)
+	if err != nil || !supported {
+		return false, err
+	}
+	dp, err := NewDatasetPath(fs)
+	if err != nil {
+		return false, err
+	}
+	pool, err := dp.Pool()
+	if err != nil {
+		return false, err
+	}
+	caps, err := PoolFeatures(ctx, pool)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot determine pool features")
+	}
+	return caps.BookmarksV2 || caps.Has("bookmark_written"), nil
+}
+
+// ZFSBookmarkFromBookmark idempotently creates bookmark `bookmark` of fs as a copy of bookmark v.
+//
+// Returns ErrBookmarkCloningNotSupported if BookmarkCloningSupported is false
+// and no bookmark with the name `bookmark` and the same identity as v exists.
+//
+// v must be validated by the caller
+func ZFSBookmarkFromBookmark(ctx context.Context, fs string, v FilesystemVersion, bookmark string) (bm FilesystemVersion, err error) {
+	if !v.IsBookmark() {
+		return bm, fmt.Errorf("bookmark cloning: source %q is not a bookmark", v.FullPath(fs))
+	}
+
+	bm = FilesystemVersion{
+		Type:      Bookmark,
+		Name:      bookmark,
+		UserRefs:  OptionUint64{Valid: false},
+		CreateTXG: v.CreateTXG,
+		Guid:      v.Guid,
+		Creation:  v.Creation,
+	}
+
+	bookmarkname := fmt.Sprintf("%s#%s", fs, bookmark)
+	if err := EntityNamecheck(bookmarkname, EntityTypeBookmark); err != nil {
+		return bm, err
+	}
+
+	existingBm, err := ZFSGetFilesystemVersion(ctx, bookmarkname)
+	if err == nil {
+		if FilesystemVersionEqualIdentity(bm, existingBm) {
+			return existingBm, nil
+		}
+		return bm, &BookmarkExists{
+			fs: fs, bookmarkOrigin: v.ToSendArgVersion(), bookmark: bookmark,
+			bookGuid: existingBm.Guid,
+		}
+	} else if _, ok := err.(*DatasetDoesNotExist); !ok {
+		return bm, errors.Wrap(err, "bookmark: idempotency check for bookmark cloning")
+	}
+
+	supported, err := BookmarkCloningSupported(ctx, fs)
+	if err != nil {
+		debug("bookmark: cannot determine bookmark cloning support, assuming it is not supported: %s", err)
+	}
+	if !supported {
+		return bm, ErrBookmarkCloningNotSupported
+	}
+
+	srcname := v.FullPath(fs)
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "bookmark", srcname, bookmarkname)
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		if ddne := tryDatasetDoesNotExist(srcname, stdio); ddne != nil {
+			return bm, ddne
+		}
+		if ClassifyZFSStderr(stdio) == ZFSErrorClassBookmarkExists {
+			// concurrent creation, check if this was idempotent
+			bookGuid, err := ZFSGetGUID(ctx, fs, "#"+bookmark)
+			if err != nil {
+				return bm, errors.Wrap(err, "bookmark: idempotency check for bookmark cloning")
+			}
+			if v.Guid == bookGuid {
+				return bm, nil
+			}
+			return bm, &BookmarkExists{
+				fs: fs, bookmarkOrigin: v.ToSendArgVersion(), bookmark: bookmark,
+				zfsMsg:   string(stdio),
+				bookGuid: bookGuid,
+			}
+		}
+		return bm, &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+	return bm, nil
+}
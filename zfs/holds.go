@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -43,17 +44,56 @@ func ZFSHold(ctx context.Context, fs string, v FilesystemVersion, tag string) er
 		return err
 	}
 	fullPath := v.FullPath(fs)
+	if useLZC() {
+		return zfsHoldLZC(ctx, fullPath, tag)
+	}
 	output, err := zfscmd.CommandContext(ctx, "zfs", "hold", tag, fullPath).CombinedOutput()
 	if err != nil {
-		if bytes.Contains(output, []byte("tag already exists on this dataset")) {
+		zfsErr := &ZFSError{output, errors.Wrapf(err, "cannot hold %q", fullPath)}
+		if zfsErr.Class() == ZFSErrorClassHoldExists {
 			goto success
 		}
-		return &ZFSError{output, errors.Wrapf(err, "cannot hold %q", fullPath)}
+		return zfsErr
 	}
 success:
 	return nil
 }
 
+var snapshotAndHoldRetries = envconst.Int("ZREPL_ZFS_SNAPSHOT_AND_HOLD_RETRIES", 3)
+var snapshotAndHoldRetryInterval = envconst.Duration("ZREPL_ZFS_SNAPSHOT_AND_HOLD_RETRY_INTERVAL", 100*time.Millisecond)
+
+// ZFSSnapshotAndHold creates snapshot fs@name and immediately puts a hold with tag on it.
+//
+// ZFS provides no way to do both atomically (channel programs cannot create holds),
+// so this function only narrows the window in which a concurrent destroy can remove
+// the snapshot before it is held.
+// The hold is retried on failure. If it still fails, the snapshot is left in place
+// and the hold error is returned.
+func ZFSSnapshotAndHold(ctx context.Context, fs *DatasetPath, name string, tag string) error {
+	if err := validateNotEmpty("tag", tag); err != nil {
+		return err
+	}
+	if err := ZFSSnapshot(ctx, fs, name, false); err != nil {
+		return err
+	}
+	v := FilesystemVersion{Type: Snapshot, Name: name}
+	var err error
+	for i := 0; i <= snapshotAndHoldRetries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(snapshotAndHoldRetryInterval):
+			}
+		}
+		if err = ZFSHold(ctx, fs.ToString(), v, tag); err == nil {
+			return nil
+		}
+		debug("snapshot and hold: hold attempt %d of %q failed: %s", i+1, v.FullPath(fs.ToString()), err)
+	}
+	return errors.Wrapf(err, "snapshot %q created but cannot hold it", v.FullPath(fs.ToString()))
+}
+
 func ZFSHolds(ctx context.Context, fs, snap string) ([]string, error) {
 	if err := validateZFSFilesystem(fs); err != nil {
 		return nil, errors.Wrap(err, "`fs` is not a valid filesystem path")
@@ -82,8 +122,75 @@ func ZFSHolds(ctx context.Context, fs, snap string) ([]string, error) {
 	return tags, nil
 }
 
+// ZFSHoldsBatch is like ZFSHolds, but lists the holds of many snapshots
+// in as few `zfs holds` invocations as possible.
+// snaps are absolute snapshot paths (fs@snap).
+// The returned map has an entry for each snapshot in snaps.
+//
+// An error for any of the snapshots (e.g. because it has been destroyed
+// concurrently) fails the entire call.
+func ZFSHoldsBatch(ctx context.Context, snaps []string) (map[string][]string, error) {
+	res := make(map[string][]string, len(snaps))
+	for _, snap := range snaps {
+		fs, vt, _, err := DecomposeVersionString(snap)
+		if err != nil {
+			return nil, err
+		}
+		if vt != Snapshot {
+			return nil, fmt.Errorf("can only list holds of snapshots, got %q", snap)
+		}
+		if err := validateZFSFilesystem(fs); err != nil {
+			return nil, errors.Wrapf(err, "invalid filesystem in %q", snap)
+		}
+		res[snap] = nil
+	}
+
+	maxInvocationLen := 12 * os.Getpagesize()
+	for i := 0; i < len(snaps); {
+		j, l := i, 0
+		for ; j < len(snaps) && (j == i || l+len(snaps[j]) <= maxInvocationLen); j++ {
+			l += len(snaps[j])
+		}
+		args := append([]string{"holds", "-H"}, snaps[i:j]...)
+		output, err := zfscmd.CommandContext(ctx, "zfs", args...).CombinedOutput()
+		if pe, ok := err.(*os.PathError); err != nil && ok && pe.Err == syscall.E2BIG && j-i > 1 {
+			maxInvocationLen = maxInvocationLen / 2
+			continue
+		}
+		if err != nil {
+			return nil, &ZFSError{output, errors.Wrap(err, "zfs holds failed")}
+		}
+		i = j
+
+		if err := parseZFSHoldsBatchOutput(output, res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// res must have an entry for each snapshot that may appear in output
+func parseZFSHoldsBatchOutput(output []byte, res map[string][]string) error {
+	scan := bufio.NewScanner(bytes.NewReader(output))
+	for scan.Scan() {
+		// NAME              TAG  TIMESTAMP
+		comps := strings.SplitN(scan.Text(), "\t", 3)
+		if len(comps) != 3 {
+			return fmt.Errorf("zfs holds: unexpected output\n%s", output)
+		}
+		if _, ok := res[comps[0]]; !ok {
+			return fmt.Errorf("zfs holds: unexpected output: unexpected snapshot %q\n%s", comps[0], output)
+		}
+		res[comps[0]] = append(res[comps[0]], comps[1])
+	}
+	return nil
+}
+
 // Idempotent: if the hold doesn't exist, this is not an error
 func ZFSRelease(ctx context.Context, tag string, snaps ...string) error {
+	if useLZC() {
+		return zfsReleaseLZC(ctx, tag, snaps...)
+	}
 	cumLens := make([]int, len(snaps))
 	for i := 1; i < len(snaps); i++ {
 		cumLens[i] = cumLens[i-1] + len(snaps[i])
@@ -116,7 +223,7 @@ func ZFSRelease(ctx context.Context, tag string, snaps ...string) error {
 		scan := bufio.NewScanner(bytes.NewReader(output))
 		for scan.Scan() {
 			line := scan.Text()
-			if strings.Contains(line, "no such tag on this dataset") {
+			if ClassifyZFSStderr([]byte(line)) == ZFSErrorClassNoSuchHold {
 				noSuchTagLines = append(noSuchTagLines, line)
 			} else {
 				otherLines = append(otherLines, line)
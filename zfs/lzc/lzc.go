@@ -0,0 +1,72 @@
+// Package lzc provides bindings to the subset of the libzfs_core API that zrepl uses.
+//
+// libzfs_core talks to the ZFS kernel module via ioctls, which is much cheaper than
+// shelling out to the zfs CLI for every snapshot, hold or bookmark operation.
+// The bindings require cgo and the libzfs_core headers and are only built with the
+// `lzc` build tag. Without that tag, all functions return ErrNotSupported.
+//
+// The functions in this package do not validate dataset names, that is the caller's responsibility.
+//
+// An ioctl cannot be interrupted once it was issued. The functions in this package therefore
+// only respect their context before they issue the ioctl, see checkContext.
+package lzc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+var ErrNotSupported = errors.New("zrepl was built without libzfs_core support (build tag `lzc`)")
+
+// Error is returned if a libzfs_core call failed.
+type Error struct {
+	Op    string
+	Errno syscall.Errno
+	// Per-dataset errors as reported by libzfs_core. May be empty.
+	Errors map[string]syscall.Errno
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("lzc_%s: %s", e.Op, e.Errno)
+	}
+	ds := make([]string, 0, len(e.Errors))
+	for d := range e.Errors {
+		ds = append(ds, d)
+	}
+	sort.Strings(ds)
+	msgs := make([]string, len(ds))
+	for i, d := range ds {
+		msgs[i] = fmt.Sprintf("%s: %s", d, e.Errors[d])
+	}
+	return fmt.Sprintf("lzc_%s: %s: %s", e.Op, e.Errno, strings.Join(msgs, ", "))
+}
+
+// Returns the error that libzfs_core reported for dataset.
+// If it did not report per-dataset errors, the overall error is returned.
+func (e *Error) DatasetErrno(dataset string) syscall.Errno {
+	if errno, ok := e.Errors[dataset]; ok {
+		return errno
+	}
+	return e.Errno
+}
+
+// checkContext returns ctx.Err() if ctx is done, e.g., if the job was stopped while
+// the caller was waiting for its turn.
+func checkContext(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// SendFlags correspond to enum lzc_send_flags.
+type SendFlags int
+
+const (
+	SendFlagEmbedData  SendFlags = 1 << 0 // send -e
+	SendFlagLargeBlock SendFlags = 1 << 1 // send -L
+	SendFlagCompress   SendFlags = 1 << 2 // send -c
+	SendFlagRaw        SendFlags = 1 << 3 // send -w
+)
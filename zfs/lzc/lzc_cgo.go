@@ -0,0 +1,273 @@
+// +build lzc
+
+package lzc
+
+/*
+#cgo CFLAGS: -I/usr/include/libzfs -I/usr/include/libspl -D_LARGEFILE64_SOURCE
+#cgo LDFLAGS: -lzfs_core -lnvpair
+
+#include <stdlib.h>
+#include <libzfs_core.h>
+#include <libnvpair.h>
+*/
+import "C"
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const Supported = true
+
+var initLib struct {
+	once sync.Once
+	err  error
+}
+
+func libzfsCoreInit() error {
+	initLib.once.Do(func() {
+		if rc := C.libzfs_core_init(); rc != 0 {
+			initLib.err = &Error{Op: "core_init", Errno: syscall.Errno(rc)}
+		}
+	})
+	return initLib.err
+}
+
+type nvlist struct{ p *C.nvlist_t }
+
+func newNVList() nvlist { return nvlist{C.fnvlist_alloc()} }
+
+func (l nvlist) free() { C.fnvlist_free(l.p) }
+
+func (l nvlist) addBoolean(name string) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	C.fnvlist_add_boolean(l.p, cname)
+}
+
+func (l nvlist) addString(name, value string) {
+	cname, cvalue := C.CString(name), C.CString(value)
+	defer C.free(unsafe.Pointer(cname))
+	defer C.free(unsafe.Pointer(cvalue))
+	C.fnvlist_add_string(l.p, cname, cvalue)
+}
+
+// v is copied, the caller remains responsible for freeing it
+func (l nvlist) addNVList(name string, v nvlist) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	C.fnvlist_add_nvlist(l.p, cname, v.p)
+}
+
+// consumes errlist
+func result(op string, rc C.int, errlist *C.nvlist_t) error {
+	var errs map[string]syscall.Errno
+	if errlist != nil {
+		defer C.fnvlist_free(errlist)
+		errs = make(map[string]syscall.Errno)
+		for pair := C.nvlist_next_nvpair(errlist, nil); pair != nil; pair = C.nvlist_next_nvpair(errlist, pair) {
+			errs[C.GoString(C.nvpair_name(pair))] = syscall.Errno(C.fnvpair_value_int32(pair))
+		}
+	}
+	if rc == 0 {
+		return nil
+	}
+	return &Error{Op: op, Errno: syscall.Errno(rc), Errors: errs}
+}
+
+// Atomically creates the given snapshots (full paths).
+func Snapshot(ctx context.Context, snaps []string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for _, s := range snaps {
+		l.addBoolean(s)
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_snapshot(l.p, nil, &errlist)
+	return result("snapshot", rc, errlist)
+}
+
+// Creates the given holds, holds maps snapshot (full path) to hold tag.
+func Hold(ctx context.Context, holds map[string]string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for snap, tag := range holds {
+		l.addString(snap, tag)
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_hold(l.p, -1, &errlist)
+	return result("hold", rc, errlist)
+}
+
+// Releases the given holds, holds maps snapshot (full path) to hold tags.
+func Release(ctx context.Context, holds map[string][]string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for snap, tags := range holds {
+		tl := newNVList()
+		for _, tag := range tags {
+			tl.addBoolean(tag)
+		}
+		l.addNVList(snap, tl)
+		tl.free()
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_release(l.p, &errlist)
+	return result("release", rc, errlist)
+}
+
+// Creates the given bookmarks, bookmarks maps bookmark (full path) to snapshot (full path).
+func Bookmark(ctx context.Context, bookmarks map[string]string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for bm, snap := range bookmarks {
+		l.addString(bm, snap)
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_bookmark(l.p, &errlist)
+	return result("bookmark", rc, errlist)
+}
+
+// Atomically destroys the given snapshots (full paths, must be on the same pool).
+// Snapshots that do not exist are silently ignored.
+func DestroySnapshots(ctx context.Context, snaps []string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for _, s := range snaps {
+		l.addBoolean(s)
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_destroy_snaps(l.p, C.B_FALSE, &errlist)
+	return result("destroy_snaps", rc, errlist)
+}
+
+// Destroys the given bookmarks (full paths, must be on the same pool).
+// Bookmarks that do not exist are silently ignored.
+func DestroyBookmarks(ctx context.Context, bookmarks []string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	l := newNVList()
+	defer l.free()
+	for _, b := range bookmarks {
+		l.addBoolean(b)
+	}
+	var errlist *C.nvlist_t
+	rc := C.lzc_destroy_bookmarks(l.p, &errlist)
+	return result("destroy_bookmarks", rc, errlist)
+}
+
+// cstringOrNil returns nil for the empty string, the caller must free the result
+func cstringOrNil(s string) *C.char {
+	if s == "" {
+		return nil
+	}
+	return C.CString(s)
+}
+
+// Writes the send stream of snap, incremental from from (a snapshot or bookmark, full paths) unless from is empty, to w.
+// lzc_send blocks until the stream was written, it fails with EPIPE if the reading end of w is closed.
+func Send(ctx context.Context, snap, from string, w *os.File, flags SendFlags) error {
+	return SendResume(ctx, snap, from, w, flags, 0, 0)
+}
+
+// Like Send, but resumes the stream at the given object and offset, see the resume token.
+func SendResume(ctx context.Context, snap, from string, w *os.File, flags SendFlags, resumeObj, resumeOff uint64) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	csnap, cfrom := C.CString(snap), cstringOrNil(from)
+	defer C.free(unsafe.Pointer(csnap))
+	defer C.free(unsafe.Pointer(cfrom))
+	var rc C.int
+	if resumeObj == 0 && resumeOff == 0 {
+		rc = C.lzc_send(csnap, cfrom, C.int(w.Fd()), C.enum_lzc_send_flags(flags))
+	} else {
+		rc = C.lzc_send_resume(csnap, cfrom, C.int(w.Fd()), C.enum_lzc_send_flags(flags), C.uint64_t(resumeObj), C.uint64_t(resumeOff))
+	}
+	return result("send", rc, nil)
+}
+
+// Returns the estimated size of the stream that Send would write.
+func SendSpace(ctx context.Context, snap, from string, flags SendFlags) (uint64, error) {
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return 0, err
+	}
+	csnap, cfrom := C.CString(snap), cstringOrNil(from)
+	defer C.free(unsafe.Pointer(csnap))
+	defer C.free(unsafe.Pointer(cfrom))
+	var space C.uint64_t
+	rc := C.lzc_send_space(csnap, cfrom, C.enum_lzc_send_flags(flags), &space)
+	if err := result("send_space", rc, nil); err != nil {
+		return 0, err
+	}
+	return uint64(space), nil
+}
+
+// Receives the stream that begins with begin and continues in r into snap (full path).
+// force rolls back the filesystem to its most recent snapshot (recv -F),
+// resumable saves the state of an interrupted receive (recv -s).
+func Receive(ctx context.Context, snap string, begin *BeginRecord, r *os.File, force, resumable bool) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if err := libzfsCoreInit(); err != nil {
+		return err
+	}
+	csnap := C.CString(snap)
+	defer C.free(unsafe.Pointer(csnap))
+	crec := C.CBytes(begin.Record)
+	defer C.free(crec)
+	rc := C.lzc_receive_with_header(csnap, nil, nil, cBool(force), cBool(resumable), cBool(begin.Raw),
+		C.int(r.Fd()), (*C.struct_dmu_replay_record)(crec))
+	return result("receive", rc, nil)
+}
+
+func cBool(b bool) C.boolean_t {
+	if b {
+		return C.B_TRUE
+	}
+	return C.B_FALSE
+}
@@ -0,0 +1,50 @@
+package lzc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// beginRecordLen is sizeof(dmu_replay_record_t), the size of the record that starts a send stream
+const beginRecordLen = 312
+
+const (
+	drrBegin           = 0
+	dmuBackupMagic     = 0x2F5bacbac
+	dmuBackupFeatRaw   = 1 << 24
+	featureFlagsShift  = 2
+	featureFlagsLength = 30
+)
+
+// BeginRecord is the first record of a send stream.
+// lzc_receive_with_header needs it separately from the rest of the stream,
+// and whether the stream is raw, which the zfs CLI determines from the record, too.
+type BeginRecord struct {
+	Record []byte
+	Raw    bool
+}
+
+// ReadBeginRecord reads the begin record from the start of a send stream.
+func ReadBeginRecord(r io.Reader) (*BeginRecord, error) {
+	rec := make([]byte, beginRecordLen)
+	if _, err := io.ReadFull(r, rec); err != nil {
+		return nil, fmt.Errorf("cannot read begin record of send stream: %s", err)
+	}
+	// the stream has the byte order of the sending host
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint64(rec[8:]) == dmuBackupMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint64(rec[8:]) == dmuBackupMagic:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid send stream: bad magic number")
+	}
+	if order.Uint32(rec[0:]) != drrBegin {
+		return nil, fmt.Errorf("invalid send stream: does not start with a begin record")
+	}
+	versionInfo := order.Uint64(rec[16:])
+	featureFlags := (versionInfo >> featureFlagsShift) & (1<<featureFlagsLength - 1)
+	return &BeginRecord{Record: rec, Raw: featureFlags&dmuBackupFeatRaw != 0}, nil
+}
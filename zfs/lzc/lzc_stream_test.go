@@ -0,0 +1,43 @@
+package lzc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func beginRecord(order binary.ByteOrder, featureFlags uint64) []byte {
+	rec := make([]byte, beginRecordLen)
+	order.PutUint32(rec[0:], drrBegin)
+	order.PutUint64(rec[8:], dmuBackupMagic)
+	order.PutUint64(rec[16:], featureFlags<<featureFlagsShift|1) // DMU_SUBSTREAM
+	return rec
+}
+
+func TestReadBeginRecord(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		rec := beginRecord(order, dmuBackupFeatRaw|1<<2)
+		stream := bytes.NewReader(append(append([]byte(nil), rec...), "rest of the stream"...))
+		br, err := ReadBeginRecord(stream)
+		require.NoError(t, err)
+		assert.Equal(t, rec, br.Record)
+		assert.True(t, br.Raw)
+		assert.Equal(t, len("rest of the stream"), stream.Len(), "must only read the begin record")
+
+		br, err = ReadBeginRecord(bytes.NewReader(beginRecord(order, 1<<2)))
+		require.NoError(t, err)
+		assert.False(t, br.Raw)
+	}
+
+	_, err := ReadBeginRecord(bytes.NewReader(make([]byte, beginRecordLen)))
+	assert.Error(t, err, "bad magic")
+	_, err = ReadBeginRecord(bytes.NewReader(beginRecord(binary.LittleEndian, 0)[:100]))
+	assert.Error(t, err, "short stream")
+	notBegin := beginRecord(binary.LittleEndian, 0)
+	binary.LittleEndian.PutUint32(notBegin, 1)
+	_, err = ReadBeginRecord(bytes.NewReader(notBegin))
+	assert.Error(t, err)
+}
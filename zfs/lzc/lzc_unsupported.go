@@ -0,0 +1,38 @@
+// +build !lzc
+
+package lzc
+
+import (
+	"context"
+	"os"
+)
+
+const Supported = false
+
+func Snapshot(ctx context.Context, snaps []string) error { return ErrNotSupported }
+
+func Hold(ctx context.Context, holds map[string]string) error { return ErrNotSupported }
+
+func Release(ctx context.Context, holds map[string][]string) error { return ErrNotSupported }
+
+func Bookmark(ctx context.Context, bookmarks map[string]string) error { return ErrNotSupported }
+
+func DestroySnapshots(ctx context.Context, snaps []string) error { return ErrNotSupported }
+
+func DestroyBookmarks(ctx context.Context, bookmarks []string) error { return ErrNotSupported }
+
+func Send(ctx context.Context, snap, from string, w *os.File, flags SendFlags) error {
+	return ErrNotSupported
+}
+
+func SendResume(ctx context.Context, snap, from string, w *os.File, flags SendFlags, resumeObj, resumeOff uint64) error {
+	return ErrNotSupported
+}
+
+func SendSpace(ctx context.Context, snap, from string, flags SendFlags) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+func Receive(ctx context.Context, snap string, begin *BeginRecord, r *os.File, force, resumable bool) error {
+	return ErrNotSupported
+}
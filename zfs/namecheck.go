@@ -191,3 +191,19 @@ func isASCII(s string) bool {
 	}
 	return true
 }
+
+// ValidateUserPropertyName checks that name is a ZFS user property name, e.g., `com.example:keep`.
+func ValidateUserPropertyName(name string) error {
+	if !strings.Contains(name, ":") {
+		return fmt.Errorf("user property name %q must contain a colon", name)
+	}
+	if len(name) > 256 {
+		return fmt.Errorf("user property name %q must be at most 256 characters long", name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune(":+._-", c)) {
+			return fmt.Errorf("user property name %q must only contain lowercase letters, numbers and the characters ':', '+', '.', '_' and '-'", name)
+		}
+	}
+	return nil
+}
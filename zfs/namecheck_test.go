@@ -62,3 +62,23 @@ func TestEntityNamecheck(t *testing.T) {
 	}
 
 }
+
+func TestValidateUserPropertyName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"com.example:keep":              true,
+		"zrepl:placeholder":             true,
+		"a:b+c_d-e.f":                   true,
+		"keep":                          false, // native property namespace
+		"com.example:Keep":              false,
+		"com.example:keep,guid":         false,
+		"com.example:keep value":        false,
+		strings.Repeat("a", 255) + ":b": false,
+	} {
+		err := ValidateUserPropertyName(name)
+		if ok && err != nil {
+			t.Errorf("expected %q to be valid, got %s", name, err)
+		} else if !ok && err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -60,6 +61,12 @@ type FilesystemPlaceholderState struct {
 	RawLocalPropertyValue string
 }
 
+// IsLegacyPlaceholder is true for placeholders that still use the hash-based property value of the 0.0.x series,
+// see ZFSMigrateHashBasedPlaceholderToCurrent.
+func (s *FilesystemPlaceholderState) IsLegacyPlaceholder() bool {
+	return s.IsPlaceholder && s.RawLocalPropertyValue != placeholderPropertyOn
+}
+
 // ZFSGetFilesystemPlaceholderState is the authoritative way to determine whether a filesystem
 // is a placeholder. Note that the property source must be `local` for the returned value to be valid.
 //
@@ -80,20 +87,34 @@ func ZFSGetFilesystemPlaceholderState(ctx context.Context, p *DatasetPath) (stat
 	return state, nil
 }
 
-func ZFSCreatePlaceholderFilesystem(ctx context.Context, fs *DatasetPath, parent *DatasetPath) (err error) {
+// ZFSCreatePlaceholderFilesystem creates fs as a placeholder below parent.
+// props are additional properties of the placeholder, they override the defaults (e.g. mountpoint=none).
+func ZFSCreatePlaceholderFilesystem(ctx context.Context, fs *DatasetPath, parent *DatasetPath, props map[string]string) (err error) {
 	if fs.Length() == 1 {
 		return fmt.Errorf("cannot create %q: pools cannot be created with zfs create", fs.ToString())
 	}
 
-	cmdline := []string{
-		"create",
-		"-o", fmt.Sprintf("%s=%s", PlaceholderPropertyName, placeholderPropertyOn),
-		"-o", "mountpoint=none",
+	createProps := map[string]string{
+		"mountpoint": "none",
 	}
 	if parentEncrypted, err := ZFSGetEncryptionEnabled(ctx, parent.ToString()); err != nil {
 		return errors.Wrap(err, "cannot determine encryption support")
 	} else if parentEncrypted {
-		cmdline = append(cmdline, "-o", "encryption=off")
+		createProps["encryption"] = "off"
+	}
+	for name, value := range props {
+		createProps[name] = value
+	}
+	createProps[PlaceholderPropertyName] = placeholderPropertyOn
+
+	names := make([]string, 0, len(createProps))
+	for name := range createProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cmdline := []string{"create"}
+	for _, name := range names {
+		cmdline = append(cmdline, "-o", fmt.Sprintf("%s=%s", name, createProps[name]))
 	}
 	cmdline = append(cmdline, fs.ToString())
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, cmdline...)
@@ -137,7 +158,7 @@ func ZFSMigrateHashBasedPlaceholderToCurrent(ctx context.Context, fs *DatasetPat
 	report := MigrateHashBasedPlaceholderReport{
 		OriginalState: *st,
 	}
-	report.NeedsModification = st.IsPlaceholder && st.RawLocalPropertyValue != placeholderPropertyOn
+	report.NeedsModification = st.IsLegacyPlaceholder()
 
 	if dryRun || !report.NeedsModification {
 		return &report, nil
@@ -0,0 +1,54 @@
+package zfs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+// PoolScheduler limits the number of concurrent operations per pool,
+// while operations on different pools proceed in parallel.
+// An operation is anything that invokes zfs commands on datasets of a single pool.
+type PoolScheduler struct {
+	maxPerPool int64
+
+	mtx   sync.Mutex
+	pools map[string]*semaphore.S
+}
+
+func NewPoolScheduler(maxPerPool int64) *PoolScheduler {
+	if maxPerPool < 1 {
+		panic("maxPerPool must be >= 1")
+	}
+	return &PoolScheduler{
+		maxPerPool: maxPerPool,
+		pools:      make(map[string]*semaphore.S),
+	}
+}
+
+// Acquire blocks until the operation on fs may start or ctx is done.
+// The caller must release the returned guard when the operation is complete.
+func (s *PoolScheduler) Acquire(ctx context.Context, fs *DatasetPath) (*semaphore.AcquireGuard, error) {
+	pool, err := fs.Pool()
+	if err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	sem, ok := s.pools[pool]
+	if !ok {
+		sem = semaphore.New(s.maxPerPool)
+		s.pools[pool] = sem
+	}
+	s.mtx.Unlock()
+	return sem.Acquire(ctx)
+}
+
+var poolScheduler = NewPoolScheduler(envconst.Int64("ZREPL_ZFS_MAX_CONCURRENT_OPERATIONS_PER_POOL", 2))
+
+// AcquirePoolSlot acquires a slot of the process-wide PoolScheduler for the pool of fs.
+// Its limit is configured through environment variable ZREPL_ZFS_MAX_CONCURRENT_OPERATIONS_PER_POOL.
+func AcquirePoolSlot(ctx context.Context, fs *DatasetPath) (*semaphore.AcquireGuard, error) {
+	return poolScheduler.Acquire(ctx, fs)
+}
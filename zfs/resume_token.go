@@ -23,12 +23,18 @@ type ResumeToken struct {
 	ToName                    string
 	HasCompressOK, CompressOK bool
 	HasRawOk, RawOK           bool
+	// send -e and -L, respectively
+	HasEmbedOK, EmbedOK           bool
+	HasLargeBlockOK, LargeBlockOK bool
+	// The position in the stream at which the receive was interrupted.
+	// Bytes is the amount of stream data that was already received.
+	HasObject, HasOffset, HasBytes bool
+	Object, Offset, Bytes          uint64
 }
 
 var resumeTokenNVListRE = regexp.MustCompile(`\t(\S+) = (.*)`)
 
 var resumeTokenContentsRE = regexp.MustCompile(`resume token contents:\nnvlist version: 0`)
-var resumeTokenIsCorruptRE = regexp.MustCompile(`resume token is corrupt`)
 
 var ResumeTokenCorruptError = errors.New("resume token is corrupt")
 var ResumeTokenDecodingNotSupported = errors.New("zfs binary does not allow decoding resume token or zrepl cannot scrape zfs output")
@@ -198,7 +204,7 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 	}
 
 	if !resumeTokenContentsRE.Match(output) {
-		if resumeTokenIsCorruptRE.Match(output) {
+		if ClassifyZFSStderr(output) == ZFSErrorClassResumeTokenCorrupt {
 			return nil, ResumeTokenCorruptError
 		}
 		return nil, ResumeTokenDecodingNotSupported
@@ -228,6 +234,24 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 			rt.HasToGUID = true
 		case "toname":
 			rt.ToName = val
+		case "object":
+			rt.Object, err = strconv.ParseUint(val, 0, 64)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+			rt.HasObject = true
+		case "offset":
+			rt.Offset, err = strconv.ParseUint(val, 0, 64)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+			rt.HasOffset = true
+		case "bytes":
+			rt.Bytes, err = strconv.ParseUint(val, 0, 64)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+			rt.HasBytes = true
 		case "rawok":
 			rt.HasRawOk = true
 			rt.RawOK, err = strconv.ParseBool(val)
@@ -240,6 +264,18 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 			if err != nil {
 				return nil, ResumeTokenParsingError
 			}
+		case "embedok":
+			rt.HasEmbedOK = true
+			rt.EmbedOK, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+		case "largeblockok":
+			rt.HasLargeBlockOK = true
+			rt.LargeBlockOK, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
 		}
 	}
 
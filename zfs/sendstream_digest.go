@@ -0,0 +1,179 @@
+package zfs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// record types of struct dmu_replay_record that are not in sendstream_header.go
+const (
+	sendStreamDRRObject        = 1
+	sendStreamDRRFreeObjects   = 2
+	sendStreamDRRWrite         = 3
+	sendStreamDRRFree          = 4
+	sendStreamDRRWriteByRef    = 6
+	sendStreamDRRSpill         = 7
+	sendStreamDRRWriteEmbedded = 8
+	sendStreamDRRObjectRange   = 9
+	sendStreamDRRRedact        = 10
+)
+
+// sendStreamDigestField is a field of a record's drr_u union that is included in the digest
+type sendStreamDigestField struct {
+	off, len int
+}
+
+// The fields of each record type that describe the dataset's content.
+// Fields that depend on the on-disk representation (checksum and compression type, block pointer checksums,
+// compressed sizes) or on the sending dataset (to-GUID, which is identical anyway) are not included,
+// nor is each record's trailing checksum of the stream, which covers the begin record.
+var sendStreamDigestFields = map[uint32][]sendStreamDigestField{
+	// drr_object, drr_type, drr_bonustype, drr_blksz, drr_bonuslen, drr_dn_slots (at 34)
+	sendStreamDRRObject: {{8, 8}, {16, 4}, {20, 4}, {24, 4}, {28, 4}, {34, 1}},
+	// drr_firstobj, drr_numobjs
+	sendStreamDRRFreeObjects: {{8, 8}, {16, 8}},
+	// drr_object, drr_type, drr_offset, drr_logical_size
+	sendStreamDRRWrite: {{8, 8}, {16, 4}, {24, 8}, {32, 8}},
+	// drr_object, drr_offset, drr_length
+	sendStreamDRRFree:       {{8, 8}, {16, 8}, {24, 8}},
+	sendStreamDRRWriteByRef: {{8, 8}, {16, 8}, {24, 8}},
+	sendStreamDRRRedact:     {{8, 8}, {16, 8}, {24, 8}},
+	// drr_object, drr_length
+	sendStreamDRRSpill: {{8, 8}, {16, 8}},
+	// drr_object, drr_offset, drr_length, drr_compression, drr_etype, drr_lsize, drr_psize
+	sendStreamDRRWriteEmbedded: {{8, 8}, {16, 8}, {24, 8}, {40, 1}, {41, 1}, {48, 4}, {52, 4}},
+	// drr_firstobj, drr_numslots
+	sendStreamDRRObjectRange: {{8, 8}, {16, 8}},
+}
+
+// sendStreamPayloadLen returns the length of the payload that follows record rec.
+func sendStreamPayloadLen(bo binary.ByteOrder, rec []byte) (int64, error) {
+	roundup8 := func(n int64) int64 { return (n + 7) &^ 7 }
+	switch drrType := bo.Uint32(rec[0:]); drrType {
+	case sendStreamDRRObject:
+		// DRR_OBJECT_PAYLOAD_SIZE: drr_raw_bonuslen for raw sends, else the padded drr_bonuslen
+		if rawBonusLen := bo.Uint32(rec[36:]); rawBonusLen != 0 {
+			return int64(rawBonusLen), nil
+		}
+		return roundup8(int64(bo.Uint32(rec[28:]))), nil
+	case sendStreamDRRWrite:
+		// DRR_WRITE_PAYLOAD_SIZE: drr_compressed_size if drr_compressiontype is set
+		if rec[50] != 0 {
+			return int64(bo.Uint64(rec[96:])), nil
+		}
+		return int64(bo.Uint64(rec[32:])), nil
+	case sendStreamDRRSpill:
+		// DRR_SPILL_PAYLOAD_SIZE
+		if rec[33] != 0 {
+			return int64(bo.Uint64(rec[40:])), nil
+		}
+		return int64(bo.Uint64(rec[16:])), nil
+	case sendStreamDRRWriteEmbedded:
+		return roundup8(int64(bo.Uint32(rec[52:]))), nil
+	case sendStreamDRRFreeObjects, sendStreamDRRFree, sendStreamDRRWriteByRef,
+		sendStreamDRRObjectRange, sendStreamDRRRedact, sendStreamDRREnd:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unknown record type %d", drrType)
+	}
+}
+
+// SendStreamDigest reads the (non-compound) zfs send stream r to its end and returns
+// a hex-encoded SHA-256 digest of its records, as well as the number of bytes read.
+//
+// The digest covers the records that describe the content of the dataset
+// (objects, data and the ranges freed by the stream) but not the begin and end
+// records, which contain the name of the sending dataset and a checksum of the
+// entire stream. Thus, the streams of the same send (same from and to snapshot GUIDs,
+// same send flags) on the sending and on the receiving side of a replication
+// have the same digest if the receiver's copy of the data is identical to the sender's.
+// Streams produced by different ZFS versions are not necessarily comparable.
+func SendStreamDigest(r io.Reader) (digest string, n int64, err error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	h := sha256.New()
+
+	rec := make([]byte, sendStreamRecordLen)
+	readRec := func() error {
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return err
+		}
+		n += sendStreamRecordLen
+		return nil
+	}
+
+	if err := readRec(); err != nil {
+		return "", n, errors.Wrap(err, "cannot read begin record")
+	}
+	bo, err := parseSendStreamBeginRecord(rec)
+	if err != nil {
+		return "", n, err
+	}
+	if bo.Uint64(rec[sendStreamBeginVersionOff:])&sendStreamHdrtypeMask == sendStreamHdrtypeCompound {
+		return "", n, fmt.Errorf("digest of compound send streams is not supported")
+	}
+	beginPayloadLen := int64(bo.Uint32(rec[sendStreamPayloadLenOff:]))
+	skipped, err := io.CopyN(ioutil.Discard, br, beginPayloadLen)
+	n += skipped
+	if err != nil {
+		return "", n, errors.Wrap(err, "cannot read begin record payload")
+	}
+
+	var canonical [8]byte // fields are hashed in little endian, regardless of the stream's byte order
+	for {
+		if err := readRec(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // must be terminated by an end record
+			}
+			return "", n, errors.Wrap(err, "cannot read record")
+		}
+		drrType := bo.Uint32(rec[0:])
+		if drrType == sendStreamDRREnd {
+			break
+		}
+		if drrType == sendStreamDRRBegin {
+			return "", n, fmt.Errorf("unexpected begin record at offset %d", n-sendStreamRecordLen)
+		}
+		fields, ok := sendStreamDigestFields[drrType]
+		if !ok {
+			return "", n, fmt.Errorf("unknown record type %d at offset %d", drrType, n-sendStreamRecordLen)
+		}
+		binary.LittleEndian.PutUint32(canonical[:], drrType)
+		h.Write(canonical[:4])
+		for _, f := range fields {
+			switch f.len {
+			case 1:
+				h.Write(rec[f.off : f.off+1])
+			case 4:
+				binary.LittleEndian.PutUint32(canonical[:], bo.Uint32(rec[f.off:]))
+				h.Write(canonical[:4])
+			case 8:
+				binary.LittleEndian.PutUint64(canonical[:], bo.Uint64(rec[f.off:]))
+				h.Write(canonical[:8])
+			}
+		}
+		payloadLen, err := sendStreamPayloadLen(bo, rec)
+		if err != nil {
+			return "", n, err
+		}
+		copied, err := io.CopyN(h, br, payloadLen)
+		n += copied
+		if err != nil {
+			return "", n, errors.Wrapf(err, "cannot read payload of record type %d", drrType)
+		}
+	}
+
+	// drain the stream so that the zfs send process exits successfully
+	drained, err := io.Copy(ioutil.Discard, br)
+	n += drained
+	if err != nil {
+		return "", n, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
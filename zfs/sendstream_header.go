@@ -0,0 +1,115 @@
+package zfs
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SendStreamObjsetType is the type of the dataset that a send stream was generated from,
+// as recorded in the stream's DRR_BEGIN record (dmu_objset_type_t).
+type SendStreamObjsetType uint32
+
+const (
+	SendStreamObjsetTypeNone       SendStreamObjsetType = 0
+	SendStreamObjsetTypeMeta       SendStreamObjsetType = 1
+	SendStreamObjsetTypeFilesystem SendStreamObjsetType = 2
+	SendStreamObjsetTypeVolume     SendStreamObjsetType = 3
+)
+
+func (t SendStreamObjsetType) String() string {
+	switch t {
+	case SendStreamObjsetTypeNone:
+		return "none"
+	case SendStreamObjsetTypeMeta:
+		return "meta"
+	case SendStreamObjsetTypeFilesystem:
+		return "filesystem"
+	case SendStreamObjsetTypeVolume:
+		return "volume"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint32(t))
+	}
+}
+
+const (
+	sendStreamDRRBegin = 0
+	sendStreamDRREnd   = 5
+	sendStreamMagic    = 0x2F5bacbac
+	// sizeof(dmu_replay_record_t)
+	sendStreamRecordLen = 312
+	// struct dmu_replay_record { drr_type uint32; drr_payloadlen uint32; drr_begin { drr_magic uint64;
+	// drr_versioninfo uint64; drr_creation_time uint64; drr_type uint32; ... } }
+	sendStreamPayloadLenOff      = 4
+	sendStreamBeginMagicOff      = 8
+	sendStreamBeginVersionOff    = 16
+	sendStreamBeginObjsetTypeOff = 32
+	sendStreamBeginMinLen        = sendStreamBeginObjsetTypeOff + 4
+	// DMU_GET_STREAM_HDRTYPE
+	sendStreamHdrtypeMask     = 0x3
+	sendStreamHdrtypeCompound = 2
+)
+
+type SendStreamHeader struct {
+	// SendStreamObjsetTypeNone if the substream of a compound stream is beyond the parsed bytes
+	ObjsetType SendStreamObjsetType
+	// Compound streams are produced by zfs send -R, -p and -b.
+	// Their header carries an nvlist of the dataset properties.
+	Compound bool
+}
+
+// ParseSendStreamHeader parses the first bytes of a zfs send stream.
+// The byte order of the stream is that of the sending host and is detected using the stream's magic number.
+//
+// For compound streams, the outer begin record does not specify a dataset type,
+// so the first begin record of the substream is parsed if header is long enough.
+func ParseSendStreamHeader(header []byte) (h SendStreamHeader, err error) {
+	bo, err := parseSendStreamBeginRecord(header)
+	if err != nil {
+		return h, err
+	}
+	if bo.Uint64(header[sendStreamBeginVersionOff:])&sendStreamHdrtypeMask != sendStreamHdrtypeCompound {
+		h.ObjsetType = SendStreamObjsetType(bo.Uint32(header[sendStreamBeginObjsetTypeOff:]))
+		return h, nil
+	}
+
+	h.Compound = true
+	// begin record, nvlist payload, end record, then the substream
+	endOff := sendStreamRecordLen + int64(bo.Uint32(header[sendStreamPayloadLenOff:]))
+	subOff := endOff + sendStreamRecordLen
+	if int64(len(header)) < subOff {
+		return h, nil
+	}
+	if drrType := bo.Uint32(header[endOff:]); drrType != sendStreamDRREnd {
+		return h, fmt.Errorf("compound send stream header not terminated by end record: record type %d", drrType)
+	}
+	sub := header[subOff:]
+	if len(sub) < sendStreamBeginMinLen {
+		return h, nil
+	}
+	if bo, err = parseSendStreamBeginRecord(sub); err != nil {
+		return h, errors.Wrap(err, "substream of compound send stream")
+	}
+	h.ObjsetType = SendStreamObjsetType(bo.Uint32(sub[sendStreamBeginObjsetTypeOff:]))
+	return h, nil
+}
+
+func parseSendStreamBeginRecord(header []byte) (binary.ByteOrder, error) {
+	if len(header) < sendStreamBeginMinLen {
+		return nil, fmt.Errorf("send stream header too short: %d bytes", len(header))
+	}
+	var bo binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint64(header[sendStreamBeginMagicOff:]) == sendStreamMagic:
+		bo = binary.LittleEndian
+	case binary.BigEndian.Uint64(header[sendStreamBeginMagicOff:]) == sendStreamMagic:
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("send stream does not start with a begin record: invalid magic")
+	}
+	if drrType := bo.Uint32(header[0:]); drrType != sendStreamDRRBegin {
+		return nil, fmt.Errorf("send stream does not start with a begin record: record type %d", drrType)
+	}
+	return bo, nil
+}
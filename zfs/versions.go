@@ -98,6 +98,10 @@ type FilesystemVersion struct {
 
 	// userrefs field (snapshots only)
 	UserRefs OptionUint64
+
+	// the values of ListFilesystemVersionsOptions.UserProperties, the empty string if a property is not set,
+	// nil if no user properties were requested
+	UserProperties map[string]string
 }
 
 type OptionUint64 struct {
@@ -198,6 +202,31 @@ type ListFilesystemVersionsOptions struct {
 	// which types should be returned
 	// nil or len(0) means any prefix matches
 	Types VersionTypeSet
+
+	// user properties to list along with the versions, see FilesystemVersion.UserProperties.
+	// The names must pass ValidateUserPropertyName.
+	UserProperties []string
+}
+
+// listProperties are the properties that `zfs list` must output for the versions, in this order:
+// those of ParseFilesystemVersionArgs, then the UserProperties.
+func (o *ListFilesystemVersionsOptions) listProperties() []string {
+	return append([]string{"name", "guid", "createtxg", "creation", "userrefs"}, o.UserProperties...)
+}
+
+// parseUserProperties sets v.UserProperties from the fields of a `zfs list` line that follow those of ParseFilesystemVersionArgs.
+func (o *ListFilesystemVersionsOptions) parseUserProperties(v *FilesystemVersion, fields []string) {
+	if len(o.UserProperties) == 0 {
+		return
+	}
+	v.UserProperties = make(map[string]string, len(o.UserProperties))
+	for i, prop := range o.UserProperties {
+		value := fields[i]
+		if value == "-" {
+			value = "" // not set
+		}
+		v.UserProperties[prop] = value
+	}
 }
 
 func (o *ListFilesystemVersionsOptions) typesFlagArgs() string {
@@ -230,7 +259,7 @@ func ZFSListFilesystemVersions(ctx context.Context, fs *DatasetPath, options Lis
 	go func() {
 		defer wg.Done()
 		ZFSListChan(ctx, listResults,
-			[]string{"name", "guid", "createtxg", "creation", "userrefs"},
+			options.listProperties(),
 			fs,
 			"-r", "-d", "1",
 			"-t", options.typesFlagArgs(),
@@ -255,6 +284,7 @@ func ZFSListFilesystemVersions(ctx context.Context, fs *DatasetPath, options Lis
 		if err != nil {
 			return nil, err
 		}
+		options.parseUserProperties(&v, line[5:])
 
 		if options.matches(v) {
 			res = append(res, v)
@@ -277,3 +307,94 @@ func ZFSGetFilesystemVersion(ctx context.Context, ds string) (v FilesystemVersio
 		userrefs:  props.Get("userrefs"),
 	})
 }
+
+// ZFSListFilesystemVersionsBulk is like ZFSListFilesystemVersions, but for many filesystems at once.
+// Instead of one `zfs list` invocation per filesystem, it issues one recursive `zfs list`
+// per pool (rooted at the deepest common ancestor of the pool's filesystems in fss)
+// and demultiplexes the output per filesystem.
+//
+// The returned map has an entry for every filesystem in fss, keyed by DatasetPath.ToString().
+// The versions of each filesystem are sorted by createtxg.
+func ZFSListFilesystemVersionsBulk(ctx context.Context, fss []*DatasetPath, options ListFilesystemVersionsOptions) (map[string][]FilesystemVersion, error) {
+	res := make(map[string][]FilesystemVersion, len(fss))
+	roots := make(map[string]*DatasetPath) // pool => common ancestor
+	for _, fs := range fss {
+		pool, err := fs.Pool()
+		if err != nil {
+			return nil, err
+		}
+		res[fs.ToString()] = make([]FilesystemVersion, 0)
+		if root, ok := roots[pool]; ok {
+			roots[pool] = commonAncestor(root, fs)
+		} else {
+			roots[pool] = fs
+		}
+	}
+
+	for _, root := range roots {
+		if err := zfsListFilesystemVersionsBulkRoot(ctx, root, options, res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func commonAncestor(a, b *DatasetPath) *DatasetPath {
+	n := 0
+	for n < len(a.comps) && n < len(b.comps) && a.comps[n] == b.comps[n] {
+		n++
+	}
+	c := &DatasetPath{comps: make([]string, n)}
+	copy(c.comps, a.comps[:n])
+	return c
+}
+
+// res must contain an entry for every filesystem whose versions shall be collected
+func zfsListFilesystemVersionsBulkRoot(ctx context.Context, root *DatasetPath, options ListFilesystemVersionsOptions, res map[string][]FilesystemVersion) error {
+	listResults := make(chan ZFSListResult)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer wg.Wait()
+	defer cancel()
+	go func() {
+		defer wg.Done()
+		ZFSListChan(ctx, listResults,
+			options.listProperties(),
+			root,
+			"-r",
+			"-t", options.typesFlagArgs(),
+			"-s", "createtxg", root.ToString())
+	}()
+
+	for listResult := range listResults {
+		if listResult.Err != nil {
+			return listResult.Err
+		}
+
+		line := listResult.Fields
+		fs, _, _, err := DecomposeVersionString(line[0])
+		if err != nil {
+			return err
+		}
+		if _, ok := res[fs]; !ok {
+			continue // not requested
+		}
+		v, err := ParseFilesystemVersion(ParseFilesystemVersionArgs{
+			fullname:  line[0],
+			guid:      line[1],
+			createtxg: line[2],
+			creation:  line[3],
+			userrefs:  line[4],
+		})
+		if err != nil {
+			return err
+		}
+		options.parseUserProperties(&v, line[5:])
+		if options.matches(v) {
+			res[fs] = append(res[fs], v)
+		}
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/pkg/errors"
+
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
@@ -237,3 +239,139 @@ func (d destroyerImpl) DestroySnapshotsCommaSyntaxSupported(ctx context.Context)
 	})
 	return batchDestroyFeatureCheck.enable, batchDestroyFeatureCheck.err
 }
+
+var destroySnapshotsRangeSyntaxEnabled = envconst.Bool("ZREPL_ZFS_DESTROY_SNAPSHOTS_RANGE_SYNTAX", true)
+
+// ZFSDestroySnapshotsBatch destroys the snapshots snapnames of fs and
+// returns the error for each of them (nil if it was destroyed).
+//
+// Snapshots that are consecutive in the filesystem's createtxg order are collapsed
+// into `fs@a%b` range arguments, such that usually a single `zfs destroy` invocation
+// suffices. If that invocation fails (it is atomic), or if range syntax is not available,
+// the destroys are done by ZFSDestroyFilesystemVersions.
+func ZFSDestroySnapshotsBatch(ctx context.Context, fs *DatasetPath, snapnames []string) []error {
+	errs := make([]error, len(snapnames))
+
+	rangeCovered := make(map[string]bool, len(snapnames))
+	if arg, covered := zfsDestroySnapshotsRangeArg(ctx, fs, snapnames); arg != "" {
+		if err := ZFSDestroy(ctx, arg); err != nil {
+			debug("batch destroy: range destroy %q failed, falling back: %s", arg, err)
+		} else {
+			rangeCovered = covered
+		}
+	}
+
+	var reqs []*DestroySnapOp
+	for i := range snapnames {
+		if rangeCovered[snapnames[i]] {
+			continue
+		}
+		reqs = append(reqs, &DestroySnapOp{
+			Filesystem: fs.ToString(),
+			Name:       snapnames[i],
+			ErrOut:     &errs[i],
+		})
+	}
+	ZFSDestroyFilesystemVersions(ctx, reqs)
+	return errs
+}
+
+// returns "" if range syntax cannot or need not be used
+func zfsDestroySnapshotsRangeArg(ctx context.Context, fs *DatasetPath, snapnames []string) (arg string, covered map[string]bool) {
+	if !destroySnapshotsRangeSyntaxEnabled || len(snapnames) < 2 {
+		return "", nil
+	}
+	if useLZC() {
+		return "", nil // lzc destroys all snapshots in one ioctl anyways
+	}
+	// range syntax was introduced along with comma syntax
+	if supported, err := destroyerSingleton.DestroySnapshotsCommaSyntaxSupported(ctx); err != nil || !supported {
+		return "", nil
+	}
+	// The ranges must be computed from a listing that is sorted by createtxg.
+	// Snapshots created after the listing are never part of a range
+	// because their createtxg is larger than that of any listed snapshot.
+	listed, err := ZFSListFilesystemVersions(ctx, fs, ListFilesystemVersionsOptions{Types: Snapshots})
+	if err != nil {
+		debug("batch destroy: cannot list snapshots of %q for range syntax: %s", fs.ToString(), err)
+		return "", nil
+	}
+	sorted := make([]string, len(listed))
+	for i := range listed {
+		sorted[i] = listed[i].Name
+	}
+	return destroySnapshotsRangeArg(fs.ToString(), sorted, snapnames)
+}
+
+// sorted are the names of all snapshots of fs, sorted by createtxg.
+// Snapshots in destroy that are not in sorted are not covered by the returned argument.
+func destroySnapshotsRangeArg(fs string, sorted []string, destroy []string) (arg string, covered map[string]bool) {
+	destroySet := make(map[string]bool, len(destroy))
+	for _, name := range destroy {
+		if name == "" || strings.ContainsAny(name, "%,") {
+			return "", nil // defensive, not a valid snapshot name
+		}
+		destroySet[name] = true
+	}
+
+	covered = make(map[string]bool, len(destroy))
+	var parts []string
+	for i := 0; i < len(sorted); {
+		if !destroySet[sorted[i]] {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(sorted) && destroySet[sorted[j+1]] {
+			j++
+		}
+		if i == j {
+			parts = append(parts, sorted[i])
+		} else {
+			parts = append(parts, fmt.Sprintf("%s%%%s", sorted[i], sorted[j]))
+		}
+		for k := i; k <= j; k++ {
+			covered[sorted[k]] = true
+		}
+		i = j + 1
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s@%s", fs, strings.Join(parts, ",")), covered
+}
+
+// ZFSListSnapshotClones returns the clones of each snapshot of fs that has clones, keyed by snapshot name.
+// Such snapshots cannot be destroyed until their clones are destroyed or promoted.
+func ZFSListSnapshotClones(ctx context.Context, fs *DatasetPath) (map[string][]string, error) {
+	lines, err := ZFSList(ctx, []string{"name", "clones"}, "-t", "snapshot", "-d", "1", fs.ToString())
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshotClones(fs.ToString(), lines)
+}
+
+func parseSnapshotClones(fs string, lines [][]string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	for _, l := range lines {
+		comps := strings.SplitN(l[0], "@", 2)
+		if len(comps) != 2 || comps[0] != fs {
+			return nil, fmt.Errorf("unexpected snapshot name %q in listing of %q", l[0], fs)
+		}
+		if l[1] == "" || l[1] == "-" {
+			continue
+		}
+		res[comps[1]] = strings.Split(l[1], ",")
+	}
+	return res, nil
+}
+
+// ZFSDestroyDeferred destroys snapshot snapname of fs with `zfs destroy -d`:
+// if the snapshot has clones or holds, ZFS marks it for destruction once the last of them is gone.
+func ZFSDestroyDeferred(ctx context.Context, fs *DatasetPath, snapname string) error {
+	arg := fmt.Sprintf("%s@%s", fs.ToString(), snapname)
+	if err := EntityNamecheck(arg, EntityTypeSnapshot); err != nil {
+		return errors.Wrap(err, "zfs destroy -d")
+	}
+	return zfsRunCombined(ctx, "destroy", "-d", arg)
+}
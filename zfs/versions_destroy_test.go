@@ -294,3 +294,30 @@ func TestExcessiveArgumentsResultInE2BIG(t *testing.T) {
 		t.Logf("output:\n%s", output)
 	}
 }
+
+func TestDestroySnapshotsRangeArg(t *testing.T) {
+	sorted := []string{"a", "b", "c", "d", "e", "f", "g"}
+
+	arg, covered := destroySnapshotsRangeArg("pool/fs", sorted, []string{"e", "a", "b", "c", "g", "x"})
+	assert.Equal(t, "pool/fs@a%c,e,g", arg)
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "c": true, "e": true, "g": true}, covered)
+
+	arg, _ = destroySnapshotsRangeArg("pool/fs", sorted, []string{"x", "y"})
+	assert.Equal(t, "", arg)
+
+	arg, _ = destroySnapshotsRangeArg("pool/fs", sorted, []string{"a", "b%d"})
+	assert.Equal(t, "", arg)
+}
+
+func TestParseSnapshotClones(t *testing.T) {
+	clones, err := parseSnapshotClones("pool/fs", [][]string{
+		{"pool/fs@a", ""},
+		{"pool/fs@b", "pool/clone1,pool/other/clone2"},
+		{"pool/fs@c", "-"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"b": {"pool/clone1", "pool/other/clone2"}}, clones)
+
+	_, err = parseSnapshotClones("pool/fs", [][]string{{"pool/fs/child@a", ""}})
+	assert.Error(t, err)
+}
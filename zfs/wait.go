@@ -0,0 +1,46 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+type WaitActivity string
+
+const (
+	// Wait for the delete queue of fs to be processed (zfs wait -t deleteq).
+	WaitActivityDeleteq WaitActivity = "deleteq"
+	// Wait for the background freeing of destroyed datasets and snapshots
+	// in the pool that contains fs to complete (zpool wait -t free).
+	// This is when the space of destroyed snapshots becomes available.
+	WaitActivityFree WaitActivity = "free"
+)
+
+// ZFSWait blocks until activity is complete or ctx is done.
+// Requires OpenZFS 2.0 or newer.
+func ZFSWait(ctx context.Context, fs *DatasetPath, activity WaitActivity) error {
+	pool, err := fs.Pool()
+	if err != nil {
+		return err
+	}
+	var cmd *zfscmd.Cmd
+	switch activity {
+	case WaitActivityDeleteq:
+		cmd = zfscmd.CommandContext(ctx, ZFS_BINARY, "wait", "-t", string(activity), fs.ToString())
+	case WaitActivityFree:
+		cmd = zfscmd.CommandContext(ctx, "zpool", "wait", "-t", string(activity), pool)
+	default:
+		return fmt.Errorf("zfs wait: unknown activity %q", activity)
+	}
+	debug("wait: %s %s", activity, fs.ToString())
+	output, err := cmd.Unbudgeted().CombinedOutput()
+	if err != nil {
+		return &ZFSError{
+			Stderr:  output,
+			WaitErr: err,
+		}
+	}
+	return nil
+}
@@ -160,7 +160,11 @@ type ZFSError struct {
 }
 
 func (e *ZFSError) Error() string {
-	return fmt.Sprintf("zfs exited with error: %s\nstderr:\n%s", e.WaitErr.Error(), e.Stderr)
+	msg := fmt.Sprintf("zfs exited with error: %s\nstderr:\n%s", e.WaitErr.Error(), e.Stderr)
+	if hint := e.Class().Hint(); hint != "" {
+		msg = fmt.Sprintf("%s\nhint: %s", msg, hint)
+	}
+	return msg
 }
 
 var ZFS_BINARY string = "zfs"
@@ -173,6 +177,13 @@ func ZFSList(ctx context.Context, properties []string, zfsArgs ...string) (res [
 		"-o", strings.Join(properties, ","))
 	args = append(args, zfsArgs...)
 
+	// unlike ZFSListChan, the output is read at once
+	guard, err := zfscmd.AcquireBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
@@ -339,8 +350,24 @@ func (a ZFSSendArgsUnvalidated) buildCommonSendArgs() ([]string, error) {
 		return args, nil
 	}
 
-	if a.Encrypted.B {
+	if a.Encrypted.B || a.Raw {
 		args = append(args, "-w")
+	} else {
+		if a.Compressed {
+			args = append(args, "-c")
+		}
+		if a.EmbeddedData {
+			args = append(args, "-e")
+		}
+		if a.LargeBlocks {
+			args = append(args, "-L")
+		}
+	}
+	if a.Properties {
+		args = append(args, "-p")
+	}
+	if a.BackupProperties {
+		args = append(args, "-b")
 	}
 
 	toV, err := absVersion(a.FS, a.To)
@@ -359,7 +386,11 @@ func (a ZFSSendArgsUnvalidated) buildCommonSendArgs() ([]string, error) {
 	if fromV == "" { // Initial
 		args = append(args, toV)
 	} else {
-		args = append(args, "-i", fromV, toV)
+		incrementalFlag := "-i"
+		if a.Intermediates {
+			incrementalFlag = "-I"
+		}
+		args = append(args, incrementalFlag, fromV, toV)
 	}
 	return args, nil
 }
@@ -379,6 +410,8 @@ func pipeWithCapacityHint(capacity int) (r, w *os.File, err error) {
 type SendStream struct {
 	cmd  *zfscmd.Cmd
 	kill context.CancelFunc
+	// nil unless the stream is written by lzc_send, in which case cmd and kill are nil
+	lzc *lzcSendStream
 
 	closeMtx     sync.Mutex
 	stdoutReader *os.File
@@ -416,6 +449,9 @@ func (s *SendStream) killAndWait(precedingReadErr error) error {
 
 	debug("sendStream: killAndWait enter")
 	defer debug("sendStream: killAndWait leave")
+	if s.lzc != nil {
+		return s.killAndWaitLZC(precedingReadErr)
+	}
 	if precedingReadErr == io.EOF {
 		// give the zfs process a little bit of time to terminate itself
 		// if it holds this deadline, exitErr will be nil
@@ -584,6 +620,19 @@ type ZFSSendArgsUnvalidated struct {
 	FS        string
 	From, To  *ZFSSendArgVersion // From may be nil
 	Encrypted *NilBool
+	// If true, do a raw send (send -w) even if Encrypted is false,
+	// i.e., also for filesystems that are not encrypted.
+	Raw bool
+	// send -c, -e and -L, respectively. Implied by raw sends.
+	Compressed   bool
+	EmbeddedData bool
+	LargeBlocks  bool
+	// send -p and -b, respectively. Mutually exclusive.
+	Properties       bool
+	BackupProperties bool
+	// send -I instead of -i, i.e., include all snapshots between From and To.
+	// From must be a snapshot.
+	Intermediates bool
 
 	// Preferred if not empty
 	ResumeToken string // if not nil, must match what is specified in From, To (covered by ValidateCorrespondsToResumeToken)
@@ -653,10 +702,18 @@ func (a ZFSSendArgsUnvalidated) Validate(ctx context.Context) (v ZFSSendArgsVali
 		// fallthrough
 	}
 
+	if a.Intermediates && (fromVersion == nil || fromVersion.Type != Snapshot) {
+		return v, newGenericValidationError(a, fmt.Errorf("`Intermediates` requires `From` to be a snapshot"))
+	}
+
 	if err := a.Encrypted.Validate(); err != nil {
 		return v, newGenericValidationError(a, errors.Wrap(err, "`Raw` invalid"))
 	}
 
+	if a.Properties && a.BackupProperties {
+		return v, newGenericValidationError(a, fmt.Errorf("`Properties` and `BackupProperties` are mutually exclusive"))
+	}
+
 	valCtx := &zfsSendArgsValidationContext{}
 	fsEncrypted, err := ZFSGetEncryptionEnabled(ctx, a.FS)
 	if err != nil {
@@ -757,12 +814,21 @@ func (a ZFSSendArgsUnvalidated) validateCorrespondsToResumeToken(ctx context.Con
 		return gen.fmt("resume token `toguid` != expected: %v != %v", t.ToGUID, a.To.GUID)
 	}
 
-	if a.Encrypted.B {
+	if a.Encrypted.B || a.Raw {
 		if !(t.RawOK && t.CompressOK) {
 			return ZFSSendArgsResumeTokenMismatchEncryptionNotSet.fmt(
 				"resume token must have `rawok` and `compressok` = true but got %v %v", t.RawOK, t.CompressOK)
 		}
 		// fallthrough
+	} else if a.Compressed {
+		if t.RawOK {
+			return ZFSSendArgsResumeTokenMismatchEncryptionSet.fmt(
+				"resume token must not have `rawok` set but got %v", t.RawOK)
+		}
+		if !t.CompressOK {
+			return gen.fmt("resume token must have `compressok` = true for compressed send but got %v", t.CompressOK)
+		}
+		// fallthrough
 	} else {
 		if t.RawOK || t.CompressOK {
 			return ZFSSendArgsResumeTokenMismatchEncryptionSet.fmt(
@@ -790,7 +856,7 @@ func ZFSSend(ctx context.Context, sendArgs ZFSSendArgsValidated) (*SendStream, e
 
 	// pre-validation of sendArgs for plain ErrEncryptedSendNotSupported error
 	// TODO go1.13: push this down to sendArgs.Validate
-	if encryptedSendValid := sendArgs.Encrypted.Validate(); encryptedSendValid == nil && sendArgs.Encrypted.B {
+	if encryptedSendValid := sendArgs.Encrypted.Validate(); (encryptedSendValid == nil && sendArgs.Encrypted.B) || sendArgs.Raw {
 		supported, err := EncryptionCLISupported(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot determine CLI native encryption support")
@@ -800,6 +866,12 @@ func ZFSSend(ctx context.Context, sendArgs ZFSSendArgsValidated) (*SendStream, e
 		}
 	}
 
+	if snap, from, flags, resumeObj, resumeOff, ok, err := lzcSendArgs(ctx, sendArgs); err != nil {
+		return nil, err
+	} else if ok {
+		return zfsSendLZC(ctx, snap, from, flags, resumeObj, resumeOff)
+	}
+
 	sargs, err := sendArgs.buildCommonSendArgs()
 	if err != nil {
 		return nil, err
@@ -972,6 +1044,14 @@ func ZFSSendDry(ctx context.Context, sendArgs ZFSSendArgsValidated) (_ *DrySendI
 			SizeEstimate: -1}, nil
 	}
 
+	if sendArgs.ResumeToken == "" {
+		if snap, from, flags, _, _, ok, err := lzcSendArgs(ctx, sendArgs); err != nil {
+			return nil, err
+		} else if ok {
+			return zfsSendDryLZC(ctx, sendArgs, snap, from, flags)
+		}
+	}
+
 	args := make([]string, 0)
 	args = append(args, "send", "-n", "-v", "-P")
 	sargs, err := sendArgs.buildCommonSendArgs()
@@ -998,6 +1078,24 @@ type RecvOptions struct {
 	RollbackAndForceRecv bool
 	// Set -s flag used for resumable send & recv
 	SavePartialRecvState bool
+	// Properties to set on the received dataset (recv -o property=value),
+	// overriding the values contained in the stream (if any).
+	OverrideProperties map[string]string
+	// Properties that must not be received from the stream (recv -x property).
+	ExcludeProperties []string
+}
+
+func recvOverridePropertiesArgs(props map[string]string) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic command line
+	args := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, "-o", fmt.Sprintf("%s=%s", name, props[name]))
+	}
+	return args
 }
 
 type ErrRecvResumeNotSupported struct {
@@ -1075,6 +1173,13 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, stream io.Rea
 		}
 		args = append(args, "-s")
 	}
+	if lzcRecvSupported(opts) {
+		return zfsRecvLZC(ctx, fsdp, v.FullPath(fs), stream, opts)
+	}
+	args = append(args, recvOverridePropertiesArgs(opts.OverrideProperties)...)
+	for _, prop := range opts.ExcludeProperties {
+		args = append(args, "-x", prop)
+	}
 	args = append(args, v.FullPath(fs))
 
 	ctx, cancelCmd := context.WithCancel(ctx)
@@ -1242,10 +1347,11 @@ func ZFSRecvClearResumeToken(ctx context.Context, fs string) (err error) {
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "recv", "-A", fs)
 	o, err := cmd.CombinedOutput()
 	if err != nil {
-		if bytes.Contains(o, []byte("does not have any resumable receive state to abort")) {
+		clearErr := &ClearResumeTokenError{o, err}
+		if clearErr.Class() == ZFSErrorClassNoResumableState {
 			return nil
 		}
-		return &ClearResumeTokenError{o, err}
+		return clearErr
 	}
 	return nil
 }
@@ -1329,6 +1435,34 @@ func ZFSGetGUID(ctx context.Context, fs string, version string) (g uint64, err e
 	return strconv.ParseUint(props.Get("guid"), 10, 64)
 }
 
+// ZFSListWrittenSince returns the value of the written@snap property of each filesystem in fss, keyed by filesystem name,
+// i.e., the amount of referenced space written to the filesystem since its snapshot snap was created.
+// snap is the snapshot name without the filesystem and @.
+// All filesystems are queried with a single zfs command.
+func ZFSListWrittenSince(ctx context.Context, fss []*DatasetPath, snap string) (map[string]uint64, error) {
+	names := make([]string, len(fss))
+	for i, fs := range fss {
+		if err := EntityNamecheck(fmt.Sprintf("%s@%s", fs.ToString(), snap), EntityTypeSnapshot); err != nil {
+			return nil, errors.Wrap(err, "invalid snapshot name")
+		}
+		names[i] = fs.ToString()
+	}
+	prop := fmt.Sprintf("written@%s", snap)
+	lines, err := ZFSList(ctx, []string{"name", prop}, names...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]uint64, len(lines))
+	for _, l := range lines {
+		written, err := strconv.ParseUint(l[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: cannot parse %s", l[0], prop)
+		}
+		res[l[0]] = written
+	}
+	return res, nil
+}
+
 type GetMountpointOutput struct {
 	Mounted    bool
 	Mountpoint string
@@ -1482,7 +1616,6 @@ func (e *DestroySnapshotsError) Error() string {
 
 var destroySnapshotsErrorRegexp = regexp.MustCompile(`^cannot destroy snapshot ([^@]+)@(.+): (.*)$`) // yes, datasets can contain `:`
 
-var destroyOneOrMoreSnapshotsNoneExistedErrorRegexp = regexp.MustCompile(`^could not find any snapshots to destroy; check snapshot names.`)
 
 var destroyBookmarkDoesNotExist = regexp.MustCompile(`^bookmark '([^']+)' does not exist`)
 
@@ -1543,6 +1676,10 @@ func ZFSDestroy(ctx context.Context, arg string) (err error) {
 
 	defer prometheus.NewTimer(prom.ZFSDestroyDuration.WithLabelValues(dstype, filesystem))
 
+	if useLZC() && dstype != "filesystem" {
+		return zfsDestroyLZC(ctx, arg)
+	}
+
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "destroy", arg)
 	stdio, err := cmd.CombinedOutput()
 	if err != nil {
@@ -1551,7 +1688,7 @@ func ZFSDestroy(ctx context.Context, arg string) (err error) {
 			WaitErr: err,
 		}
 
-		if destroyOneOrMoreSnapshotsNoneExistedErrorRegexp.Match(stdio) {
+		if ClassifyZFSStderr(stdio) == ZFSErrorClassNoSnapshotsToDestroy {
 			err = &DatasetDoesNotExist{arg}
 		} else if match := destroyBookmarkDoesNotExist.FindStringSubmatch(string(stdio)); match != nil && match[1] == arg {
 			err = &DatasetDoesNotExist{arg}
@@ -1585,6 +1722,10 @@ func ZFSSnapshot(ctx context.Context, fs *DatasetPath, name string, recursive bo
 		return errors.Wrap(err, "zfs snapshot")
 	}
 
+	if useLZC() {
+		return zfsSnapshotLZC(ctx, snapname)
+	}
+
 	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "snapshot", snapname)
 	stdio, err := cmd.CombinedOutput()
 	if err != nil {
@@ -1598,8 +1739,6 @@ func ZFSSnapshot(ctx context.Context, fs *DatasetPath, name string, recursive bo
 
 }
 
-var zfsBookmarkExistsRegex = regexp.MustCompile("^cannot create bookmark '[^']+': bookmark exists")
-
 type BookmarkExists struct {
 	zfsMsg         string
 	fs, bookmark   string
@@ -1613,12 +1752,11 @@ func (e *BookmarkExists) Error() string {
 	)
 }
 
-var ErrBookmarkCloningNotSupported = fmt.Errorf("bookmark cloning feature is not yet supported by ZFS")
+var ErrBookmarkCloningNotSupported = fmt.Errorf("bookmark cloning feature is not supported by ZFS or pool")
 
 // idempotently create bookmark of the given version v
 //
-// if `v` is a bookmark, returns ErrBookmarkCloningNotSupported
-// unless a bookmark with the name `bookmark` exists and has the same idenitty (zfs.FilesystemVersionEqualIdentity)
+// if `v` is a bookmark, see ZFSBookmarkFromBookmark
 //
 // v must be validated by the caller
 //
@@ -1643,16 +1781,7 @@ func ZFSBookmark(ctx context.Context, fs string, v FilesystemVersion, bookmark s
 	}
 
 	if v.IsBookmark() {
-		existingBm, err := ZFSGetFilesystemVersion(ctx, bookmarkname)
-		if _, ok := err.(*DatasetDoesNotExist); ok {
-			return bm, ErrBookmarkCloningNotSupported
-		} else if err != nil {
-			return bm, errors.Wrap(err, "bookmark: idempotency check for bookmark cloning")
-		}
-		if FilesystemVersionEqualIdentity(bm, existingBm) {
-			return existingBm, nil
-		}
-		return bm, ErrBookmarkCloningNotSupported // TODO This is work in progress: https://github.com/zfsonlinux/zfs/pull/9571
+		return ZFSBookmarkFromBookmark(ctx, fs, v, bookmark)
 	}
 
 	snapname := v.FullPath(fs)
@@ -1660,12 +1789,28 @@ func ZFSBookmark(ctx context.Context, fs string, v FilesystemVersion, bookmark s
 		return bm, err
 	}
 
-	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "bookmark", snapname, bookmarkname)
-	stdio, err := cmd.CombinedOutput()
+	var stdio []byte
+	var bookmarkExists bool
+	if useLZC() {
+		bookmarkExists, err = zfsBookmarkLZC(ctx, snapname, bookmarkname)
+		if _, ok := err.(*DatasetDoesNotExist); ok {
+			return bm, err
+		}
+		if err != nil {
+			stdio = []byte(err.Error())
+		}
+	} else {
+		cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "bookmark", snapname, bookmarkname)
+		stdio, err = cmd.CombinedOutput()
+		if err != nil {
+			if ddne := tryDatasetDoesNotExist(snapname, stdio); ddne != nil {
+				return bm, ddne
+			}
+			bookmarkExists = ClassifyZFSStderr(stdio) == ZFSErrorClassBookmarkExists
+		}
+	}
 	if err != nil {
-		if ddne := tryDatasetDoesNotExist(snapname, stdio); ddne != nil {
-			return bm, ddne
-		} else if zfsBookmarkExistsRegex.Match(stdio) {
+		if bookmarkExists {
 
 			// check if this was idempotent
 			bookGuid, err := ZFSGetGUID(ctx, fs, "#"+bookmark)
@@ -1717,3 +1862,46 @@ func ZFSRollback(ctx context.Context, fs *DatasetPath, snapshot FilesystemVersio
 
 	return err
 }
+
+func zfsRunCombined(ctx context.Context, args ...string) error {
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, args...)
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		return &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+// ZFSRename renames filesystem or volume from to to. Descendants are renamed along with it.
+func ZFSRename(ctx context.Context, from, to *DatasetPath) error {
+	if err := EntityNamecheck(from.ToString(), EntityTypeFilesystem); err != nil {
+		return errors.Wrap(err, "zfs rename")
+	}
+	if err := EntityNamecheck(to.ToString(), EntityTypeFilesystem); err != nil {
+		return errors.Wrap(err, "zfs rename")
+	}
+	return zfsRunCombined(ctx, "rename", from.ToString(), to.ToString())
+}
+
+// ZFSClone creates filesystem or volume target as a clone of snapshot of fs.
+func ZFSClone(ctx context.Context, fs *DatasetPath, snapshot FilesystemVersion, target *DatasetPath) error {
+	snapabs := snapshot.ToAbsPath(fs)
+	if snapshot.Type != Snapshot {
+		return fmt.Errorf("can only clone snapshots, got %s", snapabs)
+	}
+	if err := EntityNamecheck(target.ToString(), EntityTypeFilesystem); err != nil {
+		return errors.Wrap(err, "zfs clone")
+	}
+	return zfsRunCombined(ctx, "clone", snapabs, target.ToString())
+}
+
+// ZFSPromote promotes clone fs so that it no longer depends on its origin snapshot.
+func ZFSPromote(ctx context.Context, fs *DatasetPath) error {
+	if err := EntityNamecheck(fs.ToString(), EntityTypeFilesystem); err != nil {
+		return errors.Wrap(err, "zfs promote")
+	}
+	return zfsRunCombined(ctx, "promote", fs.ToString())
+}
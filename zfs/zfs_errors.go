@@ -0,0 +1,167 @@
+package zfs
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ZFSErrorClass classifies the failure of a zfs command by the error message it printed on stderr.
+//
+// The zfs package decides how to handle a failure through the stderr patterns below,
+// callers use ZFSErrorClassOf or the Class methods of the error types.
+// The parsers of the remaining stderr regexps only extract details from a message,
+// e.g., the names in the errors of zfs destroy or the resume token of a failed zfs recv.
+type ZFSErrorClass int
+
+const (
+	ZFSErrorClassUnknown ZFSErrorClass = iota
+	ZFSErrorClassDatasetBusy
+	ZFSErrorClassPermissionDenied
+	ZFSErrorClassNoSuchDataset
+	ZFSErrorClassPoolSuspended
+	ZFSErrorClassOutOfSpace
+	// zfs hold: the snapshot already has a hold with the tag
+	ZFSErrorClassHoldExists
+	// zfs recv -A: the filesystem has no partially received state
+	ZFSErrorClassNoResumableState
+	// zfs release: the snapshot has no hold with the tag
+	ZFSErrorClassNoSuchHold
+	// zfs bookmark: a bookmark with the name already exists
+	ZFSErrorClassBookmarkExists
+	// zfs destroy: none of the snapshots to destroy exist
+	ZFSErrorClassNoSnapshotsToDestroy
+	// zfs send -nvt: the resume token cannot be decoded
+	ZFSErrorClassResumeTokenCorrupt
+)
+
+func (c ZFSErrorClass) String() string {
+	switch c {
+	case ZFSErrorClassDatasetBusy:
+		return "dataset-busy"
+	case ZFSErrorClassPermissionDenied:
+		return "permission-denied"
+	case ZFSErrorClassNoSuchDataset:
+		return "no-such-dataset"
+	case ZFSErrorClassPoolSuspended:
+		return "pool-suspended"
+	case ZFSErrorClassOutOfSpace:
+		return "out-of-space"
+	case ZFSErrorClassHoldExists:
+		return "hold-exists"
+	case ZFSErrorClassNoResumableState:
+		return "no-resumable-state"
+	case ZFSErrorClassNoSuchHold:
+		return "no-such-hold"
+	case ZFSErrorClassBookmarkExists:
+		return "bookmark-exists"
+	case ZFSErrorClassNoSnapshotsToDestroy:
+		return "no-snapshots-to-destroy"
+	case ZFSErrorClassResumeTokenCorrupt:
+		return "resume-token-corrupt"
+	default:
+		return "unknown"
+	}
+}
+
+// Temporary returns true if the failed operation can succeed when retried later without intervention.
+// Replication retries steps that failed with a temporary error, other callers do not retry.
+func (c ZFSErrorClass) Temporary() bool {
+	return c == ZFSErrorClassDatasetBusy
+}
+
+// Hint returns an actionable message for the user, or "" for ZFSErrorClassUnknown.
+func (c ZFSErrorClass) Hint() string {
+	switch c {
+	case ZFSErrorClassDatasetBusy:
+		return "the dataset is busy (e.g. mounted and in use, or a concurrent zfs operation), the operation can succeed once the dataset is no longer in use"
+	case ZFSErrorClassPermissionDenied:
+		return "zrepl lacks the permission to perform the zfs operation, check that it runs as root or the required `zfs allow` permissions"
+	case ZFSErrorClassNoSuchDataset:
+		return "the dataset does not exist (anymore), check whether it was destroyed or renamed"
+	case ZFSErrorClassPoolSuspended:
+		return "the pool is suspended due to I/O failures, check `zpool status` and run `zpool clear` once the devices are available"
+	case ZFSErrorClassOutOfSpace:
+		return "the pool or dataset is out of space, free up space (e.g., through pruning) or increase quotas"
+	default:
+		return ""
+	}
+}
+
+// checked in order, the first match wins
+var zfsErrorClassPatterns = []struct {
+	class ZFSErrorClass
+	re    *regexp.Regexp
+}{
+	{ZFSErrorClassPoolSuspended, regexp.MustCompile(`(?i)pool I/O is currently suspended|pool is suspended`)},
+	{ZFSErrorClassPermissionDenied, regexp.MustCompile(`(?i)permission denied|insufficient privileges`)},
+	{ZFSErrorClassOutOfSpace, regexp.MustCompile(`(?i)out of space|no space left on device|quota exceeded`)},
+	{ZFSErrorClassDatasetBusy, regexp.MustCompile(`(?i)dataset is busy|device or resource busy`)},
+	{ZFSErrorClassNoSuchDataset, regexp.MustCompile(`(?i)dataset does not exist|no such pool or dataset|no such pool`)},
+	{ZFSErrorClassHoldExists, regexp.MustCompile(`tag already exists on this dataset`)},
+	{ZFSErrorClassNoResumableState, regexp.MustCompile(`does not have any resumable receive state to abort`)},
+	{ZFSErrorClassNoSuchHold, regexp.MustCompile(`no such tag on this dataset`)},
+	{ZFSErrorClassBookmarkExists, regexp.MustCompile(`^cannot create bookmark '[^']+': bookmark exists`)},
+	{ZFSErrorClassNoSnapshotsToDestroy, regexp.MustCompile(`^could not find any snapshots to destroy; check snapshot names.`)},
+	{ZFSErrorClassResumeTokenCorrupt, regexp.MustCompile(`resume token is corrupt`)},
+}
+
+// ClassifyZFSStderr classifies the stderr output of a failed zfs (or zpool) command.
+func ClassifyZFSStderr(stderr []byte) ZFSErrorClass {
+	for _, line := range bytes.Split(stderr, []byte("\n")) {
+		for _, p := range zfsErrorClassPatterns {
+			if p.re.Match(line) {
+				return p.class
+			}
+		}
+	}
+	return ZFSErrorClassUnknown
+}
+
+func (e *ZFSError) Class() ZFSErrorClass {
+	return ClassifyZFSStderr(e.Stderr)
+}
+
+func (e *DatasetDoesNotExist) Class() ZFSErrorClass {
+	return ZFSErrorClassNoSuchDataset
+}
+
+// Class returns the class of the first reason that can be classified.
+func (e *DestroySnapshotsError) Class() ZFSErrorClass {
+	for _, r := range e.Reason {
+		if c := ClassifyZFSStderr([]byte(r)); c != ZFSErrorClassUnknown {
+			return c
+		}
+	}
+	return ZFSErrorClassUnknown
+}
+
+func (e *ClearResumeTokenError) Class() ZFSErrorClass {
+	return ClassifyZFSStderr(e.ZFSOutput)
+}
+
+type classifiedError interface {
+	error
+	Class() ZFSErrorClass
+}
+
+var _ classifiedError = (*ZFSError)(nil)
+var _ classifiedError = (*DatasetDoesNotExist)(nil)
+var _ classifiedError = (*DestroySnapshotsError)(nil)
+var _ classifiedError = (*ClearResumeTokenError)(nil)
+
+// ZFSErrorClassOf classifies err.
+//
+// Errors that wrap one of the error types of this package are classified by their type.
+// All other errors are classified by their message, which covers errors that lost their type,
+// e.g., because they were returned by a remote endpoint.
+func ZFSErrorClassOf(err error) ZFSErrorClass {
+	if err == nil {
+		return ZFSErrorClassUnknown
+	}
+	if e, ok := errors.Cause(err).(classifiedError); ok {
+		return e.Class()
+	}
+	return ClassifyZFSStderr([]byte(err.Error()))
+}
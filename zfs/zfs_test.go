@@ -1,12 +1,18 @@
 package zfs
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/daemon/logging/trace"
 )
 
 // FIXME make this a platformtest
@@ -304,3 +310,281 @@ func TestTryRecvDestroyOrOverwriteEncryptedErr(t *testing.T) {
 	require.NotNil(t, err)
 	assert.EqualError(t, err, strings.TrimSpace(msg))
 }
+
+func TestBuildCommonSendArgsRaw(t *testing.T) {
+	to := &ZFSSendArgVersion{RelName: "@b", GUID: 1}
+	for _, c := range []struct {
+		encrypted, raw bool
+		expectW        bool
+	}{
+		{false, false, false},
+		{true, false, true},
+		{false, true, true},
+		{true, true, true},
+	} {
+		a := ZFSSendArgsUnvalidated{FS: "pool/fs", To: to, Encrypted: &NilBool{B: c.encrypted}, Raw: c.raw}
+		args, err := a.buildCommonSendArgs()
+		require.NoError(t, err)
+		assert.Equal(t, c.expectW, len(args) > 0 && args[0] == "-w", "%#v => %v", c, args)
+	}
+}
+
+func TestBuildCommonSendArgsSendFlags(t *testing.T) {
+	to := &ZFSSendArgVersion{RelName: "@b", GUID: 1}
+	a := ZFSSendArgsUnvalidated{FS: "pool/fs", To: to, Encrypted: &NilBool{B: false}, Compressed: true, EmbeddedData: true, LargeBlocks: true}
+	args, err := a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-c", "-e", "-L", "pool/fs@b"}, args)
+
+	// implied by raw sends
+	a.Raw = true
+	args, err = a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-w", "pool/fs@b"}, args)
+
+	// not implied by raw sends
+	a.Properties = true
+	args, err = a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-w", "-p", "pool/fs@b"}, args)
+	a.Properties, a.BackupProperties = false, true
+	args, err = a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-w", "-b", "pool/fs@b"}, args)
+}
+
+func TestBuildCommonSendArgsIntermediates(t *testing.T) {
+	from := &ZFSSendArgVersion{RelName: "@a", GUID: 1}
+	to := &ZFSSendArgVersion{RelName: "@c", GUID: 3}
+	a := ZFSSendArgsUnvalidated{FS: "pool/fs", From: from, To: to, Encrypted: &NilBool{B: false}}
+	args, err := a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-i", "pool/fs@a", "pool/fs@c"}, args)
+
+	a.Intermediates = true
+	args, err = a.buildCommonSendArgs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-I", "pool/fs@a", "pool/fs@c"}, args)
+}
+
+func TestParseZPoolEnabledFeatures(t *testing.T) {
+	output := "size\t1000\nfeature@async_destroy\tenabled\nfeature@large_blocks\tdisabled\nfeature@embedded_data\tactive\n"
+	features, err := parseZPoolEnabledFeatures([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"async_destroy", "embedded_data"}, features)
+
+	_, err = parseZPoolEnabledFeatures([]byte("garbage\n"))
+	assert.Error(t, err)
+}
+
+func TestCommonAncestor(t *testing.T) {
+	dp := func(s string) *DatasetPath {
+		p, err := NewDatasetPath(s)
+		require.NoError(t, err)
+		return p
+	}
+	assert.Equal(t, "pool/a", commonAncestor(dp("pool/a/b"), dp("pool/a/c/d")).ToString())
+	assert.Equal(t, "pool/a/b", commonAncestor(dp("pool/a/b"), dp("pool/a/b/c")).ToString())
+	assert.Equal(t, "pool", commonAncestor(dp("pool/a"), dp("pool/ab")).ToString())
+	assert.Equal(t, "pool/a", commonAncestor(dp("pool/a"), dp("pool/a")).ToString())
+}
+
+func TestParseZFSHoldsBatchOutput(t *testing.T) {
+	res := map[string][]string{"p/fs@a": nil, "p/fs@b": nil, "p/fs@c": nil}
+	output := "p/fs@a\ttag1\tThu Jan  1 00:00 1970\np/fs@a\ttag2\tThu Jan  1 00:00 1970\np/fs@c\ttag1\tThu Jan  1 00:00 1970\n"
+	require.NoError(t, parseZFSHoldsBatchOutput([]byte(output), res))
+	assert.Equal(t, map[string][]string{"p/fs@a": {"tag1", "tag2"}, "p/fs@b": nil, "p/fs@c": {"tag1"}}, res)
+
+	err := parseZFSHoldsBatchOutput([]byte("p/fs@d\ttag1\tThu Jan  1 00:00 1970\n"), res)
+	assert.Error(t, err)
+}
+
+func TestPoolCapabilitiesFromEnabled(t *testing.T) {
+	c := poolCapabilitiesFromEnabled("p", []string{"bookmarks", "encryption", "extensible_dataset", "lz4_compress"})
+	assert.True(t, c.Bookmarks)
+	assert.False(t, c.BookmarksV2)
+	assert.True(t, c.Encryption)
+	assert.True(t, c.ResumableReceive)
+	assert.False(t, c.LargeBlocks)
+	assert.False(t, c.Redaction)
+	assert.True(t, c.Has("lz4_compress"))
+	assert.False(t, c.Has("lz4"))
+}
+
+func TestParseSendStreamHeader(t *testing.T) {
+	begin := func(bo binary.ByteOrder, hdrtype uint64, payloadLen, objsetType uint32) []byte {
+		b := make([]byte, 312)
+		bo.PutUint32(b[0:], 0) // DRR_BEGIN
+		bo.PutUint32(b[4:], payloadLen)
+		bo.PutUint64(b[8:], 0x2F5bacbac)
+		bo.PutUint64(b[16:], hdrtype)
+		bo.PutUint32(b[32:], objsetType)
+		return b
+	}
+
+	h, err := ParseSendStreamHeader(begin(binary.LittleEndian, 1, 0, 3))
+	require.NoError(t, err)
+	assert.Equal(t, SendStreamHeader{ObjsetType: SendStreamObjsetTypeVolume}, h)
+
+	h, err = ParseSendStreamHeader(begin(binary.BigEndian, 1, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, SendStreamHeader{ObjsetType: SendStreamObjsetTypeFilesystem}, h)
+
+	// compound stream: begin record, payload, end record, substream
+	compound := begin(binary.LittleEndian, 2, 16, 0)
+	compound = append(compound, make([]byte, 16)...)
+	end := make([]byte, 312)
+	binary.LittleEndian.PutUint32(end, 5) // DRR_END
+	compound = append(compound, end...)
+	h, err = ParseSendStreamHeader(compound)
+	require.NoError(t, err)
+	assert.Equal(t, SendStreamHeader{Compound: true}, h)
+	compound = append(compound, begin(binary.LittleEndian, 1, 0, 3)...)
+	h, err = ParseSendStreamHeader(compound)
+	require.NoError(t, err)
+	assert.Equal(t, SendStreamHeader{ObjsetType: SendStreamObjsetTypeVolume, Compound: true}, h)
+
+	_, err = ParseSendStreamHeader(begin(binary.LittleEndian, 1, 0, 3)[:20])
+	assert.Error(t, err)
+	_, err = ParseSendStreamHeader(make([]byte, 312))
+	assert.Error(t, err)
+}
+
+func TestSendStreamDigest(t *testing.T) {
+	// begin record with nvlist payload, object record with bonus buffer, write record with data, free record, end record
+	stream := func(bo binary.ByteOrder, toname string, data string, checksum byte) []byte {
+		rec := func(drrType uint32) []byte {
+			b := make([]byte, 312)
+			bo.PutUint32(b[0:], drrType)
+			b[280] = checksum // drr_checksum
+			return b
+		}
+		var s []byte
+		begin := rec(0)
+		bo.PutUint32(begin[4:], 8)
+		bo.PutUint64(begin[8:], 0x2F5bacbac)
+		bo.PutUint64(begin[16:], 1)
+		copy(begin[56:], toname) // drr_toname
+		s = append(s, begin...)
+		s = append(s, make([]byte, 8)...)
+		object := rec(1)
+		bo.PutUint64(object[8:], 42)
+		bo.PutUint32(object[28:], 3) // drr_bonuslen, padded to 8
+		s = append(s, object...)
+		s = append(s, []byte("bon\x00\x00\x00\x00\x00")...)
+		write := rec(3)
+		bo.PutUint64(write[8:], 42)
+		bo.PutUint64(write[24:], 4096)
+		bo.PutUint64(write[32:], uint64(len(data)))
+		write[48] = checksum // drr_checksumtype
+		s = append(s, write...)
+		s = append(s, data...)
+		free := rec(4)
+		bo.PutUint64(free[8:], 42)
+		bo.PutUint64(free[24:], ^uint64(0))
+		s = append(s, free...)
+		s = append(s, rec(5)...)
+		return s
+	}
+
+	digest := func(s []byte) string {
+		d, n, err := SendStreamDigest(bytes.NewReader(s))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(s)), n)
+		return d
+	}
+
+	sender := digest(stream(binary.LittleEndian, "pool/fs@a", "data", 1))
+	assert.Equal(t, sender, digest(stream(binary.LittleEndian, "sink/pool/fs@a", "data", 2)))
+	assert.Equal(t, sender, digest(stream(binary.BigEndian, "sink/pool/fs@a", "data", 2)))
+	assert.NotEqual(t, sender, digest(stream(binary.LittleEndian, "pool/fs@a", "dat4", 1)))
+
+	truncated := stream(binary.LittleEndian, "pool/fs@a", "data", 1)
+	_, _, err := SendStreamDigest(bytes.NewReader(truncated[:len(truncated)-312]))
+	assert.Error(t, err)
+	_, _, err = SendStreamDigest(bytes.NewReader(truncated[:400]))
+	assert.Error(t, err)
+}
+
+func TestRecvOverridePropertiesArgs(t *testing.T) {
+	assert.Empty(t, recvOverridePropertiesArgs(nil))
+	args := recvOverridePropertiesArgs(map[string]string{"volmode": "none", "refreservation": "none"})
+	assert.Equal(t, []string{"-o", "refreservation=none", "-o", "volmode=none"}, args)
+}
+
+func TestPoolScheduler(t *testing.T) {
+	ctx := context.Background()
+	defer trace.WithTaskFromStackUpdateCtx(&ctx)()
+
+	dp := func(s string) *DatasetPath {
+		p, err := NewDatasetPath(s)
+		require.NoError(t, err)
+		return p
+	}
+	s := NewPoolScheduler(1)
+	g, err := s.Acquire(ctx, dp("a/fs1"))
+	require.NoError(t, err)
+
+	// other pools are not affected
+	gb, err := s.Acquire(ctx, dp("b/fs1"))
+	require.NoError(t, err)
+	gb.Release()
+
+	// same pool blocks until released
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(cctx, dp("a/fs2"))
+	assert.Error(t, err)
+
+	g.Release()
+	g, err = s.Acquire(ctx, dp("a/fs2"))
+	require.NoError(t, err)
+	g.Release()
+}
+
+func TestClassifyZFSStderr(t *testing.T) {
+	tcs := map[string]ZFSErrorClass{
+		"cannot destroy 'pool/fs@snap': dataset is busy\n":                                ZFSErrorClassDatasetBusy,
+		"cannot open 'pool/fs': permission denied\n":                                      ZFSErrorClassPermissionDenied,
+		"cannot open 'pool/nonexistent': dataset does not exist\n":                        ZFSErrorClassNoSuchDataset,
+		"cannot receive incremental stream: out of space\n":                               ZFSErrorClassOutOfSpace,
+		"cannot create snapshot 'pool/fs@snap': pool I/O is currently suspended\n":        ZFSErrorClassPoolSuspended,
+		"cannot receive new filesystem stream: invalid backup stream\n":                   ZFSErrorClassUnknown,
+		"warning: something\ncannot destroy snapshot pool/fs@a: dataset is busy\n":        ZFSErrorClassDatasetBusy,
+		"cannot hold snapshot 'pool/fs@snap': tag already exists on this dataset\n":       ZFSErrorClassHoldExists,
+		"'pool/fs' does not have any resumable receive state to abort\n":                  ZFSErrorClassNoResumableState,
+		"cannot release hold from snapshot 'pool/fs@snap': no such tag on this dataset\n": ZFSErrorClassNoSuchHold,
+		"cannot create bookmark 'pool/fs#book': bookmark exists\n":                        ZFSErrorClassBookmarkExists,
+		"could not find any snapshots to destroy; check snapshot names.\n":                ZFSErrorClassNoSnapshotsToDestroy,
+		"cannot resume send: resume token is corrupt\n":                                   ZFSErrorClassResumeTokenCorrupt,
+	}
+	for stderr, expect := range tcs {
+		assert.Equal(t, expect, ClassifyZFSStderr([]byte(stderr)), "%q", stderr)
+	}
+
+	zfsErr := &ZFSError{Stderr: []byte("cannot open 'pool/fs': dataset is busy"), WaitErr: errors.New("exit status 1")}
+	assert.Equal(t, ZFSErrorClassDatasetBusy, ZFSErrorClassOf(errors.Wrap(zfsErr, "destroy")))
+	assert.True(t, ZFSErrorClassOf(zfsErr).Temporary())
+	assert.Contains(t, zfsErr.Error(), "hint: ")
+	assert.Equal(t, ZFSErrorClassNoSuchDataset, ZFSErrorClassOf(&DatasetDoesNotExist{Path: "pool/fs"}))
+	destroyErr := &DestroySnapshotsError{Filesystem: "pool/fs", Undestroyable: []string{"a"}, Reason: []string{"dataset is busy"}}
+	assert.Equal(t, ZFSErrorClassDatasetBusy, ZFSErrorClassOf(errors.Wrap(destroyErr, "prune")))
+	// the type takes precedence over the message
+	assert.Equal(t, ZFSErrorClassUnknown, ZFSErrorClassOf(&ZFSError{Stderr: []byte("invalid backup stream"), WaitErr: errors.New("dataset is busy")}))
+	// errors from remote endpoints are classified by their message
+	assert.Equal(t, ZFSErrorClassOutOfSpace, ZFSErrorClassOf(errors.New("zfs exited with error: exit status 1\nstderr:\ncannot receive incremental stream: out of space")))
+	assert.Equal(t, ZFSErrorClassUnknown, ZFSErrorClassOf(nil))
+}
+
+func TestListFilesystemVersionsOptionsUserProperties(t *testing.T) {
+	o := ListFilesystemVersionsOptions{UserProperties: []string{"com.example:keep", "com.example:owner"}}
+	assert.Equal(t, []string{"name", "guid", "createtxg", "creation", "userrefs", "com.example:keep", "com.example:owner"}, o.listProperties())
+
+	var v FilesystemVersion
+	o.parseUserProperties(&v, []string{"true", "-"})
+	assert.Equal(t, map[string]string{"com.example:keep": "true", "com.example:owner": ""}, v.UserProperties)
+
+	v = FilesystemVersion{}
+	(&ListFilesystemVersionsOptions{}).parseUserProperties(&v, nil)
+	assert.Nil(t, v.UserProperties)
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/zrepl/zrepl/daemon/logging/trace"
 	"github.com/zrepl/zrepl/util/circlog"
+	"github.com/zrepl/zrepl/util/semaphore"
 )
 
 type Cmd struct {
@@ -24,6 +25,7 @@ type Cmd struct {
 	mtx                                      sync.RWMutex
 	startedAt, waitStartedAt, waitReturnedAt time.Time
 	waitReturnEndSpanCb                      trace.DoneFunc
+	unbudgeted                               bool
 }
 
 func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
@@ -31,8 +33,27 @@ func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
 	return &Cmd{cmd: cmd, ctx: ctx}
 }
 
+// Unbudgeted exempts c from the budget of zfs commands (see SetBudget).
+// It is meant for commands that wait for ZFS instead of doing work, e.g., zfs wait.
+func (c *Cmd) Unbudgeted() *Cmd {
+	c.unbudgeted = true
+	return c
+}
+
+func (c *Cmd) acquireBudget() (*semaphore.AcquireGuard, error) {
+	if c.unbudgeted {
+		return nil, nil
+	}
+	return AcquireBudget(c.ctx)
+}
+
 // err.(*exec.ExitError).Stderr will NOT be set
 func (c *Cmd) CombinedOutput() (o []byte, err error) {
+	guard, err := c.acquireBudget()
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
 	c.startPre(false)
 	c.startPost(nil)
 	c.waitPre()
@@ -43,6 +64,11 @@ func (c *Cmd) CombinedOutput() (o []byte, err error) {
 
 // err.(*exec.ExitError).Stderr will be set
 func (c *Cmd) Output() (o []byte, err error) {
+	guard, err := c.acquireBudget()
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
 	c.startPre(false)
 	c.startPost(nil)
 	c.waitPre()
@@ -0,0 +1,31 @@
+package zfscmd
+
+import (
+	"context"
+
+	"github.com/zrepl/zrepl/util/semaphore"
+)
+
+// BudgetFunc blocks until a zfs command that runs with ctx may start, or ctx is done.
+// The returned guard is released when the command is complete, it may be nil.
+type BudgetFunc func(ctx context.Context) (*semaphore.AcquireGuard, error)
+
+// nil means unlimited
+var budget BudgetFunc
+
+// SetBudget sets the budget that limits the zfs commands, e.g., the daemon-wide budget of package daemon/scheduler.
+//
+// Must be called before any command is run, i.e., during daemon initialization.
+func SetBudget(f BudgetFunc) {
+	budget = f
+}
+
+// AcquireBudget acquires the budget of SetBudget for a zfs command that runs with ctx
+// and that is not run through this package, e.g., because its output is streamed.
+// AcquireGuard.Release is a no-op for the returned guard if no budget is set.
+func AcquireBudget(ctx context.Context) (*semaphore.AcquireGuard, error) {
+	if budget == nil {
+		return nil, nil
+	}
+	return budget(ctx)
+}
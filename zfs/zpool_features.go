@@ -0,0 +1,156 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/util/envconst"
+	"github.com/zrepl/zrepl/zfs/zfscmd"
+)
+
+// ZPoolEnabledFeatures returns the names of the features of pool
+// that are either enabled or active, sorted lexicographically.
+func ZPoolEnabledFeatures(ctx context.Context, pool string) ([]string, error) {
+	if pool == "" {
+		return nil, fmt.Errorf("`pool` must not be empty")
+	}
+	output, err := zfscmd.CommandContext(ctx, "zpool", "get", "-H", "-p", "-o", "property,value", "all", pool).CombinedOutput()
+	if err != nil {
+		return nil, &ZFSError{output, errors.Wrapf(err, "cannot get features of pool %q", pool)}
+	}
+	return parseZPoolEnabledFeatures(output)
+}
+
+func parseZPoolEnabledFeatures(output []byte) ([]string, error) {
+	var features []string
+	scan := bufio.NewScanner(bytes.NewReader(output))
+	for scan.Scan() {
+		// PROPERTY                VALUE
+		comps := strings.SplitN(scan.Text(), "\t", 2)
+		if len(comps) != 2 {
+			return nil, fmt.Errorf("zpool get: unexpected output line %q", scan.Text())
+		}
+		if !strings.HasPrefix(comps[0], "feature@") {
+			continue
+		}
+		switch comps[1] {
+		case "enabled", "active":
+			features = append(features, strings.TrimPrefix(comps[0], "feature@"))
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(features)
+	return features, nil
+}
+
+// PoolCapabilities describes what a pool (and the ZFS version that manages it)
+// supports, as far as it is relevant to zrepl.
+type PoolCapabilities struct {
+	Pool string
+	// all features that are enabled or active, sorted lexicographically
+	Enabled []string
+
+	Bookmarks        bool // feature@bookmarks
+	BookmarksV2      bool // feature@bookmark_v2
+	Encryption       bool // feature@encryption
+	ResumableReceive bool // feature@extensible_dataset
+	LargeBlocks      bool // feature@large_blocks
+	Redaction        bool // feature@redaction_bookmarks
+	// Not a pool feature but a capability of the ZFS version (`zfs program`).
+	ChannelPrograms bool
+}
+
+// Has returns true if feature (without the `feature@` prefix) is enabled or active.
+func (c *PoolCapabilities) Has(feature string) bool {
+	i := sort.SearchStrings(c.Enabled, feature)
+	return i < len(c.Enabled) && c.Enabled[i] == feature
+}
+
+var poolFeaturesCacheTTL = envconst.Duration("ZREPL_ZFS_POOL_FEATURES_CACHE_TTL", 10*time.Minute)
+
+var poolFeaturesCache struct {
+	mtx sync.Mutex
+	m   map[string]poolFeaturesCacheEntry
+}
+
+type poolFeaturesCacheEntry struct {
+	caps    *PoolCapabilities
+	fetched time.Time
+}
+
+// PoolFeatures returns the capabilities of pool.
+//
+// Results are cached per pool for ZREPL_ZFS_POOL_FEATURES_CACHE_TTL because features
+// only change through administrative action (`zpool upgrade`, `zpool set feature@...`).
+// Errors are not cached.
+// The returned value is shared and must not be modified.
+func PoolFeatures(ctx context.Context, pool string) (*PoolCapabilities, error) {
+	poolFeaturesCache.mtx.Lock()
+	e, ok := poolFeaturesCache.m[pool]
+	poolFeaturesCache.mtx.Unlock()
+	if ok && time.Since(e.fetched) < poolFeaturesCacheTTL {
+		return e.caps, nil
+	}
+
+	enabled, err := ZPoolEnabledFeatures(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	caps := poolCapabilitiesFromEnabled(pool, enabled)
+	if caps.ChannelPrograms, err = channelProgramsSupported(ctx); err != nil {
+		caps.ChannelPrograms = false // not essential, don't fail the whole probe
+	}
+
+	// we take the lock late, so two updaters might check simultaneously, but that shouldn't hurt
+	poolFeaturesCache.mtx.Lock()
+	defer poolFeaturesCache.mtx.Unlock()
+	if poolFeaturesCache.m == nil {
+		poolFeaturesCache.m = make(map[string]poolFeaturesCacheEntry)
+	}
+	poolFeaturesCache.m[pool] = poolFeaturesCacheEntry{caps, time.Now()}
+	return caps, nil
+}
+
+// enabled must be sorted
+func poolCapabilitiesFromEnabled(pool string, enabled []string) *PoolCapabilities {
+	c := &PoolCapabilities{Pool: pool, Enabled: enabled}
+	c.Bookmarks = c.Has("bookmarks")
+	c.BookmarksV2 = c.Has("bookmark_v2")
+	c.Encryption = c.Has("encryption")
+	c.ResumableReceive = c.Has("extensible_dataset")
+	c.LargeBlocks = c.Has("large_blocks")
+	c.Redaction = c.Has("redaction_bookmarks")
+	return c
+}
+
+var channelProgramsSupportedCheck struct {
+	once      sync.Once
+	supported bool
+	err       error
+}
+
+func channelProgramsSupported(ctx context.Context) (bool, error) {
+	channelProgramsSupportedCheck.once.Do(func() {
+		// "feature discovery": the usage message lists the subcommand if it is supported
+		cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "program")
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); !ok {
+			debug("channel program feature check failed: %T %s", err, err)
+			channelProgramsSupportedCheck.err = err
+		}
+		channelProgramsSupportedCheck.supported = bytes.Contains(output, []byte("program [-jn]"))
+		debug("channel program feature check complete %#v", &channelProgramsSupportedCheck)
+	})
+	return channelProgramsSupportedCheck.supported, channelProgramsSupportedCheck.err
+}